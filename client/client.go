@@ -0,0 +1,473 @@
+// Package client provides a client for the HTTP API of lockerd.
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Infinite timeout.
+//
+// A lease timeout that results in a lease that never expires.
+const InfiniteTimeout time.Duration = -1
+
+// Lock mode.
+type LockMode string
+
+const (
+	// Exclusive lock mode.
+	ModeExclusive LockMode = "exclusive"
+
+	// Shared lock mode.
+	ModeShared LockMode = "shared"
+)
+
+// Acquisition options.
+type AcquireOptions struct {
+	// Lock mode. Defaults to exclusive.
+	Mode LockMode
+
+	// Owner identity, allowing the owner to re-enter locks it already holds.
+	Owner string
+
+	// Try to acquire the lock without waiting. If the lock is held, ErrConflict is returned.
+	Try bool
+
+	// Arbitrary metadata describing the acquirer, such as its host or job.
+	Labels map[string]string
+
+	// Semaphore capacity. If positive, a permit of the lock is acquired in shared mode, held by at most as many
+	// acquirers at a time.
+	Capacity int
+}
+
+// Acquired lock.
+type Lock struct {
+	// Lock path.
+	Path string
+
+	// Ticket ID, identifying the lease of the lock.
+	Id int64
+
+	// Fencing token.
+	Fence int64
+}
+
+// Lock holder state.
+type LockHolder struct {
+	Id      int64
+	Fence   int64
+	Owner   string
+	Labels  map[string]string
+	Depth   int
+	Timeout time.Duration
+}
+
+// Lock acquirer state.
+type LockAcquirer struct {
+	Id      int64
+	Mode    LockMode
+	Timeout time.Duration
+	Owner   string
+	Labels  map[string]string
+}
+
+// Lock state.
+type LockState struct {
+	LockingId      int64
+	LockTimeout    time.Duration
+	Mode           LockMode
+	Fence          int64
+	Depth          int
+	Holders        []LockHolder
+	Acquirers      []LockAcquirer
+	AcquirersTotal int
+	Capacity       int
+	Permits        int
+}
+
+// lockerd HTTP API client.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// New client.
+//
+// Creates a client for the server at the given base URL, such as http://localhost:12000, performing requests with the
+// given HTTP client. If the HTTP client is nil, the default HTTP client is used.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// Acquire a lock.
+//
+// Waits for up to the lock timeout for the lock to be acquired, returning ErrTimeout if it is not. Canceling the
+// context abandons the acquisition. Acquisition options may optionally be provided, of which only the first are
+// considered.
+func (c *Client) Acquire(ctx context.Context, path string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (*Lock, error) {
+	var acquireOptions AcquireOptions
+	if len(options) > 0 {
+		acquireOptions = options[0]
+	}
+
+	params := url.Values{
+		"lease_timeout": []string{formatDuration(leaseTimeout)},
+	}
+
+	if acquireOptions.Try {
+		params.Set("try", "true")
+	} else {
+		params.Set("lock_timeout", formatDuration(lockTimeout))
+	}
+	if acquireOptions.Mode != "" {
+		params.Set("mode", string(acquireOptions.Mode))
+	}
+	if acquireOptions.Owner != "" {
+		params.Set("owner", acquireOptions.Owner)
+	}
+	for key, value := range acquireOptions.Labels {
+		params.Add("labels", key+"="+value)
+	}
+	if acquireOptions.Capacity > 0 {
+		params.Set("capacity", strconv.Itoa(acquireOptions.Capacity))
+	}
+
+	var result struct {
+		Id    ticketId `json:"id"`
+		Fence int64    `json:"fence,string"`
+	}
+
+	if err := c.do(ctx, "POST", path, params, &result); err != nil {
+		return nil, err
+	}
+
+	return &Lock{
+		Path:  path,
+		Id:    int64(result.Id),
+		Fence: result.Fence,
+	}, nil
+}
+
+// Release a lock.
+//
+// Returns ErrNotFound if the ticket is neither holding nor waiting for the lock.
+func (c *Client) Release(ctx context.Context, path string, id int64) error {
+	return c.do(ctx, "DELETE", path, url.Values{
+		"id": []string{strconv.FormatInt(id, 10)},
+	}, nil)
+}
+
+// Extend a lease.
+//
+// Extends the lease to expire no sooner than the given timeout from now, and returns whether the lease was changed.
+// Servers responding without content do not report whether it was, in which case it is assumed to have changed.
+// Returns ErrNotFound if the ticket is not holding the lock.
+func (c *Client) Extend(ctx context.Context, path string, id int64, leaseTimeout time.Duration) (bool, error) {
+	result := struct {
+		Changed bool `json:"changed"`
+	}{
+		Changed: true,
+	}
+
+	err := c.do(ctx, "PATCH", path, url.Values{
+		"id":            []string{strconv.FormatInt(id, 10)},
+		"lease_timeout": []string{formatDuration(leaseTimeout)},
+	}, &result)
+
+	return result.Changed, err
+}
+
+// Inspect a lock.
+//
+// Returns ErrNotFound if the lock is not held.
+func (c *Client) Inspect(ctx context.Context, path string) (*LockState, error) {
+	var result lockStateResponse
+
+	if err := c.do(ctx, "GET", path, nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result.lockState()
+}
+
+// Inspect all locks.
+func (c *Client) InspectAll(ctx context.Context) (map[string]LockState, error) {
+	var result map[string]lockStateResponse
+
+	if err := c.do(ctx, "GET", "/", nil, &result); err != nil {
+		return nil, err
+	}
+
+	return lockStates(result)
+}
+
+// Inspect a range of locks.
+//
+// Returns the locks whose paths start with the prefix and sort after the cursor, up to the limit in the order of their
+// paths, which must be positive. If more locks remain, the cursor of the next range is returned, otherwise the cursor
+// is empty.
+func (c *Client) InspectRange(ctx context.Context, prefix string, cursor string, limit int) (map[string]LockState, string, error) {
+	var result struct {
+		Locks      map[string]lockStateResponse `json:"locks"`
+		NextCursor string                       `json:"next_cursor"`
+	}
+
+	err := c.do(ctx, "GET", "/", url.Values{
+		"prefix": []string{prefix},
+		"cursor": []string{cursor},
+		"limit":  []string{strconv.Itoa(limit)},
+	}, &result)
+	if err != nil {
+		return nil, "", err
+	}
+
+	states, err := lockStates(result.Locks)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return states, result.NextCursor, nil
+}
+
+// Perform a request.
+//
+// Form parameters are sent in the request body for methods that carry one, and in the query string otherwise. A
+// successful response is decoded into the result if not nil, leaving the result untouched if the response has no
+// content, while error responses are returned as an *Error.
+func (c *Client) do(ctx context.Context, method, path string, params url.Values, result interface{}) error {
+	reqURL := c.baseURL + "/" + strings.TrimPrefix(path, "/")
+
+	var body io.Reader
+	if method == "GET" || method == "DELETE" {
+		if len(params) > 0 {
+			reqURL += "?" + params.Encode()
+		}
+	} else {
+		body = strings.NewReader(params.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 204 {
+		return decodeError(resp)
+	}
+
+	if result == nil || resp.StatusCode == 204 {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Lock state response.
+type lockStateResponse struct {
+	LockingId      ticketId               `json:"locking_id"`
+	LockTimeout    string                 `json:"lock_timeout"`
+	Mode           LockMode               `json:"mode"`
+	Fence          int64                  `json:"fence,string"`
+	Depth          int                    `json:"depth"`
+	Holders        []lockHolderResponse   `json:"holders"`
+	Acquirers      []lockAcquirerResponse `json:"acquirers"`
+	AcquirersTotal int                    `json:"acquirers_total"`
+	Capacity       int                    `json:"capacity"`
+	Permits        int                    `json:"permits"`
+}
+
+// Lock holder response.
+type lockHolderResponse struct {
+	Id      ticketId          `json:"id"`
+	Fence   int64             `json:"fence,string"`
+	Owner   string            `json:"owner"`
+	Labels  map[string]string `json:"labels"`
+	Depth   int               `json:"depth"`
+	Timeout string            `json:"timeout"`
+}
+
+// Lock acquirer response.
+type lockAcquirerResponse struct {
+	Id      ticketId          `json:"id"`
+	Mode    LockMode          `json:"mode"`
+	Timeout string            `json:"timeout"`
+	Owner   string            `json:"owner"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// Convert lock state responses by path.
+func lockStates(responses map[string]lockStateResponse) (map[string]LockState, error) {
+	states := make(map[string]LockState, len(responses))
+
+	for path, resp := range responses {
+		state, err := resp.lockState()
+		if err != nil {
+			return nil, err
+		}
+
+		states[path] = *state
+	}
+
+	return states, nil
+}
+
+// Convert a lock state response.
+func (r lockStateResponse) lockState() (*LockState, error) {
+	lockTimeout, err := parseDuration(r.LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &LockState{
+		LockingId:      int64(r.LockingId),
+		LockTimeout:    lockTimeout,
+		Mode:           r.Mode,
+		Fence:          r.Fence,
+		Depth:          r.Depth,
+		Holders:        make([]LockHolder, len(r.Holders)),
+		Acquirers:      make([]LockAcquirer, len(r.Acquirers)),
+		AcquirersTotal: r.AcquirersTotal,
+		Capacity:       r.Capacity,
+		Permits:        r.Permits,
+	}
+
+	for idx, holder := range r.Holders {
+		timeout, err := parseDuration(holder.Timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		state.Holders[idx] = LockHolder{
+			Id:      int64(holder.Id),
+			Fence:   holder.Fence,
+			Owner:   holder.Owner,
+			Labels:  holder.Labels,
+			Depth:   holder.Depth,
+			Timeout: timeout,
+		}
+	}
+
+	for idx, acquirer := range r.Acquirers {
+		timeout, err := parseDuration(acquirer.Timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		state.Acquirers[idx] = LockAcquirer{
+			Id:      int64(acquirer.Id),
+			Mode:    acquirer.Mode,
+			Timeout: timeout,
+			Owner:   acquirer.Owner,
+			Labels:  acquirer.Labels,
+		}
+	}
+
+	return state, nil
+}
+
+// Format a duration for a request.
+//
+// Durations are formatted in whole milliseconds, rounding up so a positive duration is never formatted as zero.
+func formatDuration(dur time.Duration) string {
+	if dur < 0 {
+		return "infinite"
+	}
+
+	if dur == 0 {
+		return "0"
+	}
+
+	return fmt.Sprintf("%dms", (dur+time.Millisecond-1)/time.Millisecond)
+}
+
+// Parse a duration of a response.
+//
+// Durations are formatted by the server as Go durations, except for an optional leading number of days, and the
+// infinite sentinel.
+func parseDuration(dur string) (time.Duration, error) {
+	if dur == "infinite" {
+		return InfiniteTimeout, nil
+	}
+
+	var days time.Duration
+
+	if idx := strings.Index(dur, "d"); idx >= 0 {
+		count, err := strconv.ParseInt(dur[:idx], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", dur)
+		}
+
+		days = time.Duration(count) * 24 * time.Hour
+		dur = dur[idx+1:]
+
+		if dur == "" {
+			return days, nil
+		}
+	}
+
+	result, err := time.ParseDuration(dur)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", dur)
+	}
+
+	return days + result, nil
+}
+
+// Ticket ID of a response.
+//
+// Servers identify tickets by base-10 IDs, or by UUIDs encoding the IDs if configured with the UUID ID strategy, in
+// which case the ID is recovered from the UUID. Either form is accepted by requests, so IDs are always sent in base 10.
+type ticketId int64
+
+func (id *ticketId) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+
+	if !strings.Contains(str, "-") {
+		value, err := strconv.ParseInt(str, 10, 64)
+		*id = ticketId(value)
+		return err
+	}
+
+	// UUIDs are of version 8, holding the 63 bits of the ID in the first bits free for custom use, in the first 48 bits
+	// of the UUID, the 12 bits following the version, and the 3 bits following the variant.
+	buf, err := hex.DecodeString(strings.ReplaceAll(str, "-", ""))
+	if err != nil || len(buf) != 16 {
+		return fmt.Errorf("invalid ticket ID %q", str)
+	}
+
+	high := binary.BigEndian.Uint64(buf[:8])
+	low := binary.BigEndian.Uint64(buf[8:])
+	*id = ticketId(high>>16<<15 | high&0xfff<<3 | low>>59&0x7)
+
+	return nil
+}
@@ -0,0 +1,475 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lockerd/httpserver"
+	"lockerd/locking"
+)
+
+type ClientFixture struct {
+	Manager locking.Manager
+	Client  *Client
+	server  *httptest.Server
+}
+
+func NewClientFixture(t *testing.T) *ClientFixture {
+	return NewClientFixtureWithOptions(t, httpserver.HandlerOptions{})
+}
+
+func NewClientFixtureWithOptions(t *testing.T, options httpserver.HandlerOptions) *ClientFixture {
+	return NewClientFixtureWithMiddleware(t, options, nil)
+}
+
+func NewClientFixtureWithMiddleware(t *testing.T, options httpserver.HandlerOptions, middleware func(http.Handler) http.Handler) *ClientFixture {
+	return NewClientFixtureWithConfig(t, locking.Config{}, options, middleware)
+}
+
+func NewClientFixtureWithConfig(t *testing.T, config locking.Config, options httpserver.HandlerOptions, middleware func(http.Handler) http.Handler) *ClientFixture {
+	manager, _ := locking.NewManager(config)
+
+	handler := httpserver.NewHandler(manager, options)
+	if middleware != nil {
+		handler = middleware(handler)
+	}
+
+	server := httptest.NewServer(handler)
+	manager.Start()
+
+	return &ClientFixture{
+		Manager: manager,
+		Client:  New(server.URL+"/", server.Client()),
+		server:  server,
+	}
+}
+
+func (f *ClientFixture) Close() {
+	f.Manager.Stop()
+	f.server.Close()
+}
+
+func TestClientAcquireAndRelease(t *testing.T) {
+	f := NewClientFixture(t)
+	defer f.Close()
+
+	ctx := context.Background()
+
+	// Test acquiring.
+	lockA, err := f.Client.Acquire(ctx, "test", time.Minute, time.Minute)
+	if err != nil || lockA.Id == 0 || lockA.Fence == 0 {
+		t.Fatalf("Expected lock to be acquired, got %v, %v", lockA, err)
+	}
+
+	// Test that acquisition times out and fails without waiting.
+	_, err = f.Client.Acquire(ctx, "test", 50*time.Millisecond, time.Minute)
+
+	var timeoutErr *Error
+	if !errors.Is(err, ErrTimeout) || !errors.As(err, &timeoutErr) || timeoutErr.RetryAfter <= 0 {
+		t.Fatalf("Expected acquisition to time out with a retry hint, got %v", err)
+	}
+
+	if _, err := f.Client.Acquire(ctx, "test", 0, time.Minute, AcquireOptions{Try: true}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected acquisition to conflict, got %v", err)
+	}
+
+	// Test that canceling the context abandons the acquisition.
+	cancelCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := f.Client.Acquire(cancelCtx, "test", time.Minute, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected acquisition to be canceled, got %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if state, _ := f.Manager.Inspect("test"); len(state.Acquirers) != 0 {
+		t.Fatalf("Expected no acquirers, got %v", state.Acquirers)
+	}
+
+	// Test releasing.
+	if err := f.Client.Release(ctx, "test", lockA.Id); err != nil {
+		t.Fatalf("Expected lock to be released, got %v", err)
+	}
+
+	err = f.Client.Release(ctx, "test", lockA.Id)
+
+	var apiErr *Error
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &apiErr) || apiErr.StatusCode != 404 {
+		t.Fatalf("Expected lock not to be found, got %v", err)
+	}
+}
+
+func TestClientNoContent(t *testing.T) {
+	f := NewClientFixtureWithOptions(t, httpserver.HandlerOptions{NoContent: true})
+	defer f.Close()
+
+	ctx := context.Background()
+
+	lock, _ := f.Client.Acquire(ctx, "test", time.Minute, time.Second)
+
+	// Test that responses without content are successful, and that errors are still decoded.
+	if changed, err := f.Client.Extend(ctx, "test", lock.Id, time.Minute); err != nil || !changed {
+		t.Fatalf("Expected lease to be extended, got %v, %v", changed, err)
+	}
+
+	if err := f.Client.Release(ctx, "test", lock.Id); err != nil {
+		t.Fatalf("Expected lock to be released, got %v", err)
+	}
+
+	if err := f.Client.Release(ctx, "test", lock.Id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected lock not to be found, got %v", err)
+	}
+}
+
+func TestClientUUIDStrategy(t *testing.T) {
+	f := NewClientFixtureWithConfig(t, locking.Config{IDStrategy: locking.IDStrategyUUID}, httpserver.HandlerOptions{IDStrategy: locking.IDStrategyUUID}, nil)
+	defer f.Close()
+
+	ctx := context.Background()
+
+	// Test that IDs are recovered from the UUIDs of the server.
+	lock, err := f.Client.Acquire(ctx, "test", time.Minute, time.Minute)
+	if err != nil {
+		t.Fatalf("Expected lock to be acquired, got %v", err)
+	}
+
+	if lockers, _ := f.Manager.IsLocked("test"); len(lockers) != 1 || lockers[0] != lock.Id {
+		t.Fatalf("Expected lock to be held by %d, got %v", lock.Id, lockers)
+	}
+
+	ticket, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	state, err := f.Client.Inspect(ctx, "test")
+	if err != nil || state.LockingId != lock.Id || state.Holders[0].Id != lock.Id || state.Acquirers[0].Id != ticket.Id() {
+		t.Fatalf("Expected lock held by %d and acquired by %d, got %+v, %v", lock.Id, ticket.Id(), state, err)
+	}
+
+	if err := f.Client.Release(ctx, "test", lock.Id); err != nil {
+		t.Fatalf("Expected lock to be released, got %v", err)
+	}
+}
+
+func TestClientExtendAndInspect(t *testing.T) {
+	f := NewClientFixture(t)
+	defer f.Close()
+
+	ctx := context.Background()
+
+	lockA, _ := f.Client.Acquire(ctx, "test", time.Minute, time.Second, AcquireOptions{Mode: ModeShared, Owner: "worker"})
+	ticketB, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	// Test extending.
+	if changed, err := f.Client.Extend(ctx, "test", lockA.Id, 2*time.Hour); err != nil || !changed {
+		t.Fatalf("Expected lease to be extended, got %v, %v", changed, err)
+	}
+
+	if _, err := f.Client.Extend(ctx, "test", ticketB.Id(), time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected holder not to be found, got %v", err)
+	}
+
+	// Test inspecting.
+	state, err := f.Client.Inspect(ctx, "test")
+	if err != nil {
+		t.Fatalf("Failed to inspect lock: %v", err)
+	}
+
+	if state.LockingId != lockA.Id || state.Mode != ModeShared || state.Fence != lockA.Fence {
+		t.Fatalf("Expected lock to be held by %d in shared mode, got %+v", lockA.Id, state)
+	}
+	if len(state.Holders) != 1 || state.Holders[0].Owner != "worker" || state.Holders[0].Timeout < time.Hour {
+		t.Fatalf("Expected holder owned by worker, got %+v", state.Holders)
+	}
+	if len(state.Acquirers) != 1 || state.Acquirers[0].Id != ticketB.Id() || state.Acquirers[0].Mode != ModeExclusive {
+		t.Fatalf("Expected exclusive acquirer %d, got %+v", ticketB.Id(), state.Acquirers)
+	}
+
+	if _, err := f.Client.Inspect(ctx, "other"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected lock not to be found, got %v", err)
+	}
+
+	states, err := f.Client.InspectAll(ctx)
+	if err != nil || len(states) != 1 || states["test"].LockingId != lockA.Id {
+		t.Fatalf("Expected single lock held by %d, got %v, %v", lockA.Id, states, err)
+	}
+
+	// Test inspecting a range.
+	f.Manager.Acquire("test/a", time.Minute, time.Minute)
+	f.Manager.Acquire("test/b", time.Minute, time.Minute)
+
+	states, cursor, err := f.Client.InspectRange(ctx, "test/", "", 1)
+	if err != nil || len(states) != 1 || states["test/a"].LockingId == 0 || cursor != "test/a" {
+		t.Fatalf("Expected first lock of range, got %v, %q, %v", states, cursor, err)
+	}
+
+	states, cursor, err = f.Client.InspectRange(ctx, "test/", cursor, 1)
+	if err != nil || len(states) != 1 || states["test/b"].LockingId == 0 || cursor != "" {
+		t.Fatalf("Expected last lock of range, got %v, %q, %v", states, cursor, err)
+	}
+}
+
+func TestSessionKeepAlive(t *testing.T) {
+	f := NewClientFixture(t)
+	defer f.Close()
+
+	lock, _ := f.Client.Acquire(context.Background(), "test", time.Minute, 200*time.Millisecond)
+	session := f.Client.NewSession(lock, 200*time.Millisecond)
+
+	// Test that the lease is kept alive beyond its timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	if err := session.KeepAlive(ctx, 0); err != context.DeadlineExceeded {
+		t.Fatalf("Expected lease to be kept alive until canceled, got %v", err)
+	}
+
+	if lockers, _ := f.Manager.IsLocked("test"); len(lockers) != 1 || lockers[0] != lock.Id {
+		t.Fatalf("Expected lock to be held by %d, got %v", lock.Id, lockers)
+	}
+
+	// Test that keeping alive a lost lease fails.
+	if err := session.Release(context.Background()); err != nil {
+		t.Fatalf("Expected lock to be released, got %v", err)
+	}
+
+	if err := session.KeepAlive(context.Background(), 10*time.Millisecond); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected lease to be lost, got %v", err)
+	}
+}
+
+// Renewals performed against a fixture, failing as instructed.
+type RenewalFaults struct {
+	// Number of renewals to fail, or a negative number to fail all renewals.
+	Fail atomic.Int32
+
+	// Number of renewals received.
+	Renewals atomic.Int32
+}
+
+func (r *RenewalFaults) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method != "PATCH" {
+			next.ServeHTTP(resp, req)
+			return
+		}
+
+		r.Renewals.Add(1)
+		if fail := r.Fail.Load(); fail < 0 || fail > 0 && r.Fail.CompareAndSwap(fail, fail-1) {
+			http.Error(resp, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		next.ServeHTTP(resp, req)
+	})
+}
+
+func TestRenewalStrategies(t *testing.T) {
+	// Test that renewals at half of the lease are jittered to no later than half of the lease.
+	for i := 0; i < 100; i++ {
+		if delay, ok := RenewAtHalfLease(DefaultRenewalJitter).Next(time.Minute); !ok || delay < 24*time.Second || delay > 30*time.Second {
+			t.Fatalf("Expected renewal within 24s to 30s, got %v, %v", delay, ok)
+		}
+	}
+
+	if delay, ok := RenewAtHalfLease(0).Next(time.Minute); !ok || delay != 30*time.Second {
+		t.Fatalf("Expected renewal at 30s without jitter, got %v, %v", delay, ok)
+	}
+
+	if delay, ok := RenewEvery(time.Second).Next(time.Minute); !ok || delay != time.Second {
+		t.Fatalf("Expected renewal at 1s, got %v, %v", delay, ok)
+	}
+
+	if _, ok := RenewOnDemand().Next(time.Minute); ok {
+		t.Fatalf("Expected no renewal in the background on demand")
+	}
+}
+
+func TestSessionKeepAliveRenewEvery(t *testing.T) {
+	faults := &RenewalFaults{}
+	f := NewClientFixtureWithMiddleware(t, httpserver.HandlerOptions{}, faults.Middleware)
+	defer f.Close()
+
+	lock, _ := f.Client.Acquire(context.Background(), "test", time.Minute, time.Minute)
+	session := f.Client.NewSession(lock, time.Minute, SessionOptions{
+		Renewal: RenewEvery(50 * time.Millisecond),
+	})
+
+	// Test that the lease is renewed at the interval rather than at half of the lease.
+	ctx, cancel := context.WithTimeout(context.Background(), 275*time.Millisecond)
+	defer cancel()
+
+	if err := session.KeepAlive(ctx, 0); err != context.DeadlineExceeded {
+		t.Fatalf("Expected lease to be kept alive until canceled, got %v", err)
+	}
+
+	if renewals := faults.Renewals.Load(); renewals < 3 || renewals > 5 {
+		t.Fatalf("Expected 3 to 5 renewals, got %d", renewals)
+	}
+}
+
+func TestSessionKeepAliveLockLost(t *testing.T) {
+	f := NewClientFixture(t)
+	defer f.Close()
+
+	lock, _ := f.Client.Acquire(context.Background(), "test", time.Minute, 200*time.Millisecond)
+	session := f.Client.NewSession(lock, 200*time.Millisecond)
+
+	// Test that losing the lock mid-hold stops renewals and surfaces the loss.
+	time.AfterFunc(150*time.Millisecond, func() {
+		f.Manager.Release("test", lock.Id)
+	})
+
+	start := time.Now()
+	if err := session.KeepAlive(context.Background(), 0); !errors.Is(err, ErrLeaseLost) || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected lease to be lost, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Fatalf("Expected loss to be surfaced within the lease, took %v", elapsed)
+	}
+
+	if err := session.Err(); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Expected session to report the lost lease, got %v", err)
+	}
+
+	// Test that operations are not performed once the lease is lost.
+	performed := false
+	if err := session.Do(context.Background(), func(ctx context.Context) error {
+		performed = true
+		return nil
+	}); !errors.Is(err, ErrLeaseLost) || performed {
+		t.Fatalf("Expected operation not to be performed, got %v, %v", err, performed)
+	}
+
+	// Test that a lost lease is no longer renewed.
+	if err := session.Renew(context.Background()); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Expected renewal of a lost lease to fail, got %v", err)
+	}
+}
+
+func TestSessionKeepAliveRenewalFailure(t *testing.T) {
+	faults := &RenewalFaults{}
+	f := NewClientFixtureWithMiddleware(t, httpserver.HandlerOptions{}, faults.Middleware)
+	defer f.Close()
+
+	lock, _ := f.Client.Acquire(context.Background(), "test", time.Minute, 200*time.Millisecond)
+	session := f.Client.NewSession(lock, 200*time.Millisecond)
+
+	// Test that a failed renewal is retried before the lease expires.
+	faults.Fail.Store(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	if err := session.KeepAlive(ctx, 0); err != context.DeadlineExceeded {
+		t.Fatalf("Expected lease to be kept alive until canceled, got %v", err)
+	}
+
+	if lockers, _ := f.Manager.IsLocked("test"); len(lockers) != 1 || lockers[0] != lock.Id {
+		t.Fatalf("Expected lock to be held by %d, got %v", lock.Id, lockers)
+	}
+
+	// Test that renewals failing mid-hold until the lease expires lose the lease.
+	faults.Fail.Store(-1)
+
+	start := time.Now()
+	err := session.KeepAlive(context.Background(), 0)
+	if !errors.Is(err, ErrLeaseLost) || errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected lease to be lost, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Fatalf("Expected loss to be surfaced once the lease expires, took %v", elapsed)
+	}
+
+	// Test that renewals stop once the lease is lost.
+	renewals := faults.Renewals.Load()
+	time.Sleep(100 * time.Millisecond)
+
+	if current := faults.Renewals.Load(); current != renewals {
+		t.Fatalf("Expected no renewals after losing the lease, got %d more", current-renewals)
+	}
+}
+
+func TestSessionRenewOnDemand(t *testing.T) {
+	faults := &RenewalFaults{}
+	f := NewClientFixtureWithMiddleware(t, httpserver.HandlerOptions{}, faults.Middleware)
+	defer f.Close()
+
+	lock, _ := f.Client.Acquire(context.Background(), "test", time.Minute, 200*time.Millisecond)
+	session := f.Client.NewSession(lock, 200*time.Millisecond, SessionOptions{
+		Renewal: RenewOnDemand(),
+	})
+
+	// Test that the lease is renewed before each operation, keeping it alive beyond its timeout.
+	for i := 0; i < 4; i++ {
+		time.Sleep(100 * time.Millisecond)
+
+		if err := session.Do(context.Background(), func(ctx context.Context) error {
+			return nil
+		}); err != nil {
+			t.Fatalf("Expected operation to be performed, got %v", err)
+		}
+	}
+
+	if renewals := faults.Renewals.Load(); renewals != 4 {
+		t.Fatalf("Expected 4 renewals, got %d", renewals)
+	}
+
+	if lockers, _ := f.Manager.IsLocked("test"); len(lockers) != 1 || lockers[0] != lock.Id {
+		t.Fatalf("Expected lock to be held by %d, got %v", lock.Id, lockers)
+	}
+
+	// Test that keeping alive a lease renewed on demand waits for the lease to be lost.
+	lost := make(chan error, 1)
+	go func() {
+		lost <- session.KeepAlive(context.Background(), 0)
+	}()
+
+	// Test that a failed renewal mid-hold is surfaced without performing the operation.
+	f.Manager.Release("test", lock.Id)
+
+	performed := false
+	if err := session.Do(context.Background(), func(ctx context.Context) error {
+		performed = true
+		return nil
+	}); !errors.Is(err, ErrLeaseLost) || performed {
+		t.Fatalf("Expected operation not to be performed, got %v, %v", err, performed)
+	}
+
+	select {
+	case err := <-lost:
+		if !errors.Is(err, ErrLeaseLost) {
+			t.Fatalf("Expected lease to be lost, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected keeping alive to return once the lease is lost")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	fixtures := []struct {
+		Duration time.Duration
+	}{
+		{InfiniteTimeout},
+		{0},
+		{1500 * time.Millisecond},
+		{10 * time.Second},
+		{90*time.Minute + 1500*time.Millisecond},
+		{60 * time.Hour},
+		{24*time.Hour + 5*time.Second},
+	}
+
+	for _, fixture := range fixtures {
+		formatted := httpserver.FormatDuration(fixture.Duration)
+
+		if result, err := parseDuration(formatted); err != nil || result != fixture.Duration {
+			t.Errorf("Expected %q to parse as %v, got %v, %v", formatted, fixture.Duration, result, err)
+		}
+	}
+}
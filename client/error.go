@@ -0,0 +1,120 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	// Timed out waiting to acquire a lock.
+	ErrTimeout = errors.New("timed out waiting to acquire lock")
+
+	// Lock or ticket not found.
+	ErrNotFound = errors.New("not found")
+
+	// Lock is held, and could not be acquired without waiting.
+	ErrConflict = errors.New("lock is held")
+
+	// Server is shutting down, and refuses acquisitions.
+	ErrDraining = errors.New("server is shutting down")
+
+	// Request is not authenticated.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// Lease timeout is out of the range accepted by the server.
+	ErrLeaseTimeoutOutOfRange = errors.New("lease timeout out of range")
+
+	// Lock timeout is out of the range accepted by the server.
+	ErrLockTimeoutOutOfRange = errors.New("lock timeout out of range")
+
+	// Lock queue is full, as configured for the namespace of the lock.
+	ErrQueueFull = errors.New("lock queue is full")
+
+	// Owner or labels exceed the metadata limits of the server.
+	ErrMetadataTooLarge = errors.New("metadata too large")
+
+	// Lease cannot be extended past the maximum total hold time of the server.
+	ErrHoldTimeExceeded = errors.New("hold time exceeded")
+
+	// Capacity differs from that of the semaphore the lock is acquired as.
+	ErrCapacityMismatch = errors.New("capacity mismatch")
+
+	// Lease of a session was lost, as the lock is no longer held or the lease expired before being renewed.
+	ErrLeaseLost = errors.New("lease lost")
+)
+
+// Errors by API error code.
+var codeErrors = map[string]error{
+	"timeout":                    ErrTimeout,
+	"not_found":                  ErrNotFound,
+	"conflict":                   ErrConflict,
+	"draining":                   ErrDraining,
+	"unauthorized":               ErrUnauthorized,
+	"metadata_too_large":         ErrMetadataTooLarge,
+	"queue_full":                 ErrQueueFull,
+	"lease_timeout_out_of_range": ErrLeaseTimeoutOutOfRange,
+	"lock_timeout_out_of_range":  ErrLockTimeoutOutOfRange,
+	"hold_time_exceeded":         ErrHoldTimeExceeded,
+	"capacity_mismatch":          ErrCapacityMismatch,
+}
+
+// API error.
+//
+// Describes an error response of the API. Errors with well-known codes match the corresponding error values, such as
+// ErrTimeout, through errors.Is.
+type Error struct {
+	// HTTP status code.
+	StatusCode int
+
+	// Error code.
+	Code string
+
+	// Error message.
+	Message string
+
+	// Estimate of when to retry, as hinted by the server upon timeouts. Zero if not hinted.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	err, ok := codeErrors[e.Code]
+
+	return ok && err == target
+}
+
+// Decode an error response.
+//
+// Responses without a JSON error body are described by their status.
+func decodeError(resp *http.Response) error {
+	var body struct {
+		Code       string `json:"code"`
+		Message    string `json:"message"`
+		RetryAfter string `json:"retry_after"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Code == "" {
+		return &Error{
+			StatusCode: resp.StatusCode,
+			Code:       "unknown",
+			Message:    http.StatusText(resp.StatusCode),
+		}
+	}
+
+	apiErr := &Error{
+		StatusCode: resp.StatusCode,
+		Code:       body.Code,
+		Message:    body.Message,
+	}
+
+	if body.RetryAfter != "" {
+		apiErr.RetryAfter, _ = parseDuration(body.RetryAfter)
+	}
+
+	return apiErr
+}
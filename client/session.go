@@ -0,0 +1,277 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Default jitter of renewals at half of the lease, as a fraction of half of the lease.
+const DefaultRenewalJitter = 0.2
+
+// Renewal strategy.
+//
+// Decides when the lease of a session is renewed.
+type RenewalStrategy interface {
+	// Delay until the next renewal of a lease of the given timeout.
+	//
+	// Returns false if the lease is not renewed in the background, but only on demand before each protected
+	// operation.
+	Next(leaseTimeout time.Duration) (time.Duration, bool)
+}
+
+// Renewal at half of the lease.
+type halfLeaseRenewal struct {
+	jitter float64
+}
+
+// Renew at half of the lease.
+//
+// Renews the lease once half of it has elapsed, less a random jitter of up to the given fraction of half of the lease,
+// so that sessions acquired at once do not renew in lockstep.
+func RenewAtHalfLease(jitter float64) RenewalStrategy {
+	return halfLeaseRenewal{
+		jitter: min(max(jitter, 0), 1),
+	}
+}
+
+func (r halfLeaseRenewal) Next(leaseTimeout time.Duration) (time.Duration, bool) {
+	half := leaseTimeout / 2
+	return max(half-time.Duration(rand.Float64()*r.jitter*float64(half)), time.Millisecond), true
+}
+
+// Renewal at a fixed interval.
+type intervalRenewal struct {
+	interval time.Duration
+}
+
+// Renew at a fixed interval.
+func RenewEvery(interval time.Duration) RenewalStrategy {
+	return intervalRenewal{
+		interval: max(interval, time.Millisecond),
+	}
+}
+
+func (r intervalRenewal) Next(leaseTimeout time.Duration) (time.Duration, bool) {
+	return r.interval, true
+}
+
+// Renewal on demand.
+type onDemandRenewal struct{}
+
+// Renew on demand.
+//
+// Renews the lease before each operation performed by Session.Do rather than in the background.
+func RenewOnDemand() RenewalStrategy {
+	return onDemandRenewal{}
+}
+
+func (r onDemandRenewal) Next(leaseTimeout time.Duration) (time.Duration, bool) {
+	return 0, false
+}
+
+// Session options.
+type SessionOptions struct {
+	// Renewal strategy. Defaults to renewing at half of the lease with the default jitter.
+	Renewal RenewalStrategy
+}
+
+// Lock session.
+//
+// Keeps the lease of an acquired lock alive until the lock is released.
+type Session struct {
+	client       *Client
+	lock         *Lock
+	leaseTimeout time.Duration
+	renewal      RenewalStrategy
+
+	sync      sync.Mutex
+	expiresAt time.Time
+	err       error
+	lost      chan struct{}
+}
+
+// New session.
+//
+// Creates a session for an acquired lock, extending its lease by the given lease timeout whenever it is renewed. The
+// lock is assumed to have just been acquired with the lease timeout. Only the first options are considered.
+func (c *Client) NewSession(lock *Lock, leaseTimeout time.Duration, options ...SessionOptions) *Session {
+	var opts SessionOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	if opts.Renewal == nil {
+		opts.Renewal = RenewAtHalfLease(DefaultRenewalJitter)
+	}
+
+	return &Session{
+		client:       c,
+		lock:         lock,
+		leaseTimeout: leaseTimeout,
+		renewal:      opts.Renewal,
+		expiresAt:    time.Now().Add(leaseTimeout),
+		lost:         make(chan struct{}),
+	}
+}
+
+// Lock of the session.
+func (s *Session) Lock() *Lock {
+	return s.lock
+}
+
+// Error of the session.
+//
+// Returns an error wrapping ErrLeaseLost once the lease has been lost, and nil while it is held.
+func (s *Session) Err() error {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+
+	return s.check()
+}
+
+// Renew the lease.
+//
+// Extends the lease by the lease timeout of the session. The lease is lost if the lock is no longer held, or if it
+// expires before being renewed, after which the lease is no longer renewed and an error wrapping ErrLeaseLost, along
+// with its cause, is returned. Other failures are returned as is, and may be retried. Leases that never expire are
+// not renewed.
+func (s *Session) Renew(ctx context.Context) error {
+	if err := s.Err(); err != nil || s.leaseTimeout < 0 {
+		return err
+	}
+
+	start := time.Now()
+	_, err := s.client.Extend(ctx, s.lock.Path, s.lock.Id, s.leaseTimeout)
+
+	s.sync.Lock()
+	defer s.sync.Unlock()
+
+	switch {
+	case s.err != nil:
+		return s.err
+	case err == nil:
+		// The server extends the lease from the time it receives the request, which is no sooner than it was sent.
+		if expiresAt := start.Add(s.leaseTimeout); expiresAt.After(s.expiresAt) {
+			s.expiresAt = expiresAt
+		}
+		return nil
+	case errors.Is(err, ErrNotFound):
+		s.lose(err)
+		return s.err
+	case ctx.Err() != nil:
+		return err
+	}
+
+	if lostErr := s.check(); lostErr != nil {
+		return lostErr
+	}
+
+	return err
+}
+
+// Keep the lease alive.
+//
+// Renews the lease as decided by the renewal strategy of the session until the context is canceled, at which point the
+// error of the context is returned. If the interval is positive, the lease is renewed at the interval instead. Failed
+// renewals are retried before the lease expires, until the lease is lost, at which point renewals stop and the error
+// of the lost lease is returned. Leases that never expire, or are renewed on demand, are not renewed in the
+// background, though losing them on demand still returns.
+func (s *Session) KeepAlive(ctx context.Context, interval time.Duration) error {
+	renewal := s.renewal
+	if interval > 0 {
+		renewal = RenewEvery(interval)
+	}
+
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	delay, ok := renewal.Next(s.leaseTimeout)
+	if s.leaseTimeout < 0 || !ok {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.lost:
+			return s.Err()
+		}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.lost:
+			return s.Err()
+		case <-timer.C:
+		}
+
+		err := s.Renew(ctx)
+		if errors.Is(err, ErrLeaseLost) {
+			return err
+		}
+
+		delay, _ = renewal.Next(s.leaseTimeout)
+		if err != nil {
+			// Retry at half of the remaining lease at the latest, so as to retry again before it expires.
+			delay = min(delay, max(time.Until(s.expiry())/2, time.Millisecond))
+		}
+
+		timer.Reset(delay)
+	}
+}
+
+// Perform an operation protected by the lock.
+//
+// Renews the lease beforehand if the session renews it on demand, and performs the operation unless the lease has
+// been lost, in which case the error of the lost lease is returned without performing the operation. Otherwise, the
+// error of the operation is returned.
+func (s *Session) Do(ctx context.Context, op func(ctx context.Context) error) error {
+	if _, ok := s.renewal.Next(s.leaseTimeout); ok {
+		if err := s.Err(); err != nil {
+			return err
+		}
+	} else if err := s.Renew(ctx); err != nil {
+		return err
+	}
+
+	return op(ctx)
+}
+
+// Release the lock of the session.
+func (s *Session) Release(ctx context.Context) error {
+	return s.client.Release(ctx, s.lock.Path, s.lock.Id)
+}
+
+// Check whether the lease has been lost.
+//
+// Considers the lease lost once it has expired without being renewed. Assumes the lock of the session is held.
+func (s *Session) check() error {
+	if s.err == nil && s.leaseTimeout >= 0 && !time.Now().Before(s.expiresAt) {
+		s.lose(errors.New("lease expired"))
+	}
+
+	return s.err
+}
+
+// Lose the lease.
+//
+// Assumes the lock of the session is held.
+func (s *Session) lose(cause error) {
+	s.err = fmt.Errorf("%w: %w", ErrLeaseLost, cause)
+	close(s.lost)
+}
+
+// Expiry of the lease, as far as the session knows.
+func (s *Session) expiry() time.Time {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+
+	return s.expiresAt
+}
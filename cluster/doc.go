@@ -0,0 +1,2 @@
+// Package cluster provides a clustered mode of the locking service, replicating the holders of locks through Raft.
+package cluster
@@ -0,0 +1,147 @@
+package cluster
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+
+	"lockerd/locking"
+)
+
+// Command type.
+type commandType string
+
+const (
+	// A journal record of the leader's manager.
+	commandJournal commandType = "journal"
+
+	// The holders of the leader's manager, replacing the replicated holders. Only applied from logs of earlier versions,
+	// which compacted the journal by replicating the holders.
+	commandHolders commandType = "holders"
+
+	// The HTTP API address of a node.
+	commandMember commandType = "member"
+)
+
+// Replicated command.
+type command struct {
+	Type    commandType             `json:"type"`
+	Record  *locking.JournalRecord  `json:"record,omitempty"`
+	Holders []locking.JournalRecord `json:"holders,omitempty"`
+	NodeId  string                  `json:"node_id,omitempty"`
+	URL     string                  `json:"url,omitempty"`
+}
+
+// Replicated state.
+type fsmState struct {
+	// Holders of locks, in order of acquisition.
+	Holders []locking.JournalRecord `json:"holders"`
+
+	// HTTP API URLs by node ID.
+	Members map[string]string `json:"members"`
+}
+
+// Finite state machine.
+//
+// Replicates the holders of the locks of the leader's manager, as journaled by it, so a new leader can restore them,
+// as well as the HTTP API URLs of the nodes, so followers can forward requests to the leader.
+type fsm struct {
+	sync  sync.Mutex
+	state fsmState
+}
+
+// New finite state machine.
+func newFSM() *fsm {
+	return &fsm{
+		state: fsmState{
+			Members: make(map[string]string),
+		},
+	}
+}
+
+func (f *fsm) Apply(log *raft.Log) interface{} {
+	var cmd command
+	if err := json.Unmarshal(log.Data, &cmd); err != nil {
+		return err
+	}
+
+	f.sync.Lock()
+	defer f.sync.Unlock()
+
+	switch cmd.Type {
+	case commandJournal:
+		if cmd.Record != nil {
+			f.state.Holders = locking.ApplyJournalRecord(f.state.Holders, *cmd.Record)
+		}
+	case commandHolders:
+		f.state.Holders = cmd.Holders
+	case commandMember:
+		f.state.Members[cmd.NodeId] = cmd.URL
+	}
+
+	return nil
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.sync.Lock()
+	defer f.sync.Unlock()
+
+	data, err := json.Marshal(f.state)
+	if err != nil {
+		return nil, err
+	}
+
+	return fsmSnapshot(data), nil
+}
+
+func (f *fsm) Restore(reader io.ReadCloser) error {
+	defer reader.Close()
+
+	var state fsmState
+	if err := json.NewDecoder(reader).Decode(&state); err != nil {
+		return err
+	}
+
+	if state.Members == nil {
+		state.Members = make(map[string]string)
+	}
+
+	f.sync.Lock()
+	defer f.sync.Unlock()
+
+	f.state = state
+	return nil
+}
+
+// Holders whose leases have not expired by the given time.
+func (f *fsm) holders(now time.Time) []locking.JournalRecord {
+	f.sync.Lock()
+	defer f.sync.Unlock()
+
+	return locking.ExpireJournalHolders(append([]locking.JournalRecord(nil), f.state.Holders...), now)
+}
+
+// HTTP API URL of a node.
+func (f *fsm) memberURL(nodeId string) string {
+	f.sync.Lock()
+	defer f.sync.Unlock()
+
+	return f.state.Members[nodeId]
+}
+
+// Snapshot of the replicated state, encoded as JSON.
+type fsmSnapshot []byte
+
+func (s fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := sink.Write(s); err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func (s fsmSnapshot) Release() {}
@@ -0,0 +1,148 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"lockerd/locking"
+)
+
+// Header marking requests forwarded to the leader.
+const forwardedHeader = "X-Lockerd-Forwarded"
+
+// Cluster handler.
+type handler struct {
+	node       *Node
+	newHandler func(manager locking.Manager) http.Handler
+
+	sync           sync.Mutex
+	manager        locking.Manager
+	managerHandler http.Handler
+}
+
+// New cluster handler.
+//
+// Serves requests by a handler of the manager of the node while it leads the cluster, which is created by the given
+// function for every manager, and forwards them to the leader otherwise. Requests of nodes joining the cluster are
+// served at POST /?join=true. Forwarded requests are served by the leader as if received directly, so any
+// authentication or rate limiting wrapping the handler applies once more, keyed by the forwarding node if not
+// authenticated.
+func NewHandler(node *Node, newHandler func(manager locking.Manager) http.Handler) http.Handler {
+	return &handler{
+		node:       node,
+		newHandler: newHandler,
+	}
+}
+
+func (h *handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	manager := h.node.Manager()
+
+	if manager != nil && req.Method == "POST" && req.URL.Path == "/" && req.URL.Query().Get("join") == "true" {
+		h.serveJoin(resp, req)
+	} else if manager != nil {
+		h.handlerOf(manager).ServeHTTP(resp, req)
+	} else {
+		h.forward(resp, req)
+	}
+}
+
+// Handler of a manager.
+//
+// Creates the handler of a manager once the node is elected leader, and reuses it for as long as the node leads.
+func (h *handler) handlerOf(manager locking.Manager) http.Handler {
+	h.sync.Lock()
+	defer h.sync.Unlock()
+
+	if h.manager != manager {
+		h.manager = manager
+		h.managerHandler = h.newHandler(manager)
+	}
+
+	return h.managerHandler
+}
+
+// Forward a request to the leader.
+//
+// Requests are forwarded once at most, so a request reaching a node that no longer leads, or a cluster without a
+// leader, fails rather than bouncing between nodes. The read and write deadlines of the connection are lifted, as
+// forwarded requests may wait for locks, and are bounded by the leader in turn.
+func (h *handler) forward(resp http.ResponseWriter, req *http.Request) {
+	leaderURL := h.node.LeaderURL()
+	if leaderURL == "" || req.Header.Get(forwardedHeader) != "" {
+		respondError(resp, "no_leader", "Cluster has no leader", 503)
+		return
+	}
+
+	target, err := url.Parse(leaderURL)
+	if err != nil {
+		respondError(resp, "no_leader", "Cluster has no leader", 503)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(proxyReq *httputil.ProxyRequest) {
+			proxyReq.SetURL(target)
+			proxyReq.SetXForwarded()
+			proxyReq.Out.Header.Set(forwardedHeader, "true")
+		},
+		ErrorHandler: func(resp http.ResponseWriter, req *http.Request, err error) {
+			h.node.logger.Error("Failed to forward request to leader", "leader", leaderURL, "error", err)
+			respondError(resp, "no_leader", "Cluster leader unavailable", 503)
+		},
+	}
+
+	controller := http.NewResponseController(resp)
+	controller.SetReadDeadline(time.Time{})
+	controller.SetWriteDeadline(time.Time{})
+
+	proxy.ServeHTTP(resp, req)
+}
+
+// Serve a request to join the cluster.
+func (h *handler) serveJoin(resp http.ResponseWriter, req *http.Request) {
+	nodeId := req.FormValue("id")
+	addr := req.FormValue("raft_addr")
+	nodeURL := req.FormValue("url")
+
+	if nodeId == "" || addr == "" || nodeURL == "" {
+		respondError(resp, "invalid_join", "Missing form parameter id, raft_addr or url", 400)
+		return
+	}
+
+	if err := h.node.AddNode(nodeId, addr, nodeURL); err == ErrNotLeader {
+		respondError(resp, "no_leader", "Node no longer leads the cluster", 503)
+		return
+	} else if err != nil {
+		h.node.logger.Error("Failed to add node", "node_id", nodeId, "error", err)
+		respondError(resp, "internal_server_error", "Internal server error", 500)
+		return
+	}
+
+	h.node.logger.Info("Node joined cluster", "node_id", nodeId, "raft_addr", addr, "url", nodeURL)
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"id": nodeId,
+	})
+
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.WriteHeader(200)
+	resp.Write(data)
+}
+
+// Respond with an error.
+//
+// Errors are formatted like those of the HTTP API.
+func respondError(resp http.ResponseWriter, code string, message string, statusCode int) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"code":    code,
+		"message": message,
+	})
+
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.WriteHeader(statusCode)
+	resp.Write(data)
+}
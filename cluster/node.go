@@ -0,0 +1,424 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+
+	"lockerd/locking"
+)
+
+// Node is not the leader of the cluster.
+var ErrNotLeader = errors.New("node is not the leader")
+
+// Timeout of applying a command to the Raft log.
+const applyTimeout = 10 * time.Second
+
+// Node configuration.
+type Config struct {
+	// Node ID.
+	//
+	// Identifies the node within the cluster, and must thus be unique within it and stable across restarts. Defaults
+	// to the Raft address the node is bound to.
+	NodeId string
+
+	// Raft directory.
+	//
+	// The directory in which the Raft log and snapshots of the node are stored.
+	Dir string
+
+	// Raft address.
+	//
+	// The TCP address on which the node communicates with the other nodes of the cluster, which must be reachable by
+	// them, and thus cannot be unspecified.
+	Addr string
+
+	// HTTP API URL.
+	//
+	// The URL at which the other nodes reach the HTTP API of the node, to forward requests to it while it leads the
+	// cluster.
+	URL string
+
+	// Bootstrap a cluster.
+	//
+	// If set, and the node has no Raft state yet, a cluster of the node alone is bootstrapped. Nodes joining an
+	// existing cluster must not bootstrap one.
+	Bootstrap bool
+
+	// Manager configuration.
+	//
+	// Configures the manager of the node while it leads the cluster. The journal is set by the node, and takes
+	// precedence over the write-ahead log, which should thus not be configured.
+	Manager locking.Config
+
+	// Logger.
+	//
+	// Leadership changes are logged at info level, along with the logs of Raft. Defaults to discarding logs.
+	Logger *slog.Logger
+}
+
+// Cluster node.
+//
+// Replicates the holders of locks through Raft, so they survive the loss of a minority of the nodes of the cluster.
+// The leader of the cluster runs a lock manager, which journals every change of the holders of locks to the Raft log,
+// and only takes effect once committed to it. Once a node is elected leader, it creates a manager restoring the
+// replicated holders, along with their remaining leases, while the manager of a deposed leader is stopped. Waiting
+// acquisitions are not replicated, and thus fail over like they do across restarts with the write-ahead log. Since
+// every request is served by the manager of the leader, which steps down once its leader lease expires without
+// contact to a quorum, reads are consistent within the leader lease.
+type Node struct {
+	config    Config
+	raft      *raft.Raft
+	fsm       *fsm
+	transport *raft.NetworkTransport
+	store     *raftboltdb.BoltStore
+	logger    *slog.Logger
+
+	sync    sync.Mutex
+	manager locking.Manager
+
+	stopChan chan struct{}
+	leadDone chan struct{}
+}
+
+// New cluster node.
+//
+// Bootstraps a cluster if configured, and otherwise awaits being added to a cluster, such as by JoinCluster, unless
+// the node has already been a member of one.
+func NewNode(config Config) (*Node, error) {
+	return newNode(config, raft.DefaultConfig())
+}
+
+// New cluster node with the given Raft configuration.
+func newNode(config Config, raftConfig *raft.Config) (*Node, error) {
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	raftLogger := hclog.FromStandardLogger(slog.NewLogLogger(logger.Handler(), slog.LevelInfo), &hclog.LoggerOptions{
+		Name:  "raft",
+		Level: hclog.Info,
+	})
+
+	raftConfig.Logger = raftLogger
+
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	store, err := raftboltdb.NewBoltStore(filepath.Join(config.Dir, "raft.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := raft.NewFileSnapshotStoreWithLogger(config.Dir, 2, raftLogger)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	transport, err := raft.NewTCPTransportWithLogger(config.Addr, nil, 3, 10*time.Second, raftLogger)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	// Identify the node by the address it is bound to, unless configured otherwise.
+	if config.NodeId == "" {
+		config.NodeId = string(transport.LocalAddr())
+	}
+
+	raftConfig.LocalID = raft.ServerID(config.NodeId)
+
+	n := &Node{
+		config:    config,
+		fsm:       newFSM(),
+		transport: transport,
+		store:     store,
+		logger:    logger,
+		stopChan:  make(chan struct{}),
+		leadDone:  make(chan struct{}),
+	}
+
+	if n.raft, err = raft.NewRaft(raftConfig, n.fsm, store, store, snapshots, transport); err != nil {
+		transport.Close()
+		store.Close()
+		return nil, err
+	}
+
+	// Bootstrap a cluster of the node alone, unless it already has state.
+	if config.Bootstrap {
+		hasState, err := raft.HasExistingState(store, store, snapshots)
+		if err == nil && !hasState {
+			err = n.raft.BootstrapCluster(raft.Configuration{
+				Servers: []raft.Server{{ID: raftConfig.LocalID, Address: transport.LocalAddr()}},
+			}).Error()
+		}
+
+		if err != nil {
+			n.raft.Shutdown()
+			transport.Close()
+			store.Close()
+			return nil, err
+		}
+	}
+
+	go n.lead()
+
+	return n, nil
+}
+
+// Follow the leadership of the node.
+//
+// Creates a manager once the node is elected leader, and stops it once the node is deposed.
+func (n *Node) lead() {
+	defer close(n.leadDone)
+
+	for {
+		select {
+		case <-n.stopChan:
+			n.stepDown()
+			return
+		case leader := <-n.raft.LeaderCh():
+			if leader {
+				n.stepUp()
+			} else {
+				n.stepDown()
+			}
+		}
+	}
+}
+
+// Take the lead of the cluster.
+//
+// Waits for the replicated state to be up to date, and creates a manager restoring the replicated holders. Failures
+// are logged, as they are due to the loss of leadership in the meantime.
+func (n *Node) stepUp() {
+	if err := n.raft.Barrier(applyTimeout).Error(); err != nil {
+		n.logger.Error("Failed to catch up as leader", "error", err)
+		return
+	}
+
+	// Advertise the HTTP API URL of the node, if not already replicated.
+	if n.fsm.memberURL(n.config.NodeId) != n.config.URL {
+		if err := n.apply(command{Type: commandMember, NodeId: n.config.NodeId, URL: n.config.URL}); err != nil {
+			n.logger.Error("Failed to advertise URL as leader", "error", err)
+			return
+		}
+	}
+
+	managerConfig := n.config.Manager
+	managerConfig.Journal = &journal{node: n}
+	managerConfig.WALCompactionInterval = -1
+
+	manager, err := locking.NewManager(managerConfig)
+	if err != nil {
+		n.logger.Error("Failed to restore locks as leader", "error", err)
+		return
+	}
+
+	manager.Start()
+
+	n.sync.Lock()
+	prevManager := n.manager
+	n.manager = manager
+	n.sync.Unlock()
+
+	if prevManager != nil {
+		prevManager.Stop()
+	}
+
+	n.logger.Info("Leading cluster", "node_id", n.config.NodeId)
+}
+
+// Step down from the lead of the cluster.
+func (n *Node) stepDown() {
+	n.sync.Lock()
+	manager := n.manager
+	n.manager = nil
+	n.sync.Unlock()
+
+	if manager != nil {
+		manager.Stop()
+		n.logger.Info("No longer leading cluster", "node_id", n.config.NodeId)
+	}
+}
+
+// Apply a command to the Raft log.
+//
+// Returns once the command is committed and applied by the node.
+func (n *Node) apply(cmd command) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	future := n.raft.Apply(data, applyTimeout)
+	if err := future.Error(); err == raft.ErrNotLeader || err == raft.ErrLeadershipLost {
+		return ErrNotLeader
+	} else if err != nil {
+		return err
+	}
+
+	if err, ok := future.Response().(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// Manager.
+//
+// Returns the manager of the node while it leads the cluster, and nil otherwise.
+func (n *Node) Manager() locking.Manager {
+	n.sync.Lock()
+	defer n.sync.Unlock()
+
+	return n.manager
+}
+
+// Leader URL.
+//
+// Returns the HTTP API URL of the leader of the cluster, or an empty string if there is no known leader.
+func (n *Node) LeaderURL() string {
+	_, leaderId := n.raft.LeaderWithID()
+	if leaderId == "" {
+		return ""
+	}
+
+	return n.fsm.memberURL(string(leaderId))
+}
+
+// Add a node to the cluster.
+//
+// Adds the node of the given ID, Raft address and HTTP API URL as a voter. Returns ErrNotLeader unless the node leads
+// the cluster. Adding a node that is already a member with the same Raft address has no effect.
+func (n *Node) AddNode(nodeId string, addr string, nodeURL string) error {
+	err := n.raft.AddVoter(raft.ServerID(nodeId), raft.ServerAddress(addr), 0, applyTimeout).Error()
+	if err == raft.ErrNotLeader || err == raft.ErrLeadershipLost {
+		return ErrNotLeader
+	} else if err != nil {
+		return err
+	}
+
+	return n.apply(command{Type: commandMember, NodeId: nodeId, URL: nodeURL})
+}
+
+// Join a cluster.
+//
+// Requests the node of the cluster at the given HTTP API URL to add this node to the cluster, which is forwarded to
+// the leader. The request is authenticated by the given bearer token, if any.
+func (n *Node) JoinCluster(ctx context.Context, joinURL string, token string) error {
+	form := url.Values{
+		"id":        []string{n.config.NodeId},
+		"raft_addr": []string{string(n.transport.LocalAddr())},
+		"url":       []string{n.config.URL},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(joinURL, "/")+"/?join=true", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+
+		return fmt.Errorf("failed to join cluster: %d %s", resp.StatusCode, body.Message)
+	}
+
+	return nil
+}
+
+// Drain the manager of the node.
+//
+// Drains the manager of the node if it leads the cluster, as per Manager.Drain.
+func (n *Node) Drain(ctx context.Context) error {
+	if manager := n.Manager(); manager != nil {
+		return manager.Drain(ctx)
+	}
+
+	return nil
+}
+
+// Announce shutdown of the manager of the node.
+//
+// Announces shutdown to the manager of the node if it leads the cluster, as per Manager.AnnounceShutdown.
+func (n *Node) AnnounceShutdown(grace time.Duration) {
+	if manager := n.Manager(); manager != nil {
+		manager.AnnounceShutdown(grace)
+	}
+}
+
+// Close the node.
+//
+// Stops the manager of the node, if any, and shuts down Raft. The node remains a member of the cluster, and may rejoin
+// it by being restarted with the same Raft directory.
+func (n *Node) Close() error {
+	select {
+	case <-n.stopChan:
+		return nil
+	default:
+	}
+
+	close(n.stopChan)
+	<-n.leadDone
+
+	err := n.raft.Shutdown().Error()
+
+	n.transport.Close()
+
+	if closeErr := n.store.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Journal of the manager of the leader.
+//
+// Journals the changes of the holders of locks to the Raft log, and restores the holders replicated by it. Records of
+// different paths are applied concurrently, so Raft replicates them in batches rather than one round trip at a time,
+// and the log is compacted by snapshots of the replicated holders rather than by the manager.
+type journal struct {
+	node *Node
+}
+
+func (j *journal) Restore(now time.Time) ([]locking.JournalRecord, error) {
+	return j.node.fsm.holders(now), nil
+}
+
+func (j *journal) Append(record locking.JournalRecord) error {
+	return j.node.apply(command{Type: commandJournal, Record: &record})
+}
+
+func (j *journal) Compact(holders []locking.JournalRecord) error {
+	return nil
+}
@@ -0,0 +1,249 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+
+	"lockerd/httpserver"
+	"lockerd/locking"
+)
+
+// Test node.
+type testNode struct {
+	node   *Node
+	server *httptest.Server
+}
+
+// Start a test node.
+//
+// The node serves the HTTP API on a test server, and elects leaders faster than by default.
+func startTestNode(t *testing.T, bootstrap bool) *testNode {
+	var handlerSync sync.Mutex
+	var handler http.Handler
+
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		handlerSync.Lock()
+		h := handler
+		handlerSync.Unlock()
+
+		h.ServeHTTP(resp, req)
+	}))
+
+	raftConfig := raft.DefaultConfig()
+	raftConfig.HeartbeatTimeout = 200 * time.Millisecond
+	raftConfig.ElectionTimeout = 200 * time.Millisecond
+	raftConfig.LeaderLeaseTimeout = 100 * time.Millisecond
+	raftConfig.CommitTimeout = 5 * time.Millisecond
+
+	node, err := newNode(Config{
+		Dir:       t.TempDir(),
+		Addr:      "127.0.0.1:0",
+		URL:       server.URL,
+		Bootstrap: bootstrap,
+	}, raftConfig)
+	if err != nil {
+		t.Fatalf("Failed to start node: %v", err)
+	}
+
+	handlerSync.Lock()
+	handler = NewHandler(node, func(manager locking.Manager) http.Handler {
+		return httpserver.NewHandler(manager)
+	})
+	handlerSync.Unlock()
+
+	return &testNode{
+		node:   node,
+		server: server,
+	}
+}
+
+// Stop a test node.
+func (n *testNode) Close() {
+	n.server.Close()
+	n.node.Close()
+}
+
+// Perform a request against a test node.
+func (n *testNode) Request(t *testing.T, method, path string, params url.Values) (int, map[string]interface{}) {
+	var body io.Reader
+	if method == "POST" || method == "PATCH" {
+		body = strings.NewReader(params.Encode())
+	} else if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	req, _ := http.NewRequest(method, n.server.URL+path, body)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error performing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	return resp.StatusCode, result
+}
+
+// Await a leader among the given nodes.
+func awaitLeader(t *testing.T, nodes ...*testNode) *testNode {
+	deadline := time.Now().Add(10 * time.Second)
+
+	for time.Now().Before(deadline) {
+		for _, node := range nodes {
+			if node.node.Manager() != nil {
+				return node
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("No leader elected")
+	return nil
+}
+
+// Await a node following a leader.
+func awaitFollowing(t *testing.T, node *testNode) {
+	deadline := time.Now().Add(10 * time.Second)
+
+	for time.Now().Before(deadline) {
+		if node.node.LeaderURL() != "" {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Node not following a leader")
+}
+
+func TestClusterFailover(t *testing.T) {
+	nodeA := startTestNode(t, true)
+	defer nodeA.Close()
+
+	awaitLeader(t, nodeA)
+
+	nodeB := startTestNode(t, false)
+	defer nodeB.Close()
+	nodeC := startTestNode(t, false)
+	defer nodeC.Close()
+
+	// Join the nodes through a node other than the leader, forwarding the request to the leader.
+	if err := nodeB.node.JoinCluster(context.Background(), nodeA.server.URL, ""); err != nil {
+		t.Fatalf("Failed to join cluster: %v", err)
+	}
+
+	awaitFollowing(t, nodeB)
+
+	if err := nodeC.node.JoinCluster(context.Background(), nodeB.server.URL, ""); err != nil {
+		t.Fatalf("Failed to join cluster: %v", err)
+	}
+
+	awaitFollowing(t, nodeC)
+
+	// Acquire a lock through a follower.
+	status, acquired := nodeB.Request(t, "POST", "/test", url.Values{
+		"lock_timeout":  []string{"1s"},
+		"lease_timeout": []string{"1m"},
+	})
+	if status != 200 {
+		t.Fatalf("Expected status code 200, got %d: %v", status, acquired)
+	}
+
+	status, state := nodeC.Request(t, "GET", "/test", nil)
+	if status != 200 || state["locking_id"] != acquired["id"] {
+		t.Fatalf("Expected lock to be held by %v, got %v", acquired["id"], state)
+	}
+
+	// Stop the leader, and assert that the new leader restores the lock.
+	nodeA.Close()
+	leader := awaitLeader(t, nodeB, nodeC)
+
+	status, state = leader.Request(t, "GET", "/test", nil)
+	if status != 200 || state["locking_id"] != acquired["id"] || state["fence"] != acquired["fence"] {
+		t.Fatalf("Expected restored lock to be held by %v with fence %v, got %v", acquired["id"], acquired["fence"], state)
+	}
+
+	// Release the lock through whichever node.
+	for _, node := range []*testNode{nodeB, nodeC} {
+		if status, _ := node.Request(t, "DELETE", "/test", url.Values{"id": []string{acquired["id"].(string)}}); status == 200 {
+			return
+		}
+	}
+
+	t.Fatalf("Failed to release restored lock")
+}
+
+func TestClusterNoLeader(t *testing.T) {
+	node := startTestNode(t, false)
+	defer node.Close()
+
+	// Test that requests fail without a leader to forward them to.
+	status, body := node.Request(t, "GET", "/test", nil)
+	if status != 503 || body["code"] != "no_leader" {
+		t.Fatalf("Expected no leader, got %d: %v", status, body)
+	}
+}
+
+func TestFSMSnapshot(t *testing.T) {
+	f := newFSM()
+
+	apply := func(cmd command) {
+		data, _ := json.Marshal(cmd)
+		if err := f.Apply(&raft.Log{Data: data}); err != nil {
+			t.Fatalf("Failed to apply command: %v", err)
+		}
+	}
+
+	leaseUntil := time.Now().Add(time.Minute).UnixNano()
+
+	apply(command{Type: commandJournal, Record: &locking.JournalRecord{Op: locking.JournalOpHold, Path: "a", Id: 1, Fence: 10, LeaseUntil: leaseUntil}})
+	apply(command{Type: commandJournal, Record: &locking.JournalRecord{Op: locking.JournalOpHold, Path: "b", Id: 2, Fence: 11, LeaseUntil: leaseUntil}})
+	apply(command{Type: commandJournal, Record: &locking.JournalRecord{Op: locking.JournalOpRelease, Path: "a", Id: 1}})
+	apply(command{Type: commandMember, NodeId: "node", URL: "http://node"})
+
+	// Restore a snapshot to a fresh state machine.
+	snapshot, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+
+	restored := newFSM()
+	if err := restored.Restore(io.NopCloser(bytes.NewReader(snapshot.(fsmSnapshot)))); err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+
+	holders := restored.holders(time.Now())
+	if len(holders) != 1 || holders[0].Id != 2 || holders[0].Fence != 11 {
+		t.Fatalf("Expected holder 2 to be restored, got %v", holders)
+	}
+	if url := restored.memberURL("node"); url != "http://node" {
+		t.Fatalf("Expected member URL to be restored, got %q", url)
+	}
+
+	// Test that compaction replaces the holders, and that expired holders are not restored.
+	apply(command{Type: commandHolders, Holders: []locking.JournalRecord{
+		{Op: locking.JournalOpHold, Path: "c", Id: 3, LeaseUntil: leaseUntil},
+		{Op: locking.JournalOpHold, Path: "d", Id: 4, LeaseUntil: time.Now().Add(-time.Second).UnixNano()},
+	}})
+
+	if holders := f.holders(time.Now()); len(holders) != 1 || holders[0].Id != 3 {
+		t.Fatalf("Expected holder 3 only, got %v", holders)
+	}
+}
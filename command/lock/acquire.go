@@ -0,0 +1,138 @@
+package lock
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+
+	"lockerd/client"
+)
+
+func NewAcquireFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		flags, server := newFlagSet()
+		lockTimeout := flags.Duration("lock-timeout", time.Minute, "")
+		leaseTimeout := flags.Duration("lease-timeout", time.Minute, "")
+		mode := flags.String("mode", string(client.ModeExclusive), "")
+		owner := flags.String("owner", "", "")
+		try := flags.Bool("try", false, "")
+		capacity := flags.Int("capacity", 0, "")
+		labels := labelFlags{}
+		flags.Var(labels, "label", "")
+
+		return &acquireCmd{
+			ui:           ui,
+			server:       server,
+			lockTimeout:  lockTimeout,
+			leaseTimeout: leaseTimeout,
+			mode:         mode,
+			owner:        owner,
+			try:          try,
+			capacity:     capacity,
+			labels:       labels,
+			flags:        flags,
+		}, nil
+	}
+}
+
+type acquireCmd struct {
+	ui           cli.Ui
+	server       serverFlags
+	lockTimeout  *time.Duration
+	leaseTimeout *time.Duration
+	mode         *string
+	owner        *string
+	try          *bool
+	capacity     *int
+	labels       labelFlags
+	flags        *flag.FlagSet
+}
+
+func (c *acquireCmd) Run(args []string) int {
+	args, ok := parseArgs(c.ui, c.flags, c.Help(), args, 1)
+	if !ok {
+		return exitUsage
+	}
+
+	mode := client.LockMode(*c.mode)
+	if mode != client.ModeExclusive && mode != client.ModeShared {
+		c.ui.Error("Invalid lock mode: " + *c.mode)
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return exitUsage
+	}
+
+	// Permits of semaphores are held in shared mode.
+	if *c.capacity > 0 {
+		mode = client.ModeShared
+	}
+
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	lock, err := c.server.client().Acquire(ctx, args[0], *c.lockTimeout, *c.leaseTimeout, client.AcquireOptions{
+		Mode:     mode,
+		Owner:    *c.owner,
+		Try:      *c.try,
+		Labels:   c.labels,
+		Capacity: *c.capacity,
+	})
+	if err != nil {
+		return reportError(c.ui, err)
+	}
+
+	c.ui.Output(fmt.Sprintf("ID:    %d", lock.Id))
+	c.ui.Output(fmt.Sprintf("Fence: %d", lock.Fence))
+	return 0
+}
+
+func (c *acquireCmd) Synopsis() string {
+	return "Acquire a lock"
+}
+
+func (c *acquireCmd) Help() string {
+	return `Usage: lockerd acquire [options] <path>
+
+  Acquires a lock of a running lockerd server, waiting for up to the lock
+  timeout, and prints the ticket ID and fencing token of the acquisition.
+
+  Exits with 3 if the lock could not be acquired in time, or, with --try,
+  without waiting, and with 1 on any other error.
+
+Options:
+
+` + serverHelp + `
+  --lock-timeout=1m            Maximum time to wait for the lock.
+  --lease-timeout=1m           Time after which the lease expires unless
+                               extended, or a negative duration, such as -1s,
+                               for a lease that never expires.
+  --mode=exclusive             Lock mode. Either exclusive or shared.
+  --owner=                     Owner identity, allowing the owner to re-enter
+                               locks it already holds.
+  --try                        Acquire the lock without waiting.
+  --capacity=0                 Capacity of the lock as a semaphore, acquiring a
+                               permit held in shared mode by at most as many
+                               acquirers at a time. Disabled if zero.
+  --label=                     Label describing the acquirer, of the form
+                               key=value. May be repeated.`
+}
+
+// Label flags.
+type labelFlags map[string]string
+
+func (f labelFlags) String() string {
+	return ""
+}
+
+func (f labelFlags) Set(value string) error {
+	key, value, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value")
+	}
+
+	f[key] = value
+	return nil
+}
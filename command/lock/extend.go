@@ -0,0 +1,73 @@
+package lock
+
+import (
+	"flag"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+func NewExtendFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		flags, server := newFlagSet()
+		leaseTimeout := flags.Duration("lease-timeout", time.Minute, "")
+
+		return &extendCmd{
+			ui:           ui,
+			server:       server,
+			leaseTimeout: leaseTimeout,
+			flags:        flags,
+		}, nil
+	}
+}
+
+type extendCmd struct {
+	ui           cli.Ui
+	server       serverFlags
+	leaseTimeout *time.Duration
+	flags        *flag.FlagSet
+}
+
+func (c *extendCmd) Run(args []string) int {
+	args, ok := parseArgs(c.ui, c.flags, c.Help(), args, 2)
+	if !ok {
+		return exitUsage
+	}
+
+	id, ok := parseId(c.ui, args[1])
+	if !ok {
+		return exitUsage
+	}
+
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	changed, err := c.server.client().Extend(ctx, args[0], id, *c.leaseTimeout)
+	if err != nil {
+		return reportError(c.ui, err)
+	}
+
+	if !changed {
+		c.ui.Output("Lease already expires later")
+	}
+
+	return 0
+}
+
+func (c *extendCmd) Synopsis() string {
+	return "Extend the lease of a lock"
+}
+
+func (c *extendCmd) Help() string {
+	return `Usage: lockerd extend [options] <path> <id>
+
+  Extends the lease of a lock of a running lockerd server held by the ticket of
+  the given ID to expire no sooner than the lease timeout from now.
+
+Options:
+
+` + serverHelp + `
+  --lease-timeout=1m           Time after which the lease expires unless
+                               extended again, or a negative duration, such as
+                               -1s, for a lease that never expires.`
+}
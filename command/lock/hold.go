@@ -0,0 +1,231 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mitchellh/cli"
+
+	"lockerd/client"
+)
+
+// Timeout of the release of a held lock once the command exits.
+const releaseTimeout = 10 * time.Second
+
+func NewHoldFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		flags, server := newFlagSet()
+		lockTimeout := flags.Duration("lock-timeout", time.Minute, "")
+		leaseTimeout := flags.Duration("lease-timeout", 30*time.Second, "")
+		keepAliveInterval := flags.Duration("keepalive-interval", 0, "")
+		mode := flags.String("mode", string(client.ModeExclusive), "")
+		owner := flags.String("owner", "", "")
+		try := flags.Bool("try", false, "")
+		capacity := flags.Int("capacity", 0, "")
+		labels := labelFlags{}
+		flags.Var(labels, "label", "")
+
+		return &holdCmd{
+			ui:                ui,
+			server:            server,
+			lockTimeout:       lockTimeout,
+			leaseTimeout:      leaseTimeout,
+			keepAliveInterval: keepAliveInterval,
+			mode:              mode,
+			owner:             owner,
+			try:               try,
+			capacity:          capacity,
+			labels:            labels,
+			flags:             flags,
+		}, nil
+	}
+}
+
+type holdCmd struct {
+	ui                cli.Ui
+	server            serverFlags
+	lockTimeout       *time.Duration
+	leaseTimeout      *time.Duration
+	keepAliveInterval *time.Duration
+	mode              *string
+	owner             *string
+	try               *bool
+	capacity          *int
+	labels            labelFlags
+	flags             *flag.FlagSet
+}
+
+func (c *holdCmd) Run(args []string) int {
+	// Parse arguments. Parsing stops at the path, so the options of the command are left to it.
+	if err := c.flags.Parse(args); err != nil {
+		c.ui.Error(err.Error())
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return exitUsage
+	}
+
+	args = c.flags.Args()
+	if len(args) > 1 && args[1] == "--" {
+		args = append(args[:1:1], args[2:]...)
+	}
+
+	if len(args) < 2 {
+		c.ui.Error("Expected a path and a command")
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return exitUsage
+	}
+
+	mode := client.LockMode(*c.mode)
+	if mode != client.ModeExclusive && mode != client.ModeShared {
+		c.ui.Error("Invalid lock mode: " + *c.mode)
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return exitUsage
+	}
+
+	// Permits of semaphores are held in shared mode.
+	if *c.capacity > 0 {
+		mode = client.ModeShared
+	}
+
+	// Acquire the lock, abandoning the acquisition upon interruption.
+	lockClient := c.server.client()
+
+	ctx, cancel := requestContext()
+	lock, err := lockClient.Acquire(ctx, args[0], *c.lockTimeout, *c.leaseTimeout, client.AcquireOptions{
+		Mode:     mode,
+		Owner:    *c.owner,
+		Try:      *c.try,
+		Labels:   c.labels,
+		Capacity: *c.capacity,
+	})
+	cancel()
+
+	if err != nil {
+		return reportError(c.ui, err)
+	}
+
+	session := lockClient.NewSession(lock, *c.leaseTimeout)
+	defer c.release(session)
+
+	// Forward signals to the command from now on, so it is terminated on interruption, while the lock is released
+	// once it exits.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	cmd := exec.Command(args[1], args[2:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "LOCKERD_LOCK_ID="+strconv.FormatInt(lock.Id, 10), "LOCKERD_LOCK_FENCE="+strconv.FormatInt(lock.Fence, 10))
+
+	if err := cmd.Start(); err != nil {
+		c.ui.Error("Error starting command: " + err.Error())
+		return exitError
+	}
+
+	// Keep the lease alive while the command runs, terminating the command if the lease is lost.
+	keepAliveCtx, stopKeepAlive := context.WithCancel(context.Background())
+	defer stopKeepAlive()
+
+	lost := make(chan error, 1)
+	go func() {
+		if err := session.KeepAlive(keepAliveCtx, *c.keepAliveInterval); errors.Is(err, client.ErrLeaseLost) {
+			lost <- err
+		}
+	}()
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	leaseLost := false
+	for done := false; !done; {
+		select {
+		case sig := <-signals:
+			cmd.Process.Signal(sig)
+		case <-lost:
+			c.ui.Error("Error: lease of the lock was lost, terminating command")
+			leaseLost = true
+			cmd.Process.Signal(syscall.SIGTERM)
+		case <-exited:
+			done = true
+		}
+	}
+
+	stopKeepAlive()
+
+	if leaseLost {
+		return exitError
+	}
+
+	return exitCode(cmd.ProcessState)
+}
+
+// Release the lock of a session, reporting any failure.
+func (c *holdCmd) release(session *client.Session) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	if err := session.Release(ctx); err != nil && !errors.Is(err, client.ErrNotFound) {
+		c.ui.Error("Error releasing lock: " + err.Error())
+	}
+}
+
+func (c *holdCmd) Synopsis() string {
+	return "Run a command while holding a lock"
+}
+
+func (c *holdCmd) Help() string {
+	return `Usage: lockerd hold [options] <path> [--] <command> [<args>...]
+
+  Acquires a lock of a running lockerd server, runs the command while keeping
+  the lease of the lock alive, and releases the lock once the command exits.
+  The ticket ID and fencing token of the acquisition are passed to the command
+  as LOCKERD_LOCK_ID and LOCKERD_LOCK_FENCE.
+
+  Interruption and termination signals are forwarded to the command. If the
+  lease is lost, the command is terminated.
+
+  Exits with the exit code of the command, or with 3 if the lock could not be
+  acquired in time, and with 1 if the lease was lost or on any other error.
+
+Options:
+
+` + serverHelp + `
+  --lock-timeout=1m            Maximum time to wait for the lock.
+  --lease-timeout=30s          Time after which the lease expires unless
+                               extended, such as if lockerd hold is killed.
+  --keepalive-interval=        Interval at which the lease is extended. Defaults
+                               to half of the lease timeout, with jitter.
+  --mode=exclusive             Lock mode. Either exclusive or shared.
+  --owner=                     Owner identity, allowing the owner to re-enter
+                               locks it already holds.
+  --try                        Acquire the lock without waiting.
+  --capacity=0                 Capacity of the lock as a semaphore, acquiring a
+                               permit held in shared mode by at most as many
+                               acquirers at a time. Disabled if zero.
+  --label=                     Label describing the acquirer, of the form
+                               key=value. May be repeated.`
+}
+
+// Exit code of a process.
+//
+// Processes terminated by a signal exit with 128 plus the number of the signal, as in shells.
+func exitCode(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+
+	return state.ExitCode()
+}
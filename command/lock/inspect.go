@@ -0,0 +1,111 @@
+package lock
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mitchellh/cli"
+
+	"lockerd/client"
+)
+
+func NewInspectFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		flags, server := newFlagSet()
+
+		return &inspectCmd{
+			ui:     ui,
+			server: server,
+			flags:  flags,
+		}, nil
+	}
+}
+
+type inspectCmd struct {
+	ui     cli.Ui
+	server serverFlags
+	flags  *flag.FlagSet
+}
+
+func (c *inspectCmd) Run(args []string) int {
+	args, ok := parseArgs(c.ui, c.flags, c.Help(), args, 1)
+	if !ok {
+		return exitUsage
+	}
+
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	state, err := c.server.client().Inspect(ctx, args[0])
+	if errors.Is(err, client.ErrNotFound) {
+		c.ui.Output("Not locked")
+		return 0
+	} else if err != nil {
+		return reportError(c.ui, err)
+	}
+
+	c.ui.Output(formatLockState(state))
+	return 0
+}
+
+func (c *inspectCmd) Synopsis() string {
+	return "Inspect a lock"
+}
+
+func (c *inspectCmd) Help() string {
+	return `Usage: lockerd inspect [options] <path>
+
+  Prints the state of a lock of a running lockerd server, including its holders
+  and waiting acquirers.
+
+Options:
+
+` + serverHelp
+}
+
+// Format a lock state for display.
+func formatLockState(state *client.LockState) string {
+	var buf bytes.Buffer
+	writer := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(writer, "Mode:\t%s\n", state.Mode)
+	fmt.Fprintf(writer, "Fence:\t%d\n", state.Fence)
+	fmt.Fprintf(writer, "Lock timeout:\t%s\n", formatTimeout(state.LockTimeout))
+	if state.Capacity > 0 {
+		fmt.Fprintf(writer, "Capacity:\t%d (%d permits remaining)\n", state.Capacity, state.Permits)
+	}
+
+	fmt.Fprintf(writer, "\nHolders:\n")
+	fmt.Fprintf(writer, "  ID\tFence\tLease timeout\tDepth\tOwner\tLabels\n")
+	for _, holder := range state.Holders {
+		fmt.Fprintf(writer, "  %d\t%d\t%s\t%d\t%s\t%s\n", holder.Id, holder.Fence, formatTimeout(holder.Timeout), holder.Depth, holder.Owner, formatLabels(holder.Labels))
+	}
+
+	if state.AcquirersTotal > 0 {
+		fmt.Fprintf(writer, "\nAcquirers (%d of %d):\n", len(state.Acquirers), state.AcquirersTotal)
+		fmt.Fprintf(writer, "  ID\tMode\tLock timeout\tOwner\tLabels\n")
+		for _, acquirer := range state.Acquirers {
+			fmt.Fprintf(writer, "  %d\t%s\t%s\t%s\t%s\n", acquirer.Id, acquirer.Mode, formatTimeout(acquirer.Timeout), acquirer.Owner, formatLabels(acquirer.Labels))
+		}
+	}
+
+	writer.Flush()
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Format labels for display, in the order of their keys.
+func formatLabels(labels map[string]string) string {
+	var pairs []string
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,147 @@
+// Package lock implements the CLI commands operating on the locks of a running lockerd server.
+package lock
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mitchellh/cli"
+
+	"lockerd/client"
+)
+
+// Default server URL.
+const defaultServer = "http://localhost:12000"
+
+// Exit codes.
+const (
+	// The request failed.
+	exitError = 1
+
+	// The arguments are invalid.
+	exitUsage = 2
+
+	// The lock could not be acquired in time.
+	exitTimeout = 3
+)
+
+// Help of the options shared by all commands.
+const serverHelp = `  --server=http://localhost:12000
+                               Base URL of the lockerd server.
+  --auth-token=                Bearer token to authenticate requests with.
+                               Unauthenticated if empty.`
+
+// Options shared by all commands.
+type serverFlags struct {
+	server    *string
+	authToken *string
+}
+
+// New flag set.
+//
+// Creates a flag set with the options shared by all commands.
+func newFlagSet() (*flag.FlagSet, serverFlags) {
+	flags := flag.NewFlagSet("", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+
+	return flags, serverFlags{
+		server:    flags.String("server", defaultServer, ""),
+		authToken: flags.String("auth-token", "", ""),
+	}
+}
+
+// Client of the server.
+func (f serverFlags) client() *client.Client {
+	httpClient := http.DefaultClient
+	if *f.authToken != "" {
+		httpClient = &http.Client{
+			Transport: &authTransport{token: *f.authToken, base: http.DefaultTransport},
+		}
+	}
+
+	return client.New(*f.server, httpClient)
+}
+
+// Bearer token authenticating transport.
+type authTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+
+	return t.base.RoundTrip(req)
+}
+
+// Context of a request.
+//
+// The context is canceled upon interruption or termination, abandoning the request.
+func requestContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// Parse arguments.
+//
+// Parses the options, and returns the positional arguments, which must number as many as expected. Returns false, after
+// reporting the usage error, if the arguments are invalid.
+func parseArgs(ui cli.Ui, flags *flag.FlagSet, help string, args []string, expected int) ([]string, bool) {
+	if err := flags.Parse(args); err != nil {
+		ui.Error(err.Error())
+		ui.Error("")
+		ui.Error(help)
+		return nil, false
+	}
+
+	if flags.NArg() != expected {
+		ui.Error(fmt.Sprintf("Expected %d arguments, got %d", expected, flags.NArg()))
+		ui.Error("")
+		ui.Error(help)
+		return nil, false
+	}
+
+	return flags.Args(), true
+}
+
+// Parse a ticket ID argument.
+func parseId(ui cli.Ui, arg string) (int64, bool) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		ui.Error("Invalid ticket ID: " + arg)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// Format a timeout for display.
+func formatTimeout(timeout time.Duration) string {
+	if timeout == client.InfiniteTimeout {
+		return "infinite"
+	}
+
+	return timeout.String()
+}
+
+// Report a failed request.
+//
+// Returns the exit code of the failure, which distinguishes acquisitions timing out from other errors.
+func reportError(ui cli.Ui, err error) int {
+	ui.Error("Error: " + err.Error())
+
+	if errors.Is(err, client.ErrTimeout) || errors.Is(err, client.ErrConflict) {
+		return exitTimeout
+	}
+
+	return exitError
+}
@@ -0,0 +1,61 @@
+package lock
+
+import (
+	"flag"
+
+	"github.com/mitchellh/cli"
+)
+
+func NewReleaseFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		flags, server := newFlagSet()
+
+		return &releaseCmd{
+			ui:     ui,
+			server: server,
+			flags:  flags,
+		}, nil
+	}
+}
+
+type releaseCmd struct {
+	ui     cli.Ui
+	server serverFlags
+	flags  *flag.FlagSet
+}
+
+func (c *releaseCmd) Run(args []string) int {
+	args, ok := parseArgs(c.ui, c.flags, c.Help(), args, 2)
+	if !ok {
+		return exitUsage
+	}
+
+	id, ok := parseId(c.ui, args[1])
+	if !ok {
+		return exitUsage
+	}
+
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	if err := c.server.client().Release(ctx, args[0], id); err != nil {
+		return reportError(c.ui, err)
+	}
+
+	return 0
+}
+
+func (c *releaseCmd) Synopsis() string {
+	return "Release a lock"
+}
+
+func (c *releaseCmd) Help() string {
+	return `Usage: lockerd release [options] <path> <id>
+
+  Releases a lock of a running lockerd server held by the ticket of the given
+  ID, or abandons the acquisition of the ticket if it is still waiting.
+
+Options:
+
+` + serverHelp
+}
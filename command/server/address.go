@@ -0,0 +1,98 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+)
+
+// Default listening address.
+const defaultAddress = ":12000"
+
+// Listening address.
+//
+// Options left empty fall back to the global flags of the same name.
+type listenAddress struct {
+	addr         string
+	authToken    string
+	authHtpasswd string
+	tlsCert      string
+	tlsKey       string
+	tlsClientCA  string
+}
+
+// Address flags.
+//
+// Collects the listening addresses from repeated flags of the form address,key=value,key=value. Defaults to a single
+// address of defaultAddress if no flag is given.
+type addressFlags struct {
+	addresses []listenAddress
+}
+
+func (f *addressFlags) String() string {
+	return ""
+}
+
+func (f *addressFlags) Set(value string) error {
+	addr, options, _ := strings.Cut(value, ",")
+	if addr == "" {
+		return fmt.Errorf("missing address in %q", value)
+	}
+
+	address := listenAddress{addr: addr}
+
+	for _, option := range strings.Split(options, ",") {
+		if option == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(option, "=")
+		if !ok {
+			return fmt.Errorf("invalid address option %q", option)
+		}
+
+		switch key {
+		case "auth-token":
+			address.authToken = value
+		case "auth-htpasswd":
+			address.authHtpasswd = value
+		case "tls-cert":
+			address.tlsCert = value
+		case "tls-key":
+			address.tlsKey = value
+		case "tls-client-ca":
+			address.tlsClientCA = value
+		default:
+			return fmt.Errorf("unknown address option %q", key)
+		}
+	}
+
+	f.addresses = append(f.addresses, address)
+
+	return nil
+}
+
+// Listening addresses.
+//
+// Returns the addresses with their options falling back to the given global options.
+func (f *addressFlags) resolve(global listenAddress) []listenAddress {
+	addresses := f.addresses
+	if len(addresses) == 0 {
+		addresses = []listenAddress{{addr: defaultAddress}}
+	}
+
+	resolved := make([]listenAddress, len(addresses))
+
+	for idx, address := range addresses {
+		resolved[idx] = listenAddress{
+			addr:         address.addr,
+			authToken:    cmp.Or(address.authToken, global.authToken),
+			authHtpasswd: cmp.Or(address.authHtpasswd, global.authHtpasswd),
+			tlsCert:      cmp.Or(address.tlsCert, global.tlsCert),
+			tlsKey:       cmp.Or(address.tlsKey, global.tlsKey),
+			tlsClientCA:  cmp.Or(address.tlsClientCA, global.tlsClientCA),
+		}
+	}
+
+	return resolved
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Options that may be repeated, and may thus be given as lists in configuration files.
+var repeatableOptions = map[string]bool{
+	"address":   true,
+	"namespace": true,
+}
+
+// Load a configuration file.
+//
+// The file is a YAML mapping of option names to values, where the options are those of the command line without
+// leading dashes, and their values are parsed the same way, so the flags double as the schema of the file. Repeatable
+// options may be given as lists. Options given on the command line take precedence over the file, replacing all of
+// its values of repeatable options. Unknown options and invalid values fail with the line of the file.
+func loadConfigFile(flags *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	// An empty file configures nothing.
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping of options", root.Line)
+	}
+
+	// Collect the options given on the command line before applying the file, which sets flags in turn.
+	overridden := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		overridden[f.Name] = true
+	})
+
+	seen := make(map[string]bool)
+
+	for idx := 0; idx < len(root.Content); idx += 2 {
+		key, value := root.Content[idx], root.Content[idx+1]
+		name := key.Value
+
+		if flags.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("line %d: unknown option %s", key.Line, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("line %d: duplicate option %s", key.Line, name)
+		}
+		seen[name] = true
+
+		values, err := configValues(name, value)
+		if err != nil {
+			return err
+		}
+
+		if overridden[name] {
+			continue
+		}
+
+		for _, v := range values {
+			if err := flags.Set(name, v.Value); err != nil {
+				return fmt.Errorf("line %d: invalid value %q for option %s: %w", v.Line, v.Value, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Values of an option of a configuration file.
+//
+// Returns the scalar value of an option, or the scalar values of a list of a repeatable option.
+func configValues(name string, value *yaml.Node) ([]*yaml.Node, error) {
+	switch {
+	case value.Kind == yaml.ScalarNode:
+		return []*yaml.Node{value}, nil
+	case value.Kind == yaml.SequenceNode && repeatableOptions[name]:
+		for _, item := range value.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: expected a value for option %s", item.Line, name)
+			}
+		}
+
+		return value.Content, nil
+	case value.Kind == yaml.SequenceNode:
+		return nil, fmt.Errorf("line %d: option %s cannot be repeated", value.Line, name)
+	default:
+		return nil, fmt.Errorf("line %d: expected a value for option %s", value.Line, name)
+	}
+}
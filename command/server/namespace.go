@@ -0,0 +1,83 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"lockerd/locking"
+)
+
+// Namespace flags.
+//
+// Collects the configuration of namespaces from repeated flags of the form name:key=value,key=value, where an empty
+// name configures the default namespace.
+type namespaceFlags struct {
+	defaultConfig locking.NamespaceConfig
+	configs       map[string]locking.NamespaceConfig
+	tokens        map[string]string
+}
+
+func (f *namespaceFlags) String() string {
+	return ""
+}
+
+func (f *namespaceFlags) Set(value string) error {
+	name, options, _ := strings.Cut(value, ":")
+
+	var config locking.NamespaceConfig
+	var token string
+
+	for _, option := range strings.Split(options, ",") {
+		if option == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(option, "=")
+		if !ok {
+			return fmt.Errorf("invalid namespace option %q", option)
+		}
+
+		var err error
+
+		switch key {
+		case "max-queue-depth":
+			config.MaxQueueDepth, err = strconv.Atoi(value)
+		case "max-lease-timeout":
+			config.MaxLeaseTimeout, err = time.ParseDuration(value)
+		case "capacity":
+			config.Capacity, err = strconv.Atoi(value)
+		case "auth-token":
+			token = value
+		default:
+			return fmt.Errorf("unknown namespace option %q", key)
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid namespace option %q", option)
+		}
+	}
+
+	if name == "" {
+		if token != "" {
+			return errors.New("the default namespace cannot have a scoped auth token")
+		}
+
+		f.defaultConfig = config
+		return nil
+	}
+
+	if f.configs == nil {
+		f.configs = make(map[string]locking.NamespaceConfig)
+		f.tokens = make(map[string]string)
+	}
+
+	f.configs[name] = config
+	if token != "" {
+		f.tokens[name] = token
+	}
+
+	return nil
+}
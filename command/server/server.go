@@ -1,13 +1,36 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"flag"
 	"io/ioutil"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/facebookgo/grace/gracehttp"
 	"github.com/mitchellh/cli"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
+	"lockerd/cluster"
+	"lockerd/grpcserver"
 	"lockerd/httpserver"
 	"lockerd/locking"
 	"lockerd/version"
@@ -17,20 +40,181 @@ func NewFactory(ui cli.Ui) cli.CommandFactory {
 	return func() (cli.Command, error) {
 		flags := flag.NewFlagSet("", flag.ContinueOnError)
 		flags.SetOutput(ioutil.Discard)
-		addr := flags.String("address", ":12000", "")
+		configPath := flags.String("config", "", "")
+		addresses := &addressFlags{}
+		flags.Var(addresses, "address", "")
+		socket := flags.String("socket", "", "")
+		grpcAddr := flags.String("grpc-address", "", "")
+		pathNormalization := flags.String("path-normalization", "strict", "")
+		pathPattern := flags.String("path-pattern", "", "")
+		maxPathLength := flags.Int("max-path-length", locking.DefaultMaxPathLength, "")
+		maxPathSegments := flags.Int("max-path-segments", locking.DefaultMaxPathSegments, "")
+		minLeaseTimeout := flags.Duration("min-lease-timeout", 0, "")
+		maxLeaseTimeout := flags.Duration("max-lease-timeout", 0, "")
+		maxLockTimeout := flags.Duration("max-lock-timeout", 0, "")
+		maxHoldTime := flags.Duration("max-hold-time", 0, "")
+		defaultLockTimeout := flags.Duration("default-lock-timeout", 0, "")
+		defaultLeaseTimeout := flags.Duration("default-lease-timeout", 0, "")
+		timeoutPolicy := flags.String("timeout-policy", "clamp", "")
+		maintenanceJitter := flags.Duration("maintenance-jitter", 0, "")
+		shards := flags.Int("shards", 1, "")
+		idStrategy := flags.String("id-strategy", "sequential", "")
+		fairness := flags.String("fairness", "fair", "")
+		auditHistorySize := flags.Int("audit-history-size", 0, "")
+		auditHistoryPaths := flags.Int("audit-history-paths", locking.DefaultAuditHistoryPaths, "")
+		holdHistogram := flags.String("hold-histogram", "none", "")
+		namespaces := &namespaceFlags{}
+		flags.Var(namespaces, "namespace", "")
+		walPath := flags.String("wal-path", "", "")
+		raftDir := flags.String("raft-dir", "", "")
+		raftBind := flags.String("raft-bind", "", "")
+		raftId := flags.String("raft-id", "", "")
+		raftAdvertiseURL := flags.String("raft-advertise-url", "", "")
+		join := flags.String("join", "", "")
+		walCompactionInterval := flags.Duration("wal-compaction-interval", time.Minute, "")
+		authToken := flags.String("auth-token", "", "")
+		authHtpasswd := flags.String("auth-htpasswd", "", "")
+		authExempt := flags.String("auth-exempt", "", "")
+		enableAdmin := flags.Bool("enable-admin", false, "")
+		numericJson := flags.Bool("numeric-json", false, "")
+		noContent := flags.Bool("no-content", false, "")
+		maxLongPoll := flags.Duration("max-long-poll", 0, "")
+		requestTimeout := flags.Duration("request-timeout", 0, "")
+		compress := flags.Bool("compress", false, "")
+		compressMinSize := flags.Int("compress-min-size", httpserver.DefaultCompressionMinSize, "")
+		rateLimit := flags.Float64("rate-limit", 0, "")
+		rateBurst := flags.Int("rate-burst", 0, "")
+		rateLimitPerPath := flags.Bool("rate-limit-per-path", false, "")
+		webhookWorkers := flags.Int("webhook-workers", 0, "")
+		webhookRetries := flags.Int("webhook-retries", httpserver.DefaultWebhookRetries, "")
+		webhookTimeout := flags.Duration("webhook-timeout", httpserver.DefaultWebhookTimeout, "")
+		tlsCert := flags.String("tls-cert", "", "")
+		tlsKey := flags.String("tls-key", "", "")
+		tlsClientCA := flags.String("tls-client-ca", "", "")
+		drainTimeout := flags.Duration("drain-timeout", 30*time.Second, "")
+		shutdownGrace := flags.Duration("shutdown-grace", 0, "")
+		logLevel := flags.String("log-level", "info", "")
+		logFormat := flags.String("log-format", "text", "")
+		otelEndpoint := flags.String("otel-endpoint", "", "")
 
 		return &cmd{
-			ui:    ui,
-			addr:  addr,
-			flags: flags,
+			ui:                    ui,
+			configPath:            configPath,
+			addresses:             addresses,
+			socket:                socket,
+			grpcAddr:              grpcAddr,
+			pathNormalization:     pathNormalization,
+			pathPattern:           pathPattern,
+			maxPathLength:         maxPathLength,
+			maxPathSegments:       maxPathSegments,
+			minLeaseTimeout:       minLeaseTimeout,
+			maxLeaseTimeout:       maxLeaseTimeout,
+			maxLockTimeout:        maxLockTimeout,
+			maxHoldTime:           maxHoldTime,
+			defaultLockTimeout:    defaultLockTimeout,
+			defaultLeaseTimeout:   defaultLeaseTimeout,
+			timeoutPolicy:         timeoutPolicy,
+			maintenanceJitter:     maintenanceJitter,
+			shards:                shards,
+			idStrategy:            idStrategy,
+			fairness:              fairness,
+			auditHistorySize:      auditHistorySize,
+			auditHistoryPaths:     auditHistoryPaths,
+			holdHistogram:         holdHistogram,
+			namespaces:            namespaces,
+			walPath:               walPath,
+			walCompactionInterval: walCompactionInterval,
+			raftDir:               raftDir,
+			raftBind:              raftBind,
+			raftId:                raftId,
+			raftAdvertiseURL:      raftAdvertiseURL,
+			join:                  join,
+			authToken:             authToken,
+			authHtpasswd:          authHtpasswd,
+			authExempt:            authExempt,
+			enableAdmin:           enableAdmin,
+			numericJson:           numericJson,
+			noContent:             noContent,
+			maxLongPoll:           maxLongPoll,
+			requestTimeout:        requestTimeout,
+			compress:              compress,
+			compressMinSize:       compressMinSize,
+			rateLimit:             rateLimit,
+			rateBurst:             rateBurst,
+			rateLimitPerPath:      rateLimitPerPath,
+			webhookWorkers:        webhookWorkers,
+			webhookRetries:        webhookRetries,
+			webhookTimeout:        webhookTimeout,
+			tlsCert:               tlsCert,
+			tlsKey:                tlsKey,
+			tlsClientCA:           tlsClientCA,
+			drainTimeout:          drainTimeout,
+			shutdownGrace:         shutdownGrace,
+			logLevel:              logLevel,
+			logFormat:             logFormat,
+			otelEndpoint:          otelEndpoint,
+			flags:                 flags,
 		}, nil
 	}
 }
 
 type cmd struct {
-	ui    cli.Ui
-	addr  *string
-	flags *flag.FlagSet
+	ui                    cli.Ui
+	configPath            *string
+	addresses             *addressFlags
+	socket                *string
+	grpcAddr              *string
+	pathNormalization     *string
+	pathPattern           *string
+	maxPathLength         *int
+	maxPathSegments       *int
+	minLeaseTimeout       *time.Duration
+	maxLeaseTimeout       *time.Duration
+	maxLockTimeout        *time.Duration
+	maxHoldTime           *time.Duration
+	defaultLockTimeout    *time.Duration
+	defaultLeaseTimeout   *time.Duration
+	timeoutPolicy         *string
+	maintenanceJitter     *time.Duration
+	shards                *int
+	idStrategy            *string
+	fairness              *string
+	auditHistorySize      *int
+	auditHistoryPaths     *int
+	holdHistogram         *string
+	namespaces            *namespaceFlags
+	walPath               *string
+	walCompactionInterval *time.Duration
+	raftDir               *string
+	raftBind              *string
+	raftId                *string
+	raftAdvertiseURL      *string
+	join                  *string
+	authToken             *string
+	authHtpasswd          *string
+	authExempt            *string
+	enableAdmin           *bool
+	numericJson           *bool
+	noContent             *bool
+	maxLongPoll           *time.Duration
+	requestTimeout        *time.Duration
+	compress              *bool
+	compressMinSize       *int
+	rateLimit             *float64
+	rateBurst             *int
+	rateLimitPerPath      *bool
+	webhookWorkers        *int
+	webhookRetries        *int
+	webhookTimeout        *time.Duration
+	tlsCert               *string
+	tlsKey                *string
+	tlsClientCA           *string
+	drainTimeout          *time.Duration
+	shutdownGrace         *time.Duration
+	logLevel              *string
+	logFormat             *string
+	otelEndpoint          *string
+	flags                 *flag.FlagSet
 }
 
 func (c *cmd) Run(args []string) int {
@@ -42,25 +226,685 @@ func (c *cmd) Run(args []string) int {
 		return 2
 	}
 
+	// Load the configuration file if given, which the command line overrides.
+	if *c.configPath != "" {
+		if err := loadConfigFile(c.flags, *c.configPath); err != nil {
+			c.ui.Error("Invalid configuration file " + *c.configPath + ": " + err.Error())
+			return 2
+		}
+	}
+
+	// Set up the logger.
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*c.logLevel)); err != nil {
+		c.ui.Error("Invalid log level: " + *c.logLevel)
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return 2
+	}
+
+	var logHandler slog.Handler
+
+	switch *c.logFormat {
+	case "text":
+		logHandler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	case "json":
+		logHandler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	default:
+		c.ui.Error("Invalid log format: " + *c.logFormat)
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return 2
+	}
+
+	logger := slog.New(logHandler)
+
+	// Export traces of requests and lock handoffs if enabled.
+	var tracerProvider trace.TracerProvider
+	if *c.otelEndpoint != "" {
+		exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(*c.otelEndpoint))
+		if err != nil {
+			c.ui.Error("Error setting up trace exporter: " + err.Error())
+			return 1
+		}
+
+		sdkTracerProvider := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "lockerd"))),
+		)
+		defer sdkTracerProvider.Shutdown(context.Background())
+
+		tracerProvider = sdkTracerProvider
+	}
+
 	// Set up the lock manager.
-	manager := locking.NewManager(locking.Config{})
+	config := locking.Config{
+		WALPath:               *c.walPath,
+		WALCompactionInterval: *c.walCompactionInterval,
+		MaxPathLength:         *c.maxPathLength,
+		MaxPathSegments:       *c.maxPathSegments,
+		MinLeaseTimeout:       *c.minLeaseTimeout,
+		MaxLeaseTimeout:       *c.maxLeaseTimeout,
+		MaxLockTimeout:        *c.maxLockTimeout,
+		MaxTotalHoldTime:      *c.maxHoldTime,
+		DefaultLockTimeout:    *c.defaultLockTimeout,
+		DefaultLeaseTimeout:   *c.defaultLeaseTimeout,
+		MaintenanceJitter:     *c.maintenanceJitter,
+		Shards:                *c.shards,
+		AuditHistorySize:      *c.auditHistorySize,
+		AuditHistoryPaths:     *c.auditHistoryPaths,
+		DefaultNamespace:      c.namespaces.defaultConfig,
+		Namespaces:            c.namespaces.configs,
+		TracerProvider:        tracerProvider,
+		Logger:                logger,
+	}
+
+	switch *c.pathNormalization {
+	case "strict":
+		config.PathNormalization = locking.PathNormalizationStrict
+	case "lenient":
+		config.PathNormalization = locking.PathNormalizationLenient
+	default:
+		c.ui.Error("Invalid path normalization: " + *c.pathNormalization)
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return 2
+	}
+
+	switch *c.timeoutPolicy {
+	case "clamp":
+		config.TimeoutPolicy = locking.TimeoutPolicyClamp
+	case "reject":
+		config.TimeoutPolicy = locking.TimeoutPolicyReject
+	default:
+		c.ui.Error("Invalid timeout policy: " + *c.timeoutPolicy)
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return 2
+	}
+
+	switch *c.idStrategy {
+	case "sequential":
+		config.IDStrategy = locking.IDStrategySequential
+	case "random64":
+		config.IDStrategy = locking.IDStrategyRandom
+	case "uuid":
+		config.IDStrategy = locking.IDStrategyUUID
+	default:
+		c.ui.Error("Invalid ID strategy: " + *c.idStrategy)
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return 2
+	}
+
+	switch *c.fairness {
+	case "fair":
+		config.Fairness = locking.FairnessFair
+	case "barging":
+		config.Fairness = locking.FairnessBarging
+	default:
+		c.ui.Error("Invalid fairness policy: " + *c.fairness)
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return 2
+	}
+
+	switch *c.holdHistogram {
+	case "none":
+		config.HoldHistogram = locking.HoldHistogramDisabled
+	case "aggregate":
+		config.HoldHistogram = locking.HoldHistogramAggregate
+	case "namespace":
+		config.HoldHistogram = locking.HoldHistogramByNamespace
+	case "path":
+		config.HoldHistogram = locking.HoldHistogramByPath
+	default:
+		c.ui.Error("Invalid hold histogram mode: " + *c.holdHistogram)
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return 2
+	}
+
+	if *c.pathPattern != "" {
+		pathPattern, err := regexp.Compile(`^(?:` + *c.pathPattern + `)$`)
+		if err != nil {
+			c.ui.Error("Invalid path pattern: " + err.Error())
+			c.ui.Error("")
+			c.ui.Error(c.Help())
+			return 2
+		}
 
-	// Set up the server.
-	handler := httpserver.NewHandler(manager)
-	server := &http.Server{
-		Addr:    *c.addr,
-		Handler: handler,
+		config.PathPattern = pathPattern
 	}
 
-	c.ui.Output("Starting lockerd " + version.HumanVersion() + " HTTP API server on " + *c.addr)
+	// The HTTP server listens on either a TCP address or a Unix domain socket.
+	if *c.socket != "" && isFlagSet(c.flags, "address") {
+		c.ui.Error("--socket and --address are mutually exclusive")
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return 2
+	}
+
+	// Resolve the options of the listening addresses, which fall back to the global options.
+	addresses := c.addresses.resolve(listenAddress{
+		authToken:    *c.authToken,
+		authHtpasswd: *c.authHtpasswd,
+		tlsCert:      *c.tlsCert,
+		tlsKey:       *c.tlsKey,
+		tlsClientCA:  *c.tlsClientCA,
+	})
+
+	// The admin endpoints must be guarded by authentication with global credentials on every address.
+	if *c.enableAdmin {
+		exempt := slices.Contains(strings.Split(*c.authExempt, ","), "/")
+		for _, address := range addresses {
+			if address.authToken == "" && address.authHtpasswd == "" || exempt {
+				c.ui.Error("The admin endpoints require --auth-token or --auth-htpasswd, on every address, and / must not be exempt")
+				c.ui.Error("")
+				c.ui.Error(c.Help())
+				return 2
+			}
+		}
+	}
+
+	// Clustering replicates locks through Raft rather than a write-ahead log, and only serves the HTTP API, which the
+	// other nodes must be able to reach.
+	if *c.raftDir != "" {
+		if *c.raftBind == "" {
+			c.ui.Error("Clustering requires --raft-bind")
+			c.ui.Error("")
+			c.ui.Error(c.Help())
+			return 2
+		}
+
+		if *c.walPath != "" || *c.grpcAddr != "" {
+			c.ui.Error("--raft-dir is mutually exclusive with --wal-path and --grpc-address")
+			c.ui.Error("")
+			c.ui.Error(c.Help())
+			return 2
+		}
+
+		if *c.socket != "" && *c.raftAdvertiseURL == "" {
+			c.ui.Error("Clustering on a Unix domain socket requires --raft-advertise-url")
+			c.ui.Error("")
+			c.ui.Error(c.Help())
+			return 2
+		}
+	} else if *c.join != "" {
+		c.ui.Error("--join requires --raft-dir")
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return 2
+	}
+
+	// Sharding does not support journaling, whether to a write-ahead log or through Raft.
+	if *c.shards > 1 && (*c.walPath != "" || *c.raftDir != "") {
+		c.ui.Error("--shards is mutually exclusive with --wal-path and --raft-dir")
+		c.ui.Error("")
+		c.ui.Error(c.Help())
+		return 2
+	}
+
+	// Load the TLS configuration if enabled, globally for the gRPC API server, and for each listening address.
+	tlsConfig, err := loadTLSConfig(*c.tlsCert, *c.tlsKey, *c.tlsClientCA)
+	if err != nil {
+		c.ui.Error("Error loading TLS configuration: " + err.Error())
+		return 1
+	}
+
+	addressTLSConfigs := make([]*tls.Config, len(addresses))
+	for idx, address := range addresses {
+		if addressTLSConfigs[idx], err = loadTLSConfig(address.tlsCert, address.tlsKey, address.tlsClientCA); err != nil {
+			c.ui.Error("Error loading TLS configuration of " + address.addr + ": " + err.Error())
+			return 1
+		}
+	}
+
+	// Set up the lock manager, or a cluster node running one while leading the cluster.
+	var manager locking.Manager
+	var node *cluster.Node
+
+	if *c.raftDir != "" {
+		advertiseURL := *c.raftAdvertiseURL
+		if advertiseURL == "" {
+			advertiseURL = defaultAdvertiseURL(*c.raftBind, addresses[0].addr, addressTLSConfigs[0] != nil)
+		}
+
+		node, err = cluster.NewNode(cluster.Config{
+			NodeId:    *c.raftId,
+			Dir:       *c.raftDir,
+			Addr:      *c.raftBind,
+			URL:       advertiseURL,
+			Bootstrap: *c.join == "",
+			Manager:   config,
+			Logger:    logger,
+		})
+		if err != nil {
+			c.ui.Error("Error starting cluster node: " + err.Error())
+			return 1
+		}
+
+		defer node.Close()
+
+		if *c.join != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err := node.JoinCluster(ctx, *c.join, *c.authToken)
+			cancel()
+
+			if err != nil {
+				c.ui.Error("Error joining cluster: " + err.Error())
+				return 1
+			}
+		}
+
+		c.ui.Output("Starting lockerd " + version.HumanVersion() + " cluster node on " + *c.raftBind + ", advertising " + advertiseURL)
+	} else {
+		manager, err = locking.NewManager(config)
+		if err != nil {
+			c.ui.Error("Error restoring locks: " + err.Error())
+			return 1
+		}
+
+		manager.Start()
+		defer manager.Stop()
+	}
+
+	// Set up the gRPC server if enabled, running concurrently with the HTTP server.
+	if *c.grpcAddr != "" {
+		listener, err := net.Listen("tcp", *c.grpcAddr)
+		if err != nil {
+			c.ui.Error("Error starting gRPC server: " + err.Error())
+			return 1
+		}
+
+		var grpcOptions []grpc.ServerOption
+		if tlsConfig != nil {
+			grpcOptions = append(grpcOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+
+		grpcServer := grpcserver.NewServer(manager, grpcOptions...)
+		defer grpcServer.GracefulStop()
+
+		c.ui.Output("Starting lockerd " + version.HumanVersion() + " gRPC API server on " + *c.grpcAddr)
+
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				c.ui.Error("Error serving gRPC: " + err.Error())
+			}
+		}()
+	}
+
+	// Set up the server, requiring authentication if configured.
+	handlerOptions := httpserver.HandlerOptions{
+		Logger:              logger,
+		EnableAdmin:         *c.enableAdmin,
+		NumericJSON:         *c.numericJson,
+		NoContent:           *c.noContent,
+		MaxLongPollDuration: *c.maxLongPoll,
+		RequestTimeout:      *c.requestTimeout,
+		TracerProvider:      tracerProvider,
+		IDStrategy:          config.IDStrategy,
+	}
+
+	// Deliver webhooks if enabled.
+	if *c.webhookWorkers > 0 {
+		retries := *c.webhookRetries
+		if retries == 0 {
+			retries = -1
+		}
+
+		notifier := httpserver.NewNotifier(httpserver.NotifierConfig{
+			Workers:    *c.webhookWorkers,
+			Retries:    retries,
+			Timeout:    *c.webhookTimeout,
+			Logger:     logger,
+			IDStrategy: config.IDStrategy,
+		})
+		defer notifier.Close()
+
+		handlerOptions.Notifier = notifier
+	}
 
-	if err := gracehttp.Serve(server); err != nil {
+	var handler http.Handler
+	if node != nil {
+		handler = cluster.NewHandler(node, func(manager locking.Manager) http.Handler {
+			return httpserver.NewHandler(manager, handlerOptions)
+		})
+	} else {
+		handler = httpserver.NewHandler(manager, handlerOptions)
+	}
+
+	// Limit the rate of requests if enabled. Authentication wraps the limit, so authenticated clients are limited by
+	// their identity.
+	if *c.rateLimit > 0 {
+		handler = httpserver.NewRateLimitHandler(handler, httpserver.RateLimitConfig{
+			Rate:    *c.rateLimit,
+			Burst:   *c.rateBurst,
+			PerPath: *c.rateLimitPerPath,
+		})
+	}
+
+	// Set up a server for each listening address, sharing the manager and rate limits, but authenticating by the
+	// credentials of the address.
+	servers := make([]*http.Server, len(addresses))
+
+	for idx, address := range addresses {
+		addressHandler := handler
+
+		if address.authToken != "" || address.authHtpasswd != "" || len(c.namespaces.tokens) > 0 {
+			authConfig := httpserver.AuthConfig{
+				Token:           address.authToken,
+				NamespaceTokens: c.namespaces.tokens,
+			}
+
+			if address.authHtpasswd != "" {
+				authConfig.Credentials, err = httpserver.LoadHtpasswd(address.authHtpasswd)
+				if err != nil {
+					c.ui.Error("Error loading credentials: " + err.Error())
+					return 1
+				}
+			}
+
+			if *c.authExempt != "" {
+				authConfig.ExemptPaths = strings.Split(*c.authExempt, ",")
+			}
+
+			addressHandler = httpserver.NewAuthHandler(addressHandler, authConfig)
+		}
+
+		if *c.compress {
+			addressHandler = httpserver.NewCompressionHandler(addressHandler, httpserver.CompressionConfig{
+				MinSize: *c.compressMinSize,
+			})
+		}
+
+		// Assign request IDs outermost, so rejections by authentication and rate limiting can be correlated as well.
+		addressHandler = httpserver.NewRequestIDHandler(addressHandler)
+
+		// Bound reading requests and writing responses by the request timeout. The handler extends the deadlines of
+		// requests waiting for locks, or streaming, so they are not cut short.
+		servers[idx] = &http.Server{
+			Addr:         address.addr,
+			Handler:      addressHandler,
+			TLSConfig:    addressTLSConfigs[idx],
+			ReadTimeout:  *c.requestTimeout,
+			WriteTimeout: *c.requestTimeout,
+		}
+
+		listenAddr := address.addr
+		if *c.socket != "" {
+			listenAddr = "unix:" + *c.socket
+		}
+
+		if addressTLSConfigs[idx] != nil {
+			c.ui.Output("Starting lockerd " + version.HumanVersion() + " HTTPS API server on " + listenAddr)
+		} else {
+			c.ui.Output("Starting lockerd " + version.HumanVersion() + " HTTP API server on " + listenAddr)
+		}
+	}
+
+	// Drain the manager upon termination, so new acquisitions are refused while waiting acquisitions settle. The HTTP
+	// servers are shut down together concurrently, and serving only returns without error once all are terminated.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	terminated := make(chan struct{})
+	drained := make(chan error, 1)
+
+	go func() {
+		<-signals
+		signal.Stop(signals)
+
+		// Announce the shutdown ahead of draining if requested, so holders can finish and release their locks during
+		// the grace period, while the servers keep serving.
+		if *c.shutdownGrace > 0 {
+			if node != nil {
+				node.AnnounceShutdown(*c.shutdownGrace)
+			} else {
+				manager.AnnounceShutdown(*c.shutdownGrace)
+			}
+
+			time.Sleep(*c.shutdownGrace)
+		}
+
+		close(terminated)
+
+		ctx, cancel := context.WithTimeout(context.Background(), *c.drainTimeout)
+		defer cancel()
+		if node != nil {
+			drained <- node.Drain(ctx)
+		} else {
+			drained <- manager.Drain(ctx)
+		}
+	}()
+
+	if *c.socket != "" {
+		err = c.serveSocket(servers[0], terminated)
+	} else if *c.shutdownGrace > 0 {
+		err = c.serveAddresses(servers, terminated)
+	} else {
+		err = gracehttp.Serve(servers...)
+	}
+
+	if err != nil {
 		c.ui.Error("Error starting HTTP server: " + err.Error())
+		return 1
+	}
+
+	if err := <-drained; err != nil {
+		c.ui.Error("Stopping with acquisitions still waiting: " + err.Error())
 	}
 
 	return 0
 }
 
+// Default URL advertised to the other nodes of a cluster.
+//
+// Combines the host of the Raft address, which is reachable by the other nodes, with the port of the HTTP address.
+func defaultAdvertiseURL(raftAddr string, httpAddr string, tls bool) string {
+	raftHost, _, _ := net.SplitHostPort(raftAddr)
+	_, httpPort, _ := net.SplitHostPort(httpAddr)
+
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+
+	return scheme + "://" + net.JoinHostPort(raftHost, httpPort)
+}
+
+// Serve HTTP on a Unix domain socket.
+//
+// A stale socket file left behind by a previous server is replaced. Graceful restarts by SIGUSR2 are not supported,
+// as the socket cannot be handed over to a new process, and are ignored. Once terminated, the server is shut down,
+// waiting for requests in flight up to the drain timeout, and the socket file is removed.
+func (c *cmd) serveSocket(server *http.Server, terminated <-chan struct{}) error {
+	if err := removeStaleSocket(*c.socket); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("unix", *c.socket)
+	if err != nil {
+		return err
+	}
+
+	if server.TLSConfig != nil {
+		listener = tls.NewListener(listener, server.TLSConfig)
+	}
+
+	// Closing the listener removes the socket file.
+	return c.serveListeners([]*http.Server{server}, []net.Listener{listener}, terminated, "when listening on a Unix socket")
+}
+
+// Serve HTTP on the listening addresses until terminated.
+//
+// Unlike graceful serving, which stops accepting connections as soon as the process is signaled, the servers keep
+// serving until terminated, so holders can still release their locks during the shutdown grace period. Graceful
+// restarts by SIGUSR2 are not supported, and are ignored.
+func (c *cmd) serveAddresses(servers []*http.Server, terminated <-chan struct{}) error {
+	listeners := make([]net.Listener, len(servers))
+
+	for idx, server := range servers {
+		listener, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			return err
+		}
+
+		if server.TLSConfig != nil {
+			listener = tls.NewListener(listener, server.TLSConfig)
+		}
+
+		listeners[idx] = listener
+	}
+
+	return c.serveListeners(servers, listeners, terminated, "with a shutdown grace period")
+}
+
+// Serve HTTP on listeners until terminated.
+//
+// Graceful restarts by SIGUSR2 are ignored, with a warning of why they are unsupported. Once terminated, the servers
+// are shut down concurrently, waiting for requests in flight up to the drain timeout, after which the connections
+// still open, such as of streamed locks, are closed.
+func (c *cmd) serveListeners(servers []*http.Server, listeners []net.Listener, terminated <-chan struct{}, unsupported string) error {
+	restarts := make(chan os.Signal, 1)
+	signal.Notify(restarts, syscall.SIGUSR2)
+	defer signal.Stop(restarts)
+
+	shutdown := make(chan error, len(servers))
+
+	go func() {
+		for {
+			select {
+			case <-restarts:
+				c.ui.Warn("Ignoring graceful restart, which is not supported " + unsupported)
+			case <-terminated:
+				ctx, cancel := context.WithTimeout(context.Background(), *c.drainTimeout)
+				defer cancel()
+
+				// Await the shutdown of every server before the deadline is canceled.
+				var wg sync.WaitGroup
+				for _, server := range servers {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+
+						err := server.Shutdown(ctx)
+						if err == context.DeadlineExceeded {
+							err = server.Close()
+						}
+						shutdown <- err
+					}()
+				}
+
+				wg.Wait()
+				return
+			}
+		}
+	}()
+
+	served := make(chan error, len(servers))
+	for idx, server := range servers {
+		go func() {
+			served <- server.Serve(listeners[idx])
+		}()
+	}
+
+	for range servers {
+		if err := <-served; err != http.ErrServerClosed {
+			return err
+		}
+	}
+
+	for range servers {
+		if err := <-shutdown; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Remove a stale socket file.
+//
+// The file is only removed if it is a socket that no server is listening on, and does nothing if there is no file.
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.New(path + " exists and is not a socket")
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return errors.New(path + " is in use by another server")
+	}
+
+	return os.Remove(path)
+}
+
+// Test if a flag was set on the command line.
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
+
+// Load a TLS configuration.
+//
+// Returns nil if TLS is not enabled. If a client CA is given, clients are required to present a certificate chaining
+// to it.
+func loadTLSConfig(certPath, keyPath, clientCAPath string) (*tls.Config, error) {
+	if certPath == "" && keyPath == "" {
+		if clientCAPath != "" {
+			return nil, errors.New("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+
+		return nil, nil
+	}
+
+	if certPath == "" || keyPath == "" {
+		return nil, errors.New("both --tls-cert and --tls-key must be given")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAPath != "" {
+		pem, err := os.ReadFile(clientCAPath)
+		if err != nil {
+			return nil, err
+		}
+
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + clientCAPath)
+		}
+
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
 func (c *cmd) Synopsis() string {
 	return "Start the lockerd server"
 }
@@ -72,5 +916,184 @@ func (c *cmd) Help() string {
 
 Options:
 
-  --address=:12000  Listening address.`
+  --config=                    Path of a YAML configuration file of options,
+                               mapping the names of the options below to their
+                               values, such as max-lease-timeout: 1m. Repeatable
+                               options may be given as lists. Options given on
+                               the command line take precedence. Disabled if
+                               empty.
+  --address=:12000             Listening address of the HTTP API server, followed
+                               by comma-separated options of the address, such
+                               as --address=:12001,auth-token=token. The options
+                               auth-token, auth-htpasswd, tls-cert, tls-key and
+                               tls-client-ca override the flags of the same name
+                               for the address. May be repeated to serve the same
+                               locks on multiple addresses, such as an internal
+                               and an external one, each authenticated by its own
+                               credentials, which are shut down together.
+  --socket=                    Path of a Unix domain socket to listen on instead
+                               of the TCP address, restricting access by the
+                               permissions of the file system. Mutually exclusive
+                               with --address. The socket file is removed upon
+                               shutdown, and graceful restarts are unsupported.
+  --grpc-address=              Listening address of the gRPC API server. Disabled
+                               if empty.
+  --path-normalization=strict  Lock path normalization mode. Either strict, which
+                               only strips leading slashes, or lenient, which also
+                               squashes repeated slashes and collapses . segments.
+  --path-pattern=              Regular expression that lock paths must match in
+                               their entirety, such as [\w.@-]+(/[\w.@-]+)*.
+                               Paths with empty, . or .. segments are rejected
+                               regardless. Defaults to word characters and dashes.
+  --max-path-length=1024       Maximum length of lock paths. Unlimited if 0.
+  --max-path-segments=32       Maximum number of segments of lock paths. Unlimited
+                               if 0.
+  --min-lease-timeout=0        Minimum lease timeout. Disabled if 0.
+  --max-lease-timeout=0        Maximum lease timeout, which infinite lease timeouts
+                               exceed. Disabled if 0.
+  --max-lock-timeout=0         Maximum lock timeout. Disabled if 0.
+  --max-hold-time=0            Maximum time a single holder may hold a lock, no
+                               matter how often its lease is extended. Leases
+                               are capped at it, and extensions past it rejected
+                               with hold_time_exceeded. Disabled if 0.
+  --default-lock-timeout=0     Lock timeout of acquisitions omitting it. A lock
+                               timeout given by the acquisition takes precedence.
+                               Acquisitions omitting it are rejected if 0.
+  --default-lease-timeout=0    Lease timeout of acquisitions omitting it, or
+                               infinite if negative. A lease timeout given by the
+                               acquisition takes precedence. Acquisitions
+                               omitting it are rejected if 0.
+  --timeout-policy=clamp       Treatment of timeouts out of range. Either clamp,
+                               which clamps them to the nearest limit, or reject,
+                               which rejects the request.
+  --maintenance-jitter=0       Maximum random delay of the expiry of leases and
+                               acquisitions, spreading out the promotions of many
+                               leases sharing a timeout. Disabled if 0.
+  --shards=1                   Number of shards the lock paths are distributed
+                               across by consistent hashing, each locked and
+                               maintained independently, so acquisitions of
+                               different paths contend less on many cores.
+                               Mutually exclusive with --wal-path and --raft-dir.
+  --id-strategy=sequential     Ticket ID generation. Either sequential, which
+                               increments a randomly seeded ID, random64,
+                               which draws 63 random bits so IDs cannot be
+                               guessed, or uuid, which draws IDs like random64
+                               but identifies tickets by UUIDs over HTTP.
+  --fairness=fair              Handoff of locks whose leases lapsed. Either fair,
+                               which promotes waiting acquisitions first, or
+                               barging, which lets new acquisitions take the
+                               lock ahead of them until the next maintenance.
+  --audit-history-size=0       Number of recent events retained in the audit
+                               history of each lock path. Disabled if zero.
+  --audit-history-paths=10000  Maximum number of lock paths retaining audit
+                               history. The least recently active are evicted.
+  --hold-histogram=none        Records the durations locks are held for in the
+                               lockerd_hold_seconds histogram, served in the
+                               Prometheus format by GET /?metrics=true. Either
+                               none, aggregate, which records a single histogram,
+                               namespace, which labels histograms by namespace,
+                               or path, which labels them by path at the cost of
+                               a histogram per path ever locked.
+  --namespace=name:options     Configures the namespace of lock paths whose first
+                               segment is the name, or the default namespace if
+                               the name is empty, by comma-separated options of
+                               max-queue-depth=N, max-lease-timeout=duration,
+                               capacity=N, making locks semaphores held in shared
+                               mode by at most N tickets, and auth-token=token, a
+                               bearer token only accepted for the namespace. May
+                               be repeated.
+  --wal-path=                  Path of a write-ahead log to persist locks to, so
+                               they survive restarts. Disabled if empty.
+  --wal-compaction-interval=1m Interval at which the write-ahead log is compacted.
+  --raft-dir=                  Directory of the Raft log of the node, enabling
+                               clustering. The holders of locks are replicated
+                               to the nodes of the cluster, and every request is
+                               served by the leader, to which the other nodes
+                               forward requests. Mutually exclusive with
+                               --wal-path and --grpc-address. Disabled if empty.
+  --raft-bind=                 Address on which the node communicates with the
+                               other nodes of the cluster, such as
+                               10.0.0.1:12100, which must be reachable by them.
+  --raft-id=                   ID of the node, unique within the cluster and
+                               stable across restarts. Defaults to the Raft
+                               address.
+  --raft-advertise-url=        URL at which the other nodes reach the HTTP API of
+                               the node. Defaults to the host of the Raft address
+                               and the port of the listening address.
+  --join=                      URL of the HTTP API of a node of the cluster to
+                               join, authenticated by --auth-token if set. A
+                               cluster of the node alone is bootstrapped if empty.
+  --auth-token=                Static bearer token required to access the HTTP
+                               API. Disabled if empty.
+  --auth-htpasswd=             Path of an htpasswd file of bcrypt credentials
+                               accepted for basic authentication to the HTTP API.
+                               Disabled if empty.
+  --auth-exempt=               Comma-separated request paths exempt from
+                               authentication, such as /metrics or /health.
+  --enable-admin               Enables the admin endpoints of the HTTP API, which
+                               snapshot the locks by GET /?snapshot=true, restore
+                               a snapshot by POST /?restore=true, and force the
+                               release of a lock by DELETE /path?force=true.
+                               Requires --auth-token or --auth-htpasswd.
+  --numeric-json               Formats IDs and fencing tokens as JSON numbers in
+                               HTTP responses, and durations as milliseconds.
+  --no-content                 Responds to successful releases and extensions
+                               with 204 No Content rather than a JSON body.
+  --max-long-poll=0            Maximum duration an acquisition request is held
+                               open. Once elapsed, the request is responded to
+                               with 408 and the poll_expired code, and the ticket
+                               stays queued to be re-polled by PUT with its ID.
+                               Disabled if 0.
+  --request-timeout=0          Maximum time to read a request, including its
+                               body, and to process and respond to it, such as
+                               against slow clients. Acquisitions may wait for
+                               up to their lock timeout, or the maximum long
+                               poll, in addition, and watches, keepalives and
+                               WebSockets are exempt once established.
+                               Disabled if 0.
+  --compress                   Compresses JSON responses by gzip for clients
+                               accepting it.
+  --compress-min-size=1024     Minimum size in bytes of compressed responses.
+  --rate-limit=0               Sustained rate of requests per second allowed per
+                               client, which is the authenticated identity if
+                               authentication is enabled, and otherwise the IP
+                               address. Responses carry the X-RateLimit-Remaining
+                               and X-RateLimit-Reset headers, and clients learn of
+                               their quota by GET /?quota=true. Disabled if 0.
+  --rate-burst=0               Maximum burst of requests per client. Defaults to
+                               the rate limit.
+  --rate-limit-per-path        Limits the rate of requests per client and path,
+                               so a hot path cannot starve other paths.
+  --webhook-workers=0          Number of workers delivering webhooks to the
+                               notify_url of acquisitions, once their lock is
+                               released or their lease expires. Disabled if 0.
+  --webhook-retries=3          Number of retries of failed webhook deliveries,
+                               after which the webhook is dropped.
+  --webhook-timeout=5s         Timeout of a single webhook delivery attempt.
+  --tls-cert=                  Path of a PEM encoded certificate to serve HTTPS
+                               with. Requires --tls-key.
+  --tls-key=                   Path of the PEM encoded private key of the
+                               certificate.
+  --tls-client-ca=             Path of PEM encoded CA certificates to require
+                               client certificates to chain to. Disabled if empty.
+  --drain-timeout=30s          Maximum time to wait for waiting acquisitions to
+                               settle upon termination, during which new
+                               acquisitions are refused. Locks still held when the
+                               server stops are only retained if journaled to a
+                               write-ahead log.
+  --shutdown-grace=0           Grace period between announcing the shutdown upon
+                               termination and draining, during which locks are
+                               served as usual, so holders can finish and release
+                               their locks. Holders streaming their locks kept
+                               alive or watching them are sent the shutdown event,
+                               whereas other holders fall back to lease expiry.
+                               Graceful restarts are unsupported if set. Disabled
+                               if 0.
+  --log-level=info             Minimum level of logs. Either debug, info, warn or
+                               error.
+  --log-format=text            Format of logs. Either text or json.
+  --otel-endpoint=             URL of an OpenTelemetry collector to export traces
+                               of HTTP requests and lock handoffs to over
+                               OTLP/HTTP, such as http://localhost:4318. Disabled
+                               if empty.`
 }
@@ -0,0 +1,4 @@
+// Package lockerdpb contains the generated protocol buffer and gRPC code for the lockerd gRPC API.
+package lockerdpb
+
+//go:generate buf generate --template buf.gen.yaml
@@ -0,0 +1,1036 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: lockerd.proto
+
+package lockerdpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type AcquireResponse_Status int32
+
+const (
+	AcquireResponse_STATUS_UNSPECIFIED AcquireResponse_Status = 0
+	AcquireResponse_STATUS_ENQUEUED    AcquireResponse_Status = 1
+	AcquireResponse_STATUS_ACQUIRED    AcquireResponse_Status = 2
+	AcquireResponse_STATUS_TIMED_OUT   AcquireResponse_Status = 3
+)
+
+// Enum value maps for AcquireResponse_Status.
+var (
+	AcquireResponse_Status_name = map[int32]string{
+		0: "STATUS_UNSPECIFIED",
+		1: "STATUS_ENQUEUED",
+		2: "STATUS_ACQUIRED",
+		3: "STATUS_TIMED_OUT",
+	}
+	AcquireResponse_Status_value = map[string]int32{
+		"STATUS_UNSPECIFIED": 0,
+		"STATUS_ENQUEUED":    1,
+		"STATUS_ACQUIRED":    2,
+		"STATUS_TIMED_OUT":   3,
+	}
+)
+
+func (x AcquireResponse_Status) Enum() *AcquireResponse_Status {
+	p := new(AcquireResponse_Status)
+	*p = x
+	return p
+}
+
+func (x AcquireResponse_Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (AcquireResponse_Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_lockerd_proto_enumTypes[0].Descriptor()
+}
+
+func (AcquireResponse_Status) Type() protoreflect.EnumType {
+	return &file_lockerd_proto_enumTypes[0]
+}
+
+func (x AcquireResponse_Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use AcquireResponse_Status.Descriptor instead.
+func (AcquireResponse_Status) EnumDescriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{1, 0}
+}
+
+type AcquireRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Path         string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	LockTimeout  string                 `protobuf:"bytes,2,opt,name=lock_timeout,json=lockTimeout,proto3" json:"lock_timeout,omitempty"`
+	LeaseTimeout string                 `protobuf:"bytes,3,opt,name=lease_timeout,json=leaseTimeout,proto3" json:"lease_timeout,omitempty"`
+	// Either exclusive or shared. Defaults to exclusive.
+	Mode string `protobuf:"bytes,4,opt,name=mode,proto3" json:"mode,omitempty"`
+	// Owner identity for re-entrant acquisition.
+	Owner string `protobuf:"bytes,5,opt,name=owner,proto3" json:"owner,omitempty"`
+	// Whether to only acquire the lock if it can be held immediately, never queueing.
+	Try bool `protobuf:"varint,6,opt,name=try,proto3" json:"try,omitempty"`
+	// Arbitrary metadata describing the acquirer, such as its host or job.
+	Labels        map[string]string `protobuf:"bytes,7,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AcquireRequest) Reset() {
+	*x = AcquireRequest{}
+	mi := &file_lockerd_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AcquireRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AcquireRequest) ProtoMessage() {}
+
+func (x *AcquireRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lockerd_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AcquireRequest.ProtoReflect.Descriptor instead.
+func (*AcquireRequest) Descriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AcquireRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *AcquireRequest) GetLockTimeout() string {
+	if x != nil {
+		return x.LockTimeout
+	}
+	return ""
+}
+
+func (x *AcquireRequest) GetLeaseTimeout() string {
+	if x != nil {
+		return x.LeaseTimeout
+	}
+	return ""
+}
+
+func (x *AcquireRequest) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *AcquireRequest) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *AcquireRequest) GetTry() bool {
+	if x != nil {
+		return x.Try
+	}
+	return false
+}
+
+func (x *AcquireRequest) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+type AcquireResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Status AcquireResponse_Status `protobuf:"varint,1,opt,name=status,proto3,enum=lockerd.v1.AcquireResponse_Status" json:"status,omitempty"`
+	Id     int64                  `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	// Fencing token. Only set once acquired.
+	Fence         int64 `protobuf:"varint,3,opt,name=fence,proto3" json:"fence,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AcquireResponse) Reset() {
+	*x = AcquireResponse{}
+	mi := &file_lockerd_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AcquireResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AcquireResponse) ProtoMessage() {}
+
+func (x *AcquireResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lockerd_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AcquireResponse.ProtoReflect.Descriptor instead.
+func (*AcquireResponse) Descriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AcquireResponse) GetStatus() AcquireResponse_Status {
+	if x != nil {
+		return x.Status
+	}
+	return AcquireResponse_STATUS_UNSPECIFIED
+}
+
+func (x *AcquireResponse) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *AcquireResponse) GetFence() int64 {
+	if x != nil {
+		return x.Fence
+	}
+	return 0
+}
+
+type ReleaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Id            int64                  `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReleaseRequest) Reset() {
+	*x = ReleaseRequest{}
+	mi := &file_lockerd_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReleaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseRequest) ProtoMessage() {}
+
+func (x *ReleaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lockerd_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseRequest.ProtoReflect.Descriptor instead.
+func (*ReleaseRequest) Descriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ReleaseRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ReleaseRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type ReleaseResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReleaseResponse) Reset() {
+	*x = ReleaseResponse{}
+	mi := &file_lockerd_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReleaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReleaseResponse) ProtoMessage() {}
+
+func (x *ReleaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lockerd_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReleaseResponse.ProtoReflect.Descriptor instead.
+func (*ReleaseResponse) Descriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{3}
+}
+
+type ExtendRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Path         string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Id           int64                  `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	LeaseTimeout string                 `protobuf:"bytes,3,opt,name=lease_timeout,json=leaseTimeout,proto3" json:"lease_timeout,omitempty"`
+	// Whether to shorten rather than extend the lease.
+	Shorten bool `protobuf:"varint,4,opt,name=shorten,proto3" json:"shorten,omitempty"`
+	// Only extend the lease if it remains for longer than the duration.
+	IfLeaseTimeoutGt string `protobuf:"bytes,5,opt,name=if_lease_timeout_gt,json=ifLeaseTimeoutGt,proto3" json:"if_lease_timeout_gt,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *ExtendRequest) Reset() {
+	*x = ExtendRequest{}
+	mi := &file_lockerd_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExtendRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExtendRequest) ProtoMessage() {}
+
+func (x *ExtendRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lockerd_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExtendRequest.ProtoReflect.Descriptor instead.
+func (*ExtendRequest) Descriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ExtendRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ExtendRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ExtendRequest) GetLeaseTimeout() string {
+	if x != nil {
+		return x.LeaseTimeout
+	}
+	return ""
+}
+
+func (x *ExtendRequest) GetShorten() bool {
+	if x != nil {
+		return x.Shorten
+	}
+	return false
+}
+
+func (x *ExtendRequest) GetIfLeaseTimeoutGt() string {
+	if x != nil {
+		return x.IfLeaseTimeoutGt
+	}
+	return ""
+}
+
+type ExtendResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Changed       bool                   `protobuf:"varint,1,opt,name=changed,proto3" json:"changed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExtendResponse) Reset() {
+	*x = ExtendResponse{}
+	mi := &file_lockerd_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExtendResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExtendResponse) ProtoMessage() {}
+
+func (x *ExtendResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lockerd_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExtendResponse.ProtoReflect.Descriptor instead.
+func (*ExtendResponse) Descriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ExtendResponse) GetChanged() bool {
+	if x != nil {
+		return x.Changed
+	}
+	return false
+}
+
+type InspectRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InspectRequest) Reset() {
+	*x = InspectRequest{}
+	mi := &file_lockerd_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InspectRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InspectRequest) ProtoMessage() {}
+
+func (x *InspectRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lockerd_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InspectRequest.ProtoReflect.Descriptor instead.
+func (*InspectRequest) Descriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *InspectRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+type InspectAllRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only inspect locks whose paths start with the prefix.
+	Prefix string `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	// Only inspect locks whose paths sort after the cursor, ie. the next cursor of the previous page.
+	Cursor string `protobuf:"bytes,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	// Maximum number of locks to inspect. All locks are inspected if not positive.
+	Limit int32 `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	// Only inspect locks with waiting acquirers. Applied after the limit, so pages may hold fewer locks.
+	HeldOnly      bool `protobuf:"varint,4,opt,name=held_only,json=heldOnly,proto3" json:"held_only,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InspectAllRequest) Reset() {
+	*x = InspectAllRequest{}
+	mi := &file_lockerd_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InspectAllRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InspectAllRequest) ProtoMessage() {}
+
+func (x *InspectAllRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_lockerd_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InspectAllRequest.ProtoReflect.Descriptor instead.
+func (*InspectAllRequest) Descriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *InspectAllRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *InspectAllRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *InspectAllRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *InspectAllRequest) GetHeldOnly() bool {
+	if x != nil {
+		return x.HeldOnly
+	}
+	return false
+}
+
+type InspectAllResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Locks map[string]*LockState  `protobuf:"bytes,1,rep,name=locks,proto3" json:"locks,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Cursor of the next page, if more locks remain beyond the limit.
+	NextCursor    string `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InspectAllResponse) Reset() {
+	*x = InspectAllResponse{}
+	mi := &file_lockerd_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InspectAllResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InspectAllResponse) ProtoMessage() {}
+
+func (x *InspectAllResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_lockerd_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InspectAllResponse.ProtoReflect.Descriptor instead.
+func (*InspectAllResponse) Descriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *InspectAllResponse) GetLocks() map[string]*LockState {
+	if x != nil {
+		return x.Locks
+	}
+	return nil
+}
+
+func (x *InspectAllResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+type LockHolder struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Fence         int64                  `protobuf:"varint,2,opt,name=fence,proto3" json:"fence,omitempty"`
+	Owner         string                 `protobuf:"bytes,3,opt,name=owner,proto3" json:"owner,omitempty"`
+	Depth         int32                  `protobuf:"varint,4,opt,name=depth,proto3" json:"depth,omitempty"`
+	Timeout       string                 `protobuf:"bytes,5,opt,name=timeout,proto3" json:"timeout,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,6,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LockHolder) Reset() {
+	*x = LockHolder{}
+	mi := &file_lockerd_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LockHolder) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LockHolder) ProtoMessage() {}
+
+func (x *LockHolder) ProtoReflect() protoreflect.Message {
+	mi := &file_lockerd_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LockHolder.ProtoReflect.Descriptor instead.
+func (*LockHolder) Descriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *LockHolder) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *LockHolder) GetFence() int64 {
+	if x != nil {
+		return x.Fence
+	}
+	return 0
+}
+
+func (x *LockHolder) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *LockHolder) GetDepth() int32 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *LockHolder) GetTimeout() string {
+	if x != nil {
+		return x.Timeout
+	}
+	return ""
+}
+
+func (x *LockHolder) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+type LockAcquirer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Mode          string                 `protobuf:"bytes,2,opt,name=mode,proto3" json:"mode,omitempty"`
+	Timeout       string                 `protobuf:"bytes,3,opt,name=timeout,proto3" json:"timeout,omitempty"`
+	Owner         string                 `protobuf:"bytes,4,opt,name=owner,proto3" json:"owner,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,5,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LockAcquirer) Reset() {
+	*x = LockAcquirer{}
+	mi := &file_lockerd_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LockAcquirer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LockAcquirer) ProtoMessage() {}
+
+func (x *LockAcquirer) ProtoReflect() protoreflect.Message {
+	mi := &file_lockerd_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LockAcquirer.ProtoReflect.Descriptor instead.
+func (*LockAcquirer) Descriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *LockAcquirer) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *LockAcquirer) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *LockAcquirer) GetTimeout() string {
+	if x != nil {
+		return x.Timeout
+	}
+	return ""
+}
+
+func (x *LockAcquirer) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *LockAcquirer) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+type LockState struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	LockingId     int64                  `protobuf:"varint,1,opt,name=locking_id,json=lockingId,proto3" json:"locking_id,omitempty"`
+	LockTimeout   string                 `protobuf:"bytes,2,opt,name=lock_timeout,json=lockTimeout,proto3" json:"lock_timeout,omitempty"`
+	Mode          string                 `protobuf:"bytes,3,opt,name=mode,proto3" json:"mode,omitempty"`
+	Fence         int64                  `protobuf:"varint,4,opt,name=fence,proto3" json:"fence,omitempty"`
+	Depth         int32                  `protobuf:"varint,5,opt,name=depth,proto3" json:"depth,omitempty"`
+	Holders       []*LockHolder          `protobuf:"bytes,6,rep,name=holders,proto3" json:"holders,omitempty"`
+	Acquirers     []*LockAcquirer        `protobuf:"bytes,7,rep,name=acquirers,proto3" json:"acquirers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LockState) Reset() {
+	*x = LockState{}
+	mi := &file_lockerd_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LockState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LockState) ProtoMessage() {}
+
+func (x *LockState) ProtoReflect() protoreflect.Message {
+	mi := &file_lockerd_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LockState.ProtoReflect.Descriptor instead.
+func (*LockState) Descriptor() ([]byte, []int) {
+	return file_lockerd_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *LockState) GetLockingId() int64 {
+	if x != nil {
+		return x.LockingId
+	}
+	return 0
+}
+
+func (x *LockState) GetLockTimeout() string {
+	if x != nil {
+		return x.LockTimeout
+	}
+	return ""
+}
+
+func (x *LockState) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *LockState) GetFence() int64 {
+	if x != nil {
+		return x.Fence
+	}
+	return 0
+}
+
+func (x *LockState) GetDepth() int32 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *LockState) GetHolders() []*LockHolder {
+	if x != nil {
+		return x.Holders
+	}
+	return nil
+}
+
+func (x *LockState) GetAcquirers() []*LockAcquirer {
+	if x != nil {
+		return x.Acquirers
+	}
+	return nil
+}
+
+var File_lockerd_proto protoreflect.FileDescriptor
+
+const file_lockerd_proto_rawDesc = "" +
+	"\n" +
+	"\rlockerd.proto\x12\n" +
+	"lockerd.v1\"\xa3\x02\n" +
+	"\x0eAcquireRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12!\n" +
+	"\flock_timeout\x18\x02 \x01(\tR\vlockTimeout\x12#\n" +
+	"\rlease_timeout\x18\x03 \x01(\tR\fleaseTimeout\x12\x12\n" +
+	"\x04mode\x18\x04 \x01(\tR\x04mode\x12\x14\n" +
+	"\x05owner\x18\x05 \x01(\tR\x05owner\x12\x10\n" +
+	"\x03try\x18\x06 \x01(\bR\x03try\x12>\n" +
+	"\x06labels\x18\a \x03(\v2&.lockerd.v1.AcquireRequest.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xd5\x01\n" +
+	"\x0fAcquireResponse\x12:\n" +
+	"\x06status\x18\x01 \x01(\x0e2\".lockerd.v1.AcquireResponse.StatusR\x06status\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x03R\x02id\x12\x14\n" +
+	"\x05fence\x18\x03 \x01(\x03R\x05fence\"`\n" +
+	"\x06Status\x12\x16\n" +
+	"\x12STATUS_UNSPECIFIED\x10\x00\x12\x13\n" +
+	"\x0fSTATUS_ENQUEUED\x10\x01\x12\x13\n" +
+	"\x0fSTATUS_ACQUIRED\x10\x02\x12\x14\n" +
+	"\x10STATUS_TIMED_OUT\x10\x03\"4\n" +
+	"\x0eReleaseRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x03R\x02id\"\x11\n" +
+	"\x0fReleaseResponse\"\xa1\x01\n" +
+	"\rExtendRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x03R\x02id\x12#\n" +
+	"\rlease_timeout\x18\x03 \x01(\tR\fleaseTimeout\x12\x18\n" +
+	"\ashorten\x18\x04 \x01(\bR\ashorten\x12-\n" +
+	"\x13if_lease_timeout_gt\x18\x05 \x01(\tR\x10ifLeaseTimeoutGt\"*\n" +
+	"\x0eExtendResponse\x12\x18\n" +
+	"\achanged\x18\x01 \x01(\bR\achanged\"$\n" +
+	"\x0eInspectRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\"v\n" +
+	"\x11InspectAllRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\x12\x16\n" +
+	"\x06cursor\x18\x02 \x01(\tR\x06cursor\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\x12\x1b\n" +
+	"\theld_only\x18\x04 \x01(\bR\bheldOnly\"\xc7\x01\n" +
+	"\x12InspectAllResponse\x12?\n" +
+	"\x05locks\x18\x01 \x03(\v2).lockerd.v1.InspectAllResponse.LocksEntryR\x05locks\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor\x1aO\n" +
+	"\n" +
+	"LocksEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12+\n" +
+	"\x05value\x18\x02 \x01(\v2\x15.lockerd.v1.LockStateR\x05value:\x028\x01\"\xef\x01\n" +
+	"\n" +
+	"LockHolder\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x14\n" +
+	"\x05fence\x18\x02 \x01(\x03R\x05fence\x12\x14\n" +
+	"\x05owner\x18\x03 \x01(\tR\x05owner\x12\x14\n" +
+	"\x05depth\x18\x04 \x01(\x05R\x05depth\x12\x18\n" +
+	"\atimeout\x18\x05 \x01(\tR\atimeout\x12:\n" +
+	"\x06labels\x18\x06 \x03(\v2\".lockerd.v1.LockHolder.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xdb\x01\n" +
+	"\fLockAcquirer\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04mode\x18\x02 \x01(\tR\x04mode\x12\x18\n" +
+	"\atimeout\x18\x03 \x01(\tR\atimeout\x12\x14\n" +
+	"\x05owner\x18\x04 \x01(\tR\x05owner\x12<\n" +
+	"\x06labels\x18\x05 \x03(\v2$.lockerd.v1.LockAcquirer.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xf7\x01\n" +
+	"\tLockState\x12\x1d\n" +
+	"\n" +
+	"locking_id\x18\x01 \x01(\x03R\tlockingId\x12!\n" +
+	"\flock_timeout\x18\x02 \x01(\tR\vlockTimeout\x12\x12\n" +
+	"\x04mode\x18\x03 \x01(\tR\x04mode\x12\x14\n" +
+	"\x05fence\x18\x04 \x01(\x03R\x05fence\x12\x14\n" +
+	"\x05depth\x18\x05 \x01(\x05R\x05depth\x120\n" +
+	"\aholders\x18\x06 \x03(\v2\x16.lockerd.v1.LockHolderR\aholders\x126\n" +
+	"\tacquirers\x18\a \x03(\v2\x18.lockerd.v1.LockAcquirerR\tacquirers2\xde\x02\n" +
+	"\x06Locker\x12D\n" +
+	"\aAcquire\x12\x1a.lockerd.v1.AcquireRequest\x1a\x1b.lockerd.v1.AcquireResponse0\x01\x12B\n" +
+	"\aRelease\x12\x1a.lockerd.v1.ReleaseRequest\x1a\x1b.lockerd.v1.ReleaseResponse\x12?\n" +
+	"\x06Extend\x12\x19.lockerd.v1.ExtendRequest\x1a\x1a.lockerd.v1.ExtendResponse\x12<\n" +
+	"\aInspect\x12\x1a.lockerd.v1.InspectRequest\x1a\x15.lockerd.v1.LockState\x12K\n" +
+	"\n" +
+	"InspectAll\x12\x1d.lockerd.v1.InspectAllRequest\x1a\x1e.lockerd.v1.InspectAllResponseB\x1eZ\x1clockerd/grpcserver/lockerdpbb\x06proto3"
+
+var (
+	file_lockerd_proto_rawDescOnce sync.Once
+	file_lockerd_proto_rawDescData []byte
+)
+
+func file_lockerd_proto_rawDescGZIP() []byte {
+	file_lockerd_proto_rawDescOnce.Do(func() {
+		file_lockerd_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_lockerd_proto_rawDesc), len(file_lockerd_proto_rawDesc)))
+	})
+	return file_lockerd_proto_rawDescData
+}
+
+var file_lockerd_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_lockerd_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_lockerd_proto_goTypes = []any{
+	(AcquireResponse_Status)(0), // 0: lockerd.v1.AcquireResponse.Status
+	(*AcquireRequest)(nil),      // 1: lockerd.v1.AcquireRequest
+	(*AcquireResponse)(nil),     // 2: lockerd.v1.AcquireResponse
+	(*ReleaseRequest)(nil),      // 3: lockerd.v1.ReleaseRequest
+	(*ReleaseResponse)(nil),     // 4: lockerd.v1.ReleaseResponse
+	(*ExtendRequest)(nil),       // 5: lockerd.v1.ExtendRequest
+	(*ExtendResponse)(nil),      // 6: lockerd.v1.ExtendResponse
+	(*InspectRequest)(nil),      // 7: lockerd.v1.InspectRequest
+	(*InspectAllRequest)(nil),   // 8: lockerd.v1.InspectAllRequest
+	(*InspectAllResponse)(nil),  // 9: lockerd.v1.InspectAllResponse
+	(*LockHolder)(nil),          // 10: lockerd.v1.LockHolder
+	(*LockAcquirer)(nil),        // 11: lockerd.v1.LockAcquirer
+	(*LockState)(nil),           // 12: lockerd.v1.LockState
+	nil,                         // 13: lockerd.v1.AcquireRequest.LabelsEntry
+	nil,                         // 14: lockerd.v1.InspectAllResponse.LocksEntry
+	nil,                         // 15: lockerd.v1.LockHolder.LabelsEntry
+	nil,                         // 16: lockerd.v1.LockAcquirer.LabelsEntry
+}
+var file_lockerd_proto_depIdxs = []int32{
+	13, // 0: lockerd.v1.AcquireRequest.labels:type_name -> lockerd.v1.AcquireRequest.LabelsEntry
+	0,  // 1: lockerd.v1.AcquireResponse.status:type_name -> lockerd.v1.AcquireResponse.Status
+	14, // 2: lockerd.v1.InspectAllResponse.locks:type_name -> lockerd.v1.InspectAllResponse.LocksEntry
+	15, // 3: lockerd.v1.LockHolder.labels:type_name -> lockerd.v1.LockHolder.LabelsEntry
+	16, // 4: lockerd.v1.LockAcquirer.labels:type_name -> lockerd.v1.LockAcquirer.LabelsEntry
+	10, // 5: lockerd.v1.LockState.holders:type_name -> lockerd.v1.LockHolder
+	11, // 6: lockerd.v1.LockState.acquirers:type_name -> lockerd.v1.LockAcquirer
+	12, // 7: lockerd.v1.InspectAllResponse.LocksEntry.value:type_name -> lockerd.v1.LockState
+	1,  // 8: lockerd.v1.Locker.Acquire:input_type -> lockerd.v1.AcquireRequest
+	3,  // 9: lockerd.v1.Locker.Release:input_type -> lockerd.v1.ReleaseRequest
+	5,  // 10: lockerd.v1.Locker.Extend:input_type -> lockerd.v1.ExtendRequest
+	7,  // 11: lockerd.v1.Locker.Inspect:input_type -> lockerd.v1.InspectRequest
+	8,  // 12: lockerd.v1.Locker.InspectAll:input_type -> lockerd.v1.InspectAllRequest
+	2,  // 13: lockerd.v1.Locker.Acquire:output_type -> lockerd.v1.AcquireResponse
+	4,  // 14: lockerd.v1.Locker.Release:output_type -> lockerd.v1.ReleaseResponse
+	6,  // 15: lockerd.v1.Locker.Extend:output_type -> lockerd.v1.ExtendResponse
+	12, // 16: lockerd.v1.Locker.Inspect:output_type -> lockerd.v1.LockState
+	9,  // 17: lockerd.v1.Locker.InspectAll:output_type -> lockerd.v1.InspectAllResponse
+	13, // [13:18] is the sub-list for method output_type
+	8,  // [8:13] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_lockerd_proto_init() }
+func file_lockerd_proto_init() {
+	if File_lockerd_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_lockerd_proto_rawDesc), len(file_lockerd_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   16,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_lockerd_proto_goTypes,
+		DependencyIndexes: file_lockerd_proto_depIdxs,
+		EnumInfos:         file_lockerd_proto_enumTypes,
+		MessageInfos:      file_lockerd_proto_msgTypes,
+	}.Build()
+	File_lockerd_proto = out.File
+	file_lockerd_proto_goTypes = nil
+	file_lockerd_proto_depIdxs = nil
+}
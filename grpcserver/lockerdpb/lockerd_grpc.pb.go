@@ -0,0 +1,307 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: lockerd.proto
+
+package lockerdpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Locker_Acquire_FullMethodName    = "/lockerd.v1.Locker/Acquire"
+	Locker_Release_FullMethodName    = "/lockerd.v1.Locker/Release"
+	Locker_Extend_FullMethodName     = "/lockerd.v1.Locker/Extend"
+	Locker_Inspect_FullMethodName    = "/lockerd.v1.Locker/Inspect"
+	Locker_InspectAll_FullMethodName = "/lockerd.v1.Locker/InspectAll"
+)
+
+// LockerClient is the client API for Locker service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Locking API.
+//
+// Mirrors the HTTP API. Durations are expressed in the same format as the HTTP API, ie. one or more components of a
+// non-negative integer with one of the units ms, s, m, h or d, such as 1h30m, or 0. Lease timeouts may also be
+// infinite, for leases that never expire.
+type LockerClient interface {
+	// Acquire a lock.
+	//
+	// Streams the progress of the acquisition. If the lock cannot be acquired immediately, an enqueued response is sent
+	// first, followed by either an acquired or a timed out response. Canceling the call while waiting abandons the
+	// acquisition.
+	Acquire(ctx context.Context, in *AcquireRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AcquireResponse], error)
+	// Release a lock.
+	Release(ctx context.Context, in *ReleaseRequest, opts ...grpc.CallOption) (*ReleaseResponse, error)
+	// Extend or shorten a lease.
+	Extend(ctx context.Context, in *ExtendRequest, opts ...grpc.CallOption) (*ExtendResponse, error)
+	// Inspect a lock.
+	Inspect(ctx context.Context, in *InspectRequest, opts ...grpc.CallOption) (*LockState, error)
+	// Inspect all locks.
+	InspectAll(ctx context.Context, in *InspectAllRequest, opts ...grpc.CallOption) (*InspectAllResponse, error)
+}
+
+type lockerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLockerClient(cc grpc.ClientConnInterface) LockerClient {
+	return &lockerClient{cc}
+}
+
+func (c *lockerClient) Acquire(ctx context.Context, in *AcquireRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[AcquireResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Locker_ServiceDesc.Streams[0], Locker_Acquire_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AcquireRequest, AcquireResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Locker_AcquireClient = grpc.ServerStreamingClient[AcquireResponse]
+
+func (c *lockerClient) Release(ctx context.Context, in *ReleaseRequest, opts ...grpc.CallOption) (*ReleaseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReleaseResponse)
+	err := c.cc.Invoke(ctx, Locker_Release_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lockerClient) Extend(ctx context.Context, in *ExtendRequest, opts ...grpc.CallOption) (*ExtendResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExtendResponse)
+	err := c.cc.Invoke(ctx, Locker_Extend_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lockerClient) Inspect(ctx context.Context, in *InspectRequest, opts ...grpc.CallOption) (*LockState, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LockState)
+	err := c.cc.Invoke(ctx, Locker_Inspect_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lockerClient) InspectAll(ctx context.Context, in *InspectAllRequest, opts ...grpc.CallOption) (*InspectAllResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(InspectAllResponse)
+	err := c.cc.Invoke(ctx, Locker_InspectAll_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LockerServer is the server API for Locker service.
+// All implementations must embed UnimplementedLockerServer
+// for forward compatibility.
+//
+// Locking API.
+//
+// Mirrors the HTTP API. Durations are expressed in the same format as the HTTP API, ie. one or more components of a
+// non-negative integer with one of the units ms, s, m, h or d, such as 1h30m, or 0. Lease timeouts may also be
+// infinite, for leases that never expire.
+type LockerServer interface {
+	// Acquire a lock.
+	//
+	// Streams the progress of the acquisition. If the lock cannot be acquired immediately, an enqueued response is sent
+	// first, followed by either an acquired or a timed out response. Canceling the call while waiting abandons the
+	// acquisition.
+	Acquire(*AcquireRequest, grpc.ServerStreamingServer[AcquireResponse]) error
+	// Release a lock.
+	Release(context.Context, *ReleaseRequest) (*ReleaseResponse, error)
+	// Extend or shorten a lease.
+	Extend(context.Context, *ExtendRequest) (*ExtendResponse, error)
+	// Inspect a lock.
+	Inspect(context.Context, *InspectRequest) (*LockState, error)
+	// Inspect all locks.
+	InspectAll(context.Context, *InspectAllRequest) (*InspectAllResponse, error)
+	mustEmbedUnimplementedLockerServer()
+}
+
+// UnimplementedLockerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedLockerServer struct{}
+
+func (UnimplementedLockerServer) Acquire(*AcquireRequest, grpc.ServerStreamingServer[AcquireResponse]) error {
+	return status.Error(codes.Unimplemented, "method Acquire not implemented")
+}
+func (UnimplementedLockerServer) Release(context.Context, *ReleaseRequest) (*ReleaseResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Release not implemented")
+}
+func (UnimplementedLockerServer) Extend(context.Context, *ExtendRequest) (*ExtendResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Extend not implemented")
+}
+func (UnimplementedLockerServer) Inspect(context.Context, *InspectRequest) (*LockState, error) {
+	return nil, status.Error(codes.Unimplemented, "method Inspect not implemented")
+}
+func (UnimplementedLockerServer) InspectAll(context.Context, *InspectAllRequest) (*InspectAllResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method InspectAll not implemented")
+}
+func (UnimplementedLockerServer) mustEmbedUnimplementedLockerServer() {}
+func (UnimplementedLockerServer) testEmbeddedByValue()                {}
+
+// UnsafeLockerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LockerServer will
+// result in compilation errors.
+type UnsafeLockerServer interface {
+	mustEmbedUnimplementedLockerServer()
+}
+
+func RegisterLockerServer(s grpc.ServiceRegistrar, srv LockerServer) {
+	// If the following call panics, it indicates UnimplementedLockerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Locker_ServiceDesc, srv)
+}
+
+func _Locker_Acquire_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(AcquireRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LockerServer).Acquire(m, &grpc.GenericServerStream[AcquireRequest, AcquireResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Locker_AcquireServer = grpc.ServerStreamingServer[AcquireResponse]
+
+func _Locker_Release_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LockerServer).Release(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Locker_Release_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LockerServer).Release(ctx, req.(*ReleaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Locker_Extend_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExtendRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LockerServer).Extend(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Locker_Extend_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LockerServer).Extend(ctx, req.(*ExtendRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Locker_Inspect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InspectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LockerServer).Inspect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Locker_Inspect_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LockerServer).Inspect(ctx, req.(*InspectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Locker_InspectAll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InspectAllRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LockerServer).InspectAll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Locker_InspectAll_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LockerServer).InspectAll(ctx, req.(*InspectAllRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Locker_ServiceDesc is the grpc.ServiceDesc for Locker service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Locker_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "lockerd.v1.Locker",
+	HandlerType: (*LockerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Release",
+			Handler:    _Locker_Release_Handler,
+		},
+		{
+			MethodName: "Extend",
+			Handler:    _Locker_Extend_Handler,
+		},
+		{
+			MethodName: "Inspect",
+			Handler:    _Locker_Inspect_Handler,
+		},
+		{
+			MethodName: "InspectAll",
+			Handler:    _Locker_InspectAll_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Acquire",
+			Handler:       _Locker_Acquire_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "lockerd.proto",
+}
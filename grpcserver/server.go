@@ -0,0 +1,345 @@
+package grpcserver
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"lockerd/grpcserver/lockerdpb"
+	"lockerd/httpserver"
+	"lockerd/locking"
+)
+
+// gRPC service for the locking API.
+//
+// Mirrors the semantics of the HTTP API, including path validation and duration parsing.
+type service struct {
+	lockerdpb.UnimplementedLockerServer
+
+	manager locking.Manager
+}
+
+// New server.
+//
+// Returns a gRPC server with the locking API registered.
+func NewServer(manager locking.Manager, options ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(options...)
+	lockerdpb.RegisterLockerServer(server, &service{
+		manager: manager,
+	})
+
+	return server
+}
+
+func (s *service) Acquire(req *lockerdpb.AcquireRequest, stream lockerdpb.Locker_AcquireServer) error {
+	// Parse the path.
+	path, err := s.manager.ValidatePath(req.Path)
+	if err != nil {
+		return pathError(err)
+	}
+
+	// Parse the timeout values, falling back to the configured defaults if omitted. The lock timeout is not applicable
+	// when trying to acquire the lock without queueing.
+	lockTimeout, leaseTimeout := s.manager.DefaultTimeouts()
+
+	if req.LockTimeout == "" && lockTimeout == 0 && !req.Try {
+		return status.Error(codes.InvalidArgument, "Missing lock_timeout")
+	}
+	if req.LeaseTimeout == "" && leaseTimeout == 0 {
+		return status.Error(codes.InvalidArgument, "Missing lease_timeout")
+	}
+
+	if req.Try {
+		lockTimeout = 0
+	} else if req.LockTimeout != "" {
+		lockTimeout, err = httpserver.ParseDuration(req.LockTimeout)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "Invalid lock timeout")
+		}
+	}
+	if req.LeaseTimeout != "" {
+		leaseTimeout, err = httpserver.ParseLeaseTimeout(req.LeaseTimeout)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "Invalid lease timeout")
+		}
+	}
+
+	// Parse the acquisition options.
+	options := locking.AcquireOptions{
+		Owner:  req.Owner,
+		Labels: req.Labels,
+	}
+
+	switch req.Mode {
+	case "", "exclusive":
+		options.Mode = locking.ModeExclusive
+	case "shared":
+		options.Mode = locking.ModeShared
+	default:
+		return status.Error(codes.InvalidArgument, "Invalid mode")
+	}
+
+	// Try to acquire the lock without queueing if requested.
+	if req.Try {
+		ticket, acquired, err := s.manager.TryAcquire(path, leaseTimeout, options)
+		if err != nil {
+			return managerError(err)
+		}
+
+		if !acquired {
+			return status.Error(codes.FailedPrecondition, "Lock is held")
+		}
+
+		return stream.Send(acquiredResponse(ticket))
+	}
+
+	// Acquire the lock. The acquisition is abandoned by the manager if the call is canceled while waiting.
+	ctx := stream.Context()
+
+	ticket, err := s.manager.AcquireContext(ctx, path, lockTimeout, leaseTimeout, options)
+	if err != nil {
+		return managerError(err)
+	}
+
+	var acquired bool
+
+	select {
+	case acquired = <-ticket.Acquired():
+	default:
+		if err := stream.Send(&lockerdpb.AcquireResponse{
+			Status: lockerdpb.AcquireResponse_STATUS_ENQUEUED,
+			Id:     ticket.Id(),
+		}); err != nil {
+			if <-ticket.Acquired() {
+				s.manager.Release(path, ticket.Id())
+			}
+			return err
+		}
+
+		select {
+		case acquired = <-ticket.Acquired():
+		case <-ctx.Done():
+			// The acquisition is settled promptly subsequent to cancellation, but the lock may have been acquired in
+			// the meantime, in which case it must be released.
+			if <-ticket.Acquired() {
+				s.manager.Release(path, ticket.Id())
+			}
+			return ctx.Err()
+		}
+	}
+
+	if acquired {
+		return stream.Send(acquiredResponse(ticket))
+	}
+
+	return stream.Send(&lockerdpb.AcquireResponse{
+		Status: lockerdpb.AcquireResponse_STATUS_TIMED_OUT,
+		Id:     ticket.Id(),
+	})
+}
+
+func (s *service) Release(ctx context.Context, req *lockerdpb.ReleaseRequest) (*lockerdpb.ReleaseResponse, error) {
+	// Parse the path.
+	path, err := s.manager.ValidatePath(req.Path)
+	if err != nil {
+		return nil, pathError(err)
+	}
+
+	// Release the lock.
+	released, err := s.manager.Release(path, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !released {
+		return nil, errNotFound
+	}
+
+	return &lockerdpb.ReleaseResponse{}, nil
+}
+
+func (s *service) Extend(ctx context.Context, req *lockerdpb.ExtendRequest) (*lockerdpb.ExtendResponse, error) {
+	// Parse the path.
+	path, err := s.manager.ValidatePath(req.Path)
+	if err != nil {
+		return nil, pathError(err)
+	}
+
+	// Parse the timeout value.
+	if req.LeaseTimeout == "" {
+		return nil, status.Error(codes.InvalidArgument, "Missing lease_timeout")
+	}
+
+	leaseTimeout, err := httpserver.ParseLeaseTimeout(req.LeaseTimeout)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid lease timeout")
+	}
+
+	// Parse the condition on the remaining lease, if any.
+	var options locking.ExtendOptions
+
+	if req.IfLeaseTimeoutGt != "" {
+		if options.IfLeaseTimeoutGreaterThan, err = httpserver.ParseDuration(req.IfLeaseTimeoutGt); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Invalid if_lease_timeout_gt")
+		}
+	}
+
+	// Extend or shorten the lock.
+	var found, changed bool
+
+	if req.Shorten {
+		found, changed, err = s.manager.Shorten(path, req.Id, leaseTimeout)
+	} else {
+		found, changed, err = s.manager.Extend(path, req.Id, leaseTimeout, options)
+	}
+
+	if err != nil {
+		return nil, managerError(err)
+	}
+
+	if !found {
+		return nil, errNotFound
+	}
+
+	return &lockerdpb.ExtendResponse{
+		Changed: changed,
+	}, nil
+}
+
+func (s *service) Inspect(ctx context.Context, req *lockerdpb.InspectRequest) (*lockerdpb.LockState, error) {
+	// Parse the path.
+	path, err := s.manager.ValidatePath(req.Path)
+	if err != nil {
+		return nil, pathError(err)
+	}
+
+	// Inspect the lock.
+	state, err := s.manager.Inspect(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.LockingId == 0 {
+		return nil, errNotFound
+	}
+
+	return formatLockState(state), nil
+}
+
+func (s *service) InspectAll(ctx context.Context, req *lockerdpb.InspectAllRequest) (*lockerdpb.InspectAllResponse, error) {
+	states, nextCursor, err := s.manager.InspectRange(req.Prefix, req.Cursor, int(req.Limit))
+	if err != nil {
+		return nil, err
+	}
+
+	locks := make(map[string]*lockerdpb.LockState, len(states))
+
+	for path, state := range states {
+		if req.HeldOnly && len(state.Acquirers) == 0 {
+			continue
+		}
+
+		locks[path] = formatLockState(state)
+	}
+
+	return &lockerdpb.InspectAllResponse{
+		Locks:      locks,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// Not found error.
+var errNotFound = status.Error(codes.NotFound, "Not found")
+
+// Path too long error.
+var errPathTooLong = status.Error(codes.InvalidArgument, "Path too long")
+
+// Error of an invalid path.
+//
+// Paths exceeding the limits are invalid arguments, while otherwise invalid paths cannot name a lock, and are thus not
+// found.
+func pathError(err error) error {
+	if err == locking.ErrPathTooLong {
+		return errPathTooLong
+	}
+
+	return errNotFound
+}
+
+// Draining error.
+var errDraining = status.Error(codes.Unavailable, "Server is shutting down")
+
+// Queue full error.
+var errQueueFull = status.Error(codes.ResourceExhausted, "Lock queue is full")
+
+// Metadata too large error.
+var errMetadataTooLarge = status.Error(codes.InvalidArgument, "Owner or labels exceed the metadata limits")
+
+// Status errors of manager errors.
+var managerErrors = map[error]error{
+	locking.ErrDraining:               errDraining,
+	locking.ErrQueueFull:              errQueueFull,
+	locking.ErrMetadataTooLarge:       errMetadataTooLarge,
+	locking.ErrLeaseTimeoutOutOfRange: status.Error(codes.InvalidArgument, "Lease timeout out of range"),
+	locking.ErrLockTimeoutOutOfRange:  status.Error(codes.InvalidArgument, "Lock timeout out of range"),
+	locking.ErrPreconditionFailed:     status.Error(codes.FailedPrecondition, "Remaining lease does not exceed if_lease_timeout_gt"),
+	locking.ErrHoldTimeExceeded:       status.Error(codes.FailedPrecondition, "Lease cannot be extended past the maximum total hold time"),
+}
+
+// Status error of a manager error.
+//
+// Well-known manager errors are mapped to their status errors, while other errors are returned as is.
+func managerError(err error) error {
+	if statusErr, ok := managerErrors[err]; ok {
+		return statusErr
+	}
+
+	return err
+}
+
+// Acquired response for a ticket.
+func acquiredResponse(ticket locking.Ticket) *lockerdpb.AcquireResponse {
+	return &lockerdpb.AcquireResponse{
+		Status: lockerdpb.AcquireResponse_STATUS_ACQUIRED,
+		Id:     ticket.Id(),
+		Fence:  ticket.Fence(),
+	}
+}
+
+// Format a lock state for a response.
+func formatLockState(state locking.LockState) *lockerdpb.LockState {
+	holders := make([]*lockerdpb.LockHolder, len(state.Holders))
+	for idx, holder := range state.Holders {
+		holders[idx] = &lockerdpb.LockHolder{
+			Id:      holder.Id,
+			Fence:   holder.Fence,
+			Owner:   holder.Owner,
+			Labels:  holder.Labels,
+			Depth:   int32(holder.Depth),
+			Timeout: httpserver.FormatDuration(holder.Timeout),
+		}
+	}
+
+	acquirers := make([]*lockerdpb.LockAcquirer, len(state.Acquirers))
+	for idx, acquirer := range state.Acquirers {
+		acquirers[idx] = &lockerdpb.LockAcquirer{
+			Id:      acquirer.Id,
+			Mode:    acquirer.Mode.String(),
+			Timeout: httpserver.FormatDuration(acquirer.Timeout),
+			Owner:   acquirer.Owner,
+			Labels:  acquirer.Labels,
+		}
+	}
+
+	return &lockerdpb.LockState{
+		LockingId:   state.LockingId,
+		LockTimeout: httpserver.FormatDuration(state.LockTimeout),
+		Mode:        state.Mode.String(),
+		Fence:       state.Fence,
+		Depth:       int32(state.Depth),
+		Holders:     holders,
+		Acquirers:   acquirers,
+	}
+}
@@ -0,0 +1,240 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"lockerd/grpcserver/lockerdpb"
+	"lockerd/locking"
+)
+
+type ServerFixture struct {
+	Manager locking.Manager
+	Client  lockerdpb.LockerClient
+	server  *grpc.Server
+	conn    *grpc.ClientConn
+}
+
+func NewServerFixture(t *testing.T) *ServerFixture {
+	manager, _ := locking.NewManager(locking.Config{})
+	manager.Start()
+
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(manager)
+	go server.Serve(listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+
+	return &ServerFixture{
+		Manager: manager,
+		Client:  lockerdpb.NewLockerClient(conn),
+		server:  server,
+		conn:    conn,
+	}
+}
+
+func (f *ServerFixture) Close() {
+	f.conn.Close()
+	f.server.Stop()
+	f.Manager.Stop()
+}
+
+func TestServerAcquireInvalid(t *testing.T) {
+	f := NewServerFixture(t)
+	defer f.Close()
+
+	fixtures := []struct {
+		Request      *lockerdpb.AcquireRequest
+		ExpectedCode codes.Code
+	}{
+		{&lockerdpb.AcquireRequest{Path: "test", LeaseTimeout: "1m"}, codes.InvalidArgument},
+		{&lockerdpb.AcquireRequest{Path: "test", LockTimeout: "1m"}, codes.InvalidArgument},
+		{&lockerdpb.AcquireRequest{Path: "test", LockTimeout: "1x", LeaseTimeout: "1m"}, codes.InvalidArgument},
+		{&lockerdpb.AcquireRequest{Path: "test", LockTimeout: "1m", LeaseTimeout: "1m", Mode: "read"}, codes.InvalidArgument},
+		{&lockerdpb.AcquireRequest{Path: "test/", LockTimeout: "1m", LeaseTimeout: "1m"}, codes.NotFound},
+	}
+
+	for _, fixture := range fixtures {
+		stream, err := f.Client.Acquire(context.Background(), fixture.Request)
+		if err == nil {
+			_, err = stream.Recv()
+		}
+
+		if status.Code(err) != fixture.ExpectedCode {
+			t.Errorf("Expected code %v for %v, got %v", fixture.ExpectedCode, fixture.Request, err)
+		}
+	}
+}
+
+func TestServerAcquireStream(t *testing.T) {
+	f := NewServerFixture(t)
+	defer f.Close()
+
+	// Test acquiring immediately.
+	stream, _ := f.Client.Acquire(context.Background(), &lockerdpb.AcquireRequest{
+		Path:         "test",
+		LockTimeout:  "1m",
+		LeaseTimeout: "1m",
+	})
+
+	resp, err := stream.Recv()
+	if err != nil || resp.Status != lockerdpb.AcquireResponse_STATUS_ACQUIRED || resp.Fence == 0 {
+		t.Fatalf("Expected lock to be acquired, got %v, %v", resp, err)
+	}
+
+	idA := resp.Id
+
+	// Test that a waiting acquisition is streamed as enqueued, and then acquired upon release.
+	stream, _ = f.Client.Acquire(context.Background(), &lockerdpb.AcquireRequest{
+		Path:         "test",
+		LockTimeout:  "1m",
+		LeaseTimeout: "1m",
+	})
+
+	resp, err = stream.Recv()
+	if err != nil || resp.Status != lockerdpb.AcquireResponse_STATUS_ENQUEUED {
+		t.Fatalf("Expected acquisition to be enqueued, got %v, %v", resp, err)
+	}
+
+	idB := resp.Id
+
+	if _, err := f.Client.Release(context.Background(), &lockerdpb.ReleaseRequest{Path: "test", Id: idA}); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+
+	resp, err = stream.Recv()
+	if err != nil || resp.Status != lockerdpb.AcquireResponse_STATUS_ACQUIRED || resp.Id != idB {
+		t.Fatalf("Expected lock to be acquired by %d, got %v, %v", idB, resp, err)
+	}
+
+	// Test that a waiting acquisition times out.
+	stream, _ = f.Client.Acquire(context.Background(), &lockerdpb.AcquireRequest{
+		Path:         "test",
+		LockTimeout:  "50ms",
+		LeaseTimeout: "1m",
+	})
+
+	stream.Recv()
+	resp, err = stream.Recv()
+	if err != nil || resp.Status != lockerdpb.AcquireResponse_STATUS_TIMED_OUT {
+		t.Fatalf("Expected acquisition to time out, got %v, %v", resp, err)
+	}
+
+	// Test trying to acquire a held lock.
+	stream, _ = f.Client.Acquire(context.Background(), &lockerdpb.AcquireRequest{
+		Path:         "test",
+		LeaseTimeout: "1m",
+		Try:          true,
+	})
+
+	if _, err := stream.Recv(); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Expected lock to be held, got %v", err)
+	}
+}
+
+func TestServerAcquireCanceled(t *testing.T) {
+	f := NewServerFixture(t)
+	defer f.Close()
+
+	ticketA, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	// Test that canceling a waiting acquisition frees its queue slot.
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stream, _ := f.Client.Acquire(ctx, &lockerdpb.AcquireRequest{
+		Path:         "test",
+		LockTimeout:  "1m",
+		LeaseTimeout: "1m",
+	})
+	stream.Recv()
+	cancel()
+
+	time.Sleep(50 * time.Millisecond)
+
+	state, _ := f.Manager.Inspect("test")
+	if state.LockingId != ticketA.Id() || len(state.Acquirers) != 0 {
+		t.Fatalf("Expected lock to be held by %d without acquirers", ticketA.Id())
+	}
+}
+
+func TestServerExtendAndInspect(t *testing.T) {
+	f := NewServerFixture(t)
+	defer f.Close()
+
+	ticketA, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+	ticketB, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	// Test extending and shortening.
+	resp, err := f.Client.Extend(context.Background(), &lockerdpb.ExtendRequest{
+		Path:         "test",
+		Id:           ticketA.Id(),
+		LeaseTimeout: "1s",
+	})
+	if err != nil || resp.Changed {
+		t.Fatalf("Expected lease to be unchanged, got %v, %v", resp, err)
+	}
+
+	resp, err = f.Client.Extend(context.Background(), &lockerdpb.ExtendRequest{
+		Path:         "test",
+		Id:           ticketA.Id(),
+		LeaseTimeout: "1s",
+		Shorten:      true,
+	})
+	if err != nil || !resp.Changed {
+		t.Fatalf("Expected lease to be shortened, got %v, %v", resp, err)
+	}
+
+	_, err = f.Client.Extend(context.Background(), &lockerdpb.ExtendRequest{
+		Path:         "test",
+		Id:           ticketB.Id(),
+		LeaseTimeout: "1s",
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected acquirer not to be found, got %v", err)
+	}
+
+	// Test inspecting.
+	state, err := f.Client.Inspect(context.Background(), &lockerdpb.InspectRequest{Path: "test"})
+	if err != nil {
+		t.Fatalf("Failed to inspect lock: %v", err)
+	}
+
+	if state.LockingId != ticketA.Id() || state.LockTimeout == "" || state.LockTimeout == "0" {
+		t.Fatalf("Expected lock to be held by %d, got %v", ticketA.Id(), state)
+	}
+	if len(state.Acquirers) != 1 || state.Acquirers[0].Id != ticketB.Id() {
+		t.Fatalf("Expected acquirer %d, got %v", ticketB.Id(), state.Acquirers)
+	}
+
+	if _, err := f.Client.Inspect(context.Background(), &lockerdpb.InspectRequest{Path: "other"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected lock not to be found, got %v", err)
+	}
+
+	all, err := f.Client.InspectAll(context.Background(), &lockerdpb.InspectAllRequest{})
+	if err != nil || len(all.Locks) != 1 || all.Locks["test"].LockingId != ticketA.Id() {
+		t.Fatalf("Expected single lock held by %d, got %v, %v", ticketA.Id(), all, err)
+	}
+
+	f.Manager.Acquire("test/a", time.Minute, time.Minute)
+	f.Manager.Acquire("test/b", time.Minute, time.Minute)
+
+	all, err = f.Client.InspectAll(context.Background(), &lockerdpb.InspectAllRequest{Prefix: "test/", Limit: 1})
+	if err != nil || len(all.Locks) != 1 || all.Locks["test/a"] == nil || all.NextCursor != "test/a" {
+		t.Fatalf("Expected first lock of range, got %v, %v", all, err)
+	}
+}
@@ -0,0 +1,90 @@
+package httpserver
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"lockerd/locking"
+)
+
+// Maximum size of a snapshot to restore in bytes.
+const maxSnapshotSize = 64 << 20
+
+func (h *handler) serveSnapshot(resp http.ResponseWriter, req *http.Request) error {
+	if !h.admin {
+		return respondNotFound(resp)
+	}
+
+	data, err := h.manager.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	resp.Header().Set("Content-Type", jsonContentType)
+	resp.Header().Set("Content-Disposition", `attachment; filename="lockerd-snapshot.json"`)
+
+	resp.WriteHeader(200)
+	resp.Write(data)
+	return nil
+}
+
+func (h *handler) serveRestore(resp http.ResponseWriter, req *http.Request) error {
+	if !h.admin {
+		return respondNotFound(resp)
+	}
+
+	// Read the snapshot.
+	data, err := io.ReadAll(http.MaxBytesReader(resp, req.Body, maxSnapshotSize))
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return respondError(resp, "snapshot_too_large", "Snapshot too large", 413)
+	} else if err != nil {
+		return respondError(resp, "invalid_body", "Invalid body", 400)
+	}
+
+	// Restore the snapshot.
+	err = h.manager.Restore(data)
+	if err == locking.ErrSnapshotInvalid {
+		return respondError(resp, "invalid_snapshot", "Invalid snapshot", 400)
+	} else if err == locking.ErrSnapshotConflict {
+		return respondError(resp, "snapshot_conflict", "Snapshot conflicts with existing locks", 409)
+	} else if err != nil {
+		return err
+	}
+
+	return respondJson(resp, map[string]interface{}{}, 200)
+}
+
+func (h *handler) serveForceRelease(resp http.ResponseWriter, req *http.Request) error {
+	if !h.admin {
+		return respondNotFound(resp)
+	}
+
+	// Refuse tokens scoped to a namespace, as forcing the release of locks requires global credentials.
+	if identity, _ := authenticatedIdentity(req); strings.HasPrefix(identity, "namespace:") {
+		return respondError(resp, "forbidden", "Forcing the release of locks requires global credentials", 403)
+	}
+
+	// Parse the path.
+	path, err := h.manager.ValidatePath(req.URL.Path)
+	if err != nil {
+		return respondPathError(resp, err)
+	}
+
+	// Release the lock.
+	releasedIds, err := h.manager.ForceRelease(path, req.FormValue("clear_queue") == "true")
+	if err != nil {
+		return err
+	}
+
+	if len(releasedIds) == 0 {
+		return respondNotFound(resp)
+	}
+
+	return respondJson(resp, map[string]interface{}{
+		"released": h.format.ticketIds(releasedIds),
+	}, 200)
+}
@@ -0,0 +1,164 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"lockerd/locking"
+)
+
+func TestHandlerSnapshot(t *testing.T) {
+	f := NewHandlerFixtureWithOptions(t, locking.Config{}, HandlerOptions{EnableAdmin: true})
+	defer f.Close()
+
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	})
+	acquired := AssertSuccessResponse(t, resp)
+
+	// Test taking a snapshot.
+	resp = f.Request("GET", "/", url.Values{"snapshot": []string{"true"}})
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status code 200, got %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+
+	// Test restoring the snapshot to another server.
+	g := NewHandlerFixtureWithOptions(t, locking.Config{}, HandlerOptions{EnableAdmin: true})
+	defer g.Close()
+
+	resp, err = g.server.Client().Post(g.server.URL+"/?restore=true", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+	AssertSuccessResponse(t, resp)
+
+	resp = g.Request("GET", "/test", nil)
+	if body := AssertSuccessResponse(t, resp); body.LockingId != acquired.Id {
+		t.Fatalf("Expected lock to be held by %s, got %s", acquired.Id, body.LockingId)
+	}
+
+	// Test that conflicting and invalid snapshots are rejected.
+	resp, err = g.server.Client().Post(g.server.URL+"/?restore=true", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+	AssertErrorResponse(t, resp, "snapshot_conflict", 409)
+
+	resp, err = g.server.Client().Post(g.server.URL+"/?restore=true", "application/json", bytes.NewReader([]byte("{}")))
+	if err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+	AssertErrorResponse(t, resp, "invalid_snapshot", 400)
+}
+
+func TestHandlerSnapshotDisabled(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	resp := f.Request("GET", "/", url.Values{"snapshot": []string{"true"}})
+	AssertErrorResponse(t, resp, "not_found", 404)
+
+	resp, err := f.server.Client().Post(f.server.URL+"/?restore=true", "application/json", bytes.NewReader([]byte("{}")))
+	if err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+	AssertErrorResponse(t, resp, "not_found", 404)
+}
+
+func TestHandlerForceRelease(t *testing.T) {
+	f := NewHandlerFixtureWithOptions(t, locking.Config{}, HandlerOptions{EnableAdmin: true})
+	defer f.Close()
+
+	ticketA, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+	ticketB, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+	ticketC, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	// Test that the holder is released and its successor promoted.
+	resp := f.Request("DELETE", "/test", url.Values{"force": []string{"true"}})
+	AssertForceReleased(t, resp, ticketA.Id())
+
+	if lockers, _ := f.Manager.IsLocked("test"); len(lockers) != 1 || lockers[0] != ticketB.Id() {
+		t.Fatalf("Expected lock to be held by %d, got %v", ticketB.Id(), lockers)
+	}
+
+	// Test that the queue is cleared if requested.
+	resp = f.Request("DELETE", "/test", url.Values{"force": []string{"true"}, "clear_queue": []string{"true"}})
+	AssertForceReleased(t, resp, ticketB.Id(), ticketC.Id())
+
+	if acquired := <-ticketC.Acquired(); acquired {
+		t.Fatalf("Expected cleared ticket to fail acquisition")
+	}
+
+	// Test that unlocked paths are not found.
+	AssertErrorResponse(t, f.Request("DELETE", "/test", url.Values{"force": []string{"true"}}), "not_found", 404)
+}
+
+func TestHandlerForceReleaseDisabled(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	AssertErrorResponse(t, f.Request("DELETE", "/test", url.Values{"force": []string{"true"}}), "not_found", 404)
+}
+
+func TestHandlerForceReleaseNamespaceToken(t *testing.T) {
+	manager, _ := locking.NewManager(locking.Config{})
+	handler := NewAuthHandler(NewHandler(manager, HandlerOptions{EnableAdmin: true}), AuthConfig{
+		Token:           "token",
+		NamespaceTokens: map[string]string{"team-a": "token-a"},
+	})
+
+	manager.Acquire("team-a/test", time.Minute, time.Minute)
+
+	// Test that a token scoped to the namespace of the lock may not force its release, unlike the global token.
+	for _, fixture := range []struct {
+		Token              string
+		ExpectedStatusCode int
+	}{
+		{"token-a", 403},
+		{"token", 200},
+	} {
+		req := httptest.NewRequest("DELETE", "/team-a/test?force=true", nil)
+		req.Header.Set("Authorization", "Bearer "+fixture.Token)
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != fixture.ExpectedStatusCode {
+			t.Fatalf("Expected status code %d for %s, got %d", fixture.ExpectedStatusCode, fixture.Token, resp.Code)
+		}
+	}
+}
+
+func AssertForceReleased(t *testing.T, resp *http.Response, expected ...int64) {
+	t.Helper()
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status code 200, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Released []string `json:"released"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+
+	if fmt.Sprint(body.Released) != fmt.Sprint(expected) {
+		t.Fatalf("Expected %v to be released, got %v", expected, body.Released)
+	}
+}
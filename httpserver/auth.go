@@ -0,0 +1,186 @@
+package httpserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"lockerd/locking"
+)
+
+// Authentication configuration.
+type AuthConfig struct {
+	// Static bearer token accepted for authentication. Disabled if empty.
+	Token string
+
+	// Basic authentication credentials, mapping user names to bcrypt password hashes. Disabled if empty.
+	Credentials map[string][]byte
+
+	// Bearer tokens scoped to namespaces, by namespace.
+	//
+	// A scoped token only authenticates requests to the lock paths of its namespace, as determined by
+	// locking.PathNamespace, while the static token and the credentials authenticate all requests. Requests spanning
+	// namespaces, such as inspecting all locks, and requests to the default namespace, cannot be authenticated with a
+	// scoped token.
+	NamespaceTokens map[string]string
+
+	// Request paths exempt from authentication.
+	//
+	// Allows endpoints such as metrics and health checks mounted alongside the API to be exempted independently of
+	// each other.
+	ExemptPaths []string
+}
+
+// Password hash compared against for unknown users, so the response time does not reveal which users exist.
+var unknownUserHash, _ = bcrypt.GenerateFromPassword([]byte("unknown"), bcrypt.DefaultCost)
+
+// HTTP handler requiring authentication.
+type authHandler struct {
+	handler               http.Handler
+	tokenDigest           []byte
+	namespaceTokenDigests map[string][]byte
+	credentials           map[string][]byte
+	exemptPaths           map[string]bool
+}
+
+// New authentication handler.
+//
+// Wraps a handler, requiring requests to authenticate either with the configured bearer token or with basic
+// authentication credentials, or with the scoped token of the namespace of the lock path. Unauthenticated requests
+// are rejected with a 401 error. If neither a token nor any credentials are configured, all requests are rejected.
+func NewAuthHandler(handler http.Handler, config AuthConfig) http.Handler {
+	h := &authHandler{
+		handler:               handler,
+		namespaceTokenDigests: make(map[string][]byte, len(config.NamespaceTokens)),
+		credentials:           config.Credentials,
+		exemptPaths:           make(map[string]bool, len(config.ExemptPaths)),
+	}
+
+	if config.Token != "" {
+		digest := sha256.Sum256([]byte(config.Token))
+		h.tokenDigest = digest[:]
+	}
+
+	for namespace, token := range config.NamespaceTokens {
+		if namespace != "" && token != "" {
+			digest := sha256.Sum256([]byte(token))
+			h.namespaceTokenDigests[namespace] = digest[:]
+		}
+	}
+
+	for _, path := range config.ExemptPaths {
+		h.exemptPaths[path] = true
+	}
+
+	return h
+}
+
+func (h *authHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if h.exemptPaths[req.URL.Path] {
+		h.handler.ServeHTTP(resp, req)
+		return
+	}
+
+	if identity, ok := h.authenticate(req); ok {
+		h.handler.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), identityKey{}, identity)))
+		return
+	}
+
+	if h.tokenDigest != nil || len(h.namespaceTokenDigests) > 0 {
+		resp.Header().Add("WWW-Authenticate", `Bearer realm="lockerd"`)
+	}
+	if len(h.credentials) > 0 {
+		resp.Header().Add("WWW-Authenticate", `Basic realm="lockerd"`)
+	}
+
+	respondError(resp, "unauthorized", "Unauthorized", 401)
+}
+
+// Authenticate a request.
+//
+// Returns the identity the request authenticated as, which is the token, the scoped token of a namespace, or a user.
+func (h *authHandler) authenticate(req *http.Request) (string, bool) {
+	authorization := req.Header.Get("Authorization")
+
+	// Compare bearer tokens by their digests in constant time, so neither the contents nor the length of the token are
+	// revealed by the response time. Scoped tokens are only compared for requests to the lock paths of their namespace.
+	if token, ok := strings.CutPrefix(authorization, "Bearer "); ok {
+		digest := sha256.Sum256([]byte(token))
+
+		if h.tokenDigest != nil && subtle.ConstantTimeCompare(digest[:], h.tokenDigest) == 1 {
+			return "token", true
+		}
+
+		namespace := locking.PathNamespace(strings.TrimLeft(req.URL.Path, "/"))
+		namespaceDigest := h.namespaceTokenDigests[namespace]
+		return "namespace:" + namespace, namespaceDigest != nil && subtle.ConstantTimeCompare(digest[:], namespaceDigest) == 1
+	}
+
+	if user, password, ok := req.BasicAuth(); ok && len(h.credentials) > 0 {
+		hash, found := h.credentials[user]
+		if !found {
+			hash = unknownUserHash
+		}
+
+		return "user:" + user, bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil && found
+	}
+
+	return "", false
+}
+
+// Context key of the authenticated identity.
+type identityKey struct{}
+
+// Authenticated identity of a request.
+//
+// Returns false if the request was not authenticated, either as authentication is disabled or the path is exempt.
+func authenticatedIdentity(req *http.Request) (string, bool) {
+	identity, ok := req.Context().Value(identityKey{}).(string)
+	return identity, ok
+}
+
+// Load htpasswd credentials.
+//
+// Reads a file of user name and bcrypt password hash pairs separated by colons, one per line, as generated by
+// htpasswd -B. Blank lines and lines starting with # are ignored.
+func LoadHtpasswd(path string) (map[string][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	credentials := make(map[string][]byte)
+	scanner := bufio.NewScanner(file)
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("%s:%d: invalid credentials", path, lineNo)
+		}
+
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("%s:%d: unsupported password hash for %s, only bcrypt is supported", path, lineNo, user)
+		}
+
+		credentials[user] = []byte(hash)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
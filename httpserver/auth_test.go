@@ -0,0 +1,135 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthHandler(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+	handler := NewAuthHandler(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(200)
+	}), AuthConfig{
+		Token:       "token",
+		Credentials: map[string][]byte{"user": hash},
+		ExemptPaths: []string{"/health"},
+	})
+
+	fixtures := []struct {
+		Path               string
+		Authorization      string
+		User, Password     string
+		ExpectedStatusCode int
+	}{
+		{"/test", "", "", "", 401},
+		{"/test", "Bearer token", "", "", 200},
+		{"/test", "Bearer toke", "", "", 401},
+		{"/test", "Bearer tokens", "", "", 401},
+		{"/test", "token", "", "", 401},
+		{"/test", "", "user", "secret", 200},
+		{"/test", "", "user", "wrong", 401},
+		{"/test", "", "other", "secret", 401},
+		{"/health", "", "", "", 200},
+		{"/health/test", "", "", "", 401},
+	}
+
+	for _, fixture := range fixtures {
+		req := httptest.NewRequest("GET", fixture.Path, nil)
+		if fixture.Authorization != "" {
+			req.Header.Set("Authorization", fixture.Authorization)
+		}
+		if fixture.User != "" {
+			req.SetBasicAuth(fixture.User, fixture.Password)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != fixture.ExpectedStatusCode {
+			t.Errorf("Expected status code %d for %+v, got %d", fixture.ExpectedStatusCode, fixture, resp.Code)
+			continue
+		}
+
+		if resp.Code == 401 {
+			var body map[string]string
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body["code"] != "unauthorized" {
+				t.Errorf("Expected unauthorized error for %+v, got %v, %v", fixture, body, err)
+			}
+
+			if len(resp.Header().Values("WWW-Authenticate")) != 2 {
+				t.Errorf("Expected authentication challenges for %+v, got %v", fixture, resp.Header())
+			}
+		}
+	}
+}
+
+func TestAuthHandlerNamespaceTokens(t *testing.T) {
+	handler := NewAuthHandler(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(200)
+	}), AuthConfig{
+		Token:           "token",
+		NamespaceTokens: map[string]string{"team-a": "token-a", "team-b": "token-b", "": "token-default"},
+	})
+
+	fixtures := []struct {
+		Path               string
+		Authorization      string
+		ExpectedStatusCode int
+	}{
+		{"/team-a/test", "Bearer token-a", 200},
+		{"/team-a/test/nested", "Bearer token-a", 200},
+		{"/team-a/*", "Bearer token-a", 200},
+		{"/team-a/test", "Bearer token", 200},
+		{"/team-a/test", "Bearer token-b", 401},
+		{"/team-b/test", "Bearer token-a", 401},
+		{"/team-a", "Bearer token-a", 401},
+		{"/", "Bearer token-a", 401},
+		{"/test", "Bearer token-default", 401},
+		{"/*", "Bearer token-default", 401},
+	}
+
+	for _, fixture := range fixtures {
+		req := httptest.NewRequest("GET", fixture.Path, nil)
+		req.Header.Set("Authorization", fixture.Authorization)
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != fixture.ExpectedStatusCode {
+			t.Errorf("Expected status code %d for %+v, got %d", fixture.ExpectedStatusCode, fixture, resp.Code)
+		}
+	}
+}
+
+func TestLoadHtpasswd(t *testing.T) {
+	dir := t.TempDir()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+	// Test loading valid credentials.
+	path := filepath.Join(dir, "htpasswd")
+	os.WriteFile(path, []byte("# Users\nuser:"+string(hash)+"\n\n"), 0600)
+
+	credentials, err := LoadHtpasswd(path)
+	if err != nil || len(credentials) != 1 || bcrypt.CompareHashAndPassword(credentials["user"], []byte("secret")) != nil {
+		t.Fatalf("Expected credentials for user, got %v, %v", credentials, err)
+	}
+
+	// Test that unsupported hashes are rejected.
+	os.WriteFile(path, []byte("user:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"), 0600)
+
+	if _, err := LoadHtpasswd(path); err == nil {
+		t.Fatalf("Expected unsupported hash to be rejected")
+	}
+
+	// Test that a missing file is an error.
+	if _, err := LoadHtpasswd(filepath.Join(dir, "missing")); err == nil {
+		t.Fatalf("Expected missing file to be an error")
+	}
+}
@@ -0,0 +1,188 @@
+package httpserver
+
+import (
+	"bufio"
+	"compress/gzip"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Default minimum size of compressed responses.
+const DefaultCompressionMinSize = 1024
+
+// Compression configuration.
+type CompressionConfig struct {
+	// Minimum response size.
+	//
+	// Responses with bodies smaller than this many bytes are not compressed, as compression would not pay off. Defaults
+	// to DefaultCompressionMinSize.
+	MinSize int
+}
+
+// HTTP handler compressing responses.
+type compressionHandler struct {
+	handler http.Handler
+	minSize int
+}
+
+// New compression handler.
+//
+// Wraps a handler, compressing JSON responses by gzip for clients accepting it by their Accept-Encoding header. The
+// response is buffered until it reaches the minimum size, and sent uncompressed if it never does. The Content-Length
+// header of compressed responses is removed, as it no longer applies. Other responses, such as event streams and
+// WebSocket sessions, are never compressed.
+func NewCompressionHandler(handler http.Handler, config CompressionConfig) http.Handler {
+	minSize := config.MinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressionMinSize
+	}
+
+	return &compressionHandler{
+		handler: handler,
+		minSize: minSize,
+	}
+}
+
+func (h *compressionHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Add("Vary", "Accept-Encoding")
+
+	if !acceptsGzip(req) {
+		h.handler.ServeHTTP(resp, req)
+		return
+	}
+
+	writer := &compressWriter{ResponseWriter: resp, minSize: h.minSize}
+	defer writer.close()
+
+	h.handler.ServeHTTP(writer, req)
+}
+
+// Test if a request accepts gzip encoded responses.
+func acceptsGzip(req *http.Request) bool {
+	for _, encoding := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(encoding, ";")
+		if name = strings.TrimSpace(name); name != "gzip" && name != "*" {
+			continue
+		}
+
+		// Encodings with a zero quality value are explicitly not accepted.
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if quality, err := strconv.ParseFloat(q, 64); err == nil && quality == 0 {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// Response writer compressing the response.
+//
+// Buffers the body of JSON responses until deciding whether to compress them, and passes other responses through.
+type compressWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	statusCode  int
+	wroteHeader bool
+	passthrough bool
+	buf         []byte
+	gzip        *gzip.Writer
+}
+
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.statusCode = statusCode
+	w.wroteHeader = true
+
+	// Only pass JSON responses with a body through the buffer.
+	if statusCode < 200 || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") || w.Header().Get("Content-Encoding") != "" {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.gzip != nil {
+		return w.gzip.Write(data)
+	}
+
+	w.buf = append(w.buf, data...)
+	if len(w.buf) < w.minSize {
+		return len(data), nil
+	}
+
+	// Start compressing once the body reaches the minimum size.
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.ResponseWriter.WriteHeader(w.statusCode)
+
+	w.gzip = gzip.NewWriter(w.ResponseWriter)
+	if _, err := w.gzip.Write(w.buf); err != nil {
+		return 0, err
+	}
+	w.buf = nil
+
+	return len(data), nil
+}
+
+// Send the buffered body uncompressed.
+func (w *compressWriter) sendBuffered() {
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+}
+
+// Complete the response.
+//
+// Sends the buffered body uncompressed if it never reached the minimum size, or completes the compressed body.
+func (w *compressWriter) close() {
+	if w.gzip != nil {
+		w.gzip.Close()
+	} else if w.wroteHeader && !w.passthrough {
+		w.sendBuffered()
+	}
+}
+
+func (w *compressWriter) Flush() {
+	if w.gzip != nil {
+		w.gzip.Flush()
+	} else if w.wroteHeader && !w.passthrough {
+		w.sendBuffered()
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	w.wroteHeader = true
+	w.passthrough = true
+	return hijacker.Hijack()
+}
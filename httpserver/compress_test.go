@@ -0,0 +1,84 @@
+package httpserver
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompressionHandler(t *testing.T) {
+	handler := NewCompressionHandler(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/stream" {
+			resp.Header().Set("Content-Type", "text/event-stream")
+			resp.WriteHeader(200)
+			io.WriteString(resp, strings.Repeat("data: x\n\n", 200))
+			return
+		}
+
+		size, _ := strconv.Atoi(strings.TrimPrefix(req.URL.Path, "/"))
+		respondJson(resp, strings.Repeat("x", size), 200)
+	}), CompressionConfig{MinSize: 100})
+
+	for _, fixture := range []struct {
+		Path               string
+		AcceptEncoding     string
+		ExpectedCompressed bool
+	}{
+		{"/1000", "gzip, deflate", true},
+		{"/1000", "br;q=1.0, gzip;q=0.5", true},
+		{"/1000", "gzip;q=0", false},
+		{"/1000", "", false},
+		{"/10", "gzip", false},
+		{"/stream", "gzip", false},
+	} {
+		req := httptest.NewRequest("GET", fixture.Path, nil)
+		if fixture.AcceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", fixture.AcceptEncoding)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != 200 {
+			t.Fatalf("Expected status code 200 for %+v, got %d", fixture, resp.Code)
+		}
+
+		compressed := resp.Header().Get("Content-Encoding") == "gzip"
+		if compressed != fixture.ExpectedCompressed {
+			t.Fatalf("Expected compression to be %v for %+v", fixture.ExpectedCompressed, fixture)
+		}
+
+		// Assert that compressed responses decompress to the body, and that the content length is only set if correct.
+		body := resp.Body.Bytes()
+		contentLength := resp.Header().Get("Content-Length")
+
+		if compressed {
+			if contentLength != "" {
+				t.Fatalf("Expected no content length of compressed response, got %s", contentLength)
+			}
+
+			reader, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				t.Fatalf("Failed to decompress response: %v", err)
+			}
+			if body, err = io.ReadAll(reader); err != nil {
+				t.Fatalf("Failed to decompress response: %v", err)
+			}
+		} else if contentLength != "" && contentLength != strconv.Itoa(len(body)) {
+			t.Fatalf("Expected content length %d, got %s", len(body), contentLength)
+		}
+
+		expected := strings.Repeat("data: x\n\n", 200)
+		if size, err := strconv.Atoi(strings.TrimPrefix(fixture.Path, "/")); err == nil {
+			expected = `"` + strings.Repeat("x", size) + `"`
+		}
+
+		if string(body) != expected {
+			t.Fatalf("Unexpected body for %+v: %s", fixture, body)
+		}
+	}
+}
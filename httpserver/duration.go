@@ -3,18 +3,45 @@ package httpserver
 import (
 	"errors"
 	"fmt"
+	"math"
 	"regexp"
 	"strconv"
 	"time"
+
+	"lockerd/locking"
 )
 
-// Invalid duration.
-var ErrInvalidDuration = errors.New("invalid duration")
+var (
+	// Invalid duration.
+	ErrInvalidDuration = errors.New("invalid duration")
+
+	// Invalid deadline.
+	ErrInvalidDeadline = errors.New("invalid deadline")
+
+	// Deadline has passed.
+	ErrDeadlinePassed = errors.New("deadline has passed")
+)
 
 // Valid duration expression.
-var durationExpr = regexp.MustCompile(`^(\d+)(ms|s|m|h)$`)
+//
+// A duration is a sequence of one or more components, each of an integer and a unit, such as 1h30m or 2d12h.
+var durationExpr = regexp.MustCompile(`^(?:\d+(?:ms|s|m|h|d))+$`)
+
+// Duration component expression.
+var durationComponentExpr = regexp.MustCompile(`(\d+)(ms|s|m|h|d)`)
+
+// Duration units.
+var durationUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+}
 
 // Parse a duration.
+//
+// Accepts the sum of one or more components of an integer and a unit, which is one of ms, s, m, h and d (24 hours).
 func ParseDuration(dur string) (time.Duration, error) {
 	// Handle the special case of a zero duration.
 	if dur == "0" {
@@ -22,37 +49,97 @@ func ParseDuration(dur string) (time.Duration, error) {
 	}
 
 	// Match the duration expression.
-	match := durationExpr.FindStringSubmatch(dur)
-	if match == nil {
+	if !durationExpr.MatchString(dur) {
 		return 0, ErrInvalidDuration
 	}
 
-	// Parse the duration into something useful.
-	numerator, _ := strconv.ParseInt(match[1], 10, 64)
-	result := time.Duration(numerator)
+	// Sum the components of the duration, rejecting durations that cannot be represented.
+	var result time.Duration
 
-	if match[2] == "ms" {
-		result = result * time.Millisecond
-	} else if match[2] == "s" {
-		result = result * time.Second
-	} else if match[2] == "m" {
-		result = result * time.Minute
-	} else if match[2] == "h" {
-		result = result * time.Hour
+	for _, match := range durationComponentExpr.FindAllStringSubmatch(dur, -1) {
+		unit := durationUnits[match[2]]
+
+		numerator, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || numerator > int64(math.MaxInt64/unit) {
+			return 0, ErrInvalidDuration
+		}
+
+		component := time.Duration(numerator) * unit
+		if result > math.MaxInt64-component {
+			return 0, ErrInvalidDuration
+		}
+
+		result += component
 	}
 
 	return result, nil
 }
 
+// Infinite lease timeout.
+const infiniteDuration = "infinite"
+
+// Parse a lease timeout.
+//
+// Parses a duration, or the infinite sentinel for leases that never expire.
+func ParseLeaseTimeout(dur string) (time.Duration, error) {
+	if dur == infiniteDuration {
+		return locking.InfiniteTimeout, nil
+	}
+
+	return ParseDuration(dur)
+}
+
+// Parse a deadline.
+//
+// Parses an RFC 3339 timestamp, and returns the duration from the given time until it. Deadlines at or before the
+// given time are rejected with ErrDeadlinePassed.
+//
+// The duration is relative to the clock of the server, so clocks of clients running ahead or behind shorten or lengthen
+// the duration by as much. Deadlines are thus only as precise as the clocks of clients and server are synchronized.
+func ParseDeadline(deadline string, now time.Time) (time.Duration, error) {
+	deadlineTime, err := time.Parse(time.RFC3339Nano, deadline)
+	if err != nil {
+		return 0, ErrInvalidDeadline
+	}
+
+	if !deadlineTime.After(now) {
+		return 0, ErrDeadlinePassed
+	}
+
+	return deadlineTime.Sub(now), nil
+}
+
 // Format a duration.
+//
+// The infinite lease timeout is formatted as the infinite sentinel, whereas other negative durations are formatted as
+// zero. Other durations are formatted in the canonical form accepted by ParseDuration, as the integer days, hours,
+// minutes, seconds and milliseconds of the duration, omitting those that are zero, such as 2d12h30m15s250ms. Durations
+// are rounded up to whole milliseconds, so a positive duration is never formatted as zero.
 func FormatDuration(dur time.Duration) string {
-	if dur < 0 {
+	if dur == locking.InfiniteTimeout {
+		return infiniteDuration
+	}
+
+	if dur <= 0 {
 		return "0"
 	}
 
-	if dur >= 5*time.Second {
-		return fmt.Sprintf("%.3fs", float64(dur)/float64(time.Second))
+	if remainder := dur % time.Millisecond; remainder > 0 {
+		if dur > math.MaxInt64-time.Millisecond {
+			dur -= remainder
+		} else {
+			dur += time.Millisecond - remainder
+		}
+	}
+
+	var result string
+
+	for _, unit := range []string{"d", "h", "m", "s", "ms"} {
+		if count := dur / durationUnits[unit]; count > 0 {
+			result += fmt.Sprintf("%d%s", count, unit)
+			dur -= count * durationUnits[unit]
+		}
 	}
 
-	return fmt.Sprintf("%.3fms", float64(dur)/float64(time.Millisecond))
+	return result
 }
@@ -0,0 +1,145 @@
+package httpserver
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"lockerd/locking"
+)
+
+func TestParseDeadline(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	fixtures := []struct {
+		Deadline string
+		Expected time.Duration
+		Err      error
+	}{
+		{"2024-01-01T14:00:00Z", 2 * time.Hour, nil},
+		{"2024-01-01T12:00:00.5Z", 500 * time.Millisecond, nil},
+		{"2024-01-01T13:00:00+02:00", 0, ErrDeadlinePassed},
+		{"2024-01-01T12:00:00Z", 0, ErrDeadlinePassed},
+		{"2023-12-31T23:59:59Z", 0, ErrDeadlinePassed},
+		{"2024-01-01 14:00:00", 0, ErrInvalidDeadline},
+		{"1h", 0, ErrInvalidDeadline},
+		{"", 0, ErrInvalidDeadline},
+	}
+
+	for _, fixture := range fixtures {
+		result, err := ParseDeadline(fixture.Deadline, now)
+
+		if err != fixture.Err || result != fixture.Expected {
+			t.Errorf("Expected %q to parse as %v, %v, got %v, %v", fixture.Deadline, fixture.Expected, fixture.Err, result, err)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	fixtures := []struct {
+		Duration string
+		Expected time.Duration
+		Valid    bool
+	}{
+		{"0", 0, true},
+		{"10ms", 10 * time.Millisecond, true},
+		{"5s", 5 * time.Second, true},
+		{"90m", 90 * time.Minute, true},
+		{"2h", 2 * time.Hour, true},
+		{"1d", 24 * time.Hour, true},
+		{"1h30m", 90 * time.Minute, true},
+		{"2d12h", 60 * time.Hour, true},
+		{"1m30s500ms", 90*time.Second + 500*time.Millisecond, true},
+		{"", 0, false},
+		{"00", 0, false},
+		{"123a", 0, false},
+		{"1d2", 0, false},
+		{"h1", 0, false},
+		{"1.5h", 0, false},
+		{"-1h", 0, false},
+		{"1h 30m", 0, false},
+		{"infinite", 0, false},
+		{"200000d", 0, false},
+		{"9223372036854775807ms", 0, false},
+		{"106751d23h47m16s854ms1ms", 0, false},
+	}
+
+	for _, fixture := range fixtures {
+		result, err := ParseDuration(fixture.Duration)
+
+		if fixture.Valid && (err != nil || result != fixture.Expected) {
+			t.Errorf("Expected %q to parse as %v, got %v, %v", fixture.Duration, fixture.Expected, result, err)
+		} else if !fixture.Valid && err != ErrInvalidDuration {
+			t.Errorf("Expected %q to be invalid, got %v", fixture.Duration, result)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	fixtures := []struct {
+		Duration time.Duration
+		Expected string
+	}{
+		{locking.InfiniteTimeout, "infinite"},
+		{-time.Second, "0"},
+		{0, "0"},
+		{time.Nanosecond, "1ms"},
+		{1500 * time.Microsecond, "2ms"},
+		{250 * time.Millisecond, "250ms"},
+		{1500 * time.Millisecond, "1s500ms"},
+		{10 * time.Second, "10s"},
+		{time.Minute, "1m"},
+		{90*time.Minute + 1500*time.Millisecond, "1h30m1s500ms"},
+		{60 * time.Hour, "2d12h"},
+		{24*time.Hour + 5*time.Second, "1d5s"},
+	}
+
+	for _, fixture := range fixtures {
+		if result := FormatDuration(fixture.Duration); result != fixture.Expected {
+			t.Errorf("Expected %v to format as %q, got %q", fixture.Duration, fixture.Expected, result)
+		}
+	}
+}
+
+func TestFormatDurationRoundTrip(t *testing.T) {
+	durations := []time.Duration{
+		0,
+		time.Millisecond,
+		999 * time.Millisecond,
+		time.Second,
+		1500 * time.Millisecond,
+		59*time.Second + 999*time.Millisecond,
+		time.Minute,
+		90*time.Minute + 1500*time.Millisecond,
+		23*time.Hour + 59*time.Minute + 59*time.Second,
+		60 * time.Hour,
+		400*24*time.Hour + 7*time.Millisecond,
+		math.MaxInt64 / time.Millisecond * time.Millisecond,
+	}
+
+	// Add random whole millisecond durations of various magnitudes.
+	random := rand.New(rand.NewPCG(1, 2))
+	for magnitude := time.Millisecond; magnitude <= 1000*24*time.Hour; magnitude *= 10 {
+		for range 100 {
+			durations = append(durations, time.Duration(random.Int64N(int64(magnitude/time.Millisecond)))*time.Millisecond)
+		}
+	}
+
+	for _, dur := range durations {
+		formatted := FormatDuration(dur)
+
+		if result, err := ParseDuration(formatted); err != nil || result != dur {
+			t.Errorf("Expected %v formatted as %q to parse back, got %v, %v", dur, formatted, result, err)
+		}
+	}
+
+	// Test that durations with sub-millisecond precision parse back rounded up to whole milliseconds.
+	for _, dur := range []time.Duration{time.Nanosecond, 1500 * time.Microsecond, time.Hour + time.Microsecond} {
+		expected := (dur + time.Millisecond - 1) / time.Millisecond * time.Millisecond
+
+		if result, err := ParseDuration(FormatDuration(dur)); err != nil || result != expected {
+			t.Errorf("Expected %v to parse back as %v, got %v, %v", dur, expected, result, err)
+		}
+	}
+}
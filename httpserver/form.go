@@ -0,0 +1,99 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// Invalid JSON form.
+var errInvalidJsonForm = errors.New("invalid JSON form")
+
+// Test if a request has a JSON body.
+func isJsonRequest(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+	return err == nil && mediaType == "application/json"
+}
+
+// Parse a JSON form.
+//
+// Decodes a request body of a JSON object into the form values of the request, so parameters are read alike no matter
+// the encoding of the request. Strings, numbers and booleans are accepted as values, with numbers retaining their exact
+// representation. Arrays of these are accepted as multiple values, and objects of these as multiple values of the form
+// key=value, as for labels. Query parameters are retained in the form values, with values of the body taking
+// precedence.
+func parseJsonForm(req *http.Request) error {
+	decoder := json.NewDecoder(req.Body)
+	decoder.UseNumber()
+
+	var body map[string]interface{}
+	if err := decoder.Decode(&body); err != nil || body == nil {
+		return errInvalidJsonForm
+	}
+
+	postForm := make(url.Values, len(body))
+
+	for key, value := range body {
+		switch value := value.(type) {
+		case []interface{}:
+			for _, element := range value {
+				formValue, ok := jsonFormValue(element)
+				if !ok {
+					return errInvalidJsonForm
+				}
+
+				postForm.Add(key, formValue)
+			}
+		case map[string]interface{}:
+			for elementKey, element := range value {
+				formValue, ok := jsonFormValue(element)
+				if !ok {
+					return errInvalidJsonForm
+				}
+
+				postForm.Add(key, elementKey+"="+formValue)
+			}
+		case nil:
+		default:
+			formValue, ok := jsonFormValue(value)
+			if !ok {
+				return errInvalidJsonForm
+			}
+
+			postForm.Set(key, formValue)
+		}
+	}
+
+	form := req.URL.Query()
+	for key, values := range postForm {
+		form[key] = values
+	}
+
+	req.PostForm = postForm
+	req.Form = form
+
+	return nil
+}
+
+// Form value of a JSON value.
+//
+// Returns false if the value is not a string, number or boolean.
+func jsonFormValue(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	case bool:
+		if value {
+			return "true", true
+		}
+
+		return "false", true
+	}
+
+	return "", false
+}
@@ -0,0 +1,133 @@
+package httpserver
+
+import (
+	"fmt"
+	"time"
+
+	"lockerd/locking"
+)
+
+// Response format.
+//
+// Shapes the IDs, fencing tokens and durations of responses. By default, IDs and fencing tokens are formatted as
+// strings, since they may exceed the integers that JSON clients can represent precisely, and durations as formatted
+// durations. In numeric mode, IDs and fencing tokens are formatted as numbers, and durations as integer milliseconds,
+// with the infinite lease timeout as -1. Ticket IDs are formatted as external IDs of the ID strategy of the manager, ie.
+// as UUID strings for the UUID strategy whatever the mode.
+type responseFormat struct {
+	numeric    bool
+	idStrategy locking.IDStrategy
+}
+
+// Format an ID or fencing token.
+func (f responseFormat) id(id int64) interface{} {
+	if f.numeric {
+		return id
+	}
+
+	return fmt.Sprintf("%d", id)
+}
+
+// Format a ticket ID.
+//
+// The zero ID, standing for no ticket, is formatted like any other ID.
+func (f responseFormat) ticketId(id int64) interface{} {
+	if f.idStrategy == locking.IDStrategyUUID && id != 0 {
+		return locking.ExternalId(id, f.idStrategy)
+	}
+
+	return f.id(id)
+}
+
+// Format a list of ticket IDs.
+func (f responseFormat) ticketIds(ids []int64) []interface{} {
+	result := make([]interface{}, len(ids))
+	for idx, id := range ids {
+		result[idx] = f.ticketId(id)
+	}
+
+	return result
+}
+
+// Format a duration.
+//
+// Durations are rounded up to whole milliseconds in numeric mode, like formatted durations, so a positive duration is
+// never formatted as zero.
+func (f responseFormat) duration(dur time.Duration) interface{} {
+	if !f.numeric {
+		return FormatDuration(dur)
+	}
+
+	if dur == locking.InfiniteTimeout {
+		return -1
+	}
+
+	if dur <= 0 {
+		return 0
+	}
+
+	return (dur-1)/time.Millisecond + 1
+}
+
+// Format a timestamp.
+//
+// Timestamps are formatted as RFC 3339 in UTC, or null if zero, such as the expiry of a lease that never expires.
+func formatTimestamp(timestamp time.Time) interface{} {
+	if timestamp.IsZero() {
+		return nil
+	}
+
+	return timestamp.UTC().Format(time.RFC3339Nano)
+}
+
+// Format a lock state.
+func (f responseFormat) lockState(state locking.LockState) map[string]interface{} {
+	holders := make([]interface{}, len(state.Holders))
+	for idx, holder := range state.Holders {
+		holders[idx] = map[string]interface{}{
+			"id":         f.ticketId(holder.Id),
+			"fence":      f.id(holder.Fence),
+			"owner":      holder.Owner,
+			"labels":     formatLabels(holder.Labels),
+			"depth":      holder.Depth,
+			"timeout":    f.duration(holder.Timeout),
+			"held_for":   f.duration(holder.HeldFor),
+			"held_since": formatTimestamp(holder.HeldSince),
+			"expires_at": formatTimestamp(holder.ExpiresAt),
+		}
+	}
+
+	acquirers := make([]interface{}, len(state.Acquirers))
+	for idx, acquirer := range state.Acquirers {
+		acquirers[idx] = map[string]interface{}{
+			"id":          f.ticketId(acquirer.Id),
+			"mode":        acquirer.Mode.String(),
+			"owner":       acquirer.Owner,
+			"labels":      formatLabels(acquirer.Labels),
+			"timeout":     f.duration(acquirer.Timeout),
+			"waiting_for": f.duration(acquirer.WaitingFor),
+		}
+	}
+
+	result := map[string]interface{}{
+		"locking_id":      f.ticketId(state.LockingId),
+		"lock_timeout":    f.duration(state.LockTimeout),
+		"mode":            state.Mode.String(),
+		"fence":           f.id(state.Fence),
+		"depth":           state.Depth,
+		"held_for":        f.duration(state.HeldFor),
+		"held_since":      formatTimestamp(state.HeldSince),
+		"expires_at":      formatTimestamp(state.ExpiresAt),
+		"holders":         holders,
+		"acquirers":       acquirers,
+		"acquirers_total": state.AcquirersTotal,
+	}
+
+	// Only report the capacity of semaphores.
+	if state.Capacity > 0 {
+		result["capacity"] = state.Capacity
+		result["permits"] = state.Permits
+	}
+
+	return result
+}
@@ -1,227 +1,1840 @@
 package httpserver
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
 	"lockerd/locking"
 )
 
 // HTTP handler for the locking API.
 type handler struct {
-	manager locking.Manager
+	manager     locking.Manager
+	logger      *slog.Logger
+	tracer      trace.Tracer
+	propagator  propagation.TextMapPropagator
+	admin       bool
+	notifier    *Notifier
+	format      responseFormat
+	noContent   bool
+	maxLongPoll time.Duration
+	timeout     time.Duration
+}
+
+// Handler options.
+type HandlerOptions struct {
+	// Logger.
+	//
+	// Requests are logged at debug level, and internal server errors at error level. Defaults to discarding logs.
+	Logger *slog.Logger
+
+	// Tracer provider.
+	//
+	// If set, a span is started for every request, continuing any trace propagated by the request headers. Disabled by
+	// default.
+	TracerProvider trace.TracerProvider
+
+	// Trace context propagator.
+	//
+	// Defaults to W3C trace context and baggage propagation.
+	Propagator propagation.TextMapPropagator
+
+	// Enable admin endpoints.
+	//
+	// Admin endpoints snapshot and restore the locks of the manager, and force the release of locks, and as such expose
+	// and alter the state of every lock. Disabled by default, and should only be enabled behind authentication.
+	EnableAdmin bool
+
+	// Webhook notifier.
+	//
+	// If set, acquisitions may request the notify_url parameter to be notified once their lock is released or their
+	// lease expires. The notifier is not closed by the handler. Disabled by default, in which case the parameter is
+	// rejected.
+	Notifier *Notifier
+
+	// Numeric JSON.
+	//
+	// If set, IDs and fencing tokens are formatted as JSON numbers in responses, and durations as integer milliseconds,
+	// with infinite lease timeouts as -1. Clients must then be able to represent 64-bit integers precisely, which
+	// random IDs in particular require. Disabled by default, in which case they are formatted as strings.
+	NumericJSON bool
+
+	// Ticket ID strategy of the manager.
+	//
+	// Ticket IDs are formatted in responses as external IDs of the strategy, ie. as UUIDs for the UUID strategy, while
+	// requests may carry IDs as external IDs of any strategy. Defaults to the sequential strategy, whose external IDs
+	// are the IDs in base 10.
+	IDStrategy locking.IDStrategy
+
+	// Respond without content.
+	//
+	// If set, successful releases and extensions of a single ticket respond with 204 No Content rather than 200 and a
+	// JSON object, at the expense of extensions no longer reporting whether the lease changed. Error responses are
+	// unaffected. Disabled by default.
+	NoContent bool
+
+	// Maximum long poll duration.
+	//
+	// If set, requests waiting to acquire a lock are held open for no longer than this, no matter their lock timeout.
+	// Once it elapses, the request is responded to with 408 and the poll_expired code, along with the ID and queue
+	// position of the ticket, which stays queued for the rest of its lock timeout. The client re-polls by PUT with the
+	// ID, which waits for the queued ticket for up to the maximum duration anew. Acquisitions subject to the maximum
+	// outlive their request, and are only abandoned if the client disconnects before learning of the ID. Disabled by
+	// default, in which case requests are held open for up to the lock timeout.
+	MaxLongPollDuration time.Duration
+
+	// Request timeout.
+	//
+	// If set, the context of every request is canceled once the timeout elapses, bounding the processing of requests
+	// distinct from their lock timeout. Requests waiting to acquire or upgrade a lock are allowed to wait for up to
+	// their lock timeout, or the maximum long poll, in addition to the request timeout, while streams, such as watches,
+	// keepalives and WebSockets, are exempt once established. The read and write deadlines of the connection are
+	// extended alike, so the read and write timeouts of the server may be set to the request timeout without cutting
+	// waiting requests short. Disabled by default.
+	RequestTimeout time.Duration
 }
 
 // New handler.
-func NewHandler(manager locking.Manager) http.Handler {
-	return &handler{
-		manager: manager,
+//
+// Handler options may optionally be provided, of which only the first are considered.
+func NewHandler(manager locking.Manager, options ...HandlerOptions) http.Handler {
+	var handlerOptions HandlerOptions
+	if len(options) > 0 {
+		handlerOptions = options[0]
+	}
+
+	logger := handlerOptions.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	h := &handler{
+		manager:     manager,
+		logger:      logger,
+		admin:       handlerOptions.EnableAdmin,
+		notifier:    handlerOptions.Notifier,
+		format:      responseFormat{numeric: handlerOptions.NumericJSON, idStrategy: handlerOptions.IDStrategy},
+		noContent:   handlerOptions.NoContent,
+		maxLongPoll: handlerOptions.MaxLongPollDuration,
+		timeout:     handlerOptions.RequestTimeout,
 	}
+
+	if handlerOptions.TracerProvider != nil {
+		h.tracer = handlerOptions.TracerProvider.Tracer("lockerd/httpserver")
+		h.propagator = handlerOptions.Propagator
+
+		if h.propagator == nil {
+			h.propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+		}
+	}
+
+	return h
 }
 
 func (h *handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
-	var err error
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: resp, statusCode: 200}
+	resp = recorder
+	req = withRequestID(resp, req)
+
+	defer func() {
+		h.logger.Debug("Request served", "method", req.Method, "path", req.URL.Path, "status", recorder.statusCode, "duration", time.Since(start), "request_id", requestIDOf(req))
+	}()
+
+	// Trace the request if enabled.
+	if h.tracer != nil {
+		ctx := h.propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := h.tracer.Start(ctx, req.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.path", req.URL.Path),
+		))
+		req = req.WithContext(ctx)
+
+		defer func() {
+			span.SetAttributes(attribute.Int("http.response.status_code", recorder.statusCode))
+			if recorder.statusCode >= 500 {
+				span.SetStatus(codes.Error, "")
+			}
+			span.End()
+		}()
+	}
+
+	// Bound the request by the request timeout if enabled.
+	if h.timeout > 0 {
+		var stopTimeout func()
+		req, stopTimeout = withRequestTimeout(req, h.timeout)
+		defer stopTimeout()
+	}
+
+	// Resolve raw keys to their lock paths.
+	req, err := withRawKey(req)
+	if err == errRawKeyMissing {
+		respondError(resp, "missing_key", "Missing X-Lock-Key header", 400)
+		return
+	} else if err != nil {
+		respondError(resp, "invalid_key", "Invalid base64url encoded key", 400)
+		return
+	}
+
+	// Parse JSON bodies as form values, except for requests to the root, whose handlers parse their bodies themselves.
+	if req.URL.Path != "/" && isJsonRequest(req) {
+		if err := parseJsonForm(req); err != nil {
+			respondError(resp, "invalid_body", "Invalid JSON body", 400)
+			return
+		}
+	}
 
 	switch req.Method {
 	case "POST":
-		err = h.serveAcquire(resp, req)
+		if req.URL.Path == "/" && req.URL.Query().Get("restore") == "true" {
+			err = h.serveRestore(resp, req)
+		} else if req.URL.Path == "/" && req.URL.Query().Get("heartbeat") == "true" {
+			err = h.serveHeartbeat(resp, req)
+		} else if req.URL.Path == "/" {
+			err = h.serveAcquireMulti(resp, req)
+		} else {
+			err = h.serveAcquire(resp, req)
+		}
 	case "DELETE":
-		err = h.serveRelease(resp, req)
+		if req.URL.Path == "/" {
+			err = h.serveReleaseByOwner(resp, req)
+		} else if req.URL.Query().Get("force") == "true" {
+			err = h.serveForceRelease(resp, req)
+		} else {
+			err = h.serveRelease(resp, req)
+		}
+	case "PUT":
+		err = h.serveAcquireOrExtend(resp, req)
 	case "PATCH":
 		err = h.serveExtend(resp, req)
+	case "HEAD":
+		err = h.serveExists(resp, req)
 	case "GET":
-		if req.URL.Path == "/" {
+		if req.URL.Path == "/ws" && isWebSocketRequest(req) {
+			err = h.serveWebSocket(resp, req)
+		} else if req.URL.Path == "/" && req.FormValue("snapshot") == "true" {
+			err = h.serveSnapshot(resp, req)
+		} else if req.URL.Path == "/" && req.FormValue("deadlocks") == "true" {
+			err = h.serveDeadlocks(resp, req)
+		} else if req.URL.Path == "/" && req.FormValue("namespaces") == "true" {
+			err = h.serveNamespaces(resp, req)
+		} else if req.URL.Path == "/" && req.FormValue("stats") == "true" {
+			err = h.serveStats(resp, req)
+		} else if req.URL.Path == "/" && req.FormValue("metrics") == "true" {
+			err = h.serveMetrics(resp, req)
+		} else if req.URL.Path == "/" && req.FormValue("quota") == "true" {
+			err = h.serveQuota(resp, req)
+		} else if req.URL.Path == "/" {
 			err = h.serveInspectAll(resp, req)
+		} else if req.FormValue("plan") == "true" {
+			err = h.servePlan(resp, req)
+		} else if req.FormValue("position") != "" {
+			err = h.servePosition(resp, req)
+		} else if req.FormValue("history") == "true" {
+			err = h.serveHistory(resp, req)
+		} else if req.FormValue("watch") == "true" {
+			err = h.serveWatch(resp, req)
 		} else {
 			err = h.serveInspect(resp, req)
 		}
 	}
 
-	if err != nil {
+	if managerErr, ok := managerErrors[err]; ok {
+		respondError(resp, managerErr.code, managerErr.message, managerErr.statusCode)
+	} else if err != nil {
+		h.logger.Error("Request failed", "method", req.Method, "path", req.URL.Path, "error", err, "request_id", requestIDOf(req))
 		respondError(resp, "internal_server_error", "Internal server error", 500)
 	}
 }
 
-func (h *handler) serveAcquire(resp http.ResponseWriter, req *http.Request) error {
-	// Parse the path.
-	path, err := locking.ValidateLockPath(req.URL.Path)
-	if err != nil {
-		return respondNotFound(resp)
-	}
+// Error response of a manager error.
+type managerError struct {
+	code       string
+	message    string
+	statusCode int
+}
 
-	// Parse the timeout values.
+// Error responses of well-known manager errors.
+var managerErrors = map[error]managerError{
+	locking.ErrDraining:               {"draining", "Server is shutting down", 503},
+	locking.ErrMetadataTooLarge:       {"metadata_too_large", "Owner or labels exceed the metadata limits", 400},
+	locking.ErrLeaseTimeoutOutOfRange: {"lease_timeout_out_of_range", "Lease timeout out of range", 400},
+	locking.ErrLockTimeoutOutOfRange:  {"lock_timeout_out_of_range", "Lock timeout out of range", 400},
+	locking.ErrQueueFull:              {"queue_full", "Lock queue is full", 429},
+	locking.ErrPreconditionFailed:     {"precondition_failed", "Remaining lease does not exceed if_lease_timeout_gt", 412},
+	locking.ErrUpgradeConflict:        {"upgrade_conflict", "Another holder is upgrading the lock", 409},
+	locking.ErrHoldTimeExceeded:       {"hold_time_exceeded", "Lease cannot be extended past the maximum total hold time", 409},
+	locking.ErrCapacityMismatch:       {"capacity_mismatch", "Capacity differs from that of the semaphore", 409},
+}
+
+// Parameters of an acquisition.
+type acquireParams struct {
+	lockTimeout       time.Duration
+	leaseTimeout      time.Duration
+	try               bool
+	ifUnlocked        bool
+	keepaliveInterval time.Duration
+	notifyURL         *url.URL
+	options           locking.AcquireOptions
+}
+
+// Error response of an invalid request parameter.
+type paramError struct {
+	code    string
+	message string
+}
+
+// Parse the parameters of an acquisition.
+//
+// Shared by all means of acquisition, so their parameters are parsed alike. Returns the error to respond with as a
+// bad request if any parameter is missing or invalid.
+func (h *handler) parseAcquireParams(req *http.Request) (acquireParams, *paramError) {
+	var params acquireParams
+	var err error
+
+	// Parse the timeout values, falling back to the configured defaults if omitted. The lock timeout is not applicable
+	// when trying to acquire the lock without queueing, including if only acquiring an unlocked path. Timeouts may be
+	// given as deadlines instead, which take precedence.
+	params.ifUnlocked = req.FormValue("if_unlocked") == "true"
+	params.try = req.FormValue("try") == "true" || params.ifUnlocked
 	lockTimeoutStr := req.FormValue("lock_timeout")
 	leaseTimeoutStr := req.FormValue("lease_timeout")
+	params.lockTimeout, params.leaseTimeout = h.manager.DefaultTimeouts()
 
-	if lockTimeoutStr == "" {
-		return respondError(resp, "missing_lock_timeout", "Missing form parameter lock_timeout", 400)
+	if lockTimeoutStr == "" && req.FormValue("lock_deadline") == "" && params.lockTimeout == 0 && !params.try {
+		return params, &paramError{"missing_lock_timeout", "Missing form parameter lock_timeout"}
 	}
-	if leaseTimeoutStr == "" {
-		return respondError(resp, "missing_lease_timeout", "Missing form parameter lease_timeout", 400)
+	if leaseTimeoutStr == "" && req.FormValue("lease_deadline") == "" && params.leaseTimeout == 0 {
+		return params, &paramError{"missing_lease_timeout", "Missing form parameter lease_timeout"}
+	}
+
+	if params.try {
+		params.lockTimeout = 0
+	} else if lockTimeoutStr != "" {
+		params.lockTimeout, err = ParseDuration(lockTimeoutStr)
+		if err != nil {
+			return params, &paramError{"invalid_lock_timeout", "Invalid lock timeout"}
+		}
+	}
+	if leaseTimeoutStr != "" {
+		params.leaseTimeout, err = ParseLeaseTimeout(leaseTimeoutStr)
+		if err != nil {
+			return params, &paramError{"invalid_lease_timeout", "Invalid lease timeout"}
+		}
+	}
+
+	if !params.try {
+		if params.lockTimeout, err = parseDeadline(req, "lock_deadline", params.lockTimeout); err != nil {
+			return params, &paramError{"invalid_lock_deadline", "Invalid or past lock deadline"}
+		}
+	}
+	if params.leaseTimeout, err = parseDeadline(req, "lease_deadline", params.leaseTimeout); err != nil {
+		return params, &paramError{"invalid_lease_deadline", "Invalid or past lease deadline"}
+	}
+
+	// Parse the keepalive interval. The lease must be finite and outlast the interval, as it would otherwise expire
+	// between renewals.
+	if keepaliveIntervalStr := req.FormValue("keepalive_interval"); keepaliveIntervalStr != "" {
+		params.keepaliveInterval, err = ParseDuration(keepaliveIntervalStr)
+		if err != nil || params.keepaliveInterval <= 0 || params.leaseTimeout < 0 || params.keepaliveInterval >= params.leaseTimeout || req.FormValue("enqueue_only") == "true" {
+			return params, &paramError{"invalid_keepalive_interval", "Invalid keepalive interval"}
+		}
 	}
 
-	lockTimeout, err := ParseDuration(lockTimeoutStr)
+	// Parse the acquisition options.
+	labels, err := parseLabels(req.Form["labels"])
 	if err != nil {
-		return respondError(resp, "invalid_lock_timeout", "Invalid lock timeout", 400)
+		return params, &paramError{"invalid_labels", "Invalid labels"}
+	}
+
+	params.options = locking.AcquireOptions{
+		Owner:  req.FormValue("owner"),
+		Labels: labels,
+	}
+
+	switch req.FormValue("mode") {
+	case "", "exclusive":
+		params.options.Mode = locking.ModeExclusive
+	case "shared":
+		params.options.Mode = locking.ModeShared
+	default:
+		return params, &paramError{"invalid_mode", "Invalid mode"}
+	}
+
+	// Parse the semaphore capacity, which implies shared mode.
+	if capacityStr := req.FormValue("capacity"); capacityStr != "" {
+		params.options.Capacity, err = strconv.Atoi(capacityStr)
+		if err != nil || params.options.Capacity <= 0 || req.FormValue("mode") == "exclusive" {
+			return params, &paramError{"invalid_capacity", "Invalid capacity"}
+		}
+	}
+
+	// Parse the notification URL. Kept alive locks stream their lifecycle to the client instead.
+	if notifyURLStr := req.FormValue("notify_url"); notifyURLStr != "" {
+		if h.notifier == nil {
+			return params, &paramError{"webhooks_disabled", "Webhooks are disabled"}
+		}
+
+		params.notifyURL, err = parseNotifyURL(notifyURLStr)
+		if err != nil || params.keepaliveInterval > 0 {
+			return params, &paramError{"invalid_notify_url", "Invalid notification URL"}
+		}
 	}
-	leaseTimeout, err := ParseDuration(leaseTimeoutStr)
+
+	return params, nil
+}
+
+func (h *handler) serveAcquire(resp http.ResponseWriter, req *http.Request) error {
+	// Parse the path.
+	path, err := h.manager.ValidatePath(req.URL.Path)
 	if err != nil {
-		return respondError(resp, "invalid_lease_timeout", "Invalid lease timeout", 400)
+		return respondPathError(resp, err)
+	}
+
+	// Parse the acquisition.
+	params, paramErr := h.parseAcquireParams(req)
+	if paramErr != nil {
+		return respondError(resp, paramErr.code, paramErr.message, 400)
+	}
+
+	// Try to acquire the lock without queueing if requested.
+	if params.try {
+		var ticket locking.Ticket
+		var acquired bool
+
+		if params.ifUnlocked {
+			ticket, acquired, err = h.manager.AcquireIfUnlocked(path, params.leaseTimeout, params.options)
+		} else {
+			ticket, acquired, err = h.manager.TryAcquire(path, params.leaseTimeout, params.options)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !acquired && params.ifUnlocked {
+			return respondError(resp, "conflict", "Lock is held or awaited", 409)
+		} else if !acquired {
+			return respondError(resp, "conflict", "Lock is held", 409)
+		}
+
+		h.watch(path, ticket, params.notifyURL)
+
+		if params.keepaliveInterval > 0 {
+			return h.serveKeepAlive(resp, req, path, ticket, params.leaseTimeout, params.keepaliveInterval)
+		}
+
+		return respondJson(resp, map[string]interface{}{
+			"id":    h.format.ticketId(ticket.Id()),
+			"fence": h.format.id(ticket.Fence()),
+		}, 200)
+	}
+
+	// Enqueue the acquisition without waiting for it if requested. The acquisition must outlive the request.
+	if req.FormValue("enqueue_only") == "true" {
+		ticket, err := h.manager.Acquire(path, params.lockTimeout, params.leaseTimeout, params.options)
+		if err != nil {
+			return err
+		}
+
+		h.watch(path, ticket, params.notifyURL)
+
+		return h.respondEnqueued(resp, req, path, ticket)
+	}
+
+	// Acquire the lock. The acquisition is abandoned by the manager if the client disconnects while waiting, unless
+	// the wait is limited by the maximum long poll, in which case the acquisition must outlive the request.
+	longPoll := h.maxLongPoll > 0 && params.lockTimeout > h.maxLongPoll
+
+	if longPoll {
+		allowWait(resp, req, h.maxLongPoll)
+	} else {
+		allowWait(resp, req, params.lockTimeout)
 	}
 
-	// Acquire the lock.
-	ticket, err := h.manager.Acquire(path, lockTimeout, leaseTimeout)
+	var ticket locking.Ticket
+	if longPoll {
+		ticket, err = h.manager.Acquire(path, params.lockTimeout, params.leaseTimeout, params.options)
+	} else {
+		ticket, err = h.manager.AcquireContext(req.Context(), path, params.lockTimeout, params.leaseTimeout, params.options)
+	}
 	if err != nil {
 		return err
 	}
 
+	var pollDuration time.Duration
+	if longPoll {
+		pollDuration = h.maxLongPoll
+	}
+
+	pollExpired, stopPoll := pollTimer(pollDuration)
+	defer stopPoll()
+
 	select {
+	case <-pollExpired:
+		return h.respondPollExpired(resp, path, ticket)
+
 	case acquired := <-ticket.Acquired():
-		if acquired {
+		if acquired && params.keepaliveInterval > 0 {
+			return h.serveKeepAlive(resp, req, path, ticket, params.leaseTimeout, params.keepaliveInterval)
+		} else if acquired {
+			h.watch(path, ticket, params.notifyURL)
+
 			return respondJson(resp, map[string]interface{}{
-				"id": fmt.Sprintf("%d", ticket.Id()),
+				"id":    h.format.ticketId(ticket.Id()),
+				"fence": h.format.id(ticket.Fence()),
 			}, 200)
 		} else {
-			return respondError(resp, "timeout", "Timed out waiting to acquire lock", 408)
+			return h.respondTimeout(resp, req, path)
 		}
 
 	case <-req.Context().Done():
-		h.manager.Release(path, ticket.Id())
+		// The client never learned of the ID, so the acquisition is abandoned even if it would outlive the request.
+		if longPoll {
+			h.manager.Release(path, ticket.Id())
+			return nil
+		}
+
+		// The acquisition is settled promptly subsequent to cancellation, but the lock may have been acquired in the
+		// meantime, in which case it must be released.
+		if <-ticket.Acquired() {
+			h.manager.Release(path, ticket.Id())
+		}
 	}
 
 	return nil
 }
 
-func (h *handler) serveRelease(resp http.ResponseWriter, req *http.Request) error {
+// Long poll timer.
+//
+// Returns a channel that receives once the poll duration elapses, which never receives if the duration is not
+// positive, along with a function that stops the timer.
+func pollTimer(duration time.Duration) (<-chan time.Time, func()) {
+	if duration <= 0 {
+		return nil, func() {}
+	}
+
+	timer := time.NewTimer(duration)
+
+	return timer.C, func() {
+		timer.Stop()
+	}
+}
+
+// Respond with an expired long poll.
+//
+// The ticket stays queued, so the response carries its ID and queue position for the client to re-poll by PUT.
+func (h *handler) respondPollExpired(resp http.ResponseWriter, path string, ticket locking.Ticket) error {
+	position, _, err := h.manager.QueuePosition(path, ticket.Id())
+	if err != nil {
+		return err
+	}
+
+	return respondJson(resp, map[string]interface{}{
+		"code":     "poll_expired",
+		"message":  "Poll expired while waiting to acquire lock",
+		"id":       h.format.ticketId(ticket.Id()),
+		"position": position,
+	}, 408)
+}
+
+// Serve an idempotent acquisition.
+//
+// Unlike POST, which always creates a new ticket, and PATCH, which only extends the lease of an existing holder, PUT
+// acquires the lock unless the ticket of the given ID, if any, already holds or waits for it. A holder has its lease
+// extended, and is responded to as for enqueued acquisitions, whereas a waiting ticket is polled anew for up to the
+// lock timeout, subject to the maximum long poll, which makes PUT the means of re-polling an acquisition whose poll
+// expired. Otherwise, the lock is acquired as by POST, so a client can retry an acquisition whose response was lost
+// without queueing twice. The parameters of the acquisition are those of POST, so locks may equally be tried without
+// queueing, kept alive, or watched for notification once held.
+func (h *handler) serveAcquireOrExtend(resp http.ResponseWriter, req *http.Request) error {
 	// Parse the path.
-	path, err := locking.ValidateLockPath(req.URL.Path)
+	path, err := h.manager.ValidatePath(req.URL.Path)
 	if err != nil {
-		return respondNotFound(resp)
+		return respondPathError(resp, err)
 	}
 
-	// Parse the timeout values.
-	idStr := req.FormValue("id")
+	// Parse the ID, if any. Without an ID, no ticket can be found, so the lock is always acquired.
+	var id int64
+	if idStr := req.FormValue("id"); idStr != "" {
+		if id, err = locking.ParseExternalId(idStr); err != nil {
+			return respondError(resp, "invalid_id", "Invalid ID", 400)
+		}
+	}
 
-	if idStr == "" {
-		return respondError(resp, "missing_id", "Missing form parameter id", 400)
+	// Parse the acquisition. Acquiring only unlocked paths is not applicable, as the lock may already be held by the
+	// ticket.
+	params, paramErr := h.parseAcquireParams(req)
+	if paramErr != nil {
+		return respondError(resp, paramErr.code, paramErr.message, 400)
+	} else if params.ifUnlocked {
+		return respondError(resp, "invalid_if_unlocked", "if_unlocked is not applicable to PUT", 400)
 	}
 
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		return respondError(resp, "invalid_id", "Invalid ID", 400)
+	// Acquire the lock, or extend the lease of the existing ticket. New acquisitions are abandoned by the manager if
+	// the client disconnects while waiting, unless the wait is limited by the maximum long poll.
+	longPoll := h.maxLongPoll > 0 && params.lockTimeout > h.maxLongPoll
+
+	if longPoll {
+		allowWait(resp, req, h.maxLongPoll)
+	} else {
+		allowWait(resp, req, params.lockTimeout)
+	}
+
+	ctx := req.Context()
+	if longPoll {
+		ctx = context.Background()
 	}
 
-	// Release the lock.
-	released, err := h.manager.Release(path, id)
+	ticket, found, err := h.manager.AcquireOrExtend(ctx, path, id, params.lockTimeout, params.leaseTimeout, params.options)
 	if err != nil {
 		return err
 	}
 
-	if released {
-		return respondJson(resp, map[string]interface{}{}, 200)
+	// Respond to holders right away. Tickets neither holding nor waiting any longer have settled in the meantime, and
+	// are responded to as timed out.
+	if found {
+		position, _, err := h.manager.QueuePosition(path, ticket.Id())
+		if err != nil {
+			return err
+		} else if position <= 0 && params.keepaliveInterval > 0 {
+			return h.serveKeepAlive(resp, req, path, ticket, params.leaseTimeout, params.keepaliveInterval)
+		} else if position <= 0 {
+			h.watch(path, ticket, params.notifyURL)
+
+			return h.respondEnqueued(resp, req, path, ticket)
+		}
 	}
 
-	return respondNotFound(resp)
-}
+	// Poll waiting tickets anew for up to the lock timeout, as their own lock timeout is fixed, and new tickets for up
+	// to the maximum long poll.
+	var pollDuration time.Duration
 
-func (h *handler) serveExtend(resp http.ResponseWriter, req *http.Request) error {
-	// Parse the path.
-	path, err := locking.ValidateLockPath(req.URL.Path)
-	if err != nil {
-		return respondNotFound(resp)
+	switch {
+	case found && h.maxLongPoll > 0:
+		pollDuration = max(min(params.lockTimeout, h.maxLongPoll), time.Nanosecond)
+	case found:
+		pollDuration = max(params.lockTimeout, time.Nanosecond)
+	case longPoll:
+		pollDuration = h.maxLongPoll
 	}
 
-	// Parse the timeout values.
-	idStr := req.FormValue("id")
-	leaseTimeoutStr := req.FormValue("lease_timeout")
+	pollExpired, stopPoll := pollTimer(pollDuration)
+	defer stopPoll()
 
-	if idStr == "" {
-		return respondError(resp, "missing_id", "Missing form parameter id", 400)
+	select {
+	case <-pollExpired:
+		return h.respondPollExpired(resp, path, ticket)
+
+	case acquired := <-ticket.Acquired():
+		if !acquired && params.try && !found {
+			return respondError(resp, "conflict", "Lock is held", 409)
+		} else if !acquired {
+			return h.respondTimeout(resp, req, path)
+		} else if params.keepaliveInterval > 0 {
+			return h.serveKeepAlive(resp, req, path, ticket, params.leaseTimeout, params.keepaliveInterval)
+		}
+
+		h.watch(path, ticket, params.notifyURL)
+
+		return respondJson(resp, map[string]interface{}{
+			"id":    h.format.ticketId(ticket.Id()),
+			"fence": h.format.id(ticket.Fence()),
+		}, 200)
+
+	case <-req.Context().Done():
+		// Re-polled tickets stay queued, as the client knows of their ID, whereas new tickets outliving the request
+		// are abandoned, as the client never learned of their ID.
+		if found {
+			return nil
+		} else if longPoll {
+			h.manager.Release(path, ticket.Id())
+			return nil
+		}
+
+		// The acquisition is settled promptly subsequent to cancellation, but the lock may have been acquired in the
+		// meantime, in which case it must be released.
+		if <-ticket.Acquired() {
+			h.manager.Release(path, ticket.Id())
+		}
 	}
 
-	if leaseTimeoutStr == "" {
-		return respondError(resp, "missing_lease_timeout", "Missing form parameter lease_timeout", 400)
+	return nil
+}
+
+// Watch a ticket for notification.
+//
+// Does nothing unless a notification URL was requested.
+func (h *handler) watch(path string, ticket locking.Ticket, notifyURL *url.URL) {
+	if notifyURL != nil {
+		h.notifier.watch(path, ticket, notifyURL)
+	}
+}
+
+// Serve a kept alive lock.
+//
+// Streams the lifecycle of an acquired lock as server-sent events, while its lease is renewed at the keepalive
+// interval for as long as the client stays connected. Once the client disconnects, renewal stops, and the lease
+// expires as usual unless released or otherwise extended. The contended event is streamed once another acquisition
+// waits for the lock, advising the holder to finish early, and the shutdown event once shutdown of the server is
+// announced, advising the holder to finish and release the lock before the deadline.
+func (h *handler) serveKeepAlive(resp http.ResponseWriter, req *http.Request, path string, ticket locking.Ticket, leaseTimeout, interval time.Duration) error {
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		return respondError(resp, "streaming_unsupported", "Streaming unsupported", 500)
 	}
 
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		return respondError(resp, "invalid_id", "Invalid ID", 400)
+	allowWait(resp, req, -1)
+
+	ctx := req.Context()
+
+	if found, err := h.manager.KeepAlive(ctx, path, ticket.Id(), leaseTimeout, interval); err != nil {
+		return err
+	} else if !found {
+		return h.respondTimeout(resp, req, path)
 	}
-	leaseTimeout, err := ParseDuration(leaseTimeoutStr)
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.WriteHeader(200)
+
+	// Stream the acquisition, and subsequently renewals of the lease, contention and shutdown until the lock is
+	// released or the lease expires.
+	contended := ticket.Contended()
+	shutdown := h.manager.ShutdownAnnounced()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"id":    h.format.ticketId(ticket.Id()),
+		"fence": h.format.id(ticket.Fence()),
+	})
 	if err != nil {
-		return respondError(resp, "invalid_lease_timeout", "Invalid lease timeout", 400)
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(resp, "event: acquired\ndata: %s\n\n", data); err != nil {
+		return nil
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case event, ok := <-ticket.Events():
+			if !ok {
+				return nil
+			}
+
+			var name string
+
+			switch event {
+			case locking.TicketLeaseChanged:
+				name = "renewed"
+			case locking.TicketReleased:
+				name = "released"
+			case locking.TicketLeaseExpired:
+				name = "expired"
+			default:
+				continue
+			}
+
+			if _, err := fmt.Fprintf(resp, "event: %s\ndata: {}\n\n", name); err != nil {
+				return nil
+			}
+			flusher.Flush()
+
+		case <-contended:
+			contended = nil
+
+			if _, err := fmt.Fprint(resp, "event: contended\ndata: {}\n\n"); err != nil {
+				return nil
+			}
+			flusher.Flush()
+
+		case <-shutdown:
+			shutdown = nil
+
+			if err := h.streamShutdown(resp, flusher); err != nil {
+				return nil
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
 	}
+}
 
-	// Extend the lock.
-	extended, err := h.manager.Extend(path, id, leaseTimeout)
+// Stream the announced shutdown.
+//
+// Streams the shutdown event with the deadline after which the manager is drained.
+func (h *handler) streamShutdown(resp http.ResponseWriter, flusher http.Flusher) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"deadline": formatTimestamp(h.manager.ShutdownDeadline()),
+	})
 	if err != nil {
 		return err
 	}
 
-	if extended {
-		return respondJson(resp, map[string]interface{}{}, 200)
+	if _, err := fmt.Fprintf(resp, "event: shutdown\ndata: %s\n\n", data); err != nil {
+		return err
 	}
+	flusher.Flush()
 
-	return respondNotFound(resp)
+	return nil
 }
 
-func (h *handler) serveInspect(resp http.ResponseWriter, req *http.Request) error {
-	// Parse the path.
-	path, err := locking.ValidateLockPath(req.URL.Path)
+// Multiple lock acquisition request.
+//
+// Only the paths are decoded, whereas the remaining parameters of the body are parsed as form values.
+type acquireMultiRequest struct {
+	Paths []string `json:"paths"`
+}
+
+func (h *handler) serveAcquireMulti(resp http.ResponseWriter, req *http.Request) error {
+	// Parse the request body. The paths must be given as an array, whereas the remaining parameters are parsed as form
+	// values, so the acquisition is parsed as that of a single lock.
+	data, err := io.ReadAll(req.Body)
 	if err != nil {
-		return respondNotFound(resp)
+		return respondError(resp, "invalid_body", "Invalid JSON body", 400)
 	}
 
-	// Inspect the lock.
-	state, err := h.manager.Inspect(path)
-	if err != nil {
-		return err
+	var body acquireMultiRequest
+	if err := json.Unmarshal(data, &body); err != nil {
+		return respondError(resp, "invalid_body", "Invalid JSON body", 400)
 	}
 
-	if state.LockingId == 0 {
-		return respondNotFound(resp)
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	if err := parseJsonForm(req); err != nil {
+		return respondError(resp, "invalid_body", "Invalid JSON body", 400)
 	}
 
-	acquirers := make([]interface{}, len(state.Acquirers))
-	for idx, acquirer := range state.Acquirers {
-		acquirers[idx] = map[string]interface{}{
-			"id":      fmt.Sprintf("%d", acquirer.Id),
-			"timeout": FormatDuration(acquirer.Timeout),
+	if len(body.Paths) == 0 {
+		return respondError(resp, "missing_paths", "Missing paths", 400)
+	}
+
+	paths := make([]string, len(body.Paths))
+	for idx, path := range body.Paths {
+		if paths[idx], err = h.manager.ValidatePath(path); err == locking.ErrPathTooLong {
+			return respondError(resp, "path_too_long", "Path too long "+path, 400)
+		} else if err != nil {
+			return respondError(resp, "invalid_path", "Invalid path "+path, 400)
 		}
 	}
 
-	return respondJson(resp, map[string]interface{}{
-		"locking_id":   fmt.Sprintf("%d", state.LockingId),
-		"lock_timeout": FormatDuration(state.LockTimeout),
-		"acquirers":    acquirers,
-	}, 200)
-}
+	// Parse the acquisition. Acquiring only unlocked paths, keeping locks alive and notification are specific to single
+	// locks.
+	params, paramErr := h.parseAcquireParams(req)
+	if paramErr != nil {
+		return respondError(resp, paramErr.code, paramErr.message, 400)
+	} else if params.ifUnlocked || params.keepaliveInterval > 0 || params.notifyURL != nil {
+		return respondError(resp, "unsupported_parameter", "Parameter not applicable to multiple locks", 400)
+	}
 
-func (h *handler) serveInspectAll(resp http.ResponseWriter, req *http.Request) error {
-	// Inspect the manager.
-	states, err := h.manager.InspectAll()
-	if err != nil {
+	// Acquire the locks.
+	allowWait(resp, req, params.lockTimeout)
+
+	tickets, err := h.manager.AcquireMulti(paths, params.lockTimeout, params.leaseTimeout, params.options)
+
+	if multiErr, ok := err.(*locking.AcquireMultiError); ok {
+		// Report the status of each path in acquisition order. Locks prior to the failed lock were released, while
+		// locks subsequent to it were never attempted.
+		sorted := append([]string(nil), paths...)
+		sort.Strings(sorted)
+
+		locks := make([]interface{}, 0, len(sorted))
+		status := "released"
+
+		for idx, path := range sorted {
+			if idx > 0 && path == sorted[idx-1] {
+				continue
+			}
+
+			if path == multiErr.Path {
+				locks = append(locks, map[string]interface{}{"path": path, "status": "timeout"})
+				status = "skipped"
+			} else {
+				locks = append(locks, map[string]interface{}{"path": path, "status": status})
+			}
+		}
+
+		body := map[string]interface{}{
+			"code":    "timeout",
+			"message": "Timed out waiting to acquire lock " + multiErr.Path,
+			"locks":   locks,
+		}
+		if err := h.hintRetryAfter(resp, body, multiErr.Path); err != nil {
+			return err
+		}
+
+		return respondJson(resp, body, 408)
+	} else if err != nil {
 		return err
 	}
 
-	locks := make(map[string]interface{}, len(states))
+	// Release the locks if the client disconnected in the meantime.
+	if req.Context().Err() != nil {
+		released := make(map[int64]bool, len(tickets))
 
-	for path, state := range states {
-		acquirers := make([]interface{}, len(state.Acquirers))
-		for idx, acquirer := range state.Acquirers {
-			acquirers[idx] = map[string]interface{}{
-				"id":      fmt.Sprintf("%d", acquirer.Id),
-				"timeout": FormatDuration(acquirer.Timeout),
+		for idx, ticket := range tickets {
+			if !released[ticket.Id()] {
+				h.manager.Release(paths[idx], ticket.Id())
+				released[ticket.Id()] = true
 			}
 		}
 
-		locks[path] = map[string]interface{}{
-			"locking_id":   fmt.Sprintf("%d", state.LockingId),
-			"lock_timeout": FormatDuration(state.LockTimeout),
-			"acquirers":    acquirers,
+		return nil
+	}
+
+	locks := make([]interface{}, len(tickets))
+	for idx, ticket := range tickets {
+		locks[idx] = map[string]interface{}{
+			"path":   paths[idx],
+			"status": "acquired",
+			"id":     h.format.ticketId(ticket.Id()),
+			"fence":  h.format.id(ticket.Fence()),
 		}
 	}
 
-	return respondJson(resp, locks, 200)
+	return respondJson(resp, map[string]interface{}{
+		"locks": locks,
+	}, 200)
+}
+
+// Respond with the enqueued state of a ticket.
+//
+// Rather than waiting for the acquisition, the ticket is left in the queue, and its position is returned. Position
+// zero indicates that the lock has been acquired. The ticket is still subject to its lock timeout, and the client is
+// expected to inspect the lock to learn of its promotion.
+func (h *handler) respondEnqueued(resp http.ResponseWriter, req *http.Request, path string, ticket locking.Ticket) error {
+	state, err := h.manager.Inspect(path)
+	if err != nil {
+		return err
+	}
+
+	for _, holder := range state.Holders {
+		if holder.Id == ticket.Id() {
+			return respondJson(resp, map[string]interface{}{
+				"id":       h.format.ticketId(ticket.Id()),
+				"fence":    h.format.id(holder.Fence),
+				"position": 0,
+			}, 200)
+		}
+	}
+
+	for idx, acquirer := range state.Acquirers {
+		if acquirer.Id == ticket.Id() {
+			return respondJson(resp, map[string]interface{}{
+				"id":       h.format.ticketId(ticket.Id()),
+				"position": idx + 1,
+			}, 202)
+		}
+	}
+
+	return h.respondTimeout(resp, req, path)
+}
+
+// Respond with an acquisition timeout.
+//
+// If requested by the include_state parameter, the state of the lock is included in the response body, so the client
+// learns of the holders without inspecting the lock. The state is omitted if the lock is no longer held.
+func (h *handler) respondTimeout(resp http.ResponseWriter, req *http.Request, path string) error {
+	body := map[string]interface{}{
+		"code":    "timeout",
+		"message": "Timed out waiting to acquire lock",
+	}
+	if err := h.hintRetryAfter(resp, body, path); err != nil {
+		return err
+	}
+
+	if req.FormValue("include_state") == "true" {
+		state, err := h.manager.Inspect(path)
+		if err != nil {
+			return err
+		}
+
+		if state.LockingId != 0 {
+			body["state"] = h.format.lockState(state)
+		}
+	}
+
+	return respondJson(resp, body, 408)
+}
+
+// Hint when to retry acquiring a lock.
+//
+// If the lock is still held, the client is hinted when to retry by a Retry-After header in whole seconds, and a
+// retry_after field of the response body.
+func (h *handler) hintRetryAfter(resp http.ResponseWriter, body map[string]interface{}, path string) error {
+	retryAfter, ok, err := h.estimateRetryAfter(path)
+	if err != nil || !ok {
+		return err
+	}
+
+	resp.Header().Set("Retry-After", strconv.FormatInt(int64((retryAfter+time.Second-1)/time.Second), 10))
+	body["retry_after"] = h.format.duration(retryAfter)
+
+	return nil
+}
+
+// Estimate when to retry acquiring a lock.
+//
+// The estimate is best-effort, and assumes that the holders of the lock hold it for the remainder of their leases,
+// after which the acquirers waiting for the lock each hold it for their full lease in turn. Leases may be released
+// early or extended, and shared acquirers may hold the lock together, so the lock may be freed sooner or later than
+// estimated. No estimate is made if the lock is not held, or any of these leases never expire.
+func (h *handler) estimateRetryAfter(path string) (time.Duration, bool, error) {
+	state, err := h.manager.Inspect(path)
+	if err != nil || state.LockingId == 0 {
+		return 0, false, err
+	}
+
+	estimate, ok := estimateWait(state)
+
+	return estimate, ok, nil
+}
+
+// Estimate the wait for a lock.
+//
+// Estimates the time until the lock is freed for an acquisition queued behind the current acquirers, as per
+// estimateRetryAfter. Returns whether an estimate is made.
+func estimateWait(state locking.LockState) (time.Duration, bool) {
+	var estimate time.Duration
+
+	for _, holder := range state.Holders {
+		if holder.Timeout < 0 {
+			return 0, false
+		}
+
+		estimate = max(estimate, holder.Timeout)
+	}
+
+	for _, acquirer := range state.Acquirers {
+		if acquirer.LeaseTimeout < 0 {
+			return 0, false
+		}
+
+		estimate += acquirer.LeaseTimeout
+	}
+
+	return estimate, true
+}
+
+func (h *handler) serveRelease(resp http.ResponseWriter, req *http.Request) error {
+	// Parse the path.
+	path, err := h.manager.ValidatePath(req.URL.Path)
+	if err != nil {
+		return respondPathError(resp, err)
+	}
+
+	// Parse the IDs.
+	if req.FormValue("id") == "" {
+		return respondError(resp, "missing_id", "Missing form parameter id", 400)
+	}
+
+	ids := make([]int64, len(req.Form["id"]))
+	for idx, idStr := range req.Form["id"] {
+		if ids[idx], err = locking.ParseExternalId(idStr); err != nil {
+			return respondError(resp, "invalid_id", "Invalid ID", 400)
+		}
+	}
+
+	// Release the locks. A single lock is released as usual, whereas multiple locks respond whether each was found.
+	released, err := h.manager.ReleaseMulti(path, ids)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) > 1 {
+		body := make(map[string]bool, len(released))
+		for id, found := range released {
+			body[fmt.Sprintf("%d", id)] = found
+		}
+
+		return respondJson(resp, map[string]interface{}{
+			"released": body,
+		}, 200)
+	}
+
+	if released[ids[0]] && h.noContent {
+		return respondNoContent(resp)
+	} else if released[ids[0]] {
+		return respondJson(resp, map[string]interface{}{}, 200)
+	}
+
+	return respondNotFound(resp)
+}
+
+func (h *handler) serveReleaseByOwner(resp http.ResponseWriter, req *http.Request) error {
+	// Parse the owner.
+	owner := req.FormValue("owner")
+
+	if owner == "" {
+		return respondError(resp, "missing_owner", "Missing form parameter owner", 400)
+	}
+
+	// Release the locks of the owner.
+	count, err := h.manager.ReleaseByOwner(owner)
+	if err != nil {
+		return err
+	}
+
+	return respondJson(resp, map[string]interface{}{
+		"released": count,
+	}, 200)
+}
+
+func (h *handler) serveExtend(resp http.ResponseWriter, req *http.Request) error {
+	// Parse the path.
+	path, err := h.manager.ValidatePath(req.URL.Path)
+	if err != nil {
+		return respondPathError(resp, err)
+	}
+
+	// Change the lock mode instead, if requested.
+	if req.FormValue("mode") != "" {
+		return h.serveChangeMode(resp, req, path)
+	}
+
+	// Parse the timeout values.
+	idStr := req.FormValue("id")
+	leaseTimeoutStr := req.FormValue("lease_timeout")
+
+	if idStr == "" {
+		return respondError(resp, "missing_id", "Missing form parameter id", 400)
+	}
+
+	if leaseTimeoutStr == "" {
+		return respondError(resp, "missing_lease_timeout", "Missing form parameter lease_timeout", 400)
+	}
+
+	id, err := locking.ParseExternalId(idStr)
+	if err != nil {
+		return respondError(resp, "invalid_id", "Invalid ID", 400)
+	}
+	leaseTimeout, err := ParseLeaseTimeout(leaseTimeoutStr)
+	if err != nil {
+		return respondError(resp, "invalid_lease_timeout", "Invalid lease timeout", 400)
+	}
+
+	// Parse the condition on the remaining lease, if any.
+	var options locking.ExtendOptions
+
+	if minRemainingStr := req.FormValue("if_lease_timeout_gt"); minRemainingStr != "" {
+		if options.IfLeaseTimeoutGreaterThan, err = ParseDuration(minRemainingStr); err != nil {
+			return respondError(resp, "invalid_if_lease_timeout_gt", "Invalid if_lease_timeout_gt", 400)
+		}
+	}
+
+	// Extend or shorten the lock.
+	var found, changed bool
+
+	if req.FormValue("shorten") == "true" {
+		found, changed, err = h.manager.Shorten(path, id, leaseTimeout)
+	} else {
+		found, changed, err = h.manager.Extend(path, id, leaseTimeout, options)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if found && h.noContent {
+		return respondNoContent(resp)
+	} else if found {
+		return respondJson(resp, map[string]interface{}{
+			"changed": changed,
+		}, 200)
+	}
+
+	return respondNotFound(resp)
+}
+
+// Lease of a heartbeat request.
+type heartbeatLease struct {
+	Path         string      `json:"path"`
+	Id           interface{} `json:"id"`
+	LeaseTimeout string      `json:"lease_timeout"`
+}
+
+// Serve a heartbeat.
+//
+// Extends every lease listed by the request body in one request, sparing holders of many locks a request per lease.
+// The result of every lease is reported in the order of the request, along with the error code if the lease could not
+// be extended, as leases may be extended even though others fail.
+func (h *handler) serveHeartbeat(resp http.ResponseWriter, req *http.Request) error {
+	// Parse the request body.
+	var leases []heartbeatLease
+
+	decoder := json.NewDecoder(req.Body)
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&leases); err != nil {
+		return respondError(resp, "invalid_body", "Invalid JSON body", 400)
+	}
+
+	if len(leases) == 0 {
+		return respondError(resp, "missing_leases", "Missing leases", 400)
+	}
+
+	results := make([]map[string]interface{}, len(leases))
+	extensions := make([]locking.LeaseExtension, 0, len(leases))
+	extensionIdxs := make([]int, 0, len(leases))
+
+	for idx, lease := range leases {
+		results[idx] = map[string]interface{}{
+			"path":    lease.Path,
+			"id":      lease.Id,
+			"found":   false,
+			"changed": false,
+		}
+
+		// Accept IDs as strings as well as numbers, as formatted in either mode.
+		idStr, ok := lease.Id.(string)
+		if number, isNumber := lease.Id.(json.Number); isNumber {
+			idStr, ok = number.String(), true
+		}
+
+		id, err := locking.ParseExternalId(idStr)
+		if !ok || err != nil {
+			results[idx]["code"] = "invalid_id"
+			continue
+		}
+		results[idx]["id"] = h.format.ticketId(id)
+
+		if lease.LeaseTimeout == "" {
+			results[idx]["code"] = "missing_lease_timeout"
+			continue
+		}
+
+		leaseTimeout, err := ParseLeaseTimeout(lease.LeaseTimeout)
+		if err != nil {
+			results[idx]["code"] = "invalid_lease_timeout"
+			continue
+		}
+
+		extensions = append(extensions, locking.LeaseExtension{
+			Path:    lease.Path,
+			Id:      id,
+			Timeout: leaseTimeout,
+		})
+		extensionIdxs = append(extensionIdxs, idx)
+	}
+
+	// Extend the leases.
+	for extensionIdx, extension := range h.manager.ExtendMulti(extensions) {
+		lease := extensions[extensionIdx]
+		result := results[extensionIdxs[extensionIdx]]
+		result["found"] = extension.Found
+		result["changed"] = extension.Changed
+
+		if managerErr, ok := managerErrors[extension.Err]; ok {
+			result["code"] = managerErr.code
+		} else if extension.Err == locking.ErrPathTooLong {
+			result["code"] = "path_too_long"
+		} else if extension.Err == locking.ErrPathInvalid {
+			result["code"] = "invalid_path"
+		} else if extension.Err != nil {
+			h.logger.Error("Heartbeat failed", "path", lease.Path, "id", lease.Id, "error", extension.Err)
+			result["code"] = "internal_server_error"
+		} else if !extension.Found {
+			result["code"] = "not_found"
+		}
+	}
+
+	return respondJson(resp, map[string]interface{}{
+		"leases": results,
+	}, 200)
+}
+
+func (h *handler) serveChangeMode(resp http.ResponseWriter, req *http.Request, path string) error {
+	// Parse the ID.
+	idStr := req.FormValue("id")
+
+	if idStr == "" {
+		return respondError(resp, "missing_id", "Missing form parameter id", 400)
+	}
+
+	id, err := locking.ParseExternalId(idStr)
+	if err != nil {
+		return respondError(resp, "invalid_id", "Invalid ID", 400)
+	}
+
+	// Change the lock mode.
+	switch req.FormValue("mode") {
+	case "shared":
+		found, err := h.manager.Downgrade(path, id)
+		if err != nil {
+			return err
+		} else if !found {
+			return respondNotFound(resp)
+		}
+
+		return respondJson(resp, map[string]interface{}{
+			"mode": "shared",
+		}, 200)
+	case "exclusive":
+		// Parse the lock timeout, falling back to the configured default if omitted.
+		lockTimeout, _ := h.manager.DefaultTimeouts()
+
+		if lockTimeoutStr := req.FormValue("lock_timeout"); lockTimeoutStr != "" {
+			if lockTimeout, err = ParseDuration(lockTimeoutStr); err != nil {
+				return respondError(resp, "invalid_lock_timeout", "Invalid lock timeout", 400)
+			}
+		}
+
+		allowWait(resp, req, lockTimeout)
+
+		ticket, err := h.manager.Upgrade(path, id, lockTimeout)
+		if err == locking.ErrUpgradeTimeout {
+			return h.respondTimeout(resp, req, path)
+		} else if err != nil {
+			return err
+		} else if ticket == nil {
+			return respondNotFound(resp)
+		}
+
+		return respondJson(resp, map[string]interface{}{
+			"mode":  "exclusive",
+			"fence": h.format.id(ticket.Fence()),
+		}, 200)
+	}
+
+	return respondError(resp, "invalid_mode", "Invalid mode", 400)
+}
+
+// Serve the existence of a lock.
+//
+// Responds like inspecting the lock, but without a body, and with the IDs of the tickets holding the lock in the
+// X-Lock-Holder header instead.
+func (h *handler) serveExists(resp http.ResponseWriter, req *http.Request) error {
+	// Parse the path.
+	path, err := h.manager.ValidatePath(req.URL.Path)
+	if err != nil {
+		return respondPathError(resp, err)
+	}
+
+	// Test if the path is locked.
+	lockers, err := h.manager.IsLocked(path)
+	if err != nil {
+		return err
+	}
+
+	if len(lockers) == 0 {
+		return respondNotFound(resp)
+	}
+
+	for _, id := range lockers {
+		resp.Header().Add("X-Lock-Holder", fmt.Sprintf("%d", id))
+	}
+
+	resp.WriteHeader(200)
+	return nil
+}
+
+func (h *handler) serveInspect(resp http.ResponseWriter, req *http.Request) error {
+	if strings.HasSuffix(req.URL.Path, "*") {
+		return h.serveInspectPattern(resp, req)
+	}
+
+	// Parse the path.
+	path, err := h.manager.ValidatePath(req.URL.Path)
+	if err != nil {
+		return respondPathError(resp, err)
+	}
+
+	// Parse the acquirers limit, including all acquirers if omitted.
+	var options locking.InspectOptions
+	if req.FormValue("acquirers_limit") != "" {
+		if options.AcquirersLimit, err = strconv.Atoi(req.FormValue("acquirers_limit")); err != nil || options.AcquirersLimit <= 0 {
+			return respondError(resp, "invalid_acquirers_limit", "Invalid acquirers limit", 400)
+		}
+	}
+
+	// Inspect the lock.
+	state, err := h.manager.Inspect(path, options)
+	if err != nil {
+		return err
+	}
+
+	if state.LockingId == 0 {
+		return respondNotFound(resp)
+	}
+
+	// Tag the response by the generation of the lock, so clients polling the lock are spared the body while the state
+	// is unchanged.
+	etag := fmt.Sprintf(`"%d"`, state.Generation)
+	resp.Header().Set("ETag", etag)
+
+	if etagMatches(req.Header.Get("If-None-Match"), etag) {
+		resp.WriteHeader(304)
+		return nil
+	}
+
+	return respondJson(resp, h.format.lockState(state), 200)
+}
+
+// Test if an If-None-Match header matches an entity tag.
+//
+// Entity tags are compared weakly, as per RFC 9110, so weak tags match their strong counterparts.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Serve the locks matching a pattern.
+//
+// Paths ending in a /* wildcard segment inspect every held lock beneath them, responding with the locks by path as
+// when inspecting all locks, which is empty if no locks match.
+func (h *handler) serveInspectPattern(resp http.ResponseWriter, req *http.Request) error {
+	states, err := h.manager.InspectPattern(req.URL.Path)
+	if err == locking.ErrPathInvalid || err == locking.ErrPathTooLong {
+		return respondPathError(resp, err)
+	} else if err != nil {
+		return err
+	}
+
+	locks := make(map[string]interface{}, len(states))
+
+	for path, state := range states {
+		locks[path] = h.format.lockState(state)
+	}
+
+	return respondJson(resp, locks, 200)
+}
+
+func (h *handler) serveWatch(resp http.ResponseWriter, req *http.Request) error {
+	// Parse the path.
+	path, err := h.manager.ValidatePath(req.URL.Path)
+	if err != nil {
+		return respondPathError(resp, err)
+	}
+
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		return respondError(resp, "streaming_unsupported", "Streaming unsupported", 500)
+	}
+
+	// Subscribe to the lock. The subscription is cleaned up once the client disconnects.
+	allowWait(resp, req, -1)
+
+	states, unsubscribe, err := h.manager.Subscribe(path)
+	if err != nil {
+		return err
+	}
+	defer unsubscribe()
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.WriteHeader(200)
+	flusher.Flush()
+
+	// Stream the lock states as events, which are either locked events with the lock state, or unlocked events, along
+	// with the shutdown event once shutdown of the server is announced, so holders subscribed to their locks can finish
+	// and release them before the deadline.
+	shutdown := h.manager.ShutdownAnnounced()
+
+	for {
+		select {
+		case state, ok := <-states:
+			if !ok {
+				return nil
+			}
+
+			event, data := "unlocked", []byte("{}")
+			if state.LockingId != 0 {
+				event = "locked"
+				if data, err = json.Marshal(h.format.lockState(state)); err != nil {
+					return nil
+				}
+			}
+
+			if _, err := fmt.Fprintf(resp, "event: %s\ndata: %s\n\n", event, data); err != nil {
+				return nil
+			}
+			flusher.Flush()
+
+		case <-shutdown:
+			shutdown = nil
+
+			if err := h.streamShutdown(resp, flusher); err != nil {
+				return nil
+			}
+
+		case <-req.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (h *handler) servePosition(resp http.ResponseWriter, req *http.Request) error {
+	// Parse the path.
+	path, err := h.manager.ValidatePath(req.URL.Path)
+	if err != nil {
+		return respondPathError(resp, err)
+	}
+
+	// Parse the ID.
+	id, err := locking.ParseExternalId(req.FormValue("position"))
+	if err != nil {
+		return respondError(resp, "invalid_id", "Invalid ID", 400)
+	}
+
+	// Find the position of the ticket.
+	position, total, err := h.manager.QueuePosition(path, id)
+	if err != nil {
+		return err
+	}
+
+	if position < 0 {
+		return respondNotFound(resp)
+	}
+
+	return respondJson(resp, map[string]interface{}{
+		"position": position,
+		"total":    total,
+	}, 200)
+}
+
+// Serve an acquisition plan.
+//
+// Reports whether the lock could be acquired immediately in the requested mode, and otherwise the estimated wait as
+// per estimateRetryAfter, without creating a ticket. Locks held in shared mode can be acquired immediately in shared
+// mode unless acquirers are waiting, and locks held by the requested owner can be re-entered. If a lease timeout is
+// requested, the estimated time until the lock would be released by the acquisition is reported as well. The plan is
+// a snapshot, so an acquisition made subsequently may fare differently.
+func (h *handler) servePlan(resp http.ResponseWriter, req *http.Request) error {
+	// Parse the path.
+	path, err := h.manager.ValidatePath(req.URL.Path)
+	if err != nil {
+		return respondPathError(resp, err)
+	}
+
+	// Parse the lease timeout, if any, and the mode. Without a lease timeout, no release is estimated, as for leases
+	// that never expire.
+	leaseTimeout := locking.InfiniteTimeout
+
+	if leaseTimeoutStr := req.FormValue("lease_timeout"); leaseTimeoutStr != "" {
+		if leaseTimeout, err = ParseLeaseTimeout(leaseTimeoutStr); err != nil {
+			return respondError(resp, "invalid_lease_timeout", "Invalid lease timeout", 400)
+		}
+	}
+
+	var mode locking.LockMode
+
+	switch req.FormValue("mode") {
+	case "", "exclusive":
+		mode = locking.ModeExclusive
+	case "shared":
+		mode = locking.ModeShared
+	default:
+		return respondError(resp, "invalid_mode", "Invalid mode", 400)
+	}
+
+	// Inspect the lock, and determine whether it can be acquired immediately.
+	state, err := h.manager.Inspect(path)
+	if err != nil {
+		return err
+	}
+
+	acquirable := state.LockingId == 0 ||
+		mode == locking.ModeShared && state.Mode == locking.ModeShared && len(state.Acquirers) == 0
+
+	if owner := req.FormValue("owner"); owner != "" {
+		for _, holder := range state.Holders {
+			acquirable = acquirable || holder.Owner == owner
+		}
+	}
+
+	body := map[string]interface{}{
+		"acquirable":        acquirable,
+		"queue_depth":       len(state.Acquirers),
+		"estimated_wait":    nil,
+		"estimated_release": nil,
+	}
+
+	if state.LockingId != 0 {
+		body["state"] = h.format.lockState(state)
+	}
+
+	// Estimate the wait, and the release if the lease is finite.
+	wait, ok := time.Duration(0), true
+	if !acquirable {
+		wait, ok = estimateWait(state)
+	}
+
+	if ok {
+		body["estimated_wait"] = h.format.duration(wait)
+
+		if leaseTimeout >= 0 {
+			body["estimated_release"] = h.format.duration(wait + leaseTimeout)
+		}
+	}
+
+	return respondJson(resp, body, 200)
+}
+
+func (h *handler) serveHistory(resp http.ResponseWriter, req *http.Request) error {
+	// Parse the path.
+	path, err := h.manager.ValidatePath(req.URL.Path)
+	if err != nil {
+		return respondPathError(resp, err)
+	}
+
+	// Retrieve the history of the lock, which is empty if auditing is disabled.
+	events, err := h.manager.History(path)
+	if err != nil {
+		return err
+	}
+
+	history := make([]interface{}, len(events))
+
+	for idx, event := range events {
+		entry := map[string]interface{}{
+			"event":  event.Kind.String(),
+			"time":   event.Time.UTC().Format(time.RFC3339Nano),
+			"id":     h.format.ticketId(event.Id),
+			"owner":  event.Owner,
+			"labels": formatLabels(event.Labels),
+		}
+		if event.Fence != 0 {
+			entry["fence"] = h.format.id(event.Fence)
+		}
+		if event.LeaseTimeout != 0 {
+			entry["lease_timeout"] = h.format.duration(event.LeaseTimeout)
+		}
+
+		history[idx] = entry
+	}
+
+	return respondJson(resp, map[string]interface{}{
+		"history": history,
+	}, 200)
+}
+
+func (h *handler) serveDeadlocks(resp http.ResponseWriter, req *http.Request) error {
+	deadlocks, err := h.manager.DetectDeadlocks()
+	if err != nil {
+		return err
+	}
+
+	result := make([]interface{}, len(deadlocks))
+	for idx, deadlock := range deadlocks {
+		result[idx] = h.format.ticketIds(deadlock)
+	}
+
+	return respondJson(resp, map[string]interface{}{
+		"deadlocks": result,
+	}, 200)
+}
+
+func (h *handler) serveNamespaces(resp http.ResponseWriter, req *http.Request) error {
+	namespaces, err := h.manager.Namespaces()
+	if err != nil {
+		return err
+	}
+
+	result := make([]interface{}, len(namespaces))
+
+	for idx, namespace := range namespaces {
+		result[idx] = map[string]interface{}{
+			"name":              namespace.Name,
+			"locks":             namespace.Locks,
+			"max_queue_depth":   namespace.Config.MaxQueueDepth,
+			"max_lease_timeout": h.format.duration(namespace.Config.MaxLeaseTimeout),
+			"capacity":          namespace.Config.Capacity,
+		}
+	}
+
+	return respondJson(resp, map[string]interface{}{
+		"namespaces": result,
+	}, 200)
+}
+
+func (h *handler) serveStats(resp http.ResponseWriter, req *http.Request) error {
+	stats := h.manager.Stats()
+
+	var lastMaintenance interface{}
+	if !stats.LastMaintenance.IsZero() {
+		lastMaintenance = stats.LastMaintenance.UTC().Format(time.RFC3339Nano)
+	}
+
+	return respondJson(resp, map[string]interface{}{
+		"paths":                stats.Paths,
+		"holders":              stats.Holders,
+		"acquirers":            stats.Acquirers,
+		"oldest_lease_age":     h.format.duration(stats.OldestLeaseAge),
+		"maintained_paths":     stats.MaintainedPaths,
+		"maintenance_duration": h.format.duration(stats.MaintenanceDuration),
+		"last_maintenance":     lastMaintenance,
+	}, 200)
+}
+
+// Serve all locks.
+//
+// Locks may be filtered by path prefix, and paginated by a limit and the cursor of the previous page, in which case the
+// locks are wrapped in an object that carries the cursor of the next page if more locks remain. Filtering to contended
+// locks by held_only happens after pagination, so pages may hold fewer locks than the limit.
+func (h *handler) serveInspectAll(resp http.ResponseWriter, req *http.Request) error {
+	// Parse the format options.
+	format := req.FormValue("format")
+	sortOrder := req.FormValue("sort")
+
+	if format != "" && format != "map" && format != "array" {
+		return respondError(resp, "invalid_format", "Invalid format", 400)
+	}
+	if sortOrder != "" && sortOrder != "path" && sortOrder != "queue_depth" {
+		return respondError(resp, "invalid_sort", "Invalid sort order", 400)
+	}
+
+	// Parse the range options.
+	prefix := req.FormValue("prefix")
+	cursor := req.FormValue("cursor")
+	heldOnly := req.FormValue("held_only") == "true"
+
+	limit := 0
+	paginated := req.FormValue("limit") != ""
+
+	if paginated {
+		var err error
+		if limit, err = strconv.Atoi(req.FormValue("limit")); err != nil || limit <= 0 {
+			return respondError(resp, "invalid_limit", "Invalid limit", 400)
+		}
+	}
+
+	// Inspect the manager.
+	states, nextCursor, err := h.manager.InspectRange(prefix, cursor, limit)
+	if err != nil {
+		return err
+	}
+
+	if heldOnly {
+		for path, state := range states {
+			if len(state.Acquirers) == 0 {
+				delete(states, path)
+			}
+		}
+	}
+
+	// Wrap paginated responses, so the cursor of the next page can be returned alongside the locks.
+	respondLocks := func(locks interface{}) error {
+		if !paginated {
+			return respondJson(resp, locks, 200)
+		}
+
+		body := map[string]interface{}{
+			"locks": locks,
+		}
+		if nextCursor != "" {
+			body["next_cursor"] = nextCursor
+		}
+
+		return respondJson(resp, body, 200)
+	}
+
+	if format == "array" {
+		// Sort the paths by the requested order.
+		paths := make([]string, 0, len(states))
+		for path := range states {
+			paths = append(paths, path)
+		}
+
+		sort.Slice(paths, func(i, j int) bool {
+			if sortOrder == "queue_depth" {
+				depthI, depthJ := len(states[paths[i]].Acquirers), len(states[paths[j]].Acquirers)
+				if depthI != depthJ {
+					return depthI > depthJ
+				}
+			}
+
+			return paths[i] < paths[j]
+		})
+
+		locks := make([]interface{}, len(paths))
+
+		for idx, path := range paths {
+			lock := h.format.lockState(states[path])
+			lock["path"] = path
+			locks[idx] = lock
+		}
+
+		return respondLocks(locks)
+	}
+
+	locks := make(map[string]interface{}, len(states))
+
+	for path, state := range states {
+		locks[path] = h.format.lockState(state)
+	}
+
+	return respondLocks(locks)
+}
+
+// Parse the deadline parameter of a timeout.
+//
+// Returns the duration from now until the deadline of the parameter, as per ParseDeadline, or the given timeout if the
+// parameter is omitted, so deadlines take precedence over timeouts given alongside them. Lease deadlines are converted
+// upon parsing, so the lease of an acquisition that waits for the lock outlasts the deadline by as long as it waited.
+func parseDeadline(req *http.Request, name string, timeout time.Duration) (time.Duration, error) {
+	deadline := req.FormValue(name)
+	if deadline == "" {
+		return timeout, nil
+	}
+
+	return ParseDeadline(deadline, time.Now())
+}
+
+// Parse labels.
+//
+// Parses labels of the form key=value. Returns nil if there are no labels.
+func parseLabels(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(values))
+
+	for _, value := range values {
+		key, value, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, errInvalidLabel
+		}
+
+		labels[key] = value
+	}
+
+	return labels, nil
+}
+
+// Invalid label.
+var errInvalidLabel = errors.New("invalid label")
+
+// Format labels for a response.
+//
+// Labels are always formatted as an object, even if there are none.
+func formatLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return map[string]string{}
+	}
+
+	return labels
 }
@@ -1,12 +1,19 @@
 package httpserver
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
 
 	"lockerd/locking"
 )
@@ -18,8 +25,16 @@ type HandlerFixture struct {
 }
 
 func NewHandlerFixture(t *testing.T) *HandlerFixture {
-	manager := locking.NewManager(locking.Config{})
-	server := httptest.NewServer(NewHandler(manager))
+	return NewHandlerFixtureWithConfig(t, locking.Config{})
+}
+
+func NewHandlerFixtureWithConfig(t *testing.T, config locking.Config) *HandlerFixture {
+	return NewHandlerFixtureWithOptions(t, config, HandlerOptions{})
+}
+
+func NewHandlerFixtureWithOptions(t *testing.T, config locking.Config, options HandlerOptions) *HandlerFixture {
+	manager, _ := locking.NewManager(config)
+	server := httptest.NewServer(NewHandler(manager, options))
 	manager.Start()
 
 	return &HandlerFixture{
@@ -35,6 +50,28 @@ func (f *HandlerFixture) Close() {
 }
 
 func (f *HandlerFixture) Request(method, path string, params url.Values) *http.Response {
+	resp, err := f.RequestContext(context.Background(), method, path, params)
+	if err != nil {
+		f.t.Fatalf("Error performing request: %v", err)
+	}
+
+	return resp
+}
+
+func (f *HandlerFixture) RequestContext(ctx context.Context, method, path string, params url.Values) (*http.Response, error) {
+	return f.requestHeader(ctx, method, path, params, nil)
+}
+
+func (f *HandlerFixture) RequestHeader(method, path string, params url.Values, header http.Header) *http.Response {
+	resp, err := f.requestHeader(context.Background(), method, path, params, header)
+	if err != nil {
+		f.t.Fatalf("Error performing request: %v", err)
+	}
+
+	return resp
+}
+
+func (f *HandlerFixture) requestHeader(ctx context.Context, method, path string, params url.Values, header http.Header) (*http.Response, error) {
 	var body io.Reader
 
 	if method == "POST" || method == "PATCH" || method == "PUT" {
@@ -48,15 +85,37 @@ func (f *HandlerFixture) Request(method, path string, params url.Values) *http.R
 		f.t.Logf("Performing %s %s", method, path)
 	}
 
-	req, err := http.NewRequest(method, f.server.URL+path, body)
+	req, err := http.NewRequestWithContext(ctx, method, f.server.URL+path, body)
 	if err != nil {
 		f.t.Fatalf("Error building response: %v", err)
 	}
 
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
 	if body != nil {
 		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	}
 
+	return f.server.Client().Do(req)
+}
+
+func (f *HandlerFixture) RequestJson(method, path string, body interface{}) *http.Response {
+	data, err := json.Marshal(body)
+	if err != nil {
+		f.t.Fatalf("Error encoding request body: %v", err)
+	}
+
+	f.t.Logf("Performing %s %s with request body %s", method, path, data)
+
+	req, err := http.NewRequest(method, f.server.URL+path, bytes.NewReader(data))
+	if err != nil {
+		f.t.Fatalf("Error building response: %v", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
 	resp, err := f.server.Client().Do(req)
 	if err != nil {
 		f.t.Fatalf("Error performing request: %v", err)
@@ -64,3 +123,44 @@ func (f *HandlerFixture) Request(method, path string, params url.Values) *http.R
 
 	return resp
 }
+
+// Dial a WebSocket session.
+//
+// Frames are read with a deadline, so tests waiting for frames that never arrive fail rather than hang.
+func (f *HandlerFixture) DialWebSocket() *websocket.Conn {
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(f.server.URL, "http")+"/ws", "", f.server.URL)
+	if err != nil {
+		f.t.Fatalf("Error dialing WebSocket: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	return conn
+}
+
+// New server-sent event reader.
+//
+// Returns a function reading the next event of the stream, returning its name and its decoded data.
+func NewEventReader(t *testing.T, body io.Reader) func() (string, SuccessResponse) {
+	reader := bufio.NewReader(body)
+
+	return func() (string, SuccessResponse) {
+		var event string
+		var data SuccessResponse
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Failed to read event: %v", err)
+			}
+
+			line = strings.TrimRight(line, "\n")
+			if line == "" {
+				return event, data
+			} else if strings.HasPrefix(line, "event: ") {
+				event = strings.TrimPrefix(line, "event: ")
+			} else if strings.HasPrefix(line, "data: ") {
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data)
+			}
+		}
+	}
+}
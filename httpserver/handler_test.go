@@ -1,140 +1,1806 @@
 package httpserver
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"lockerd/locking"
 )
 
-type SuccessResponseAcquirer struct {
-	Id      string `json:"id"`
-	Timeout string `json:"timeout"`
-}
+type SuccessResponseAcquirer struct {
+	Id         string            `json:"id"`
+	Owner      string            `json:"owner"`
+	Labels     map[string]string `json:"labels"`
+	Timeout    string            `json:"timeout"`
+	WaitingFor string            `json:"waiting_for"`
+}
+
+type SuccessResponseHolder struct {
+	Id        string            `json:"id"`
+	Fence     string            `json:"fence"`
+	Owner     string            `json:"owner"`
+	Labels    map[string]string `json:"labels"`
+	Depth     int               `json:"depth"`
+	Timeout   string            `json:"timeout"`
+	HeldFor   string            `json:"held_for"`
+	HeldSince string            `json:"held_since"`
+	ExpiresAt string            `json:"expires_at"`
+}
+
+type SuccessResponse struct {
+	Id             string                    `json:"id"`
+	Fence          string                    `json:"fence"`
+	Path           string                    `json:"path"`
+	Changed        bool                      `json:"changed"`
+	Position       int                       `json:"position"`
+	LockingId      string                    `json:"locking_id"`
+	LockTimeout    string                    `json:"lock_timeout"`
+	Mode           string                    `json:"mode"`
+	Depth          int                       `json:"depth"`
+	HeldFor        string                    `json:"held_for"`
+	HeldSince      string                    `json:"held_since"`
+	ExpiresAt      string                    `json:"expires_at"`
+	Holders        []SuccessResponseHolder   `json:"holders"`
+	Acquirers      []SuccessResponseAcquirer `json:"acquirers"`
+	AcquirersTotal int                       `json:"acquirers_total"`
+	Capacity       int                       `json:"capacity"`
+	Permits        int                       `json:"permits"`
+}
+
+type InspectAllResponse map[string]SuccessResponse
+
+type InspectAllArrayResponse []SuccessResponse
+
+type InspectAllPageResponse struct {
+	Locks      InspectAllResponse `json:"locks"`
+	NextCursor string             `json:"next_cursor"`
+}
+
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ErrorFixture struct {
+	Method             string
+	Path               string
+	Params             url.Values
+	ExpectedCode       string
+	ExpectedStatusCode int
+}
+
+func TestHandlerAcquireInvalid(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	AssertErrors(f, []ErrorFixture{
+		// Missing parameters.
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lock_timeout": []string{"1m"},
+			},
+			ExpectedCode:       "missing_lease_timeout",
+			ExpectedStatusCode: 400,
+		},
+
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lease_timeout": []string{"1m"},
+			},
+			ExpectedCode:       "missing_lock_timeout",
+			ExpectedStatusCode: 400,
+		},
+
+		// Invalid parameters.
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lock_timeout":  []string{"1m"},
+				"lease_timeout": []string{"1x"},
+			},
+			ExpectedCode:       "invalid_lease_timeout",
+			ExpectedStatusCode: 400,
+		},
+
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lock_timeout":  []string{"123a"},
+				"lease_timeout": []string{"1m"},
+			},
+			ExpectedCode:       "invalid_lock_timeout",
+			ExpectedStatusCode: 400,
+		},
+
+		// Invalid path.
+		{
+			Method: "POST",
+			Path:   "/test/",
+			Params: url.Values{
+				"id":            []string{"123"},
+				"lease_timeout": []string{"1m"},
+			},
+			ExpectedCode:       "not_found",
+			ExpectedStatusCode: 404,
+		},
+	})
+}
+
+func TestHandlerAcquireDefaultTimeouts(t *testing.T) {
+	f := NewHandlerFixtureWithConfig(t, locking.Config{DefaultLockTimeout: time.Minute, DefaultLeaseTimeout: 2 * time.Minute})
+	defer f.Close()
+
+	// Test acquiring with the default timeouts.
+	resp := f.Request("POST", "/test", nil)
+	AssertSuccessResponse(t, resp)
+
+	if state, _ := f.Manager.Inspect("test"); state.LockTimeout <= time.Minute || state.LockTimeout > 2*time.Minute {
+		t.Fatalf("Expected the default lease timeout, got %s", state.LockTimeout)
+	}
+
+	// Test that given timeouts take precedence over the defaults.
+	resp = f.Request("POST", "/other", url.Values{
+		"lease_timeout": []string{"5m"},
+	})
+	AssertSuccessResponse(t, resp)
+
+	if state, _ := f.Manager.Inspect("other"); state.LockTimeout <= 4*time.Minute {
+		t.Fatalf("Expected the given lease timeout, got %s", state.LockTimeout)
+	}
+
+	resp = f.Request("POST", "/test", url.Values{
+		"lock_timeout": []string{"10ms"},
+	})
+	AssertErrorResponse(t, resp, "timeout", 408)
+
+	// Test that given timeouts are still validated.
+	resp = f.Request("POST", "/test", url.Values{
+		"lease_timeout": []string{"1x"},
+	})
+	AssertErrorResponse(t, resp, "invalid_lease_timeout", 400)
+}
+
+func TestHandlerAcquireSuccessful(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	// Test acquiring successfully.
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	})
+	body := AssertSuccessResponse(t, resp)
+
+	if body.Id == "" {
+		t.Fatalf("Expected to have received an ID")
+	}
+	id, _ := strconv.ParseInt(body.Id, 10, 64)
+
+	lockers, _ := f.Manager.IsLocked("test")
+	if len(lockers) != 1 || lockers[0] != id {
+		t.Fatalf("Expected requestor to be locker")
+	}
+}
+
+func TestHandlerJsonBody(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	// Test acquiring with a JSON body.
+	resp := f.RequestJson("POST", "/test", map[string]interface{}{
+		"lock_timeout":  "1m",
+		"lease_timeout": "1m",
+		"owner":         "worker",
+	})
+
+	body := AssertSuccessResponse(t, resp)
+
+	state, _ := f.Manager.Inspect("test")
+	if body.Id != fmt.Sprintf("%d", state.LockingId) || state.Holders[0].Owner != "worker" {
+		t.Fatalf("Expected lock to be held by %s owned by worker, got %v", body.Id, state)
+	}
+
+	// Test extending and releasing with a numeric ID.
+	id, _ := strconv.ParseInt(body.Id, 10, 64)
+
+	resp = f.RequestJson("PATCH", "/test", map[string]interface{}{
+		"id":            id,
+		"lease_timeout": "2m",
+	})
+
+	if body := AssertSuccessResponse(t, resp); !body.Changed {
+		t.Fatalf("Expected lease to be changed")
+	}
+
+	resp = f.RequestJson("DELETE", "/test", map[string]interface{}{
+		"id": id,
+	})
+	AssertSuccessResponse(t, resp)
+
+	if lockers, _ := f.Manager.IsLocked("test"); len(lockers) != 0 {
+		t.Fatalf("Expected lock to be released, got %v", lockers)
+	}
+
+	// Test that malformed bodies are rejected.
+	for _, body := range []interface{}{"test", []string{"test"}, map[string]interface{}{"id": map[string]interface{}{"a": []int64{id}}}} {
+		resp := f.RequestJson("POST", "/test", body)
+		AssertErrorResponse(t, resp, "invalid_body", 400)
+	}
+}
+
+func TestHandlerAcquireLabels(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	// Test acquiring with labels as form values and a JSON object.
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+		"labels":        []string{"host=a", "job=backup=daily"},
+	})
+	AssertSuccessResponse(t, resp)
+
+	resp = f.RequestJson("POST", "/test", map[string]interface{}{
+		"lock_timeout":  "1m",
+		"lease_timeout": "1m",
+		"owner":         "worker",
+		"labels":        map[string]interface{}{"host": "b"},
+		"enqueue_only":  true,
+	})
+	if resp.StatusCode != 202 {
+		t.Fatalf("Expected status code %d, got %d", 202, resp.StatusCode)
+	}
+
+	body := AssertSuccessResponse(t, f.Request("GET", "/test", nil))
+
+	if labels := body.Holders[0].Labels; len(labels) != 2 || labels["host"] != "a" || labels["job"] != "backup=daily" {
+		t.Fatalf("Expected holder labels, got %v", labels)
+	}
+	if len(body.Acquirers) != 1 || body.Acquirers[0].Owner != "worker" || body.Acquirers[0].Labels["host"] != "b" {
+		t.Fatalf("Expected acquirer owned by worker with labels, got %+v", body.Acquirers)
+	}
+
+	// Test that malformed and oversized labels are rejected.
+	resp = f.Request("POST", "/other", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+		"labels":        []string{"host"},
+	})
+	AssertErrorResponse(t, resp, "invalid_labels", 400)
+
+	resp = f.Request("POST", "/other", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+		"labels":        []string{"host=" + strings.Repeat("a", locking.MaxLabelValueLength+1)},
+	})
+	AssertErrorResponse(t, resp, "metadata_too_large", 400)
+}
+
+func TestHandlerPathTooLong(t *testing.T) {
+	f := NewHandlerFixtureWithConfig(t, locking.Config{MaxPathLength: 8, MaxPathSegments: 2})
+	defer f.Close()
+
+	params := url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	}
+
+	AssertErrors(f, []ErrorFixture{
+		{
+			Method:             "POST",
+			Path:               "/abcdefghi",
+			Params:             params,
+			ExpectedCode:       "path_too_long",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Method:             "POST",
+			Path:               "/a/b/c",
+			Params:             params,
+			ExpectedCode:       "path_too_long",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Method:             "GET",
+			Path:               "/a/b/c",
+			ExpectedCode:       "path_too_long",
+			ExpectedStatusCode: 400,
+		},
+	})
+
+	// Test that paths at the limits are accepted.
+	AssertSuccessResponse(t, f.Request("POST", "/abcd/efg", params))
+}
+
+func TestHandlerHead(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	// Test that unlocked paths are not found.
+	resp := f.Request("HEAD", "/test", nil)
+	if resp.StatusCode != 404 || resp.Header.Get("X-Lock-Holder") != "" {
+		t.Fatalf("Expected status code 404 without holder, got %d", resp.StatusCode)
+	}
+
+	// Test that the holders of locked paths are reported without a body.
+	shared := locking.AcquireOptions{Mode: locking.ModeShared}
+	ticketA, _ := f.Manager.Acquire("test", time.Minute, time.Minute, shared)
+	ticketB, _ := f.Manager.Acquire("test", time.Minute, time.Minute, shared)
+
+	resp = f.Request("HEAD", "/test", nil)
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status code 200, got %d", resp.StatusCode)
+	}
+
+	expected := []string{fmt.Sprintf("%d", ticketA.Id()), fmt.Sprintf("%d", ticketB.Id())}
+	if holders := resp.Header.Values("X-Lock-Holder"); fmt.Sprint(holders) != fmt.Sprint(expected) {
+		t.Fatalf("Expected holders %v, got %v", expected, holders)
+	}
+
+	if body, _ := io.ReadAll(resp.Body); len(body) != 0 {
+		t.Fatalf("Expected no body, got %q", body)
+	}
+}
+
+func TestHandlerMetrics(t *testing.T) {
+	f := NewHandlerFixtureWithConfig(t, locking.Config{
+		HoldHistogram:        locking.HoldHistogramByPath,
+		HoldHistogramBuckets: []time.Duration{time.Minute, time.Hour},
+	})
+	defer f.Close()
+
+	for _, path := range []string{"a", locking.RawKeyPath(`"x"`)} {
+		ticket, _ := f.Manager.Acquire(path, time.Minute, time.Minute)
+		f.Manager.Release(path, ticket.Id())
+	}
+
+	resp := f.Request("GET", "/", url.Values{"metrics": []string{"true"}})
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status code 200, got %d", resp.StatusCode)
+	}
+
+	data, _ := io.ReadAll(resp.Body)
+	body := string(data)
+
+	// Test that the histograms are exposed by path, with label values escaped.
+	for _, line := range []string{
+		"# TYPE lockerd_hold_seconds histogram\n",
+		`lockerd_hold_seconds_bucket{path="a",le="60"} 1` + "\n",
+		`lockerd_hold_seconds_bucket{path="a",le="3600"} 1` + "\n",
+		`lockerd_hold_seconds_bucket{path="a",le="+Inf"} 1` + "\n",
+		`lockerd_hold_seconds_count{path="a"} 1` + "\n",
+		`lockerd_hold_seconds_count{path="~//\"x\""} 1` + "\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+
+	// Test that no histograms are exposed if disabled.
+	g := NewHandlerFixture(t)
+	defer g.Close()
+
+	resp = g.Request("GET", "/", url.Values{"metrics": []string{"true"}})
+	if data, _ := io.ReadAll(resp.Body); resp.StatusCode != 200 || len(data) != 0 {
+		t.Fatalf("Expected empty metrics, got %d: %s", resp.StatusCode, data)
+	}
+}
+
+func TestHandlerStats(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	f.Manager.Acquire("a", time.Minute, time.Minute)
+	f.Manager.Acquire("a", time.Minute, time.Minute)
+	f.Manager.Acquire("b", time.Minute, time.Minute)
+
+	// Await a maintenance pass.
+	time.Sleep(50 * time.Millisecond)
+
+	resp := f.Request("GET", "/", url.Values{"stats": []string{"true"}})
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status code %d, got %d", 200, resp.StatusCode)
+	}
+
+	var body struct {
+		Paths           int     `json:"paths"`
+		Holders         int     `json:"holders"`
+		Acquirers       int     `json:"acquirers"`
+		OldestLeaseAge  string  `json:"oldest_lease_age"`
+		LastMaintenance *string `json:"last_maintenance"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+
+	if body.Paths != 2 || body.Holders != 2 || body.Acquirers != 1 {
+		t.Fatalf("Expected 2 paths, 2 holders and 1 acquirer, got %+v", body)
+	}
+	if age, err := ParseDuration(body.OldestLeaseAge); err != nil || age <= 0 || age >= time.Minute {
+		t.Fatalf("Unexpected oldest lease age %q", body.OldestLeaseAge)
+	}
+	if body.LastMaintenance == nil {
+		t.Fatalf("Expected time of last maintenance")
+	}
+}
+
+func TestHandlerQuota(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	// Test that the quota is served without any limit if not rate limited.
+	resp := f.Request("GET", "/?quota=true", nil)
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status code %d, got %d", 200, resp.StatusCode)
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+
+	if limit, ok := body["rate_limit"]; !ok || limit != nil || body["client"] == "" {
+		t.Fatalf("Expected quota of the client without rate limit, got %v", body)
+	}
+}
+
+func TestHandlerNamespaces(t *testing.T) {
+	f := NewHandlerFixtureWithConfig(t, locking.Config{
+		Namespaces: map[string]locking.NamespaceConfig{
+			"team": {MaxQueueDepth: 1, MaxLeaseTimeout: time.Hour},
+		},
+	})
+	defer f.Close()
+
+	f.Manager.Acquire("team/a", time.Minute, time.Minute)
+	f.Manager.Acquire("team/a", time.Minute, time.Minute)
+
+	// Test that acquisitions beyond the queue depth are refused.
+	resp := f.Request("POST", "/team/a", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	})
+	AssertErrorResponse(t, resp, "queue_full", 429)
+
+	// Test listing namespaces.
+	resp = f.Request("GET", "/", url.Values{
+		"namespaces": []string{"true"},
+	})
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status code %d, got %d", 200, resp.StatusCode)
+	}
+
+	var body struct {
+		Namespaces []struct {
+			Name            string `json:"name"`
+			Locks           int    `json:"locks"`
+			MaxQueueDepth   int    `json:"max_queue_depth"`
+			MaxLeaseTimeout string `json:"max_lease_timeout"`
+		} `json:"namespaces"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+
+	if len(body.Namespaces) != 2 || body.Namespaces[0].Name != "" || body.Namespaces[0].Locks != 0 {
+		t.Fatalf("Expected default namespace without locks, got %+v", body.Namespaces)
+	}
+	if team := body.Namespaces[1]; team.Name != "team" || team.Locks != 1 || team.MaxQueueDepth != 1 || team.MaxLeaseTimeout != "1h" {
+		t.Fatalf("Expected team namespace with a single lock, got %+v", team)
+	}
+}
+
+func TestHandlerTimeoutOutOfRange(t *testing.T) {
+	f := NewHandlerFixtureWithConfig(t, locking.Config{
+		MaxLeaseTimeout: time.Hour,
+		MaxLockTimeout:  time.Minute,
+		TimeoutPolicy:   locking.TimeoutPolicyReject,
+	})
+	defer f.Close()
+
+	AssertErrors(f, []ErrorFixture{
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lock_timeout":  []string{"1m"},
+				"lease_timeout": []string{"infinite"},
+			},
+			ExpectedCode:       "lease_timeout_out_of_range",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lock_timeout":  []string{"2m"},
+				"lease_timeout": []string{"1m"},
+			},
+			ExpectedCode:       "lock_timeout_out_of_range",
+			ExpectedStatusCode: 400,
+		},
+	})
+
+	ticket, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	resp := f.Request("PATCH", "/test", url.Values{
+		"id":            []string{fmt.Sprintf("%d", ticket.Id())},
+		"lease_timeout": []string{"2h"},
+	})
+	AssertErrorResponse(t, resp, "lease_timeout_out_of_range", 400)
+}
+
+func TestHandlerAcquireFence(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	// Test that each acquisition receives a greater fencing token.
+	var fences []int64
+
+	for idx := 0; idx < 2; idx++ {
+		resp := f.Request("POST", "/test", url.Values{
+			"lock_timeout":  []string{"1m"},
+			"lease_timeout": []string{"1m"},
+		})
+		body := AssertSuccessResponse(t, resp)
+
+		id, _ := strconv.ParseInt(body.Id, 10, 64)
+		fence, err := strconv.ParseInt(body.Fence, 10, 64)
+		if err != nil || fence == 0 {
+			t.Fatalf("Expected to have received a fencing token, got %q", body.Fence)
+		}
+
+		// Test that the fencing token is reported by inspection.
+		resp = f.Request("GET", "/test", nil)
+		state := AssertSuccessResponse(t, resp)
+
+		if state.Fence != body.Fence || state.Holders[0].Fence != body.Fence {
+			t.Fatalf("Expected inspected fencing token to be %s", body.Fence)
+		}
+
+		f.Manager.Release("test", id)
+		fences = append(fences, fence)
+	}
+
+	if fences[1] <= fences[0] {
+		t.Fatalf("Expected fencing token %d to exceed %d", fences[1], fences[0])
+	}
+}
+
+func TestHandlerAcquireInfinite(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	AssertErrors(f, []ErrorFixture{
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lock_timeout":  []string{"infinite"},
+				"lease_timeout": []string{"1m"},
+			},
+			ExpectedCode:       "invalid_lock_timeout",
+			ExpectedStatusCode: 400,
+		},
+	})
+
+	// Test acquiring with an infinite lease.
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"0"},
+		"lease_timeout": []string{"infinite"},
+	})
+	id := AssertSuccessResponse(t, resp).Id
+
+	resp = f.Request("GET", "/test", nil)
+	if body := AssertSuccessResponse(t, resp); body.LockTimeout != "infinite" || body.Holders[0].Timeout != "infinite" {
+		t.Fatalf("Expected lease to be infinite, got %s", body.LockTimeout)
+	}
+
+	// Test shortening the infinite lease.
+	resp = f.Request("PATCH", "/test", url.Values{
+		"id":            []string{id},
+		"lease_timeout": []string{"1m"},
+		"shorten":       []string{"true"},
+	})
+	if body := AssertSuccessResponse(t, resp); !body.Changed {
+		t.Fatalf("Expected infinite lease to be shortened")
+	}
+}
+
+func TestHandlerAcquireTimeout(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	// Acquire up front to cause waiting.
+	f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	// Test acquiring causing timeout.
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"10ms"},
+		"lease_timeout": []string{"1m"},
+	})
+
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "60" {
+		t.Fatalf("Expected to retry after the remaining lease, got %q", retryAfter)
+	}
+	AssertErrorResponse(t, resp, "timeout", 408)
+
+	// Test that the leases of queued acquirers are included in the estimate.
+	f.Manager.Acquire("test", time.Minute, 90*time.Second)
+
+	resp = f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"10ms"},
+		"lease_timeout": []string{"1m"},
+	})
+
+	var body struct {
+		Code       string `json:"code"`
+		RetryAfter string `json:"retry_after"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+
+	retryAfter, _ := ParseDuration(body.RetryAfter)
+	if resp.Header.Get("Retry-After") != "150" || body.Code != "timeout" || retryAfter <= 149*time.Second || retryAfter > 150*time.Second {
+		t.Fatalf("Expected to retry after the remaining lease and the queued lease, got %q, %+v", resp.Header.Get("Retry-After"), body)
+	}
+
+	// Test that no hint is given if a lease never expires.
+	f.Manager.Acquire("test", time.Minute, locking.InfiniteTimeout)
+
+	resp = f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"10ms"},
+		"lease_timeout": []string{"1m"},
+	})
+
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		t.Fatalf("Expected no retry hint, got %q", retryAfter)
+	}
+	AssertErrorResponse(t, resp, "timeout", 408)
+}
+
+func TestHandlerAcquireTimeoutIncludeState(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	holder, _ := f.Manager.Acquire("test", time.Minute, time.Minute, locking.AcquireOptions{Owner: "holder"})
+	waiting, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	// Test that the state of the lock is included upon timing out.
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"10ms"},
+		"lease_timeout": []string{"1m"},
+		"include_state": []string{"true"},
+	})
+	if resp.StatusCode != 408 {
+		t.Fatalf("Expected status code 408, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Code  string          `json:"code"`
+		State SuccessResponse `json:"state"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+
+	if body.Code != "timeout" || body.State.LockingId != fmt.Sprintf("%d", holder.Id()) {
+		t.Fatalf("Expected lock to be held by %d, got %+v", holder.Id(), body)
+	}
+	if len(body.State.Acquirers) != 1 || body.State.Acquirers[0].Id != fmt.Sprintf("%d", waiting.Id()) {
+		t.Fatalf("Expected %d to be waiting, got %+v", waiting.Id(), body.State.Acquirers)
+	}
+
+	// Test that the state is omitted unless requested.
+	resp = f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"10ms"},
+		"lease_timeout": []string{"1m"},
+	})
+
+	var plain map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&plain); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+	if _, ok := plain["state"]; ok {
+		t.Fatalf("Expected no state, got %v", plain)
+	}
+}
+
+func TestHandlerAcquireEnqueueOnly(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	// Test enqueueing on a free lock.
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+		"enqueue_only":  []string{"true"},
+	})
+	body := AssertSuccessResponse(t, resp)
+
+	if body.Id == "" || body.Position != 0 {
+		t.Fatalf("Expected to have acquired the lock")
+	}
+	holderId, _ := strconv.ParseInt(body.Id, 10, 64)
+
+	// Test enqueueing behind the holder.
+	for expectedPosition := 1; expectedPosition <= 2; expectedPosition++ {
+		resp = f.Request("POST", "/test", url.Values{
+			"lock_timeout":  []string{"50ms"},
+			"lease_timeout": []string{"1m"},
+			"enqueue_only":  []string{"true"},
+		})
+		if resp.StatusCode != 202 {
+			t.Fatalf("Expected status code %d, got %d", 202, resp.StatusCode)
+		}
+
+		var body SuccessResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Error decoding response body: %v", err)
+		}
+
+		if body.Position != expectedPosition {
+			t.Fatalf("Expected position %d, got %d", expectedPosition, body.Position)
+		}
+	}
+
+	// Assert that the enqueued tickets remain subject to their lock timeout.
+	state, _ := f.Manager.Inspect("test")
+	if state.LockingId != holderId || len(state.Acquirers) != 2 {
+		t.Fatalf("Expected 2 enqueued acquirers")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	state, _ = f.Manager.Inspect("test")
+	if state.LockingId != holderId || len(state.Acquirers) != 0 {
+		t.Fatalf("Expected enqueued acquirers to have timed out")
+	}
+
+	// Test enqueueing with an immediate timeout.
+	resp = f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"0"},
+		"lease_timeout": []string{"1m"},
+		"enqueue_only":  []string{"true"},
+	})
+	AssertErrorResponse(t, resp, "timeout", 408)
+}
+
+func TestHandlerAcquireOrExtend(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	// Test that PUT without an ID acquires the lock.
+	resp := f.Request("PUT", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	})
+	body := AssertSuccessResponse(t, resp)
+
+	// Test that retrying with the ID of the holder extends its lease rather than queueing.
+	resp = f.Request("PUT", "/test", url.Values{
+		"id":            []string{body.Id},
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"2m"},
+	})
+	if retried := AssertSuccessResponse(t, resp); retried.Id != body.Id || retried.Fence != body.Fence {
+		t.Fatalf("Expected holder %s to be returned, got %+v", body.Id, retried)
+	}
+
+	state, _ := f.Manager.Inspect("test")
+	if len(state.Acquirers) != 0 || state.Holders[0].Timeout <= time.Minute {
+		t.Fatalf("Expected lease to be extended without queueing, got %+v", state)
+	}
+
+	// Test that retrying with the ID of a waiting ticket waits for it rather than queueing.
+	waiting, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	resp = f.Request("PUT", "/test", url.Values{
+		"id":            []string{fmt.Sprintf("%d", waiting.Id())},
+		"lock_timeout":  []string{"50ms"},
+		"lease_timeout": []string{"1m"},
+	})
+	AssertErrorResponse(t, resp, "poll_expired", 408)
+
+	if state, _ := f.Manager.Inspect("test"); len(state.Acquirers) != 1 || state.Acquirers[0].Id != waiting.Id() {
+		t.Fatalf("Expected only ticket %d to be waiting, got %+v", waiting.Id(), state)
+	}
+
+	// Test that an unknown ID acquires the lock anew.
+	resp = f.Request("PUT", "/other", url.Values{
+		"id":            []string{body.Id},
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	})
+	if acquired := AssertSuccessResponse(t, resp); acquired.Id == body.Id {
+		t.Fatalf("Expected a new ticket, got %s", acquired.Id)
+	}
+
+	resp = f.Request("PUT", "/test", url.Values{
+		"id":            []string{"x"},
+		"lease_timeout": []string{"1m"},
+	})
+	AssertErrorResponse(t, resp, "invalid_id", 400)
+}
+
+func TestHandlerAcquireOrExtendParams(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	// Test that PUT parses its parameters as POST does.
+	resp := f.Request("PUT", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+		"mode":          []string{"x"},
+	})
+	AssertErrorResponse(t, resp, "invalid_mode", 400)
+
+	resp = f.Request("PUT", "/test", url.Values{
+		"lease_timeout": []string{"1m"},
+		"if_unlocked":   []string{"true"},
+	})
+	AssertErrorResponse(t, resp, "invalid_if_unlocked", 400)
+
+	// Test that trying to acquire a held lock conflicts without queueing.
+	holder, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	resp = f.Request("PUT", "/test", url.Values{
+		"lease_timeout": []string{"1m"},
+		"try":           []string{"true"},
+	})
+	AssertErrorResponse(t, resp, "conflict", 409)
+
+	if state, _ := f.Manager.Inspect("test"); len(state.Acquirers) != 0 {
+		t.Fatalf("Expected no acquisition to be queued, got %+v", state.Acquirers)
+	}
+
+	// Test that a holder retrying with a keepalive interval has its lock kept alive.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resp, err := f.RequestContext(ctx, "PUT", "/test", url.Values{
+		"id":                 []string{fmt.Sprintf("%d", holder.Id())},
+		"lock_timeout":       []string{"1m"},
+		"lease_timeout":      []string{"2m"},
+		"keepalive_interval": []string{"1m"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer resp.Body.Close()
+
+	nextEvent := NewEventReader(t, resp.Body)
+
+	if event, body := nextEvent(); event != "acquired" || body.Id != fmt.Sprintf("%d", holder.Id()) {
+		t.Fatalf("Expected acquired event of %d, got %s %v", holder.Id(), event, body)
+	}
+}
+
+func TestHandlerAcquireLongPoll(t *testing.T) {
+	f := NewHandlerFixtureWithOptions(t, locking.Config{}, HandlerOptions{MaxLongPollDuration: 50 * time.Millisecond})
+	defer f.Close()
+
+	holder, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	// Test that the poll expires before the lock timeout, with the ticket staying queued.
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	})
+	if resp.StatusCode != 408 {
+		t.Fatalf("Expected status code %d, got %d", 408, resp.StatusCode)
+	}
+
+	var body struct {
+		Code     string `json:"code"`
+		Id       string `json:"id"`
+		Position int    `json:"position"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+
+	if body.Code != "poll_expired" || body.Id == "" || body.Position != 1 {
+		t.Fatalf("Expected poll to expire with ticket queued, got %+v", body)
+	}
+
+	// Test that re-polling by ID keeps the ticket queued.
+	repoll := url.Values{
+		"id":            []string{body.Id},
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	}
+
+	resp = f.Request("PUT", "/test", repoll)
+	if resp.StatusCode != 408 {
+		t.Fatalf("Expected status code %d, got %d", 408, resp.StatusCode)
+	}
+
+	if state, _ := f.Manager.Inspect("test"); len(state.Acquirers) != 1 || fmt.Sprintf("%d", state.Acquirers[0].Id) != body.Id {
+		t.Fatalf("Expected ticket %s to stay queued, got %+v", body.Id, state.Acquirers)
+	}
+
+	// Test that re-polling acquires the lock once released.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		f.Manager.Release("test", holder.Id())
+	}()
+
+	resp = f.Request("PUT", "/test", repoll)
+	if acquired := AssertSuccessResponse(t, resp); acquired.Id != body.Id || acquired.Fence == "" {
+		t.Fatalf("Expected ticket %s to acquire the lock, got %+v", body.Id, acquired)
+	}
+
+	// Test that lock timeouts within the maximum are waited for as usual.
+	resp = f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"20ms"},
+		"lease_timeout": []string{"1m"},
+	})
+	AssertErrorResponse(t, resp, "timeout", 408)
+}
+
+func TestHandlerPlan(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	plan := func(params url.Values) map[string]interface{} {
+		params.Set("plan", "true")
+
+		resp := f.Request("GET", "/test", params)
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expected status code %d, got %d", 200, resp.StatusCode)
+		}
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Error decoding response body: %v", err)
+		}
+
+		return body
+	}
+
+	// Test planning to acquire a free lock.
+	body := plan(url.Values{"lease_timeout": []string{"1m"}})
+	if body["acquirable"] != true || body["estimated_wait"] != "0" || body["estimated_release"] != "1m" || body["state"] != nil {
+		t.Fatalf("Expected free lock, got %v", body)
+	}
+
+	// Test planning to acquire a held lock, queueing behind an acquirer.
+	f.Manager.Acquire("test", time.Minute, time.Minute, locking.AcquireOptions{Mode: locking.ModeShared, Owner: "worker"})
+	f.Manager.Acquire("test", time.Minute, 30*time.Second)
+
+	body = plan(url.Values{"lease_timeout": []string{"1m"}})
+	if body["acquirable"] != false || body["queue_depth"] != float64(1) || body["state"] == nil {
+		t.Fatalf("Expected held lock with one acquirer, got %v", body)
+	}
+
+	if wait, err := ParseDuration(body["estimated_wait"].(string)); err != nil || wait <= time.Minute || wait > 90*time.Second {
+		t.Fatalf("Expected estimated wait of about 90s, got %v", body["estimated_wait"])
+	}
+
+	// Test that the owner of the lock can re-enter it, and that no ticket is created.
+	if body = plan(url.Values{"owner": []string{"worker"}}); body["acquirable"] != true || body["estimated_release"] != nil {
+		t.Fatalf("Expected lock to be re-entrant, got %v", body)
+	}
+
+	if state, _ := f.Manager.Inspect("test"); len(state.Holders) != 1 || len(state.Acquirers) != 1 {
+		t.Fatalf("Expected planning not to create tickets, got %+v", state)
+	}
+
+	resp := f.Request("GET", "/test", url.Values{"plan": []string{"true"}, "mode": []string{"x"}})
+	AssertErrorResponse(t, resp, "invalid_mode", 400)
+}
+
+func TestHandlerAcquireShared(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	AssertErrors(f, []ErrorFixture{
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lock_timeout":  []string{"1m"},
+				"lease_timeout": []string{"1m"},
+				"mode":          []string{"read"},
+			},
+			ExpectedCode:       "invalid_mode",
+			ExpectedStatusCode: 400,
+		},
+	})
+
+	// Test acquiring in shared mode concurrently.
+	var ids []string
+
+	for idx := 0; idx < 2; idx++ {
+		resp := f.Request("POST", "/test", url.Values{
+			"lock_timeout":  []string{"0"},
+			"lease_timeout": []string{"1m"},
+			"mode":          []string{"shared"},
+		})
+		ids = append(ids, AssertSuccessResponse(t, resp).Id)
+	}
+
+	// Test acquiring exclusively while held in shared mode.
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"0"},
+		"lease_timeout": []string{"1m"},
+		"mode":          []string{"exclusive"},
+	})
+	AssertErrorResponse(t, resp, "timeout", 408)
+
+	// Test inspecting the shared lock.
+	resp = f.Request("GET", "/test", nil)
+	body := AssertSuccessResponse(t, resp)
+
+	if body.Mode != "shared" || body.LockingId != ids[0] {
+		t.Fatalf("Expected lock to be held in shared mode by %s", ids[0])
+	}
+	if len(body.Holders) != 2 || body.Holders[0].Id != ids[0] || body.Holders[1].Id != ids[1] {
+		t.Fatalf("Expected lock to be held by %v, got %v", ids, body.Holders)
+	}
+}
+
+func TestHandlerAcquireSemaphore(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	AssertErrors(f, []ErrorFixture{
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lock_timeout":  []string{"1m"},
+				"lease_timeout": []string{"1m"},
+				"capacity":      []string{"0"},
+			},
+			ExpectedCode:       "invalid_capacity",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lock_timeout":  []string{"1m"},
+				"lease_timeout": []string{"1m"},
+				"capacity":      []string{"2"},
+				"mode":          []string{"exclusive"},
+			},
+			ExpectedCode:       "invalid_capacity",
+			ExpectedStatusCode: 400,
+		},
+	})
+
+	// Test acquiring the permits of a semaphore until exhausted.
+	var ids []string
+
+	for idx := 0; idx < 2; idx++ {
+		resp := f.Request("POST", "/test", url.Values{
+			"lock_timeout":  []string{"0"},
+			"lease_timeout": []string{"1m"},
+			"capacity":      []string{"2"},
+		})
+		ids = append(ids, AssertSuccessResponse(t, resp).Id)
+	}
+
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"0"},
+		"lease_timeout": []string{"1m"},
+		"capacity":      []string{"2"},
+	})
+	AssertErrorResponse(t, resp, "timeout", 408)
+
+	// Test acquiring with another capacity.
+	resp = f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"0"},
+		"lease_timeout": []string{"1m"},
+		"capacity":      []string{"3"},
+	})
+	AssertErrorResponse(t, resp, "capacity_mismatch", 409)
+
+	// Test inspecting the semaphore.
+	resp = f.Request("GET", "/test", nil)
+	body := AssertSuccessResponse(t, resp)
+
+	if body.Mode != "shared" || len(body.Holders) != 2 || body.Holders[0].Id != ids[0] || body.Holders[1].Id != ids[1] {
+		t.Fatalf("Expected lock to be held in shared mode by %v, got %v", ids, body.Holders)
+	}
+	if body.Capacity != 2 || body.Permits != 0 {
+		t.Fatalf("Expected capacity of 2 without permits, got %d and %d", body.Capacity, body.Permits)
+	}
+}
+
+func TestHandlerAcquireOrExtendSemaphore(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	resp := f.Request("PUT", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+		"capacity":      []string{"0"},
+	})
+	AssertErrorResponse(t, resp, "invalid_capacity", 400)
+
+	// Test that PUT acquires the permits of a semaphore rather than an exclusive lock.
+	var ids []string
+
+	for idx := 0; idx < 2; idx++ {
+		resp := f.Request("PUT", "/test", url.Values{
+			"lock_timeout":  []string{"0"},
+			"lease_timeout": []string{"1m"},
+			"capacity":      []string{"2"},
+		})
+		ids = append(ids, AssertSuccessResponse(t, resp).Id)
+	}
+
+	resp = f.Request("PUT", "/test", url.Values{
+		"lock_timeout":  []string{"0"},
+		"lease_timeout": []string{"1m"},
+		"capacity":      []string{"3"},
+	})
+	AssertErrorResponse(t, resp, "capacity_mismatch", 409)
+
+	// Test that retrying with the ID of a permit holder extends its lease rather than acquiring another permit.
+	resp = f.Request("PUT", "/test", url.Values{
+		"id":            []string{ids[0]},
+		"lock_timeout":  []string{"0"},
+		"lease_timeout": []string{"2m"},
+		"capacity":      []string{"2"},
+	})
+	if retried := AssertSuccessResponse(t, resp); retried.Id != ids[0] {
+		t.Fatalf("Expected holder %s to be returned, got %+v", ids[0], retried)
+	}
+
+	resp = f.Request("GET", "/test", nil)
+	body := AssertSuccessResponse(t, resp)
+
+	if body.Mode != "shared" || len(body.Holders) != 2 || body.Holders[0].Id != ids[0] || body.Holders[1].Id != ids[1] {
+		t.Fatalf("Expected lock to be held in shared mode by %v, got %v", ids, body.Holders)
+	}
+	if body.Capacity != 2 || body.Permits != 0 {
+		t.Fatalf("Expected capacity of 2 without permits, got %d and %d", body.Capacity, body.Permits)
+	}
+}
+
+func TestHandlerDowngrade(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	ticketA, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+	ticketB, _ := f.Manager.Acquire("test", time.Minute, time.Minute, locking.AcquireOptions{Mode: locking.ModeShared})
+
+	AssertErrors(f, []ErrorFixture{
+		{
+			Method:             "PATCH",
+			Path:               "/test",
+			Params:             url.Values{"mode": []string{"shared"}},
+			ExpectedCode:       "missing_id",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Method: "PATCH",
+			Path:   "/test",
+			Params: url.Values{
+				"id":   []string{fmt.Sprintf("%d", ticketA.Id())},
+				"mode": []string{"read"},
+			},
+			ExpectedCode:       "invalid_mode",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Method: "PATCH",
+			Path:   "/test",
+			Params: url.Values{
+				"id":   []string{fmt.Sprintf("%d", ticketB.Id())},
+				"mode": []string{"shared"},
+			},
+			ExpectedCode:       "not_found",
+			ExpectedStatusCode: 404,
+		},
+	})
+
+	// Test that downgrading admits the waiting shared ticket.
+	resp := f.Request("PATCH", "/test", url.Values{
+		"id":   []string{fmt.Sprintf("%d", ticketA.Id())},
+		"mode": []string{"shared"},
+	})
+	AssertSuccessResponse(t, resp)
+
+	select {
+	case acquired := <-ticketB.Acquired():
+		if !acquired {
+			t.Fatalf("Expected shared ticket to acquire the lock")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected shared ticket to acquire the lock")
+	}
+
+	body := AssertSuccessResponse(t, f.Request("GET", "/test", nil))
+	if body.Mode != "shared" || len(body.Holders) != 2 {
+		t.Fatalf("Expected lock to be held in shared mode by 2 holders, got %v", body.Holders)
+	}
+}
+
+func TestHandlerUpgrade(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	shared := locking.AcquireOptions{Mode: locking.ModeShared}
+	ticketA, _ := f.Manager.Acquire("test", time.Minute, time.Minute, shared)
+	ticketB, _ := f.Manager.Acquire("test", time.Minute, time.Minute, shared)
+
+	// Test that an upgrade times out while another holder remains.
+	resp := f.Request("PATCH", "/test", url.Values{
+		"id":           []string{fmt.Sprintf("%d", ticketA.Id())},
+		"mode":         []string{"exclusive"},
+		"lock_timeout": []string{"0"},
+	})
+	AssertErrorResponse(t, resp, "timeout", 408)
+
+	// Test that a second holder upgrading conflicts with a pending upgrade.
+	upgraded := make(chan *http.Response, 1)
+	go func() {
+		upgraded <- f.Request("PATCH", "/test", url.Values{
+			"id":           []string{fmt.Sprintf("%d", ticketA.Id())},
+			"mode":         []string{"exclusive"},
+			"lock_timeout": []string{"1m"},
+		})
+	}()
+
+	AssertEventually(t, func() bool {
+		resp := f.Request("PATCH", "/test", url.Values{
+			"id":           []string{fmt.Sprintf("%d", ticketB.Id())},
+			"mode":         []string{"exclusive"},
+			"lock_timeout": []string{"0"},
+		})
+		resp.Body.Close()
+
+		return resp.StatusCode == 409
+	})
+
+	// Test that the pending upgrade succeeds once the other holder releases the lock.
+	f.Manager.Release("test", ticketB.Id())
+
+	body := AssertSuccessResponse(t, <-upgraded)
+	if body.Fence != fmt.Sprintf("%d", ticketA.Fence()) {
+		t.Fatalf("Expected fencing token %d, got %s", ticketA.Fence(), body.Fence)
+	}
+
+	body = AssertSuccessResponse(t, f.Request("GET", "/test", nil))
+	if body.Mode != "exclusive" || len(body.Holders) != 1 {
+		t.Fatalf("Expected lock to be held exclusively, got %v", body.Holders)
+	}
+}
+
+func TestHandlerAcquireDisconnect(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	ticketA, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	// Test that a client disconnecting while waiting frees its queue slot.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := f.RequestContext(ctx, "POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	}); err == nil {
+		t.Fatalf("Expected request to be canceled")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	state, _ := f.Manager.Inspect("test")
+	if state.LockingId != ticketA.Id() || len(state.Acquirers) != 0 {
+		t.Fatalf("Expected lock to be held by %d without acquirers", ticketA.Id())
+	}
+}
+
+func TestHandlerAcquireKeepAlive(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	AssertErrors(f, []ErrorFixture{
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lock_timeout":       []string{"1m"},
+				"lease_timeout":      []string{"1m"},
+				"keepalive_interval": []string{"1m"},
+			},
+			ExpectedCode:       "invalid_keepalive_interval",
+			ExpectedStatusCode: 400,
+		},
+
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lock_timeout":       []string{"1m"},
+				"lease_timeout":      []string{"infinite"},
+				"keepalive_interval": []string{"1s"},
+			},
+			ExpectedCode:       "invalid_keepalive_interval",
+			ExpectedStatusCode: 400,
+		},
+	})
+
+	// Test that the lease is renewed while the client is connected.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resp, err := f.RequestContext(ctx, "POST", "/test", url.Values{
+		"lock_timeout":       []string{"1m"},
+		"lease_timeout":      []string{"200ms"},
+		"keepalive_interval": []string{"50ms"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer resp.Body.Close()
+
+	nextEvent := NewEventReader(t, resp.Body)
+
+	event, body := nextEvent()
+	if event != "acquired" || body.Id == "" || body.Fence == "" {
+		t.Fatalf("Expected acquired event, got %s %v", event, body)
+	}
+
+	if event, _ := nextEvent(); event != "renewed" {
+		t.Fatalf("Expected renewed event, got %s", event)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if lockers, _ := f.Manager.IsLocked("test"); len(lockers) != 1 || fmt.Sprintf("%d", lockers[0]) != body.Id {
+		t.Fatalf("Expected lock to be held by %s, got %v", body.Id, lockers)
+	}
+
+	// Test that renewal stops once the client disconnects.
+	cancel()
+	time.Sleep(300 * time.Millisecond)
+
+	if lockers, _ := f.Manager.IsLocked("test"); len(lockers) != 0 {
+		t.Fatalf("Expected lease to expire, got %v", lockers)
+	}
+}
+
+func TestHandlerAcquireKeepAliveContended(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resp, err := f.RequestContext(ctx, "POST", "/test", url.Values{
+		"lock_timeout":       []string{"1m"},
+		"lease_timeout":      []string{"1m"},
+		"keepalive_interval": []string{"30s"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer resp.Body.Close()
+
+	nextEvent := NewEventReader(t, resp.Body)
+
+	if event, _ := nextEvent(); event != "acquired" {
+		t.Fatalf("Expected acquired event, got %s", event)
+	}
+
+	// Test that the holder is advised of another acquisition waiting for the lock.
+	f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	if event, _ := nextEvent(); event != "contended" {
+		t.Fatalf("Expected contended event, got %s", event)
+	}
+}
+
+func TestHandlerShutdownNotice(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Hold a lock kept alive, and another lock subscribed to by its holder.
+	resp, err := f.RequestContext(ctx, "POST", "/a", url.Values{
+		"lock_timeout":       []string{"1m"},
+		"lease_timeout":      []string{"1m"},
+		"keepalive_interval": []string{"30s"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer resp.Body.Close()
+
+	nextKeepAliveEvent := NewEventReader(t, resp.Body)
+
+	if event, _ := nextKeepAliveEvent(); event != "acquired" {
+		t.Fatalf("Expected acquired event, got %s", event)
+	}
+
+	ticket, _ := f.Manager.Acquire("b", time.Minute, time.Minute)
+
+	resp, err = f.RequestContext(ctx, "GET", "/b", url.Values{"watch": []string{"true"}})
+	if err != nil {
+		t.Fatalf("Failed to watch lock: %v", err)
+	}
+	defer resp.Body.Close()
 
-type SuccessResponse struct {
-	Id          string                    `json:"id"`
-	LockingId   string                    `json:"locking_id"`
-	LockTimeout string                    `json:"lock_timeout"`
-	Acquirers   []SuccessResponseAcquirer `json:"acquirers"`
-}
+	nextWatchEvent := NewEventReader(t, resp.Body)
 
-type InspectAllResponse map[string]SuccessResponse
+	if event, _ := nextWatchEvent(); event != "locked" {
+		t.Fatalf("Expected locked event, got %s", event)
+	}
 
-type ErrorResponse struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	// Test that both holders are notified of the shutdown before the manager is drained.
+	f.Manager.AnnounceShutdown(time.Minute)
+
+	if event, _ := nextKeepAliveEvent(); event != "shutdown" {
+		t.Fatalf("Expected shutdown event of kept alive lock, got %s", event)
+	}
+	if event, _ := nextWatchEvent(); event != "shutdown" {
+		t.Fatalf("Expected shutdown event of subscribed lock, got %s", event)
+	}
+
+	// Test that the holders can still release their locks during the grace period.
+	f.Manager.Release("b", ticket.Id())
+
+	if event, _ := nextWatchEvent(); event != "unlocked" {
+		t.Fatalf("Expected unlocked event, got %s", event)
+	}
+
+	if err := f.Manager.Drain(context.Background()); err != nil {
+		t.Fatalf("Expected draining to complete, got %v", err)
+	}
 }
 
-type ErrorFixture struct {
-	Method             string
-	Path               string
-	Params             url.Values
-	ExpectedCode       string
-	ExpectedStatusCode int
+func TestHandlerAcquireTraced(t *testing.T) {
+	manager, _ := locking.NewManager(locking.Config{})
+	manager.Start()
+	defer manager.Stop()
+
+	recorder := tracetest.NewSpanRecorder()
+	server := httptest.NewServer(NewHandler(manager, HandlerOptions{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	}))
+	defer server.Close()
+
+	// Test that requests are traced, continuing the trace of the request headers.
+	req, _ := http.NewRequest("POST", server.URL+"/test", strings.NewReader("lock_timeout=1m&lease_timeout=1m"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Error performing request: %v", err)
+	}
+	AssertSuccessResponse(t, resp)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected single span, got %d", len(spans))
+	}
+
+	if traceId := spans[0].SpanContext().TraceID().String(); traceId != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("Expected propagated trace ID, got %s", traceId)
+	}
+	if len(spans[0].Events()) != 1 || spans[0].Events()[0].Name != "acquired" {
+		t.Fatalf("Expected acquired event, got %v", spans[0].Events())
+	}
 }
 
-func TestHandlerAcquireInvalid(t *testing.T) {
+func TestHandlerAcquireTry(t *testing.T) {
 	f := NewHandlerFixture(t)
 	defer f.Close()
 
 	AssertErrors(f, []ErrorFixture{
-		// Missing parameters.
 		{
 			Method: "POST",
 			Path:   "/test",
 			Params: url.Values{
-				"lock_timeout": []string{"1m"},
+				"try": []string{"true"},
 			},
 			ExpectedCode:       "missing_lease_timeout",
 			ExpectedStatusCode: 400,
 		},
+	})
+
+	// Test trying to acquire an unlocked path without a lock timeout.
+	resp := f.Request("POST", "/test", url.Values{
+		"lease_timeout": []string{"1m"},
+		"try":           []string{"true"},
+	})
+	id := AssertSuccessResponse(t, resp).Id
+
+	// Test trying to acquire a held lock.
+	resp = f.Request("POST", "/test", url.Values{
+		"lease_timeout": []string{"1m"},
+		"try":           []string{"true"},
+	})
+	AssertErrorResponse(t, resp, "conflict", 409)
+
+	// Test that the failed attempt did not queue.
+	resp = f.Request("GET", "/test", nil)
+	body := AssertSuccessResponse(t, resp)
+
+	if body.LockingId != id || len(body.Acquirers) != 0 {
+		t.Fatalf("Expected lock to be held by %s without acquirers", id)
+	}
+}
+
+func TestHandlerAcquireDeadline(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
 
+	past := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+
+	AssertErrors(f, []ErrorFixture{
 		{
 			Method: "POST",
 			Path:   "/test",
 			Params: url.Values{
+				"lock_deadline": []string{past},
 				"lease_timeout": []string{"1m"},
 			},
-			ExpectedCode:       "missing_lock_timeout",
+			ExpectedCode:       "invalid_lock_deadline",
 			ExpectedStatusCode: 400,
 		},
-
-		// Invalid parameters.
 		{
 			Method: "POST",
 			Path:   "/test",
 			Params: url.Values{
-				"lock_timeout":  []string{"1m"},
-				"lease_timeout": []string{"1d"},
+				"lock_timeout":   []string{"1m"},
+				"lease_deadline": []string{"tomorrow"},
 			},
-			ExpectedCode:       "invalid_lease_timeout",
+			ExpectedCode:       "invalid_lease_deadline",
 			ExpectedStatusCode: 400,
 		},
-
 		{
-			Method: "POST",
+			Method: "PUT",
 			Path:   "/test",
 			Params: url.Values{
-				"lock_timeout":  []string{"123a"},
-				"lease_timeout": []string{"1m"},
+				"lock_timeout":   []string{"1m"},
+				"lease_deadline": []string{past},
 			},
-			ExpectedCode:       "invalid_lock_timeout",
+			ExpectedCode:       "invalid_lease_deadline",
 			ExpectedStatusCode: 400,
 		},
+	})
 
-		// Invalid path.
-		{
-			Method: "POST",
-			Path:   "/test/",
-			Params: url.Values{
-				"id":            []string{"123"},
-				"lease_timeout": []string{"1m"},
-			},
-			ExpectedCode:       "not_found",
-			ExpectedStatusCode: 404,
-		},
+	// Test acquiring with deadlines in place of timeouts, which take precedence over timeouts given alongside.
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_deadline":  []string{future},
+		"lease_deadline": []string{future},
+		"lease_timeout":  []string{"1m"},
 	})
+	AssertSuccessResponse(t, resp)
+
+	state, _ := f.Manager.Inspect("test")
+	if state.LockTimeout <= 59*time.Minute || state.LockTimeout > time.Hour {
+		t.Fatalf("Expected lease to last until the deadline, got %v", state.LockTimeout)
+	}
 }
 
-func TestHandlerAcquireSuccessful(t *testing.T) {
+func TestHandlerAcquireIfUnlocked(t *testing.T) {
 	f := NewHandlerFixture(t)
 	defer f.Close()
 
-	// Test acquiring successfully.
+	// Test acquiring an unlocked path without a lock timeout.
 	resp := f.Request("POST", "/test", url.Values{
-		"lock_timeout":  []string{"1m"},
 		"lease_timeout": []string{"1m"},
+		"mode":          []string{"shared"},
+		"owner":         []string{"worker"},
+		"if_unlocked":   []string{"true"},
 	})
+	id := AssertSuccessResponse(t, resp).Id
+
+	// Test that neither sharing nor re-entering the lock is possible.
+	for _, owner := range []string{"", "worker"} {
+		resp = f.Request("POST", "/test", url.Values{
+			"lease_timeout": []string{"1m"},
+			"mode":          []string{"shared"},
+			"owner":         []string{owner},
+			"if_unlocked":   []string{"true"},
+		})
+		AssertErrorResponse(t, resp, "conflict", 409)
+	}
+
+	// Test that the failed attempts did not queue.
+	resp = f.Request("GET", "/test", nil)
 	body := AssertSuccessResponse(t, resp)
 
-	if body.Id == "" {
-		t.Fatalf("Expected to have received an ID")
+	if body.LockingId != id || len(body.Acquirers) != 0 {
+		t.Fatalf("Expected lock to be held by %s without acquirers", id)
 	}
-	id, _ := strconv.ParseInt(body.Id, 10, 64)
+}
 
-	locker, _ := f.Manager.IsLocked("test")
-	if locker != id {
-		t.Fatalf("Expected requestor to be locker")
+func TestHandlerRawKey(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	key := "https://example.com/a b?c"
+	header := http.Header{"X-Lock-Key": []string{key}}
+	encoded := "/~raw/" + base64.RawURLEncoding.EncodeToString([]byte(key))
+
+	// Test acquiring a raw key by header.
+	resp := f.RequestHeader("POST", "/~raw", url.Values{"lock_timeout": []string{"0s"}, "lease_timeout": []string{"1m"}}, header)
+	id := AssertSuccessResponse(t, resp).Id
+
+	// Test that the encoded path segment addresses the same lock, with or without padding.
+	for _, path := range []string{encoded, encoded + "=="} {
+		resp = f.Request("GET", path, nil)
+		if body := AssertSuccessResponse(t, resp); body.LockingId != id {
+			t.Fatalf("Expected %s to be locked by %s, got %s", path, id, body.LockingId)
+		}
 	}
+
+	// Test that raw keys do not collide with structured paths.
+	resp = f.RequestHeader("POST", "/~raw", url.Values{"lock_timeout": []string{"0s"}, "lease_timeout": []string{"1m"}}, http.Header{"X-Lock-Key": []string{"a"}})
+	AssertSuccessResponse(t, resp)
+
+	resp = f.Request("POST", "/a", url.Values{"lease_timeout": []string{"1m"}, "try": []string{"true"}})
+	AssertSuccessResponse(t, resp)
+
+	// Test releasing the raw key.
+	resp = f.RequestHeader("DELETE", "/~raw", url.Values{"id": []string{id}}, header)
+	AssertSuccessResponse(t, resp)
+
+	AssertErrorResponse(t, f.Request("GET", encoded, nil), "not_found", 404)
+
+	// Test invalid raw keys.
+	AssertErrorResponse(t, f.Request("GET", "/~raw", nil), "missing_key", 400)
+	AssertErrorResponse(t, f.Request("GET", "/~raw/*", nil), "invalid_key", 400)
+	AssertErrorResponse(t, f.Request("GET", "/~raw/", nil), "invalid_key", 400)
+
+	resp = f.RequestHeader("GET", "/~raw", nil, http.Header{"X-Lock-Key": []string{strings.Repeat("a", locking.DefaultMaxPathLength)}})
+	AssertErrorResponse(t, resp, "path_too_long", 400)
 }
 
-func TestHandlerAcquireTimeout(t *testing.T) {
+func TestHandlerAcquireReentrant(t *testing.T) {
 	f := NewHandlerFixture(t)
 	defer f.Close()
 
-	// Acquire up front to cause waiting.
-	f.Manager.Acquire("test", time.Minute, time.Minute)
+	// Test re-entering a lock by owner.
+	var ids []string
 
-	// Test acquiring causing timeout.
-	resp := f.Request("POST", "/test", url.Values{
-		"lock_timeout":  []string{"10ms"},
-		"lease_timeout": []string{"1m"},
+	for idx := 0; idx < 2; idx++ {
+		resp := f.Request("POST", "/test", url.Values{
+			"lock_timeout":  []string{"0"},
+			"lease_timeout": []string{"1m"},
+			"owner":         []string{"worker"},
+		})
+		ids = append(ids, AssertSuccessResponse(t, resp).Id)
+	}
+
+	if ids[0] != ids[1] {
+		t.Fatalf("Expected re-entry to return ID %s, got %s", ids[0], ids[1])
+	}
+
+	// Test inspecting the re-entrancy depth.
+	resp := f.Request("GET", "/test", nil)
+	body := AssertSuccessResponse(t, resp)
+
+	if body.Depth != 2 || body.Holders[0].Depth != 2 || body.Holders[0].Owner != "worker" {
+		t.Fatalf("Expected lock to be held by worker with depth 2, got %v", body.Holders)
+	}
+
+	// Test that the lock is held until every hold is released.
+	resp = f.Request("DELETE", "/test", url.Values{"id": []string{ids[0]}})
+	AssertSuccessResponse(t, resp)
+
+	resp = f.Request("GET", "/test", nil)
+	if body = AssertSuccessResponse(t, resp); body.Depth != 1 {
+		t.Fatalf("Expected lock to be held with depth 1, got %d", body.Depth)
+	}
+
+	resp = f.Request("DELETE", "/test", url.Values{"id": []string{ids[0]}})
+	AssertSuccessResponse(t, resp)
+
+	resp = f.Request("GET", "/test", nil)
+	AssertErrorResponse(t, resp, "not_found", 404)
+}
+
+type AcquireMultiResponse struct {
+	Code  string `json:"code"`
+	Locks []struct {
+		Path   string `json:"path"`
+		Status string `json:"status"`
+		Id     string `json:"id"`
+		Fence  string `json:"fence"`
+	} `json:"locks"`
+}
+
+func TestHandlerAcquireMulti(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	fixtures := []struct {
+		Body         map[string]interface{}
+		ExpectedCode string
+	}{
+		{map[string]interface{}{"lock_timeout": "1m", "lease_timeout": "1m"}, "missing_paths"},
+		{map[string]interface{}{"paths": []string{"a", "b/"}, "lock_timeout": "1m", "lease_timeout": "1m"}, "invalid_path"},
+		{map[string]interface{}{"paths": []string{"a"}, "lease_timeout": "1m"}, "missing_lock_timeout"},
+		{map[string]interface{}{"paths": []string{"a"}, "lock_timeout": "1m", "lease_timeout": "1x"}, "invalid_lease_timeout"},
+		{map[string]interface{}{"paths": "a", "lock_timeout": "1m", "lease_timeout": "1m"}, "invalid_body"},
+	}
+
+	for _, fixture := range fixtures {
+		resp := f.RequestJson("POST", "/", fixture.Body)
+		AssertErrorResponse(t, resp, fixture.ExpectedCode, 400)
+	}
+
+	// Test acquiring multiple locks.
+	resp := f.RequestJson("POST", "/", map[string]interface{}{
+		"paths":         []string{"b", "a"},
+		"lock_timeout":  "1m",
+		"lease_timeout": "1m",
 	})
-	AssertErrorResponse(t, resp, "timeout", 408)
+
+	var body AcquireMultiResponse
+	if resp.StatusCode != 200 || json.NewDecoder(resp.Body).Decode(&body) != nil || len(body.Locks) != 2 {
+		t.Fatalf("Expected locks to be acquired, got status code %d", resp.StatusCode)
+	}
+
+	for idx, path := range []string{"b", "a"} {
+		lock := body.Locks[idx]
+		lockers, _ := f.Manager.IsLocked(path)
+
+		if lock.Path != path || lock.Status != "acquired" || len(lockers) != 1 || fmt.Sprintf("%d", lockers[0]) != lock.Id {
+			t.Fatalf("Expected %s to be acquired, got %v", path, lock)
+		}
+	}
+
+	// Test the per-path status of a failed acquisition.
+	resp = f.RequestJson("POST", "/", map[string]interface{}{
+		"paths":         []string{"c", "b", "a0", "d"},
+		"lock_timeout":  "50ms",
+		"lease_timeout": "1m",
+	})
+
+	body = AcquireMultiResponse{}
+	if resp.StatusCode != 408 || json.NewDecoder(resp.Body).Decode(&body) != nil || body.Code != "timeout" {
+		t.Fatalf("Expected acquisition to time out, got status code %d", resp.StatusCode)
+	}
+
+	expected := []string{"a0:released", "b:timeout", "c:skipped", "d:skipped"}
+	if len(body.Locks) != len(expected) {
+		t.Fatalf("Expected %d statuses, got %v", len(expected), body.Locks)
+	}
+	for idx, lock := range body.Locks {
+		if lock.Path+":"+lock.Status != expected[idx] {
+			t.Errorf("Expected status %s, got %s:%s", expected[idx], lock.Path, lock.Status)
+		}
+	}
+
+	if lockers, _ := f.Manager.IsLocked("a0"); len(lockers) != 0 {
+		t.Fatalf("Expected a0 to be released")
+	}
 }
 
 func TestHandlerReleaseInvalid(t *testing.T) {
@@ -185,6 +1851,21 @@ func TestHandlerReleaseInvalid(t *testing.T) {
 	})
 }
 
+func TestHandlerReleaseIdBoundary(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	// Test that the largest ID is accepted, and that larger IDs are rejected rather than truncated.
+	resp := f.Request("DELETE", "/test", url.Values{"id": []string{"9223372036854775807"}})
+	AssertErrorResponse(t, resp, "not_found", 404)
+
+	resp = f.Request("DELETE", "/test", url.Values{"id": []string{"9223372036854775808"}})
+	AssertErrorResponse(t, resp, "invalid_id", 400)
+
+	resp = f.Request("DELETE", "/test", url.Values{"id": []string{"18446744073709551615"}})
+	AssertErrorResponse(t, resp, "invalid_id", 400)
+}
+
 func TestHandlerReleaseLocker(t *testing.T) {
 	f := NewHandlerFixture(t)
 	defer f.Close()
@@ -198,10 +1879,171 @@ func TestHandlerReleaseLocker(t *testing.T) {
 	})
 	AssertSuccessResponse(t, resp)
 
-	locker, err := f.Manager.IsLocked("test")
-	if locker != 0 || err != nil {
+	lockers, err := f.Manager.IsLocked("test")
+	if len(lockers) != 0 || err != nil {
+		t.Fatalf("Unexpected state after releasing")
+	}
+}
+
+func TestHandlerNoContent(t *testing.T) {
+	f := NewHandlerFixtureWithOptions(t, locking.Config{}, HandlerOptions{NoContent: true})
+	defer f.Close()
+
+	ticket, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+	id := fmt.Sprintf("%d", ticket.Id())
+
+	// Test that extending and releasing respond without content.
+	for _, req := range []struct {
+		method string
+		params url.Values
+	}{
+		{"PATCH", url.Values{"id": []string{id}, "lease_timeout": []string{"2m"}}},
+		{"DELETE", url.Values{"id": []string{id}}},
+	} {
+		resp := f.Request(req.method, "/test", req.params)
+		if resp.StatusCode != 204 {
+			t.Fatalf("Expected status code %d, got %d", 204, resp.StatusCode)
+		}
+
+		if body, _ := io.ReadAll(resp.Body); len(body) != 0 {
+			t.Fatalf("Expected no body, got %q", body)
+		}
+	}
+
+	// Test that errors are still responded to as JSON.
+	resp := f.Request("DELETE", "/test", url.Values{"id": []string{id}})
+	AssertErrorResponse(t, resp, "not_found", 404)
+}
+
+func TestHandlerReleaseMulti(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	ticketA, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+	ticketB, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+	missing := ticketB.Id() + 1000
+
+	resp := f.Request("DELETE", "/test", url.Values{
+		"id": []string{fmt.Sprintf("%d", ticketA.Id()), fmt.Sprintf("%d", ticketB.Id()), fmt.Sprintf("%d", missing)},
+	})
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status code 200, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Released map[string]bool `json:"released"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+
+	expected := map[string]bool{
+		fmt.Sprintf("%d", ticketA.Id()): true,
+		fmt.Sprintf("%d", ticketB.Id()): true,
+		fmt.Sprintf("%d", missing):      false,
+	}
+	if fmt.Sprint(body.Released) != fmt.Sprint(expected) {
+		t.Fatalf("Expected %v to be released, got %v", expected, body.Released)
+	}
+
+	lockers, err := f.Manager.IsLocked("test")
+	if len(lockers) != 0 || err != nil {
 		t.Fatalf("Unexpected state after releasing")
 	}
+
+	// Test that every ID must be valid.
+	resp = f.Request("DELETE", "/test", url.Values{"id": []string{fmt.Sprintf("%d", missing), "abc"}})
+	AssertErrorResponse(t, resp, "invalid_id", 400)
+}
+
+func TestHandlerHeartbeat(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	ticketA, _ := f.Manager.Acquire("a", time.Minute, time.Second)
+	ticketB, _ := f.Manager.Acquire("b", time.Minute, time.Second)
+
+	resp := f.RequestJson("POST", "/?heartbeat=true", []interface{}{
+		map[string]interface{}{"path": "a", "id": fmt.Sprintf("%d", ticketA.Id()), "lease_timeout": "1m"},
+		map[string]interface{}{"path": "b", "id": ticketB.Id(), "lease_timeout": "1m"},
+		map[string]interface{}{"path": "b", "id": ticketB.Id() + 1000, "lease_timeout": "1m"},
+		map[string]interface{}{"path": "b", "id": "abc", "lease_timeout": "1m"},
+		map[string]interface{}{"path": "b", "id": ticketB.Id(), "lease_timeout": "1x"},
+		map[string]interface{}{"path": "a/../b", "id": ticketB.Id(), "lease_timeout": "1m"},
+	})
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status code 200, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Leases []struct {
+			Path    string `json:"path"`
+			Id      string `json:"id"`
+			Found   bool   `json:"found"`
+			Changed bool   `json:"changed"`
+			Code    string `json:"code"`
+		} `json:"leases"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+
+	expected := []string{"a true true ", "b true true ", "b false false not_found", "b false false invalid_id",
+		"b false false invalid_lease_timeout", "a/../b false false invalid_path"}
+	if len(body.Leases) != len(expected) {
+		t.Fatalf("Expected %d leases, got %+v", len(expected), body.Leases)
+	}
+	for idx, lease := range body.Leases {
+		if result := fmt.Sprintf("%s %t %t %s", lease.Path, lease.Found, lease.Changed, lease.Code); result != expected[idx] {
+			t.Errorf("Expected lease #%d to be %q, got %q", idx+1, expected[idx], result)
+		}
+	}
+	if body.Leases[0].Id != fmt.Sprintf("%d", ticketA.Id()) || body.Leases[1].Id != fmt.Sprintf("%d", ticketB.Id()) {
+		t.Errorf("Unexpected IDs %+v", body.Leases)
+	}
+
+	state, _ := f.Manager.Inspect("b")
+	if state.LockTimeout <= time.Second {
+		t.Fatalf("Expected lease to be extended, got %v", state.LockTimeout)
+	}
+
+	// Test that the body must list leases.
+	AssertErrorResponse(t, f.RequestJson("POST", "/?heartbeat=true", []interface{}{}), "missing_leases", 400)
+	AssertErrorResponse(t, f.RequestJson("POST", "/?heartbeat=true", map[string]interface{}{}), "invalid_body", 400)
+}
+
+func TestHandlerReleaseByOwner(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	f.Manager.Acquire("a", time.Minute, time.Minute, locking.AcquireOptions{Owner: "worker"})
+	f.Manager.Acquire("b", time.Minute, time.Minute, locking.AcquireOptions{Owner: "worker"})
+	ticket, _ := f.Manager.Acquire("c", time.Minute, time.Minute, locking.AcquireOptions{Owner: "other"})
+
+	resp := f.Request("DELETE", "/", url.Values{"owner": []string{"worker"}})
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status code 200, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Released int `json:"released"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+	if body.Released != 2 {
+		t.Fatalf("Expected 2 tickets to be released, got %d", body.Released)
+	}
+
+	for path, expected := range map[string]int64{"a": 0, "b": 0, "c": ticket.Id()} {
+		lockers, _ := f.Manager.IsLocked(path)
+		if expected == 0 && len(lockers) != 0 || expected != 0 && (len(lockers) != 1 || lockers[0] != expected) {
+			t.Fatalf("Unexpected lockers of %s after releasing: %v", path, lockers)
+		}
+	}
+
+	// Test that the owner is required.
+	AssertErrorResponse(t, f.Request("DELETE", "/", nil), "missing_owner", 400)
 }
 
 func TestHandlerExtendInvalid(t *testing.T) {
@@ -236,7 +2078,7 @@ func TestHandlerExtendInvalid(t *testing.T) {
 			Path:   "/test",
 			Params: url.Values{
 				"id":            []string{"123"},
-				"lease_timeout": []string{"1d"},
+				"lease_timeout": []string{"1x"},
 			},
 			ExpectedCode:       "invalid_lease_timeout",
 			ExpectedStatusCode: 400,
@@ -279,24 +2121,148 @@ func TestHandlerExtendInvalid(t *testing.T) {
 	})
 }
 
-func TestHandlerExtendLocker(t *testing.T) {
+func TestHandlerExtendLocker(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	// Acquire a ticket.
+	ticket, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+	state, _ := f.Manager.Inspect("test")
+
+	// Test extending with ID that is not the locker.
+	resp := f.Request("PATCH", "/test", url.Values{
+		"id":            []string{fmt.Sprintf("%d", ticket.Id())},
+		"lease_timeout": []string{"5m"},
+	})
+	AssertSuccessResponse(t, resp)
+
+	newState, _ := f.Manager.Inspect("test")
+	if newState.LockingId != ticket.Id() || newState.LockTimeout <= state.LockTimeout {
+		t.Fatalf("Unexpected state after releasing")
+	}
+}
+
+func TestHandlerExtendConditional(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	ticket, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	// Test extending while the lease remains for longer than the threshold.
+	resp := f.Request("PATCH", "/test", url.Values{
+		"id":                  []string{fmt.Sprintf("%d", ticket.Id())},
+		"lease_timeout":       []string{"5m"},
+		"if_lease_timeout_gt": []string{"30s"},
+	})
+	if body := AssertSuccessResponse(t, resp); !body.Changed {
+		t.Fatalf("Expected lease to be changed")
+	}
+
+	// Test that the extension fails when the lease does not remain for long enough.
+	resp = f.Request("PATCH", "/test", url.Values{
+		"id":                  []string{fmt.Sprintf("%d", ticket.Id())},
+		"lease_timeout":       []string{"1h"},
+		"if_lease_timeout_gt": []string{"10m"},
+	})
+	AssertErrorResponse(t, resp, "precondition_failed", 412)
+
+	resp = f.Request("PATCH", "/test", url.Values{
+		"id":                  []string{fmt.Sprintf("%d", ticket.Id())},
+		"lease_timeout":       []string{"1h"},
+		"if_lease_timeout_gt": []string{"invalid"},
+	})
+	AssertErrorResponse(t, resp, "invalid_if_lease_timeout_gt", 400)
+
+	if state, _ := f.Manager.Inspect("test"); state.LockTimeout > 5*time.Minute {
+		t.Fatalf("Expected lease not to be extended, got %s", state.LockTimeout)
+	}
+}
+
+func TestHandlerShortenLocker(t *testing.T) {
 	f := NewHandlerFixture(t)
 	defer f.Close()
 
 	// Acquire a ticket.
-	ticket, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+	ticket, _ := f.Manager.Acquire("test", time.Minute, 5*time.Minute)
 	state, _ := f.Manager.Inspect("test")
 
-	// Test extending with ID that is not the locker.
+	// Test extending by less than the remaining lease.
 	resp := f.Request("PATCH", "/test", url.Values{
 		"id":            []string{fmt.Sprintf("%d", ticket.Id())},
-		"lease_timeout": []string{"5m"},
+		"lease_timeout": []string{"1m"},
 	})
-	AssertSuccessResponse(t, resp)
+	body := AssertSuccessResponse(t, resp)
+
+	if body.Changed {
+		t.Fatalf("Expected lease to be unchanged")
+	}
 
 	newState, _ := f.Manager.Inspect("test")
-	if newState.LockingId != ticket.Id() || newState.LockTimeout <= state.LockTimeout {
-		t.Fatalf("Unexpected state after releasing")
+	if newState.LockTimeout > state.LockTimeout || newState.LockTimeout < 4*time.Minute {
+		t.Fatalf("Unexpected state after extending")
+	}
+
+	// Test shortening.
+	resp = f.Request("PATCH", "/test", url.Values{
+		"id":            []string{fmt.Sprintf("%d", ticket.Id())},
+		"lease_timeout": []string{"1m"},
+		"shorten":       []string{"true"},
+	})
+	body = AssertSuccessResponse(t, resp)
+
+	if !body.Changed {
+		t.Fatalf("Expected lease to be changed")
+	}
+
+	newState, _ = f.Manager.Inspect("test")
+	if newState.LockingId != ticket.Id() || newState.LockTimeout > time.Minute {
+		t.Fatalf("Unexpected state after shortening")
+	}
+}
+
+func TestHandlerInspectETag(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	ticket, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	inspect := func(ifNoneMatch string) *http.Response {
+		req, _ := http.NewRequest("GET", f.server.URL+"/test", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		resp, err := f.server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Error performing request: %v", err)
+		}
+
+		return resp
+	}
+
+	resp := inspect("")
+	AssertSuccessResponse(t, resp)
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatalf("Expected ETag")
+	}
+
+	// Test that the body is spared while the state is unchanged.
+	for _, ifNoneMatch := range []string{etag, `"0", ` + etag, "W/" + etag, "*"} {
+		if resp := inspect(ifNoneMatch); resp.StatusCode != 304 || resp.Header.Get("ETag") != etag {
+			t.Fatalf("Expected status code 304 for %s, got %d", ifNoneMatch, resp.StatusCode)
+		}
+	}
+
+	// Test that the body is served once the state changes.
+	f.Manager.Extend("test", ticket.Id(), time.Hour)
+
+	resp = inspect(etag)
+	AssertSuccessResponse(t, resp)
+
+	if resp.Header.Get("ETag") == etag {
+		t.Fatalf("Expected ETag to change")
 	}
 }
 
@@ -344,6 +2310,18 @@ func TestHandlerInspectLocked(t *testing.T) {
 	if body.LockTimeout == "" || body.LockTimeout == "0" {
 		t.Fatalf("Unxpected lock timeout: %s", body.LockTimeout)
 	}
+	if body.HeldFor == "" || body.HeldFor != body.Holders[0].HeldFor {
+		t.Fatalf("Unexpected holding duration: %s", body.HeldFor)
+	}
+
+	heldSince, err := time.Parse(time.RFC3339Nano, body.HeldSince)
+	if err != nil || body.HeldSince != body.Holders[0].HeldSince || time.Since(heldSince) > time.Minute {
+		t.Fatalf("Unexpected holding start: %s", body.HeldSince)
+	}
+	expiresAt, err := time.Parse(time.RFC3339Nano, body.ExpiresAt)
+	if err != nil || body.ExpiresAt != body.Holders[0].ExpiresAt || !expiresAt.After(heldSince) {
+		t.Fatalf("Unexpected lease expiry: %s", body.ExpiresAt)
+	}
 
 	if len(body.Acquirers) != 2 {
 		t.Fatalf("Expected 2 acquirers in response")
@@ -362,6 +2340,344 @@ func TestHandlerInspectLocked(t *testing.T) {
 	if body.Acquirers[1].Timeout == "" || body.Acquirers[1].Timeout == "0" {
 		t.Fatalf("Unxpected acquirer #2 timeout: %s", body.Acquirers[1].Timeout)
 	}
+	for idx, acquirer := range body.Acquirers {
+		if acquirer.WaitingFor == "" {
+			t.Fatalf("Expected acquirer #%d waiting duration", idx+1)
+		}
+	}
+}
+
+func TestHandlerInspectAcquirersLimit(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	f.Manager.Acquire("test", time.Minute, time.Minute)
+	ticketB, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+	f.Manager.Acquire("test", time.Minute, time.Minute)
+	f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	// Test that only the first acquirers are included, along with the total.
+	resp := f.Request("GET", "/test", url.Values{"acquirers_limit": []string{"2"}})
+	body := AssertSuccessResponse(t, resp)
+
+	if len(body.Acquirers) != 2 || body.Acquirers[0].Id != fmt.Sprintf("%d", ticketB.Id()) || body.AcquirersTotal != 3 {
+		t.Fatalf("Expected 2 of 3 acquirers starting with %d, got %+v", ticketB.Id(), body)
+	}
+
+	// Test that all acquirers are included by default.
+	resp = f.Request("GET", "/test", nil)
+	if body = AssertSuccessResponse(t, resp); len(body.Acquirers) != 3 || body.AcquirersTotal != 3 {
+		t.Fatalf("Expected all 3 acquirers, got %+v", body)
+	}
+
+	// Test invalid limits.
+	for _, limit := range []string{"0", "-1", "a"} {
+		resp = f.Request("GET", "/test", url.Values{"acquirers_limit": []string{limit}})
+		AssertErrorResponse(t, resp, "invalid_acquirers_limit", 400)
+	}
+}
+
+func TestHandlerNumericJSON(t *testing.T) {
+	f := NewHandlerFixtureWithOptions(t, locking.Config{}, HandlerOptions{NumericJSON: true})
+	defer f.Close()
+
+	type numericState struct {
+		LockingId   int64 `json:"locking_id"`
+		LockTimeout int64 `json:"lock_timeout"`
+		Fence       int64 `json:"fence"`
+		HeldFor     int64 `json:"held_for"`
+		Acquirers   []struct {
+			Id         int64 `json:"id"`
+			Timeout    int64 `json:"timeout"`
+			WaitingFor int64 `json:"waiting_for"`
+		} `json:"acquirers"`
+	}
+
+	decode := func(resp *http.Response, body interface{}) {
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expected status code %d, got %d", 200, resp.StatusCode)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+			t.Fatalf("Error decoding response body: %v", err)
+		}
+	}
+
+	// Test that acquisitions respond with numeric IDs and fencing tokens.
+	var acquired struct {
+		Id    int64 `json:"id"`
+		Fence int64 `json:"fence"`
+	}
+	decode(f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	}), &acquired)
+
+	if acquired.Id == 0 || acquired.Fence == 0 {
+		t.Fatalf("Expected numeric ID and fence, got %+v", acquired)
+	}
+
+	ticket, _ := f.Manager.Acquire("test", time.Minute, locking.InfiniteTimeout)
+
+	// Test that inspecting a lock responds with numeric IDs and durations in milliseconds.
+	var state numericState
+	decode(f.Request("GET", "/test", nil), &state)
+
+	if state.LockingId != acquired.Id || state.Fence != acquired.Fence {
+		t.Fatalf("Expected lock to be held by %d with fence %d, got %+v", acquired.Id, acquired.Fence, state)
+	}
+	if state.LockTimeout <= 59000 || state.LockTimeout > 60000 || state.HeldFor <= 0 {
+		t.Fatalf("Expected durations in milliseconds, got %+v", state)
+	}
+	if len(state.Acquirers) != 1 || state.Acquirers[0].Id != ticket.Id() || state.Acquirers[0].Timeout <= 59000 {
+		t.Fatalf("Expected acquirer %d, got %+v", ticket.Id(), state.Acquirers)
+	}
+
+	// Test that inspecting all locks honors the mode.
+	var states map[string]numericState
+	decode(f.Request("GET", "/", nil), &states)
+
+	if states["test"].LockingId != acquired.Id || states["test"].Acquirers[0].WaitingFor <= 0 {
+		t.Fatalf("Expected lock to be held by %d, got %+v", acquired.Id, states)
+	}
+
+	// Test that infinite lease timeouts are formatted as -1.
+	f.Manager.Release("test", acquired.Id)
+	decode(f.Request("GET", "/test", nil), &state)
+
+	if state.LockingId != ticket.Id() || state.LockTimeout != -1 {
+		t.Fatalf("Expected infinite lease timeout, got %+v", state)
+	}
+}
+
+func TestHandlerUUIDStrategy(t *testing.T) {
+	f := NewHandlerFixtureWithOptions(t, locking.Config{IDStrategy: locking.IDStrategyUUID}, HandlerOptions{IDStrategy: locking.IDStrategyUUID})
+	defer f.Close()
+
+	// Test that acquisitions respond with UUIDs of their IDs.
+	acquired := AssertSuccessResponse(t, f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	}))
+
+	id, err := locking.ParseExternalId(acquired.Id)
+	if err != nil || !strings.Contains(acquired.Id, "-") {
+		t.Fatalf("Expected UUID, got %q", acquired.Id)
+	}
+
+	// Test that inspections respond with UUIDs, while fencing tokens remain integers.
+	state := AssertSuccessResponse(t, f.Request("GET", "/test", nil))
+	if state.LockingId != acquired.Id || state.Fence != acquired.Fence || strings.Contains(state.Fence, "-") {
+		t.Fatalf("Expected lock held by %q with fence %q, got %+v", acquired.Id, acquired.Fence, state)
+	}
+
+	// Test that tickets are addressed by their UUIDs as well as their IDs in base 10.
+	AssertSuccessResponse(t, f.Request("PATCH", "/test", url.Values{
+		"id":            []string{acquired.Id},
+		"lease_timeout": []string{"2m"},
+	}))
+	AssertSuccessResponse(t, f.Request("DELETE", "/test", url.Values{
+		"id": []string{strconv.FormatInt(id, 10)},
+	}))
+
+	// Test that malformed UUIDs are refused.
+	AssertErrorResponse(t, f.Request("DELETE", "/test", url.Values{
+		"id": []string{strings.Replace(acquired.Id, "-8", "-4", 1)},
+	}), "invalid_id", 400)
+}
+
+func TestHandlerInspectPattern(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	ticketA, _ := f.Manager.Acquire("jobs/2024/a", time.Minute, time.Minute)
+	f.Manager.Acquire("jobs/2024/b", time.Minute, time.Minute)
+	f.Manager.Acquire("jobs/2025/a", time.Minute, time.Minute)
+
+	for pattern, expectedCount := range map[string]int{
+		"/jobs/2023/*": 0,
+		"/jobs/2025/*": 1,
+		"/jobs/2024/*": 2,
+		"/jobs/*":      3,
+	} {
+		resp := f.Request("GET", pattern, nil)
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expected status code %d, got %d", 200, resp.StatusCode)
+		}
+
+		var body InspectAllResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Error decoding response body: %v", err)
+		}
+
+		if len(body) != expectedCount {
+			t.Fatalf("Expected %s to match %d locks, got %v", pattern, expectedCount, body)
+		}
+		if expectedCount == 2 && body["jobs/2024/a"].LockingId != fmt.Sprintf("%d", ticketA.Id()) {
+			t.Fatalf("Expected jobs/2024/a to be held by %d, got %v", ticketA.Id(), body)
+		}
+	}
+
+	// Test that invalid patterns and acquisitions of patterns are rejected.
+	AssertErrorResponse(t, f.Request("GET", "/jobs/*/a", nil), "not_found", 404)
+
+	resp := f.Request("POST", "/jobs/*", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	})
+	AssertErrorResponse(t, resp, "not_found", 404)
+}
+
+func TestHandlerInspectWatch(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resp, err := f.RequestContext(ctx, "GET", "/test", url.Values{"watch": []string{"true"}})
+	if err != nil {
+		t.Fatalf("Failed to watch lock: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected event stream, got %s", resp.Header.Get("Content-Type"))
+	}
+
+	nextEvent := NewEventReader(t, resp.Body)
+
+	// Test that the current state is streamed initially.
+	if event, _ := nextEvent(); event != "unlocked" {
+		t.Fatalf("Expected unlocked event, got %s", event)
+	}
+
+	// Test that changes are streamed.
+	ticketA, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	if event, body := nextEvent(); event != "locked" || body.LockingId != fmt.Sprintf("%d", ticketA.Id()) {
+		t.Fatalf("Expected locked event for %d, got %s %v", ticketA.Id(), event, body)
+	}
+
+	f.Manager.Release("test", ticketA.Id())
+
+	if event, _ := nextEvent(); event != "unlocked" {
+		t.Fatalf("Expected unlocked event, got %s", event)
+	}
+}
+
+func TestHandlerQueuePosition(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	f.Manager.Acquire("test", time.Minute, time.Minute)
+	waiting, _ := f.Manager.Acquire("test", time.Minute, time.Minute)
+
+	resp := f.Request("GET", "/test", url.Values{"position": []string{fmt.Sprintf("%d", waiting.Id())}})
+	if body := AssertSuccessResponse(t, resp); body.Position != 1 {
+		t.Fatalf("Expected position 1, got %d", body.Position)
+	}
+
+	resp = f.Request("GET", "/test", url.Values{"position": []string{fmt.Sprintf("%d", waiting.Id()+1)}})
+	AssertErrorResponse(t, resp, "not_found", 404)
+
+	resp = f.Request("GET", "/test", url.Values{"position": []string{"invalid"}})
+	AssertErrorResponse(t, resp, "invalid_id", 400)
+}
+
+func TestHandlerHistory(t *testing.T) {
+	f := NewHandlerFixtureWithConfig(t, locking.Config{AuditHistorySize: 10})
+	defer f.Close()
+
+	ticket, _ := f.Manager.Acquire("test", time.Minute, time.Minute, locking.AcquireOptions{Owner: "worker"})
+	f.Manager.Extend("test", ticket.Id(), time.Hour)
+	f.Manager.Release("test", ticket.Id())
+
+	resp := f.Request("GET", "/test", url.Values{"history": []string{"true"}})
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status code 200, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		History []struct {
+			Event        string `json:"event"`
+			Time         string `json:"time"`
+			Id           string `json:"id"`
+			Owner        string `json:"owner"`
+			Fence        string `json:"fence"`
+			LeaseTimeout string `json:"lease_timeout"`
+		} `json:"history"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Error decoding response body: %v", err)
+	}
+
+	if len(body.History) != 3 {
+		t.Fatalf("Expected 3 events, got %v", body.History)
+	}
+	for idx, event := range []string{"acquired", "extended", "released"} {
+		entry := body.History[idx]
+		if entry.Event != event || entry.Id != fmt.Sprintf("%d", ticket.Id()) || entry.Owner != "worker" || entry.Time == "" {
+			t.Fatalf("Expected event #%d to be %s, got %+v", idx+1, event, entry)
+		}
+	}
+	if body.History[0].Fence != fmt.Sprintf("%d", ticket.Fence()) || body.History[1].LeaseTimeout != "1h" {
+		t.Fatalf("Unexpected events %+v", body.History)
+	}
+
+	// Test that the history of an unknown path is empty.
+	resp = f.Request("GET", "/other", url.Values{"history": []string{"true"}})
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status code 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandlerDeadlocks(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	ownerA := locking.AcquireOptions{Owner: "worker-a"}
+	ownerB := locking.AcquireOptions{Owner: "worker-b"}
+
+	f.Manager.Acquire("a", time.Minute, time.Minute, ownerA)
+	f.Manager.Acquire("b", time.Minute, time.Minute, ownerB)
+	ticketA, _ := f.Manager.Acquire("b", time.Minute, time.Minute, ownerA)
+	ticketB, _ := f.Manager.Acquire("a", time.Minute, time.Minute, ownerB)
+
+	// Test listing deadlocks.
+	resp := f.Request("GET", "/", url.Values{"deadlocks": []string{"true"}})
+
+	var body struct {
+		Deadlocks [][]string `json:"deadlocks"`
+	}
+	if resp.StatusCode != 200 || json.NewDecoder(resp.Body).Decode(&body) != nil {
+		t.Fatalf("Expected deadlocks, got status code %d", resp.StatusCode)
+	}
+
+	expected := [][]string{{fmt.Sprintf("%d", ticketA.Id()), fmt.Sprintf("%d", ticketB.Id())}}
+	if fmt.Sprint(body.Deadlocks) != fmt.Sprint(expected) {
+		t.Fatalf("Expected deadlocks %v, got %v", expected, body.Deadlocks)
+	}
+}
+
+func TestHandlerAcquireDraining(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	f.Manager.Drain(context.Background())
+
+	// Test that acquisitions are refused while draining.
+	AssertErrors(f, []ErrorFixture{
+		{
+			Method: "POST",
+			Path:   "/test",
+			Params: url.Values{
+				"lock_timeout":  []string{"1m"},
+				"lease_timeout": []string{"1m"},
+			},
+			ExpectedCode:       "draining",
+			ExpectedStatusCode: 503,
+		},
+	})
 }
 
 func TestHandlerInspectAll(t *testing.T) {
@@ -443,6 +2759,156 @@ func TestHandlerInspectAll(t *testing.T) {
 	}
 }
 
+func TestHandlerInspectAllArray(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	AssertErrors(f, []ErrorFixture{
+		{
+			Method: "GET",
+			Path:   "/",
+			Params: url.Values{
+				"format": []string{"list"},
+			},
+			ExpectedCode:       "invalid_format",
+			ExpectedStatusCode: 400,
+		},
+
+		{
+			Method: "GET",
+			Path:   "/",
+			Params: url.Values{
+				"format": []string{"array"},
+				"sort":   []string{"age"},
+			},
+			ExpectedCode:       "invalid_sort",
+			ExpectedStatusCode: 400,
+		},
+	})
+
+	// Acquire locks with varying queue depths.
+	ticketA, _ := f.Manager.Acquire("a", time.Minute, time.Minute)
+	ticketB, _ := f.Manager.Acquire("b", time.Minute, time.Minute)
+	f.Manager.Acquire("b", time.Minute, time.Minute)
+	ticketC, _ := f.Manager.Acquire("c", time.Minute, time.Minute)
+	f.Manager.Acquire("c", time.Minute, time.Minute)
+	f.Manager.Acquire("c", time.Minute, time.Minute)
+
+	for _, fix := range []struct {
+		Sort          string
+		ExpectedPaths []string
+		ExpectedIds   []int64
+	}{
+		{"", []string{"a", "b", "c"}, []int64{ticketA.Id(), ticketB.Id(), ticketC.Id()}},
+		{"path", []string{"a", "b", "c"}, []int64{ticketA.Id(), ticketB.Id(), ticketC.Id()}},
+		{"queue_depth", []string{"c", "b", "a"}, []int64{ticketC.Id(), ticketB.Id(), ticketA.Id()}},
+	} {
+		resp := f.Request("GET", "/", url.Values{
+			"format": []string{"array"},
+			"sort":   []string{fix.Sort},
+		})
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expected status code %d, got %d", 200, resp.StatusCode)
+		}
+
+		var body InspectAllArrayResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Error decoding response body: %v", err)
+		}
+
+		if len(body) != len(fix.ExpectedPaths) {
+			t.Fatalf("Expected %d locks to be returned, got %d", len(fix.ExpectedPaths), len(body))
+		}
+
+		for idx, lock := range body {
+			if lock.Path != fix.ExpectedPaths[idx] {
+				t.Fatalf("Expected lock #%d to be %s, but it is %s", idx+1, fix.ExpectedPaths[idx], lock.Path)
+			}
+			if lock.LockingId != fmt.Sprintf("%d", fix.ExpectedIds[idx]) {
+				t.Fatalf("Expected locking ID to be %d, but it is %s", fix.ExpectedIds[idx], lock.LockingId)
+			}
+		}
+	}
+}
+
+func TestHandlerInspectAllPaginated(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	AssertErrors(f, []ErrorFixture{
+		{
+			Method: "GET",
+			Path:   "/",
+			Params: url.Values{
+				"limit": []string{"0"},
+			},
+			ExpectedCode:       "invalid_limit",
+			ExpectedStatusCode: 400,
+		},
+	})
+
+	// Acquire locks, of which a/2 is contended.
+	f.Manager.Acquire("a/1", time.Minute, time.Minute)
+	f.Manager.Acquire("a/2", time.Minute, time.Minute)
+	f.Manager.Acquire("a/2", time.Minute, time.Minute)
+	f.Manager.Acquire("a/3", time.Minute, time.Minute)
+	f.Manager.Acquire("b/1", time.Minute, time.Minute)
+
+	inspect := func(params url.Values) InspectAllPageResponse {
+		resp := f.Request("GET", "/", params)
+		if resp.StatusCode != 200 {
+			t.Fatalf("Expected status code %d, got %d", 200, resp.StatusCode)
+		}
+
+		var body InspectAllPageResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Error decoding response body: %v", err)
+		}
+
+		return body
+	}
+
+	// Test paginating by prefix.
+	body := inspect(url.Values{
+		"prefix": []string{"a/"},
+		"limit":  []string{"2"},
+	})
+	if len(body.Locks) != 2 || body.Locks["a/1"].LockingId == "" || body.Locks["a/2"].LockingId == "" {
+		t.Fatalf("Expected a/1 and a/2 to be returned, got %v", body.Locks)
+	}
+	if body.NextCursor != "a/2" {
+		t.Fatalf("Expected next cursor to be a/2, got %q", body.NextCursor)
+	}
+
+	body = inspect(url.Values{
+		"prefix": []string{"a/"},
+		"limit":  []string{"2"},
+		"cursor": []string{body.NextCursor},
+	})
+	if len(body.Locks) != 1 || body.Locks["a/3"].LockingId == "" || body.NextCursor != "" {
+		t.Fatalf("Expected only a/3 to be returned, got %v, %q", body.Locks, body.NextCursor)
+	}
+
+	// Test filtering to contended locks.
+	body = inspect(url.Values{
+		"limit":     []string{"10"},
+		"held_only": []string{"true"},
+	})
+	if len(body.Locks) != 1 || len(body.Locks["a/2"].Acquirers) != 1 {
+		t.Fatalf("Expected only a/2 to be returned, got %v", body.Locks)
+	}
+
+	// Test that filtering without a limit retains the plain format.
+	resp := f.Request("GET", "/", url.Values{
+		"prefix": []string{"b/"},
+	})
+
+	var all InspectAllResponse
+	if err := json.NewDecoder(resp.Body).Decode(&all); err != nil || len(all) != 1 || all["b/1"].LockingId == "" {
+		t.Fatalf("Expected only b/1 to be returned, got %v, %v", all, err)
+	}
+}
+
 func AssertErrorResponse(t *testing.T, resp *http.Response, code string, statusCode int) {
 	if resp.StatusCode != statusCode {
 		t.Fatalf("Expected status code %d, got %d", statusCode, resp.StatusCode)
@@ -477,5 +2943,109 @@ func AssertErrors(f *HandlerFixture, fixtures []ErrorFixture) {
 	for _, fix := range fixtures {
 		resp := f.Request(fix.Method, fix.Path, fix.Params)
 		AssertErrorResponse(f.t, resp, fix.ExpectedCode, fix.ExpectedStatusCode)
+
+		// Assert that the error is identical for JSON bodies.
+		if fix.Method != "GET" {
+			body := make(map[string]string, len(fix.Params))
+			for key := range fix.Params {
+				body[key] = fix.Params.Get(key)
+			}
+
+			resp = f.RequestJson(fix.Method, fix.Path, body)
+			AssertErrorResponse(f.t, resp, fix.ExpectedCode, fix.ExpectedStatusCode)
+		}
+	}
+}
+
+func TestHandlerRequestID(t *testing.T) {
+	manager, _ := locking.NewManager(locking.Config{})
+	handler := NewRequestIDHandler(NewAuthHandler(NewHandler(manager), AuthConfig{Token: "token"}))
+
+	requestIDs := make(map[string]bool)
+
+	for _, fixture := range []struct {
+		Method             string
+		Path               string
+		Authorization      string
+		ExpectedStatusCode int
+	}{
+		{"GET", "/a", "", 401},
+		{"GET", "/", "Bearer token", 200},
+		{"DELETE", "/a?id=1", "Bearer token", 404},
+	} {
+		req := httptest.NewRequest(fixture.Method, fixture.Path, nil)
+		if fixture.Authorization != "" {
+			req.Header.Set("Authorization", fixture.Authorization)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != fixture.ExpectedStatusCode {
+			t.Fatalf("Expected status code %d for %+v, got %d", fixture.ExpectedStatusCode, fixture, resp.Code)
+		}
+
+		// Assert that every response is assigned a unique request ID.
+		requestID := resp.Header().Get("X-Request-Id")
+		if requestID == "" || requestIDs[requestID] {
+			t.Fatalf("Expected unique request ID for %+v, got %q", fixture, requestID)
+		}
+		requestIDs[requestID] = true
+
+		// Assert that error responses include the request ID.
+		if resp.Code >= 400 {
+			var body struct {
+				RequestID string `json:"request_id"`
+			}
+			json.NewDecoder(resp.Body).Decode(&body)
+
+			if body.RequestID != requestID {
+				t.Fatalf("Expected request ID %q in error body for %+v, got %q", requestID, fixture, body.RequestID)
+			}
+		}
+	}
+}
+
+// Response writer transforming the body by appending a newline to every write.
+type newlineWriter struct {
+	http.ResponseWriter
+}
+
+func (w newlineWriter) Write(data []byte) (int, error) {
+	if _, err := w.ResponseWriter.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func TestHandlerWrappedResponseWriter(t *testing.T) {
+	manager, _ := locking.NewManager(locking.Config{})
+	handler := NewHandler(manager)
+
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		handler.ServeHTTP(newlineWriter{resp}, req)
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/", "/missing"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Error performing request: %v", err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		// Assert that the content length, if any, matches the transformed body, which is received in its entirety.
+		if err != nil {
+			t.Fatalf("Error reading response of %s: %v", path, err)
+		}
+		if resp.ContentLength >= 0 && resp.ContentLength != int64(len(body)) {
+			t.Fatalf("Expected content length %d of %s, got %d", len(body), path, resp.ContentLength)
+		}
+		if !strings.HasSuffix(string(body), "}\n") || !json.Valid(body) {
+			t.Fatalf("Expected transformed JSON body of %s, got %q", path, body)
+		}
 	}
 }
@@ -0,0 +1,65 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Escape a Prometheus label value.
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Serve metrics.
+//
+// Responds with the hold histograms of the manager in the Prometheus text exposition format, as the
+// lockerd_hold_seconds histogram, labeled by path or namespace if configured. No histograms are exposed if they are
+// disabled.
+func (h *handler) serveMetrics(resp http.ResponseWriter, req *http.Request) error {
+	var b strings.Builder
+
+	histograms := h.manager.HoldHistograms()
+	if histograms != nil {
+		b.WriteString("# HELP lockerd_hold_seconds Durations locks were held for until released or expired.\n")
+		b.WriteString("# TYPE lockerd_hold_seconds histogram\n")
+	}
+
+	for _, histogram := range histograms {
+		labels := ""
+		if histogram.LabelName != "" {
+			labels = fmt.Sprintf(`%s="%s"`, histogram.LabelName, prometheusLabelEscaper.Replace(histogram.Label))
+		}
+
+		for idx, bound := range histogram.Buckets {
+			fmt.Fprintf(&b, "lockerd_hold_seconds_bucket{%s} %d\n", joinLabels(labels, `le="`+formatSeconds(bound)+`"`), histogram.Counts[idx])
+		}
+		fmt.Fprintf(&b, "lockerd_hold_seconds_bucket{%s} %d\n", joinLabels(labels, `le="+Inf"`), histogram.Count)
+
+		if labels != "" {
+			labels = "{" + labels + "}"
+		}
+		fmt.Fprintf(&b, "lockerd_hold_seconds_sum%s %s\n", labels, formatSeconds(histogram.Sum))
+		fmt.Fprintf(&b, "lockerd_hold_seconds_count%s %d\n", labels, histogram.Count)
+	}
+
+	resp.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	resp.WriteHeader(200)
+	_, err := resp.Write([]byte(b.String()))
+
+	return err
+}
+
+// Join Prometheus labels.
+func joinLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+
+	return labels + "," + label
+}
+
+// Format a duration in seconds.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
@@ -0,0 +1,229 @@
+package httpserver
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Interval at which idle rate limiters are cleaned up.
+const rateLimiterCleanupInterval = time.Minute
+
+// Rate limit configuration.
+type RateLimitConfig struct {
+	// Sustained rate of requests per second.
+	//
+	// Must be positive, as no requests are let through after the initial burst otherwise.
+	Rate float64
+
+	// Maximum burst of requests.
+	//
+	// Defaults to the rate, rounded up, and at least one request.
+	Burst int
+
+	// Limit per path.
+	//
+	// If set, requests are limited per client and path, so a client exhausting its limit for a hot path can still
+	// reach other paths. Otherwise, requests are limited per client across all paths.
+	PerPath bool
+}
+
+// HTTP handler limiting the rate of requests.
+type rateLimitHandler struct {
+	handler http.Handler
+	limit   rate.Limit
+	burst   int
+	perPath bool
+
+	sync      sync.Mutex
+	limiters  map[string]*rateLimiter
+	cleanedAt time.Time
+}
+
+// Rate limiter of a client.
+type rateLimiter struct {
+	limiter *rate.Limiter
+	usedAt  time.Time
+}
+
+// New rate limiting handler.
+//
+// Wraps a handler, limiting the rate of requests by token buckets per client, which is the authenticated identity if
+// the handler is wrapped by an authentication handler, and otherwise the IP address of the client. Requests over the
+// limit are rejected with a 429 error and a Retry-After header. Every response carries the X-RateLimit-Remaining and
+// X-RateLimit-Reset headers, of the requests remaining and the seconds until the bucket is full again, and the quota
+// of the client is served at GET /?quota=true, without taking from it. Limiters that have been idle for long enough to refill their bucket are
+// cleaned up periodically.
+func NewRateLimitHandler(handler http.Handler, config RateLimitConfig) http.Handler {
+	burst := config.Burst
+	if burst <= 0 {
+		burst = max(int(math.Ceil(config.Rate)), 1)
+	}
+
+	return &rateLimitHandler{
+		handler:   handler,
+		limit:     rate.Limit(config.Rate),
+		burst:     burst,
+		perPath:   config.PerPath,
+		limiters:  make(map[string]*rateLimiter),
+		cleanedAt: time.Now(),
+	}
+}
+
+func (h *rateLimitHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	now := time.Now()
+
+	// The quota is read without taking from it. When limiting per path, it is the quota of the path given by the path
+	// parameter.
+	client := clientOf(req)
+	path := req.URL.Path
+	if req.Method == "GET" && path == "/" && req.URL.Query().Get("quota") == "true" {
+		path = "/" + strings.TrimLeft(req.URL.Query().Get("path"), "/")
+		remaining, reset := h.quotaOf(h.limiterOf(h.clientKey(client, path), now), now)
+		h.setQuotaHeaders(resp, remaining, reset)
+
+		respondJson(resp, map[string]interface{}{
+			"client": client,
+			"rate_limit": map[string]interface{}{
+				"rate":      float64(h.limit),
+				"burst":     h.burst,
+				"per_path":  h.perPath,
+				"remaining": remaining,
+				"reset":     FormatDuration(reset),
+			},
+		}, 200)
+		return
+	}
+
+	// Reserve a token, which is only taken if available right away.
+	limiter := h.limiterOf(h.clientKey(client, path), now)
+	reservation := limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+
+	allowed := reservation.OK() && delay == 0
+	if !allowed {
+		reservation.CancelAt(now)
+	}
+
+	remaining, reset := h.quotaOf(limiter, now)
+	h.setQuotaHeaders(resp, remaining, reset)
+
+	if allowed {
+		h.handler.ServeHTTP(resp, req)
+		return
+	}
+
+	if reservation.OK() && delay != rate.InfDuration {
+		resp.Header().Set("Retry-After", strconv.FormatInt(ceilSeconds(delay), 10))
+	}
+
+	respondError(resp, "rate_limited", "Rate limit exceeded", 429)
+}
+
+// Serve the quota of a client.
+//
+// Only reached if requests are not rate limited, as the quota is otherwise served by the rate limiting handler, so the
+// client is not subject to any limit.
+func (h *handler) serveQuota(resp http.ResponseWriter, req *http.Request) error {
+	return respondJson(resp, map[string]interface{}{
+		"client":     clientOf(req),
+		"rate_limit": nil,
+	}, 200)
+}
+
+// Client of a request.
+//
+// The client is the authenticated identity, or otherwise the IP address of the client.
+func clientOf(req *http.Request) string {
+	client, ok := authenticatedIdentity(req)
+	if !ok {
+		client, _, _ = net.SplitHostPort(req.RemoteAddr)
+		client = "ip:" + client
+	}
+
+	return client
+}
+
+// Key of the rate limiter of a client.
+//
+// Keyed by the client, and by the path if limiting per path.
+func (h *rateLimitHandler) clientKey(client string, path string) string {
+	if h.perPath {
+		return client + " " + path
+	}
+
+	return client
+}
+
+// Quota of a rate limiter.
+//
+// Returns the number of requests remaining without being limited, and the duration until the bucket is full again.
+func (h *rateLimitHandler) quotaOf(limiter *rate.Limiter, now time.Time) (int, time.Duration) {
+	tokens := limiter.TokensAt(now)
+
+	var reset time.Duration
+	if h.limit > 0 && tokens < float64(h.burst) {
+		reset = time.Duration((float64(h.burst) - tokens) / float64(h.limit) * float64(time.Second))
+	}
+
+	return max(int(math.Floor(tokens)), 0), reset
+}
+
+// Set the headers of the quota of a client.
+func (h *rateLimitHandler) setQuotaHeaders(resp http.ResponseWriter, remaining int, reset time.Duration) {
+	resp.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	resp.Header().Set("X-RateLimit-Reset", strconv.FormatInt(ceilSeconds(reset), 10))
+}
+
+// Seconds of a duration, rounded up.
+func ceilSeconds(dur time.Duration) int64 {
+	return int64((dur + time.Second - 1) / time.Second)
+}
+
+// Rate limiter of a client.
+//
+// Creates the limiter if necessary, and cleans up idle limiters if due.
+func (h *rateLimitHandler) limiterOf(key string, now time.Time) *rate.Limiter {
+	h.sync.Lock()
+	defer h.sync.Unlock()
+
+	if now.Sub(h.cleanedAt) >= rateLimiterCleanupInterval {
+		h.cleanup(now)
+	}
+
+	limiter, ok := h.limiters[key]
+	if !ok {
+		limiter = &rateLimiter{limiter: rate.NewLimiter(h.limit, h.burst)}
+		h.limiters[key] = limiter
+	}
+
+	limiter.usedAt = now
+
+	return limiter.limiter
+}
+
+// Clean up idle rate limiters.
+//
+// A limiter that has been idle for long enough to refill its bucket is indistinguishable from a new limiter, and can
+// thus be removed without loosening the limit. This assumes exclusive lock to the handler is provided during the
+// process.
+func (h *rateLimitHandler) cleanup(now time.Time) {
+	idle := rateLimiterCleanupInterval
+	if h.limit > 0 {
+		idle = max(idle, time.Duration(float64(h.burst)/float64(h.limit)*float64(time.Second)))
+	}
+
+	for key, limiter := range h.limiters {
+		if now.Sub(limiter.usedAt) >= idle {
+			delete(h.limiters, key)
+		}
+	}
+
+	h.cleanedAt = now
+}
@@ -0,0 +1,165 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRateLimitHandler(t *testing.T) {
+	ok := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(200)
+	})
+
+	request := func(handler http.Handler, path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// Test that requests beyond the burst are limited per client.
+	handler := NewRateLimitHandler(ok, RateLimitConfig{Rate: 0.5, Burst: 2})
+
+	for idx, expected := range []int{200, 200, 429} {
+		if resp := request(handler, "/a", "10.0.0.1:1234"); resp.Code != expected {
+			t.Fatalf("Expected request #%d to respond %d, got %d", idx+1, expected, resp.Code)
+		}
+	}
+
+	resp := request(handler, "/b", "10.0.0.1:5678")
+	if resp.Code != 429 || resp.Header().Get("Retry-After") != "2" {
+		t.Fatalf("Expected request to be limited for 2 seconds, got %d, %q", resp.Code, resp.Header().Get("Retry-After"))
+	}
+
+	if resp := request(handler, "/a", "10.0.0.2:1234"); resp.Code != 200 {
+		t.Fatalf("Expected other client not to be limited, got %d", resp.Code)
+	}
+
+	// Test that requests are limited per path if requested.
+	handler = NewRateLimitHandler(ok, RateLimitConfig{Rate: 0.5, Burst: 1, PerPath: true})
+
+	for path, expected := range map[string]int{"/a": 200, "/b": 200} {
+		if resp := request(handler, path, "10.0.0.1:1234"); resp.Code != expected {
+			t.Fatalf("Expected request of %s to respond %d, got %d", path, expected, resp.Code)
+		}
+	}
+	if resp := request(handler, "/a", "10.0.0.1:1234"); resp.Code != 429 {
+		t.Fatalf("Expected request to be limited, got %d", resp.Code)
+	}
+}
+
+func TestRateLimitHandlerAuthenticated(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+	handler := NewAuthHandler(NewRateLimitHandler(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(200)
+	}), RateLimitConfig{Rate: 0.5, Burst: 1}), AuthConfig{
+		Credentials: map[string][]byte{"a": hash, "b": hash},
+	})
+
+	// Test that authenticated clients are limited by their identity rather than their address.
+	for idx, fixture := range []struct {
+		User               string
+		ExpectedStatusCode int
+	}{
+		{"a", 200},
+		{"a", 429},
+		{"b", 200},
+	} {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.SetBasicAuth(fixture.User, "secret")
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != fixture.ExpectedStatusCode {
+			t.Fatalf("Expected request #%d to respond %d, got %d", idx+1, fixture.ExpectedStatusCode, resp.Code)
+		}
+	}
+}
+
+func TestRateLimitHandlerQuota(t *testing.T) {
+	ok := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(200)
+	})
+
+	request := func(handler http.Handler, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	quota := func(handler http.Handler, path string) map[string]interface{} {
+		resp := request(handler, path)
+		if resp.Code != 200 {
+			t.Fatalf("Expected status code %d, got %d", 200, resp.Code)
+		}
+
+		var body struct {
+			Client    string                 `json:"client"`
+			RateLimit map[string]interface{} `json:"rate_limit"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Error decoding response body: %v", err)
+		}
+		if body.Client != "ip:10.0.0.1" {
+			t.Fatalf("Expected client ip:10.0.0.1, got %q", body.Client)
+		}
+
+		return body.RateLimit
+	}
+
+	// Test that responses carry the remaining requests and the seconds until the bucket is full again.
+	handler := NewRateLimitHandler(ok, RateLimitConfig{Rate: 0.5, Burst: 3})
+
+	for idx, expected := range []struct {
+		StatusCode int
+		Remaining  string
+		Reset      string
+	}{
+		{200, "2", "2"},
+		{200, "1", "4"},
+		{200, "0", "6"},
+		{429, "0", "6"},
+	} {
+		resp := request(handler, "/a")
+		if resp.Code != expected.StatusCode || resp.Header().Get("X-RateLimit-Remaining") != expected.Remaining || resp.Header().Get("X-RateLimit-Reset") != expected.Reset {
+			t.Fatalf("Expected request #%d to respond %d with %s remaining and reset in %s, got %d with %q and %q", idx+1, expected.StatusCode, expected.Remaining, expected.Reset, resp.Code, resp.Header().Get("X-RateLimit-Remaining"), resp.Header().Get("X-RateLimit-Reset"))
+		}
+	}
+
+	// Test that the quota is served once exhausted.
+	if limit := quota(handler, "/?quota=true"); limit["remaining"] != 0.0 {
+		t.Fatalf("Expected no requests remaining, got %v", limit)
+	}
+
+	// Test that reading the quota does not take from it.
+	handler = NewRateLimitHandler(ok, RateLimitConfig{Rate: 0.5, Burst: 3})
+	request(handler, "/a")
+
+	for i := 0; i < 5; i++ {
+		if limit := quota(handler, "/?quota=true"); limit["rate"] != 0.5 || limit["burst"] != 3.0 || limit["per_path"] != false || limit["remaining"] != 2.0 || limit["reset"] != "2s" {
+			t.Fatalf("Expected 2 of 3 requests remaining at 0.5 per second, got %v", limit)
+		}
+	}
+
+	// Test that the quota is that of the requested path when limiting per path.
+	handler = NewRateLimitHandler(ok, RateLimitConfig{Rate: 0.5, Burst: 3, PerPath: true})
+	request(handler, "/a")
+
+	if limit := quota(handler, "/?quota=true&path=a"); limit["per_path"] != true || limit["remaining"] != 2.0 {
+		t.Fatalf("Expected 2 requests of /a remaining, got %v", limit)
+	}
+	if limit := quota(handler, "/?quota=true&path=b"); limit["remaining"] != 3.0 {
+		t.Fatalf("Expected 3 requests of /b remaining, got %v", limit)
+	}
+}
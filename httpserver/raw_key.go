@@ -0,0 +1,57 @@
+package httpserver
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"lockerd/locking"
+)
+
+const (
+	// Route of raw keys.
+	//
+	// Requests to the route address the lock of the raw key given by the X-Lock-Key header, while requests to
+	// subpaths of the route address the lock of the raw key given by the base64url encoded segment following it. The
+	// route is not a valid lock path under the default path pattern.
+	rawKeyRoute = "/~raw"
+
+	// Header of the raw key.
+	rawKeyHeader = "X-Lock-Key"
+)
+
+// Missing raw key.
+var errRawKeyMissing = errors.New("missing raw key")
+
+// Invalid raw key.
+var errRawKeyInvalid = errors.New("invalid raw key")
+
+// Resolve a raw key.
+//
+// Rewrites the path of requests to the raw key route to the lock path of the raw key, so the key is addressed like any
+// other lock path, see locking.RawKeyPath. Other requests are returned as they are. The encoded key may be padded or
+// not.
+func withRawKey(req *http.Request) (*http.Request, error) {
+	var key string
+	if req.URL.Path == rawKeyRoute {
+		if key = req.Header.Get(rawKeyHeader); key == "" {
+			return req, errRawKeyMissing
+		}
+	} else if encoded, ok := strings.CutPrefix(req.URL.Path, rawKeyRoute+"/"); ok {
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		if err != nil || len(decoded) == 0 {
+			return req, errRawKeyInvalid
+		}
+
+		key = string(decoded)
+	} else {
+		return req, nil
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Path = "/" + locking.RawKeyPath(key)
+	req.URL.RawPath = ""
+
+	return req, nil
+}
@@ -0,0 +1,59 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header of the request ID.
+const requestIDHeader = "X-Request-Id"
+
+// HTTP handler assigning request IDs.
+type requestIDHandler struct {
+	handler http.Handler
+}
+
+// New request ID handler.
+//
+// Wraps a handler, assigning every request a random ID, which is set as the X-Request-Id header of the response and
+// included in error responses as the request_id field, so errors reported by clients can be correlated with the
+// server logs. The handler of the locking API assigns request IDs on its own, so wrapping is only required for
+// responses of handlers wrapping it in turn, such as authentication and rate limiting.
+func NewRequestIDHandler(handler http.Handler) http.Handler {
+	return &requestIDHandler{handler: handler}
+}
+
+func (h *requestIDHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	h.handler.ServeHTTP(resp, withRequestID(resp, req))
+}
+
+// Context key of the request ID.
+type requestIDKey struct{}
+
+// Assign a request ID.
+//
+// Generates an ID unless the request was already assigned one by an outer handler, and sets it as the header of the
+// response. Returns the request with the ID in its context.
+func withRequestID(resp http.ResponseWriter, req *http.Request) *http.Request {
+	if _, ok := req.Context().Value(requestIDKey{}).(string); ok {
+		return req
+	}
+
+	var buf [8]byte
+	rand.Read(buf[:])
+	requestID := hex.EncodeToString(buf[:])
+
+	resp.Header().Set(requestIDHeader, requestID)
+
+	return req.WithContext(context.WithValue(req.Context(), requestIDKey{}, requestID))
+}
+
+// Request ID of a request.
+//
+// Returns an empty string if the request was not assigned an ID.
+func requestIDOf(req *http.Request) string {
+	requestID, _ := req.Context().Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -1,9 +1,12 @@
 package httpserver
 
 import (
+	"bufio"
 	"encoding/json"
+	"net"
 	"net/http"
-	"strconv"
+
+	"lockerd/locking"
 )
 
 const (
@@ -20,24 +23,84 @@ func respondJson(resp http.ResponseWriter, data interface{}, statusCode int) err
 		return err
 	}
 
-	// Set the response headers and write the response.
+	// Set the response headers and write the response. The content length is left for net/http to determine, as it
+	// would no longer apply if the body is transformed by a wrapping response writer, such as by compression.
 	resp.Header().Set("Content-Type", jsonContentType)
-	resp.Header().Set("Content-Length", strconv.Itoa(len(jsonData)))
 
 	resp.WriteHeader(statusCode)
 	resp.Write(jsonData)
 	return nil
 }
 
+// Respond without content.
+func respondNoContent(resp http.ResponseWriter) error {
+	resp.WriteHeader(204)
+	return nil
+}
+
 // Respond with an error.
+//
+// Includes the ID of the request, as set in the response header upon assigning it, if any.
 func respondError(resp http.ResponseWriter, code string, message string, statusCode int) error {
-	return respondJson(resp, map[string]interface{}{
+	body := map[string]interface{}{
 		"code":    code,
 		"message": message,
-	}, statusCode)
+	}
+
+	if requestID := resp.Header().Get(requestIDHeader); requestID != "" {
+		body["request_id"] = requestID
+	}
+
+	return respondJson(resp, body, statusCode)
 }
 
 // Respond with a not found error.
 func respondNotFound(resp http.ResponseWriter) error {
 	return respondError(resp, "not_found", "Not found", 404)
 }
+
+// Respond with a path error.
+//
+// Paths exceeding the limits are rejected as bad requests, while otherwise invalid paths cannot name a lock, and are
+// thus not found.
+func respondPathError(resp http.ResponseWriter, err error) error {
+	if err == locking.ErrPathTooLong {
+		return respondError(resp, "path_too_long", "Path too long", 400)
+	}
+
+	return respondNotFound(resp)
+}
+
+// Response writer recording the status code of the response.
+//
+// Supports flushing and hijacking if the underlying response writer does, as required for streaming responses and
+// WebSocket sessions respectively.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	r.statusCode = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
@@ -0,0 +1,61 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Deadline of a request.
+type requestDeadline struct {
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+// Context key of the deadline of a request.
+type requestDeadlineKey struct{}
+
+// Bound a request by the request timeout.
+//
+// Returns the request with a context canceled once the timeout elapses, unless the request is allowed to wait in the
+// meantime, along with a function stopping the timeout once the request is served.
+func withRequestTimeout(req *http.Request, timeout time.Duration) (*http.Request, func()) {
+	ctx, cancel := context.WithCancel(req.Context())
+	deadline := &requestDeadline{
+		timer:   time.AfterFunc(timeout, cancel),
+		timeout: timeout,
+	}
+
+	return req.WithContext(context.WithValue(ctx, requestDeadlineKey{}, deadline)), func() {
+		deadline.timer.Stop()
+		cancel()
+	}
+}
+
+// Allow a request to wait.
+//
+// Extends the deadline of the request to the wait plus the request timeout from now, so waiting for a lock is bounded
+// by its lock timeout rather than the request timeout, and processing the request before and after waiting is still
+// bounded by the request timeout. The read and write deadlines of the connection, as imposed by the read and write
+// timeouts of the server, are extended alike, as they would otherwise cancel the request or fail its response. A
+// negative wait lifts the deadlines entirely, such as for streams held open for as long as the client desires. Does
+// nothing if the request is not bounded by a request timeout. This assumes the request body was read beforehand.
+func allowWait(resp http.ResponseWriter, req *http.Request, wait time.Duration) {
+	deadline, ok := req.Context().Value(requestDeadlineKey{}).(*requestDeadline)
+	if !ok {
+		return
+	}
+
+	var deadlineAt time.Time
+	if wait < 0 {
+		deadline.timer.Stop()
+	} else {
+		deadline.timer.Reset(wait + deadline.timeout)
+		deadlineAt = time.Now().Add(wait + deadline.timeout)
+	}
+
+	// Response writers not supporting deadlines are only subject to the deadline of the request.
+	controller := http.NewResponseController(resp)
+	controller.SetReadDeadline(deadlineAt)
+	controller.SetWriteDeadline(deadlineAt)
+}
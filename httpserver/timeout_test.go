@@ -0,0 +1,85 @@
+package httpserver
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"lockerd/locking"
+)
+
+func NewTimeoutServer(manager locking.Manager, timeout time.Duration) *httptest.Server {
+	server := httptest.NewUnstartedServer(NewHandler(manager, HandlerOptions{
+		RequestTimeout: timeout,
+	}))
+	server.Config.ReadTimeout = timeout
+	server.Config.WriteTimeout = timeout
+	server.Start()
+
+	return server
+}
+
+func TestHandlerRequestTimeoutLongPoll(t *testing.T) {
+	manager, _ := locking.NewManager(locking.Config{})
+	manager.Start()
+	defer manager.Stop()
+
+	server := NewTimeoutServer(manager, 200*time.Millisecond)
+	defer server.Close()
+
+	ticket, _ := manager.Acquire("test", time.Minute, time.Minute)
+	time.AfterFunc(600*time.Millisecond, func() {
+		manager.Release("test", ticket.Id())
+	})
+
+	// Test that waiting for a lock is bounded by the lock timeout rather than the request timeout.
+	req, _ := http.NewRequest("POST", server.URL+"/test", strings.NewReader("lock_timeout=5s&lease_timeout=1m"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	start := time.Now()
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Error performing request: %v", err)
+	}
+	AssertSuccessResponse(t, resp)
+
+	if elapsed := time.Since(start); elapsed < 600*time.Millisecond {
+		t.Fatalf("Expected request to wait for the release, responded after %v", elapsed)
+	}
+}
+
+func TestHandlerRequestTimeoutSlowBody(t *testing.T) {
+	manager, _ := locking.NewManager(locking.Config{})
+	manager.Start()
+	defer manager.Stop()
+
+	server := NewTimeoutServer(manager, 200*time.Millisecond)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer conn.Close()
+
+	// Test that a client never sending the announced body cannot hold the connection open.
+	conn.Write([]byte("POST /test HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 100\r\n\r\nlock"))
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				t.Fatalf("Expected connection to be closed")
+			}
+			break
+		}
+	}
+
+	if lockers, _ := manager.IsLocked("test"); len(lockers) != 0 {
+		t.Fatalf("Expected path not to be locked, got lockers %v", lockers)
+	}
+}
@@ -0,0 +1,318 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lockerd/locking"
+)
+
+// Defaults of webhook notifiers.
+const (
+	// Default number of delivery workers.
+	DefaultWebhookWorkers = 4
+
+	// Default number of webhooks queued for delivery.
+	DefaultWebhookQueueSize = 1024
+
+	// Default number of retries of failed deliveries.
+	DefaultWebhookRetries = 3
+
+	// Default timeout of a single delivery attempt.
+	DefaultWebhookTimeout = 5 * time.Second
+
+	// Default delay before the first retry of a failed delivery.
+	DefaultWebhookRetryDelay = time.Second
+)
+
+// Invalid notification URL.
+var errInvalidNotifyURL = errors.New("invalid notification URL")
+
+// Webhook notifier configuration.
+type NotifierConfig struct {
+	// Number of delivery workers.
+	//
+	// Bounds the number of concurrent deliveries. Defaults to DefaultWebhookWorkers.
+	Workers int
+
+	// Number of webhooks queued for delivery.
+	//
+	// Webhooks are dropped if the queue is full. Defaults to DefaultWebhookQueueSize.
+	QueueSize int
+
+	// Number of retries of failed deliveries.
+	//
+	// Once exhausted, the webhook is dropped and the failure is logged. Defaults to DefaultWebhookRetries, whereas a
+	// negative number disables retries.
+	Retries int
+
+	// Timeout of a single delivery attempt.
+	//
+	// Defaults to DefaultWebhookTimeout.
+	Timeout time.Duration
+
+	// Delay before the first retry.
+	//
+	// The delay doubles with each subsequent retry. Defaults to DefaultWebhookRetryDelay.
+	RetryDelay time.Duration
+
+	// HTTP client.
+	//
+	// Defaults to a client without a timeout of its own, as the timeout applies per attempt.
+	Client *http.Client
+
+	// Logger.
+	//
+	// Failed deliveries are logged at warning level. Defaults to discarding logs.
+	Logger *slog.Logger
+
+	// Ticket ID strategy of the manager.
+	//
+	// Ticket IDs are delivered as external IDs of the strategy. Defaults to the sequential strategy.
+	IDStrategy locking.IDStrategy
+}
+
+// Webhook notifier.
+//
+// Notifies URLs of the release and lease expiry of the tickets it watches, by POSTing a small JSON payload. Webhooks
+// are delivered by a bounded pool of workers, independent of the maintenance of locks, so a slow endpoint cannot stall
+// the manager. Deliveries that fail are retried with exponential backoff, and eventually dropped.
+type Notifier struct {
+	config   NotifierConfig
+	queue    chan webhookDelivery
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	failures atomic.Int64
+
+	// Tickets being watched, which are only watched once no matter how often they are re-entered.
+	watchingSync sync.Mutex
+	watching     map[int64]struct{}
+}
+
+// Webhook delivery.
+type webhookDelivery struct {
+	url     *url.URL
+	event   string
+	payload []byte
+}
+
+// New webhook notifier.
+//
+// Starts the delivery workers, which run until the notifier is closed.
+func NewNotifier(config NotifierConfig) *Notifier {
+	if config.Workers <= 0 {
+		config.Workers = DefaultWebhookWorkers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultWebhookQueueSize
+	}
+	if config.Retries == 0 {
+		config.Retries = DefaultWebhookRetries
+	} else if config.Retries < 0 {
+		config.Retries = 0
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultWebhookTimeout
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = DefaultWebhookRetryDelay
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{}
+	}
+	if config.Logger == nil {
+		config.Logger = slog.New(slog.DiscardHandler)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	n := &Notifier{
+		config:   config,
+		queue:    make(chan webhookDelivery, config.QueueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		watching: make(map[int64]struct{}),
+	}
+
+	for i := 0; i < config.Workers; i++ {
+		n.wg.Add(1)
+		go n.work()
+	}
+
+	return n
+}
+
+// Close the notifier.
+//
+// Stops the delivery workers, aborting deliveries in progress and dropping queued webhooks.
+func (n *Notifier) Close() {
+	n.cancel()
+	n.wg.Wait()
+}
+
+// Number of failed deliveries.
+//
+// Counts the webhooks dropped after exhausting their retries, or because the queue was full.
+func (n *Notifier) Failures() int64 {
+	return n.failures.Load()
+}
+
+// Parse a notification URL.
+//
+// Only absolute HTTP and HTTPS URLs are accepted.
+func parseNotifyURL(notifyURL string) (*url.URL, error) {
+	u, err := url.Parse(notifyURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errInvalidNotifyURL
+	}
+
+	return u, nil
+}
+
+// Watch a ticket.
+//
+// Notifies the URL once the ticket is released or its lease expires. A ticket that is already watched is not watched
+// again.
+func (n *Notifier) watch(path string, ticket locking.Ticket, notifyURL *url.URL) {
+	id := ticket.Id()
+
+	n.watchingSync.Lock()
+	if _, ok := n.watching[id]; ok {
+		n.watchingSync.Unlock()
+		return
+	}
+	n.watching[id] = struct{}{}
+	n.watchingSync.Unlock()
+
+	go func() {
+		defer func() {
+			n.watchingSync.Lock()
+			delete(n.watching, id)
+			n.watchingSync.Unlock()
+		}()
+
+		for event := range ticket.Events() {
+			var name string
+
+			switch event {
+			case locking.TicketReleased:
+				name = "released"
+			case locking.TicketLeaseExpired:
+				name = "expired"
+			default:
+				continue
+			}
+
+			payload, err := json.Marshal(map[string]interface{}{
+				"event": name,
+				"path":  path,
+				"id":    locking.ExternalId(id, n.config.IDStrategy),
+				"fence": fmt.Sprintf("%d", ticket.Fence()),
+				"time":  time.Now().UTC().Format(time.RFC3339Nano),
+			})
+			if err != nil {
+				continue
+			}
+
+			n.enqueue(webhookDelivery{url: notifyURL, event: name, payload: payload})
+		}
+	}()
+}
+
+// Enqueue a webhook for delivery.
+//
+// The webhook is dropped if the queue is full or the notifier is closed.
+func (n *Notifier) enqueue(delivery webhookDelivery) {
+	select {
+	case <-n.ctx.Done():
+	case n.queue <- delivery:
+	default:
+		n.failures.Add(1)
+		n.config.Logger.Warn("Webhook dropped, queue is full", "url", delivery.url.Redacted(), "event", delivery.event)
+	}
+}
+
+// Deliver queued webhooks until the notifier is closed.
+func (n *Notifier) work() {
+	defer n.wg.Done()
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case delivery := <-n.queue:
+			n.deliver(delivery)
+		}
+	}
+}
+
+// Deliver a webhook.
+//
+// Retries failed attempts with exponential backoff until the retries are exhausted or the notifier is closed.
+func (n *Notifier) deliver(delivery webhookDelivery) {
+	delay := n.config.RetryDelay
+
+	var err error
+
+	for attempt := 0; attempt <= n.config.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-n.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			delay *= 2
+		}
+
+		if err = n.post(delivery); err == nil {
+			return
+		}
+	}
+
+	if n.ctx.Err() != nil {
+		return
+	}
+
+	n.failures.Add(1)
+	n.config.Logger.Warn("Webhook delivery failed", "url", delivery.url.Redacted(), "event", delivery.event, "attempts", n.config.Retries+1, "error", err)
+}
+
+// Attempt to deliver a webhook.
+//
+// Any response status other than 2xx is considered a failure.
+func (n *Notifier) post(delivery webhookDelivery) error {
+	ctx, cancel := context.WithTimeout(n.ctx, n.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", delivery.url.String(), bytes.NewReader(delivery.payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", jsonContentType)
+
+	resp, err := n.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
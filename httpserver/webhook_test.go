@@ -0,0 +1,136 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lockerd/locking"
+)
+
+func TestHandlerWebhook(t *testing.T) {
+	received := make(chan map[string]string, 8)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(req.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer endpoint.Close()
+
+	notifier := NewNotifier(NotifierConfig{})
+	defer notifier.Close()
+
+	f := NewHandlerFixtureWithOptions(t, locking.Config{MaintenanceInterval: 10 * time.Millisecond}, HandlerOptions{Notifier: notifier})
+	defer f.Close()
+
+	// Test notification of a release.
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+		"notify_url":    []string{endpoint.URL},
+	})
+	body := AssertSuccessResponse(t, resp)
+
+	AssertSuccessResponse(t, f.Request("DELETE", "/test", url.Values{"id": []string{body.Id}}))
+	AssertWebhook(t, received, "released", "test", body.Id)
+
+	// Test notification of a lease expiry.
+	resp = f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"50ms"},
+		"notify_url":    []string{endpoint.URL},
+	})
+	body = AssertSuccessResponse(t, resp)
+
+	AssertWebhook(t, received, "expired", "test", body.Id)
+
+	// Test that invalid notification URLs are rejected.
+	resp = f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+		"notify_url":    []string{"ftp://example.com"},
+	})
+	AssertErrorResponse(t, resp, "invalid_notify_url", 400)
+}
+
+func TestHandlerWebhookDisabled(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+		"notify_url":    []string{"http://example.com"},
+	})
+	AssertErrorResponse(t, resp, "webhooks_disabled", 400)
+}
+
+func TestNotifierRetries(t *testing.T) {
+	var attempts atomic.Int64
+	var failing atomic.Bool
+	endpoint := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		// Fail every other attempt, unless failing every attempt.
+		if attempts.Add(1)%2 == 1 || failing.Load() {
+			resp.WriteHeader(500)
+		}
+	}))
+	defer endpoint.Close()
+
+	notifyURL, _ := url.Parse(endpoint.URL)
+
+	notifier := NewNotifier(NotifierConfig{Retries: 1, RetryDelay: time.Millisecond})
+	defer notifier.Close()
+
+	manager, _ := locking.NewManager(locking.Config{})
+
+	// Test that a failed delivery is retried.
+	ticket, _ := manager.Acquire("test", time.Minute, time.Minute)
+	notifier.watch("test", ticket, notifyURL)
+	manager.Release("test", ticket.Id())
+
+	AssertEventually(t, func() bool { return attempts.Load() == 2 })
+	if notifier.Failures() != 0 {
+		t.Fatalf("Expected no failures, got %d", notifier.Failures())
+	}
+
+	// Test that the delivery is dropped once the retries are exhausted.
+	failing.Store(true)
+
+	ticket, _ = manager.Acquire("test", time.Minute, time.Minute)
+	notifier.watch("test", ticket, notifyURL)
+	manager.Release("test", ticket.Id())
+
+	AssertEventually(t, func() bool { return notifier.Failures() == 1 })
+	if attempts.Load() != 4 {
+		t.Fatalf("Expected 4 attempts, got %d", attempts.Load())
+	}
+}
+
+func AssertWebhook(t *testing.T, received chan map[string]string, event, path, id string) {
+	t.Helper()
+
+	select {
+	case payload := <-received:
+		if payload["event"] != event || payload["path"] != path || payload["id"] != id {
+			t.Fatalf("Expected %s webhook of %s by %s, got %v", event, path, id, payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected %s webhook of %s by %s", event, path, id)
+	}
+}
+
+func AssertEventually(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if condition() {
+			return
+		}
+	}
+
+	t.Fatalf("Condition not met within %s", 5*time.Second)
+}
@@ -0,0 +1,526 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/websocket"
+
+	"lockerd/locking"
+)
+
+const (
+	// Maximum size of a WebSocket command frame in bytes.
+	maxWebSocketFrameSize = 64 << 10
+
+	// Maximum number of commands in flight on a WebSocket session.
+	//
+	// Commands beyond it are rejected rather than queued, so a session waiting for many locks can still release them.
+	maxWebSocketCommands = 64
+)
+
+// WebSocket command.
+//
+// Commands are sent as JSON text frames, and carry the same parameters as the corresponding HTTP requests, along with
+// an opaque request ID echoed in the response.
+type webSocketCommand struct {
+	RequestId        string            `json:"request_id"`
+	Command          string            `json:"command"`
+	Path             string            `json:"path"`
+	Id               string            `json:"id"`
+	LockTimeout      string            `json:"lock_timeout"`
+	LeaseTimeout     string            `json:"lease_timeout"`
+	Mode             string            `json:"mode"`
+	Owner            string            `json:"owner"`
+	Labels           map[string]string `json:"labels"`
+	Try              bool              `json:"try"`
+	Shorten          bool              `json:"shorten"`
+	IfLeaseTimeoutGt string            `json:"if_lease_timeout_gt"`
+}
+
+// Lock held through a WebSocket session.
+type webSocketHold struct {
+	path string
+	id   int64
+}
+
+// WebSocket session.
+//
+// Commands of a session are served concurrently, so waiting for a lock does not block other commands, and responses
+// are sent as the commands complete, matched to the commands by their request IDs. Locks acquired through the session
+// are bound to the connection, and released once it closes.
+type webSocketSession struct {
+	handler *handler
+	conn    *websocket.Conn
+
+	// Locks held through the session, with their hold counts.
+	holds     map[webSocketHold]int
+	holdsSync sync.Mutex
+}
+
+// Whether a request is a WebSocket upgrade request.
+func isWebSocketRequest(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Upgrade"), "websocket")
+}
+
+// Cross-origin WebSocket request.
+var errCrossOriginWebSocket = errors.New("cross-origin websocket request")
+
+// Check the origin of a WebSocket request.
+//
+// Browsers attach credentials to WebSocket requests of any origin, so requests from other origins are rejected. Clients
+// other than browsers commonly send no origin, and are accepted.
+func checkWebSocketOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	originUrl, err := url.Parse(origin)
+	if err != nil || originUrl.Host != req.Host {
+		return errCrossOriginWebSocket
+	}
+
+	return nil
+}
+
+// Serve a WebSocket session.
+//
+// Acquisitions waiting when the connection closes are abandoned, and locks held through the session are released.
+func (h *handler) serveWebSocket(resp http.ResponseWriter, req *http.Request) error {
+	if !canHijack(resp) {
+		return respondError(resp, "websocket_unsupported", "WebSocket unsupported", 500)
+	}
+
+	allowWait(resp, req, -1)
+
+	server := websocket.Server{
+		Handshake: checkWebSocketOrigin,
+		Handler: func(conn *websocket.Conn) {
+			conn.MaxPayloadBytes = maxWebSocketFrameSize
+
+			session := &webSocketSession{
+				handler: h,
+				conn:    conn,
+				holds:   make(map[webSocketHold]int),
+			}
+			session.serve(req.Context())
+		},
+	}
+
+	server.ServeHTTP(resp, req)
+	return nil
+}
+
+// Whether the connection of a response can be hijacked.
+//
+// Response writers wrapping others are unwrapped, as they implement hijacking regardless of the writers they wrap.
+func canHijack(resp http.ResponseWriter) bool {
+	for {
+		if wrapper, ok := resp.(interface{ Unwrap() http.ResponseWriter }); ok {
+			resp = wrapper.Unwrap()
+			continue
+		}
+
+		_, ok := resp.(http.Hijacker)
+		return ok
+	}
+}
+
+// Serve the commands of the session until the connection closes.
+func (s *webSocketSession) serve(ctx context.Context) {
+	// The request context is not canceled when a hijacked connection closes, so the commands are bound to a context
+	// canceled once reading from the connection fails.
+	ctx, cancel := context.WithCancel(ctx)
+
+	var commands sync.WaitGroup
+	inFlight := make(chan struct{}, maxWebSocketCommands)
+
+	for {
+		var data []byte
+
+		if err := websocket.Message.Receive(s.conn, &data); err == websocket.ErrFrameTooLarge {
+			s.respondError(webSocketCommand{}, "frame_too_large", "Frame too large", 400)
+			continue
+		} else if err != nil {
+			break
+		}
+
+		var command webSocketCommand
+
+		if err := json.Unmarshal(data, &command); err != nil {
+			s.respondError(command, "invalid_body", "Invalid JSON body", 400)
+			continue
+		}
+
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			s.respondError(command, "too_many_commands", "Too many commands in flight", 429)
+			continue
+		}
+
+		commands.Add(1)
+		go func() {
+			defer commands.Done()
+			defer func() { <-inFlight }()
+
+			s.serveCommand(ctx, command)
+		}()
+	}
+
+	// Wait for the commands to settle before releasing the locks, so no lock is held through the session afterwards.
+	cancel()
+	commands.Wait()
+
+	s.holdsSync.Lock()
+	defer s.holdsSync.Unlock()
+
+	for hold, count := range s.holds {
+		for range count {
+			s.handler.manager.Release(hold.path, hold.id)
+		}
+	}
+
+	s.holds = nil
+}
+
+// Serve a command.
+func (s *webSocketSession) serveCommand(ctx context.Context, command webSocketCommand) {
+	var err error
+
+	switch command.Command {
+	case "acquire":
+		err = s.serveAcquire(ctx, command)
+	case "release":
+		err = s.serveRelease(command)
+	case "extend":
+		err = s.serveExtend(command)
+	case "inspect":
+		err = s.serveInspect(command)
+	default:
+		err = s.respondError(command, "invalid_command", "Invalid command", 400)
+	}
+
+	if managerErr, ok := managerErrors[err]; ok {
+		s.respondError(command, managerErr.code, managerErr.message, managerErr.statusCode)
+	} else if err != nil {
+		s.handler.logger.Error("WebSocket command failed", "command", command.Command, "path", command.Path, "error", err)
+		s.respondError(command, "internal_server_error", "Internal server error", 500)
+	}
+}
+
+func (s *webSocketSession) serveAcquire(ctx context.Context, command webSocketCommand) error {
+	// Parse the path.
+	path, err := s.handler.manager.ValidatePath(command.Path)
+	if err != nil {
+		return s.respondPathError(command, err)
+	}
+
+	// Parse the timeout values, falling back to the configured defaults if omitted. The lock timeout is not applicable
+	// when trying to acquire the lock without queueing.
+	lockTimeout, leaseTimeout := s.handler.manager.DefaultTimeouts()
+
+	if command.LockTimeout == "" && lockTimeout == 0 && !command.Try {
+		return s.respondError(command, "missing_lock_timeout", "Missing lock_timeout", 400)
+	}
+	if command.LeaseTimeout == "" && leaseTimeout == 0 {
+		return s.respondError(command, "missing_lease_timeout", "Missing lease_timeout", 400)
+	}
+
+	if command.Try {
+		lockTimeout = 0
+	} else if command.LockTimeout != "" {
+		lockTimeout, err = ParseDuration(command.LockTimeout)
+		if err != nil {
+			return s.respondError(command, "invalid_lock_timeout", "Invalid lock timeout", 400)
+		}
+	}
+	if command.LeaseTimeout != "" {
+		leaseTimeout, err = ParseLeaseTimeout(command.LeaseTimeout)
+		if err != nil {
+			return s.respondError(command, "invalid_lease_timeout", "Invalid lease timeout", 400)
+		}
+	}
+
+	// Parse the acquisition options.
+	options := locking.AcquireOptions{
+		Owner:  command.Owner,
+		Labels: command.Labels,
+	}
+
+	switch command.Mode {
+	case "", "exclusive":
+		options.Mode = locking.ModeExclusive
+	case "shared":
+		options.Mode = locking.ModeShared
+	default:
+		return s.respondError(command, "invalid_mode", "Invalid mode", 400)
+	}
+
+	// Try to acquire the lock without queueing if requested.
+	if command.Try {
+		ticket, acquired, err := s.handler.manager.TryAcquire(path, leaseTimeout, options)
+		if err != nil {
+			return err
+		}
+
+		if !acquired {
+			return s.respondError(command, "conflict", "Lock is held", 409)
+		}
+
+		return s.respondAcquired(command, path, ticket)
+	}
+
+	// Acquire the lock. The acquisition is abandoned by the manager if the connection closes while waiting.
+	ticket, err := s.handler.manager.AcquireContext(ctx, path, lockTimeout, leaseTimeout, options)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case acquired := <-ticket.Acquired():
+		if acquired {
+			return s.respondAcquired(command, path, ticket)
+		}
+
+		response := map[string]interface{}{
+			"code":    "timeout",
+			"message": "Timed out waiting to acquire lock",
+		}
+		if retryAfter, ok, err := s.handler.estimateRetryAfter(path); err != nil {
+			return err
+		} else if ok {
+			response["retry_after"] = s.handler.format.duration(retryAfter)
+		}
+
+		return s.respond(command, response, 408)
+
+	case <-ctx.Done():
+		// The acquisition is settled promptly subsequent to cancellation, but the lock may have been acquired in the
+		// meantime, in which case it must be released.
+		if <-ticket.Acquired() {
+			s.handler.manager.Release(path, ticket.Id())
+		}
+	}
+
+	return nil
+}
+
+// Respond with an acquired lock.
+//
+// The lock is bound to the session, and its lifecycle is pushed to the client until the lock is released or its lease
+// expires. Re-entering a lock held through the session binds it once more.
+func (s *webSocketSession) respondAcquired(command webSocketCommand, path string, ticket locking.Ticket) error {
+	hold := webSocketHold{path: path, id: ticket.Id()}
+
+	s.holdsSync.Lock()
+	s.holds[hold]++
+	first := s.holds[hold] == 1
+	s.holdsSync.Unlock()
+
+	if first {
+		go s.pushEvents(hold, ticket)
+	}
+
+	return s.respond(command, map[string]interface{}{
+		"id":    s.handler.format.ticketId(ticket.Id()),
+		"fence": s.handler.format.id(ticket.Fence()),
+	}, 200)
+}
+
+// Push the lifecycle events of a lock held through the session.
+//
+// Events are pushed as frames carrying the event name, path and ticket ID, without a request ID. Once the lock is
+// released or its lease expires, it is no longer bound to the session.
+func (s *webSocketSession) pushEvents(hold webSocketHold, ticket locking.Ticket) {
+	for event := range ticket.Events() {
+		var name string
+
+		switch event {
+		case locking.TicketLeaseChanged:
+			name = "renewed"
+		case locking.TicketReleased:
+			name = "released"
+		case locking.TicketLeaseExpired:
+			name = "expired"
+		default:
+			continue
+		}
+
+		if event != locking.TicketLeaseChanged {
+			s.unbind(hold)
+		}
+
+		s.send(map[string]interface{}{
+			"event": name,
+			"path":  hold.path,
+			"id":    s.handler.format.ticketId(hold.id),
+		})
+	}
+}
+
+// Unbind a lock from the session.
+func (s *webSocketSession) unbind(hold webSocketHold) {
+	s.holdsSync.Lock()
+	defer s.holdsSync.Unlock()
+
+	delete(s.holds, hold)
+}
+
+func (s *webSocketSession) serveRelease(command webSocketCommand) error {
+	// Parse the path.
+	path, err := s.handler.manager.ValidatePath(command.Path)
+	if err != nil {
+		return s.respondPathError(command, err)
+	}
+
+	// Parse the ID.
+	if command.Id == "" {
+		return s.respondError(command, "missing_id", "Missing id", 400)
+	}
+
+	id, err := locking.ParseExternalId(command.Id)
+	if err != nil {
+		return s.respondError(command, "invalid_id", "Invalid ID", 400)
+	}
+
+	// Release the lock, and a hold of it through the session if any.
+	released, err := s.handler.manager.Release(path, id)
+	if err != nil {
+		return err
+	}
+
+	if !released {
+		return s.respondError(command, "not_found", "Not found", 404)
+	}
+
+	hold := webSocketHold{path: path, id: id}
+
+	s.holdsSync.Lock()
+	if s.holds[hold] > 1 {
+		s.holds[hold]--
+	} else {
+		delete(s.holds, hold)
+	}
+	s.holdsSync.Unlock()
+
+	return s.respond(command, map[string]interface{}{}, 200)
+}
+
+func (s *webSocketSession) serveExtend(command webSocketCommand) error {
+	// Parse the path.
+	path, err := s.handler.manager.ValidatePath(command.Path)
+	if err != nil {
+		return s.respondPathError(command, err)
+	}
+
+	// Parse the ID and timeout value.
+	if command.Id == "" {
+		return s.respondError(command, "missing_id", "Missing id", 400)
+	}
+	if command.LeaseTimeout == "" {
+		return s.respondError(command, "missing_lease_timeout", "Missing lease_timeout", 400)
+	}
+
+	id, err := locking.ParseExternalId(command.Id)
+	if err != nil {
+		return s.respondError(command, "invalid_id", "Invalid ID", 400)
+	}
+	leaseTimeout, err := ParseLeaseTimeout(command.LeaseTimeout)
+	if err != nil {
+		return s.respondError(command, "invalid_lease_timeout", "Invalid lease timeout", 400)
+	}
+
+	// Parse the condition on the remaining lease, if any.
+	var options locking.ExtendOptions
+
+	if command.IfLeaseTimeoutGt != "" {
+		if options.IfLeaseTimeoutGreaterThan, err = ParseDuration(command.IfLeaseTimeoutGt); err != nil {
+			return s.respondError(command, "invalid_if_lease_timeout_gt", "Invalid if_lease_timeout_gt", 400)
+		}
+	}
+
+	// Extend or shorten the lock.
+	var found, changed bool
+
+	if command.Shorten {
+		found, changed, err = s.handler.manager.Shorten(path, id, leaseTimeout)
+	} else {
+		found, changed, err = s.handler.manager.Extend(path, id, leaseTimeout, options)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return s.respondError(command, "not_found", "Not found", 404)
+	}
+
+	return s.respond(command, map[string]interface{}{
+		"changed": changed,
+	}, 200)
+}
+
+func (s *webSocketSession) serveInspect(command webSocketCommand) error {
+	// Parse the path.
+	path, err := s.handler.manager.ValidatePath(command.Path)
+	if err != nil {
+		return s.respondPathError(command, err)
+	}
+
+	// Inspect the lock.
+	state, err := s.handler.manager.Inspect(path)
+	if err != nil {
+		return err
+	}
+
+	if state.LockingId == 0 {
+		return s.respondError(command, "not_found", "Not found", 404)
+	}
+
+	return s.respond(command, s.handler.format.lockState(state), 200)
+}
+
+// Respond to a command.
+//
+// Responses carry the same fields as the bodies of the corresponding HTTP responses, along with the request ID of the
+// command and the status code of the corresponding HTTP response.
+func (s *webSocketSession) respond(command webSocketCommand, response map[string]interface{}, statusCode int) error {
+	response["request_id"] = command.RequestId
+	response["status"] = statusCode
+
+	s.send(response)
+	return nil
+}
+
+// Respond to a command with an error.
+func (s *webSocketSession) respondError(command webSocketCommand, code string, message string, statusCode int) error {
+	return s.respond(command, map[string]interface{}{
+		"code":    code,
+		"message": message,
+	}, statusCode)
+}
+
+// Respond to a command with a path error.
+func (s *webSocketSession) respondPathError(command webSocketCommand, err error) error {
+	if err == locking.ErrPathTooLong {
+		return s.respondError(command, "path_too_long", "Path too long", 400)
+	}
+
+	return s.respondError(command, "not_found", "Not found", 404)
+}
+
+// Send a frame.
+//
+// Frames are sent whole, even when sent concurrently. Failures to send are ignored, as they imply that the connection
+// is closing, which ends the session.
+func (s *webSocketSession) send(frame map[string]interface{}) {
+	websocket.JSON.Send(s.conn, frame)
+}
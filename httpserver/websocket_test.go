@@ -0,0 +1,207 @@
+package httpserver
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+type WebSocketFrame struct {
+	RequestId string `json:"request_id"`
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Event     string `json:"event"`
+	Path      string `json:"path"`
+	Id        string `json:"id"`
+	Fence     string `json:"fence"`
+	Changed   bool   `json:"changed"`
+	LockingId string `json:"locking_id"`
+}
+
+func sendWebSocketCommand(t *testing.T, conn *websocket.Conn, command map[string]interface{}) {
+	if err := websocket.JSON.Send(conn, command); err != nil {
+		t.Fatalf("Failed to send command: %v", err)
+	}
+}
+
+func receiveWebSocketFrame(t *testing.T, conn *websocket.Conn) WebSocketFrame {
+	var frame WebSocketFrame
+	if err := websocket.JSON.Receive(conn, &frame); err != nil {
+		t.Fatalf("Failed to receive frame: %v", err)
+	}
+
+	return frame
+}
+
+func TestHandlerWebSocket(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	conn := f.DialWebSocket()
+	defer conn.Close()
+
+	// Test that invalid commands are rejected without closing the session.
+	sendWebSocketCommand(t, conn, map[string]interface{}{"request_id": "1", "command": "unlock", "path": "test"})
+	if frame := receiveWebSocketFrame(t, conn); frame.RequestId != "1" || frame.Status != 400 || frame.Code != "invalid_command" {
+		t.Fatalf("Expected invalid command error, got %v", frame)
+	}
+
+	sendWebSocketCommand(t, conn, map[string]interface{}{"request_id": "2", "command": "acquire", "path": "test"})
+	if frame := receiveWebSocketFrame(t, conn); frame.RequestId != "2" || frame.Status != 400 || frame.Code != "missing_lock_timeout" {
+		t.Fatalf("Expected missing lock timeout error, got %v", frame)
+	}
+
+	// Test acquiring and inspecting a lock.
+	sendWebSocketCommand(t, conn, map[string]interface{}{
+		"request_id":    "3",
+		"command":       "acquire",
+		"path":          "test",
+		"lock_timeout":  "1m",
+		"lease_timeout": "1m",
+	})
+
+	acquired := receiveWebSocketFrame(t, conn)
+	if acquired.RequestId != "3" || acquired.Status != 200 || acquired.Id == "" || acquired.Fence == "" {
+		t.Fatalf("Expected lock to be acquired, got %v", acquired)
+	}
+
+	sendWebSocketCommand(t, conn, map[string]interface{}{"request_id": "4", "command": "inspect", "path": "test"})
+	if frame := receiveWebSocketFrame(t, conn); frame.RequestId != "4" || frame.Status != 200 || frame.LockingId != acquired.Id {
+		t.Fatalf("Expected lock to be held by %s, got %v", acquired.Id, frame)
+	}
+
+	// Test extending the lock.
+	sendWebSocketCommand(t, conn, map[string]interface{}{
+		"request_id":    "5",
+		"command":       "extend",
+		"path":          "test",
+		"id":            acquired.Id,
+		"lease_timeout": "2m",
+	})
+
+	for range 2 {
+		if frame := receiveWebSocketFrame(t, conn); frame.Event != "" && frame.Event != "renewed" {
+			t.Fatalf("Expected renewed event, got %v", frame)
+		} else if frame.Event == "" && (frame.RequestId != "5" || frame.Status != 200 || !frame.Changed) {
+			t.Fatalf("Expected lock to be extended, got %v", frame)
+		}
+	}
+
+	// Test that releasing the lock is responded to, and pushed as an event.
+	sendWebSocketCommand(t, conn, map[string]interface{}{"request_id": "6", "command": "release", "path": "test", "id": acquired.Id})
+
+	for range 2 {
+		if frame := receiveWebSocketFrame(t, conn); frame.Event != "" && (frame.Event != "released" || frame.Path != "test" || frame.Id != acquired.Id) {
+			t.Fatalf("Expected released event, got %v", frame)
+		} else if frame.Event == "" && (frame.RequestId != "6" || frame.Status != 200) {
+			t.Fatalf("Expected lock to be released, got %v", frame)
+		}
+	}
+
+	sendWebSocketCommand(t, conn, map[string]interface{}{"request_id": "7", "command": "release", "path": "test", "id": acquired.Id})
+	if frame := receiveWebSocketFrame(t, conn); frame.RequestId != "7" || frame.Status != 404 || frame.Code != "not_found" {
+		t.Fatalf("Expected not found error, got %v", frame)
+	}
+}
+
+func TestHandlerWebSocketConcurrentCommands(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	resp := f.Request("POST", "/test", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	})
+	holder := AssertSuccessResponse(t, resp)
+
+	conn := f.DialWebSocket()
+	defer conn.Close()
+
+	// Test that commands are served while another command waits for a lock.
+	sendWebSocketCommand(t, conn, map[string]interface{}{
+		"request_id":    "1",
+		"command":       "acquire",
+		"path":          "test",
+		"lock_timeout":  "1m",
+		"lease_timeout": "1m",
+	})
+
+	time.Sleep(100 * time.Millisecond)
+
+	sendWebSocketCommand(t, conn, map[string]interface{}{"request_id": "2", "command": "release", "path": "test", "id": holder.Id})
+
+	for range 2 {
+		if frame := receiveWebSocketFrame(t, conn); frame.RequestId == "2" && frame.Status != 200 {
+			t.Fatalf("Expected lock to be released, got %v", frame)
+		} else if frame.RequestId != "2" && (frame.RequestId != "1" || frame.Status != 200 || frame.Id == "") {
+			t.Fatalf("Expected lock to be acquired, got %v", frame)
+		}
+	}
+}
+
+func TestHandlerWebSocketClose(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	conn := f.DialWebSocket()
+
+	sendWebSocketCommand(t, conn, map[string]interface{}{
+		"request_id":    "1",
+		"command":       "acquire",
+		"path":          "test",
+		"lock_timeout":  "1m",
+		"lease_timeout": "infinite",
+	})
+	if frame := receiveWebSocketFrame(t, conn); frame.Status != 200 {
+		t.Fatalf("Expected lock to be acquired, got %v", frame)
+	}
+
+	// Test that acquisitions waiting when the session closes are abandoned, and held locks are released.
+	resp := f.Request("POST", "/other", url.Values{
+		"lock_timeout":  []string{"1m"},
+		"lease_timeout": []string{"1m"},
+	})
+	AssertSuccessResponse(t, resp)
+
+	sendWebSocketCommand(t, conn, map[string]interface{}{
+		"request_id":    "2",
+		"command":       "acquire",
+		"path":          "other",
+		"lock_timeout":  "1m",
+		"lease_timeout": "1m",
+	})
+
+	time.Sleep(100 * time.Millisecond)
+
+	if state, _ := f.Manager.Inspect("other"); len(state.Acquirers) != 1 {
+		t.Fatalf("Expected acquisition to wait, got %v", state.Acquirers)
+	}
+
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	if lockers, _ := f.Manager.IsLocked("test"); len(lockers) != 0 {
+		t.Fatalf("Expected lock to be released, got %v", lockers)
+	}
+
+	if state, _ := f.Manager.Inspect("other"); len(state.Acquirers) != 0 {
+		t.Fatalf("Expected acquisition to be abandoned, got %v", state.Acquirers)
+	}
+}
+
+func TestHandlerWebSocketCrossOrigin(t *testing.T) {
+	f := NewHandlerFixture(t)
+	defer f.Close()
+
+	config, err := websocket.NewConfig("ws"+f.server.URL[len("http"):]+"/ws", "http://example.com")
+	if err != nil {
+		t.Fatalf("Failed to configure WebSocket: %v", err)
+	}
+
+	if conn, err := websocket.DialConfig(config); err == nil {
+		conn.Close()
+		t.Fatalf("Expected cross-origin session to be rejected")
+	}
+}
@@ -0,0 +1,234 @@
+package locking
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Default number of paths retaining audit history.
+const DefaultAuditHistoryPaths = 10000
+
+// Audit event kind.
+type AuditEventKind int
+
+const (
+	// Lock acquired.
+	AuditAcquired AuditEventKind = iota + 1
+
+	// Lock re-entered by its owner.
+	AuditReentered
+
+	// Re-entered lock exited, without releasing it.
+	AuditExited
+
+	// Lock released.
+	AuditReleased
+
+	// Lease extended.
+	AuditExtended
+
+	// Lease shortened.
+	AuditShortened
+
+	// Lease expired.
+	AuditExpired
+
+	// Acquisition timed out.
+	AuditTimedOut
+
+	// Acquisition canceled.
+	//
+	// The acquisition was either released while waiting, abandoned or aborted.
+	AuditCanceled
+
+	// Lock downgraded from exclusive to shared mode.
+	AuditDowngraded
+
+	// Lock upgraded from shared to exclusive mode.
+	AuditUpgraded
+)
+
+func (k AuditEventKind) String() string {
+	switch k {
+	case AuditAcquired:
+		return "acquired"
+	case AuditReentered:
+		return "reentered"
+	case AuditExited:
+		return "exited"
+	case AuditReleased:
+		return "released"
+	case AuditExtended:
+		return "extended"
+	case AuditShortened:
+		return "shortened"
+	case AuditExpired:
+		return "expired"
+	case AuditTimedOut:
+		return "timed_out"
+	case AuditCanceled:
+		return "canceled"
+	case AuditDowngraded:
+		return "downgraded"
+	case AuditUpgraded:
+		return "upgraded"
+	}
+
+	return "unknown"
+}
+
+// Audit event.
+type AuditEvent struct {
+	// Kind.
+	Kind AuditEventKind
+
+	// Wall clock time of the event.
+	Time time.Time
+
+	// Ticket ID.
+	Id int64
+
+	// Owner identity of the ticket.
+	Owner string
+
+	// Labels of the ticket.
+	//
+	// Shared with the ticket, and must not be modified.
+	Labels map[string]string
+
+	// Fencing token.
+	//
+	// Zero unless the ticket has acquired the lock.
+	Fence int64
+
+	// Lease timeout.
+	//
+	// The lease timeout granted by acquisitions, re-entries, extensions and shortenings, and zero for other events.
+	// InfiniteTimeout if the lease never expires.
+	LeaseTimeout time.Duration
+}
+
+// Audit log.
+//
+// Retains the most recent events of each path in a ring buffer of a fixed size, for a bounded number of paths. Once
+// the number of paths is exceeded, the history of the path least recently appended to is evicted, no matter if the
+// path is still locked. The audit log is safe for concurrent use, as events of different paths are appended
+// concurrently.
+type auditLog struct {
+	sync      sync.Mutex
+	size      int
+	maxPaths  int
+	histories map[string]*list.Element
+	order     *list.List
+}
+
+// Audit history of a path.
+type auditHistory struct {
+	path   string
+	events []AuditEvent
+	start  int
+}
+
+// New audit log.
+//
+// Returns nil if the size is not positive, which disables auditing.
+func newAuditLog(size int, maxPaths int) *auditLog {
+	if size <= 0 {
+		return nil
+	}
+
+	if maxPaths <= 0 {
+		maxPaths = DefaultAuditHistoryPaths
+	}
+
+	return &auditLog{
+		size:      size,
+		maxPaths:  maxPaths,
+		histories: make(map[string]*list.Element),
+		order:     list.New(),
+	}
+}
+
+// Append an event to the history of a path.
+func (l *auditLog) append(path string, event AuditEvent) {
+	l.sync.Lock()
+	defer l.sync.Unlock()
+
+	elem, ok := l.histories[path]
+	if ok {
+		l.order.MoveToFront(elem)
+	} else {
+		if len(l.histories) >= l.maxPaths {
+			oldest := l.order.Back()
+			delete(l.histories, oldest.Value.(*auditHistory).path)
+			l.order.Remove(oldest)
+		}
+
+		elem = l.order.PushFront(&auditHistory{path: path})
+		l.histories[path] = elem
+	}
+
+	history := elem.Value.(*auditHistory)
+
+	if len(history.events) < l.size {
+		history.events = append(history.events, event)
+	} else {
+		history.events[history.start] = event
+		history.start = (history.start + 1) % l.size
+	}
+}
+
+// History of a path.
+//
+// Returns the retained events of the path, oldest first.
+func (l *auditLog) history(path string) []AuditEvent {
+	l.sync.Lock()
+	defer l.sync.Unlock()
+
+	elem, ok := l.histories[path]
+	if !ok {
+		return nil
+	}
+
+	history := elem.Value.(*auditHistory)
+
+	events := make([]AuditEvent, 0, len(history.events))
+	events = append(events, history.events[history.start:]...)
+	events = append(events, history.events[:history.start]...)
+
+	return events
+}
+
+// Audit an event of a ticket.
+//
+// Does nothing if auditing is disabled. This assumes lock to the path is provided during the process.
+func (m *managerImpl) audit(path string, kind AuditEventKind, ticket *ticketImpl, leaseTimeout time.Duration) {
+	if m.auditLog == nil {
+		return
+	}
+
+	m.auditLog.append(path, AuditEvent{
+		Kind:         kind,
+		Time:         m.clock.Now(),
+		Id:           ticket.id,
+		Owner:        ticket.owner,
+		Labels:       ticket.labels,
+		Fence:        ticket.fence,
+		LeaseTimeout: max(leaseTimeout, InfiniteTimeout),
+	})
+}
+
+func (m *managerImpl) History(path string) ([]AuditEvent, error) {
+	// Clean and validate the path.
+	path, err := m.pathValidator.Validate(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.auditLog == nil {
+		return nil, nil
+	}
+
+	return m.auditLog.history(path), nil
+}
@@ -0,0 +1,93 @@
+package locking
+
+import (
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket of the locks of a BoltDB store.
+var boltLocksBucket = []byte("locks")
+
+// BoltDB store.
+//
+// Stores the locks in a BoltDB database, keyed by path. Every batch of changed locks commits a single transaction.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// New BoltDB store.
+//
+// Opens or creates the database at the path. The locks recorded in it are loaded by the manager the store is
+// configured for.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltLocksBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Load() ([]StoredLock, error) {
+	var locks []StoredLock
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltLocksBucket).ForEach(func(key, value []byte) error {
+			var lock StoredLock
+			if err := json.Unmarshal(value, &lock); err != nil {
+				return err
+			}
+
+			locks = append(locks, lock)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return locks, nil
+}
+
+func (s *BoltStore) Write(locks []StoredLock) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltLocksBucket)
+
+		for _, lock := range locks {
+			if len(lock.Holders) == 0 {
+				if err := bucket.Delete([]byte(lock.Path)); err != nil {
+					return err
+				}
+				continue
+			}
+
+			data, err := json.Marshal(lock)
+			if err != nil {
+				return err
+			}
+
+			if err := bucket.Put([]byte(lock.Path), data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Close the store.
+//
+// The manager must be stopped beforehand, so it has written its changes.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,111 @@
+package locking
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBoltStore(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "locks.db")
+	clock := NewMockClock(time.Unix(0, 0))
+
+	store, err := NewBoltStore(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	manager, _ := NewManager(Config{Store: store, Clock: clock, MaintenanceInterval: time.Second})
+	manager.Start()
+
+	owner := AcquireOptions{Owner: "worker"}
+
+	ticketA, _ := manager.Acquire("a", time.Minute, time.Minute, owner)
+	manager.Acquire("a", time.Minute, time.Minute, owner)
+	manager.Extend("a", ticketA.Id(), 2*time.Minute)
+	ticketB, _ := manager.Acquire("a", time.Minute, time.Minute, AcquireOptions{Mode: ModeShared})
+	ticketC, _ := manager.Acquire("b", time.Minute, time.Minute)
+	manager.Release("b", ticketC.Id())
+	ticketD, _ := manager.Acquire("s", time.Minute, InfiniteTimeout, AcquireOptions{Capacity: 2})
+	AssertTicketWaiting(t, ticketB)
+
+	// Test that nothing is written before the maintenance pass.
+	if locks, _ := store.Load(); len(locks) != 0 {
+		t.Fatalf("Expected no stored locks, got %+v", locks)
+	}
+
+	// Test that the maintenance pass writes the holders, but neither waiting acquisitions nor deleted locks.
+	clock.Advance(time.Second)
+
+	expected := []StoredLock{
+		{
+			Path:  "a",
+			Fence: ticketA.Fence(),
+			Holders: []StoredHolder{
+				{Id: ticketA.Id(), Fence: ticketA.Fence(), Owner: "worker", HoldCount: 2, LeaseUntil: int64(2 * time.Minute)},
+			},
+		},
+		{
+			Path:     "s",
+			Fence:    ticketD.Fence(),
+			Capacity: 2,
+			Holders: []StoredHolder{
+				{Id: ticketD.Id(), Mode: ModeShared, Fence: ticketD.Fence(), HoldCount: 1, LeaseUntil: JournalLeaseNever},
+			},
+		},
+	}
+
+	if locks, _ := store.Load(); !reflect.DeepEqual(locks, expected) {
+		t.Fatalf("Expected stored locks %+v, got %+v", expected, locks)
+	}
+
+	// Test that stopping the manager writes the changes in place, such as of the hold count.
+	manager.Release("a", ticketA.Id())
+	manager.Stop()
+
+	expected[0].Holders[0].HoldCount = 1
+
+	if locks, _ := store.Load(); !reflect.DeepEqual(locks, expected) {
+		t.Fatalf("Expected stored locks %+v, got %+v", expected, locks)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store: %v", err)
+	}
+
+	// Test that a manager restores the holders of the reopened store.
+	store, err = NewBoltStore(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	restored, err := NewManager(Config{Store: store, Clock: clock})
+	if err != nil {
+		t.Fatalf("Failed to restore manager: %v", err)
+	}
+
+	AssertPathLockedBy(t, restored, "a", ticketA.Id())
+	AssertPathLockedBy(t, restored, "s", ticketD.Id())
+	AssertPathLockedBy(t, restored, "b")
+
+	state, _ := restored.Inspect("s")
+	if state.Capacity != 2 || state.Holders[0].Fence != ticketD.Fence() {
+		t.Fatalf("Expected semaphore of 2 permits held with fence %d, got %+v", ticketD.Fence(), state)
+	}
+
+	// Test that expired holders are not restored, and that the store is rewritten accordingly.
+	restored.Stop()
+	clock.Advance(3 * time.Minute)
+
+	restored, _ = NewManager(Config{Store: store, Clock: clock})
+	restored.Stop()
+
+	AssertPathLockedBy(t, restored, "a")
+	AssertPathLockedBy(t, restored, "s", ticketD.Id())
+
+	if locks, _ := store.Load(); len(locks) != 1 || locks[0].Path != "s" {
+		t.Fatalf("Expected only the semaphore to be stored, got %+v", locks)
+	}
+}
@@ -0,0 +1,165 @@
+package locking
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spacemonkeygo/monotime"
+)
+
+// Clock.
+//
+// The source of time of a manager, which tells the wall clock and monotonic time, and schedules timeouts. Allows
+// tests to advance time deterministically by a mock clock, rather than relying on real delays.
+type Clock interface {
+	// Wall clock time.
+	Now() time.Time
+
+	// Monotonic time.
+	//
+	// The time elapsed since an arbitrary point, which is unaffected by changes of the wall clock.
+	Monotonic() time.Duration
+
+	// Await a duration.
+	//
+	// Returns a channel that receives the wall clock time once the duration has elapsed.
+	After(d time.Duration) <-chan time.Time
+
+	// Invoke a function after a duration.
+	//
+	// Invokes the function once the duration has elapsed, in a goroutine of its own unless documented otherwise.
+	AfterFunc(d time.Duration, f func())
+}
+
+// System clock.
+//
+// Tells the time of the system, and schedules timeouts by real timers.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Monotonic() time.Duration {
+	return monotime.Monotonic()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) {
+	time.AfterFunc(d, f)
+}
+
+// Mock clock.
+//
+// Time only passes as the clock is advanced. Functions scheduled by AfterFunc are invoked synchronously while
+// advancing the clock, in the order of their due times, so a manager using the clock performs its maintenance passes
+// before Advance returns. The mock clock is safe for concurrent use.
+type MockClock struct {
+	sync    sync.Mutex
+	now     time.Time
+	elapsed time.Duration
+	timers  []*mockTimer
+}
+
+// Timer of a mock clock.
+//
+// Either sends to the channel or invokes the function once due.
+type mockTimer struct {
+	at time.Duration
+	c  chan time.Time
+	f  func()
+}
+
+// New mock clock.
+//
+// The wall clock of the mock clock starts at the given time, and its monotonic time at zero.
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+func (c *MockClock) Now() time.Time {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	return c.now
+}
+
+func (c *MockClock) Monotonic() time.Duration {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	return c.elapsed
+}
+
+func (c *MockClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.schedule(&mockTimer{at: max(d, 0), c: ch})
+
+	return ch
+}
+
+func (c *MockClock) AfterFunc(d time.Duration, f func()) {
+	c.schedule(&mockTimer{at: max(d, 0), f: f})
+}
+
+// Schedule a timer.
+//
+// The due time of the timer is relative to the current time upon scheduling.
+func (c *MockClock) schedule(timer *mockTimer) {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	timer.at += c.elapsed
+	c.timers = append(c.timers, timer)
+
+	// Keep the timers in order of their due times, retaining the order of scheduling for equal due times.
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].at < c.timers[j].at
+	})
+}
+
+// Advance the clock.
+//
+// Advances the wall clock and monotonic time by the duration, firing the timers due in the meantime in order. Timers
+// scheduled by fired timers are fired as well if due before the end of the duration.
+func (c *MockClock) Advance(d time.Duration) {
+	c.sync.Lock()
+	until := c.elapsed + max(d, 0)
+
+	for len(c.timers) > 0 && c.timers[0].at <= until {
+		timer := c.timers[0]
+		c.timers = c.timers[1:]
+
+		c.now = c.now.Add(timer.at - c.elapsed)
+		c.elapsed = timer.at
+		now := c.now
+		c.sync.Unlock()
+
+		if timer.f != nil {
+			timer.f()
+		} else {
+			timer.c <- now
+		}
+
+		c.sync.Lock()
+	}
+
+	c.now = c.now.Add(until - c.elapsed)
+	c.elapsed = until
+	c.sync.Unlock()
+}
+
+// Set the wall clock.
+//
+// Sets the wall clock to the given time, leaving monotonic time and timers untouched, as when the system clock is
+// adjusted.
+func (c *MockClock) SetWall(now time.Time) {
+	c.sync.Lock()
+	defer c.sync.Unlock()
+
+	c.now = now
+}
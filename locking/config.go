@@ -1,7 +1,11 @@
 package locking
 
 import (
+	"log/slog"
+	"regexp"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Locking manager configuration.
@@ -10,4 +14,224 @@ type Config struct {
 	//
 	// Defaults to 10 milliseconds.
 	MaintenanceInterval time.Duration
+
+	// Maintenance jitter.
+	//
+	// Maximum random delay added to the scheduled maintenance of every expiring lease and acquisition, so many leases
+	// sharing the same timeout expire, and promote their successors, spread across maintenance passes rather than all
+	// at once. Leases may thus outlast their timeout by up to the jitter. Disabled by default.
+	MaintenanceJitter time.Duration
+
+	// Number of shards.
+	//
+	// If more than one, the paths are distributed across as many independent managers by consistent hashing, each with
+	// its own lock and maintenance, so acquisitions of different paths contend less for the manager. Operations
+	// spanning all paths, such as inspecting all locks, fan out to every shard, and deadlocks are detected with every
+	// shard locked at once. Callbacks may be invoked concurrently by different shards, and the paths retaining audit
+	// history are split evenly between the shards. Sharding does not support journals or the write-ahead log.
+	// Disabled by default.
+	Shards int
+
+	// Path normalization mode.
+	//
+	// Defaults to strict normalization.
+	PathNormalization PathNormalization
+
+	// Path pattern.
+	//
+	// The pattern that valid lock paths must match in their entirety, allowing a wider character set than the default,
+	// such as dots. Paths with empty, `.` or `..` segments are rejected regardless. Defaults to DefaultPathPattern.
+	PathPattern *regexp.Regexp
+
+	// Maximum path length.
+	//
+	// Paths longer than this many bytes result in ErrPathTooLong. Zero disables the limit, which is the default.
+	// DefaultMaxPathLength is a generous limit. Raw key paths are limited to DefaultMaxPathLength if the limit is
+	// disabled, see RawKeyPath.
+	MaxPathLength int
+
+	// Maximum number of path segments.
+	//
+	// Paths with more segments result in ErrPathTooLong. Zero disables the limit, which is the default.
+	// DefaultMaxPathSegments is a generous limit.
+	MaxPathSegments int
+
+	// Callbacks are optional, and are invoked outside of the manager's critical section, and thus may call back into
+	// the manager. Callbacks are invoked one at a time in the order of the events they represent, but may be invoked
+	// from any goroutine calling into the manager, including the maintenance goroutine, so they should return promptly.
+
+	// Path creation callback.
+	//
+	// Invoked when a lock path is first tracked by the manager.
+	OnPathCreated func(path string)
+
+	// Path deletion callback.
+	//
+	// Invoked when a lock path is no longer tracked by the manager.
+	OnPathDeleted func(path string)
+
+	// Acquisition callback.
+	//
+	// Invoked with the ID of the ticket when a lock is acquired without waiting. Re-entering a lock does not invoke it.
+	OnAcquire func(path string, id int64)
+
+	// Promotion callback.
+	//
+	// Invoked with the ID of the ticket when a waiting acquisition is promoted to hold the lock.
+	OnPromote func(path string, id int64)
+
+	// Release callback.
+	//
+	// Invoked with the ID of the ticket when a held lock is released, including by releasing all locks of an owner,
+	// but not when its lease expires.
+	OnRelease func(path string, id int64)
+
+	// Timeout callback.
+	//
+	// Invoked with the ID of the ticket when an acquisition times out, including acquisitions that cannot acquire the
+	// lock immediately and do not wait, or when the lease of a held lock expires.
+	OnTimeout func(path string, id int64)
+
+	// Abort deadlocked acquisitions.
+	//
+	// If set, deadlocks between owners are detected during maintenance, and the youngest waiting acquisition of each
+	// deadlock is aborted, ie. informed of failed acquisition. Deadlocks can only be detected between acquisitions with
+	// owner identities. Disabled by default.
+	AbortDeadlocks bool
+
+	// Minimum lease timeout.
+	//
+	// Lease timeouts below it, when acquiring or extending, are treated according to the timeout policy, preventing
+	// leases so short that they thrash the manager. Shortened leases are clamped to it regardless of the policy, unless
+	// shortened to zero. Disabled if zero.
+	MinLeaseTimeout time.Duration
+
+	// Maximum lease timeout.
+	//
+	// Lease timeouts above it, including infinite lease timeouts, are treated according to the timeout policy when
+	// acquiring or extending, preventing leases that pin locks for too long. Shortening a lease is unaffected by the
+	// limits. Disabled if zero.
+	MaxLeaseTimeout time.Duration
+
+	// Maximum total hold time.
+	//
+	// Hard ceiling on how long a single ticket may hold a lock, measured from its acquisition, no matter how often its
+	// lease is extended. Extensions past it fail with ErrHoldTimeExceeded, leaving the lease to expire as usual, and
+	// leases of acquisitions, including infinite leases, are capped at it. Disabled if zero.
+	MaxTotalHoldTime time.Duration
+
+	// Maximum lock timeout.
+	//
+	// Lock timeouts above it are treated according to the timeout policy. Disabled if zero.
+	MaxLockTimeout time.Duration
+
+	// Default lock timeout.
+	//
+	// Applies to acquisitions over the APIs that omit a lock timeout, which are rejected if zero. A lock timeout given
+	// by the acquisition always takes precedence, and the default is subject to the limits and timeout policy like any
+	// other lock timeout.
+	DefaultLockTimeout time.Duration
+
+	// Default lease timeout.
+	//
+	// Applies to acquisitions over the APIs that omit a lease timeout, which are rejected if zero. A negative default
+	// is infinite. A lease timeout given by the acquisition always takes precedence, and the default is subject to the
+	// limits, timeout policy and namespace caps like any other lease timeout.
+	DefaultLeaseTimeout time.Duration
+
+	// Timeout policy.
+	//
+	// Whether timeouts out of range are clamped to the nearest limit, or rejected. Defaults to clamping.
+	TimeoutPolicy TimeoutPolicy
+
+	// Ticket ID strategy.
+	//
+	// Whether ticket IDs are sequential, or random so they cannot be guessed. Defaults to sequential.
+	IDStrategy IDStrategy
+
+	// Fairness policy.
+	//
+	// Whether acquisitions may take a lock whose leases have lapsed ahead of the waiting tickets, or are queued behind
+	// them. Defaults to strict first-in, first-out handoff.
+	Fairness Fairness
+
+	// Default namespace configuration.
+	//
+	// Configures the default namespace of single segment paths, as well as any namespace without a configuration of
+	// its own. Imposes no limits by default.
+	DefaultNamespace NamespaceConfig
+
+	// Namespace configuration.
+	//
+	// Overrides the default namespace configuration by namespace, ie. the first segment of paths with more than one
+	// segment, so teams sharing a manager can be isolated from each other.
+	Namespaces map[string]NamespaceConfig
+
+	// Write-ahead log path.
+	//
+	// If set, the holders of locks are journaled to an append-only log at the path, which is replayed when the manager
+	// is created, restoring the locks along with their remaining lease timeouts. Leases that expired in the meantime
+	// are dropped. Waiting acquisitions are not journaled. Disabled by default.
+	WALPath string
+
+	// Journal.
+	//
+	// If set, the holders of locks are journaled to it in place of the write-ahead log, such as to replicate them, and
+	// restored from it when the manager is created. Takes precedence over WALPath. Disabled by default.
+	Journal Journal
+
+	// Lock store.
+	//
+	// If set, the locks are written to it, and their holders restored from it when the manager is created, unless
+	// restored from the journal. A store may not be shared between managers. Disabled by default.
+	Store Store
+
+	// Write-ahead log compaction interval.
+	//
+	// The interval at which the write-ahead log, or journal, is replaced by a snapshot of the current lock holders.
+	// Defaults to 1 minute. Compaction is disabled if negative, such as for journals that compact themselves.
+	WALCompactionInterval time.Duration
+
+	// Audit history size.
+	//
+	// The number of most recent lifecycle events retained per path for auditing, such as acquisitions, releases, lease
+	// changes and timeouts, along with the owners and labels of the tickets. Disabled if zero, which is the default.
+	AuditHistorySize int
+
+	// Number of paths retaining audit history.
+	//
+	// Once exceeded, the history of the path least recently audited is evicted, bounding the memory of auditing.
+	// Defaults to DefaultAuditHistoryPaths.
+	AuditHistoryPaths int
+
+	// Hold histogram mode.
+	//
+	// Records the durations locks are held for in histograms, labeled by the mode, such as for tracking service level
+	// objectives. Labeling by path retains a histogram per path ever locked, so labeling by namespace or aggregating
+	// bounds the memory of histograms. Disabled by default.
+	HoldHistogram HoldHistogramMode
+
+	// Hold histogram buckets.
+	//
+	// The upper bounds of the buckets of hold histograms. Defaults to DefaultHoldHistogramBuckets.
+	HoldHistogramBuckets []time.Duration
+
+	// Tracer provider.
+	//
+	// If set, the handoff chains of contended paths are traced. A span of a path is started once a waiting ticket is
+	// first promoted, and lasts until the lock is free of tickets, while every promotion is recorded as a child span
+	// covering the wait of the promoted ticket. Disabled by default.
+	TracerProvider trace.TracerProvider
+
+	// Logger.
+	//
+	// Lock lifecycle events, such as acquisitions, releases and timeouts, are logged at debug and info level, while
+	// maintenance failures are logged at error level. Defaults to discarding logs.
+	Logger *slog.Logger
+
+	// Clock.
+	//
+	// The source of time of the manager, by which leases and acquisitions time out and maintenance is scheduled.
+	// Tests may provide a MockClock to advance time deterministically. Defaults to the system clock.
+	Clock Clock
 }
@@ -0,0 +1,222 @@
+package locking
+
+import (
+	"sort"
+)
+
+// Wait-for graph.
+//
+// The nodes of the graph are the waiting tickets with owners, and an edge from one ticket to another indicates that
+// the former cannot acquire its lock before the latter has acquired its lock. This is the case if the latter is
+// queued ahead of the former, or if the owner of the latter holds the lock the former is waiting for.
+type waitForGraph struct {
+	nodes    []*ticketImpl
+	paths    map[*ticketImpl]string
+	managers map[*ticketImpl]*managerImpl
+	edges    map[*ticketImpl][]*ticketImpl
+}
+
+// Lock of a wait-for graph.
+type waitForLock struct {
+	path    string
+	lock    *lockImpl
+	manager *managerImpl
+}
+
+// Build the wait-for graph.
+//
+// This assumes exclusive lock to the manager is provided during the process.
+func (m *managerImpl) waitForGraph() *waitForGraph {
+	return newWaitForGraph([]*managerImpl{m})
+}
+
+// Build the wait-for graph of multiple managers.
+//
+// The graph spans the locks of all managers, so deadlocks between owners waiting for locks of different managers are
+// found alike. This assumes exclusive lock to every manager is provided during the process.
+func newWaitForGraph(managers []*managerImpl) *waitForGraph {
+	g := &waitForGraph{
+		paths:    make(map[*ticketImpl]string),
+		managers: make(map[*ticketImpl]*managerImpl),
+		edges:    make(map[*ticketImpl][]*ticketImpl),
+	}
+
+	// Determine the waiting tickets of each owner, visiting the paths in sorted order for determinism.
+	var locks []waitForLock
+	for _, m := range managers {
+		for path, lock := range m.locks {
+			locks = append(locks, waitForLock{path: path, lock: lock, manager: m})
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].path < locks[j].path
+	})
+
+	waitingByOwner := make(map[string][]*ticketImpl)
+
+	for _, waitFor := range locks {
+		lock := waitFor.lock
+		for _, ticket := range lock.tickets[lock.holderCount():] {
+			if ticket.owner != "" {
+				g.nodes = append(g.nodes, ticket)
+				g.paths[ticket] = waitFor.path
+				g.managers[ticket] = waitFor.manager
+				waitingByOwner[ticket.owner] = append(waitingByOwner[ticket.owner], ticket)
+			}
+		}
+	}
+
+	// Add the edges of each waiting ticket.
+	for _, waitFor := range locks {
+		lock := waitFor.lock
+		holderCount := lock.holderCount()
+
+		for idx, ticket := range lock.tickets[holderCount:] {
+			if ticket.owner == "" {
+				continue
+			}
+
+			for _, holder := range lock.tickets[:holderCount] {
+				if holder.owner != "" {
+					g.edges[ticket] = append(g.edges[ticket], waitingByOwner[holder.owner]...)
+				}
+			}
+
+			for _, ahead := range lock.tickets[holderCount : holderCount+idx] {
+				if ahead.owner != "" {
+					g.edges[ticket] = append(g.edges[ticket], ahead)
+				}
+			}
+		}
+	}
+
+	return g
+}
+
+// Find the deadlocks of the graph.
+//
+// Returns the strongly connected components of the graph that contain a cycle, using Tarjan's algorithm.
+func (g *waitForGraph) deadlocks() [][]*ticketImpl {
+	var deadlocks [][]*ticketImpl
+	var stack []*ticketImpl
+
+	index := make(map[*ticketImpl]int, len(g.nodes))
+	lowLink := make(map[*ticketImpl]int, len(g.nodes))
+	onStack := make(map[*ticketImpl]bool, len(g.nodes))
+
+	var connect func(ticket *ticketImpl)
+	connect = func(ticket *ticketImpl) {
+		index[ticket] = len(index)
+		lowLink[ticket] = index[ticket]
+		stack = append(stack, ticket)
+		onStack[ticket] = true
+
+		selfLoop := false
+
+		for _, next := range g.edges[ticket] {
+			if next == ticket {
+				selfLoop = true
+			}
+
+			if _, ok := index[next]; !ok {
+				connect(next)
+				if lowLink[next] < lowLink[ticket] {
+					lowLink[ticket] = lowLink[next]
+				}
+			} else if onStack[next] && index[next] < lowLink[ticket] {
+				lowLink[ticket] = index[next]
+			}
+		}
+
+		if lowLink[ticket] != index[ticket] {
+			return
+		}
+
+		// Pop the component off the stack.
+		var component []*ticketImpl
+
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+
+			if top == ticket {
+				break
+			}
+		}
+
+		if len(component) > 1 || selfLoop {
+			deadlocks = append(deadlocks, component)
+		}
+	}
+
+	for _, ticket := range g.nodes {
+		if _, ok := index[ticket]; !ok {
+			connect(ticket)
+		}
+	}
+
+	return deadlocks
+}
+
+func (m *managerImpl) DetectDeadlocks() ([][]int64, error) {
+	// Lock the manager.
+	m.sync.Lock()
+	defer m.unlock()
+
+	return m.waitForGraph().deadlockIds(), nil
+}
+
+// Ticket IDs of the deadlocks of the graph.
+//
+// The IDs of each deadlock are sorted, and the deadlocks are sorted by their lowest ID.
+func (g *waitForGraph) deadlockIds() [][]int64 {
+	deadlocks := g.deadlocks()
+	result := make([][]int64, len(deadlocks))
+
+	for idx, deadlock := range deadlocks {
+		ids := make([]int64, len(deadlock))
+		for ticketIdx, ticket := range deadlock {
+			ids[ticketIdx] = ticket.id
+		}
+
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i] < ids[j]
+		})
+
+		result[idx] = ids
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i][0] < result[j][0]
+	})
+
+	return result
+}
+
+// Abort deadlocked acquisitions.
+//
+// This assumes exclusive lock to the manager is provided during the process.
+func (m *managerImpl) abortDeadlockedAcquisitions() {
+	m.waitForGraph().abortDeadlocks()
+}
+
+// Abort the deadlocked acquisitions of the graph.
+//
+// Aborts the youngest waiting acquisition, ie. the one with the highest ticket ID, of each deadlock by the manager of
+// its lock. This assumes exclusive lock to the managers of the graph is provided during the process.
+func (g *waitForGraph) abortDeadlocks() {
+	for _, deadlock := range g.deadlocks() {
+		youngest := deadlock[0]
+		for _, ticket := range deadlock[1:] {
+			if ticket.id > youngest.id {
+				youngest = ticket
+			}
+		}
+
+		m := g.managers[youngest]
+		m.logger.Warn("Aborting deadlocked acquisition", "path", g.paths[youngest], "id", youngest.id, "deadlock_size", len(deadlock))
+		m.abortAcquisition(g.paths[youngest], youngest)
+	}
+}
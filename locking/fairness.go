@@ -0,0 +1,70 @@
+package locking
+
+// Fairness policy.
+//
+// Determines whether acquisitions may take a lock ahead of waiting tickets at the boundary of a handoff, ie. once the
+// leases of all holders have lapsed, but before the waiting tickets have been promoted by maintenance.
+type Fairness int
+
+const (
+	// Fair policy.
+	//
+	// Strict first-in, first-out handoff: an acquisition finding the leases of the holders lapsed promotes the waiting
+	// tickets right away, and is queued behind them. This is the default.
+	FairnessFair Fairness = iota
+
+	// Barging policy.
+	//
+	// An acquisition finding the leases of all holders lapsed takes the momentarily free lock ahead of the waiting
+	// tickets, which keep waiting behind it. Explicit releases always hand the lock off to the waiting tickets
+	// directly, regardless of the policy.
+	FairnessBarging
+)
+
+// Settle a lock before an acquisition.
+//
+// Expires the lapsed leases and acquisitions of the path if any lease has lapsed, so the acquisition does not mistake a
+// lock as held until the next maintenance pass. Under the fair policy, the waiting tickets are promoted right away.
+// Under the barging policy, they are left for the next maintenance pass of the path to promote, unless the
+// acquisition takes the lock first. This assumes lock to the path is provided during the process.
+func (m *managerImpl) settle(path string) {
+	now := m.clock.Monotonic()
+
+	curLock, ok := m.lockOf(path)
+	if !ok || !curLock.lapsed(now) {
+		return
+	}
+
+	if m.fairness != FairnessBarging {
+		m.maintainPath(path)
+		return
+	}
+
+	nextTickets := m.expireTickets(path, curLock, now)
+
+	if len(nextTickets) == 0 {
+		m.deleteLock(path)
+	} else {
+		m.setLock(path, &lockImpl{
+			tickets: nextTickets,
+			fence:   curLock.fence,
+		})
+		m.scheduleMaintenance(path, 0)
+	}
+}
+
+// Test if a ticket can join the holders of a lock immediately.
+//
+// As per lockImpl.admits, except that under the barging policy, a lock without holders admits the ticket even if there
+// are waiting tickets. The lock may be nil.
+func (m *managerImpl) admits(lock *lockImpl, mode LockMode) bool {
+	if lock == nil {
+		return true
+	}
+
+	if m.fairness == FairnessBarging && lock.holderCount() == 0 {
+		return true
+	}
+
+	return lock.admits(mode)
+}
@@ -0,0 +1,226 @@
+package locking
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Hold histogram mode.
+//
+// Determines whether the durations locks are held for are recorded, and how they are labeled, which bounds the number
+// of histograms retained by the manager.
+type HoldHistogramMode int
+
+const (
+	// Hold durations are not recorded. This is the default.
+	HoldHistogramDisabled HoldHistogramMode = iota
+
+	// Hold durations are recorded in a single histogram for all paths.
+	HoldHistogramAggregate
+
+	// Hold durations are recorded in a histogram per namespace, see PathNamespace.
+	HoldHistogramByNamespace
+
+	// Hold durations are recorded in a histogram per path.
+	//
+	// Histograms are retained for the lifetime of the manager, so their number grows with the number of paths ever
+	// locked.
+	HoldHistogramByPath
+)
+
+// Default bucket bounds of hold histograms.
+var DefaultHoldHistogramBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+}
+
+// Hold histogram.
+//
+// The distribution of the durations tickets held locks for, recorded once they stopped holding them, whether by
+// release or lease expiry.
+type HoldHistogram struct {
+	// Name of the label.
+	//
+	// Either path or namespace, depending on the mode, or empty if the histogram aggregates all paths.
+	LabelName string
+
+	// Value of the label.
+	Label string
+
+	// Upper bounds of the buckets, in ascending order.
+	Buckets []time.Duration
+
+	// Cumulative counts of the buckets.
+	//
+	// The number of recorded durations not exceeding the upper bound of each bucket.
+	Counts []uint64
+
+	// Number of recorded durations.
+	Count uint64
+
+	// Sum of the recorded durations.
+	Sum time.Duration
+}
+
+// Hold histograms.
+//
+// Records hold durations by label. Guarded by a mutex of its own, as durations are recorded by operations on
+// different paths concurrently.
+type holdHistograms struct {
+	sync       sync.Mutex
+	mode       HoldHistogramMode
+	buckets    []time.Duration
+	histograms map[string]*holdHistogram
+}
+
+// Hold histogram of a label.
+//
+// The counts of the buckets are not cumulative, and followed by the count of durations exceeding the last bucket.
+type holdHistogram struct {
+	counts []uint64
+	sum    time.Duration
+}
+
+// New hold histograms.
+//
+// Returns nil if the mode is disabled, which records nothing.
+func newHoldHistograms(mode HoldHistogramMode, buckets []time.Duration) *holdHistograms {
+	if mode == HoldHistogramDisabled {
+		return nil
+	}
+
+	if len(buckets) == 0 {
+		buckets = DefaultHoldHistogramBuckets
+	}
+
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+
+	return &holdHistograms{
+		mode:       mode,
+		buckets:    slices.Compact(buckets),
+		histograms: make(map[string]*holdHistogram),
+	}
+}
+
+// Record a hold duration of a path.
+func (h *holdHistograms) record(path string, held time.Duration) {
+	if h == nil {
+		return
+	}
+
+	label := ""
+	switch h.mode {
+	case HoldHistogramByNamespace:
+		label = PathNamespace(path)
+	case HoldHistogramByPath:
+		label = path
+	}
+
+	h.sync.Lock()
+	defer h.sync.Unlock()
+
+	histogram, ok := h.histograms[label]
+	if !ok {
+		histogram = &holdHistogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.histograms[label] = histogram
+	}
+
+	idx, _ := slices.BinarySearch(h.buckets, held)
+	histogram.counts[idx]++
+	histogram.sum += held
+}
+
+// Snapshot the histograms.
+//
+// Returns the histograms in order of their labels.
+func (h *holdHistograms) snapshot() []HoldHistogram {
+	if h == nil {
+		return nil
+	}
+
+	labelName := ""
+	switch h.mode {
+	case HoldHistogramByNamespace:
+		labelName = "namespace"
+	case HoldHistogramByPath:
+		labelName = "path"
+	}
+
+	h.sync.Lock()
+	defer h.sync.Unlock()
+
+	snapshot := make([]HoldHistogram, 0, len(h.histograms))
+
+	for label, histogram := range h.histograms {
+		counts := make([]uint64, len(h.buckets))
+		count := uint64(0)
+
+		for idx, bucketCount := range histogram.counts {
+			count += bucketCount
+			if idx < len(counts) {
+				counts[idx] = count
+			}
+		}
+
+		snapshot = append(snapshot, HoldHistogram{
+			LabelName: labelName,
+			Label:     label,
+			Buckets:   h.buckets,
+			Counts:    counts,
+			Count:     count,
+			Sum:       histogram.sum,
+		})
+	}
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].Label < snapshot[j].Label
+	})
+
+	return snapshot
+}
+
+// Merge hold histograms.
+//
+// Merges histograms of equal labels and buckets, such as of the shards of a manager, in order of their labels.
+func mergeHoldHistograms(histograms []HoldHistogram) []HoldHistogram {
+	merged := make(map[string]*HoldHistogram)
+
+	for _, histogram := range histograms {
+		existing, ok := merged[histogram.Label]
+		if !ok {
+			histogram.Counts = slices.Clone(histogram.Counts)
+			merged[histogram.Label] = &histogram
+			continue
+		}
+
+		for idx, count := range histogram.Counts {
+			existing.Counts[idx] += count
+		}
+		existing.Count += histogram.Count
+		existing.Sum += histogram.Sum
+	}
+
+	result := make([]HoldHistogram, 0, len(merged))
+	for _, histogram := range merged {
+		result = append(result, *histogram)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Label < result[j].Label
+	})
+
+	return result
+}
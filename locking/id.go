@@ -0,0 +1,139 @@
+package locking
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Invalid external ID.
+//
+// Returned when parsing an external ID that is neither a positive base-10 ID nor a UUID of a ticket ID.
+var ErrInvalidExternalId = errors.New("invalid external ID")
+
+// Ticket ID strategy.
+//
+// Determines how the IDs of new tickets are generated. IDs are always positive.
+type IDStrategy int
+
+const (
+	// Sequential strategy.
+	//
+	// The first ID is seeded randomly, and every subsequent ticket is assigned the next ID. IDs are thus cheap to
+	// generate, but can be guessed from one another. This is the default.
+	IDStrategySequential IDStrategy = iota
+
+	// Random strategy.
+	//
+	// Every ticket is assigned 63 random bits drawn from a cryptographically secure source, so IDs cannot be guessed
+	// from one another, and collisions, whether among the tickets of a manager or across restarts, are negligible.
+	IDStrategyRandom
+
+	// UUID strategy.
+	//
+	// Every ticket is assigned a random ID like the random strategy, and is identified externally by a UUID encoding
+	// its ID, as formatted by ExternalId. IDs thus remain integers within the manager, its journals and snapshots, and
+	// restored tickets keep their UUIDs.
+	IDStrategyUUID
+)
+
+// Number of bits of the checksum of a ticket ID in its UUID.
+const uuidChecksumBits = 59
+
+// External ID of a ticket.
+//
+// Formats the ID as a UUID for the UUID strategy, and as a base-10 string otherwise. The UUID is of version 8, whose
+// 122 bits free for custom use hold the 63 bits of the ID followed by a checksum of the ID, so every ID has exactly one
+// UUID, and the ID is recovered from its UUID by ParseExternalId.
+func ExternalId(id int64, strategy IDStrategy) string {
+	if strategy != IDStrategyUUID {
+		return strconv.FormatInt(id, 10)
+	}
+
+	value := uint64(id)
+	high := value>>15<<16 | 0x8<<12 | value>>3&0xfff
+	low := 0x2<<62 | value&0x7<<uuidChecksumBits | idChecksum(id)
+
+	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x", high>>32, high>>16&0xffff, high&0xffff, low>>48, low&0xffffffffffff)
+}
+
+// Parse an external ID.
+//
+// Accepts external IDs of any strategy, ie. positive base-10 IDs and UUIDs of IDs, and returns the ID.
+func ParseExternalId(externalId string) (int64, error) {
+	if !strings.Contains(externalId, "-") {
+		id, err := strconv.ParseInt(externalId, 10, 64)
+		if err != nil || id <= 0 {
+			return 0, ErrInvalidExternalId
+		}
+
+		return id, nil
+	}
+
+	// Parse the canonical form of a UUID, of hexadecimal groups of 8, 4, 4, 4 and 12 digits.
+	if len(externalId) != 36 || externalId[8] != '-' || externalId[13] != '-' || externalId[18] != '-' || externalId[23] != '-' {
+		return 0, ErrInvalidExternalId
+	}
+
+	buf, err := hex.DecodeString(externalId[0:8] + externalId[9:13] + externalId[14:18] + externalId[19:23] + externalId[24:])
+	if err != nil {
+		return 0, ErrInvalidExternalId
+	}
+
+	high := binary.BigEndian.Uint64(buf[:8])
+	low := binary.BigEndian.Uint64(buf[8:])
+	if high>>12&0xf != 0x8 || low>>62 != 0x2 {
+		return 0, ErrInvalidExternalId
+	}
+
+	id := int64(high>>16<<15 | high&0xfff<<3 | low>>uuidChecksumBits&0x7)
+	if id <= 0 || low&(1<<uuidChecksumBits-1) != idChecksum(id) {
+		return 0, ErrInvalidExternalId
+	}
+
+	return id, nil
+}
+
+// Checksum of a ticket ID in its UUID.
+func idChecksum(id int64) uint64 {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(id))
+
+	hash := fnv.New64a()
+	hash.Write(buf[:])
+
+	return hash.Sum64() & (1<<uuidChecksumBits - 1)
+}
+
+// Generate a ticket ID.
+func (m *managerImpl) nextId() int64 {
+	if m.idStrategy == IDStrategyRandom || m.idStrategy == IDStrategyUUID {
+		var buf [8]byte
+
+		for {
+			rand.Read(buf[:])
+
+			if id := int64(binary.BigEndian.Uint64(buf[:]) & math.MaxInt64); id > 0 {
+				return id
+			}
+		}
+	}
+
+	m.sequenceSync.Lock()
+	defer m.sequenceSync.Unlock()
+
+	if m.nextTicketId < 1 {
+		m.nextTicketId = 1
+	}
+
+	id := m.nextTicketId
+	m.nextTicketId++
+
+	return id
+}
@@ -0,0 +1,136 @@
+package locking
+
+import (
+	"math"
+	"time"
+)
+
+// Journal.
+//
+// Journals the holders of locks, such as to make them durable or to replicate them, so they can be restored by a
+// manager created subsequently. Waiting acquisitions are not journaled, as the acquirers waiting for them do not
+// survive the manager either. The write-ahead log is a journal of a local file.
+type Journal interface {
+	// Restore the holders.
+	//
+	// Returns the records of the holders whose leases have not expired by the given time, in order of acquisition.
+	// Invoked once when the manager is created.
+	Restore(now time.Time) ([]JournalRecord, error)
+
+	// Append a record.
+	//
+	// Invoked while the path of the record is locked, once a change of the holders is decided, but before it takes
+	// effect, so a failure aborts the change. The records of a path are appended one at a time, in order, whereas
+	// records of different paths may be appended concurrently.
+	Append(record JournalRecord) error
+
+	// Compact the journal.
+	//
+	// Invoked at the compaction interval with the records of the current holders, which replace the journal. Not
+	// invoked if compaction is disabled, such as for journals that compact themselves.
+	Compact(holders []JournalRecord) error
+}
+
+// Journal operation.
+type JournalOp string
+
+const (
+	// A ticket started holding a lock.
+	JournalOpHold JournalOp = "hold"
+
+	// The lease of a holder changed.
+	JournalOpLease JournalOp = "lease"
+
+	// The hold count of a re-entrant holder changed.
+	JournalOpHoldCount JournalOp = "hold_count"
+
+	// The lock mode, and thus the fencing token, of a holder changed.
+	JournalOpMode JournalOp = "mode"
+
+	// A holder stopped holding a lock, either by release or lease expiry.
+	JournalOpRelease JournalOp = "release"
+)
+
+// Journal record.
+//
+// Lease timeouts are journaled as wall clock timestamps, as monotonic timestamps do not survive a restart.
+type JournalRecord struct {
+	Op         JournalOp         `json:"op"`
+	Path       string            `json:"path"`
+	Id         int64             `json:"id"`
+	Mode       LockMode          `json:"mode,omitempty"`
+	Fence      int64             `json:"fence,omitempty"`
+	Owner      string            `json:"owner,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	HoldCount  int               `json:"hold_count,omitempty"`
+	LeaseUntil int64             `json:"lease_until,omitempty"`
+}
+
+// Wall clock lease timeout of a lease that never expires.
+const JournalLeaseNever = math.MaxInt64
+
+// Wall clock lease timeout.
+//
+// Returns the wall clock timestamp at which a lease with the given timeout from now expires.
+func journalLeaseUntil(now time.Time, timeout time.Duration) int64 {
+	if timeout < 0 {
+		return JournalLeaseNever
+	}
+
+	return now.Add(timeout).UnixNano()
+}
+
+// Wall clock lease timeout of a monotonic lease timeout.
+//
+// Returns the wall clock timestamp at which a lease expiring at the given monotonic timestamp expires.
+func wallLeaseUntil(leaseTimeoutAt time.Duration, monotimeNow time.Duration, wallNow time.Time) int64 {
+	if leaseTimeoutAt == leaseNever {
+		return JournalLeaseNever
+	}
+
+	return wallNow.Add(leaseTimeoutAt - monotimeNow).UnixNano()
+}
+
+// Apply a journal record.
+//
+// Applies a record to the records of holders it follows in the journal, returning the records of the holders it
+// leaves, in order of acquisition.
+func ApplyJournalRecord(holders []JournalRecord, record JournalRecord) []JournalRecord {
+	if record.Op == JournalOpHold {
+		return append(holders, record)
+	}
+
+	for idx := range holders {
+		if holders[idx].Path != record.Path || holders[idx].Id != record.Id {
+			continue
+		}
+
+		switch record.Op {
+		case JournalOpLease:
+			holders[idx].LeaseUntil = record.LeaseUntil
+		case JournalOpHoldCount:
+			holders[idx].HoldCount = record.HoldCount
+		case JournalOpMode:
+			holders[idx].Mode = record.Mode
+			holders[idx].Fence = record.Fence
+		case JournalOpRelease:
+			return append(holders[:idx], holders[idx+1:]...)
+		}
+	}
+
+	return holders
+}
+
+// Expire journaled holders.
+//
+// Drops the records of the holders whose leases have expired by the given time.
+func ExpireJournalHolders(holders []JournalRecord, now time.Time) []JournalRecord {
+	live := holders[:0]
+	for _, holder := range holders {
+		if holder.LeaseUntil > now.UnixNano() {
+			live = append(live, holder)
+		}
+	}
+
+	return live
+}
@@ -1,8 +1,138 @@
 package locking
 
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Lock mode.
+type LockMode int
+
+const (
+	// Exclusive lock mode.
+	//
+	// An exclusive lock is held by a single ticket at a time. This is the default.
+	ModeExclusive LockMode = iota
+
+	// Shared lock mode.
+	//
+	// A shared lock may be held by any number of tickets at a time, as long as it is not held exclusively. Shared
+	// acquisitions queue behind any waiting exclusive acquisitions, so exclusive acquirers are not starved.
+	ModeShared
+)
+
+func (m LockMode) String() string {
+	if m == ModeShared {
+		return "shared"
+	}
+
+	return "exclusive"
+}
+
 // Lock.
 //
-// Represents the state of a single lock.
+// Represents the state of a single lock. The tickets holding the lock always make up the head of the tickets, and are
+// either a single exclusive ticket or any number of shared tickets.
 type lockImpl struct {
 	tickets []*ticketImpl
+
+	// Fencing token of the most recent acquisition.
+	fence int64
+
+	// Generation of the state.
+	generation int64
+
+	// Semaphore capacity.
+	//
+	// The maximum number of tickets holding the lock in shared mode at a time. Zero if the lock is not a semaphore, in
+	// which case the number of shared holders is unlimited. Carried over to the following states of the lock until it
+	// is deleted.
+	capacity int
+
+	// Trace span of the handoff chain of the path.
+	//
+	// Only set once a waiting ticket is promoted while handoffs are traced, and carried over to the following states of
+	// the lock until it is deleted.
+	span trace.Span
+}
+
+// Number of tickets holding the lock.
+func (l *lockImpl) holderCount() int {
+	count := 0
+	for count < len(l.tickets) && l.tickets[count].leaseTimeoutAt > 0 {
+		count++
+	}
+
+	return count
+}
+
+// Test if a ticket can join the holders of the lock immediately.
+//
+// This is only the case if the lock is not held, or if both the lock and the ticket are shared and there are neither
+// waiting tickets nor a holder waiting to upgrade the lock, nor, for semaphores, as many holders as the capacity.
+func (l *lockImpl) admits(mode LockMode) bool {
+	holderCount := l.holderCount()
+
+	if holderCount == 0 {
+		return len(l.tickets) == 0
+	}
+
+	return mode == ModeShared && l.tickets[0].mode == ModeShared && holderCount == len(l.tickets) && l.upgrader() == nil &&
+		(l.capacity <= 0 || holderCount < l.capacity)
+}
+
+// Signal contention to the holders of the lock.
+//
+// Only signals if tickets wait for the lock. This assumes lock to the path is provided during the process.
+func (l *lockImpl) contend() {
+	holderCount := l.holderCount()
+	if holderCount == len(l.tickets) {
+		return
+	}
+
+	for _, ticket := range l.tickets[:holderCount] {
+		ticket.contend()
+	}
+}
+
+// Test if the lease of any holder of the lock has lapsed by the given time.
+func (l *lockImpl) lapsed(now time.Duration) bool {
+	for _, ticket := range l.tickets[:l.holderCount()] {
+		if ticket.leaseTimeoutAt > 0 && ticket.leaseTimeoutAt <= now {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Find the holder waiting to upgrade the lock.
+//
+// Returns nil if no holder is waiting to upgrade the lock.
+func (l *lockImpl) upgrader() *ticketImpl {
+	for _, ticket := range l.tickets[:l.holderCount()] {
+		if ticket.upgradeChan != nil {
+			return ticket
+		}
+	}
+
+	return nil
+}
+
+// Find the holder owned by an owner.
+//
+// Returns nil if the owner is not set, or if the lock is not held by the owner. The lock may be nil.
+func (l *lockImpl) holderOwnedBy(owner string) *ticketImpl {
+	if l == nil || owner == "" {
+		return nil
+	}
+
+	for _, ticket := range l.tickets[:l.holderCount()] {
+		if ticket.owner == owner {
+			return ticket
+		}
+	}
+
+	return nil
 }
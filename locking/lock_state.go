@@ -9,34 +9,222 @@ type LockAcquirerState struct {
 	// ID.
 	Id int64
 
+	// Mode.
+	Mode LockMode
+
+	// Owner identity.
+	Owner string
+
+	// Labels.
+	//
+	// Shared with the ticket, and must not be modified.
+	Labels map[string]string
+
 	// Timeout.
 	Timeout time.Duration
+
+	// Lease timeout.
+	//
+	// The lease timeout requested by the acquirer, which applies once the lock is acquired. InfiniteTimeout if the
+	// lease never expires.
+	LeaseTimeout time.Duration
+
+	// Waiting duration.
+	//
+	// The time since the acquirer was enqueued.
+	WaitingFor time.Duration
+}
+
+// Lock holder state.
+type LockHolderState struct {
+	// ID.
+	Id int64
+
+	// Fencing token.
+	Fence int64
+
+	// Owner identity.
+	Owner string
+
+	// Labels.
+	//
+	// Shared with the ticket, and must not be modified.
+	Labels map[string]string
+
+	// Re-entrancy depth.
+	//
+	// The number of holds of the holder, which is greater than one if the lock has been re-entered.
+	Depth int
+
+	// Lease timeout.
+	//
+	// InfiniteTimeout if the lease never expires.
+	Timeout time.Duration
+
+	// Holding duration.
+	//
+	// The time since the holder acquired the lock.
+	HeldFor time.Duration
+
+	// Holding start.
+	//
+	// The wall clock time at which the holder acquired the lock.
+	HeldSince time.Time
+
+	// Lease expiry.
+	//
+	// The wall clock time at which the lease expires, derived from the remaining lease timeout. Zero if the lease never
+	// expires.
+	ExpiresAt time.Time
 }
 
 // Lock state.
 type LockState struct {
 	// Locking lease ID.
 	//
-	// Zero if the lock is not currently held.
+	// The ID of the longest standing holder of the lock. Zero if the lock is not currently held.
 	LockingId int64
 
 	// Lock timeout.
+	//
+	// The lease timeout of the longest standing holder of the lock. InfiniteTimeout if the lease never expires.
 	LockTimeout time.Duration
 
+	// Mode.
+	Mode LockMode
+
+	// Fencing token.
+	//
+	// The fencing token of the most recent acquisition of the lock.
+	Fence int64
+
+	// Generation.
+	//
+	// Changes whenever the state of the lock changes, except for the remaining timeouts, which change continuously,
+	// and never repeats for a path, even if the lock is deleted and subsequently recreated. Generations are drawn from
+	// a single counter for all paths, seeded by the wall clock, so they are unlikely to repeat across restarts either.
+	// Equal generations of a path thus indicate an unchanged state.
+	Generation int64
+
+	// Re-entrancy depth.
+	//
+	// The number of holds of the longest standing holder of the lock.
+	Depth int
+
+	// Holding duration.
+	//
+	// The time since the longest standing holder of the lock acquired it.
+	HeldFor time.Duration
+
+	// Holding start.
+	//
+	// The wall clock time at which the longest standing holder of the lock acquired it.
+	HeldSince time.Time
+
+	// Lease expiry.
+	//
+	// The wall clock time at which the lease of the longest standing holder of the lock expires, derived from the
+	// remaining lease timeout. Zero if the lease never expires.
+	ExpiresAt time.Time
+
+	// Holders.
+	//
+	// All current holders of the lock, of which there can be multiple if the lock is held in shared mode.
+	Holders []LockHolderState
+
 	// Waiting acquirers.
+	//
+	// The acquirers waiting for the lock in order, limited to the first acquirers if inspected with a limit.
 	Acquirers []LockAcquirerState
+
+	// Total number of waiting acquirers.
+	//
+	// Includes the acquirers beyond the limit of an inspection.
+	AcquirersTotal int
+
+	// Semaphore capacity.
+	//
+	// The maximum number of tickets holding the lock in shared mode at a time. Zero if the lock is not a semaphore.
+	Capacity int
+
+	// Remaining permits.
+	//
+	// The number of further tickets the semaphore admits in shared mode. Zero if the lock is not a semaphore, or is
+	// held exclusively.
+	Permits int
 }
 
 // Lock state from lock.
-func lockStateFromLock(lock *lockImpl, monotimeNow time.Duration) (state LockState) {
+//
+// Only includes the first acquirers up to the limit if positive.
+func lockStateFromLock(lock *lockImpl, monotimeNow time.Duration, wallNow time.Time, acquirersLimit int) (state LockState) {
+	holderCount := lock.holderCount()
+
 	state.LockingId = lock.tickets[0].id
-	state.LockTimeout = lock.tickets[0].leaseTimeoutAt - monotimeNow
-	state.Acquirers = make([]LockAcquirerState, len(lock.tickets)-1)
+	state.LockTimeout = leaseTimeout(lock.tickets[0].leaseTimeoutAt, monotimeNow)
+	state.Mode = lock.tickets[0].mode
+	state.Fence = lock.fence
+	state.Generation = lock.generation
+	state.Depth = lock.tickets[0].holdCount
+	state.HeldFor = monotimeNow - lock.tickets[0].acquiredAt
+	state.HeldSince = lock.tickets[0].acquiredAtWall
+	state.ExpiresAt = leaseExpiresAt(lock.tickets[0].leaseTimeoutAt, monotimeNow, wallNow)
+	state.Holders = make([]LockHolderState, holderCount)
+	state.AcquirersTotal = len(lock.tickets) - holderCount
+	state.Capacity = lock.capacity
+	state.Permits = lock.permits()
+
+	acquirers := lock.tickets[holderCount:]
+	if acquirersLimit > 0 && len(acquirers) > acquirersLimit {
+		acquirers = acquirers[:acquirersLimit]
+	}
+
+	state.Acquirers = make([]LockAcquirerState, len(acquirers))
+
+	for idx, ticket := range lock.tickets[:holderCount] {
+		state.Holders[idx].Id = ticket.id
+		state.Holders[idx].Fence = ticket.fence
+		state.Holders[idx].Owner = ticket.owner
+		state.Holders[idx].Labels = ticket.labels
+		state.Holders[idx].Depth = ticket.holdCount
+		state.Holders[idx].Timeout = leaseTimeout(ticket.leaseTimeoutAt, monotimeNow)
+		state.Holders[idx].HeldFor = monotimeNow - ticket.acquiredAt
+		state.Holders[idx].HeldSince = ticket.acquiredAtWall
+		state.Holders[idx].ExpiresAt = leaseExpiresAt(ticket.leaseTimeoutAt, monotimeNow, wallNow)
+	}
 
-	for idx, ticket := range lock.tickets[1:] {
+	for idx, ticket := range acquirers {
 		state.Acquirers[idx].Id = ticket.id
+		state.Acquirers[idx].Mode = ticket.mode
+		state.Acquirers[idx].Owner = ticket.owner
+		state.Acquirers[idx].Labels = ticket.labels
 		state.Acquirers[idx].Timeout = ticket.acquireTimeoutAt - monotimeNow
+		state.Acquirers[idx].LeaseTimeout = max(ticket.firstLeaseTimeout, InfiniteTimeout)
+		state.Acquirers[idx].WaitingFor = monotimeNow - ticket.createdAt
 	}
 
 	return
 }
+
+// Remaining lease timeout.
+//
+// Returns InfiniteTimeout if the lease never expires.
+func leaseTimeout(leaseTimeoutAt time.Duration, monotimeNow time.Duration) time.Duration {
+	if leaseTimeoutAt == leaseNever {
+		return InfiniteTimeout
+	}
+
+	return leaseTimeoutAt - monotimeNow
+}
+
+// Lease expiry as a wall clock timestamp.
+//
+// Derived from the remaining lease timeout upon inspection, so it follows adjustments of the wall clock, as the lease
+// itself expires by monotonic time. Returns the zero time if the lease never expires.
+func leaseExpiresAt(leaseTimeoutAt time.Duration, monotimeNow time.Duration, wallNow time.Time) time.Time {
+	if leaseTimeoutAt == leaseNever {
+		return time.Time{}
+	}
+
+	return wallNow.Add(leaseTimeoutAt - monotimeNow)
+}
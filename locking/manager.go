@@ -1,11 +1,19 @@
 package locking
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
 	"math/rand"
+	"runtime/debug"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/spacemonkeygo/monotime"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Lock manager.
@@ -14,47 +22,329 @@ import (
 // stopped.
 type Manager interface {
 	// Start maintenance.
+	//
+	// Starting maintenance that is already running has no effect.
 	Start()
 
 	// Stop maintenance.
+	//
+	// Maintenance stops before its next pass, and can subsequently be started anew. Stopping maintenance that is not
+	// running has no effect. Either way, the changes of the locks not yet written to the store, if configured, are
+	// written.
 	Stop()
 
 	// Acquire a lock.
 	//
 	// Acquires a lock with a given timeout after which the attempt is aborted. The acquisition does not support
-	// infinite timeouts. The lease timeout is the lifetime of the lock if not renewed after the lock is acquired.
+	// infinite timeouts. The lease timeout is the lifetime of the lock if not renewed after the lock is acquired. A
+	// negative lease timeout, such as InfiniteTimeout, results in a lease that never expires, and is held until the
+	// lock is released. Timeouts outside of the configured range are clamped or rejected, as per the timeout policy.
 	//
 	// The function returns a ticket, that can be evaluated for the lock state. The ticket is not a guarantee, that a
 	// lock can be acquired in a timely fashion. It is safe to release the ticket subsequent to acquisition no matter
 	// if the ticket was actually acquired, signaling either the release of the lock or the intent to not carry on
 	// with the acquisition. In the latter case, the ticket is guaranteed to indicate that acquisition failed.
-	Acquire(path string, lockTimeout time.Duration, leaseTimeout time.Duration) (ticket Ticket, err error)
+	//
+	// Acquisition options may optionally be provided, of which only the first are considered. By default, the lock is
+	// acquired exclusively.
+	//
+	// If an owner is provided in the options, and a ticket of the same owner already holds the lock, the lock is
+	// re-entered rather than queueing behind the owner itself: the existing ticket is returned, with its hold count
+	// incremented and its lease extended to the given lease timeout if that is later. The ticket ID identifies the hold
+	// as a whole, so every re-entry must be matched by a release of the same ID before the lock is actually released.
+	Acquire(path string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (ticket Ticket, err error)
+
+	// Acquire a lock subject to a context.
+	//
+	// Acquires a lock as Acquire, except that if the context is canceled while the ticket is still waiting, the ticket
+	// is immediately removed from the queue and informed of failed acquisition. Cancellation of the context has no
+	// effect once the lock is acquired, and it is up to the caller to release the lock.
+	//
+	// If the context carries a recording trace span, the path and ticket ID are set as attributes of the span, and the
+	// progress of the acquisition is recorded as events of the span.
+	AcquireContext(ctx context.Context, path string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (ticket Ticket, err error)
+
+	// Acquire a lock, returning a function to cancel the acquisition.
+	//
+	// Acquires a lock as Acquire. Canceling removes the ticket from the queue by reference while it is still waiting,
+	// and informs it of failed acquisition, sparing the validation of the path and the search by ID of Release. Once
+	// the acquisition is settled, whether acquired or timed out, canceling has no effect, and it is up to the caller
+	// to release the lock. The function is safe to call multiple times.
+	AcquireWithCancel(path string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (ticket Ticket, cancel func(), err error)
+
+	// Acquire a lock, or extend the lease of a ticket already holding it.
+	//
+	// Allows acquisitions to be retried idempotently. If the ticket of the given ID holds the lock, its lease is
+	// extended as per Extend, and if it is waiting for the lock, it is left untouched. Either way, the existing ticket
+	// is returned. Otherwise, the lock is acquired as per AcquireContext, returning a new ticket. Returns whether the
+	// ticket of the ID was found.
+	AcquireOrExtend(ctx context.Context, path string, id int64, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (ticket Ticket, found bool, err error)
+
+	// Acquire multiple locks.
+	//
+	// Acquires the locks of all the given paths, or none of them. The locks are acquired one at a time in sorted order
+	// of their paths, so concurrent acquisitions of overlapping paths cannot deadlock each other. The lock timeout
+	// applies to the acquisition as a whole. If any lock cannot be acquired, the locks acquired so far are released,
+	// and an AcquireMultiError is returned. Otherwise, the tickets are returned in the order of the given paths, with
+	// duplicate paths sharing a ticket. Acquisition options apply to every lock.
+	AcquireMulti(paths []string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (tickets []Ticket, err error)
+
+	// Try to acquire a lock.
+	//
+	// Acquires a lock only if it can be held immediately, never joining the queue of waiting acquisitions. If the lock
+	// is acquired, the acquired ticket is returned. Otherwise, no ticket is created, and nil is returned. Acquisition
+	// options, including re-entry by owner, are handled as for Acquire.
+	TryAcquire(path string, leaseTimeout time.Duration, options ...AcquireOptions) (ticket Ticket, acquired bool, err error)
+
+	// Acquire a lock if unlocked.
+	//
+	// Acquires a lock only if the path has no tickets at all, neither holding nor waiting, never joining the queue of
+	// waiting acquisitions. Unlike TryAcquire, the lock is not acquired if it is held in shared mode, nor re-entered by
+	// its owner, so of any number of concurrent callers, at most one succeeds. If the lock is acquired, the acquired
+	// ticket is returned. Otherwise, no ticket is created, and nil is returned.
+	AcquireIfUnlocked(path string, leaseTimeout time.Duration, options ...AcquireOptions) (ticket Ticket, acquired bool, err error)
 
 	// Release a lock.
 	//
 	// If the ID is for a ticket that is still waiting to be locked, the ticket is informed of failed acquisition and
-	// removed from the queue. Returns whether the ticket was found.
+	// removed from the queue. If the ticket holds the lock re-entrantly, its hold count is decremented, and the lock is
+	// only released once the count reaches zero. Returns whether the ticket was found.
 	Release(path string, id int64) (found bool, err error)
 
+	// Release all locks of an owner.
+	//
+	// Releases every ticket of the given owner identity across all paths, whether holding or waiting for a lock, and
+	// promotes their successors. Locks held re-entrantly are released no matter their hold count. An empty owner
+	// matches no tickets. Returns the number of released tickets, including those released before a journal failure.
+	ReleaseByOwner(owner string) (count int, err error)
+
+	// Force the release of a lock.
+	//
+	// Releases the tickets holding the lock no matter their ID, owner or hold count, and promotes their successors, or
+	// if the queue is to be cleared, informs all waiting tickets of failed acquisition as well. Returns the IDs of the
+	// released tickets in order of the queue, including those released before a journal failure.
+	ForceRelease(path string, clearQueue bool) (releasedIds []int64, err error)
+
+	// Release multiple locks of a path.
+	//
+	// Releases every ticket of the given IDs as if released individually, but while locking the manager only once, and
+	// promotes their successors once all tickets are released, so no ticket is promoted only to be released right
+	// away. Returns whether each ticket was found.
+	ReleaseMulti(path string, ids []int64) (released map[int64]bool, err error)
+
 	// Extend a lease.
 	//
-	// Returns whether the lease was found and extended.
-	Extend(path string, id int64, timeout time.Duration) (found bool, err error)
+	// Extends the lease to expire no sooner than the given timeout from now. Extension never shortens a lease, so if
+	// the lease already expires later, it is left untouched. A negative timeout extends the lease to never expire,
+	// whereas extending a lease that never expires has no effect. Timeouts outside of the configured range are clamped
+	// or rejected, as per the timeout policy. If the options make the extension conditional on the remaining lease, and
+	// the condition is not met, ErrPreconditionFailed is returned. Extensions past the maximum total hold time fail with
+	// ErrHoldTimeExceeded. Returns whether the lease was found, and whether its timeout was changed.
+	Extend(path string, id int64, timeout time.Duration, options ...ExtendOptions) (found bool, changed bool, err error)
+
+	// Extend multiple leases.
+	//
+	// Extends every lease as if extended individually, sparing holders of many locks a request per lease. The path of
+	// each extension is locked in turn, only while extending its lease, so the extensions are not atomic, and operations
+	// on other paths proceed concurrently. Returns the result of every extension in the order of the extensions. Extensions fail
+	// individually, so some leases may be extended while others are not found, or fail with an error.
+	ExtendMulti(extensions []LeaseExtension) (results []LeaseExtensionResult)
+
+	// Keep a lease alive.
+	//
+	// Extends the lease of a lock holder by the given lease timeout at the given interval in the background, for as
+	// long as the context is not done and the ticket holds the lock. Renewal stops as soon as the context is done, after
+	// which the lease expires as usual unless otherwise extended. Returns whether the holder was found.
+	KeepAlive(ctx context.Context, path string, id int64, leaseTimeout time.Duration, interval time.Duration) (found bool, err error)
+
+	// Shorten a lease.
+	//
+	// Shortens the lease to expire no later than the given timeout from now. If the lease already expires sooner, it is
+	// left untouched. A lease that never expires can be shortened to expire. Timeouts below the minimum lease timeout
+	// are clamped to it, regardless of the timeout policy, whereas a zero timeout expires the lease during the next
+	// maintenance pass, as if released. Returns whether the lease was found, and whether its timeout was changed.
+	Shorten(path string, id int64, timeout time.Duration) (found bool, changed bool, err error)
+
+	// Downgrade a lock.
+	//
+	// Converts the exclusive hold of a ticket into a shared hold without releasing the lock, and immediately promotes
+	// the shared acquisitions waiting at the head of the queue. Promotion stops at the first waiting exclusive
+	// acquisition, which keeps its place in the queue ahead of any shared acquisitions behind it. Downgrading a shared
+	// hold has no effect. Returns whether the holder was found.
+	Downgrade(path string, id int64) (found bool, err error)
+
+	// Upgrade a lock.
+	//
+	// Converts the shared hold of a ticket into an exclusive hold without releasing the lock, blocking until all other
+	// shared holders have released the lock or the lock timeout elapses. While the upgrade is pending, no further shared
+	// acquisitions are admitted, and the ticket is issued a new fencing token once upgraded. Only a single holder of a
+	// lock may wait to upgrade it at a time, as two holders waiting for one another would never proceed, so any other
+	// holder attempting to upgrade fails immediately with ErrUpgradeConflict, and should release its shared hold to let
+	// the pending upgrade proceed. Upon timeout, ErrUpgradeTimeout is returned, and the ticket keeps its shared hold.
+	// Upgrading an exclusive hold has no effect. Returns the upgraded ticket, or nil if the ticket does not hold the
+	// lock, or stops holding it while waiting.
+	Upgrade(path string, id int64, lockTimeout time.Duration) (ticket Ticket, err error)
 
 	// Test if a path is locked.
 	//
-	// Returns the ID of the ticket holding the lock if the path is locked, otherwise zero.
-	IsLocked(path string) (locker int64, err error)
+	// Returns the IDs of the tickets holding the lock if the path is locked, otherwise nil. Multiple tickets can hold
+	// the lock if it is held in shared mode.
+	IsLocked(path string) (lockers []int64, err error)
+
+	// Queue position of a ticket.
+	//
+	// Returns the 1-based position of a waiting ticket among the acquisitions waiting for the lock, or zero if the
+	// ticket holds the lock, along with the total number of waiting acquisitions. Returns a position of -1 if the ticket
+	// neither holds nor waits for the lock.
+	QueuePosition(path string, id int64) (position int, total int, err error)
 
 	// Inpect lock state.
-	Inspect(path string) (state LockState, err error)
+	Inspect(path string, options ...InspectOptions) (state LockState, err error)
 
 	// Inspect all locks.
 	//
 	// Returns a complete snapshot of all held locks.
 	InspectAll() (states map[string]LockState, err error)
+
+	// Inspect locks matching a pattern.
+	//
+	// The pattern is either a lock path, matching only that path, or a lock path followed by a trailing /* wildcard
+	// segment, matching every path beneath it. A lone * matches all paths. Returns a snapshot of the held locks
+	// matching the pattern.
+	InspectPattern(pattern string) (states map[string]LockState, err error)
+
+	// Inspect a range of locks.
+	//
+	// Returns a snapshot of the held locks whose paths start with the given prefix and sort after the given path, up
+	// to a limit of locks in the order of their paths. A limit that is not positive returns all such locks. If more
+	// locks remain beyond the limit, the path of the last returned lock is returned as the cursor to inspect the next
+	// range after, otherwise the cursor is empty.
+	InspectRange(prefix string, after string, limit int) (states map[string]LockState, next string, err error)
+
+	// Subscribe to lock state changes.
+	//
+	// Returns a channel that receives the current state of the lock, and subsequently its state whenever it changes,
+	// ie. upon acquisition, release, lease changes, promotion and timeouts. The state of a lock that is not held is
+	// the zero value. Only the most recent state is buffered, so states are coalesced if the subscriber falls behind.
+	// The returned function unsubscribes and closes the channel, and must be called once the subscriber is done.
+	Subscribe(path string) (states <-chan LockState, unsubscribe func(), err error)
+
+	// Default timeouts.
+	//
+	// Returns the configured default lock and lease timeouts for acquisitions that omit them, which are zero if not
+	// configured.
+	DefaultTimeouts() (lockTimeout time.Duration, leaseTimeout time.Duration)
+
+	// Statistics.
+	//
+	// Returns the aggregate state of all locks as a point-in-time snapshot, taken in a single pass over all locks while
+	// the manager is locked, so the cost is linear in the number of paths and tickets.
+	Stats() (stats ManagerStats)
+
+	// Hold histograms.
+	//
+	// Returns the distributions of the durations locks were held for in order of their labels, or nil if hold
+	// histograms are disabled.
+	HoldHistograms() []HoldHistogram
+
+	// List namespaces.
+	//
+	// Returns the state of the default namespace, the configured namespaces and the namespaces of any held locks, in
+	// the order of their names.
+	Namespaces() (namespaces []NamespaceState, err error)
+
+	// Lock history.
+	//
+	// Returns the retained audit events of a path, oldest first, such as acquisitions, releases, lease changes and
+	// timeouts. Histories are retained even once the lock is no longer held. Returns nil if auditing is disabled, or no
+	// events of the path are retained.
+	History(path string) (events []AuditEvent, err error)
+
+	// Detect deadlocks.
+	//
+	// Detects waiting acquisitions that are deadlocked, as their owners wait for each other in a cycle. This relies on
+	// owner identities, as an owner waiting for a lock is considered to block any lock it holds, so acquisitions
+	// without an owner are never considered deadlocked. Returns groups of the IDs of the waiting tickets that make up
+	// one or more cycles, with each group sorted.
+	DetectDeadlocks() (deadlocks [][]int64, err error)
+
+	// Drain the manager.
+	//
+	// Refuses any subsequent acquisitions, including re-entries, with ErrDraining, and waits for the outstanding
+	// waiting acquisitions to settle, either by acquiring the lock or by failing. Returns the error of the context if
+	// it is done before then. Held locks are unaffected by draining, and can still be extended and released, so locks
+	// still held once the manager is stopped are only restored by a subsequent manager if journaled.
+	Drain(ctx context.Context) error
+
+	// Announce shutdown.
+	//
+	// Announces that the manager is about to be drained once the grace period elapses, so holders can finish their
+	// work and release their locks in the meantime, rather than have their leases outlive the manager. Holders learn of
+	// the announcement by ShutdownAnnounced, such as by a server notifying the holders streaming their locks, whereas
+	// other holders fall back to lease expiry. Locks are acquired, extended and released as usual until drained. Only
+	// the first announcement takes effect, and draining announces shutdown without grace unless announced before.
+	AnnounceShutdown(grace time.Duration)
+
+	// Shutdown announcement.
+	//
+	// Returns a channel closed once shutdown is announced.
+	ShutdownAnnounced() <-chan struct{}
+
+	// Shutdown deadline.
+	//
+	// Returns the time the grace period of the announced shutdown elapses, after which the manager is drained, or zero
+	// if shutdown has not been announced.
+	ShutdownDeadline() time.Time
+
+	// Snapshot the locks.
+	//
+	// Serializes the holders and waiting acquisitions of every lock to a versioned format, which can be restored by
+	// another manager, such as when migrating locks between servers or taking backups. Timeouts are recorded as the
+	// durations remaining, so they are unaffected by the move to another process.
+	Snapshot() (data []byte, err error)
+
+	// Restore a snapshot.
+	//
+	// Restores the locks of a snapshot taken by Snapshot, retaining their ticket IDs and fencing tokens, so clients
+	// can carry on with the locks. The time elapsed since the snapshot was taken counts against the timeouts, as per
+	// the wall clock, and tickets whose timeouts have elapsed are skipped. Timeout limits and namespace limits are not
+	// applied, as the restored locks were granted subject to the limits of their manager. Returns ErrSnapshotInvalid if
+	// the snapshot cannot be restored, and ErrSnapshotConflict without restoring any locks if the manager already has
+	// a lock of any path of the snapshot.
+	Restore(data []byte) (err error)
+
+	// Validate a lock path.
+	//
+	// Cleans and validates the provided lock path according to the manager's configuration, returning an error if
+	// the path is not valid.
+	ValidatePath(path string) (string, error)
 }
 
+// Manager draining.
+//
+// Returned for acquisitions attempted once the manager has started draining.
+var ErrDraining = errors.New("manager is draining")
+
+// Precondition failed.
+//
+// Returned for conditional extensions of leases that do not meet the condition.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// Hold time exceeded.
+//
+// Returned for extensions of leases past the maximum total hold time.
+var ErrHoldTimeExceeded = errors.New("hold time exceeded")
+
+// Upgrade conflict.
+//
+// Returned for upgrades of locks that another holder is already waiting to upgrade.
+var ErrUpgradeConflict = errors.New("upgrade conflict")
+
+// Upgrade timed out.
+//
+// Returned for upgrades of locks that other holders did not release before the lock timeout.
+var ErrUpgradeTimeout = errors.New("upgrade timed out")
+
 // Lock manager implementation.
 //
 // Manages all available locks by path. Each individual is managed in an immutable manner, thus leading to safe
@@ -64,338 +354,2377 @@ type Manager interface {
 // To avoid a large amount of updates to contended locks, maintenance, ie. the timing out of locks and waiting
 // acquisitions, is, unless an explicit lock release is performed, performed in batches at a configurable interval.
 //
+// Operations on a single path lock the manager for reading and lock the path, so operations on different paths proceed
+// concurrently, while operations spanning all paths, such as inspecting all locks, lock the manager exclusively, which
+// amounts to lock to every path. State shared by all paths, such as the locks by path, the ID and fence sequences, the
+// queued callbacks and the journal, is guarded by mutexes of its own, which are only ever locked last and briefly.
+//
 // In its present form, the lock manager's complexity scales linearly with the number of outstanding tickets per lock
 // path.
 type managerImpl struct {
-	sync                    sync.Mutex
-	locks                   map[string]*lockImpl
-	nextTicketId            int64
-	maintenanceInterval     time.Duration
-	locksNeedingMaintenance []string
-	stopChan                chan struct{}
+	sync                      sync.RWMutex
+	pathLocks                 pathLocks
+	locksSync                 sync.RWMutex
+	locks                     map[string]*lockImpl
+	paths                     pathIndex
+	sequenceSync              sync.Mutex
+	nextTicketId              int64
+	idStrategy                IDStrategy
+	fairness                  Fairness
+	nextFence                 int64
+	nextGeneration            int64
+	maintenanceInterval       time.Duration
+	maintenanceJitter         time.Duration
+	maxTotalHoldTime          time.Duration
+	pathValidator             PathValidator
+	maintenanceSync           sync.Mutex
+	locksNeedingMaintenance   []string
+	maintainedPaths           int
+	maintenanceDuration       time.Duration
+	maintainedAt              time.Time
+	stopChan                  chan struct{}
+	callbacksSync             sync.Mutex
+	callbacks                 []func()
+	dispatchingCallbacks      bool
+	onPathCreated             func(path string)
+	onPathDeleted             func(path string)
+	onAcquire                 func(path string, id int64)
+	onPromote                 func(path string, id int64)
+	onRelease                 func(path string, id int64)
+	onTimeout                 func(path string, id int64)
+	abortDeadlocks            bool
+	timeoutLimits             timeoutLimits
+	defaultLockTimeout        time.Duration
+	defaultLeaseTimeout       time.Duration
+	defaultNamespace          NamespaceConfig
+	namespaces                map[string]NamespaceConfig
+	draining                  bool
+	shutdownChan              chan struct{}
+	shutdownDeadline          time.Time
+	subscriptionsSync         sync.Mutex
+	subscriptions             map[string][]*subscription
+	changedPaths              map[string]struct{}
+	journal                   Journal
+	journalCompactionInterval time.Duration
+	journalCompactedAt        time.Duration
+	store                     Store
+	storeSync                 sync.Mutex
+	storeChangedPaths         map[string]struct{}
+	storeChanges              map[string]StoredLock
+	storeWriteSync            sync.Mutex
+	auditLog                  *auditLog
+	holdHistograms            *holdHistograms
+	tracer                    trace.Tracer
+	logger                    *slog.Logger
+	clock                     Clock
 }
 
 // New lock manager.
-func NewManager(config Config) Manager {
+//
+// If a journal or write-ahead log is configured, the lock holders journaled in it are restored, or else, if a store is
+// configured, the holders of the stored locks. If multiple shards are configured, the paths are distributed across as
+// many managers.
+func NewManager(config Config) (Manager, error) {
+	if config.Shards > 1 {
+		return newShardedManager(config)
+	}
+
 	// Seed the first ticket ID.
 	nextTicketId := rand.New(rand.NewSource(time.Now().UnixNano())).Int63()
 
+	// Seed the fencing tokens and generations from the wall clock, so they keep increasing across restarts of the
+	// manager.
+	nextFence := time.Now().UnixNano()
+
 	// Default configuration.
 	maintenanceInterval := 10 * time.Millisecond
+	journalCompactionInterval := time.Minute
 
 	if config.MaintenanceInterval > 0 {
 		maintenanceInterval = config.MaintenanceInterval
 	}
+	if config.WALCompactionInterval != 0 {
+		journalCompactionInterval = config.WALCompactionInterval
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	clock := config.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
 
-	return &managerImpl{
+	m := &managerImpl{
 		locks:               make(map[string]*lockImpl),
 		nextTicketId:        nextTicketId,
+		idStrategy:          config.IDStrategy,
+		fairness:            config.Fairness,
+		nextFence:           nextFence,
+		nextGeneration:      nextFence,
 		maintenanceInterval: maintenanceInterval,
+		maintenanceJitter:   max(config.MaintenanceJitter, 0),
+		maxTotalHoldTime:    max(config.MaxTotalHoldTime, 0),
+		pathValidator: PathValidator{
+			Normalization: config.PathNormalization,
+			Pattern:       config.PathPattern,
+			MaxLength:     config.MaxPathLength,
+			MaxSegments:   config.MaxPathSegments,
+		},
+		onPathCreated:       config.OnPathCreated,
+		onPathDeleted:       config.OnPathDeleted,
+		onAcquire:           config.OnAcquire,
+		onPromote:           config.OnPromote,
+		onRelease:           config.OnRelease,
+		onTimeout:           config.OnTimeout,
+		abortDeadlocks:      config.AbortDeadlocks,
+		defaultLockTimeout:  max(config.DefaultLockTimeout, 0),
+		defaultLeaseTimeout: max(config.DefaultLeaseTimeout, InfiniteTimeout),
+		timeoutLimits: timeoutLimits{
+			minLeaseTimeout: config.MinLeaseTimeout,
+			maxLeaseTimeout: config.MaxLeaseTimeout,
+			maxLockTimeout:  config.MaxLockTimeout,
+			policy:          config.TimeoutPolicy,
+		},
+		defaultNamespace:          config.DefaultNamespace,
+		namespaces:                config.Namespaces,
+		journalCompactionInterval: journalCompactionInterval,
+		store:                     config.Store,
+		auditLog:                  newAuditLog(config.AuditHistorySize, config.AuditHistoryPaths),
+		holdHistograms:            newHoldHistograms(config.HoldHistogram, config.HoldHistogramBuckets),
+		shutdownChan:              make(chan struct{}),
+		logger:                    logger,
+		clock:                     clock,
 	}
-}
 
-func (m *managerImpl) Release(path string, id int64) (bool, error) {
-	// Clean and validate the path.
-	path, err := ValidateLockPath(path)
-	if err != nil {
-		return false, err
+	if config.TracerProvider != nil {
+		m.tracer = config.TracerProvider.Tracer("lockerd/locking")
 	}
 
-	// Lock the manager.
-	m.sync.Lock()
-	defer m.sync.Unlock()
-
-	// Find the lock.
-	curLock, ok := m.locks[path]
-	if !ok || len(curLock.tickets) == 0 {
-		return false, nil
+	// Restore the lock holders from the journal if configured.
+	journal := config.Journal
+	if journal == nil && config.WALPath != "" {
+		journal = newWAL(config.WALPath)
 	}
 
-	// Update the lock state.
-	found := false
-	nextTickets := make([]*ticketImpl, 0, len(curLock.tickets))
-
-	for _, ticket := range curLock.tickets {
-		if ticket.id == id {
-			found = true
-
-			if ticket.leaseTimeoutAt == 0 {
-				// The ticket is not yet the head, so we need to emit the acquisition state.
-				ticket.acquiredChan <- false
-			}
-		} else {
-			nextTickets = append(nextTickets, ticket)
+	if journal != nil {
+		if err := m.restore(journal); err != nil {
+			return nil, err
 		}
 	}
 
-	// Update the lock, and, if necessary, perform maintenance.
-	if len(nextTickets) > 0 {
-		m.locks[path] = &lockImpl{
-			tickets: nextTickets,
+	// Load the locks of the store if configured, restoring their holders unless restored from the journal.
+	if m.store != nil {
+		if err := m.load(journal == nil); err != nil {
+			return nil, err
 		}
-		m.maintainPath(path)
-	} else {
-		delete(m.locks, path)
 	}
 
-	return found, nil
+	return m, nil
 }
 
-func (m *managerImpl) Extend(path string, id int64, timeout time.Duration) (bool, error) {
-	// Clean and validate the path.
-	path, err := ValidateLockPath(path)
+// Restore the lock holders from a journal.
+func (m *managerImpl) restore(journal Journal) error {
+	holders, err := journal.Restore(m.clock.Now())
 	if err != nil {
-		return false, err
+		return err
 	}
 
 	// Lock the manager.
 	m.sync.Lock()
-	defer m.sync.Unlock()
-
-	// Find the lock.
-	curLock, ok := m.locks[path]
-	if !ok || len(curLock.tickets) == 0 {
-		return false, nil
-	}
+	defer m.unlock()
 
-	// Update the lock state.
-	headTicket := curLock.tickets[0]
-
-	if headTicket.id == id {
-		headTicket.leaseTimeoutAt = monotime.Monotonic() + timeout
+	m.journal = journal
+	m.journalCompactedAt = m.clock.Monotonic()
 
-		go func() {
-			time.Sleep(timeout)
+	m.restoreHolders(holders, m.journalCompactedAt)
 
-			m.sync.Lock()
-			defer m.sync.Unlock()
-			m.locksNeedingMaintenance = append(m.locksNeedingMaintenance, path)
-		}()
-
-		return true, nil
-	}
+	m.logger.Info("Restored locks from journal", "holders", len(holders))
 
-	return false, nil
+	return nil
 }
 
-// Maintain a path.
+// Load the locks of the store.
 //
-// This assumes exclusive lock to the manager is provided during the process.
-func (m *managerImpl) maintainPath(path string) {
-	curLock, ok := m.locks[path]
-	if !ok || len(curLock.tickets) == 0 {
-		return
+// Restores the holders of the stored locks if requested. Every stored lock is written again by the first write to the
+// store, so the store reflects the restored holders even if restored from a journal instead.
+func (m *managerImpl) load(restore bool) error {
+	locks, err := m.store.Load()
+	if err != nil {
+		return err
 	}
 
-	// Determine which tickets are to survive.
-	var nextTickets []*ticketImpl
-	now := monotime.Monotonic()
+	// Lock the manager.
+	m.sync.Lock()
+	defer m.unlock()
 
-	for _, ticket := range curLock.tickets {
-		if ticket.leaseTimeoutAt > 0 {
-			// Locked tickets stay in place until their timeout.
-			if ticket.leaseTimeoutAt > now {
-				nextTickets = append(nextTickets, ticket)
-			}
-		} else {
-			// Waiting acquisitions stay in play until their timeout.
-			if ticket.acquireTimeoutAt > now {
-				nextTickets = append(nextTickets, ticket)
-			} else {
-				ticket.acquiredChan <- false
-			}
-		}
+	m.storeSync.Lock()
+	if m.storeChangedPaths == nil {
+		m.storeChangedPaths = make(map[string]struct{})
 	}
+	for _, lock := range locks {
+		m.storeChangedPaths[lock.Path] = struct{}{}
+	}
+	m.storeSync.Unlock()
 
-	// Promote the head ticket if necessary.
-	if len(nextTickets) > 0 && nextTickets[0].leaseTimeoutAt == 0 {
-		ticket := nextTickets[0]
+	if !restore {
+		return nil
+	}
 
-		ticket.leaseTimeoutAt = monotime.Monotonic() + ticket.firstLeaseTimeout
-		ticket.acquiredChan <- true
+	// Restore the holders whose leases have not expired.
+	wallNow := m.clock.Now().UnixNano()
 
-		go func() {
-			time.Sleep(ticket.firstLeaseTimeout)
+	var holders []JournalRecord
 
-			m.sync.Lock()
-			defer m.sync.Unlock()
-			m.locksNeedingMaintenance = append(m.locksNeedingMaintenance, path)
-		}()
-	}
+	for _, lock := range locks {
+		for _, holder := range lock.Holders {
+			if holder.LeaseUntil <= wallNow {
+				continue
+			}
 
-	// Update the lock state.
-	if len(nextTickets) == 0 {
-		delete(m.locks, path)
-	} else if len(nextTickets) != len(curLock.tickets) {
-		m.locks[path] = &lockImpl{
-			tickets: nextTickets,
+			holders = append(holders, JournalRecord{
+				Op:         JournalOpHold,
+				Path:       lock.Path,
+				Id:         holder.Id,
+				Mode:       holder.Mode,
+				Fence:      holder.Fence,
+				Owner:      holder.Owner,
+				Labels:     holder.Labels,
+				HoldCount:  holder.HoldCount,
+				LeaseUntil: holder.LeaseUntil,
+			})
 		}
 	}
-}
-
-func (m *managerImpl) Start() {
-	stopChan := make(chan struct{})
 
-	m.sync.Lock()
+	m.restoreHolders(holders, m.clock.Monotonic())
 
-	if m.stopChan != nil {
-		close(m.stopChan)
+	// Restore the capacities of the semaphores, which are not yet shared with any other goroutine.
+	for _, lock := range locks {
+		if restored, ok := m.locks[lock.Path]; ok {
+			restored.capacity = lock.Capacity
+		}
 	}
 
-	m.stopChan = stopChan
-	m.sync.Unlock()
+	m.logger.Info("Restored locks from store", "holders", len(holders))
 
-	go func() {
-		for {
-			time.Sleep(m.maintenanceInterval)
+	return nil
+}
 
-			m.sync.Lock()
-			for _, path := range m.locksNeedingMaintenance {
-				m.maintainPath(path)
-			}
-			m.locksNeedingMaintenance = nil
-			m.sync.Unlock()
+// Restore lock holders.
+//
+// Restores the holders as acquired at the given time, in order. This assumes exclusive lock to the manager is provided
+// during the process.
+func (m *managerImpl) restoreHolders(holders []JournalRecord, now time.Duration) {
+	wallNow := m.clock.Now().UnixNano()
+
+	for _, holder := range holders {
+		leaseTimeout := time.Duration(holder.LeaseUntil - wallNow)
+		if holder.LeaseUntil == JournalLeaseNever {
+			leaseTimeout = InfiniteTimeout
+		}
 
-			select {
-			case <-m.stopChan:
-				return
-			default:
-			}
+		ticket := newTicket(holder.Id, holder.Mode, leaseTimeout)
+		ticket.fence = holder.Fence
+		ticket.owner = holder.Owner
+		ticket.labels = holder.Labels
+		if holder.HoldCount > 1 {
+			ticket.holdCount = holder.HoldCount
+		}
+		ticket.createdAt = now
+		ticket.acquiredAt = now
+		ticket.acquiredAtWall = m.clock.Now()
+		ticket.leaseTimeoutAt = leaseTimeoutAt(now, leaseTimeout)
+		ticket.emit(TicketAcquired)
+
+		var tickets []*ticketImpl
+		if prevLock, ok := m.locks[holder.Path]; ok {
+			tickets = prevLock.tickets
 		}
-	}()
-}
 
-func (m *managerImpl) Stop() {
-	m.sync.Lock()
-	defer m.sync.Unlock()
+		m.setLock(holder.Path, &lockImpl{
+			tickets: append(tickets, ticket),
+			fence:   holder.Fence,
+		})
+		m.scheduleMaintenance(holder.Path, leaseTimeout)
 
-	if m.stopChan != nil {
-		close(m.stopChan)
-		m.stopChan = nil
+		if holder.Fence > m.nextFence {
+			m.nextFence = holder.Fence
+		}
 	}
 }
 
-func (m *managerImpl) Acquire(path string, lockTimeout time.Duration, leaseTimeout time.Duration) (Ticket, error) {
+func (m *managerImpl) Release(path string, id int64) (bool, error) {
+	released, err := m.ReleaseMulti(path, []int64{id})
+
+	return released[id], err
+}
+
+func (m *managerImpl) ReleaseMulti(path string, ids []int64) (map[int64]bool, error) {
 	// Clean and validate the path.
-	path, err := ValidateLockPath(path)
+	path, err := m.pathValidator.Validate(path)
 	if err != nil {
 		return nil, err
 	}
 
-	// Lock the manager.
-	m.sync.Lock()
-	defer m.sync.Unlock()
-
-	// Create a lock representation if one does not already exist for the given path.
-	prevLock, _ := m.locks[path]
-
-	// Create a ticket and evaluate locking.
-	if m.nextTicketId < 1 {
-		m.nextTicketId = 1
+	released := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		released[id] = false
 	}
 
-	ticketId := m.nextTicketId
-	m.nextTicketId++
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
 
-	ticket := &ticketImpl{
-		id:                ticketId,
-		acquiredChan:      make(chan bool, 1),
-		firstLeaseTimeout: leaseTimeout,
+	// Find the lock.
+	curLock, ok := m.lockOf(path)
+	if !ok || len(curLock.tickets) == 0 {
+		return released, nil
 	}
 
-	if prevLock == nil || len(prevLock.tickets) == 0 {
-		// If the ticket is the new head of the lock, we set its lease timeout and informs of acquisition immediately.
-		m.locks[path] = &lockImpl{
-			tickets: []*ticketImpl{ticket},
+	// Journal the releases of the tickets holding the lock. If a lock is held re-entrantly, only a single hold is
+	// released for every occurrence of its ID. Journal failures stop the release of any further tickets.
+	holderCount := curLock.holderCount()
+	removing := make(map[int64]bool, len(ids))
+
+	for _, id := range ids {
+		idx := slices.IndexFunc(curLock.tickets, func(ticket *ticketImpl) bool {
+			return ticket.id == id
+		})
+		if idx < 0 || removing[id] {
+			continue
 		}
 
-		ticket.leaseTimeoutAt = monotime.Monotonic() + leaseTimeout
-		ticket.acquiredChan <- true
+		ticket := curLock.tickets[idx]
 
-		go func() {
-			time.Sleep(leaseTimeout)
-
-			m.sync.Lock()
-			defer m.sync.Unlock()
-			m.locksNeedingMaintenance = append(m.locksNeedingMaintenance, path)
-		}()
-	} else if lockTimeout <= 0 {
-		// If the lock timeout is immediate, we simply indicate that the lock could not be acquired.
-		ticket.acquiredChan <- false
-	} else {
-		// If the ticket is not the head of the lock, we append it to the list of tickets and set its acquisition
-		// timeout.
-		m.locks[path] = &lockImpl{
-			tickets: append(prevLock.tickets, ticket),
-		}
+		if idx < holderCount && ticket.holdCount > 1 {
+			if err = m.journalHoldCount(path, id, ticket.holdCount-1); err != nil {
+				break
+			}
 
-		ticket.acquireTimeoutAt = monotime.Monotonic() + lockTimeout
+			ticket.holdCount--
+			m.markChanged(path)
+			m.audit(path, AuditExited, ticket, 0)
+			m.logger.Debug("Lock exited", "path", path, "id", id, "hold_count", ticket.holdCount)
+		} else {
+			if idx < holderCount {
+				if err = m.journalRelease(path, id); err != nil {
+					break
+				}
+			}
 
-		go func() {
-			time.Sleep(lockTimeout)
+			removing[id] = true
+		}
 
-			m.sync.Lock()
-			defer m.sync.Unlock()
-			m.locksNeedingMaintenance = append(m.locksNeedingMaintenance, path)
-		}()
+		released[id] = true
 	}
 
-	return ticket, nil
+	// Update the lock state.
+	m.removeTickets(path, curLock, func(ticket *ticketImpl) bool {
+		return removing[ticket.id]
+	})
+
+	return released, err
 }
 
-func (m *managerImpl) IsLocked(path string) (locker int64, err error) {
+func (m *managerImpl) ForceRelease(path string, clearQueue bool) ([]int64, error) {
 	// Clean and validate the path.
-	path, err = ValidateLockPath(path)
+	path, err := m.pathValidator.Validate(path)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	// Lock the manager.
-	m.sync.Lock()
-	defer m.sync.Unlock()
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
 
-	// Test the lock state.
-	lock, ok := m.locks[path]
-	if !ok || len(lock.tickets) == 0 {
-		return
+	// Find the lock.
+	curLock, ok := m.lockOf(path)
+	if !ok || len(curLock.tickets) == 0 {
+		return nil, nil
 	}
 
-	locker = lock.tickets[0].id
-	return
-}
+	// Journal the releases of the holders, and determine the tickets to release. Journal failures stop the release of
+	// any further tickets, while the releases journaled already are applied, so the manager does not diverge from its
+	// journal.
+	holderCount := curLock.holderCount()
+	releasing := make(map[*ticketImpl]bool, len(curLock.tickets))
+	var releasedIds []int64
 
-func (m *managerImpl) Inspect(path string) (state LockState, err error) {
-	// Clean and validate the path.
-	path, err = ValidateLockPath(path)
-	if err != nil {
-		return
-	}
+	for idx, ticket := range curLock.tickets {
+		if idx >= holderCount && !clearQueue {
+			break
+		}
 
-	// Lock the manager.
-	m.sync.Lock()
-	defer m.sync.Unlock()
+		if idx < holderCount {
+			if err = m.journalRelease(path, ticket.id); err != nil {
+				break
+			}
+		}
 
-	// Fetch the lock.
-	lock, ok := m.locks[path]
-	if !ok || len(lock.tickets) == 0 {
-		return
+		releasing[ticket] = true
+		releasedIds = append(releasedIds, ticket.id)
 	}
 
-	return lockStateFromLock(lock, monotime.Monotonic()), nil
+	m.logger.Warn("Lock force-released", "path", path, "ids", releasedIds, "clear_queue", clearQueue)
+
+	// Update the lock state.
+	m.removeTickets(path, curLock, func(ticket *ticketImpl) bool {
+		return releasing[ticket]
+	})
+
+	return releasedIds, err
 }
 
-func (m *managerImpl) InspectAll() (states map[string]LockState, err error) {
+func (m *managerImpl) ReleaseByOwner(owner string) (int, error) {
+	if owner == "" {
+		return 0, nil
+	}
+
 	// Lock the manager.
 	m.sync.Lock()
-	defer m.sync.Unlock()
+	defer m.unlock()
 
-	// Build the state map.
-	now := monotime.Monotonic()
-	states = make(map[string]LockState, len(m.locks))
+	isOwned := func(ticket *ticketImpl) bool {
+		return ticket.owner == owner
+	}
 
-	for path, lock := range m.locks {
-		states[path] = lockStateFromLock(lock, now)
+	// Find the paths with tickets of the owner. The paths are collected beforehand, as releasing the tickets may delete
+	// locks.
+	var paths []string
+
+	for path, curLock := range m.locks {
+		if slices.ContainsFunc(curLock.tickets, isOwned) {
+			paths = append(paths, path)
+		}
 	}
 
-	return
+	slices.Sort(paths)
+
+	// Release the tickets path by path, journaling the releases of holders first. If journaling fails, the releases
+	// journaled already are still applied, so the manager does not diverge from its journal.
+	count := 0
+
+	for _, path := range paths {
+		curLock := m.locks[path]
+		journaled := make(map[*ticketImpl]bool)
+
+		for _, ticket := range curLock.tickets[:curLock.holderCount()] {
+			if !isOwned(ticket) {
+				continue
+			}
+
+			if err := m.journalRelease(path, ticket.id); err != nil {
+				count += m.removeTickets(path, curLock, func(ticket *ticketImpl) bool {
+					return journaled[ticket]
+				})
+
+				return count, err
+			}
+
+			journaled[ticket] = true
+		}
+
+		count += m.removeTickets(path, curLock, isOwned)
+	}
+
+	return count, nil
+}
+
+// Remove tickets from a lock.
+//
+// Removes the tickets matching the predicate, informing waiting tickets of failed acquisition and holders of their
+// release, and performs maintenance of the remaining tickets. Releases of holders must be journaled beforehand. Returns
+// the number of removed tickets. This assumes lock to the path is provided during the process.
+func (m *managerImpl) removeTickets(path string, curLock *lockImpl, match func(ticket *ticketImpl) bool) int {
+	removed := 0
+	nextTickets := make([]*ticketImpl, 0, len(curLock.tickets))
+
+	for _, ticket := range curLock.tickets {
+		if match(ticket) {
+			removed++
+
+			if ticket.leaseTimeoutAt == 0 {
+				// The ticket is not yet the head, so we need to emit the acquisition state.
+				ticket.emit(TicketAcquisitionFailed)
+				m.audit(path, AuditCanceled, ticket, 0)
+				m.logger.Debug("Acquisition canceled", "path", path, "id", ticket.id, "waited", m.clock.Monotonic()-ticket.createdAt)
+			} else {
+				ticket.settleUpgrade(false)
+				ticket.emit(TicketReleased)
+				m.audit(path, AuditReleased, ticket, 0)
+				m.queueTicketCallback(m.onRelease, path, ticket.id)
+				m.holdHistograms.record(path, m.clock.Monotonic()-ticket.acquiredAt)
+				m.logger.Debug("Lock released", "path", path, "id", ticket.id, "held", m.clock.Monotonic()-ticket.acquiredAt)
+			}
+		} else {
+			nextTickets = append(nextTickets, ticket)
+		}
+	}
+
+	if removed == 0 {
+		return 0
+	}
+
+	// Update the lock, and, if necessary, perform maintenance.
+	if len(nextTickets) > 0 {
+		m.setLock(path, &lockImpl{
+			tickets: nextTickets,
+			fence:   curLock.fence,
+		})
+		m.maintainPath(path)
+	} else {
+		m.deleteLock(path)
+	}
+
+	return removed
+}
+
+func (m *managerImpl) Extend(path string, id int64, timeout time.Duration, options ...ExtendOptions) (bool, bool, error) {
+	var opts ExtendOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	return m.updateLease(path, id, timeout, false, opts.IfLeaseTimeoutGreaterThan)
+}
+
+func (m *managerImpl) Shorten(path string, id int64, timeout time.Duration) (bool, bool, error) {
+	return m.updateLease(path, id, timeout, true, 0)
+}
+
+func (m *managerImpl) Downgrade(path string, id int64) (bool, error) {
+	// Clean and validate the path.
+	path, err := m.pathValidator.Validate(path)
+	if err != nil {
+		return false, err
+	}
+
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	// Find the holder.
+	holder := m.holderOf(path, id)
+	if holder == nil {
+		return false, nil
+	} else if holder.mode == ModeShared {
+		return true, nil
+	}
+
+	// Update the lock state, and promote the shared acquisitions now admitted.
+	holder.mode = ModeShared
+	if err := m.journalMode(path, holder); err != nil {
+		holder.mode = ModeExclusive
+		return false, err
+	}
+
+	m.markChanged(path)
+	m.audit(path, AuditDowngraded, holder, 0)
+	m.logger.Debug("Lock downgraded", "path", path, "id", id)
+
+	m.maintainPath(path)
+
+	return true, nil
+}
+
+func (m *managerImpl) Upgrade(path string, id int64, lockTimeout time.Duration) (Ticket, error) {
+	// Clean and validate the path.
+	path, err := m.pathValidator.Validate(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Limit the lock timeout to the configured range.
+	if lockTimeout, err = m.timeoutLimits.limitLock(lockTimeout); err != nil {
+		return nil, err
+	}
+
+	holder, upgradeChan, err := m.requestUpgrade(path, id, lockTimeout)
+	if holder == nil || err != nil {
+		return nil, err
+	}
+
+	// Wait for the upgrade to settle. The holder is only returned if upgraded, as the upgrade otherwise failed because
+	// the holder no longer holds the lock.
+	select {
+	case upgraded := <-upgradeChan:
+		if upgraded {
+			return holder, nil
+		}
+		return nil, nil
+	case <-m.clock.After(lockTimeout):
+	}
+
+	// Abort the upgrade, unless it was settled in the meantime.
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	select {
+	case upgraded := <-upgradeChan:
+		if upgraded {
+			return holder, nil
+		}
+		return nil, nil
+	default:
+	}
+
+	holder.upgradeChan = nil
+	m.markChanged(path)
+	m.logger.Debug("Upgrade timed out", "path", path, "id", id, "lock_timeout", lockTimeout)
+
+	// Admit the shared acquisitions held back by the upgrade.
+	m.maintainPath(path)
+
+	return nil, ErrUpgradeTimeout
+}
+
+// Request the upgrade of a lock.
+//
+// Marks the holder as waiting to upgrade the lock, and completes the upgrade right away if no other holders remain.
+// Returns the holder and the channel settling its upgrade, or nil if the ticket does not hold the lock.
+func (m *managerImpl) requestUpgrade(path string, id int64, lockTimeout time.Duration) (*ticketImpl, chan bool, error) {
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	// Find the holder.
+	holder := m.holderOf(path, id)
+	if holder == nil {
+		return nil, nil, nil
+	}
+
+	upgradeChan := make(chan bool, 1)
+
+	if holder.mode == ModeExclusive {
+		upgradeChan <- true
+		return holder, upgradeChan, nil
+	}
+
+	curLock, _ := m.lockOf(path)
+	if curLock.upgrader() != nil {
+		return nil, nil, ErrUpgradeConflict
+	}
+	if curLock.holderCount() > 1 && lockTimeout <= 0 {
+		return nil, nil, ErrUpgradeTimeout
+	}
+
+	// Hold back further shared acquisitions until the upgrade is settled. Maintenance completes the upgrade once no
+	// other holders remain.
+	holder.upgradeChan = upgradeChan
+	m.markChanged(path)
+	m.maintainPath(path)
+
+	return holder, upgradeChan, nil
+}
+
+// Update a lease.
+//
+// Updates the lease timeout of a lock holder if it either extends or shortens the lease as requested. If the minimum
+// remaining lease is positive, the lease must remain for longer than it to be updated.
+func (m *managerImpl) updateLease(path string, id int64, timeout time.Duration, shorten bool, minRemaining time.Duration) (bool, bool, error) {
+	// Clean and validate the path.
+	path, err := m.pathValidator.Validate(path)
+	if err != nil {
+		return false, false, err
+	}
+
+	// Limit extensions to the configured range, and shortened leases to the minimum.
+	if !shorten {
+		if timeout, err = m.timeoutLimits.limitLease(timeout); err != nil {
+			return false, false, err
+		}
+	} else {
+		timeout = m.timeoutLimits.limitShortenedLease(timeout)
+	}
+
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	// Find the holder.
+	holder := m.holderOf(path, id)
+	if holder == nil {
+		return false, false, nil
+	}
+
+	// Check the remaining lease. Leases that never expire always meet the condition.
+	if minRemaining > 0 && holder.leaseTimeoutAt != leaseNever &&
+		holder.leaseTimeoutAt-m.clock.Monotonic() <= minRemaining {
+		return true, false, ErrPreconditionFailed
+	}
+
+	// Update the lock state.
+	changed, err := m.applyLease(path, holder, m.namespaceOf(path).capLease(timeout), shorten)
+
+	return true, changed, err
+}
+
+func (m *managerImpl) KeepAlive(ctx context.Context, path string, id int64, leaseTimeout time.Duration, interval time.Duration) (bool, error) {
+	// Clean and validate the path.
+	path, err := m.pathValidator.Validate(path)
+	if err != nil {
+		return false, err
+	}
+
+	// Limit the lease timeout to the configured range.
+	if leaseTimeout, err = m.timeoutLimits.limitLease(leaseTimeout); err != nil {
+		return false, err
+	}
+
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	// Find the holder.
+	holder := m.holderOf(path, id)
+	if holder == nil {
+		return false, nil
+	}
+
+	leaseTimeout = m.namespaceOf(path).capLease(leaseTimeout)
+
+	// Renew the lease in the background until the context is done or the holder no longer holds the lock.
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.clock.After(interval):
+			}
+
+			if !m.renew(ctx, path, holder, leaseTimeout) {
+				return
+			}
+		}
+	}()
+
+	return true, nil
+}
+
+// Renew a lease.
+//
+// Extends the lease of a holder, unless the context is done or the holder no longer holds the lock. The context is
+// checked while the path is locked, so no renewal takes place once the context is done. Returns whether the holder
+// still holds the lock.
+func (m *managerImpl) renew(ctx context.Context, path string, holder *ticketImpl, leaseTimeout time.Duration) bool {
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	if ctx.Err() != nil || m.holderOf(path, holder.id) != holder {
+		return false
+	}
+
+	// Journal failures are retried upon the next renewal.
+	m.applyLease(path, holder, leaseTimeout, false)
+
+	return true
+}
+
+// Find the holder of a lock by ticket ID.
+//
+// Returns nil if the ticket is not holding the lock. This assumes lock to the path is provided during the process.
+func (m *managerImpl) holderOf(path string, id int64) *ticketImpl {
+	curLock, ok := m.lockOf(path)
+	if !ok {
+		return nil
+	}
+
+	for _, ticket := range curLock.tickets[:curLock.holderCount()] {
+		if ticket.id == id {
+			return ticket
+		}
+	}
+
+	return nil
+}
+
+// Apply a lease timeout to a holder.
+//
+// Updates the lease timeout if it either extends or shortens the lease as requested, and returns whether it did. This
+// assumes lock to the path is provided during the process.
+func (m *managerImpl) applyLease(path string, holder *ticketImpl, timeout time.Duration, shorten bool) (bool, error) {
+	nextLeaseTimeoutAt := leaseTimeoutAt(m.clock.Monotonic(), timeout)
+
+	if shorten && nextLeaseTimeoutAt >= holder.leaseTimeoutAt || !shorten && nextLeaseTimeoutAt <= holder.leaseTimeoutAt {
+		return false, nil
+	}
+
+	// Refuse to extend the lease past the maximum total hold time, letting it expire as usual.
+	if !shorten && m.maxTotalHoldTime > 0 &&
+		(nextLeaseTimeoutAt == leaseNever || nextLeaseTimeoutAt-holder.acquiredAt > m.maxTotalHoldTime) {
+		return false, ErrHoldTimeExceeded
+	}
+
+	if err := m.journalLease(path, holder.id, timeout); err != nil {
+		return false, err
+	}
+
+	holder.leaseTimeoutAt = nextLeaseTimeoutAt
+	holder.emit(TicketLeaseChanged)
+	m.markChanged(path)
+
+	if shorten {
+		m.audit(path, AuditShortened, holder, timeout)
+		m.logger.Debug("Lease shortened", "path", path, "id", holder.id, "lease_timeout", timeout)
+	} else {
+		m.audit(path, AuditExtended, holder, timeout)
+		m.logger.Debug("Lease extended", "path", path, "id", holder.id, "lease_timeout", timeout)
+	}
+
+	m.scheduleMaintenance(path, timeout)
+
+	return true, nil
+}
+
+// Cap a lease timeout at the maximum total hold time.
+//
+// Lease timeouts exceeding the maximum, including infinite lease timeouts, are capped at it, as leases of acquisitions
+// start upon acquisition.
+func (m *managerImpl) capHoldTime(leaseTimeout time.Duration) time.Duration {
+	if m.maxTotalHoldTime > 0 && (leaseTimeout < 0 || leaseTimeout > m.maxTotalHoldTime) {
+		return m.maxTotalHoldTime
+	}
+
+	return leaseTimeout
+}
+
+// Maintain a path.
+//
+// This assumes lock to the path is provided during the process.
+func (m *managerImpl) maintainPath(path string) {
+	curLock, ok := m.lockOf(path)
+	if !ok || len(curLock.tickets) == 0 {
+		return
+	}
+
+	// Determine which tickets are to survive.
+	//
+	// Journal failures cannot be reported during maintenance, but are repaired by the next compaction of the journal,
+	// which journals the complete state of the manager.
+	//
+	// Expiration is fully evaluated before any promotion takes place, using a single point in time for the entire
+	// pass. This ensures that a waiting acquisition past its timeout is never promoted, even if the lock was freed
+	// during the same pass, and that waiters expiring during the same pass are treated alike no matter their order.
+	now := m.clock.Monotonic()
+	nextTickets := m.expireTickets(path, curLock, now)
+
+	// Complete a pending upgrade once the upgrading ticket is the only holder left.
+	promoted := false
+	fence := curLock.fence
+	span := curLock.span
+	nextLock := &lockImpl{tickets: nextTickets}
+	holderCount := nextLock.holderCount()
+	upgrader := nextLock.upgrader()
+
+	if upgrader != nil && holderCount == 1 {
+		promoted = true
+		fence = m.issueFence()
+
+		upgrader.mode = ModeExclusive
+		upgrader.fence = fence
+		if err := m.journalMode(path, upgrader); err != nil {
+			m.logger.Error("Failed to journal upgrade", "path", path, "id", upgrader.id, "error", err)
+		}
+		upgrader.settleUpgrade(true)
+		m.audit(path, AuditUpgraded, upgrader, 0)
+		m.logger.Debug("Lock upgraded", "path", path, "id", upgrader.id, "fence", fence)
+
+		upgrader = nil
+	}
+
+	// Promote waiting tickets if possible. The first waiting ticket is promoted if the lock is no longer held, and any
+	// shared tickets are promoted for as long as the lock is held in shared mode, unless a holder waits to upgrade it,
+	// or, for semaphores, the capacity is exhausted.
+	for idx := holderCount; idx < len(nextTickets); idx++ {
+		ticket := nextTickets[idx]
+
+		if idx > 0 && (ticket.mode == ModeExclusive || nextTickets[0].mode == ModeExclusive || upgrader != nil ||
+			(curLock.capacity > 0 && idx >= curLock.capacity)) {
+			break
+		}
+
+		promoted = true
+		fence = m.issueFence()
+
+		ticket.fence = fence
+		ticket.acquiredAt = now
+		ticket.acquiredAtWall = m.clock.Now()
+		ticket.leaseTimeoutAt = leaseTimeoutAt(now, ticket.firstLeaseTimeout)
+		if err := m.journalHold(path, ticket); err != nil {
+			m.logger.Error("Failed to journal acquisition", "path", path, "id", ticket.id, "error", err)
+		}
+		ticket.emit(TicketAcquired)
+		ticket.addSpanEvent("promoted")
+		span = m.traceHandoff(path, span, ticket, now-ticket.createdAt)
+		m.audit(path, AuditAcquired, ticket, ticket.firstLeaseTimeout)
+		m.queueTicketCallback(m.onPromote, path, ticket.id)
+		m.logger.Debug("Lock acquired", "path", path, "id", ticket.id, "fence", fence, "waited", now-ticket.createdAt)
+
+		m.scheduleMaintenance(path, ticket.firstLeaseTimeout)
+	}
+
+	// Update the lock state.
+	if len(nextTickets) == 0 {
+		m.deleteLock(path)
+	} else if promoted || len(nextTickets) != len(curLock.tickets) {
+		m.setLock(path, &lockImpl{
+			tickets: nextTickets,
+			fence:   fence,
+			span:    span,
+		})
+	}
+}
+
+// Trace the handoff of a lock to a promoted ticket.
+//
+// Starts the span of the handoff chain of the path unless already started, and records the promotion as a child span
+// of it, covering the wait of the ticket. Returns the span of the handoff chain, which is nil if handoffs are not
+// traced.
+func (m *managerImpl) traceHandoff(path string, pathSpan trace.Span, ticket *ticketImpl, waited time.Duration) trace.Span {
+	if m.tracer == nil {
+		return pathSpan
+	}
+
+	now := m.clock.Now()
+	waitedSince := now.Add(-waited)
+
+	if pathSpan == nil {
+		_, pathSpan = m.tracer.Start(context.Background(), "lockerd.path",
+			trace.WithTimestamp(waitedSince),
+			trace.WithAttributes(attribute.String("lockerd.path", path)),
+		)
+	}
+
+	_, span := m.tracer.Start(trace.ContextWithSpan(context.Background(), pathSpan), "lockerd.handoff",
+		trace.WithTimestamp(waitedSince),
+		trace.WithAttributes(
+			attribute.Int64("lockerd.ticket_id", ticket.id),
+			attribute.String("lockerd.mode", ticket.mode.String()),
+			attribute.Int64("lockerd.fence", ticket.fence),
+		),
+	)
+	span.End(trace.WithTimestamp(now))
+
+	return pathSpan
+}
+
+// Expire the lapsed tickets of a lock.
+//
+// Informs the tickets whose leases or acquisitions have lapsed by the given time, and returns the tickets surviving
+// them, in order. The lock itself is left untouched. This assumes lock to the path is provided during the process.
+func (m *managerImpl) expireTickets(path string, curLock *lockImpl, now time.Duration) []*ticketImpl {
+	var nextTickets []*ticketImpl
+
+	for _, ticket := range curLock.tickets {
+		if ticket.leaseTimeoutAt > 0 {
+			// Locked tickets stay in place until their timeout.
+			if ticket.leaseTimeoutAt > now {
+				nextTickets = append(nextTickets, ticket)
+			} else {
+				if err := m.journalRelease(path, ticket.id); err != nil {
+					m.logger.Error("Failed to journal lease expiry", "path", path, "id", ticket.id, "error", err)
+				}
+				ticket.settleUpgrade(false)
+				ticket.emit(TicketLeaseExpired)
+				m.audit(path, AuditExpired, ticket, 0)
+				m.queueTicketCallback(m.onTimeout, path, ticket.id)
+				m.holdHistograms.record(path, now-ticket.acquiredAt)
+				m.logger.Info("Lease expired", "path", path, "id", ticket.id, "held", now-ticket.acquiredAt)
+			}
+		} else {
+			// Waiting acquisitions stay in play until their timeout.
+			if ticket.acquireTimeoutAt > now {
+				nextTickets = append(nextTickets, ticket)
+			} else {
+				ticket.emit(TicketAcquisitionFailed)
+				ticket.addSpanEvent("timed out")
+				m.audit(path, AuditTimedOut, ticket, 0)
+				m.queueTicketCallback(m.onTimeout, path, ticket.id)
+				m.logger.Info("Acquisition timed out", "path", path, "id", ticket.id, "waited", now-ticket.createdAt)
+			}
+		}
+	}
+
+	return nextTickets
+}
+
+// Schedule maintenance of a path.
+//
+// The path is maintained during the first maintenance pass after the given duration, delayed by a random jitter if
+// configured. Negative durations, as of leases that never expire, are never scheduled.
+func (m *managerImpl) scheduleMaintenance(path string, after time.Duration) {
+	if after < 0 {
+		return
+	}
+
+	if m.maintenanceJitter > 0 {
+		after += time.Duration(rand.Int63n(int64(m.maintenanceJitter)))
+	}
+
+	m.clock.AfterFunc(after, func() {
+		m.maintenanceSync.Lock()
+		defer m.maintenanceSync.Unlock()
+		m.locksNeedingMaintenance = append(m.locksNeedingMaintenance, path)
+	})
+}
+
+// Lock of a path.
+//
+// Returns the lock of the path, and whether the path is tracked. This assumes lock to the path is provided during the
+// process.
+func (m *managerImpl) lockOf(path string) (*lockImpl, bool) {
+	m.locksSync.RLock()
+	defer m.locksSync.RUnlock()
+
+	lock, ok := m.locks[path]
+
+	return lock, ok
+}
+
+// Set the lock for a path.
+//
+// Signals contention to the holders of the lock if tickets wait for it. This assumes lock to the path is provided during
+// the process.
+func (m *managerImpl) setLock(path string, lock *lockImpl) {
+	m.locksSync.Lock()
+	prevLock, ok := m.locks[path]
+	if !ok {
+		m.paths.insert(path)
+	} else {
+		// Carry the trace span of the handoff chain and the capacity over to the new state of the lock.
+		if lock.span == nil {
+			lock.span = prevLock.span
+		}
+		if lock.capacity == 0 {
+			lock.capacity = prevLock.capacity
+		}
+	}
+	m.locks[path] = lock
+	m.locksSync.Unlock()
+
+	lock.contend()
+
+	if !ok && m.onPathCreated != nil {
+		m.queueCallback(func() {
+			m.onPathCreated(path)
+		})
+	}
+
+	m.markChanged(path)
+}
+
+// Delete the lock for a path.
+//
+// This assumes lock to the path is provided during the process.
+func (m *managerImpl) deleteLock(path string) {
+	m.locksSync.Lock()
+	prevLock, ok := m.locks[path]
+	if ok {
+		delete(m.locks, path)
+		m.paths.remove(path)
+	}
+	m.locksSync.Unlock()
+
+	if !ok {
+		return
+	}
+
+	// Fail any acquisitions still waiting for the lock, which would otherwise wait indefinitely. Locks are only deleted
+	// once free of tickets, so this guards against violations of that invariant.
+	for _, ticket := range prevLock.tickets {
+		if ticket.leaseTimeoutAt == 0 && !ticket.settledChanClosed {
+			ticket.emit(TicketAcquisitionFailed)
+			m.logger.Error("Failed acquisition waiting for deleted lock", "path", path, "id", ticket.id)
+		}
+	}
+
+	// End the handoff chain of the path.
+	if prevLock.span != nil {
+		prevLock.span.End()
+	}
+
+	if m.onPathDeleted != nil {
+		m.queueCallback(func() {
+			m.onPathDeleted(path)
+		})
+	}
+
+	m.markChanged(path)
+}
+
+// Mark the state of a path as changed.
+//
+// Advances the generation of the lock, and, once the path is unlocked, notifies subscribers of the path of the state
+// and stages the state for the store. This assumes lock to the path is provided during the process.
+func (m *managerImpl) markChanged(path string) {
+	if lock, ok := m.lockOf(path); ok {
+		m.sequenceSync.Lock()
+		m.nextGeneration++
+		lock.generation = m.nextGeneration
+		m.sequenceSync.Unlock()
+	}
+
+	if m.store != nil {
+		m.storeSync.Lock()
+		if m.storeChangedPaths == nil {
+			m.storeChangedPaths = make(map[string]struct{})
+		}
+		m.storeChangedPaths[path] = struct{}{}
+		m.storeSync.Unlock()
+	}
+
+	m.subscriptionsSync.Lock()
+	defer m.subscriptionsSync.Unlock()
+
+	if len(m.subscriptions[path]) == 0 {
+		return
+	}
+
+	if m.changedPaths == nil {
+		m.changedPaths = make(map[string]struct{})
+	}
+	m.changedPaths[path] = struct{}{}
+}
+
+// Publish the state of changed paths to subscribers.
+//
+// This assumes exclusive lock to the manager is provided during the process.
+func (m *managerImpl) publishChanges() {
+	m.subscriptionsSync.Lock()
+	changedPaths := m.changedPaths
+	m.changedPaths = nil
+	m.subscriptionsSync.Unlock()
+
+	for path := range changedPaths {
+		m.publish(path)
+	}
+}
+
+// Publish the state of a path to subscribers if changed.
+//
+// This assumes lock to the path is provided during the process.
+func (m *managerImpl) publishChangesOf(path string) {
+	m.subscriptionsSync.Lock()
+	_, changed := m.changedPaths[path]
+	delete(m.changedPaths, path)
+	m.subscriptionsSync.Unlock()
+
+	if changed {
+		m.publish(path)
+	}
+}
+
+// Publish the state of a path to subscribers.
+//
+// This assumes lock to the path is provided during the process, so subscriptions of the path are only ever delivered
+// to by one goroutine at a time.
+func (m *managerImpl) publish(path string) {
+	state := m.stateOf(path)
+
+	m.subscriptionsSync.Lock()
+	subscriptions := slices.Clone(m.subscriptions[path])
+	m.subscriptionsSync.Unlock()
+
+	for _, sub := range subscriptions {
+		sub.deliver(state)
+	}
+}
+
+// Stage the state of changed paths for the store.
+//
+// This assumes exclusive lock to the manager is provided during the process.
+func (m *managerImpl) stageStoreChanges() {
+	if m.store == nil {
+		return
+	}
+
+	m.storeSync.Lock()
+	changedPaths := m.storeChangedPaths
+	m.storeChangedPaths = nil
+	m.storeSync.Unlock()
+
+	for path := range changedPaths {
+		m.stageStore(path)
+	}
+}
+
+// Stage the state of a path for the store if changed.
+//
+// This assumes lock to the path is provided during the process.
+func (m *managerImpl) stageStoreChangesOf(path string) {
+	if m.store == nil {
+		return
+	}
+
+	m.storeSync.Lock()
+	_, changed := m.storeChangedPaths[path]
+	delete(m.storeChangedPaths, path)
+	m.storeSync.Unlock()
+
+	if changed {
+		m.stageStore(path)
+	}
+}
+
+// Stage the state of a path for the store.
+//
+// The state replaces any state of the path staged earlier, to be written by the next write to the store. This assumes
+// lock to the path is provided during the process, so the states of a path are staged in order.
+func (m *managerImpl) stageStore(path string) {
+	stored := StoredLock{Path: path}
+
+	if lock, ok := m.lockOf(path); ok {
+		now := m.clock.Monotonic()
+		wallNow := m.clock.Now()
+		holders := lock.tickets[:lock.holderCount()]
+
+		stored.Fence = lock.fence
+		stored.Capacity = lock.capacity
+		stored.Holders = make([]StoredHolder, len(holders))
+
+		for idx, ticket := range holders {
+			stored.Holders[idx] = StoredHolder{
+				Id:         ticket.id,
+				Mode:       ticket.mode,
+				Fence:      ticket.fence,
+				Owner:      ticket.owner,
+				Labels:     ticket.labels,
+				HoldCount:  ticket.holdCount,
+				LeaseUntil: wallLeaseUntil(ticket.leaseTimeoutAt, now, wallNow),
+			}
+		}
+	}
+
+	m.storeSync.Lock()
+	if m.storeChanges == nil {
+		m.storeChanges = make(map[string]StoredLock)
+	}
+	m.storeChanges[path] = stored
+	m.storeSync.Unlock()
+}
+
+// Write the staged changes to the store.
+//
+// Writes one batch at a time, outside of the locks of the manager. If the write fails, the error is logged, and the
+// changes are staged again, unless superseded by changes staged in the meantime, to be retried by the next write.
+func (m *managerImpl) writeStore() {
+	if m.store == nil {
+		return
+	}
+
+	m.storeWriteSync.Lock()
+	defer m.storeWriteSync.Unlock()
+
+	m.storeSync.Lock()
+	changes := m.storeChanges
+	m.storeChanges = nil
+	m.storeSync.Unlock()
+
+	if len(changes) == 0 {
+		return
+	}
+
+	err := m.store.Write(sortedStoredLocks(changes))
+	if err == nil {
+		return
+	}
+
+	m.logger.Error("Failed to write locks to store", "locks", len(changes), "error", err)
+
+	m.storeSync.Lock()
+	defer m.storeSync.Unlock()
+
+	if m.storeChanges == nil {
+		m.storeChanges = make(map[string]StoredLock)
+	}
+	for path, stored := range changes {
+		if _, ok := m.storeChanges[path]; !ok {
+			m.storeChanges[path] = stored
+		}
+	}
+}
+
+// Get the state of a path.
+//
+// This assumes lock to the path is provided during the process.
+func (m *managerImpl) stateOf(path string) LockState {
+	lock, ok := m.lockOf(path)
+	if !ok || len(lock.tickets) == 0 {
+		return LockState{}
+	}
+
+	return lockStateFromLock(lock, m.clock.Monotonic(), m.clock.Now(), 0)
+}
+
+// Queue a callback.
+//
+// The callback is invoked once the manager, or the path, is unlocked.
+func (m *managerImpl) queueCallback(callback func()) {
+	m.callbacksSync.Lock()
+	defer m.callbacksSync.Unlock()
+
+	m.callbacks = append(m.callbacks, callback)
+}
+
+// Queue a ticket lifecycle callback.
+//
+// Does nothing if the callback is not configured.
+func (m *managerImpl) queueTicketCallback(callback func(path string, id int64), path string, id int64) {
+	if callback == nil {
+		return
+	}
+
+	m.queueCallback(func() {
+		callback(path, id)
+	})
+}
+
+// Unlock the manager.
+//
+// Publishes the changes of all paths, and invokes any queued callbacks outside of the critical section. This assumes
+// exclusive lock to the manager is provided.
+func (m *managerImpl) unlock() {
+	m.publishChanges()
+	m.stageStoreChanges()
+	m.sync.Unlock()
+	m.dispatchCallbacks()
+}
+
+// Lock a path.
+//
+// Locks the manager for reading, excluding operations spanning all paths, and locks the path, excluding other
+// operations on it.
+func (m *managerImpl) lockPath(path string) {
+	m.sync.RLock()
+	m.pathLocks.lock(path)
+}
+
+// Unlock a path.
+//
+// Publishes the changes of the path, stages them for the store, and invokes any queued callbacks outside of the critical
+// section.
+func (m *managerImpl) unlockPath(path string) {
+	m.publishChangesOf(path)
+	m.stageStoreChangesOf(path)
+	m.pathLocks.unlock(path)
+	m.sync.RUnlock()
+	m.dispatchCallbacks()
+}
+
+// Dispatch queued callbacks.
+//
+// To retain the order of callbacks, only a single goroutine dispatches callbacks at a time, with any callbacks queued
+// by other goroutines in the meantime being dispatched by the already dispatching goroutine.
+func (m *managerImpl) dispatchCallbacks() {
+	m.callbacksSync.Lock()
+
+	if m.dispatchingCallbacks || len(m.callbacks) == 0 {
+		m.callbacksSync.Unlock()
+		return
+	}
+
+	m.dispatchingCallbacks = true
+
+	for len(m.callbacks) > 0 {
+		callbacks := m.callbacks
+		m.callbacks = nil
+		m.callbacksSync.Unlock()
+
+		for _, callback := range callbacks {
+			callback()
+		}
+
+		m.callbacksSync.Lock()
+	}
+
+	m.dispatchingCallbacks = false
+	m.callbacksSync.Unlock()
+}
+
+func (m *managerImpl) Start() {
+	m.sync.Lock()
+	defer m.sync.Unlock()
+
+	if m.stopChan != nil {
+		return
+	}
+
+	m.stopChan = make(chan struct{})
+
+	m.scheduleMaintenancePass(m.stopChan)
+}
+
+// Schedule a maintenance pass.
+//
+// The pass is performed once the maintenance interval elapses, by the clock, unless stopped in the meantime.
+func (m *managerImpl) scheduleMaintenancePass(stopChan chan struct{}) {
+	m.clock.AfterFunc(m.maintenanceInterval, func() {
+		m.maintain(stopChan)
+	})
+}
+
+// Perform a maintenance pass, and schedule the next, unless stopped.
+//
+// Serves as its own watchdog: if the pass panics, the panic is logged and the next pass is scheduled nonetheless, so
+// leases keep expiring.
+func (m *managerImpl) maintain(stopChan chan struct{}) {
+	select {
+	case <-stopChan:
+		return
+	default:
+	}
+
+	defer func() {
+		if panicked := recover(); panicked != nil {
+			m.logger.Error("Maintenance panicked, restarting", "panic", panicked, "stack", string(debug.Stack()))
+		}
+
+		m.scheduleMaintenancePass(stopChan)
+	}()
+
+	startedAt := m.clock.Now()
+	paths := m.maintainOnce()
+	m.writeStore()
+	m.recordMaintenance(paths, startedAt)
+}
+
+// Perform a maintenance pass.
+//
+// The paths due are maintained one at a time, each locking only the path, while deadlocks are aborted and the journal
+// is compacted with the manager locked exclusively. Returns the number of paths maintained. The manager is unlocked
+// even if the pass panics.
+func (m *managerImpl) maintainOnce() int {
+	// Maintain the paths due. The paths are taken beforehand, so a path whose maintenance panics is not retried.
+	m.maintenanceSync.Lock()
+	paths := m.locksNeedingMaintenance
+	m.locksNeedingMaintenance = nil
+	m.maintenanceSync.Unlock()
+
+	for _, path := range paths {
+		m.maintainPathRecovering(path)
+	}
+
+	// The time of the last compaction is only accessed by maintenance once the manager is created.
+	compactJournal := m.journal != nil && m.journalCompactionInterval > 0 && m.clock.Monotonic()-m.journalCompactedAt >= m.journalCompactionInterval
+	if !m.abortDeadlocks && !compactJournal {
+		return len(paths)
+	}
+
+	m.sync.Lock()
+	defer m.unlock()
+
+	// Abort the youngest acquisition of each deadlock if configured.
+	if m.abortDeadlocks {
+		m.abortDeadlockedAcquisitions()
+	}
+
+	// Compact the journal at the configured interval. Failed compactions are retried at the next interval, with
+	// journaling continuing to the current journal in the meantime.
+	if compactJournal {
+		if err := m.compactJournal(); err != nil {
+			m.logger.Error("Failed to compact journal", "error", err)
+		}
+	}
+
+	return len(paths)
+}
+
+// Maintain a path, recovering from panics.
+//
+// A panic is logged, and does not prevent the maintenance of other paths. The path is unlocked even if its maintenance
+// panics.
+func (m *managerImpl) maintainPathRecovering(path string) {
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	defer func() {
+		if panicked := recover(); panicked != nil {
+			m.logger.Error("Maintenance of path panicked", "path", path, "panic", panicked, "stack", string(debug.Stack()))
+		}
+	}()
+
+	m.maintainPath(path)
+}
+
+func (m *managerImpl) Stop() {
+	m.sync.Lock()
+	if m.stopChan != nil {
+		close(m.stopChan)
+		m.stopChan = nil
+	}
+	m.sync.Unlock()
+
+	// Write the changes staged since the last maintenance pass.
+	m.writeStore()
+}
+
+func (m *managerImpl) Acquire(path string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (Ticket, error) {
+	ticket, err := m.acquire(context.Background(), path, lockTimeout, leaseTimeout, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return ticket, nil
+}
+
+// Acquire a lock.
+//
+// Traces the acquisition if the context carries a recording span.
+func (m *managerImpl) acquire(ctx context.Context, path string, lockTimeout time.Duration, leaseTimeout time.Duration, options []AcquireOptions) (*ticketImpl, error) {
+	acquireOptions := resolveAcquireOptions(options)
+	if err := acquireOptions.validateMetadata(); err != nil {
+		return nil, err
+	}
+
+	// Clean and validate the path.
+	path, err := m.pathValidator.Validate(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Limit the timeouts to the configured range.
+	if lockTimeout, err = m.timeoutLimits.limitLock(lockTimeout); err != nil {
+		return nil, err
+	}
+	if leaseTimeout, err = m.timeoutLimits.limitLease(leaseTimeout); err != nil {
+		return nil, err
+	}
+
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	if m.draining {
+		return nil, ErrDraining
+	}
+
+	namespace := m.namespaceOf(path)
+	leaseTimeout = m.capHoldTime(namespace.capLease(leaseTimeout))
+
+	// Create a lock representation if one does not already exist for the given path.
+	m.settle(path)
+	prevLock, _ := m.lockOf(path)
+
+	// Re-enter the lock if it is already held by the owner.
+	if holder := prevLock.holderOwnedBy(acquireOptions.Owner); holder != nil {
+		if err := m.reenter(path, holder, leaseTimeout); err != nil {
+			return nil, err
+		}
+
+		return holder, nil
+	}
+
+	// Evaluate the acquisition against the semaphore if the lock has a capacity.
+	prevLock, err = semaphoreOf(prevLock, namespace, acquireOptions.Capacity)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse to queue the acquisition beyond the queue depth of the namespace.
+	if !m.admits(prevLock, acquireOptions.Mode) && lockTimeout > 0 && namespace.MaxQueueDepth > 0 &&
+		len(prevLock.tickets)-prevLock.holderCount() >= namespace.MaxQueueDepth {
+		return nil, ErrQueueFull
+	}
+
+	// Create a ticket and evaluate locking.
+	ticket := m.newTicket(acquireOptions, leaseTimeout)
+
+	if span := trace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(attribute.String("lockerd.path", path), attribute.Int64("lockerd.ticket_id", ticket.id))
+		ticket.span = span
+	}
+
+	if m.admits(prevLock, ticket.mode) {
+		// If the ticket can hold the lock immediately, we set its lease timeout and informs of acquisition
+		// immediately.
+		if err := m.hold(path, prevLock, ticket); err != nil {
+			return nil, err
+		}
+	} else if lockTimeout <= 0 {
+		// If the lock timeout is immediate, we simply indicate that the lock could not be acquired.
+		ticket.emit(TicketAcquisitionFailed)
+		ticket.addSpanEvent("timed out")
+		m.audit(path, AuditTimedOut, ticket, 0)
+		m.queueTicketCallback(m.onTimeout, path, ticket.id)
+		m.logger.Debug("Acquisition timed out", "path", path, "id", ticket.id, "waited", time.Duration(0))
+	} else {
+		// If the ticket cannot hold the lock, we append it to the list of tickets and set its acquisition timeout.
+		m.setLock(path, &lockImpl{
+			tickets:  append(prevLock.tickets, ticket),
+			fence:    prevLock.fence,
+			capacity: prevLock.capacity,
+		})
+
+		ticket.acquireTimeoutAt = ticket.createdAt + lockTimeout
+		ticket.addSpanEvent("queued")
+		m.logger.Debug("Acquisition enqueued", "path", path, "id", ticket.id, "position", len(prevLock.tickets)-prevLock.holderCount()+1)
+
+		m.scheduleMaintenance(path, lockTimeout)
+	}
+
+	return ticket, nil
+}
+
+func (m *managerImpl) AcquireContext(ctx context.Context, path string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (Ticket, error) {
+	ticket, err := m.acquire(ctx, path, lockTimeout, leaseTimeout, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Abandon the acquisition if the context is canceled before the acquisition is settled. The goroutine exits as
+	// soon as the acquisition is settled, so it does not outlive the wait for the lock.
+	select {
+	case <-ticket.settledChan:
+		return ticket, nil
+	default:
+	}
+
+	path, _ = m.pathValidator.Validate(path)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.abandon(path, ticket)
+		case <-ticket.settledChan:
+		}
+	}()
+
+	return ticket, nil
+}
+
+func (m *managerImpl) AcquireWithCancel(path string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (Ticket, func(), error) {
+	ticket, err := m.acquire(context.Background(), path, lockTimeout, leaseTimeout, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path, _ = m.pathValidator.Validate(path)
+
+	return ticket, func() {
+		m.abandon(path, ticket)
+	}, nil
+}
+
+func (m *managerImpl) AcquireOrExtend(ctx context.Context, path string, id int64, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (Ticket, bool, error) {
+	ticket, err := m.extendTicket(path, id, leaseTimeout)
+	if err != nil {
+		return nil, false, err
+	} else if ticket != nil {
+		return ticket, true, nil
+	}
+
+	acquired, err := m.AcquireContext(ctx, path, lockTimeout, leaseTimeout, options...)
+
+	return acquired, false, err
+}
+
+// Extend the lease of a ticket if holding the lock.
+//
+// Returns the ticket of the ID, whether holding or waiting for the lock, or nil if it neither holds nor waits for the
+// lock.
+func (m *managerImpl) extendTicket(path string, id int64, leaseTimeout time.Duration) (*ticketImpl, error) {
+	// Clean and validate the path, and limit the lease to the configured range.
+	path, err := m.pathValidator.Validate(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if leaseTimeout, err = m.timeoutLimits.limitLease(leaseTimeout); err != nil {
+		return nil, err
+	}
+
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	// Find the ticket, and extend its lease if it holds the lock.
+	curLock, ok := m.lockOf(path)
+	if !ok {
+		return nil, nil
+	}
+
+	for idx, ticket := range curLock.tickets {
+		if ticket.id != id {
+			continue
+		}
+
+		if idx < curLock.holderCount() {
+			if _, err := m.applyLease(path, ticket, m.namespaceOf(path).capLease(leaseTimeout), false); err != nil {
+				return nil, err
+			}
+		}
+
+		return ticket, nil
+	}
+
+	return nil, nil
+}
+
+// Abandon an acquisition.
+//
+// Removes the ticket from the queue of the lock and informs it of failed acquisition, unless the acquisition has
+// already been settled.
+func (m *managerImpl) abandon(path string, ticket *ticketImpl) {
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	m.abortAcquisition(path, ticket)
+}
+
+// Abort an acquisition.
+//
+// Removes a waiting ticket from the queue of the lock and informs it of failed acquisition, unless the acquisition has
+// already been settled. This assumes lock to the path is provided during the process.
+func (m *managerImpl) abortAcquisition(path string, ticket *ticketImpl) {
+	if ticket.settledChanClosed {
+		return
+	}
+
+	curLock, ok := m.lockOf(path)
+	if !ok {
+		// The lock of a waiting ticket is never deleted, but should it be, the acquisition must still fail rather than
+		// wait indefinitely.
+		ticket.emit(TicketAcquisitionFailed)
+		m.logger.Error("Aborted acquisition of missing lock", "path", path, "id", ticket.id)
+		return
+	}
+
+	nextTickets := make([]*ticketImpl, 0, len(curLock.tickets))
+	for _, t := range curLock.tickets {
+		if t != ticket {
+			nextTickets = append(nextTickets, t)
+		}
+	}
+
+	ticket.emit(TicketAcquisitionFailed)
+	ticket.addSpanEvent("aborted")
+	m.audit(path, AuditCanceled, ticket, 0)
+	m.logger.Debug("Acquisition aborted", "path", path, "id", ticket.id, "waited", m.clock.Monotonic()-ticket.createdAt)
+
+	// Update the lock, and perform maintenance, as the removal may allow waiting tickets to be promoted.
+	if len(nextTickets) > 0 {
+		m.setLock(path, &lockImpl{
+			tickets: nextTickets,
+			fence:   curLock.fence,
+		})
+		m.maintainPath(path)
+	} else {
+		m.deleteLock(path)
+	}
+}
+
+func (m *managerImpl) TryAcquire(path string, leaseTimeout time.Duration, options ...AcquireOptions) (Ticket, bool, error) {
+	return m.tryAcquire(path, leaseTimeout, options, false)
+}
+
+func (m *managerImpl) AcquireIfUnlocked(path string, leaseTimeout time.Duration, options ...AcquireOptions) (Ticket, bool, error) {
+	return m.tryAcquire(path, leaseTimeout, options, true)
+}
+
+// Try to acquire a lock.
+//
+// Acquires the lock as per TryAcquire, or as per AcquireIfUnlocked if only unlocked paths are to be acquired.
+func (m *managerImpl) tryAcquire(path string, leaseTimeout time.Duration, options []AcquireOptions, ifUnlocked bool) (Ticket, bool, error) {
+	acquireOptions := resolveAcquireOptions(options)
+	if err := acquireOptions.validateMetadata(); err != nil {
+		return nil, false, err
+	}
+
+	// Clean and validate the path.
+	path, err := m.pathValidator.Validate(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Limit the lease timeout to the configured range.
+	if leaseTimeout, err = m.timeoutLimits.limitLease(leaseTimeout); err != nil {
+		return nil, false, err
+	}
+
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	if m.draining {
+		return nil, false, ErrDraining
+	}
+
+	namespace := m.namespaceOf(path)
+	leaseTimeout = m.capHoldTime(namespace.capLease(leaseTimeout))
+
+	// Only create a ticket if the lock can be held immediately.
+	m.settle(path)
+	prevLock, _ := m.lockOf(path)
+
+	if ifUnlocked && prevLock != nil {
+		return nil, false, nil
+	}
+
+	if holder := prevLock.holderOwnedBy(acquireOptions.Owner); holder != nil {
+		if err := m.reenter(path, holder, leaseTimeout); err != nil {
+			return nil, false, err
+		}
+
+		return holder, true, nil
+	}
+
+	prevLock, err = semaphoreOf(prevLock, namespace, acquireOptions.Capacity)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !m.admits(prevLock, acquireOptions.Mode) {
+		return nil, false, nil
+	}
+
+	ticket := m.newTicket(acquireOptions, leaseTimeout)
+	if err := m.hold(path, prevLock, ticket); err != nil {
+		return nil, false, err
+	}
+
+	return ticket, true, nil
+}
+
+// Create a new ticket.
+//
+// This assumes lock to the path is provided during the process.
+func (m *managerImpl) newTicket(options AcquireOptions, leaseTimeout time.Duration) *ticketImpl {
+	ticket := newTicket(m.nextId(), options.Mode, leaseTimeout)
+	ticket.owner = options.Owner
+	ticket.labels = maps.Clone(options.Labels)
+	ticket.createdAt = m.clock.Monotonic()
+
+	return ticket
+}
+
+// Re-enter a lock.
+//
+// Increments the hold count of a holder, and extends its lease if the lease timeout is later, unless past the maximum
+// total hold time. The holder is notified of acquisition anew if it is not already pending. This assumes lock to the
+// path is provided during the process.
+func (m *managerImpl) reenter(path string, holder *ticketImpl, leaseTimeout time.Duration) error {
+	if _, err := m.applyLease(path, holder, leaseTimeout, false); err != nil && err != ErrHoldTimeExceeded {
+		return err
+	}
+
+	if err := m.journalHoldCount(path, holder.id, holder.holdCount+1); err != nil {
+		return err
+	}
+
+	holder.holdCount++
+	m.markChanged(path)
+	m.audit(path, AuditReentered, holder, leaseTimeout)
+	m.logger.Debug("Lock re-entered", "path", path, "id", holder.id, "hold_count", holder.holdCount)
+
+	holder.notifyAcquired(true)
+
+	return nil
+}
+
+// Issue a fencing token.
+//
+// Fencing tokens are drawn from a single counter for all paths, so the token of a path strictly increases even if the
+// lock is deleted and subsequently recreated.
+func (m *managerImpl) issueFence() int64 {
+	m.sequenceSync.Lock()
+	defer m.sequenceSync.Unlock()
+
+	m.nextFence++
+
+	return m.nextFence
+}
+
+// Make a ticket hold a lock.
+//
+// Adds the ticket to the holders of the lock, which must admit the ticket, ahead of any waiting tickets. The lock is
+// left untouched if the acquisition cannot be journaled. This assumes lock to the path is provided during the process.
+func (m *managerImpl) hold(path string, prevLock *lockImpl, ticket *ticketImpl) error {
+	var tickets []*ticketImpl
+	if prevLock == nil {
+		tickets = []*ticketImpl{ticket}
+	} else if holderCount := prevLock.holderCount(); holderCount < len(prevLock.tickets) {
+		// Barge ahead of the waiting tickets.
+		tickets = slices.Concat(prevLock.tickets[:holderCount], []*ticketImpl{ticket}, prevLock.tickets[holderCount:])
+	} else {
+		tickets = append(prevLock.tickets, ticket)
+	}
+
+	// Retain the capacity of the semaphore, which is not yet stored if defined by this acquisition.
+	var capacity int
+	if prevLock != nil {
+		capacity = prevLock.capacity
+	}
+
+	ticket.fence = m.issueFence()
+
+	if err := m.journalHold(path, ticket); err != nil {
+		return err
+	}
+
+	m.setLock(path, &lockImpl{
+		tickets:  tickets,
+		fence:    ticket.fence,
+		capacity: capacity,
+	})
+
+	ticket.acquiredAt = m.clock.Monotonic()
+	ticket.acquiredAtWall = m.clock.Now()
+	ticket.leaseTimeoutAt = leaseTimeoutAt(ticket.acquiredAt, ticket.firstLeaseTimeout)
+	ticket.emit(TicketAcquired)
+	ticket.addSpanEvent("acquired")
+	m.audit(path, AuditAcquired, ticket, ticket.firstLeaseTimeout)
+	m.queueTicketCallback(m.onAcquire, path, ticket.id)
+	m.logger.Debug("Lock acquired", "path", path, "id", ticket.id, "fence", ticket.fence, "waited", ticket.acquiredAt-ticket.createdAt)
+
+	m.scheduleMaintenance(path, ticket.firstLeaseTimeout)
+
+	return nil
+}
+
+// Journal the acquisition of a lock.
+//
+// This assumes lock to the path is provided during the process.
+func (m *managerImpl) journalHold(path string, ticket *ticketImpl) error {
+	if m.journal == nil {
+		return nil
+	}
+
+	return m.appendJournal(JournalRecord{
+		Op:         JournalOpHold,
+		Path:       path,
+		Id:         ticket.id,
+		Mode:       ticket.mode,
+		Fence:      ticket.fence,
+		Owner:      ticket.owner,
+		Labels:     ticket.labels,
+		LeaseUntil: journalLeaseUntil(m.clock.Now(), ticket.firstLeaseTimeout),
+	})
+}
+
+// Journal the change of a hold count.
+//
+// This assumes lock to the path is provided during the process.
+func (m *managerImpl) journalHoldCount(path string, id int64, holdCount int) error {
+	if m.journal == nil {
+		return nil
+	}
+
+	return m.appendJournal(JournalRecord{
+		Op:        JournalOpHoldCount,
+		Path:      path,
+		Id:        id,
+		HoldCount: holdCount,
+	})
+}
+
+// Journal the change of a lock mode.
+//
+// Journals the mode and fencing token of the ticket, which must be updated beforehand. This assumes lock to the path is
+// provided during the process.
+func (m *managerImpl) journalMode(path string, ticket *ticketImpl) error {
+	if m.journal == nil {
+		return nil
+	}
+
+	return m.appendJournal(JournalRecord{
+		Op:    JournalOpMode,
+		Path:  path,
+		Id:    ticket.id,
+		Mode:  ticket.mode,
+		Fence: ticket.fence,
+	})
+}
+
+// Journal the change of a lease.
+//
+// This assumes lock to the path is provided during the process.
+func (m *managerImpl) journalLease(path string, id int64, timeout time.Duration) error {
+	if m.journal == nil {
+		return nil
+	}
+
+	return m.appendJournal(JournalRecord{
+		Op:         JournalOpLease,
+		Path:       path,
+		Id:         id,
+		LeaseUntil: journalLeaseUntil(m.clock.Now(), timeout),
+	})
+}
+
+// Journal the release or expiry of a lease.
+//
+// This assumes lock to the path is provided during the process.
+func (m *managerImpl) journalRelease(path string, id int64) error {
+	if m.journal == nil {
+		return nil
+	}
+
+	return m.appendJournal(JournalRecord{
+		Op:   JournalOpRelease,
+		Path: path,
+		Id:   id,
+	})
+}
+
+// Append a record to the journal.
+//
+// Records of a path are appended one at a time under the lock of the path, retaining their order, whereas records of
+// different paths are appended concurrently, so a journal awaiting replication of a record does not hold up others.
+func (m *managerImpl) appendJournal(record JournalRecord) error {
+	return m.journal.Append(record)
+}
+
+// Compact the journal.
+//
+// Replaces the journal with a snapshot of the current lock holders. This assumes exclusive lock to the manager is
+// provided during the process.
+func (m *managerImpl) compactJournal() error {
+	now := m.clock.Monotonic()
+	wallNow := m.clock.Now()
+
+	var holders []JournalRecord
+
+	for path, lock := range m.locks {
+		for _, ticket := range lock.tickets[:lock.holderCount()] {
+			holders = append(holders, JournalRecord{
+				Op:         JournalOpHold,
+				Path:       path,
+				Id:         ticket.id,
+				Mode:       ticket.mode,
+				Fence:      ticket.fence,
+				Owner:      ticket.owner,
+				Labels:     ticket.labels,
+				HoldCount:  ticket.holdCount,
+				LeaseUntil: wallLeaseUntil(ticket.leaseTimeoutAt, now, wallNow),
+			})
+		}
+	}
+
+	m.journalCompactedAt = now
+
+	return m.journal.Compact(holders)
+}
+
+func (m *managerImpl) IsLocked(path string) (lockers []int64, err error) {
+	// Clean and validate the path.
+	path, err = m.pathValidator.Validate(path)
+	if err != nil {
+		return
+	}
+
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	// Test the lock state.
+	lock, ok := m.lockOf(path)
+	if !ok || len(lock.tickets) == 0 {
+		return
+	}
+
+	holderCount := lock.holderCount()
+	lockers = make([]int64, holderCount)
+
+	for idx, ticket := range lock.tickets[:holderCount] {
+		lockers[idx] = ticket.id
+	}
+
+	return
+}
+
+func (m *managerImpl) QueuePosition(path string, id int64) (int, int, error) {
+	// Clean and validate the path.
+	path, err := m.pathValidator.Validate(path)
+	if err != nil {
+		return -1, 0, err
+	}
+
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	// Scan the tickets of the lock.
+	curLock, ok := m.lockOf(path)
+	if !ok {
+		return -1, 0, nil
+	}
+
+	holderCount := curLock.holderCount()
+	total := len(curLock.tickets) - holderCount
+
+	for idx, ticket := range curLock.tickets {
+		if ticket.id == id {
+			return max(idx-holderCount+1, 0), total, nil
+		}
+	}
+
+	return -1, total, nil
+}
+
+func (m *managerImpl) Inspect(path string, options ...InspectOptions) (state LockState, err error) {
+	var opts InspectOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	// Clean and validate the path.
+	path, err = m.pathValidator.Validate(path)
+	if err != nil {
+		return
+	}
+
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	lock, ok := m.lockOf(path)
+	if !ok || len(lock.tickets) == 0 {
+		return LockState{}, nil
+	}
+
+	return lockStateFromLock(lock, m.clock.Monotonic(), m.clock.Now(), opts.AcquirersLimit), nil
+}
+
+func (m *managerImpl) Subscribe(path string) (<-chan LockState, func(), error) {
+	// Clean and validate the path.
+	path, err := m.pathValidator.Validate(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	// Register the subscription, and deliver the current state.
+	sub := newSubscription()
+
+	m.subscriptionsSync.Lock()
+	if m.subscriptions == nil {
+		m.subscriptions = make(map[string][]*subscription)
+	}
+	m.subscriptions[path] = append(m.subscriptions[path], sub)
+	m.subscriptionsSync.Unlock()
+
+	sub.deliver(m.stateOf(path))
+
+	unsubscribe := func() {
+		m.lockPath(path)
+		defer m.unlockPath(path)
+
+		m.subscriptionsSync.Lock()
+		defer m.subscriptionsSync.Unlock()
+
+		subscriptions := m.subscriptions[path]
+		for idx, s := range subscriptions {
+			if s == sub {
+				subscriptions = append(subscriptions[:idx:idx], subscriptions[idx+1:]...)
+				break
+			}
+		}
+
+		if len(subscriptions) == 0 {
+			delete(m.subscriptions, path)
+		} else {
+			m.subscriptions[path] = subscriptions
+		}
+
+		sub.close()
+	}
+
+	return sub.stateChan, unsubscribe, nil
+}
+
+func (m *managerImpl) InspectAll() (states map[string]LockState, err error) {
+	// Lock the manager.
+	m.sync.Lock()
+	defer m.unlock()
+
+	// Build the state map.
+	now := m.clock.Monotonic()
+	wallNow := m.clock.Now()
+	states = make(map[string]LockState, len(m.locks))
+
+	for path, lock := range m.locks {
+		states[path] = lockStateFromLock(lock, now, wallNow, 0)
+	}
+
+	return
+}
+
+func (m *managerImpl) InspectPattern(pattern string) (states map[string]LockState, err error) {
+	// Clean and validate the pattern.
+	pattern, err = m.pathValidator.ValidatePattern(pattern)
+	if err != nil {
+		return
+	}
+
+	// Lock the manager.
+	m.sync.Lock()
+	defer m.unlock()
+
+	// Build the state map of the matching paths.
+	now := m.clock.Monotonic()
+	wallNow := m.clock.Now()
+
+	prefix, wildcard := strings.CutSuffix(pattern, "*")
+	if !wildcard {
+		states = make(map[string]LockState, 1)
+		if lock, ok := m.locks[pattern]; ok {
+			states[pattern] = lockStateFromLock(lock, now, wallNow, 0)
+		}
+
+		return
+	}
+
+	paths, _ := m.paths.rangeOf(prefix, "", 0)
+	states = make(map[string]LockState, len(paths))
+
+	for _, path := range paths {
+		states[path] = lockStateFromLock(m.locks[path], now, wallNow, 0)
+	}
+
+	return
+}
+
+func (m *managerImpl) InspectRange(prefix string, after string, limit int) (states map[string]LockState, next string, err error) {
+	// Lock the manager.
+	m.sync.Lock()
+	defer m.unlock()
+
+	// Select the paths of the range.
+	paths, more := m.paths.rangeOf(prefix, after, limit)
+	if more {
+		next = paths[len(paths)-1]
+	}
+
+	// Build the state map.
+	now := m.clock.Monotonic()
+	wallNow := m.clock.Now()
+	states = make(map[string]LockState, len(paths))
+
+	for _, path := range paths {
+		states[path] = lockStateFromLock(m.locks[path], now, wallNow, 0)
+	}
+
+	return
+}
+
+func (m *managerImpl) DefaultTimeouts() (time.Duration, time.Duration) {
+	return m.defaultLockTimeout, m.defaultLeaseTimeout
+}
+
+func (m *managerImpl) Namespaces() ([]NamespaceState, error) {
+	// Lock the manager.
+	m.sync.Lock()
+	defer m.unlock()
+
+	// Count the locks by namespace, including the default and configured namespaces without locks.
+	counts := map[string]int{"": 0}
+	for name := range m.namespaces {
+		counts[name] = 0
+	}
+	for _, path := range m.paths.paths {
+		counts[PathNamespace(path)]++
+	}
+
+	names := slices.Sorted(maps.Keys(counts))
+	namespaces := make([]NamespaceState, len(names))
+
+	for idx, name := range names {
+		namespaces[idx] = NamespaceState{
+			Name:   name,
+			Config: m.namespaceConfig(name),
+			Locks:  counts[name],
+		}
+	}
+
+	return namespaces, nil
+}
+
+// Configuration of the namespace of a path.
+func (m *managerImpl) namespaceOf(path string) NamespaceConfig {
+	return m.namespaceConfig(PathNamespace(path))
+}
+
+// Configuration of a namespace.
+//
+// Namespaces without configuration, including the default namespace, are configured by the default namespace
+// configuration.
+func (m *managerImpl) namespaceConfig(name string) NamespaceConfig {
+	if config, ok := m.namespaces[name]; ok && name != "" {
+		return config
+	}
+
+	return m.defaultNamespace
+}
+
+func (m *managerImpl) Drain(ctx context.Context) error {
+	m.sync.Lock()
+	if !m.draining {
+		m.logger.Info("Draining lock manager")
+	}
+	m.draining = true
+	m.announceShutdown(0)
+	m.sync.Unlock()
+
+	// Wait for the waiting acquisitions to settle, checking at the maintenance interval, as that is when they time
+	// out.
+	for {
+		m.sync.Lock()
+		waiting := 0
+		for _, lock := range m.locks {
+			waiting += len(lock.tickets) - lock.holderCount()
+		}
+		m.sync.Unlock()
+
+		if waiting == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.clock.After(m.maintenanceInterval):
+		}
+	}
+}
+
+func (m *managerImpl) AnnounceShutdown(grace time.Duration) {
+	m.sync.Lock()
+	defer m.sync.Unlock()
+
+	if m.announceShutdown(grace) {
+		m.logger.Info("Announcing shutdown", "grace", grace)
+	}
+}
+
+// Announce shutdown unless announced before.
+//
+// Returns whether shutdown was announced. This assumes exclusive lock to the manager is provided during the process.
+func (m *managerImpl) announceShutdown(grace time.Duration) bool {
+	if !m.shutdownDeadline.IsZero() {
+		return false
+	}
+
+	m.shutdownDeadline = m.clock.Now().Add(max(grace, 0))
+	close(m.shutdownChan)
+
+	return true
+}
+
+func (m *managerImpl) ShutdownAnnounced() <-chan struct{} {
+	return m.shutdownChan
+}
+
+func (m *managerImpl) ShutdownDeadline() time.Time {
+	m.sync.RLock()
+	defer m.sync.RUnlock()
+
+	return m.shutdownDeadline
+}
+
+func (m *managerImpl) ValidatePath(path string) (string, error) {
+	return m.pathValidator.Validate(path)
 }
@@ -1,14 +1,127 @@
 package locking
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 const timeScale = 100 * time.Millisecond
 
+func TestManagerIDStrategy(t *testing.T) {
+	for _, strategy := range []IDStrategy{IDStrategySequential, IDStrategyRandom, IDStrategyUUID} {
+		manager, _ := NewManager(Config{IDStrategy: strategy})
+
+		ids := make(map[int64]bool)
+		successive := 0
+		var prevId int64
+
+		for i := 0; i < 100; i++ {
+			ticket, _ := manager.Acquire(fmt.Sprintf("a/%d", i), timeScale, timeScale)
+
+			if ticket.Id() <= 0 || ids[ticket.Id()] {
+				t.Fatalf("Expected unique positive ID, got %d", ticket.Id())
+			}
+			if prevId != 0 && ticket.Id() == prevId+1 {
+				successive++
+			}
+
+			ids[ticket.Id()] = true
+			prevId = ticket.Id()
+		}
+
+		// Assert that only sequential IDs follow one another.
+		if strategy == IDStrategySequential && successive != 99 || strategy != IDStrategySequential && successive > 0 {
+			t.Fatalf("Unexpected %d successive IDs for strategy %d", successive, strategy)
+		}
+	}
+}
+
+func TestExternalId(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-8[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	for _, id := range []int64{1, 2, 42, 1 << 40, math.MaxInt64 - 1, math.MaxInt64} {
+		// Assert that IDs of the UUID strategy are formatted as UUIDs of version 8, and parsed back.
+		externalId := ExternalId(id, IDStrategyUUID)
+		if !uuidPattern.MatchString(externalId) {
+			t.Fatalf("Expected UUID of version 8 for %d, got %q", id, externalId)
+		}
+		if parsed, err := ParseExternalId(externalId); parsed != id || err != nil {
+			t.Fatalf("Expected UUID %q to be parsed as %d, got %d, %v", externalId, id, parsed, err)
+		}
+		if parsed, err := ParseExternalId(strings.ToUpper(externalId)); parsed != id || err != nil {
+			t.Fatalf("Expected upper case UUID %q to be parsed as %d, got %d, %v", externalId, id, parsed, err)
+		}
+
+		// Assert that IDs of other strategies are formatted in base 10, and parsed back.
+		if externalId := ExternalId(id, IDStrategyRandom); externalId != strconv.FormatInt(id, 10) {
+			t.Fatalf("Expected base-10 ID %d, got %q", id, externalId)
+		}
+		if parsed, err := ParseExternalId(strconv.FormatInt(id, 10)); parsed != id || err != nil {
+			t.Fatalf("Expected %d to be parsed, got %d, %v", id, parsed, err)
+		}
+	}
+
+	// Assert that UUIDs not encoding an ID are refused.
+	externalId := ExternalId(42, IDStrategyUUID)
+	corrupted := externalId[:35] + "0"
+	if corrupted == externalId {
+		corrupted = externalId[:35] + "1"
+	}
+
+	for _, invalid := range []string{
+		"",
+		"0",
+		"-1",
+		"abc",
+		corrupted,
+		strings.Replace(externalId, "-8", "-4", 1),
+		"00000000-0000-8000-8000-000000000000",
+		strings.ReplaceAll(externalId, "-", ""),
+	} {
+		if _, err := ParseExternalId(invalid); err != ErrInvalidExternalId {
+			t.Fatalf("Expected %q to be invalid, got %v", invalid, err)
+		}
+	}
+}
+
+func TestManagerIDBoundary(t *testing.T) {
+	manager, _ := NewManager(Config{})
+	manager.(*managerImpl).nextTicketId = math.MaxInt64
+
+	// Assert that the largest ID is usable, and that the sequence wraps around to positive IDs.
+	ticketA, _ := manager.Acquire("a", timeScale, timeScale)
+	ticketB, _ := manager.Acquire("b", timeScale, timeScale)
+
+	if ticketA.Id() != math.MaxInt64 || ticketB.Id() != 1 {
+		t.Fatalf("Expected IDs %d and 1, got %d and %d", int64(math.MaxInt64), ticketA.Id(), ticketB.Id())
+	}
+
+	AssertPathLockedBy(t, manager, "a", math.MaxInt64)
+
+	if found, _ := manager.Release("a", math.MaxInt64); !found {
+		t.Fatalf("Expected lock to be released")
+	}
+}
+
 func TestManagerAcquireInvalidPath(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
 	go manager.Start()
 	defer manager.Stop()
 
@@ -23,8 +136,9 @@ func TestManagerAcquireInvalidPath(t *testing.T) {
 }
 
 func TestManagerAcquireExpires(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
-	go manager.Start()
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
 	defer manager.Stop()
 
 	ticketA, err := manager.Acquire("a", 10*timeScale, 10*timeScale)
@@ -50,15 +164,100 @@ func TestManagerAcquireExpires(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketA.Id())
 
 	// Wait for the lock to time out.
-	time.Sleep(11 * timeScale)
+	clock.Advance(11 * timeScale)
 
 	// Assert that the path is no longer locked.
 	AssertPathLocked(t, manager, "a", 0)
 }
 
+func TestManagerMockClock(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("a", timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("a", 20*timeScale, 10*timeScale)
+
+	if !<-ticketA.Acquired() {
+		t.Fatalf("Lock was not immediately acquired")
+	}
+
+	// Assert that the lease does not expire before its time.
+	clock.Advance(9 * timeScale)
+	AssertPathLocked(t, manager, "a", ticketA.Id())
+
+	// Assert that the waiting ticket is promoted once the lease expires, without any real delay.
+	clock.Advance(timeScale)
+	AssertPathLocked(t, manager, "a", ticketB.Id())
+
+	select {
+	case status := <-ticketB.Acquired():
+		if !status {
+			t.Fatalf("Waiting ticket failed to acquire the lock")
+		}
+	default:
+		t.Fatalf("Waiting ticket was not promoted")
+	}
+
+	// Assert that the promoted ticket is leased from the time of its promotion.
+	if state, _ := manager.Inspect("a"); state.LockTimeout != 10*timeScale {
+		t.Fatalf("Expected lock timeout of %v, got %v", 10*timeScale, state.LockTimeout)
+	}
+}
+
+func TestManagerFairness(t *testing.T) {
+	for _, test := range []struct {
+		fairness Fairness
+		barging  bool
+	}{
+		{FairnessFair, false},
+		{FairnessBarging, true},
+	} {
+		clock := NewMockClock(time.Unix(0, 0))
+		manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock, Fairness: test.fairness})
+
+		ticketA, _ := manager.Acquire("a", timeScale, 10*timeScale)
+		ticketB, _ := manager.Acquire("a", 100*timeScale, 10*timeScale)
+
+		// Let the lease lapse without maintenance promoting the waiting ticket.
+		clock.Advance(10 * timeScale)
+		AssertPathLockedBy(t, manager, "a", ticketA.Id())
+
+		// Assert that a newcomer barges ahead of the waiting ticket only if barging.
+		_, acquired, _ := manager.TryAcquire("a", 10*timeScale)
+		if acquired != test.barging {
+			t.Fatalf("Expected immediate acquisition to be %v with fairness %d, got %v", test.barging, test.fairness, acquired)
+		}
+
+		ticketC, _ := manager.Acquire("a", 100*timeScale, 10*timeScale)
+		manager.Start()
+
+		if test.barging {
+			// The newcomer takes the lock, and the waiting ticket keeps waiting behind it, even after maintenance.
+			clock.Advance(timeScale)
+
+			state, _ := manager.Inspect("a")
+			if state.Holders[0].Id == ticketB.Id() || len(state.Acquirers) != 2 || state.Acquirers[0].Id != ticketB.Id() {
+				t.Fatalf("Expected waiting ticket to remain first in queue, got %+v", state)
+			}
+		} else {
+			// The waiting ticket is promoted right away, and the newcomer queued behind it.
+			AssertPathLockedBy(t, manager, "a", ticketB.Id())
+
+			if position, _, _ := manager.QueuePosition("a", ticketC.Id()); position != 1 {
+				t.Fatalf("Expected newcomer to be queued first, got position %d", position)
+			}
+		}
+
+		manager.Stop()
+	}
+}
+
 func TestManagerAcquireSecondTimesOutWhileAcquiring(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
-	go manager.Start()
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
 	defer manager.Stop()
 
 	ticketA, err := manager.Acquire("a", 10*timeScale, 20*timeScale)
@@ -101,7 +300,7 @@ func TestManagerAcquireSecondTimesOutWhileAcquiring(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketA.Id())
 
 	// Assert that after a second, the lock acquisition fails.
-	time.Sleep(11 * timeScale)
+	clock.Advance(11 * timeScale)
 
 	select {
 	case status := <-ticketB.Acquired():
@@ -116,13 +315,13 @@ func TestManagerAcquireSecondTimesOutWhileAcquiring(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketA.Id())
 
 	// Assert that after another second, the lock is released.
-	time.Sleep(11 * timeScale)
+	clock.Advance(11 * timeScale)
 
 	AssertPathLocked(t, manager, "a", 0)
 }
 
 func TestManagerAcquireSecondTimesOutImmediately(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
 	go manager.Start()
 	defer manager.Stop()
 
@@ -169,8 +368,9 @@ func TestManagerAcquireSecondTimesOutImmediately(t *testing.T) {
 }
 
 func TestManagerAcquireSecondAcquiresAfterFirstTimeout(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
-	go manager.Start()
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
 	defer manager.Stop()
 
 	ticketA, err := manager.Acquire("a", 10*timeScale, 10*timeScale)
@@ -213,7 +413,7 @@ func TestManagerAcquireSecondAcquiresAfterFirstTimeout(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketA.Id())
 
 	// Assert that after a half a second, the lock is still held by ticket A.
-	time.Sleep(5 * timeScale)
+	clock.Advance(5 * timeScale)
 
 	select {
 	case <-ticketB.Acquired():
@@ -224,7 +424,7 @@ func TestManagerAcquireSecondAcquiresAfterFirstTimeout(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketA.Id())
 
 	// Assert that after another second, the lock is now held by ticket B.
-	time.Sleep(6 * timeScale)
+	clock.Advance(6 * timeScale)
 
 	select {
 	case status := <-ticketB.Acquired():
@@ -238,14 +438,15 @@ func TestManagerAcquireSecondAcquiresAfterFirstTimeout(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketB.Id())
 
 	// Assert that after another second, the lock is released.
-	time.Sleep(11 * timeScale)
+	clock.Advance(11 * timeScale)
 
 	AssertPathLocked(t, manager, "a", 0)
 }
 
 func TestManagerAcquireStaggered(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
-	go manager.Start()
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
 	defer manager.Stop()
 
 	ticketA, _ := manager.Acquire("a", 40*timeScale, 10*timeScale)
@@ -256,22 +457,61 @@ func TestManagerAcquireStaggered(t *testing.T) {
 	// Assert each step of the way.
 	AssertPathLocked(t, manager, "a", ticketA.Id())
 
-	time.Sleep(11 * timeScale)
+	clock.Advance(11 * timeScale)
 	AssertPathLocked(t, manager, "a", ticketB.Id())
 
-	time.Sleep(10 * timeScale)
+	clock.Advance(10 * timeScale)
 	AssertPathLocked(t, manager, "a", ticketC.Id())
 
-	time.Sleep(10 * timeScale)
+	clock.Advance(10 * timeScale)
 	AssertPathLocked(t, manager, "a", ticketD.Id())
 
-	time.Sleep(10 * timeScale)
+	clock.Advance(10 * timeScale)
 	AssertPathLocked(t, manager, "a", 0)
 }
 
+func TestManagerAcquireExpiresBeforePromotion(t *testing.T) {
+	// Use a maintenance interval long enough for both the lease and the first acquisition to time out before the
+	// first maintenance pass.
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: 15 * timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("a", 40*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("a", 8*timeScale, 10*timeScale)
+	ticketC, _ := manager.Acquire("a", 40*timeScale, 10*timeScale)
+
+	<-ticketA.Acquired()
+
+	// Assert that after the first maintenance pass, the timed out acquisition was not promoted.
+	clock.Advance(17 * timeScale)
+
+	select {
+	case status := <-ticketB.Acquired():
+		if status {
+			t.Fatalf("Lock was unexpectedly acquired after waiting for timeout")
+		}
+	default:
+		t.Fatalf("Lock did not report acquisition state after timeout")
+	}
+
+	select {
+	case status := <-ticketC.Acquired():
+		if !status {
+			t.Fatalf("Lock was expected to be acquired")
+		}
+	default:
+		t.Fatalf("Lock did not report acquisition state after promotion")
+	}
+
+	AssertPathLocked(t, manager, "a", ticketC.Id())
+}
+
 func TestManagerAcquireSecondCancelsAcquiring(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
-	go manager.Start()
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
 	defer manager.Stop()
 
 	ticketA, err := manager.Acquire("a", 10*timeScale, 20*timeScale)
@@ -314,7 +554,7 @@ func TestManagerAcquireSecondCancelsAcquiring(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketA.Id())
 
 	// Assert that after a second, the lock is still not acquired.
-	time.Sleep(11 * timeScale)
+	clock.Advance(11 * timeScale)
 
 	select {
 	case <-ticketB.Acquired():
@@ -338,13 +578,13 @@ func TestManagerAcquireSecondCancelsAcquiring(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketA.Id())
 
 	// Assert that after another second, the lock is released.
-	time.Sleep(11 * timeScale)
+	clock.Advance(11 * timeScale)
 
 	AssertPathLocked(t, manager, "a", 0)
 }
 
 func TestManagerAcquireCanceledImmediately(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
 	go manager.Start()
 	defer manager.Stop()
 
@@ -401,8 +641,9 @@ func TestManagerAcquireCanceledImmediately(t *testing.T) {
 }
 
 func TestManagerAcquireSecondAcquiresAfterFirstExtendedTimeout(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
-	go manager.Start()
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
 	defer manager.Stop()
 
 	ticketA, err := manager.Acquire("a", 10*timeScale, 10*timeScale)
@@ -445,7 +686,7 @@ func TestManagerAcquireSecondAcquiresAfterFirstExtendedTimeout(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketA.Id())
 
 	// Assert that after a half a second, the lock is still held by ticket A.
-	time.Sleep(5 * timeScale)
+	clock.Advance(5 * timeScale)
 
 	select {
 	case <-ticketB.Acquired():
@@ -456,7 +697,7 @@ func TestManagerAcquireSecondAcquiresAfterFirstExtendedTimeout(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketA.Id())
 
 	// Extend lock A by another period.
-	found, err := manager.Extend("a", ticketA.Id(), 10*timeScale)
+	found, _, err := manager.Extend("a", ticketA.Id(), 10*timeScale)
 	if err != nil {
 		t.Fatalf("Failed to extend lock: %v", err)
 	}
@@ -465,7 +706,7 @@ func TestManagerAcquireSecondAcquiresAfterFirstExtendedTimeout(t *testing.T) {
 	}
 
 	// Attempt to extend lock B.
-	found, err = manager.Extend("a", ticketB.Id(), 10*timeScale)
+	found, _, err = manager.Extend("a", ticketB.Id(), 10*timeScale)
 	if err != nil {
 		t.Fatalf("Failed to extend lock: %v", err)
 	}
@@ -476,7 +717,7 @@ func TestManagerAcquireSecondAcquiresAfterFirstExtendedTimeout(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketA.Id())
 
 	// Assert that after another second, the lock is still held by ticket A.
-	time.Sleep(5 * timeScale)
+	clock.Advance(5 * timeScale)
 
 	select {
 	case <-ticketB.Acquired():
@@ -487,7 +728,7 @@ func TestManagerAcquireSecondAcquiresAfterFirstExtendedTimeout(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketA.Id())
 
 	// Assert that after another second, the lock is now held by ticket B.
-	time.Sleep(6 * timeScale)
+	clock.Advance(6 * timeScale)
 
 	select {
 	case status := <-ticketB.Acquired():
@@ -501,13 +742,13 @@ func TestManagerAcquireSecondAcquiresAfterFirstExtendedTimeout(t *testing.T) {
 	AssertPathLocked(t, manager, "a", ticketB.Id())
 
 	// Assert that after another second, the lock is released.
-	time.Sleep(11 * timeScale)
+	clock.Advance(11 * timeScale)
 
 	AssertPathLocked(t, manager, "a", 0)
 }
 
 func TestManagerInspect(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
 	go manager.Start()
 	defer manager.Stop()
 
@@ -579,111 +820,3481 @@ func TestManagerInspect(t *testing.T) {
 	}
 }
 
-func TestManagerExtendNonExistent(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
+func TestManagerInspectAcquirersLimit(t *testing.T) {
+	manager, _ := NewManager(Config{})
 	go manager.Start()
 	defer manager.Stop()
 
-	found, err := manager.Extend("a", 1, time.Second)
-	if err != nil {
-		t.Fatalf("Failed to extend lock: %v", err)
+	manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	manager.Acquire("a", 10*timeScale, 10*timeScale)
+
+	for _, fixture := range []struct {
+		Limit             int
+		ExpectedAcquirers []int64
+	}{
+		{0, nil},
+		{1, []int64{ticketB.Id()}},
+		{2, []int64{ticketB.Id(), ticketC.Id()}},
+		{5, nil},
+	} {
+		state, err := manager.Inspect("a", InspectOptions{AcquirersLimit: fixture.Limit})
+		if err != nil {
+			t.Fatalf("Failed to inspect lock: %v", err)
+		}
+
+		if state.AcquirersTotal != 3 {
+			t.Errorf("Expected 3 acquirers in total with limit %d, got %d", fixture.Limit, state.AcquirersTotal)
+		}
+
+		// No expected acquirers stands for all acquirers.
+		if fixture.ExpectedAcquirers == nil {
+			if len(state.Acquirers) != 3 {
+				t.Errorf("Expected all acquirers with limit %d, got %d", fixture.Limit, len(state.Acquirers))
+			}
+			continue
+		}
+
+		if len(state.Acquirers) != len(fixture.ExpectedAcquirers) {
+			t.Fatalf("Expected %d acquirers with limit %d, got %d", len(fixture.ExpectedAcquirers), fixture.Limit, len(state.Acquirers))
+		}
+		for idx, id := range fixture.ExpectedAcquirers {
+			if state.Acquirers[idx].Id != id {
+				t.Errorf("Expected acquirer #%d to be %d, got %d", idx+1, id, state.Acquirers[idx].Id)
+			}
+		}
 	}
-	if found {
-		t.Fatalf("Lock unexpectedly found")
+}
+
+func TestManagerInspectDurations(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	clock.Advance(2 * timeScale)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	clock.Advance(timeScale)
+
+	state, _ := manager.Inspect("a")
+	if state.HeldFor != 3*timeScale || state.Holders[0].HeldFor != state.HeldFor {
+		t.Errorf("Unexpected holding duration %v", state.HeldFor)
+	}
+	if state.Acquirers[0].WaitingFor != timeScale {
+		t.Errorf("Unexpected waiting duration %v", state.Acquirers[0].WaitingFor)
+	}
+
+	// Test that the holding duration starts once the waiting acquirer is promoted.
+	manager.Release("a", ticketA.Id())
+	AssertTicketAcquired(t, ticketB, true)
+
+	state, _ = manager.Inspect("a")
+	if state.HeldFor != 0 {
+		t.Errorf("Unexpected holding duration %v after promotion", state.HeldFor)
 	}
 }
 
-func TestManagerReleaseNonExistent(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
-	go manager.Start()
+func TestManagerExtendNeverShortens(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
 	defer manager.Stop()
 
-	found, err := manager.Release("a", 1)
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+
+	// Attempt to extend the lease by less than its remaining timeout.
+	found, changed, err := manager.Extend("a", ticketA.Id(), 2*timeScale)
 	if err != nil {
-		t.Fatalf("Failed to release lock: %v", err)
+		t.Fatalf("Failed to extend lock: %v", err)
 	}
-	if found {
-		t.Fatalf("Lock unexpectedly found")
+	if !found {
+		t.Fatalf("Lock was not found when trying to extend")
+	}
+	if changed {
+		t.Fatalf("Lease was unexpectedly changed when extending by less than the remaining timeout")
+	}
+
+	// Assert that the lease was not shortened.
+	clock.Advance(5 * timeScale)
+	AssertPathLocked(t, manager, "a", ticketA.Id())
+
+	// Extend the lease by more than its remaining timeout.
+	found, changed, err = manager.Extend("a", ticketA.Id(), 10*timeScale)
+	if err != nil {
+		t.Fatalf("Failed to extend lock: %v", err)
+	}
+	if !found || !changed {
+		t.Fatalf("Expected lease to be found and changed")
 	}
 }
 
-func AssertPathLocked(t *testing.T, manager Manager, path string, expected int64) {
-	locker, err := manager.IsLocked("a")
+func TestManagerExtendConditional(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 5*timeScale)
+
+	// Extend the lease while it remains for longer than the threshold.
+	found, changed, err := manager.Extend("a", ticketA.Id(), 10*timeScale, ExtendOptions{IfLeaseTimeoutGreaterThan: 2 * timeScale})
 	if err != nil {
-		t.Fatalf("Unexpected error checking lock state for %s: %v", path, err)
+		t.Fatalf("Failed to extend lock: %v", err)
+	}
+	if !found || !changed {
+		t.Fatalf("Expected lease to be found and changed")
 	}
 
-	if locker != expected {
-		if expected != 0 {
-			t.Fatalf("Expected path %s to be locked by %d", path, expected)
-		} else {
-			t.Fatalf("Expected path %s to be locked by %d but it is locked by %d", path, expected, locker)
-		}
+	// Attempt to extend the lease once it is about to expire.
+	clock.Advance(8 * timeScale)
+
+	found, changed, err = manager.Extend("a", ticketA.Id(), 10*timeScale, ExtendOptions{IfLeaseTimeoutGreaterThan: 5 * timeScale})
+	if err != ErrPreconditionFailed {
+		t.Fatalf("Expected precondition to fail, got %v", err)
+	}
+	if !found || changed {
+		t.Fatalf("Expected lease to be found and unchanged")
+	}
+
+	// Assert that the lease was not extended.
+	clock.Advance(4 * timeScale)
+	AssertPathLocked(t, manager, "a", 0)
+
+	// Assert that leases that never expire always meet the condition.
+	ticketB, _ := manager.Acquire("b", 10*timeScale, InfiniteTimeout)
+
+	if _, _, err := manager.Extend("b", ticketB.Id(), 10*timeScale, ExtendOptions{IfLeaseTimeoutGreaterThan: time.Hour}); err != nil {
+		t.Fatalf("Failed to extend lock: %v", err)
 	}
 }
 
-func TestManagerInspectAll(t *testing.T) {
-	manager := NewManager(Config{MaintenanceInterval: timeScale})
-	go manager.Start()
+func TestManagerShorten(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
 	defer manager.Stop()
 
-	// Test inspecting with no locks held.
-	states, err := manager.InspectAll()
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("a", 20*timeScale, 10*timeScale)
+
+	// Attempt to shorten the lease to more than its remaining timeout.
+	found, changed, err := manager.Shorten("a", ticketA.Id(), 20*timeScale)
 	if err != nil {
-		t.Fatalf("Failed to inspect manager: %v", err)
+		t.Fatalf("Failed to shorten lock: %v", err)
+	}
+	if !found {
+		t.Fatalf("Lock was not found when trying to shorten")
+	}
+	if changed {
+		t.Fatalf("Lease was unexpectedly changed when shortening by more than the remaining timeout")
 	}
 
-	if len(states) != 0 {
-		t.Fatalf("Expected no states to be returned")
+	// Shorten the lease.
+	found, changed, err = manager.Shorten("a", ticketA.Id(), 2*timeScale)
+	if err != nil {
+		t.Fatalf("Failed to shorten lock: %v", err)
+	}
+	if !found || !changed {
+		t.Fatalf("Expected lease to be found and changed")
 	}
 
-	// Test inspecting with multiple locks.
-	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
-	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
-	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
-	ticketD, _ := manager.Acquire("b", 10*timeScale, 10*timeScale)
+	// Assert that the lock passes to the waiting ticket once the shortened lease expires.
+	clock.Advance(4 * timeScale)
+	AssertPathLocked(t, manager, "a", ticketB.Id())
 
-	states, err = manager.InspectAll()
+	// Assert that released tickets cannot be shortened.
+	found, _, err = manager.Shorten("a", ticketA.Id(), timeScale)
 	if err != nil {
-		t.Fatalf("Failed to inspect lock: %v", err)
+		t.Fatalf("Failed to shorten lock: %v", err)
+	}
+	if found {
+		t.Fatalf("Released lock was unexpectedly found when trying to shorten")
 	}
 
-	if len(states) != 2 {
-		t.Fatalf("Expected 2 states to be returned")
+	// Assert that waiting tickets cannot be shortened, and keep waiting.
+	ticketC, _ := manager.Acquire("a", 20*timeScale, 10*timeScale)
+
+	found, _, err = manager.Shorten("a", ticketC.Id(), timeScale)
+	if err != nil {
+		t.Fatalf("Failed to shorten lock: %v", err)
+	}
+	if found {
+		t.Fatalf("Waiting ticket was unexpectedly found when trying to shorten")
 	}
 
-	state := states["a"]
-	if state.LockingId != ticketA.Id() {
-		t.Errorf("Expected lock to be held by %d", ticketA.Id())
+	AssertTicketWaiting(t, ticketC)
+	AssertPathLockedBy(t, manager, "a", ticketB.Id())
+}
+
+func TestManagerShortenMinLeaseTimeout(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{
+		MaintenanceInterval: timeScale,
+		MinLeaseTimeout:     5 * timeScale,
+		TimeoutPolicy:       TimeoutPolicyReject,
+		Clock:               clock,
+	})
+	manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("b", 10*timeScale, 10*timeScale)
+
+	// Assert that shortening below the minimum clamps the lease rather than rejecting it.
+	found, changed, err := manager.Shorten("a", ticketA.Id(), timeScale)
+	if err != nil || !found || !changed {
+		t.Fatalf("Expected lease to be found and changed, got %v, %v, %v", found, changed, err)
 	}
-	if state.LockTimeout <= 0 {
-		t.Errorf("Expected lock timeout")
+
+	if state, _ := manager.Inspect("a"); state.LockTimeout != 5*timeScale {
+		t.Fatalf("Expected lease to be clamped to %v, got %v", 5*timeScale, state.LockTimeout)
 	}
-	if len(state.Acquirers) != 2 {
-		t.Errorf("Expected 2 acquirers")
+
+	// Assert that shortening to zero expires the lease as intended.
+	found, changed, err = manager.Shorten("b", ticketB.Id(), 0)
+	if err != nil || !found || !changed {
+		t.Fatalf("Expected lease to be found and changed, got %v, %v, %v", found, changed, err)
 	}
 
-	if state.Acquirers[0].Id != ticketB.Id() {
-		t.Errorf("Expected acquirer #1 to be %d", ticketB.Id())
+	clock.Advance(timeScale)
+	AssertPathLockedBy(t, manager, "b")
+	AssertPathLockedBy(t, manager, "a", ticketA.Id())
+
+	// Assert that the clamped lease expires at the minimum.
+	clock.Advance(4 * timeScale)
+	AssertPathLockedBy(t, manager, "a")
+}
+
+func TestManagerAcquireIfUnlocked(t *testing.T) {
+	manager, _ := NewManager(Config{})
+
+	// Assert that of many concurrent callers, exactly one acquires the lock.
+	var wg sync.WaitGroup
+	var acquiredCount atomic.Int32
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, acquired, _ := manager.AcquireIfUnlocked("a", time.Minute); acquired {
+				acquiredCount.Add(1)
+			}
+		}()
 	}
-	if state.Acquirers[0].Timeout <= 0 {
-		t.Errorf("Expected acquirer #1 to have timeout")
+	wg.Wait()
+
+	if acquiredCount.Load() != 1 {
+		t.Fatalf("Expected exactly one acquisition, got %d", acquiredCount.Load())
 	}
-	if state.Acquirers[1].Id != ticketC.Id() {
-		t.Errorf("Expected acquirer #2 to be %d", ticketC.Id())
+
+	// Assert that a shared lock is not joined, unlike by trying to acquire it.
+	ticketA, _, _ := manager.TryAcquire("b", time.Minute, AcquireOptions{Mode: ModeShared})
+
+	if _, acquired, _ := manager.AcquireIfUnlocked("b", time.Minute, AcquireOptions{Mode: ModeShared}); acquired {
+		t.Fatalf("Shared lock was unexpectedly joined")
 	}
-	if state.Acquirers[1].Timeout <= 0 {
-		t.Errorf("Expected acquirer #2 to have timeout")
+
+	// Assert that the path is acquired once unlocked.
+	manager.Release("b", ticketA.Id())
+
+	if ticket, acquired, _ := manager.AcquireIfUnlocked("b", time.Minute); !acquired || ticket == nil {
+		t.Fatalf("Expected unlocked path to be acquired")
 	}
+}
 
-	state = states["b"]
-	if state.LockingId != ticketD.Id() {
-		t.Errorf("Expected lock to be held by %d", ticketA.Id())
+func TestManagerMaxTotalHoldTime(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, MaxTotalHoldTime: 10 * timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("a", timeScale, 4*timeScale)
+
+	// Assert that the lease is extended for as long as it stays within the maximum total hold time.
+	for idx := 0; idx < 2; idx++ {
+		clock.Advance(3 * timeScale)
+
+		if found, changed, err := manager.Extend("a", ticketA.Id(), 4*timeScale); !found || !changed || err != nil {
+			t.Fatalf("Expected extension #%d to succeed, got %v, %v, %v", idx+1, found, changed, err)
+		}
 	}
-	if state.LockTimeout <= 0 {
-		t.Errorf("Expected lock timeout")
+
+	// Assert that extending the lease past the maximum total hold time fails, and the lease expires as usual.
+	clock.Advance(2 * timeScale)
+
+	if found, changed, err := manager.Extend("a", ticketA.Id(), 4*timeScale); !found || changed || err != ErrHoldTimeExceeded {
+		t.Fatalf("Expected extension to exceed the hold time, got %v, %v, %v", found, changed, err)
 	}
-	if len(state.Acquirers) != 0 {
-		t.Errorf("Expected no acquirers")
+	if found, _, err := manager.Extend("a", ticketA.Id(), InfiniteTimeout); !found || err != ErrHoldTimeExceeded {
+		t.Fatalf("Expected infinite extension to exceed the hold time, got %v, %v", found, err)
+	}
+
+	AssertPathLockedBy(t, manager, "a", ticketA.Id())
+	clock.Advance(2 * timeScale)
+	AssertPathLockedBy(t, manager, "a")
+
+	// Assert that leases of acquisitions are capped at the maximum total hold time.
+	manager.Acquire("a", timeScale, InfiniteTimeout)
+
+	if state, _ := manager.Inspect("a"); state.LockTimeout != 10*timeScale {
+		t.Fatalf("Expected lease to be capped at %v, got %v", 10*timeScale, state.LockTimeout)
+	}
+}
+
+func TestManagerContended(t *testing.T) {
+	manager, _ := NewManager(Config{})
+
+	isContended := func(ticket Ticket) bool {
+		select {
+		case <-ticket.Contended():
+			return true
+		default:
+			return false
+		}
+	}
+
+	// Assert that the holder is signaled once an acquisition queues behind it.
+	ticketA, _ := manager.Acquire("a", time.Minute, time.Minute)
+	if isContended(ticketA) {
+		t.Fatalf("Holder was unexpectedly contended")
+	}
+
+	ticketB, _ := manager.Acquire("a", time.Minute, time.Minute)
+	ticketC, _ := manager.Acquire("a", time.Minute, time.Minute)
+	if !isContended(ticketA) || isContended(ticketB) {
+		t.Fatalf("Expected only the holder to be contended")
+	}
+
+	// Assert that a ticket promoted ahead of waiting acquisitions is signaled right away.
+	manager.Release("a", ticketA.Id())
+	if !isContended(ticketB) {
+		t.Fatalf("Expected promoted ticket to be contended")
+	}
+
+	// Assert that a ticket promoted without waiting acquisitions is not signaled.
+	manager.Release("a", ticketB.Id())
+	if isContended(ticketC) {
+		t.Fatalf("Promoted ticket was unexpectedly contended")
+	}
+}
+
+func TestManagerKeepAlive(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale / 10})
+	go manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("test", 10*timeScale, 2*timeScale)
+	ticketB, _ := manager.Acquire("test", 10*timeScale, 2*timeScale)
+
+	// Assert that only holders are kept alive.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if found, _ := manager.KeepAlive(ctx, "test", ticketB.Id(), 2*timeScale, timeScale/2); found {
+		t.Fatalf("Expected waiting ticket %d not to be kept alive", ticketB.Id())
+	}
+
+	if found, _ := manager.KeepAlive(ctx, "test", ticketA.Id(), 2*timeScale, timeScale/2); !found {
+		t.Fatalf("Expected ticket %d to be kept alive", ticketA.Id())
+	}
+
+	// Assert that the lease outlives its timeout while kept alive.
+	time.Sleep(4 * timeScale)
+
+	AssertPathLockedBy(t, manager, "test", ticketA.Id())
+
+	// Assert that the lease expires once no longer kept alive.
+	cancel()
+	time.Sleep(3 * timeScale)
+
+	AssertPathLockedBy(t, manager, "test", ticketB.Id())
+}
+
+func TestManagerExtendNonExistent(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	found, _, err := manager.Extend("a", 1, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to extend lock: %v", err)
+	}
+	if found {
+		t.Fatalf("Lock unexpectedly found")
+	}
+}
+
+func TestManagerReleaseByOwner(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	crashed := AcquireOptions{Owner: "worker"}
+
+	// Hold a lock re-entrantly and another lock, and wait for a third lock held by another owner.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, crashed)
+	manager.Acquire("a", 10*timeScale, 10*timeScale, crashed)
+	ticketB, _ := manager.Acquire("b", 10*timeScale, 10*timeScale, crashed)
+	ticketC, _ := manager.Acquire("c", 10*timeScale, 10*timeScale, AcquireOptions{Owner: "other"})
+	waitingA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	waitingC, _ := manager.Acquire("c", 10*timeScale, 10*timeScale, crashed)
+
+	count, err := manager.ReleaseByOwner("worker")
+	if err != nil {
+		t.Fatalf("Failed to release locks by owner: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("Expected 3 tickets to be released, got %d", count)
+	}
+
+	// Assert that every ticket of the owner was released, and that successors were promoted.
+	AssertPathLockedBy(t, manager, "a", waitingA.Id())
+	AssertPathLockedBy(t, manager, "b")
+	AssertPathLockedBy(t, manager, "c", ticketC.Id())
+	AssertTicketAcquired(t, waitingC, false)
+
+	if found, _ := manager.Release("a", ticketA.Id()); found {
+		t.Fatalf("Expected re-entered ticket to be released")
+	}
+	if found, _ := manager.Release("b", ticketB.Id()); found {
+		t.Fatalf("Expected ticket to be released")
+	}
+
+	// Assert that an empty owner matches no tickets.
+	if count, _ := manager.ReleaseByOwner(""); count != 0 {
+		t.Fatalf("Expected no tickets to be released, got %d", count)
+	}
+}
+
+func TestManagerReleaseMulti(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	// Hold a lock, and queue two tickets behind it, the first of which is released along with the holder.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+
+	released, err := manager.ReleaseMulti("a", []int64{ticketA.Id(), ticketB.Id(), ticketC.Id() + 1000})
+	if err != nil {
+		t.Fatalf("Failed to release locks: %v", err)
+	}
+
+	expected := map[int64]bool{ticketA.Id(): true, ticketB.Id(): true, ticketC.Id() + 1000: false}
+	if fmt.Sprint(released) != fmt.Sprint(expected) {
+		t.Fatalf("Expected %v to be released, got %v", expected, released)
+	}
+
+	// Assert that the released waiting ticket was never promoted, and that the remaining ticket was.
+	AssertTicketEvents(t, ticketB, []TicketEvent{TicketAcquisitionFailed})
+	AssertTicketAcquired(t, ticketC, true)
+	AssertPathLockedBy(t, manager, "a", ticketC.Id())
+
+	// Assert that re-entrant holds are released once per occurrence.
+	owned := AcquireOptions{Owner: "worker"}
+	ticketD, _ := manager.Acquire("b", 10*timeScale, 10*timeScale, owned)
+	manager.Acquire("b", 10*timeScale, 10*timeScale, owned)
+	manager.Acquire("b", 10*timeScale, 10*timeScale, owned)
+
+	if released, _ := manager.ReleaseMulti("b", []int64{ticketD.Id(), ticketD.Id()}); !released[ticketD.Id()] {
+		t.Fatalf("Expected re-entered ticket to be found")
+	}
+
+	AssertPathLockedBy(t, manager, "b", ticketD.Id())
+
+	if released, _ := manager.ReleaseMulti("b", []int64{ticketD.Id(), ticketD.Id()}); !released[ticketD.Id()] {
+		t.Fatalf("Expected re-entered ticket to be found")
+	}
+
+	AssertPathLockedBy(t, manager, "b")
+}
+
+func TestManagerExtendMulti(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock, MaxLeaseTimeout: 100 * timeScale, TimeoutPolicy: TimeoutPolicyReject})
+	manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 2*timeScale)
+	ticketB, _ := manager.Acquire("b", 10*timeScale, 2*timeScale)
+	ticketC, _ := manager.Acquire("b", 10*timeScale, 2*timeScale)
+
+	results := manager.ExtendMulti([]LeaseExtension{
+		{Path: "a", Id: ticketA.Id(), Timeout: 5 * timeScale},
+		{Path: "b", Id: ticketB.Id(), Timeout: time.Millisecond},
+		{Path: "b", Id: ticketC.Id(), Timeout: 5 * timeScale},
+		{Path: "a/../b", Id: ticketB.Id(), Timeout: 5 * timeScale},
+		{Path: "b", Id: ticketB.Id(), Timeout: 1000 * timeScale},
+	})
+
+	expected := []LeaseExtensionResult{
+		{Found: true, Changed: true},
+		{Found: true, Changed: false},
+		{Found: false},
+		{Err: ErrPathInvalid},
+		{Err: ErrLeaseTimeoutOutOfRange},
+	}
+	if fmt.Sprint(results) != fmt.Sprint(expected) {
+		t.Fatalf("Expected results %v, got %v", expected, results)
+	}
+
+	// Assert that only the extended lease outlasts its original timeout.
+	clock.Advance(3 * timeScale)
+
+	AssertPathLockedBy(t, manager, "a", ticketA.Id())
+	AssertPathLockedBy(t, manager, "b", ticketC.Id())
+}
+
+func TestManagerReleaseDuringTimeout(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: time.Millisecond})
+	go manager.Start()
+	defer manager.Stop()
+
+	holder, _ := manager.Acquire("a", 0, InfiniteTimeout)
+	AssertTicketAcquired(t, holder, true)
+
+	// Assert that releasing a waiting ticket concurrently with its acquisition timing out never blocks the manager, and
+	// that the ticket is informed of failed acquisition exactly once.
+	for round := 0; round < 50; round++ {
+		ticket, _ := manager.Acquire("a", time.Millisecond, time.Minute)
+
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				time.Sleep(time.Millisecond)
+				manager.Release("a", ticket.Id())
+			}()
+		}
+
+		released := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(released)
+		}()
+
+		select {
+		case <-released:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Manager blocked releasing ticket %d", ticket.Id())
+		}
+
+		AssertTicketAcquired(t, ticket, false)
+		AssertTicketWaiting(t, ticket)
+	}
+
+	// Assert that re-entering a lock whose acquisition was never received does not block the manager either.
+	owned := AcquireOptions{Owner: "worker"}
+	ticket, _ := manager.Acquire("b", 0, time.Minute, owned)
+	for range 3 {
+		manager.Acquire("b", 0, time.Minute, owned)
+	}
+
+	AssertPathLockedBy(t, manager, "b", ticket.Id())
+	AssertTicketAcquired(t, ticket, true)
+}
+
+func TestManagerForceRelease(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	shared := AcquireOptions{Mode: ModeShared, Owner: "worker"}
+
+	// Hold a lock re-entrantly and shared, and queue tickets behind it.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, AcquireOptions{Mode: ModeShared})
+	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketD, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+
+	// Assert that all holders are released no matter their hold count, and that the successor is promoted.
+	releasedIds, err := manager.ForceRelease("a", false)
+	if err != nil {
+		t.Fatalf("Failed to force release: %v", err)
+	}
+	if !slices.Equal(releasedIds, []int64{ticketA.Id(), ticketB.Id()}) {
+		t.Fatalf("Expected holders to be released, got %v", releasedIds)
+	}
+
+	AssertTicketAcquired(t, ticketC, true)
+	AssertTicketWaiting(t, ticketD)
+	AssertPathLockedBy(t, manager, "a", ticketC.Id())
+
+	// Assert that clearing the queue fails the waiting tickets.
+	releasedIds, _ = manager.ForceRelease("a", true)
+	if !slices.Equal(releasedIds, []int64{ticketC.Id(), ticketD.Id()}) {
+		t.Fatalf("Expected all tickets to be released, got %v", releasedIds)
+	}
+
+	AssertTicketAcquired(t, ticketD, false)
+	AssertPathLockedBy(t, manager, "a")
+
+	// Assert that nothing is released from an unlocked path.
+	if releasedIds, err := manager.ForceRelease("a", true); len(releasedIds) != 0 || err != nil {
+		t.Fatalf("Expected nothing to be released, got %v", releasedIds)
+	}
+}
+
+func TestManagerReleaseNonExistent(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	found, err := manager.Release("a", 1)
+	if err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+	if found {
+		t.Fatalf("Lock unexpectedly found")
+	}
+}
+
+func AssertPathLocked(t *testing.T, manager Manager, path string, expected int64) {
+	lockers, err := manager.IsLocked("a")
+	if err != nil {
+		t.Fatalf("Unexpected error checking lock state for %s: %v", path, err)
+	}
+
+	var locker int64
+	if len(lockers) > 0 {
+		locker = lockers[0]
+	}
+
+	if len(lockers) > 1 || locker != expected {
+		if expected != 0 {
+			t.Fatalf("Expected path %s to be locked by %d", path, expected)
+		} else {
+			t.Fatalf("Expected path %s to be locked by %d but it is locked by %d", path, expected, locker)
+		}
+	}
+}
+
+func TestManagerInspectTimestamps(t *testing.T) {
+	clock := NewMockClock(time.Unix(1000, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+
+	ticketA, _ := manager.Acquire("a", time.Minute, time.Minute)
+	ticketB, _ := manager.Acquire("a", time.Minute, InfiniteTimeout)
+
+	// Assert that the holding start is recorded upon acquisition, and the expiry derived from the remaining lease.
+	clock.Advance(10 * time.Second)
+
+	state, _ := manager.Inspect("a")
+	if !state.HeldSince.Equal(time.Unix(1000, 0)) || !state.Holders[0].HeldSince.Equal(time.Unix(1000, 0)) {
+		t.Fatalf("Expected holding start at 1000s, got %v", state.HeldSince)
+	}
+	if !state.ExpiresAt.Equal(time.Unix(1060, 0)) || !state.Holders[0].ExpiresAt.Equal(time.Unix(1060, 0)) {
+		t.Fatalf("Expected expiry at 1060s, got %v", state.ExpiresAt)
+	}
+
+	// Assert that adjusting the wall clock leaves the holding start untouched, while the expiry follows it.
+	clock.SetWall(time.Unix(2000, 0))
+
+	state, _ = manager.Inspect("a")
+	if !state.HeldSince.Equal(time.Unix(1000, 0)) {
+		t.Fatalf("Expected holding start at 1000s, got %v", state.HeldSince)
+	}
+	if !state.ExpiresAt.Equal(time.Unix(2050, 0)) {
+		t.Fatalf("Expected expiry at 2050s, got %v", state.ExpiresAt)
+	}
+
+	// Assert that promoted holders record their holding start, and leases that never expire have no expiry.
+	manager.Release("a", ticketA.Id())
+	clock.Advance(time.Second)
+
+	state, _ = manager.Inspect("a")
+	if state.LockingId != ticketB.Id() || !state.HeldSince.Equal(time.Unix(2000, 0)) {
+		t.Fatalf("Expected holding start of %d at 2000s, got %v", ticketB.Id(), state.HeldSince)
+	}
+	if !state.ExpiresAt.IsZero() || !state.Holders[0].ExpiresAt.IsZero() {
+		t.Fatalf("Expected no expiry, got %v", state.ExpiresAt)
+	}
+}
+
+func TestManagerInspectAll(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	// Test inspecting with no locks held.
+	states, err := manager.InspectAll()
+	if err != nil {
+		t.Fatalf("Failed to inspect manager: %v", err)
+	}
+
+	if len(states) != 0 {
+		t.Fatalf("Expected no states to be returned")
+	}
+
+	// Test inspecting with multiple locks.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketD, _ := manager.Acquire("b", 10*timeScale, 10*timeScale)
+
+	states, err = manager.InspectAll()
+	if err != nil {
+		t.Fatalf("Failed to inspect lock: %v", err)
+	}
+
+	if len(states) != 2 {
+		t.Fatalf("Expected 2 states to be returned")
+	}
+
+	state := states["a"]
+	if state.LockingId != ticketA.Id() {
+		t.Errorf("Expected lock to be held by %d", ticketA.Id())
+	}
+	if state.LockTimeout <= 0 {
+		t.Errorf("Expected lock timeout")
+	}
+	if len(state.Acquirers) != 2 {
+		t.Errorf("Expected 2 acquirers")
+	}
+
+	if state.Acquirers[0].Id != ticketB.Id() {
+		t.Errorf("Expected acquirer #1 to be %d", ticketB.Id())
+	}
+	if state.Acquirers[0].Timeout <= 0 {
+		t.Errorf("Expected acquirer #1 to have timeout")
+	}
+	if state.Acquirers[1].Id != ticketC.Id() {
+		t.Errorf("Expected acquirer #2 to be %d", ticketC.Id())
+	}
+	if state.Acquirers[1].Timeout <= 0 {
+		t.Errorf("Expected acquirer #2 to have timeout")
+	}
+
+	state = states["b"]
+	if state.LockingId != ticketD.Id() {
+		t.Errorf("Expected lock to be held by %d", ticketA.Id())
+	}
+	if state.LockTimeout <= 0 {
+		t.Errorf("Expected lock timeout")
+	}
+	if len(state.Acquirers) != 0 {
+		t.Errorf("Expected no acquirers")
+	}
+}
+
+func TestManagerLenientPathNormalization(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, PathNormalization: PathNormalizationLenient})
+	go manager.Start()
+	defer manager.Stop()
+
+	ticketA, err := manager.Acquire("./a//.", 10*timeScale, 10*timeScale)
+	if err != nil {
+		t.Fatalf("Unexpected error acquiring lock: %v", err)
+	}
+
+	// Assert that the path was normalized.
+	AssertPathLocked(t, manager, "a", ticketA.Id())
+
+	// Assert that parent segments are rejected.
+	if _, err := manager.Acquire("b/../a", 10*timeScale, 10*timeScale); err != ErrPathInvalid {
+		t.Fatalf("Expected ErrPathInvalid, but got %v", err)
+	}
+}
+
+func TestManagerPathCallbacks(t *testing.T) {
+	var events []string
+	var eventsSync sync.Mutex
+
+	record := func(event string) {
+		eventsSync.Lock()
+		defer eventsSync.Unlock()
+		events = append(events, event)
+	}
+
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{
+		MaintenanceInterval: timeScale,
+		Clock:               clock,
+		OnPathCreated: func(path string) {
+			record("created " + path)
+		},
+		OnPathDeleted: func(path string) {
+			record("deleted " + path)
+		},
+	})
+	manager.Start()
+	defer manager.Stop()
+
+	// Assert that callbacks are fired on creation and explicit deletion.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	manager.Release("a", ticketA.Id())
+	manager.Release("a", ticketB.Id())
+
+	// Assert that callbacks are fired on deletion by maintenance.
+	manager.Acquire("b", 10*timeScale, 5*timeScale)
+	clock.Advance(6 * timeScale)
+
+	expectedEvents := []string{"created a", "deleted a", "created b", "deleted b"}
+
+	eventsSync.Lock()
+	defer eventsSync.Unlock()
+
+	if fmt.Sprint(events) != fmt.Sprint(expectedEvents) {
+		t.Fatalf("Expected events %v, got %v", expectedEvents, events)
+	}
+}
+
+func TestManagerLifecycleCallbacks(t *testing.T) {
+	var eventsSync sync.Mutex
+	var events []string
+
+	var manager Manager
+	callback := func(event string) func(path string, id int64) {
+		return func(path string, id int64) {
+			// Assert that the manager can be reentered.
+			manager.IsLocked(path)
+
+			eventsSync.Lock()
+			defer eventsSync.Unlock()
+
+			events = append(events, fmt.Sprintf("%s %s %d", event, path, id))
+		}
+	}
+
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ = NewManager(Config{
+		MaintenanceInterval: timeScale,
+		Clock:               clock,
+		OnAcquire:           callback("acquired"),
+		OnPromote:           callback("promoted"),
+		OnRelease:           callback("released"),
+		OnTimeout:           callback("timed out"),
+	})
+	manager.Start()
+	defer manager.Stop()
+
+	// Assert that callbacks are fired on acquisition, timeouts of acquisitions, release and promotion.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 5*timeScale)
+	ticketC, _ := manager.Acquire("a", 0, 10*timeScale)
+	ticketD, _ := manager.Acquire("a", 2*timeScale, 10*timeScale)
+	clock.Advance(3 * timeScale)
+
+	manager.Release("a", ticketA.Id())
+
+	// Assert that callbacks are fired on lease expiry.
+	clock.Advance(6 * timeScale)
+
+	expectedEvents := []string{
+		fmt.Sprintf("acquired a %d", ticketA.Id()),
+		fmt.Sprintf("timed out a %d", ticketC.Id()),
+		fmt.Sprintf("timed out a %d", ticketD.Id()),
+		fmt.Sprintf("released a %d", ticketA.Id()),
+		fmt.Sprintf("promoted a %d", ticketB.Id()),
+		fmt.Sprintf("timed out a %d", ticketB.Id()),
+	}
+
+	eventsSync.Lock()
+	defer eventsSync.Unlock()
+
+	if fmt.Sprint(events) != fmt.Sprint(expectedEvents) {
+		t.Fatalf("Expected events %v, got %v", expectedEvents, events)
+	}
+}
+
+func TestManagerPathCallbacksChurn(t *testing.T) {
+	var eventsSync sync.Mutex
+	created := make(map[string]bool)
+	errors := make(chan error, 1)
+
+	fail := func(err error) {
+		select {
+		case errors <- err:
+		default:
+		}
+	}
+
+	var manager Manager
+	manager, _ = NewManager(Config{
+		MaintenanceInterval: timeScale,
+		OnPathCreated: func(path string) {
+			eventsSync.Lock()
+			defer eventsSync.Unlock()
+
+			if created[path] {
+				fail(fmt.Errorf("Path %s created twice", path))
+			}
+			created[path] = true
+
+			// Assert that the manager can be reentered.
+			manager.IsLocked(path)
+		},
+		OnPathDeleted: func(path string) {
+			eventsSync.Lock()
+			defer eventsSync.Unlock()
+
+			if !created[path] {
+				fail(fmt.Errorf("Path %s deleted before creation", path))
+			}
+			created[path] = false
+		},
+	})
+	go manager.Start()
+	defer manager.Stop()
+
+	// Churn a small set of paths from a number of goroutines.
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+
+		go func(worker int) {
+			defer wg.Done()
+
+			for idx := 0; idx < 200; idx++ {
+				path := fmt.Sprintf("%d", (worker+idx)%3)
+				lockTimeout := time.Duration(idx%2) * timeScale
+
+				ticket, err := manager.Acquire(path, lockTimeout, 10*timeScale)
+				if err != nil {
+					fail(err)
+					return
+				}
+
+				manager.Release(path, ticket.Id())
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errors:
+		t.Fatal(err)
+	default:
+	}
+
+	// Assert that all paths have been deleted.
+	eventsSync.Lock()
+	defer eventsSync.Unlock()
+
+	if len(created) != 3 {
+		t.Fatalf("Expected 3 paths to have been created, got %d", len(created))
+	}
+
+	for path, exists := range created {
+		if exists {
+			t.Errorf("Expected path %s to have been deleted", path)
+		}
+	}
+}
+
+func TestManagerTicketEvents(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("a", 40*timeScale, 3*timeScale)
+	ticketC, _ := manager.Acquire("a", 0, 10*timeScale)
+
+	manager.Extend("a", ticketA.Id(), 20*timeScale)
+	manager.Release("a", ticketA.Id())
+
+	AssertTicketEvents(t, ticketA, []TicketEvent{TicketAcquired, TicketLeaseChanged, TicketReleased})
+	AssertTicketEvents(t, ticketC, []TicketEvent{TicketAcquisitionFailed})
+
+	// Assert that the promoted ticket's lease expires.
+	clock.Advance(5 * timeScale)
+
+	AssertTicketEvents(t, ticketB, []TicketEvent{TicketAcquired, TicketLeaseExpired})
+
+	// Assert that the acquisition state is derived from the events.
+	for _, fix := range []struct {
+		Ticket   Ticket
+		Acquired bool
+	}{
+		{ticketA, true},
+		{ticketB, true},
+		{ticketC, false},
+	} {
+		select {
+		case status := <-fix.Ticket.Acquired():
+			if status != fix.Acquired {
+				t.Errorf("Expected ticket %d acquisition state to be %v", fix.Ticket.Id(), fix.Acquired)
+			}
+		default:
+			t.Errorf("Ticket %d did not report acquisition state", fix.Ticket.Id())
+		}
+	}
+}
+
+func TestManagerTicketEventsDelivered(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+
+	// Assert that no event is lost while the consumer keeps up, no matter how many events are emitted.
+	if event := <-ticketA.Events(); event != TicketAcquired {
+		t.Fatalf("Expected acquired event, got %v", event)
+	}
+
+	for idx := 1; idx <= 3*ticketEventBufferSize; idx++ {
+		manager.Extend("a", ticketA.Id(), time.Duration(10+idx)*timeScale)
+
+		select {
+		case event := <-ticketA.Events():
+			if event != TicketLeaseChanged {
+				t.Fatalf("Expected lease changed event, got %v", event)
+			}
+		default:
+			t.Fatalf("Lease changed event %d was not delivered", idx)
+		}
+	}
+
+	// Assert that no event is lost while no more events are pending than are buffered.
+	for idx := 1; idx < ticketEventBufferSize; idx++ {
+		manager.Extend("a", ticketA.Id(), time.Duration(40+idx)*timeScale)
+	}
+	manager.Release("a", ticketA.Id())
+
+	expectedEvents := []TicketEvent{TicketReleased}
+	for len(expectedEvents) < ticketEventBufferSize {
+		expectedEvents = append([]TicketEvent{TicketLeaseChanged}, expectedEvents...)
+	}
+
+	AssertTicketEvents(t, ticketA, expectedEvents)
+}
+
+func TestManagerTicketEventsCoalesced(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+
+	// Emit more events than can be buffered.
+	for idx := 1; idx <= 12; idx++ {
+		manager.Extend("a", ticketA.Id(), time.Duration(10+idx)*timeScale)
+	}
+	manager.Release("a", ticketA.Id())
+
+	// Assert that the oldest events were discarded.
+	expectedEvents := []TicketEvent{TicketReleased}
+	for len(expectedEvents) < ticketEventBufferSize {
+		expectedEvents = append([]TicketEvent{TicketLeaseChanged}, expectedEvents...)
+	}
+
+	AssertTicketEvents(t, ticketA, expectedEvents)
+
+	// Assert that the acquisition state was retained.
+	select {
+	case status := <-ticketA.Acquired():
+		if !status {
+			t.Fatalf("Lock was not acquired")
+		}
+	default:
+		t.Fatalf("No lock indication was emitted from the ticket")
+	}
+}
+
+func AssertTicketEvents(t *testing.T, ticket Ticket, expected []TicketEvent) {
+	var events []TicketEvent
+
+	for {
+		select {
+		case event, ok := <-ticket.Events():
+			if ok {
+				events = append(events, event)
+				continue
+			}
+
+		case <-time.After(timeScale):
+			t.Fatalf("Events for ticket %d were not closed, got %v", ticket.Id(), events)
+		}
+
+		break
+	}
+
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Fatalf("Expected events %v for ticket %d, got %v", expected, ticket.Id(), events)
+	}
+}
+
+func TestManagerAcquireShared(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	// Assert that shared tickets hold the lock concurrently.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+
+	AssertTicketAcquired(t, ticketA, true)
+	AssertTicketAcquired(t, ticketB, true)
+	AssertPathLockedBy(t, manager, "a", ticketA.Id(), ticketB.Id())
+
+	// Assert that an exclusive ticket waits for the shared holders, and that subsequent shared tickets queue behind it.
+	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketD, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+
+	AssertTicketWaiting(t, ticketC)
+	AssertTicketWaiting(t, ticketD)
+
+	state, _ := manager.Inspect("a")
+	if state.Mode != ModeShared || len(state.Holders) != 2 || len(state.Acquirers) != 2 {
+		t.Fatalf("Expected lock to be held by 2 shared holders with 2 acquirers")
+	}
+	if state.Acquirers[0].Mode != ModeExclusive || state.Acquirers[1].Mode != ModeShared {
+		t.Fatalf("Unexpected acquirer modes")
+	}
+
+	// Assert that the exclusive ticket is only promoted once all shared holders are released.
+	manager.Release("a", ticketA.Id())
+
+	AssertTicketWaiting(t, ticketC)
+	AssertPathLockedBy(t, manager, "a", ticketB.Id())
+
+	manager.Release("a", ticketB.Id())
+
+	AssertTicketAcquired(t, ticketC, true)
+	AssertTicketWaiting(t, ticketD)
+	AssertPathLockedBy(t, manager, "a", ticketC.Id())
+
+	// Assert that the shared ticket is promoted once the exclusive ticket is released.
+	manager.Release("a", ticketC.Id())
+
+	AssertTicketAcquired(t, ticketD, true)
+	AssertPathLockedBy(t, manager, "a", ticketD.Id())
+}
+
+func TestManagerAcquireSemaphore(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	permit := AcquireOptions{Capacity: 2}
+
+	// Assert that permits are held concurrently up to the capacity.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, permit)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, permit)
+
+	AssertTicketAcquired(t, ticketA, true)
+	AssertTicketAcquired(t, ticketB, true)
+	AssertPathLockedBy(t, manager, "a", ticketA.Id(), ticketB.Id())
+
+	state, _ := manager.Inspect("a")
+	if state.Mode != ModeShared || state.Capacity != 2 || state.Permits != 0 {
+		t.Fatalf("Expected exhausted shared semaphore of 2 permits, got %+v", state)
+	}
+
+	// Assert that acquisitions wait once the permits are exhausted, including shared ones not specifying a capacity.
+	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, permit)
+	ticketD, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, AcquireOptions{Mode: ModeShared})
+	ticketE, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, permit)
+
+	AssertTicketWaiting(t, ticketC)
+	AssertTicketWaiting(t, ticketD)
+	AssertTicketWaiting(t, ticketE)
+
+	if _, acquired, _ := manager.TryAcquire("a", 10*timeScale, permit); acquired {
+		t.Fatalf("Expected acquisition without waiting to fail")
+	}
+
+	// Assert that acquisitions specifying another capacity are refused.
+	if _, err := manager.Acquire("a", 10*timeScale, 10*timeScale, AcquireOptions{Capacity: 3}); err != ErrCapacityMismatch {
+		t.Fatalf("Expected capacity mismatch, got %v", err)
+	}
+
+	// Assert that releases promote as many waiting tickets as permits become available.
+	manager.Release("a", ticketA.Id())
+
+	AssertTicketAcquired(t, ticketC, true)
+	AssertTicketWaiting(t, ticketD)
+	AssertPathLockedBy(t, manager, "a", ticketB.Id(), ticketC.Id())
+
+	manager.Release("a", ticketB.Id())
+	manager.Release("a", ticketC.Id())
+
+	AssertTicketAcquired(t, ticketD, true)
+	AssertTicketAcquired(t, ticketE, true)
+	AssertPathLockedBy(t, manager, "a", ticketD.Id(), ticketE.Id())
+
+	// Assert that the capacity is retained while the lock is held, and forgotten once it is free of tickets.
+	manager.Release("a", ticketD.Id())
+
+	state, _ = manager.Inspect("a")
+	if state.Capacity != 2 || state.Permits != 1 {
+		t.Fatalf("Expected semaphore with a remaining permit, got %+v", state)
+	}
+
+	manager.Release("a", ticketE.Id())
+
+	ticketF, err := manager.Acquire("a", 10*timeScale, 10*timeScale, AcquireOptions{Capacity: 3})
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	AssertTicketAcquired(t, ticketF, true)
+
+	// Assert that exclusive acquisitions wait for all permits to be released.
+	ticketG, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	AssertTicketWaiting(t, ticketG)
+
+	manager.Release("a", ticketF.Id())
+
+	AssertTicketAcquired(t, ticketG, true)
+
+	state, _ = manager.Inspect("a")
+	if state.Mode != ModeExclusive || state.Capacity != 3 || state.Permits != 0 {
+		t.Fatalf("Expected exclusively held semaphore without permits, got %+v", state)
+	}
+}
+
+func TestManagerAcquireSemaphoreNamespace(t *testing.T) {
+	manager, _ := NewManager(Config{
+		MaintenanceInterval: timeScale,
+		Namespaces:          map[string]NamespaceConfig{"pool": {Capacity: 1}},
+	})
+	go manager.Start()
+	defer manager.Stop()
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	// Assert that shared acquisitions of the namespace are limited to its capacity.
+	ticketA, _ := manager.Acquire("pool/a", 10*timeScale, 10*timeScale, shared)
+	ticketB, _ := manager.Acquire("pool/a", 10*timeScale, 10*timeScale, shared)
+
+	AssertTicketAcquired(t, ticketA, true)
+	AssertTicketWaiting(t, ticketB)
+
+	manager.Release("pool/a", ticketA.Id())
+	AssertTicketAcquired(t, ticketB, true)
+
+	// Assert that acquisitions specifying a capacity override that of the namespace.
+	ticketC, _ := manager.Acquire("pool/b", 10*timeScale, 10*timeScale, AcquireOptions{Capacity: 2})
+	ticketD, _ := manager.Acquire("pool/b", 10*timeScale, 10*timeScale, shared)
+
+	AssertTicketAcquired(t, ticketC, true)
+	AssertTicketAcquired(t, ticketD, true)
+
+	// Assert that locks outside of the namespace are not limited.
+	ticketE, _ := manager.Acquire("c", 10*timeScale, 10*timeScale, shared)
+	ticketF, _ := manager.Acquire("c", 10*timeScale, 10*timeScale, shared)
+
+	AssertTicketAcquired(t, ticketE, true)
+	AssertTicketAcquired(t, ticketF, true)
+}
+
+func TestManagerAcquireSharedPromotesConsecutive(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	ticketD, _ := manager.Acquire("a", 40*timeScale, 10*timeScale)
+	ticketE, _ := manager.Acquire("a", 40*timeScale, 10*timeScale, shared)
+
+	AssertTicketAcquired(t, ticketA, true)
+	AssertPathLockedBy(t, manager, "a", ticketA.Id())
+
+	// Assert that all consecutive shared tickets are promoted together.
+	manager.Release("a", ticketA.Id())
+
+	AssertTicketAcquired(t, ticketB, true)
+	AssertTicketAcquired(t, ticketC, true)
+	AssertTicketWaiting(t, ticketD)
+	AssertTicketWaiting(t, ticketE)
+	AssertPathLockedBy(t, manager, "a", ticketB.Id(), ticketC.Id())
+
+	// Assert that shared leases expire individually.
+	manager.Extend("a", ticketC.Id(), 20*timeScale)
+	clock.Advance(12 * timeScale)
+
+	AssertTicketWaiting(t, ticketD)
+	AssertPathLockedBy(t, manager, "a", ticketC.Id())
+
+	manager.Release("a", ticketC.Id())
+
+	AssertTicketAcquired(t, ticketD, true)
+	AssertTicketWaiting(t, ticketE)
+	AssertPathLockedBy(t, manager, "a", ticketD.Id())
+}
+
+func TestManagerDowngrade(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	ticketD, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketE, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+
+	AssertTicketAcquired(t, ticketA, true)
+
+	// Assert that only holders can be downgraded.
+	if found, err := manager.Downgrade("a", ticketB.Id()); found || err != nil {
+		t.Fatalf("Expected waiting ticket not to be downgraded")
+	}
+	if found, err := manager.Downgrade("b", ticketA.Id()); found || err != nil {
+		t.Fatalf("Expected ticket not to be downgraded on another path")
+	}
+
+	// Assert that downgrading admits the shared tickets at the head of the queue, but not those behind an exclusive
+	// ticket.
+	if found, err := manager.Downgrade("a", ticketA.Id()); !found || err != nil {
+		t.Fatalf("Expected ticket to be downgraded")
+	}
+
+	AssertTicketAcquired(t, ticketB, true)
+	AssertTicketAcquired(t, ticketC, true)
+	AssertTicketWaiting(t, ticketD)
+	AssertTicketWaiting(t, ticketE)
+	AssertPathLockedBy(t, manager, "a", ticketA.Id(), ticketB.Id(), ticketC.Id())
+
+	state, _ := manager.Inspect("a")
+	if state.Mode != ModeShared || state.LockingId != ticketA.Id() {
+		t.Fatalf("Expected lock to be held in shared mode by %d", ticketA.Id())
+	}
+
+	// Assert that downgrading a shared hold has no effect.
+	if found, err := manager.Downgrade("a", ticketA.Id()); !found || err != nil {
+		t.Fatalf("Expected shared ticket to be found")
+	}
+
+	AssertTicketWaiting(t, ticketD)
+
+	// Assert that the exclusive ticket is promoted once all shared holders are released.
+	manager.Release("a", ticketA.Id())
+	manager.Release("a", ticketB.Id())
+
+	AssertTicketWaiting(t, ticketD)
+
+	manager.Release("a", ticketC.Id())
+
+	AssertTicketAcquired(t, ticketD, true)
+	AssertTicketWaiting(t, ticketE)
+	AssertPathLockedBy(t, manager, "a", ticketD.Id())
+}
+
+func TestManagerDowngradeConcurrent(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	// Assert that downgrading while shared and exclusive acquisitions race never grants an exclusive ticket alongside
+	// other holders.
+	for round := 0; round < 20; round++ {
+		holder, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+		AssertTicketAcquired(t, holder, true)
+
+		var wg sync.WaitGroup
+		tickets := make([]Ticket, 8)
+
+		for idx := range tickets {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				if idx%4 == 3 {
+					tickets[idx], _ = manager.Acquire("a", 10*timeScale, 10*timeScale)
+				} else {
+					tickets[idx], _ = manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+				}
+			}()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			manager.Downgrade("a", holder.Id())
+		}()
+
+		wg.Wait()
+
+		state, _ := manager.Inspect("a")
+		if state.Mode != ModeShared {
+			t.Fatalf("Expected lock to be held in shared mode")
+		}
+		for idx := 3; idx < len(tickets); idx += 4 {
+			AssertTicketWaiting(t, tickets[idx])
+		}
+		if len(state.Acquirers) > 0 && state.Acquirers[0].Mode != ModeExclusive {
+			t.Fatalf("Expected an exclusive acquirer at the head of the queue, got %v", state.Acquirers)
+		}
+
+		for _, ticket := range append(tickets, holder) {
+			manager.Release("a", ticket.Id())
+		}
+	}
+}
+
+func TestManagerUpgrade(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	// Assert that the only holder is upgraded immediately, and issued a new fencing token.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	AssertTicketAcquired(t, ticketA, true)
+
+	fence := ticketA.Fence()
+
+	if ticket, err := manager.Upgrade("a", ticketA.Id(), 0); ticket != ticketA || err != nil {
+		t.Fatalf("Expected ticket to be upgraded, got %v", err)
+	}
+	if ticketA.Fence() <= fence {
+		t.Fatalf("Expected fencing token to increase beyond %d, got %d", fence, ticketA.Fence())
+	}
+
+	state, _ := manager.Inspect("a")
+	if state.Mode != ModeExclusive || state.Fence != ticketA.Fence() {
+		t.Fatalf("Expected lock to be held exclusively with fencing token %d", ticketA.Fence())
+	}
+
+	// Assert that upgrading an exclusive hold has no effect.
+	if ticket, err := manager.Upgrade("a", ticketA.Id(), 0); ticket != ticketA || err != nil {
+		t.Fatalf("Expected exclusive ticket to be found")
+	}
+
+	// Assert that only holders can be upgraded.
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+
+	if ticket, err := manager.Upgrade("a", ticketB.Id(), timeScale); ticket != nil || err != nil {
+		t.Fatalf("Expected waiting ticket not to be upgraded")
+	}
+
+	manager.Release("a", ticketA.Id())
+	manager.Release("a", ticketB.Id())
+}
+
+func TestManagerUpgradeWaits(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+
+	AssertPathLockedBy(t, manager, "a", ticketA.Id(), ticketB.Id())
+
+	// Assert that an immediate upgrade fails while other holders remain.
+	if _, err := manager.Upgrade("a", ticketA.Id(), 0); err != ErrUpgradeTimeout {
+		t.Fatalf("Expected upgrade to time out, got %v", err)
+	}
+
+	// Assert that the upgrade waits for the other holders, ahead of the waiting exclusive ticket.
+	upgraded := make(chan error, 1)
+	go func() {
+		ticket, err := manager.Upgrade("a", ticketA.Id(), 10*timeScale)
+		if err == nil && ticket != ticketA {
+			err = fmt.Errorf("unexpected ticket %v", ticket)
+		}
+		upgraded <- err
+	}()
+
+	time.Sleep(timeScale)
+
+	// Assert that shared acquisitions are held back while the upgrade is pending.
+	ticketD, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	AssertTicketWaiting(t, ticketD)
+
+	// Assert that the second holder attempting to upgrade fails with a conflict rather than deadlocking.
+	if _, err := manager.Upgrade("a", ticketB.Id(), 10*timeScale); err != ErrUpgradeConflict {
+		t.Fatalf("Expected upgrade conflict, got %v", err)
+	}
+
+	manager.Release("a", ticketB.Id())
+
+	if err := <-upgraded; err != nil {
+		t.Fatalf("Expected ticket to be upgraded, got %v", err)
+	}
+
+	AssertTicketWaiting(t, ticketC)
+	AssertTicketWaiting(t, ticketD)
+	AssertPathLockedBy(t, manager, "a", ticketA.Id())
+
+	state, _ := manager.Inspect("a")
+	if state.Mode != ModeExclusive {
+		t.Fatalf("Expected lock to be held exclusively")
+	}
+
+	manager.Release("a", ticketA.Id())
+
+	AssertTicketAcquired(t, ticketC, true)
+	AssertTicketWaiting(t, ticketD)
+}
+
+func TestManagerUpgradeTimeout(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+
+	// Assert that shared acquisitions held back by an upgrade are admitted once it times out.
+	acquired := make(chan Ticket, 1)
+	go func() {
+		time.Sleep(timeScale)
+		ticket, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+		acquired <- ticket
+	}()
+
+	if ticket, err := manager.Upgrade("a", ticketA.Id(), 2*timeScale); ticket != nil || err != ErrUpgradeTimeout {
+		t.Fatalf("Expected upgrade to time out, got %v", err)
+	}
+
+	ticketC := <-acquired
+	AssertTicketAcquired(t, ticketC, true)
+	AssertPathLockedBy(t, manager, "a", ticketA.Id(), ticketB.Id(), ticketC.Id())
+
+	// Assert that the upgrade fails once the ticket stops holding the lock.
+	go func() {
+		time.Sleep(timeScale)
+		manager.Release("a", ticketA.Id())
+	}()
+
+	if ticket, err := manager.Upgrade("a", ticketA.Id(), 10*timeScale); ticket != nil || err != nil {
+		t.Fatalf("Expected released ticket not to be upgraded, got %v", err)
+	}
+
+	// Assert that another holder may upgrade once the pending upgrade fails.
+	manager.Release("a", ticketC.Id())
+
+	if ticket, err := manager.Upgrade("a", ticketB.Id(), 0); ticket != ticketB || err != nil {
+		t.Fatalf("Expected ticket to be upgraded, got %v", err)
+	}
+}
+
+func TestManagerAcquireContext(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	// Assert that canceling a waiting acquisition removes it from the queue immediately.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ticketB, _ := manager.AcquireContext(ctx, "a", 10*timeScale, 10*timeScale)
+	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+
+	AssertTicketWaiting(t, ticketB)
+	AssertTicketWaiting(t, ticketC)
+
+	cancel()
+
+	select {
+	case acquired := <-ticketB.Acquired():
+		if acquired {
+			t.Fatalf("Expected canceled acquisition to fail")
+		}
+	case <-time.After(timeScale):
+		t.Fatalf("Canceled acquisition was not settled")
+	}
+
+	// Assert that shared waiters behind the canceled acquisition are promoted.
+	AssertTicketAcquired(t, ticketC, true)
+	AssertPathLockedBy(t, manager, "a", ticketA.Id(), ticketC.Id())
+
+	// Assert that canceling an acquired lock has no effect.
+	ctx, cancel = context.WithCancel(context.Background())
+	ticketD, _ := manager.AcquireContext(ctx, "b", 10*timeScale, 10*timeScale)
+	cancel()
+	time.Sleep(timeScale / 10)
+
+	AssertTicketAcquired(t, ticketD, true)
+	AssertPathLockedBy(t, manager, "b", ticketD.Id())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	ticketE, _ := manager.AcquireContext(ctx, "b", 10*timeScale, 10*timeScale)
+	manager.Release("b", ticketD.Id())
+	AssertTicketAcquired(t, ticketE, true)
+
+	cancel()
+	time.Sleep(timeScale / 10)
+
+	AssertPathLockedBy(t, manager, "b", ticketE.Id())
+}
+
+func TestManagerAcquireWithCancel(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	// Assert that canceling a waiting acquisition removes it from the queue immediately.
+	ticketA, _, _ := manager.AcquireWithCancel("a", 10*timeScale, 10*timeScale, shared)
+	ticketB, cancelB, _ := manager.AcquireWithCancel("a", 10*timeScale, 10*timeScale)
+	ticketC, _, _ := manager.AcquireWithCancel("a", 10*timeScale, 10*timeScale, shared)
+
+	AssertTicketWaiting(t, ticketB)
+	AssertTicketWaiting(t, ticketC)
+
+	cancelB()
+	AssertTicketAcquired(t, ticketB, false)
+
+	// Assert that shared waiters behind the canceled acquisition are promoted.
+	AssertTicketAcquired(t, ticketC, true)
+	AssertPathLockedBy(t, manager, "a", ticketA.Id(), ticketC.Id())
+
+	// Assert that canceling again has no effect.
+	cancelB()
+	AssertPathLockedBy(t, manager, "a", ticketA.Id(), ticketC.Id())
+
+	// Assert that canceling an acquired lock has no effect.
+	ticketD, cancelD, _ := manager.AcquireWithCancel("b", 10*timeScale, 10*timeScale)
+	AssertTicketAcquired(t, ticketD, true)
+
+	cancelD()
+	AssertPathLockedBy(t, manager, "b", ticketD.Id())
+
+	// Assert that canceling a timed out acquisition has no effect.
+	ticketE, cancelE, _ := manager.AcquireWithCancel("b", timeScale/10, 10*timeScale)
+	ticketF, _, _ := manager.AcquireWithCancel("b", 10*timeScale, 10*timeScale)
+	time.Sleep(2 * timeScale)
+	AssertTicketAcquired(t, ticketE, false)
+
+	cancelE()
+	AssertTicketWaiting(t, ticketF)
+	AssertPathLockedBy(t, manager, "b", ticketD.Id())
+
+	// Assert that invalid paths fail without a cancel function.
+	_, cancel, err := manager.AcquireWithCancel("", 10*timeScale, 10*timeScale)
+	if err == nil || cancel != nil {
+		t.Fatalf("Expected acquisition of invalid path to fail, got err %v", err)
+	}
+}
+
+func TestManagerAcquireContextTraced(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale / 10})
+	go manager.Start()
+	defer manager.Stop()
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	ticketA, _ := manager.Acquire("test", 10*timeScale, 10*timeScale)
+
+	// Assert that the progress of a traced acquisition is recorded.
+	ctx, span := tracer.Start(context.Background(), "acquire")
+
+	ticketB, _ := manager.AcquireContext(ctx, "test", 10*timeScale, 10*timeScale)
+	manager.Release("test", ticketA.Id())
+	<-ticketB.Acquired()
+
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected single span, got %d", len(spans))
+	}
+
+	var events []string
+	for _, event := range spans[0].Events() {
+		events = append(events, event.Name)
+	}
+
+	if fmt.Sprint(events) != "[queued promoted]" {
+		t.Fatalf("Expected queued and promoted events, got %v", events)
+	}
+
+	attributes := fmt.Sprint(spans[0].Attributes())
+	if !strings.Contains(attributes, "lockerd.path test") || !strings.Contains(attributes, fmt.Sprintf("lockerd.ticket_id %d", ticketB.Id())) {
+		t.Fatalf("Expected path and ticket ID attributes, got %s", attributes)
+	}
+}
+
+func TestManagerHandoffTraced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	manager, _ := NewManager(Config{
+		MaintenanceInterval: timeScale / 10,
+		TracerProvider:      sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	})
+	go manager.Start()
+	defer manager.Stop()
+
+	// Assert that uncontended locks are not traced.
+	ticketA, _ := manager.Acquire("test", 10*timeScale, 10*timeScale)
+	manager.Release("test", ticketA.Id())
+
+	if spans := recorder.Started(); len(spans) != 0 {
+		t.Fatalf("Expected no spans, got %d", len(spans))
+	}
+
+	// Assert that every promotion of the handoff chain is recorded as a child span of the span of the path.
+	ticketA, _ = manager.Acquire("test", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("test", 10*timeScale, 10*timeScale)
+	ticketC, _ := manager.Acquire("test", 10*timeScale, 10*timeScale)
+
+	manager.Release("test", ticketA.Id())
+	AssertTicketAcquired(t, ticketB, true)
+
+	manager.Release("test", ticketB.Id())
+	AssertTicketAcquired(t, ticketC, true)
+
+	if spans := recorder.Ended(); len(spans) != 2 {
+		t.Fatalf("Expected 2 ended spans, got %d", len(spans))
+	}
+
+	manager.Release("test", ticketC.Id())
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 ended spans, got %d", len(spans))
+	}
+
+	pathSpan := spans[2]
+	if pathSpan.Name() != "lockerd.path" || fmt.Sprint(pathSpan.Attributes()) != "[{lockerd.path test}]" {
+		t.Fatalf("Expected span of path, got %s with %v", pathSpan.Name(), pathSpan.Attributes())
+	}
+
+	for idx, ticket := range []Ticket{ticketB, ticketC} {
+		span := spans[idx]
+		if span.Name() != "lockerd.handoff" || span.Parent().SpanID() != pathSpan.SpanContext().SpanID() {
+			t.Fatalf("Expected handoff span as child of span of path, got %s", span.Name())
+		}
+
+		attributes := fmt.Sprint(span.Attributes())
+		if !strings.Contains(attributes, fmt.Sprintf("lockerd.ticket_id %d", ticket.Id())) {
+			t.Fatalf("Expected ticket ID attribute, got %s", attributes)
+		}
+	}
+}
+
+func TestManagerAcquireMulti(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	// Assert that all locks are acquired, with tickets in the order of the paths.
+	tickets, err := manager.AcquireMulti([]string{"c", "a", "b", "a"}, 10*timeScale, 10*timeScale)
+	if err != nil {
+		t.Fatalf("Failed to acquire locks: %v", err)
+	}
+
+	if len(tickets) != 4 || tickets[1] != tickets[3] {
+		t.Fatalf("Expected 4 tickets with duplicate paths sharing a ticket")
+	}
+	for idx, path := range []string{"c", "a", "b"} {
+		AssertPathLockedBy(t, manager, path, tickets[idx].Id())
+	}
+
+	// Assert that acquired locks are rolled back if a lock cannot be acquired.
+	manager.Release("c", tickets[0].Id())
+
+	if _, err := manager.AcquireMulti([]string{"d", "b", "c"}, 2*timeScale, 10*timeScale); err == nil {
+		t.Fatalf("Expected acquisition to fail")
+	} else if multiErr, ok := err.(*AcquireMultiError); !ok || multiErr.Path != "b" {
+		t.Fatalf("Expected acquisition of b to fail, got %v", err)
+	}
+
+	AssertPathLockedBy(t, manager, "c")
+	AssertPathLockedBy(t, manager, "d")
+	AssertPathLockedBy(t, manager, "b", tickets[2].Id())
+
+	// Assert that invalid paths are rejected before acquiring any locks.
+	if _, err := manager.AcquireMulti([]string{"e", "f/"}, 0, 10*timeScale); err != ErrPathInvalid {
+		t.Fatalf("Expected invalid path error")
+	}
+
+	AssertPathLockedBy(t, manager, "e")
+}
+
+func TestManagerAcquireMultiConcurrent(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	// Assert that concurrent acquisitions of overlapping paths in opposite orders do not deadlock.
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+
+	for idx := 0; idx < 20; idx++ {
+		paths := []string{"a", "b", "c"}
+		if idx%2 == 1 {
+			paths = []string{"c", "b", "a"}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			tickets, err := manager.AcquireMulti(paths, 20*timeScale, 10*timeScale)
+			if err == nil {
+				for idx, ticket := range tickets {
+					manager.Release(paths[idx], ticket.Id())
+				}
+			}
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Expected all acquisitions to succeed, got %v", err)
+		}
+	}
+}
+
+func TestManagerTryAcquire(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	// Assert that an unlocked path is acquired immediately.
+	ticketA, acquired, err := manager.TryAcquire("a", 10*timeScale, shared)
+	if err != nil || !acquired {
+		t.Fatalf("Expected lock to be acquired")
+	}
+
+	AssertTicketAcquired(t, ticketA, true)
+
+	// Assert that a compatible holder is admitted.
+	ticketB, acquired, _ := manager.TryAcquire("a", 10*timeScale, shared)
+	if !acquired {
+		t.Fatalf("Expected shared lock to be acquired")
+	}
+
+	// Assert that contention neither queues nor allocates a ticket.
+	ticketC, acquired, err := manager.TryAcquire("a", 10*timeScale)
+	if err != nil || acquired || ticketC != nil {
+		t.Fatalf("Expected exclusive lock not to be acquired")
+	}
+
+	state, _ := manager.Inspect("a")
+	if len(state.Acquirers) != 0 {
+		t.Fatalf("Expected no acquirers, got %d", len(state.Acquirers))
+	}
+
+	AssertPathLockedBy(t, manager, "a", ticketA.Id(), ticketB.Id())
+
+	ticketD, _ := manager.Acquire("b", 0, 10*timeScale)
+	if ticketD.Id() != ticketB.Id()+1 {
+		t.Fatalf("Expected ticket ID %d, got %d", ticketB.Id()+1, ticketD.Id())
+	}
+
+	// Assert that the lock is acquired once released.
+	manager.Release("a", ticketA.Id())
+	manager.Release("a", ticketB.Id())
+
+	ticketE, acquired, _ := manager.TryAcquire("a", 10*timeScale)
+	if !acquired {
+		t.Fatalf("Expected lock to be acquired")
+	}
+
+	AssertPathLockedBy(t, manager, "a", ticketE.Id())
+
+	// Assert that invalid paths are rejected.
+	if _, _, err := manager.TryAcquire("a/", 10*timeScale); err != ErrPathInvalid {
+		t.Fatalf("Expected invalid path error")
+	}
+}
+
+func TestManagerFencingTokens(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	// Assert that waiting tickets have no fencing token until acquired.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+
+	if ticketA.Fence() == 0 {
+		t.Fatalf("Expected acquired ticket to have a fencing token")
+	}
+	if ticketB.Fence() != 0 {
+		t.Fatalf("Expected waiting ticket not to have a fencing token")
+	}
+
+	state, _ := manager.Inspect("a")
+	if state.Fence != ticketA.Fence() || state.Holders[0].Fence != ticketA.Fence() {
+		t.Fatalf("Expected lock fencing token to be %d", ticketA.Fence())
+	}
+
+	// Assert that the token increases when the lock changes hands by promotion.
+	manager.Release("a", ticketA.Id())
+
+	AssertTicketAcquired(t, ticketB, true)
+
+	if ticketB.Fence() <= ticketA.Fence() {
+		t.Fatalf("Expected fencing token %d to exceed %d", ticketB.Fence(), ticketA.Fence())
+	}
+
+	state, _ = manager.Inspect("a")
+	if state.Fence != ticketB.Fence() {
+		t.Fatalf("Expected lock fencing token to be %d", ticketB.Fence())
+	}
+
+	// Assert that the token increases even if the lock is deleted in the meantime.
+	manager.Release("a", ticketB.Id())
+
+	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	if ticketC.Fence() <= ticketB.Fence() {
+		t.Fatalf("Expected fencing token %d to exceed %d", ticketC.Fence(), ticketB.Fence())
+	}
+
+	// Assert that the token increases after lease expiry.
+	ticketD, _ := manager.Acquire("a", 20*timeScale, 10*timeScale)
+	clock.Advance(12 * timeScale)
+
+	AssertTicketAcquired(t, ticketD, true)
+
+	if ticketD.Fence() <= ticketC.Fence() {
+		t.Fatalf("Expected fencing token %d to exceed %d", ticketD.Fence(), ticketC.Fence())
+	}
+}
+
+func TestManagerInfiniteLease(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	// Assert that an infinite lease is not reaped.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, InfiniteTimeout)
+	ticketB, _ := manager.Acquire("a", 20*timeScale, 10*timeScale)
+
+	clock.Advance(3 * timeScale)
+
+	AssertTicketWaiting(t, ticketB)
+	AssertPathLockedBy(t, manager, "a", ticketA.Id())
+
+	state, _ := manager.Inspect("a")
+	if state.LockTimeout != InfiniteTimeout || state.Holders[0].Timeout != InfiniteTimeout {
+		t.Fatalf("Expected lease to be infinite, got %v", state.LockTimeout)
+	}
+
+	// Assert that extending an infinite lease has no effect.
+	if found, changed, _ := manager.Extend("a", ticketA.Id(), 10*timeScale); !found || changed {
+		t.Fatalf("Expected extension of infinite lease to have no effect")
+	}
+
+	// Assert that an infinite lease can be shortened to expire.
+	if found, changed, _ := manager.Shorten("a", ticketA.Id(), timeScale); !found || !changed {
+		t.Fatalf("Expected infinite lease to be shortened")
+	}
+
+	clock.Advance(3 * timeScale)
+
+	AssertTicketAcquired(t, ticketB, true)
+
+	// Assert that a finite lease can be extended to be infinite, and that infinite leases can be released.
+	if _, changed, _ := manager.Extend("a", ticketB.Id(), InfiniteTimeout); !changed {
+		t.Fatalf("Expected lease to be extended to be infinite")
+	}
+
+	clock.Advance(12 * timeScale)
+
+	AssertPathLockedBy(t, manager, "a", ticketB.Id())
+
+	if found, _ := manager.Release("a", ticketB.Id()); !found {
+		t.Fatalf("Expected infinite lease to be released")
+	}
+
+	AssertPathLockedBy(t, manager, "a")
+}
+
+func TestManagerWALRestore(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "wal")
+
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, err := NewManager(Config{MaintenanceInterval: timeScale, WALPath: walPath, Clock: clock})
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	manager.Start()
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	// Journal shared holders, an extended lease, a released lease, a promoted waiter and an expiring lease.
+	manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, shared)
+	manager.Extend("a", ticketB.Id(), 100*timeScale)
+
+	ticketC, _ := manager.Acquire("b", 10*timeScale, 100*timeScale)
+	ticketD, _ := manager.Acquire("b", 10*timeScale, 100*timeScale)
+	manager.Release("b", ticketC.Id())
+	AssertTicketAcquired(t, ticketD, true)
+
+	manager.Acquire("c", 10*timeScale, 3*timeScale)
+	ticketE, _ := manager.Acquire("d", 10*timeScale, InfiniteTimeout)
+
+	manager.Stop()
+
+	// Assert that the holders are restored, with expired leases dropped.
+	clock.Advance(12 * timeScale)
+
+	manager, err = NewManager(Config{MaintenanceInterval: timeScale, WALPath: walPath, Clock: clock})
+	if err != nil {
+		t.Fatalf("Failed to restore manager: %v", err)
+	}
+	manager.Start()
+	defer manager.Stop()
+
+	AssertPathLockedBy(t, manager, "a", ticketB.Id())
+	AssertPathLockedBy(t, manager, "b", ticketD.Id())
+	AssertPathLockedBy(t, manager, "c")
+	AssertPathLockedBy(t, manager, "d", ticketE.Id())
+
+	if state, _ := manager.Inspect("d"); state.LockTimeout != InfiniteTimeout {
+		t.Fatalf("Expected restored lease to be infinite")
+	}
+
+	state, _ := manager.Inspect("a")
+	if state.Mode != ModeShared || state.Fence != ticketB.Fence() {
+		t.Fatalf("Expected shared lock with fencing token %d", ticketB.Fence())
+	}
+	if state.LockTimeout != 88*timeScale {
+		t.Fatalf("Unexpected restored lease timeout %v", state.LockTimeout)
+	}
+
+	// Assert that restored tickets can be released, and that fencing tokens keep increasing.
+	if found, _ := manager.Release("b", ticketD.Id()); !found {
+		t.Fatalf("Expected restored ticket to be released")
+	}
+
+	ticketF, _ := manager.Acquire("b", 10*timeScale, 10*timeScale)
+	if ticketF.Fence() <= ticketD.Fence() {
+		t.Fatalf("Expected fencing token %d to exceed %d", ticketF.Fence(), ticketD.Fence())
+	}
+}
+
+func TestManagerSnapshot(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	// Snapshot shared holders, a re-entered holder with a waiting acquisition, an infinite lease and an expiring lease.
+	owner := AcquireOptions{Owner: "worker", Labels: map[string]string{"host": "a"}}
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 100*timeScale, AcquireOptions{Mode: ModeShared})
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 100*timeScale, AcquireOptions{Mode: ModeShared})
+	ticketC, _ := manager.Acquire("b", 10*timeScale, 100*timeScale, owner)
+	manager.Acquire("b", 10*timeScale, 100*timeScale, owner)
+	ticketD, _ := manager.Acquire("b", 100*timeScale, 10*timeScale)
+	ticketE, _ := manager.Acquire("c", 10*timeScale, InfiniteTimeout)
+	manager.Acquire("d", 10*timeScale, 3*timeScale)
+
+	data, err := manager.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+
+	// Assert that the locks are restored by another manager, with expired leases skipped.
+	clock.Advance(5 * timeScale)
+
+	restored, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	restored.Start()
+	defer restored.Stop()
+
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+
+	AssertPathLockedBy(t, restored, "a", ticketA.Id(), ticketB.Id())
+	AssertPathLockedBy(t, restored, "b", ticketC.Id())
+	AssertPathLockedBy(t, restored, "c", ticketE.Id())
+	AssertPathLockedBy(t, restored, "d")
+
+	state, _ := restored.Inspect("b")
+	if state.Fence != ticketC.Fence() || state.Depth != 2 || state.Holders[0].Owner != "worker" || state.Holders[0].Labels["host"] != "a" {
+		t.Fatalf("Expected re-entered lock held by worker with fencing token %d, got %+v", ticketC.Fence(), state)
+	}
+	if state.LockTimeout != 95*timeScale {
+		t.Fatalf("Unexpected restored lease timeout %v", state.LockTimeout)
+	}
+	if len(state.Acquirers) != 1 || state.Acquirers[0].Id != ticketD.Id() || state.Acquirers[0].Timeout != 95*timeScale {
+		t.Fatalf("Expected acquirer %d to be restored, got %+v", ticketD.Id(), state.Acquirers)
+	}
+
+	if state, _ := restored.Inspect("c"); state.LockTimeout != InfiniteTimeout {
+		t.Fatalf("Expected restored lease to be infinite")
+	}
+
+	// Assert that waiting acquisitions are promoted once the restored holder releases the lock.
+	restored.Release("b", ticketC.Id())
+	restored.Release("b", ticketC.Id())
+	AssertPathLockedBy(t, restored, "b", ticketD.Id())
+
+	// Assert that fencing tokens keep increasing, and that snapshots conflicting with existing locks are refused.
+	ticketF, _ := restored.Acquire("e", 10*timeScale, 10*timeScale)
+	if ticketF.Fence() <= ticketC.Fence() {
+		t.Fatalf("Expected fencing token %d to exceed %d", ticketF.Fence(), ticketC.Fence())
+	}
+
+	if err := restored.Restore(data); err != ErrSnapshotConflict {
+		t.Fatalf("Expected snapshot conflict, got %v", err)
+	}
+
+	for _, data := range []string{`{"version":2}`, `{"version":1,"locks":[{"path":"a/../b"}]}`, `not json`} {
+		if err := restored.Restore([]byte(data)); err != ErrSnapshotInvalid {
+			t.Errorf("Expected snapshot %s to be invalid, got %v", data, err)
+		}
+	}
+}
+
+func TestManagerWALCompaction(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "wal")
+
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{
+		MaintenanceInterval:   timeScale,
+		WALPath:               walPath,
+		WALCompactionInterval: 5 * timeScale,
+		Clock:                 clock,
+	})
+	manager.Start()
+	defer manager.Stop()
+
+	// Churn a lock to grow the log.
+	for idx := 0; idx < 10; idx++ {
+		ticket, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+		manager.Release("a", ticket.Id())
+	}
+
+	ticket, _ := manager.Acquire("a", 10*timeScale, 100*timeScale)
+
+	// Assert that the log is compacted to the current holders.
+	clock.Advance(6 * timeScale)
+
+	data, err := ioutil.ReadFile(walPath)
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Fatalf("Expected compacted log to contain 1 record, got %d", lines)
+	}
+
+	restored, _ := NewManager(Config{WALPath: walPath, Clock: clock})
+	AssertPathLockedBy(t, restored, "a", ticket.Id())
+}
+
+// Journal failing appends once a number of records is appended.
+type failingJournal struct {
+	sync      sync.Mutex
+	records   []JournalRecord
+	failAfter int
+	compacted int
+}
+
+func (j *failingJournal) Restore(now time.Time) ([]JournalRecord, error) {
+	return nil, nil
+}
+
+func (j *failingJournal) Append(record JournalRecord) error {
+	j.sync.Lock()
+	defer j.sync.Unlock()
+
+	if len(j.records) >= j.failAfter {
+		return fmt.Errorf("journal failed")
+	}
+
+	j.records = append(j.records, record)
+	return nil
+}
+
+func (j *failingJournal) Compact(holders []JournalRecord) error {
+	j.sync.Lock()
+	defer j.sync.Unlock()
+
+	j.compacted++
+	return nil
+}
+
+func TestManagerJournalFailure(t *testing.T) {
+	journal := &failingJournal{failAfter: 3}
+
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{
+		MaintenanceInterval:   timeScale,
+		Journal:               journal,
+		WALCompactionInterval: -1,
+		Clock:                 clock,
+	})
+	manager.Start()
+	defer manager.Stop()
+
+	owner := AcquireOptions{Owner: "worker"}
+	manager.Acquire("a", 10*timeScale, 100*timeScale, owner)
+	ticketB, _ := manager.Acquire("b", 10*timeScale, 100*timeScale, owner)
+
+	// Assert that the releases journaled before a failure are applied.
+	count, err := manager.ReleaseByOwner("worker")
+	if count != 1 || err == nil {
+		t.Fatalf("Expected a single release before failing, got %d, %v", count, err)
+	}
+
+	AssertPathLockedBy(t, manager, "a")
+	AssertPathLockedBy(t, manager, "b", ticketB.Id())
+
+	if last := journal.records[len(journal.records)-1]; last.Op != JournalOpRelease || last.Path != "a" {
+		t.Fatalf("Expected release of a to be journaled last, got %+v", last)
+	}
+
+	// Assert that the journal is not compacted if compaction is disabled.
+	clock.Advance(20 * timeScale)
+
+	journal.sync.Lock()
+	defer journal.sync.Unlock()
+
+	if journal.compacted != 0 {
+		t.Fatalf("Expected journal not to be compacted, got %d compactions", journal.compacted)
+	}
+}
+
+// Store failing writes while failing.
+type failingStore struct {
+	Store
+	failing atomic.Bool
+}
+
+func (s *failingStore) Write(locks []StoredLock) error {
+	if s.failing.Load() {
+		return fmt.Errorf("store failed")
+	}
+
+	return s.Store.Write(locks)
+}
+
+func TestManagerStoreFailure(t *testing.T) {
+	store := &failingStore{Store: NewMemoryStore()}
+	store.failing.Store(true)
+
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Store: store, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	// Assert that failing writes do not fail the operations of the manager.
+	ticketA, err := manager.Acquire("a", 10*timeScale, 100*timeScale)
+	if err != nil {
+		t.Fatalf("Expected acquisition to succeed, got %v", err)
+	}
+	clock.Advance(timeScale)
+
+	if locks, _ := store.Load(); len(locks) != 0 {
+		t.Fatalf("Expected no stored locks, got %+v", locks)
+	}
+
+	// Assert that failed writes are retried along with later changes.
+	ticketB, _ := manager.Acquire("b", 10*timeScale, 100*timeScale)
+	manager.Extend("a", ticketA.Id(), 200*timeScale)
+	store.failing.Store(false)
+	clock.Advance(timeScale)
+
+	locks, _ := store.Load()
+	if len(locks) != 2 || locks[0].Holders[0].Id != ticketA.Id() || locks[1].Holders[0].Id != ticketB.Id() {
+		t.Fatalf("Expected stored holders of a and b, got %+v", locks)
+	}
+
+	if leaseUntil := clock.Now().Add(199 * timeScale).UnixNano(); locks[0].Holders[0].LeaseUntil != leaseUntil {
+		t.Fatalf("Expected stored lease until %d, got %d", leaseUntil, locks[0].Holders[0].LeaseUntil)
+	}
+}
+
+func TestManagerAcquireReentrant(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	ownerA := AcquireOptions{Owner: "worker-a"}
+	ownerB := AcquireOptions{Owner: "worker-b"}
+
+	// Assert that the owner re-enters the lock with the same ticket.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, ownerA)
+	AssertTicketAcquired(t, ticketA, true)
+
+	reentered, _ := manager.Acquire("a", 10*timeScale, 20*timeScale, ownerA)
+	if reentered != ticketA {
+		t.Fatalf("Expected re-entry to return ticket %d", ticketA.Id())
+	}
+	AssertTicketAcquired(t, reentered, true)
+
+	reentered, acquired, _ := manager.TryAcquire("a", 10*timeScale, ownerA)
+	if !acquired || reentered != ticketA {
+		t.Fatalf("Expected re-entry to return ticket %d", ticketA.Id())
+	}
+
+	state, _ := manager.Inspect("a")
+	if state.Depth != 3 || state.Holders[0].Depth != 3 || state.Holders[0].Owner != "worker-a" {
+		t.Fatalf("Expected lock to be held by worker-a with depth 3, got %d", state.Depth)
+	}
+	if state.LockTimeout <= 10*timeScale {
+		t.Fatalf("Expected re-entry to extend the lease")
+	}
+
+	// Assert that other owners queue.
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, ownerB)
+	AssertTicketWaiting(t, ticketB)
+
+	// Assert that the lock is only released once every hold is released.
+	for idx := 0; idx < 2; idx++ {
+		if found, _ := manager.Release("a", ticketA.Id()); !found {
+			t.Fatalf("Expected hold to be released")
+		}
+
+		AssertTicketWaiting(t, ticketB)
+		AssertPathLockedBy(t, manager, "a", ticketA.Id())
+	}
+
+	manager.Release("a", ticketA.Id())
+
+	AssertTicketAcquired(t, ticketB, true)
+	AssertPathLockedBy(t, manager, "a", ticketB.Id())
+
+	// Assert that acquisitions without an owner never re-enter.
+	ticketC, _ := manager.Acquire("b", 10*timeScale, 10*timeScale)
+	ticketD, _ := manager.Acquire("b", 0, 10*timeScale)
+
+	if ticketD == ticketC {
+		t.Fatalf("Expected acquisition without owner not to re-enter")
+	}
+	AssertTicketAcquired(t, ticketD, false)
+}
+
+func TestManagerLabels(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	labels := map[string]string{"host": "a", "job": "backup"}
+
+	// Assert that labels are surfaced for holders and acquirers.
+	manager.Acquire("a", 10*timeScale, 10*timeScale, AcquireOptions{Labels: labels})
+	manager.Acquire("a", 10*timeScale, 10*timeScale, AcquireOptions{Owner: "worker", Labels: labels})
+
+	labels["host"] = "b"
+
+	state, _ := manager.Inspect("a")
+	if state.Holders[0].Labels["host"] != "a" || state.Holders[0].Labels["job"] != "backup" {
+		t.Fatalf("Expected holder labels, got %v", state.Holders[0].Labels)
+	}
+	if state.Acquirers[0].Owner != "worker" || state.Acquirers[0].Labels["host"] != "a" {
+		t.Fatalf("Expected acquirer owned by worker with labels, got %+v", state.Acquirers[0])
+	}
+
+	// Assert that metadata exceeding the limits is rejected.
+	tooMany := make(map[string]string, MaxLabels+1)
+	for idx := 0; idx <= MaxLabels; idx++ {
+		tooMany[fmt.Sprintf("key%d", idx)] = "value"
+	}
+
+	fixtures := []AcquireOptions{
+		{Owner: strings.Repeat("a", MaxOwnerLength+1)},
+		{Labels: tooMany},
+		{Labels: map[string]string{strings.Repeat("a", MaxLabelKeyLength+1): "value"}},
+		{Labels: map[string]string{"key": strings.Repeat("a", MaxLabelValueLength+1)}},
+	}
+
+	for _, options := range fixtures {
+		if _, err := manager.Acquire("b", 10*timeScale, 10*timeScale, options); err != ErrMetadataTooLarge {
+			t.Errorf("Expected metadata to be too large, got %v", err)
+		}
+		if _, _, err := manager.TryAcquire("b", 10*timeScale, options); err != ErrMetadataTooLarge {
+			t.Errorf("Expected metadata to be too large, got %v", err)
+		}
+	}
+
+	if lockers, _ := manager.IsLocked("b"); len(lockers) != 0 {
+		t.Fatalf("Expected lock not to be held, got %v", lockers)
+	}
+}
+
+func TestManagerHistory(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock, AuditHistorySize: 4, AuditHistoryPaths: 2})
+	manager.Start()
+	defer manager.Stop()
+
+	// Assert that the lifecycle of a lock is audited, along with the owner metadata.
+	owner := AcquireOptions{Owner: "worker", Labels: map[string]string{"host": "a"}}
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, owner)
+	manager.Extend("a", ticketA.Id(), 20*timeScale)
+	ticketB, _ := manager.Acquire("a", timeScale, 10*timeScale)
+	clock.Advance(3 * timeScale)
+
+	AssertHistory(t, manager, "a", []AuditEventKind{AuditAcquired, AuditExtended, AuditTimedOut})
+
+	events, _ := manager.History("a")
+	if events[0].Id != ticketA.Id() || events[0].Owner != "worker" || events[0].Labels["host"] != "a" || events[0].Fence != ticketA.Fence() {
+		t.Fatalf("Expected acquisition by worker, got %+v", events[0])
+	}
+	if events[1].LeaseTimeout != 20*timeScale || events[2].Id != ticketB.Id() {
+		t.Fatalf("Unexpected events %+v", events[1:])
+	}
+
+	// Assert that only the most recent events are retained, and that histories outlive locks.
+	manager.Release("a", ticketA.Id())
+	manager.Acquire("a", 10*timeScale, timeScale)
+	clock.Advance(3 * timeScale)
+
+	AssertHistory(t, manager, "a", []AuditEventKind{AuditTimedOut, AuditReleased, AuditAcquired, AuditExpired})
+
+	// Assert that the histories of the paths least recently audited are evicted.
+	manager.Acquire("b", 10*timeScale, 10*timeScale)
+	manager.Acquire("c", 10*timeScale, 10*timeScale)
+
+	AssertHistory(t, manager, "a", nil)
+	AssertHistory(t, manager, "b", []AuditEventKind{AuditAcquired})
+	AssertHistory(t, manager, "c", []AuditEventKind{AuditAcquired})
+
+	// Assert that auditing is disabled by default.
+	disabled, _ := NewManager(Config{})
+	disabled.Acquire("a", 10*timeScale, 10*timeScale)
+
+	AssertHistory(t, disabled, "a", nil)
+}
+
+func AssertHistory(t *testing.T, manager Manager, path string, expected []AuditEventKind) {
+	t.Helper()
+
+	events, err := manager.History(path)
+	if err != nil {
+		t.Fatalf("Failed to retrieve history: %v", err)
+	}
+
+	kinds := make([]AuditEventKind, len(events))
+	for idx, event := range events {
+		kinds[idx] = event.Kind
+	}
+
+	if !slices.Equal(kinds, expected) {
+		t.Fatalf("Expected history of %s to be %v, got %v", path, expected, kinds)
+	}
+}
+
+func TestManagerQueuePosition(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	holder, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	waitingA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	waitingB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+
+	for _, fixture := range []struct {
+		Id       int64
+		Position int
+	}{
+		{holder.Id(), 0},
+		{waitingA.Id(), 1},
+		{waitingB.Id(), 2},
+		{waitingB.Id() + 1, -1},
+	} {
+		position, total, err := manager.QueuePosition("a", fixture.Id)
+		if err != nil || position != fixture.Position || total != 2 {
+			t.Fatalf("Expected position %d of 2 for %d, got %d of %d, %v", fixture.Position, fixture.Id, position, total, err)
+		}
+	}
+
+	// Assert that positions advance as the queue moves.
+	manager.Release("a", holder.Id())
+
+	if position, total, _ := manager.QueuePosition("a", waitingB.Id()); position != 1 || total != 1 {
+		t.Fatalf("Expected position 1 of 1, got %d of %d", position, total)
+	}
+	if position, _, _ := manager.QueuePosition("b", waitingB.Id()); position != -1 {
+		t.Fatalf("Expected ticket not to be found, got position %d", position)
+	}
+}
+
+func TestManagerInspectRange(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	for _, path := range []string{"a/3", "a/1", "b/1", "a/2"} {
+		manager.Acquire(path, 10*timeScale, 10*timeScale)
+	}
+
+	// Assert that ranges are paginated in the order of their paths.
+	states, next, _ := manager.InspectRange("a/", "", 2)
+	if len(states) != 2 || states["a/1"].LockingId == 0 || states["a/2"].LockingId == 0 || next != "a/2" {
+		t.Fatalf("Expected first range of a/1 and a/2, got %v, %q", states, next)
+	}
+
+	states, next, _ = manager.InspectRange("a/", next, 2)
+	if len(states) != 1 || states["a/3"].LockingId == 0 || next != "" {
+		t.Fatalf("Expected last range of a/3, got %v, %q", states, next)
+	}
+
+	// Assert that ranges without a limit are complete.
+	if states, next, _ := manager.InspectRange("", "a/1", 0); len(states) != 3 || next != "" {
+		t.Fatalf("Expected all locks after a/1, got %v, %q", states, next)
+	}
+
+	// Assert that exactly filled ranges have no next cursor.
+	if states, next, _ := manager.InspectRange("b/", "", 1); len(states) != 1 || next != "" {
+		t.Fatalf("Expected single lock of b/, got %v, %q", states, next)
+	}
+}
+
+func TestManagerInspectPattern(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	for _, path := range []string{"jobs/2024/a", "jobs/2024/b/c", "jobs/2025/a", "jobs/2024"} {
+		manager.Acquire(path, 10*timeScale, 10*timeScale)
+	}
+
+	for pattern, expectedPaths := range map[string][]string{
+		"jobs/2023/*":    {},
+		"jobs/2025/*":    {"jobs/2025/a"},
+		"jobs/2024/*":    {"jobs/2024/a", "jobs/2024/b/c"},
+		"jobs/2024":      {"jobs/2024"},
+		"jobs/2023":      {},
+		"*":              {"jobs/2024", "jobs/2024/a", "jobs/2024/b/c", "jobs/2025/a"},
+		"/jobs/2024/b/*": {"jobs/2024/b/c"},
+	} {
+		states, err := manager.InspectPattern(pattern)
+		if err != nil {
+			t.Fatalf("Failed to inspect %s: %v", pattern, err)
+		}
+
+		if len(states) != len(expectedPaths) {
+			t.Errorf("Expected %s to match %v, got %v", pattern, expectedPaths, states)
+		}
+		for _, path := range expectedPaths {
+			if states[path].LockingId == 0 {
+				t.Errorf("Expected %s to match %s", pattern, path)
+			}
+		}
+	}
+
+	// Assert that released locks no longer match.
+	lockers, _ := manager.IsLocked("jobs/2025/a")
+	manager.Release("jobs/2025/a", lockers[0])
+
+	if states, _ := manager.InspectPattern("jobs/2025/*"); len(states) != 0 {
+		t.Fatalf("Expected no locks to match, got %v", states)
+	}
+
+	if _, err := manager.InspectPattern("jobs/*/a"); err != ErrPathInvalid {
+		t.Fatalf("Expected pattern to be invalid, got %v", err)
+	}
+}
+
+func TestManagerGeneration(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	var generations []int64
+
+	assertChanged := func(expected bool) {
+		t.Helper()
+
+		state, _ := manager.Inspect("a")
+		if changed := state.Generation != generations[len(generations)-1]; changed != expected {
+			t.Fatalf("Expected generation change to be %v, got %d after %v", expected, state.Generation, generations)
+		}
+
+		generations = append(generations, state.Generation)
+	}
+
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	state, _ := manager.Inspect("a")
+	generations = append(generations, state.Generation)
+
+	// Assert that the generation is unaffected by inspection, but changes with every change of state.
+	assertChanged(false)
+
+	manager.Extend("a", ticketA.Id(), 20*timeScale)
+	assertChanged(true)
+
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	assertChanged(true)
+
+	manager.Release("a", ticketA.Id())
+	assertChanged(true)
+
+	// Assert that generations do not repeat once a lock is deleted and recreated.
+	manager.Release("a", ticketB.Id())
+	manager.Acquire("a", 10*timeScale, 10*timeScale)
+	assertChanged(true)
+
+	if !slices.IsSorted(generations) {
+		t.Fatalf("Expected generations to increase, got %v", generations)
+	}
+}
+
+func TestManagerMaintenanceJitter(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale / 10, MaintenanceJitter: 5 * timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	// Acquire many leases sharing the same timeout, and record when each expires.
+	start := time.Now()
+	expiries := make(chan time.Duration, 20)
+
+	for idx := range cap(expiries) {
+		ticket, _ := manager.Acquire(fmt.Sprintf("a%d", idx), 0, timeScale)
+
+		go func() {
+			for event := range ticket.Events() {
+				if event == TicketLeaseExpired {
+					expiries <- time.Since(start)
+				}
+			}
+		}()
+	}
+
+	// Assert that the leases expire spread out across maintenance passes, but never before their timeout.
+	var earliest, latest time.Duration
+
+	for idx := range cap(expiries) {
+		select {
+		case expiry := <-expiries:
+			if idx == 0 || expiry < earliest {
+				earliest = expiry
+			}
+			latest = max(latest, expiry)
+		case <-time.After(10 * timeScale):
+			t.Fatalf("Expected all leases to expire")
+		}
+	}
+
+	if earliest < timeScale {
+		t.Fatalf("Expected no lease to expire before its timeout, got %s", earliest)
+	}
+	if latest-earliest < timeScale {
+		t.Fatalf("Expected expiries to spread out, got %s to %s", earliest, latest)
+	}
+}
+
+func TestManagerAcquireOrExtend(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	// Test that an unknown ID acquires the lock.
+	ticketA, found, _ := manager.AcquireOrExtend(context.Background(), "a", 0, 10*timeScale, 2*timeScale)
+	if found {
+		t.Fatalf("Expected no ticket to be found")
+	}
+
+	AssertTicketAcquired(t, ticketA, true)
+
+	// Test that the holder has its lease extended.
+	ticket, found, _ := manager.AcquireOrExtend(context.Background(), "a", ticketA.Id(), 10*timeScale, 10*timeScale)
+	if !found || ticket.Id() != ticketA.Id() {
+		t.Fatalf("Expected ticket %d to be found", ticketA.Id())
+	}
+
+	// Test that a waiting ticket is left waiting.
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+
+	ticket, found, _ = manager.AcquireOrExtend(context.Background(), "a", ticketB.Id(), 10*timeScale, 10*timeScale)
+	if !found || ticket.Id() != ticketB.Id() {
+		t.Fatalf("Expected ticket %d to be found", ticketB.Id())
+	}
+
+	if state, _ := manager.Inspect("a"); len(state.Acquirers) != 1 {
+		t.Fatalf("Expected a single waiting acquisition, got %d", len(state.Acquirers))
+	}
+
+	// Assert that the holder outlives its original lease.
+	clock.Advance(4 * timeScale)
+
+	AssertTicketWaiting(t, ticketB)
+	AssertPathLockedBy(t, manager, "a", ticketA.Id())
+}
+
+func TestManagerHoldHistograms(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{
+		MaintenanceInterval:  timeScale,
+		Clock:                clock,
+		HoldHistogram:        HoldHistogramByNamespace,
+		HoldHistogramBuckets: []time.Duration{5 * timeScale, timeScale},
+	})
+	manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("team/a", 0, 10*timeScale)
+	ticketB, _ := manager.Acquire("team/b", 0, 3*timeScale, AcquireOptions{Owner: "worker"})
+	manager.Acquire("team/b", 0, 3*timeScale, AcquireOptions{Owner: "worker"})
+	ticketC, _ := manager.Acquire("c", 0, 10*timeScale)
+
+	// Test that re-entrant exits are not recorded, but releases and lease expiry are.
+	clock.Advance(timeScale / 2)
+	manager.Release("c", ticketC.Id())
+	manager.Release("team/b", ticketB.Id())
+
+	clock.Advance(3 * timeScale)
+	manager.Release("team/a", ticketA.Id())
+
+	expected := []HoldHistogram{
+		{LabelName: "namespace", Label: "", Buckets: []time.Duration{timeScale, 5 * timeScale}, Counts: []uint64{1, 1}, Count: 1, Sum: timeScale / 2},
+		{LabelName: "namespace", Label: "team", Buckets: []time.Duration{timeScale, 5 * timeScale}, Counts: []uint64{0, 2}, Count: 2, Sum: 3*timeScale + 7*timeScale/2},
+	}
+
+	if histograms := manager.HoldHistograms(); !reflect.DeepEqual(histograms, expected) {
+		t.Fatalf("Expected histograms %+v, got %+v", expected, histograms)
+	}
+
+	// Test that histograms are disabled by default.
+	disabled, _ := NewManager(Config{})
+	if histograms := disabled.HoldHistograms(); histograms != nil {
+		t.Fatalf("Expected no histograms, got %+v", histograms)
+	}
+}
+
+func TestManagerStats(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	// Assert that an empty manager has no statistics.
+	if stats := manager.Stats(); stats != (ManagerStats{}) {
+		t.Fatalf("Expected empty statistics, got %+v", stats)
+	}
+
+	shared := AcquireOptions{Mode: ModeShared}
+
+	manager.Acquire("a", 10*timeScale, 10*timeScale)
+	manager.Acquire("a", 10*timeScale, 10*timeScale)
+	clock.Advance(timeScale)
+	manager.Acquire("b", 10*timeScale, 10*timeScale, shared)
+	manager.Acquire("b", 10*timeScale, 10*timeScale, shared)
+	manager.Acquire("b", 10*timeScale, 10*timeScale)
+
+	// Assert that holders and acquirers are counted across paths, and that the oldest lease is that of path a.
+	stats := manager.Stats()
+	if stats.Paths != 2 || stats.Holders != 3 || stats.Acquirers != 2 {
+		t.Fatalf("Expected 2 paths, 3 holders and 2 acquirers, got %+v", stats)
+	}
+	if stats.OldestLeaseAge != timeScale {
+		t.Fatalf("Expected oldest lease age of %s, got %s", timeScale, stats.OldestLeaseAge)
+	}
+
+	// Assert that maintenance has run at the end of the last interval.
+	clock.Advance(timeScale)
+
+	if stats = manager.Stats(); !stats.LastMaintenance.Equal(clock.Now()) {
+		t.Fatalf("Expected maintenance to have run at %s, got %s", clock.Now(), stats.LastMaintenance)
+	}
+}
+
+func TestManagerNamespaces(t *testing.T) {
+	manager, _ := NewManager(Config{
+		MaintenanceInterval: timeScale,
+		DefaultNamespace:    NamespaceConfig{MaxLeaseTimeout: 10 * timeScale},
+		Namespaces: map[string]NamespaceConfig{
+			"team-a": {MaxQueueDepth: 1},
+			"team-b": {},
+		},
+	})
+	go manager.Start()
+	defer manager.Stop()
+
+	// Assert that acquisitions beyond the queue depth of the namespace fail.
+	manager.Acquire("team-a/x", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("team-a/x", 10*timeScale, 10*timeScale)
+	AssertTicketWaiting(t, ticketB)
+
+	if _, err := manager.Acquire("team-a/x", 10*timeScale, 10*timeScale); err != ErrQueueFull {
+		t.Fatalf("Expected queue to be full, got %v", err)
+	}
+
+	// Assert that acquisitions that do not queue are unaffected by the queue depth.
+	if ticket, err := manager.Acquire("team-a/x", 0, 10*timeScale); err != nil {
+		t.Fatalf("Expected immediate acquisition not to be refused, got %v", err)
+	} else {
+		AssertTicketAcquired(t, ticket, false)
+	}
+
+	// Assert that other namespaces are unaffected by the queue depth.
+	manager.Acquire("team-b/x", 10*timeScale, InfiniteTimeout)
+	manager.Acquire("team-b/x", 10*timeScale, 10*timeScale)
+
+	if _, err := manager.Acquire("team-b/x", 10*timeScale, 10*timeScale); err != nil {
+		t.Fatalf("Expected acquisition to be enqueued, got %v", err)
+	}
+
+	// Assert that leases of the default namespace, and of namespaces without configuration, are capped.
+	for _, path := range []string{"x", "team-c/x"} {
+		ticket, _ := manager.Acquire(path, 10*timeScale, InfiniteTimeout)
+		manager.Extend(path, ticket.Id(), 100*timeScale)
+
+		if state, _ := manager.Inspect(path); state.LockTimeout < 0 || state.LockTimeout > 10*timeScale {
+			t.Fatalf("Expected lease of %s to be capped, got %v", path, state.LockTimeout)
+		}
+	}
+
+	if state, _ := manager.Inspect("team-b/x"); state.LockTimeout != InfiniteTimeout {
+		t.Fatalf("Expected lease of team-b/x not to be capped, got %v", state.LockTimeout)
+	}
+
+	// Assert that namespaces are listed with their locks.
+	namespaces, _ := manager.Namespaces()
+
+	expected := []NamespaceState{
+		{Name: "", Config: NamespaceConfig{MaxLeaseTimeout: 10 * timeScale}, Locks: 1},
+		{Name: "team-a", Config: NamespaceConfig{MaxQueueDepth: 1}, Locks: 1},
+		{Name: "team-b", Locks: 1},
+		{Name: "team-c", Config: NamespaceConfig{MaxLeaseTimeout: 10 * timeScale}, Locks: 1},
+	}
+	if fmt.Sprint(namespaces) != fmt.Sprint(expected) {
+		t.Fatalf("Expected namespaces %v, got %v", expected, namespaces)
+	}
+}
+
+func TestManagerTimeoutLimitsClamp(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{
+		MaintenanceInterval: timeScale,
+		Clock:               clock,
+		MinLeaseTimeout:     5 * timeScale,
+		MaxLeaseTimeout:     20 * timeScale,
+		MaxLockTimeout:      3 * timeScale,
+	})
+	manager.Start()
+	defer manager.Stop()
+
+	// Assert that lease timeouts are clamped when acquiring.
+	for _, fixture := range []struct {
+		LeaseTimeout    time.Duration
+		ExpectedTimeout time.Duration
+	}{
+		{timeScale, 5 * timeScale},
+		{10 * timeScale, 10 * timeScale},
+		{100 * timeScale, 20 * timeScale},
+		{InfiniteTimeout, 20 * timeScale},
+	} {
+		ticket, err := manager.Acquire("a", 0, fixture.LeaseTimeout)
+		if err != nil {
+			t.Fatalf("Failed to acquire lock: %v", err)
+		}
+
+		state, _ := manager.Inspect("a")
+		if state.LockTimeout != fixture.ExpectedTimeout {
+			t.Errorf("Expected lease timeout of %v to be clamped to %v, got %v", fixture.LeaseTimeout, fixture.ExpectedTimeout, state.LockTimeout)
+		}
+
+		manager.Release("a", ticket.Id())
+	}
+
+	// Assert that extensions are clamped.
+	ticketA, _, _ := manager.TryAcquire("a", 10*timeScale)
+	if _, changed, err := manager.Extend("a", ticketA.Id(), InfiniteTimeout); err != nil || !changed {
+		t.Fatalf("Expected lease to be extended, got %v, %v", changed, err)
+	}
+	if state, _ := manager.Inspect("a"); state.LockTimeout != 20*timeScale {
+		t.Fatalf("Expected extension to be clamped, got %v", state.LockTimeout)
+	}
+
+	// Assert that lock timeouts are clamped.
+	ticketB, _ := manager.Acquire("a", 100*timeScale, 10*timeScale)
+	AssertTicketWaiting(t, ticketB)
+
+	clock.Advance(3 * timeScale)
+	AssertTicketAcquired(t, ticketB, false)
+}
+
+func TestManagerTimeoutLimitsReject(t *testing.T) {
+	manager, _ := NewManager(Config{
+		MaintenanceInterval: timeScale,
+		MinLeaseTimeout:     5 * timeScale,
+		MaxLeaseTimeout:     20 * timeScale,
+		MaxLockTimeout:      3 * timeScale,
+		TimeoutPolicy:       TimeoutPolicyReject,
+	})
+	go manager.Start()
+	defer manager.Stop()
+
+	// Assert that out of range timeouts are rejected.
+	for _, leaseTimeout := range []time.Duration{timeScale, 21 * timeScale, InfiniteTimeout} {
+		if _, err := manager.Acquire("a", 0, leaseTimeout); err != ErrLeaseTimeoutOutOfRange {
+			t.Errorf("Expected lease timeout %v to be rejected, got %v", leaseTimeout, err)
+		}
+		if _, _, err := manager.TryAcquire("a", leaseTimeout); err != ErrLeaseTimeoutOutOfRange {
+			t.Errorf("Expected lease timeout %v to be rejected, got %v", leaseTimeout, err)
+		}
+	}
+
+	if _, err := manager.Acquire("a", 4*timeScale, 10*timeScale); err != ErrLockTimeoutOutOfRange {
+		t.Fatalf("Expected lock timeout to be rejected, got %v", err)
+	}
+
+	// Assert that timeouts at the limits are accepted.
+	ticket, err := manager.Acquire("a", 3*timeScale, 20*timeScale)
+	if err != nil {
+		t.Fatalf("Expected acquisition at the limits, got %v", err)
+	}
+	AssertTicketAcquired(t, ticket, true)
+
+	// Assert that extensions are rejected, while shortening is unaffected.
+	if _, _, err := manager.Extend("a", ticket.Id(), InfiniteTimeout); err != ErrLeaseTimeoutOutOfRange {
+		t.Fatalf("Expected extension to be rejected, got %v", err)
+	}
+	if _, changed, err := manager.Shorten("a", ticket.Id(), timeScale); err != nil || !changed {
+		t.Fatalf("Expected lease to be shortened, got %v, %v", changed, err)
+	}
+}
+
+func TestManagerSubscribe(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	states, unsubscribe, err := manager.Subscribe("a")
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	nextState := func() LockState {
+		select {
+		case state := <-states:
+			return state
+		case <-time.After(5 * timeScale):
+			t.Fatalf("Expected lock state")
+		}
+		return LockState{}
+	}
+
+	// Assert that the current state is delivered initially.
+	if state := nextState(); state.LockingId != 0 {
+		t.Fatalf("Expected lock not to be held")
+	}
+
+	// Assert that acquisitions, lease changes and releases are delivered.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+	if state := nextState(); state.LockingId != ticketA.Id() {
+		t.Fatalf("Expected lock to be held by %d", ticketA.Id())
+	}
+
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 3*timeScale)
+	if state := nextState(); len(state.Acquirers) != 1 || state.Acquirers[0].Id != ticketB.Id() {
+		t.Fatalf("Expected acquirer %d", ticketB.Id())
+	}
+
+	manager.Extend("a", ticketA.Id(), 20*timeScale)
+	if state := nextState(); state.LockTimeout <= 10*timeScale {
+		t.Fatalf("Expected lease to be extended")
+	}
+
+	manager.Release("a", ticketA.Id())
+	if state := nextState(); state.LockingId != ticketB.Id() || len(state.Acquirers) != 0 {
+		t.Fatalf("Expected lock to be promoted to %d", ticketB.Id())
+	}
+
+	// Assert that changes of other paths are not delivered.
+	manager.Acquire("b", 10*timeScale, 10*timeScale)
+
+	// Assert that lease expiry is delivered.
+	if state := nextState(); state.LockingId != 0 {
+		t.Fatalf("Expected lease to expire")
+	}
+
+	// Assert that unsubscribing closes the channel.
+	unsubscribe()
+
+	if _, ok := <-states; ok {
+		t.Fatalf("Expected channel to be closed")
+	}
+
+	manager.Acquire("a", 10*timeScale, 10*timeScale)
+}
+
+func TestManagerDetectDeadlocks(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale})
+	go manager.Start()
+	defer manager.Stop()
+
+	ownerA := AcquireOptions{Owner: "worker-a"}
+	ownerB := AcquireOptions{Owner: "worker-b"}
+	ownerC := AcquireOptions{Owner: "worker-c"}
+
+	// Assert that owners waiting for each other are detected.
+	manager.Acquire("a", 10*timeScale, 10*timeScale, ownerA)
+	manager.Acquire("b", 10*timeScale, 10*timeScale, ownerB)
+	manager.Acquire("c", 10*timeScale, 10*timeScale, ownerC)
+
+	ticketA, _ := manager.Acquire("b", 10*timeScale, 10*timeScale, ownerA)
+	ticketB, _ := manager.Acquire("c", 10*timeScale, 10*timeScale, ownerB)
+
+	if deadlocks, _ := manager.DetectDeadlocks(); len(deadlocks) != 0 {
+		t.Fatalf("Expected no deadlocks, got %v", deadlocks)
+	}
+
+	ticketC, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, ownerC)
+
+	// Assert that acquisitions without owners are not considered.
+	manager.Acquire("a", 10*timeScale, 10*timeScale)
+
+	deadlocks, _ := manager.DetectDeadlocks()
+	if fmt.Sprint(deadlocks) != fmt.Sprint([][]int64{{ticketA.Id(), ticketB.Id(), ticketC.Id()}}) {
+		t.Fatalf("Expected deadlock of %d, %d and %d, got %v", ticketA.Id(), ticketB.Id(), ticketC.Id(), deadlocks)
+	}
+}
+
+func TestManagerAbortDeadlocks(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock, AbortDeadlocks: true})
+	manager.Start()
+	defer manager.Stop()
+
+	ownerA := AcquireOptions{Owner: "worker-a"}
+	ownerB := AcquireOptions{Owner: "worker-b"}
+
+	// Assert that the youngest acquisition of a deadlock is aborted.
+	manager.Acquire("a", 10*timeScale, 10*timeScale, ownerA)
+	manager.Acquire("b", 10*timeScale, 10*timeScale, ownerB)
+
+	ticketA, _ := manager.Acquire("b", 10*timeScale, 10*timeScale, ownerA)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale, ownerB)
+
+	clock.Advance(2 * timeScale)
+
+	AssertTicketAcquired(t, ticketB, false)
+	AssertTicketWaiting(t, ticketA)
+
+	if deadlocks, _ := manager.DetectDeadlocks(); len(deadlocks) != 0 {
+		t.Fatalf("Expected no deadlocks, got %v", deadlocks)
+	}
+}
+
+func TestManagerDrain(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale / 10})
+	go manager.Start()
+	defer manager.Stop()
+
+	ticketA, _ := manager.Acquire("test", 10*timeScale, 10*timeScale)
+	ticketB, _ := manager.Acquire("test", 2*timeScale, 10*timeScale)
+	ticketC, _ := manager.Acquire("test", 10*timeScale, 10*timeScale)
+
+	// Assert that draining times out while acquisitions are waiting.
+	ctx, cancel := context.WithTimeout(context.Background(), timeScale)
+	defer cancel()
+
+	if err := manager.Drain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected draining to time out, got %v", err)
+	}
+
+	// Assert that new acquisitions are refused while draining.
+	if _, err := manager.Acquire("other", 10*timeScale, 10*timeScale); err != ErrDraining {
+		t.Fatalf("Expected acquisition to be refused, got %v", err)
+	}
+	if _, _, err := manager.TryAcquire("other", 10*timeScale); err != ErrDraining {
+		t.Fatalf("Expected acquisition to be refused, got %v", err)
+	}
+
+	// Assert that draining completes once the waiting acquisitions settle, with held locks left untouched.
+	drained := make(chan error, 1)
+	go func() {
+		drained <- manager.Drain(context.Background())
+	}()
+
+	manager.Release("test", ticketC.Id())
+
+	select {
+	case err := <-drained:
+		t.Fatalf("Expected draining to wait for acquisition, got %v", err)
+	case <-time.After(timeScale / 2):
+	}
+
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatalf("Expected draining to complete, got %v", err)
+		}
+	case <-time.After(2 * timeScale):
+		t.Fatalf("Expected draining to complete")
+	}
+
+	AssertTicketAcquired(t, ticketB, false)
+	AssertPathLockedBy(t, manager, "test", ticketA.Id())
+
+	if found, _ := manager.Release("test", ticketA.Id()); !found {
+		t.Fatalf("Expected lock to be released while draining")
+	}
+}
+
+func TestManagerAnnounceShutdown(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	ticket, _ := manager.Acquire("test", 10*timeScale, 10*timeScale)
+
+	if !manager.ShutdownDeadline().IsZero() {
+		t.Fatalf("Expected no shutdown deadline before announcement")
+	}
+
+	// Assert that holders learn of the announcement and its deadline before the manager is drained.
+	manager.AnnounceShutdown(5 * timeScale)
+
+	select {
+	case <-manager.ShutdownAnnounced():
+	default:
+		t.Fatalf("Expected shutdown to be announced")
+	}
+
+	if deadline := manager.ShutdownDeadline(); !deadline.Equal(clock.Now().Add(5 * timeScale)) {
+		t.Fatalf("Expected shutdown deadline after the grace period, got %v", deadline)
+	}
+
+	// Assert that locks are acquired, extended and released as usual during the grace period.
+	if _, err := manager.Acquire("other", 10*timeScale, 10*timeScale); err != nil {
+		t.Fatalf("Expected acquisition during the grace period, got %v", err)
+	}
+	if found, _, _ := manager.Extend("test", ticket.Id(), 20*timeScale); !found {
+		t.Fatalf("Expected lease to be extended during the grace period")
+	}
+	if found, _ := manager.Release("test", ticket.Id()); !found {
+		t.Fatalf("Expected lock to be released during the grace period")
+	}
+
+	// Assert that subsequent announcements and draining retain the announced deadline.
+	clock.Advance(timeScale)
+	manager.AnnounceShutdown(timeScale)
+
+	if err := manager.Drain(context.Background()); err != nil {
+		t.Fatalf("Expected draining to complete, got %v", err)
+	}
+	if deadline := manager.ShutdownDeadline(); !deadline.Equal(time.Unix(0, 0).Add(5 * timeScale)) {
+		t.Fatalf("Expected shutdown deadline to be retained, got %v", deadline)
+	}
+
+	// Assert that draining announces shutdown if not announced before.
+	manager, _ = NewManager(Config{MaintenanceInterval: timeScale, Clock: clock})
+	manager.Start()
+	defer manager.Stop()
+
+	if err := manager.Drain(context.Background()); err != nil {
+		t.Fatalf("Expected draining to complete, got %v", err)
+	}
+
+	select {
+	case <-manager.ShutdownAnnounced():
+	default:
+		t.Fatalf("Expected draining to announce shutdown")
+	}
+
+	if deadline := manager.ShutdownDeadline(); !deadline.Equal(clock.Now()) {
+		t.Fatalf("Expected shutdown deadline without grace, got %v", deadline)
+	}
+}
+
+// Buffer safe for concurrent use.
+type syncBuffer struct {
+	sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(data []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buffer.Write(data)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buffer.String()
+}
+
+func TestManagerLogging(t *testing.T) {
+	var logs syncBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale / 10, Clock: clock, Logger: logger})
+	manager.Start()
+	defer manager.Stop()
+
+	// Assert that the lifecycle of locks is logged.
+	ticketA, _ := manager.Acquire("test", 10*timeScale, 10*timeScale)
+	manager.Acquire("test", timeScale, 10*timeScale)
+	manager.Extend("test", ticketA.Id(), 20*timeScale)
+
+	clock.Advance(2 * timeScale)
+	manager.Release("test", ticketA.Id())
+
+	expected := []string{
+		fmt.Sprintf(`msg="Lock acquired" path=test id=%d`, ticketA.Id()),
+		fmt.Sprintf(`msg="Acquisition enqueued" path=test id=%d position=1`, ticketA.Id()+1),
+		fmt.Sprintf(`msg="Lease extended" path=test id=%d lease_timeout=2s`, ticketA.Id()),
+		fmt.Sprintf(`msg="Acquisition timed out" path=test id=%d waited=`, ticketA.Id()+1),
+		fmt.Sprintf(`msg="Lock released" path=test id=%d held=`, ticketA.Id()),
+	}
+
+	for _, message := range expected {
+		if !strings.Contains(logs.String(), message) {
+			t.Errorf("Expected log to contain %s, got:\n%s", message, logs.String())
+		}
+	}
+}
+
+func TestManagerAcquireReleaseStress(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale / 10})
+	manager.Start()
+	defer manager.Stop()
+
+	// Assert that every acquisition settles while many goroutines acquire, release and abandon the same path, both
+	// exclusively and shared.
+	var wg sync.WaitGroup
+	for worker := range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for iteration := range 50 {
+				var options AcquireOptions
+				if (worker+iteration)%3 == 0 {
+					options.Mode = ModeShared
+				}
+
+				lockTimeout := time.Duration(iteration%4) * timeScale / 20
+				ticket, cancel, err := manager.AcquireWithCancel("a", lockTimeout, timeScale, options)
+				if err != nil {
+					t.Errorf("Failed to acquire lock: %v", err)
+					return
+				}
+
+				// Abandon some of the acquisitions while they may still be waiting.
+				switch iteration % 5 {
+				case 0:
+					cancel()
+				case 1:
+					manager.Release("a", ticket.Id())
+				}
+
+				select {
+				case acquired := <-ticket.Acquired():
+					if acquired {
+						manager.Release("a", ticket.Id())
+					}
+				case <-time.After(20 * timeScale):
+					t.Errorf("Acquisition of ticket %d never settled", ticket.Id())
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Assert that the lock is deleted once all tickets are gone.
+	if locks, _ := manager.InspectAll(); len(locks) != 0 {
+		t.Fatalf("Expected no locks, got %+v", locks)
+	}
+}
+
+func TestManagerStartStop(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: time.Millisecond})
+
+	// Assert that starting and stopping repeatedly and concurrently neither panics nor races.
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for range 100 {
+				manager.Start()
+				manager.Start()
+				manager.Stop()
+				manager.Stop()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Assert that maintenance is stopped, and thus that leases no longer expire.
+	ticket, _ := manager.Acquire("a", 0, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+
+	AssertPathLockedBy(t, manager, "a", ticket.Id())
+
+	// Assert that maintenance can be restarted.
+	manager.Start()
+	defer manager.Stop()
+
+	time.Sleep(10 * time.Millisecond)
+
+	AssertPathLockedBy(t, manager, "a")
+}
+
+func TestManagerMaintenancePanic(t *testing.T) {
+	var logs syncBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale / 10, Clock: clock, AbortDeadlocks: true, Logger: logger})
+	manager.Start()
+	defer manager.Stop()
+
+	// Inject a corrupt lock, which panics both the maintenance of its path and the detection of deadlocks on every
+	// pass.
+	m := manager.(*managerImpl)
+	m.sync.Lock()
+	m.locks["corrupt"] = nil
+	m.sync.Unlock()
+
+	m.maintenanceSync.Lock()
+	m.locksNeedingMaintenance = append(m.locksNeedingMaintenance, "corrupt")
+	m.maintenanceSync.Unlock()
+
+	// Assert that maintenance keeps running, and thus that leases keep expiring.
+	ticketA, _ := manager.Acquire("a", 10*timeScale, 2*timeScale)
+	ticketB, _ := manager.Acquire("a", 10*timeScale, 10*timeScale)
+
+	AssertTicketAcquired(t, ticketA, true)
+	AssertTicketWaiting(t, ticketB)
+
+	clock.Advance(4 * timeScale)
+
+	AssertTicketAcquired(t, ticketB, true)
+	AssertPathLockedBy(t, manager, "a", ticketB.Id())
+
+	for _, message := range []string{`msg="Maintenance of path panicked" path=corrupt`, `msg="Maintenance panicked, restarting"`} {
+		if !strings.Contains(logs.String(), message) {
+			t.Errorf("Expected log to contain %s", message)
+		}
+	}
+
+	// Remove the corrupt lock, so maintenance stops panicking.
+	m.sync.Lock()
+	delete(m.locks, "corrupt")
+	m.sync.Unlock()
+}
+
+func TestManagerConcurrentPaths(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale / 10})
+	manager.Start()
+	defer manager.Stop()
+
+	// Acquire, extend, inspect and release overlapping paths concurrently, alongside operations spanning all paths,
+	// counting the holders of every path to assert mutual exclusion.
+	paths := []string{"a", "b", "c", "d", "ns/a", "ns/b"}
+	holders := make(map[string]*atomic.Int64, len(paths))
+	for _, path := range paths {
+		holders[path] = &atomic.Int64{}
+	}
+
+	deadline := time.Now().Add(5 * timeScale)
+
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < 16; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; time.Now().Before(deadline); i++ {
+				path := paths[(worker+i)%len(paths)]
+
+				stateChan, unsubscribe, _ := manager.Subscribe(path)
+
+				ticket, _ := manager.Acquire(path, timeScale, 10*timeScale)
+				if acquired := <-ticket.Acquired(); acquired {
+					if count := holders[path].Add(1); count != 1 {
+						t.Errorf("Expected path %s to be held once, got %d holders", path, count)
+					}
+
+					manager.Extend(path, ticket.Id(), 20*timeScale)
+					manager.Inspect(path)
+					<-stateChan
+
+					holders[path].Add(-1)
+					manager.Release(path, ticket.Id())
+				}
+
+				unsubscribe()
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for time.Now().Before(deadline) {
+			manager.InspectAll()
+			manager.Stats()
+			manager.Snapshot()
+			manager.ExtendMulti([]LeaseExtension{{Path: "a", Id: 1, Timeout: timeScale}})
+		}
+	}()
+
+	wg.Wait()
+
+	// Assert that every lock is released, and that the empty locks are deleted.
+	if states, _ := manager.InspectAll(); len(states) != 0 {
+		t.Errorf("Expected no locks, got %v", states)
+	}
+}
+
+func AssertTicketAcquired(t *testing.T, ticket Ticket, expected bool) {
+	select {
+	case status := <-ticket.Acquired():
+		if status != expected {
+			t.Fatalf("Expected ticket %d acquisition state to be %v", ticket.Id(), expected)
+		}
+	default:
+		t.Fatalf("Ticket %d did not report acquisition state", ticket.Id())
+	}
+}
+
+func AssertTicketWaiting(t *testing.T, ticket Ticket) {
+	select {
+	case <-ticket.Acquired():
+		t.Fatalf("Ticket %d unexpectedly reported acquisition state", ticket.Id())
+	default:
+	}
+}
+
+func AssertPathLockedBy(t *testing.T, manager Manager, path string, expected ...int64) {
+	lockers, err := manager.IsLocked(path)
+	if err != nil {
+		t.Fatalf("Unexpected error checking lock state for %s: %v", path, err)
+	}
+
+	if fmt.Sprint(lockers) != fmt.Sprint(expected) {
+		t.Fatalf("Expected path %s to be locked by %v but it is locked by %v", path, expected, lockers)
 	}
 }
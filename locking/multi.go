@@ -0,0 +1,169 @@
+package locking
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Multiple lock acquisition error.
+//
+// Indicates that a lock of a multiple lock acquisition could not be acquired, and thus that all locks acquired prior
+// to it were released.
+type AcquireMultiError struct {
+	// Path of the lock that could not be acquired.
+	Path string
+}
+
+func (e *AcquireMultiError) Error() string {
+	return fmt.Sprintf("failed to acquire lock %s", e.Path)
+}
+
+// Lease extension.
+//
+// A lease to extend by the given timeout, as part of the extension of multiple leases.
+type LeaseExtension struct {
+	// Path.
+	Path string
+
+	// Ticket ID.
+	Id int64
+
+	// Lease timeout.
+	//
+	// InfiniteTimeout extends the lease to never expire.
+	Timeout time.Duration
+}
+
+// Lease extension result.
+type LeaseExtensionResult struct {
+	// Whether the lease was found.
+	Found bool
+
+	// Whether the lease timeout was changed.
+	Changed bool
+
+	// Error.
+	//
+	// Set if the lease could not be extended, such as if the path is invalid, or the timeout is rejected by the timeout
+	// policy.
+	Err error
+}
+
+// Sort lock paths.
+//
+// Cleans and validates the paths, returning them in acquisition order without duplicates.
+func sortPaths(validator PathValidator, paths []string) ([]string, error) {
+	sorted := make([]string, 0, len(paths))
+	seen := make(map[string]struct{}, len(paths))
+
+	for _, path := range paths {
+		path, err := validator.Validate(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := seen[path]; !ok {
+			seen[path] = struct{}{}
+			sorted = append(sorted, path)
+		}
+	}
+
+	sort.Strings(sorted)
+
+	return sorted, nil
+}
+
+func (m *managerImpl) AcquireMulti(paths []string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) ([]Ticket, error) {
+	return acquireMulti(m, m.pathValidator, m.clock, paths, lockTimeout, leaseTimeout, options)
+}
+
+// Acquire multiple locks of a manager.
+//
+// Acquires the locks one at a time by the manager, as per Manager.AcquireMulti, with the paths cleaned and validated
+// by the given validator, and the lock timeout shared by the given clock.
+func acquireMulti(m Manager, validator PathValidator, clock Clock, paths []string, lockTimeout time.Duration, leaseTimeout time.Duration, options []AcquireOptions) ([]Ticket, error) {
+	sorted, err := sortPaths(validator, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Acquire the locks one at a time in sorted order, sharing the lock timeout.
+	acquireTimeoutAt := clock.Monotonic() + lockTimeout
+	tickets := make(map[string]Ticket, len(sorted))
+
+	for _, path := range sorted {
+		ticket, err := m.Acquire(path, acquireTimeoutAt-clock.Monotonic(), leaseTimeout, options...)
+		if err == nil && <-ticket.Acquired() {
+			tickets[path] = ticket
+			continue
+		}
+
+		// Roll back the locks acquired so far.
+		for prevPath, prevTicket := range tickets {
+			m.Release(prevPath, prevTicket.Id())
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, &AcquireMultiError{
+			Path: path,
+		}
+	}
+
+	// Return the tickets in the order of the requested paths.
+	result := make([]Ticket, len(paths))
+	for idx, path := range paths {
+		path, _ = validator.Validate(path)
+		result[idx] = tickets[path]
+	}
+
+	return result, nil
+}
+
+func (m *managerImpl) ExtendMulti(extensions []LeaseExtension) []LeaseExtensionResult {
+	results := make([]LeaseExtensionResult, len(extensions))
+
+	// Clean and validate the paths, and limit the timeouts to the configured range.
+	paths := make([]string, len(extensions))
+	timeouts := make([]time.Duration, len(extensions))
+
+	for idx, extension := range extensions {
+		if paths[idx], results[idx].Err = m.pathValidator.Validate(extension.Path); results[idx].Err != nil {
+			continue
+		}
+
+		timeouts[idx], results[idx].Err = m.timeoutLimits.limitLease(extension.Timeout)
+	}
+
+	// Extend the leases, locking one path at a time.
+	for idx, extension := range extensions {
+		if results[idx].Err != nil {
+			continue
+		}
+
+		results[idx].Found, results[idx].Changed, results[idx].Err = m.extendLease(paths[idx], extension.Id, timeouts[idx])
+	}
+
+	return results
+}
+
+// Extend the lease of a holder as part of extending many leases.
+//
+// Returns whether the holder was found, and whether its lease changed.
+func (m *managerImpl) extendLease(path string, id int64, timeout time.Duration) (bool, bool, error) {
+	// Lock the path.
+	m.lockPath(path)
+	defer m.unlockPath(path)
+
+	holder := m.holderOf(path, id)
+	if holder == nil {
+		return false, false, nil
+	}
+
+	changed, err := m.applyLease(path, holder, m.namespaceOf(path).capLease(timeout), false)
+
+	return true, changed, err
+}
@@ -0,0 +1,78 @@
+package locking
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Lock queue is full.
+//
+// The acquisition would have to wait behind more acquisitions than the queue depth of the namespace allows.
+var ErrQueueFull = errors.New("lock queue is full")
+
+// Namespace configuration.
+//
+// Overrides the limits of the locks within a namespace. The zero value imposes no limits.
+type NamespaceConfig struct {
+	// Maximum queue depth.
+	//
+	// The maximum number of acquisitions waiting for a lock of the namespace. Acquisitions that would have to wait
+	// beyond it fail with ErrQueueFull instead. Zero disables the limit.
+	MaxQueueDepth int
+
+	// Maximum lease timeout.
+	//
+	// Lease timeouts of the locks of the namespace are capped to it when acquiring and extending, including infinite
+	// lease timeouts. Zero disables the cap.
+	MaxLeaseTimeout time.Duration
+
+	// Semaphore capacity.
+	//
+	// Locks of the namespace created by acquisitions not specifying a capacity are semaphores of the capacity, limiting
+	// the number of tickets holding them in shared mode at a time. Zero disables the limit.
+	Capacity int
+}
+
+// Namespace state.
+type NamespaceState struct {
+	// Name.
+	//
+	// Empty for the default namespace.
+	Name string
+
+	// Configuration in effect.
+	Config NamespaceConfig
+
+	// Number of held locks.
+	Locks int
+}
+
+// Namespace of a lock path.
+//
+// The namespace of a path is its first segment, if the path has more than one segment. Paths of a single segment
+// belong to the default namespace, which is named by the empty string, so paths predating namespaces are unaffected.
+// Raw key paths belong to the default namespace as well, as their keys are opaque.
+func PathNamespace(path string) string {
+	if _, ok := RawKey(path); ok {
+		return ""
+	}
+
+	namespace, _, ok := strings.Cut(path, "/")
+	if !ok {
+		return ""
+	}
+
+	return namespace
+}
+
+// Cap a lease timeout.
+//
+// Caps the lease timeout to the maximum lease timeout of the namespace, if any.
+func (c NamespaceConfig) capLease(leaseTimeout time.Duration) time.Duration {
+	if c.MaxLeaseTimeout > 0 && (leaseTimeout < 0 || leaseTimeout > c.MaxLeaseTimeout) {
+		return c.MaxLeaseTimeout
+	}
+
+	return leaseTimeout
+}
@@ -0,0 +1,108 @@
+package locking
+
+import (
+	"errors"
+	"time"
+)
+
+// Lock acquisition options.
+type AcquireOptions struct {
+	// Lock mode.
+	//
+	// Defaults to exclusive.
+	Mode LockMode
+
+	// Owner identity.
+	//
+	// If set, an acquisition by the owner of a ticket already holding the lock re-enters the lock, rather than
+	// queueing. Owner identities are opaque to the manager, and are not required to be unique among holders of a
+	// shared lock. Defaults to no owner, in which case the lock is never re-entered.
+	Owner string
+
+	// Labels.
+	//
+	// Arbitrary metadata describing the acquirer, such as its host or job, surfaced when inspecting the lock. Labels
+	// are fixed when the ticket is created, so re-entering a lock retains the labels of the holder.
+	Labels map[string]string
+
+	// Semaphore capacity.
+	//
+	// If positive, a permit of the lock is acquired as a semaphore of the capacity: the lock is acquired in shared mode,
+	// and held by at most as many tickets at a time, while further acquisitions wait. The capacity of a lock is defined
+	// by the first acquisition specifying one, and retained until the lock is free of tickets. Acquisitions specifying
+	// another capacity meanwhile fail with ErrCapacityMismatch. Capacities are not journaled, so locks restored from a
+	// journal have no capacity until acquired with one again. Defaults to the capacity of the namespace, if any.
+	Capacity int
+}
+
+// Limits of acquisition metadata.
+const (
+	// Maximum length of an owner identity in bytes.
+	MaxOwnerLength = 256
+
+	// Maximum number of labels.
+	MaxLabels = 16
+
+	// Maximum length of a label key in bytes.
+	MaxLabelKeyLength = 64
+
+	// Maximum length of a label value in bytes.
+	MaxLabelValueLength = 256
+)
+
+// Metadata too large.
+//
+// Returned for acquisitions whose owner identity or labels exceed the metadata limits.
+var ErrMetadataTooLarge = errors.New("metadata too large")
+
+// Validate the metadata of acquisition options.
+func (o AcquireOptions) validateMetadata() error {
+	if len(o.Owner) > MaxOwnerLength || len(o.Labels) > MaxLabels {
+		return ErrMetadataTooLarge
+	}
+
+	for key, value := range o.Labels {
+		if len(key) > MaxLabelKeyLength || len(value) > MaxLabelValueLength {
+			return ErrMetadataTooLarge
+		}
+	}
+
+	return nil
+}
+
+// Resolve acquisition options.
+//
+// Returns the first of the optionally provided options, or the default options if none are provided.
+func resolveAcquireOptions(options []AcquireOptions) AcquireOptions {
+	var acquireOptions AcquireOptions
+	if len(options) > 0 {
+		acquireOptions = options[0]
+	}
+
+	// Permits of semaphores are held in shared mode.
+	if acquireOptions.Capacity > 0 {
+		acquireOptions.Mode = ModeShared
+	}
+
+	return acquireOptions
+}
+
+// Inspection options.
+type InspectOptions struct {
+	// Maximum number of acquirers.
+	//
+	// If positive, only the first acquirers waiting for the lock up to the limit are included in the lock state, which
+	// keeps inspecting locks with long queues cheap. The total number of acquirers is reported regardless. Defaults to
+	// including all acquirers.
+	AcquirersLimit int
+}
+
+// Extension options.
+type ExtendOptions struct {
+	// Minimum remaining lease.
+	//
+	// If positive, the lease is only extended if it remains for longer than the given duration, failing with
+	// ErrPreconditionFailed otherwise. This lets a holder avoid extending a lease that is about to expire, and may thus
+	// already be considered lost. Defaults to extending the lease unconditionally.
+	IfLeaseTimeoutGreaterThan time.Duration
+}
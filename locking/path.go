@@ -3,30 +3,235 @@ package locking
 import (
 	"errors"
 	"regexp"
+	"strings"
 )
 
+// Default path pattern.
+//
+// Paths consist of one or more slash separated segments of word characters and dashes, ie. [A-Za-z0-9_-].
+const DefaultPathPattern = `^[\w\-]+(?:\/[\w\-]+)*$`
+
 // Valid path expression.
-var validPathExpr = regexp.MustCompile(`^[\w\-]+(?:\/[\w\-]+)*$`)
+var validPathExpr = regexp.MustCompile(DefaultPathPattern)
 
 // Invalid path.
 var ErrPathInvalid = errors.New("invalid path")
 
+// Path exceeds the length or segment limits.
+var ErrPathTooLong = errors.New("path too long")
+
+const (
+	// Default maximum path length.
+	DefaultMaxPathLength = 1024
+
+	// Default maximum number of path segments.
+	DefaultMaxPathSegments = 32
+)
+
+// Raw key path prefix.
+//
+// The prefix of the lock paths of raw keys, see RawKeyPath.
+const RawKeyPrefix = "~//"
+
+// Path normalization mode.
+type PathNormalization int
+
+const (
+	// Strict path normalization.
+	//
+	// Only leading slashes are stripped from the path prior to validation. This is the default.
+	PathNormalizationStrict PathNormalization = iota
+
+	// Lenient path normalization.
+	//
+	// In addition to stripping leading slashes, repeated slashes within the path are squashed and `.` segments are
+	// collapsed prior to validation. `..` segments are always rejected, as they would otherwise introduce ambiguity
+	// in the lock hierarchy.
+	PathNormalizationLenient
+)
+
+// Path validator.
+//
+// Cleans and validates lock paths according to a set of rules. The zero value validates paths using strict
+// normalization.
+type PathValidator struct {
+	// Normalization mode.
+	Normalization PathNormalization
+
+	// Path pattern.
+	//
+	// The pattern that valid paths must match, which should be anchored to match paths in their entirety. Regardless
+	// of the pattern, paths with empty segments, such as trailing slashes, and `.` or `..` segments are always
+	// rejected, so a pattern cannot allow path traversal. Defaults to DefaultPathPattern.
+	Pattern *regexp.Regexp
+
+	// Maximum path length.
+	//
+	// The maximum length of a cleaned path in bytes. Longer paths result in ErrPathTooLong. Zero disables the limit,
+	// except for raw key paths, which are limited to DefaultMaxPathLength then.
+	MaxLength int
+
+	// Maximum number of path segments.
+	//
+	// Paths with more segments result in ErrPathTooLong. Zero disables the limit.
+	MaxSegments int
+
+	// Whether paths are already cleaned and validated, such as by a sharded manager routing them to a shard, and are
+	// thus accepted as they are.
+	validated bool
+}
+
 // Validate lock path.
 //
-// Cleans and validates the provided lock path, returning an error if the path is not valid.
+// Cleans and validates the provided lock path using strict normalization, returning an error if the path is not
+// valid.
 func ValidateLockPath(path string) (string, error) {
-	// Strip trailing slash.
+	return PathValidator{}.Validate(path)
+}
+
+// Validate lock path.
+//
+// Cleans and validates the provided lock path, returning an error if the path is not valid.
+func (v PathValidator) Validate(path string) (string, error) {
+	if v.validated {
+		return path, nil
+	}
+
+	// Strip leading slashes.
 	for len(path) > 0 && path[0] == '/' {
 		path = path[1:]
 	}
 
-	// Ensure that the path follows the following basic rule:
+	// Accept raw keys as they are, as they are opaque and thus only subject to the length limit.
+	if key, ok := RawKey(path); ok {
+		maxLength := v.MaxLength
+		if maxLength == 0 {
+			maxLength = DefaultMaxPathLength
+		}
+
+		if key == "" {
+			return path, ErrPathInvalid
+		}
+		if len(path) > maxLength {
+			return path, ErrPathTooLong
+		}
+
+		return path, nil
+	}
+
+	// Normalize the path segments if requested.
+	if v.Normalization == PathNormalizationLenient {
+		var err error
+		if path, err = normalizeLockPath(path); err != nil {
+			return path, err
+		}
+	}
+
+	// Ensure that the path is within the limits, before matching it any further.
+	if v.MaxLength > 0 && len(path) > v.MaxLength {
+		return path, ErrPathTooLong
+	}
+	if v.MaxSegments > 0 && strings.Count(path, "/")+1 > v.MaxSegments {
+		return path, ErrPathTooLong
+	}
+
+	// Ensure that the path follows the following basic rules:
 	//
 	// 1. It does not end in a trailing slash.
 	// 2. There are no empty path segments.
-	if !validPathExpr.MatchString(path) {
+	// 3. There are no `.` or `..` segments.
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return path, ErrPathInvalid
+		}
+	}
+
+	// Ensure that the path matches the pattern.
+	pattern := v.Pattern
+	if pattern == nil {
+		pattern = validPathExpr
+	}
+
+	if !pattern.MatchString(path) {
 		return path, ErrPathInvalid
 	}
 
 	return path, nil
 }
+
+// Validate inspect pattern.
+//
+// Cleans and validates the provided inspect pattern using strict normalization, returning an error if the pattern is
+// not valid. See PathValidator.ValidatePattern.
+func ValidateInspectPattern(pattern string) (string, error) {
+	return PathValidator{}.ValidatePattern(pattern)
+}
+
+// Validate inspect pattern.
+//
+// Cleans and validates the provided inspect pattern, returning an error if the pattern is not valid. A pattern is
+// either a valid lock path, or a valid lock path followed by a trailing /* wildcard segment, or a lone *. Patterns
+// are only meaningful for inspection, and are never valid lock paths themselves.
+func (v PathValidator) ValidatePattern(pattern string) (string, error) {
+	// Strip leading slashes.
+	for len(pattern) > 0 && pattern[0] == '/' {
+		pattern = pattern[1:]
+	}
+
+	if pattern == "*" {
+		return pattern, nil
+	}
+
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		prefix, err := v.Validate(prefix)
+		if err != nil {
+			return pattern, err
+		}
+
+		return prefix + "/*", nil
+	}
+
+	return v.Validate(pattern)
+}
+
+// Raw key path.
+//
+// Returns the lock path of an opaque key, which is not subject to path validation except for the length limit. The
+// paths of raw keys start with RawKeyPrefix, which contains an empty path segment that structured paths never do, so
+// raw keys share the locks of a manager with structured paths without colliding with them.
+func RawKeyPath(key string) string {
+	return RawKeyPrefix + key
+}
+
+// Raw key of a lock path.
+//
+// Returns the opaque key of a raw key path, and whether the path is a raw key path.
+func RawKey(path string) (string, bool) {
+	return strings.CutPrefix(path, RawKeyPrefix)
+}
+
+// Normalize lock path segments.
+//
+// Squashes empty and collapses `.` segments while rejecting `..` segments. Trailing slashes are retained, so as to
+// still be rejected by validation.
+func normalizeLockPath(path string) (string, error) {
+	segments := strings.Split(path, "/")
+	normalized := make([]string, 0, len(segments))
+
+	for idx, segment := range segments {
+		switch segment {
+		case "..":
+			return path, ErrPathInvalid
+		case ".":
+			continue
+		case "":
+			if idx < len(segments)-1 {
+				continue
+			}
+		}
+
+		normalized = append(normalized, segment)
+	}
+
+	return strings.Join(normalized, "/"), nil
+}
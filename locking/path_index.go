@@ -0,0 +1,55 @@
+package locking
+
+import (
+	"slices"
+	"strings"
+)
+
+// Path index.
+//
+// Keeps the paths of the held locks in sorted order, so ranges of paths sharing a prefix can be found by binary search
+// rather than by scanning every lock. Insertion and removal are linear in the number of paths, but only move memory.
+type pathIndex struct {
+	paths []string
+}
+
+// Insert a path.
+func (i *pathIndex) insert(path string) {
+	idx, found := slices.BinarySearch(i.paths, path)
+	if !found {
+		i.paths = slices.Insert(i.paths, idx, path)
+	}
+}
+
+// Remove a path.
+func (i *pathIndex) remove(path string) {
+	idx, found := slices.BinarySearch(i.paths, path)
+	if found {
+		i.paths = slices.Delete(i.paths, idx, idx+1)
+	}
+}
+
+// Range of paths.
+//
+// Returns the paths that start with the given prefix and sort after the given path, in sorted order, up to a limit of
+// paths. A limit that is not positive returns all such paths. Returns whether more paths remain beyond the limit. The
+// returned paths are shared with the index, and must not be retained beyond the exclusive lock of the manager.
+func (i *pathIndex) rangeOf(prefix string, after string, limit int) (paths []string, more bool) {
+	// Find the first path of the range, which is the first path after the given path, or the first path starting with
+	// the prefix, whichever sorts last. Paths sharing a prefix are contiguous.
+	start, _ := slices.BinarySearch(i.paths, max(prefix, after))
+	if start < len(i.paths) && i.paths[start] == after {
+		start++
+	}
+
+	end := start
+	for end < len(i.paths) && strings.HasPrefix(i.paths[end], prefix) {
+		if limit > 0 && end-start == limit {
+			return i.paths[start:end], true
+		}
+
+		end++
+	}
+
+	return i.paths[start:end], false
+}
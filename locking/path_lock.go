@@ -0,0 +1,59 @@
+package locking
+
+import (
+	"sync"
+)
+
+// Path locks.
+//
+// Mutexes of the paths currently operated on. The mutex of a path is created when the path is first locked, and
+// removed once it is neither locked nor awaited, so the mutexes are independent of whether the path has a lock, and
+// paths that are not operated on take no memory.
+type pathLocks struct {
+	sync    sync.Mutex
+	mutexes map[string]*pathMutex
+}
+
+// Mutex of a path.
+type pathMutex struct {
+	sync sync.Mutex
+
+	// Number of goroutines holding or awaiting the mutex.
+	refs int
+}
+
+// Lock a path.
+func (l *pathLocks) lock(path string) {
+	l.sync.Lock()
+
+	if l.mutexes == nil {
+		l.mutexes = make(map[string]*pathMutex)
+	}
+
+	mutex, ok := l.mutexes[path]
+	if !ok {
+		mutex = &pathMutex{}
+		l.mutexes[path] = mutex
+	}
+
+	mutex.refs++
+	l.sync.Unlock()
+
+	mutex.sync.Lock()
+}
+
+// Unlock a path.
+//
+// The path must be locked.
+func (l *pathLocks) unlock(path string) {
+	l.sync.Lock()
+
+	mutex := l.mutexes[path]
+	if mutex.refs--; mutex.refs == 0 {
+		delete(l.mutexes, path)
+	}
+
+	l.sync.Unlock()
+
+	mutex.sync.Unlock()
+}
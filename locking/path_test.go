@@ -1,6 +1,8 @@
 package locking
 
 import (
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -13,6 +15,8 @@ func TestValidateLockPath(t *testing.T) {
 		"a/b/c/",
 		"aø",
 		"aø/b",
+		"a//b",
+		"./a",
 	} {
 		_, err := ValidateLockPath(path)
 		if err != ErrPathInvalid {
@@ -35,3 +39,210 @@ func TestValidateLockPath(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateLockPathPattern(t *testing.T) {
+	dotted := regexp.MustCompile(`^[\w\-.@]+(?:/[\w\-.@]+)*$`)
+
+	for _, policy := range []struct {
+		Name         string
+		Validator    PathValidator
+		ValidPaths   map[string]string
+		InvalidPaths []string
+	}{
+		{
+			Name:      "default",
+			Validator: PathValidator{},
+			ValidPaths: map[string]string{
+				"a/b":   "a/b",
+				"/a-b":  "a-b",
+				"a_b/c": "a_b/c",
+			},
+			InvalidPaths: []string{"service.api/v1", "user@host", "a/..", "a/"},
+		},
+		{
+			Name:      "dotted",
+			Validator: PathValidator{Pattern: dotted},
+			ValidPaths: map[string]string{
+				"service.api/v1": "service.api/v1",
+				"/user@host":     "user@host",
+				"a..b/c":         "a..b/c",
+				".hidden":        ".hidden",
+			},
+			InvalidPaths: []string{"", "/", "a/", "a//b", ".", "./a", "a/.", "..", "a/..", "a/../b", "a b"},
+		},
+		{
+			Name:      "dotted lenient",
+			Validator: PathValidator{Pattern: dotted, Normalization: PathNormalizationLenient},
+			ValidPaths: map[string]string{
+				"service.api//v1": "service.api/v1",
+				"./user@host":     "user@host",
+			},
+			InvalidPaths: []string{"a/..", "../a", "a/"},
+		},
+	} {
+		for path, expectedPath := range policy.ValidPaths {
+			actualPath, err := policy.Validator.Validate(path)
+			if err != nil {
+				t.Errorf("Expected %s to be a valid path by %s policy", path, policy.Name)
+			} else if actualPath != expectedPath {
+				t.Errorf("Expected %s to be cleaned to %s by %s policy, but it was cleaned to %s", path, expectedPath, policy.Name, actualPath)
+			}
+		}
+
+		for _, path := range policy.InvalidPaths {
+			if _, err := policy.Validator.Validate(path); err != ErrPathInvalid {
+				t.Errorf("Expected %s to result in ErrPathInvalid by %s policy, got %v", path, policy.Name, err)
+			}
+		}
+	}
+}
+
+func TestValidateLockPathLimits(t *testing.T) {
+	validator := PathValidator{MaxLength: 16, MaxSegments: 4}
+
+	// Test paths at the limits.
+	for _, path := range []string{
+		strings.Repeat("a", 16),
+		"/" + strings.Repeat("a", 16),
+		"a/b/c/d",
+		"aaaa/bbbb/cc/ddd",
+	} {
+		if _, err := validator.Validate(path); err != nil {
+			t.Errorf("Expected %s to be a valid path, got %v", path, err)
+		}
+	}
+
+	// Test paths beyond the limits.
+	for _, path := range []string{
+		strings.Repeat("a", 17),
+		"a/b/c/d/e",
+		"aaaa/bbbb/ccc/ddd",
+	} {
+		if _, err := validator.Validate(path); err != ErrPathTooLong {
+			t.Errorf("Expected %s to result in ErrPathTooLong, got %v", path, err)
+		}
+	}
+
+	// Test that zero disables the limits.
+	if _, err := (PathValidator{}).Validate(strings.Repeat("a/", 64) + "a"); err != nil {
+		t.Errorf("Expected path to be valid without limits, got %v", err)
+	}
+}
+
+func TestValidateLockPathLenient(t *testing.T) {
+	validator := PathValidator{Normalization: PathNormalizationLenient}
+
+	// Test invalid paths.
+	for _, path := range []string{
+		"",
+		"/",
+		".",
+		"./",
+		"a/",
+		"a//",
+		"a/./",
+		"..",
+		"a/..",
+		"a/../b",
+		"../a",
+		"aø",
+	} {
+		_, err := validator.Validate(path)
+		if err != ErrPathInvalid {
+			t.Errorf("Expected %s to result in ErrPathInvalid, got %v", path, err)
+		}
+	}
+
+	// Test valid paths.
+	for path, expectedPath := range map[string]string{
+		"a":         "a",
+		"//a":       "a",
+		"a-b-c/095": "a-b-c/095",
+		"a//b":      "a/b",
+		"a///b//c":  "a/b/c",
+		"./a":       "a",
+		"a/./b":     "a/b",
+		"a/.":       "a",
+		"/./a/.//b": "a/b",
+	} {
+		actualPath, err := validator.Validate(path)
+		if err != nil {
+			t.Errorf("Expected %s to be a valid path", path)
+		} else if actualPath != expectedPath {
+			t.Errorf("Expected %s to be cleaned to %s, but it was cleaned to %s", path, expectedPath, actualPath)
+		}
+	}
+}
+
+func TestValidateInspectPattern(t *testing.T) {
+	// Test invalid patterns.
+	for _, pattern := range []string{
+		"",
+		"a/",
+		"a*",
+		"a/b*",
+		"*/a",
+		"a/*/b",
+		"a/**",
+		"a//*",
+	} {
+		_, err := ValidateInspectPattern(pattern)
+		if err != ErrPathInvalid {
+			t.Errorf("Expected %s to result in ErrPathInvalid, got %v", pattern, err)
+		}
+	}
+
+	// Test valid patterns.
+	for pattern, expectedPattern := range map[string]string{
+		"a":       "a",
+		"*":       "*",
+		"/*":      "*",
+		"a/*":     "a/*",
+		"//a/b/*": "a/b/*",
+	} {
+		actualPattern, err := ValidateInspectPattern(pattern)
+		if err != nil {
+			t.Errorf("Expected %s to be a valid pattern", pattern)
+		} else if actualPattern != expectedPattern {
+			t.Errorf("Expected %s to be cleaned to %s, but it was cleaned to %s", pattern, expectedPattern, actualPattern)
+		}
+	}
+
+	// Test that patterns are never valid lock paths.
+	if _, err := ValidateLockPath("a/*"); err != ErrPathInvalid {
+		t.Errorf("Expected wildcard to be an invalid lock path, got %v", err)
+	}
+}
+
+func TestValidateRawKeyPath(t *testing.T) {
+	validator := PathValidator{Pattern: regexp.MustCompile(`^[a-z/]+$`), MaxLength: 16, MaxSegments: 2}
+
+	// Test that raw keys bypass the pattern and segment limits, but not the length limit.
+	for _, key := range []string{"a b", "/x/../y/", strings.Repeat("/", 13)} {
+		path, err := validator.Validate("/" + RawKeyPath(key))
+		if err != nil {
+			t.Errorf("Expected raw key %q to be valid, got %v", key, err)
+		} else if rawKey, ok := RawKey(path); !ok || rawKey != key {
+			t.Errorf("Expected path %q to be of raw key %q", path, key)
+		}
+	}
+
+	if _, err := validator.Validate(RawKeyPath(strings.Repeat("a", 14))); err != ErrPathTooLong {
+		t.Errorf("Expected raw key beyond the limit to result in ErrPathTooLong, got %v", err)
+	}
+	if _, err := (PathValidator{}).Validate(RawKeyPath(strings.Repeat("a", DefaultMaxPathLength))); err != ErrPathTooLong {
+		t.Errorf("Expected raw key beyond the default limit to result in ErrPathTooLong, got %v", err)
+	}
+	if _, err := validator.Validate(RawKeyPath("")); err != ErrPathInvalid {
+		t.Errorf("Expected empty raw key to result in ErrPathInvalid, got %v", err)
+	}
+
+	// Test that structured paths never resolve to raw key paths.
+	lenient := PathValidator{Normalization: PathNormalizationLenient, Pattern: regexp.MustCompile(`^.+$`)}
+	if path, err := lenient.Validate("~/a"); err != nil || path != "~/a" {
+		t.Errorf("Expected ~/a to remain a structured path, got %q, %v", path, err)
+	}
+	if ns := PathNamespace(RawKeyPath("a/b")); ns != "" {
+		t.Errorf("Expected raw key to belong to the default namespace, got %q", ns)
+	}
+}
@@ -0,0 +1,56 @@
+package locking
+
+import (
+	"cmp"
+	"errors"
+)
+
+// Capacity mismatch.
+//
+// Returned for acquisitions specifying a capacity other than that of the semaphore they acquire a permit of.
+var ErrCapacityMismatch = errors.New("capacity differs from that of the semaphore")
+
+// Lock to evaluate an acquisition against, carrying the capacity of the semaphore.
+//
+// The capacity of a lock is defined by the first acquisition specifying one, or, for locks created by acquisitions not
+// specifying one, by the namespace, and is retained for as long as the lock exists. The returned lock is only a copy
+// of the existing lock carrying its capacity, which holding or enqueueing the acquisition stores, and is nil if the lock
+// does not exist and has no capacity. This assumes lock to the path is provided during the process.
+func semaphoreOf(prevLock *lockImpl, namespace NamespaceConfig, capacity int) (*lockImpl, error) {
+	if prevLock == nil {
+		if capacity = cmp.Or(capacity, namespace.Capacity); capacity <= 0 {
+			return nil, nil
+		}
+
+		return &lockImpl{capacity: capacity}, nil
+	}
+
+	if capacity <= 0 || capacity == prevLock.capacity {
+		return prevLock, nil
+	}
+
+	if prevLock.capacity > 0 {
+		return nil, ErrCapacityMismatch
+	}
+
+	return &lockImpl{
+		tickets:    prevLock.tickets,
+		fence:      prevLock.fence,
+		generation: prevLock.generation,
+		span:       prevLock.span,
+		capacity:   capacity,
+	}, nil
+}
+
+// Remaining permits of a semaphore.
+//
+// The number of further shared holders the lock admits, as long as no tickets wait for it. Zero if the lock is not a
+// semaphore, or is held exclusively.
+func (l *lockImpl) permits() int {
+	holderCount := l.holderCount()
+	if l.capacity <= 0 || (holderCount > 0 && l.tickets[0].mode == ModeExclusive) {
+		return 0
+	}
+
+	return max(l.capacity-holderCount, 0)
+}
@@ -0,0 +1,675 @@
+package locking
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"maps"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sharding does not support stores.
+//
+// Returned when creating a manager of multiple shards with a lock store configured, as shards cannot share a store.
+var ErrShardedStore = errors.New("sharded managers do not support lock stores")
+
+// Sharding does not support journaling.
+//
+// Returned when creating a manager of multiple shards with a journal or write-ahead log configured.
+var ErrShardedJournal = errors.New("sharded managers do not support journaling")
+
+// Sharded lock manager.
+//
+// Distributes the paths across multiple independent managers, the shards, by consistent hashing of the cleaned paths,
+// so operations on paths of different shards never contend for the same lock. Operations on a path are served by its
+// shard, while operations spanning all paths fan out to every shard and merge their results. Statistics and
+// inspections of all locks are thus merged from snapshots of each shard taken one after another, while snapshots of
+// the locks are taken, and restored, with every shard locked at once, as are deadlocks detected and aborted across the
+// shards.
+type shardedManager struct {
+	shards         []*managerImpl
+	pathValidator  PathValidator
+	logger         *slog.Logger
+	abortDeadlocks bool
+
+	sync     sync.Mutex
+	stopChan chan struct{}
+}
+
+// New sharded lock manager.
+func newShardedManager(config Config) (Manager, error) {
+	if config.Journal != nil || config.WALPath != "" {
+		return nil, ErrShardedJournal
+	}
+	if config.Store != nil {
+		return nil, ErrShardedStore
+	}
+
+	// Split the paths retaining audit history between the shards.
+	auditHistoryPaths := config.AuditHistoryPaths
+	if auditHistoryPaths <= 0 {
+		auditHistoryPaths = DefaultAuditHistoryPaths
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	m := &shardedManager{
+		shards:         make([]*managerImpl, config.Shards),
+		logger:         logger,
+		abortDeadlocks: config.AbortDeadlocks,
+	}
+
+	// Deadlocks may span shards, and are thus aborted by the sharded manager rather than by the shards.
+	for idx := range m.shards {
+		shardConfig := config
+		shardConfig.Shards = 0
+		shardConfig.AbortDeadlocks = false
+		shardConfig.AuditHistoryPaths = (auditHistoryPaths + config.Shards - 1) / config.Shards
+		shardConfig.Logger = logger.With("shard", idx)
+
+		shard, err := NewManager(shardConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		m.shards[idx] = shard.(*managerImpl)
+	}
+
+	// Validate the paths once before routing them, so the shards accept them as they are.
+	m.pathValidator = m.shards[0].pathValidator
+
+	for _, shard := range m.shards {
+		shard.pathValidator.validated = true
+	}
+
+	return m, nil
+}
+
+// Shard index of a cleaned path.
+//
+// Hashes the path to a shard by jump consistent hashing, so changing the number of shards only moves the paths of
+// the shards added or removed.
+func (m *shardedManager) shardIndex(path string) int {
+	hash := fnv.New64a()
+	hash.Write([]byte(path))
+	key := hash.Sum64()
+
+	var bucket, next int64 = -1, 0
+	for next < int64(len(m.shards)) {
+		bucket = next
+		key = key*2862933555777941757 + 1
+		next = int64(float64(bucket+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+
+	return int(bucket)
+}
+
+// Shard of a path.
+//
+// Cleans and validates the path, returning it along with the shard managing it.
+func (m *shardedManager) shardOf(path string) (*managerImpl, string, error) {
+	path, err := m.pathValidator.Validate(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return m.shards[m.shardIndex(path)], path, nil
+}
+
+// Lock all shards.
+//
+// Shards are locked in order, so concurrent locking of all shards cannot deadlock.
+func (m *shardedManager) lockShards() {
+	for _, shard := range m.shards {
+		shard.sync.Lock()
+	}
+}
+
+// Unlock all shards.
+//
+// Every shard is unlocked before invoking the callbacks queued by any of them, so callbacks calling back into the
+// manager cannot deadlock on a shard that is still locked.
+func (m *shardedManager) unlockShards() {
+	for _, shard := range m.shards {
+		shard.publishChanges()
+		shard.sync.Unlock()
+	}
+
+	for _, shard := range m.shards {
+		shard.dispatchCallbacks()
+	}
+}
+
+func (m *shardedManager) Start() {
+	for _, shard := range m.shards {
+		shard.Start()
+	}
+
+	m.sync.Lock()
+	defer m.sync.Unlock()
+
+	if m.stopChan != nil || !m.abortDeadlocks {
+		return
+	}
+
+	m.stopChan = make(chan struct{})
+
+	m.scheduleDeadlockAbortion(m.stopChan)
+}
+
+func (m *shardedManager) Stop() {
+	for _, shard := range m.shards {
+		shard.Stop()
+	}
+
+	m.sync.Lock()
+	defer m.sync.Unlock()
+
+	if m.stopChan != nil {
+		close(m.stopChan)
+		m.stopChan = nil
+	}
+}
+
+// Schedule the abortion of deadlocked acquisitions.
+//
+// Deadlocks are aborted at the maintenance interval of the shards, by their clock, unless stopped in the meantime.
+func (m *shardedManager) scheduleDeadlockAbortion(stopChan chan struct{}) {
+	m.shards[0].clock.AfterFunc(m.shards[0].maintenanceInterval, func() {
+		m.abortDeadlockedAcquisitions(stopChan)
+	})
+}
+
+// Abort deadlocked acquisitions across the shards, and schedule the next abortion, unless stopped.
+//
+// Like the maintenance of the shards, a panic is logged and the next abortion is scheduled nonetheless.
+func (m *shardedManager) abortDeadlockedAcquisitions(stopChan chan struct{}) {
+	select {
+	case <-stopChan:
+		return
+	default:
+	}
+
+	defer func() {
+		if panicked := recover(); panicked != nil {
+			m.logger.Error("Deadlock abortion panicked, restarting", "panic", panicked, "stack", string(debug.Stack()))
+		}
+
+		m.scheduleDeadlockAbortion(stopChan)
+	}()
+
+	m.lockShards()
+	defer m.unlockShards()
+
+	newWaitForGraph(m.shards).abortDeadlocks()
+}
+
+func (m *shardedManager) Acquire(path string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (Ticket, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return shard.Acquire(path, lockTimeout, leaseTimeout, options...)
+}
+
+func (m *shardedManager) AcquireContext(ctx context.Context, path string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (Ticket, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return shard.AcquireContext(ctx, path, lockTimeout, leaseTimeout, options...)
+}
+
+func (m *shardedManager) AcquireWithCancel(path string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (Ticket, func(), error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return shard.AcquireWithCancel(path, lockTimeout, leaseTimeout, options...)
+}
+
+func (m *shardedManager) AcquireOrExtend(ctx context.Context, path string, id int64, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) (Ticket, bool, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return shard.AcquireOrExtend(ctx, path, id, lockTimeout, leaseTimeout, options...)
+}
+
+func (m *shardedManager) AcquireMulti(paths []string, lockTimeout time.Duration, leaseTimeout time.Duration, options ...AcquireOptions) ([]Ticket, error) {
+	return acquireMulti(m, m.pathValidator, m.shards[0].clock, paths, lockTimeout, leaseTimeout, options)
+}
+
+func (m *shardedManager) TryAcquire(path string, leaseTimeout time.Duration, options ...AcquireOptions) (Ticket, bool, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return shard.TryAcquire(path, leaseTimeout, options...)
+}
+
+func (m *shardedManager) AcquireIfUnlocked(path string, leaseTimeout time.Duration, options ...AcquireOptions) (Ticket, bool, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return shard.AcquireIfUnlocked(path, leaseTimeout, options...)
+}
+
+func (m *shardedManager) Release(path string, id int64) (bool, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return false, err
+	}
+
+	return shard.Release(path, id)
+}
+
+func (m *shardedManager) ReleaseByOwner(owner string) (int, error) {
+	count := 0
+
+	for _, shard := range m.shards {
+		shardCount, err := shard.ReleaseByOwner(owner)
+		count += shardCount
+
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+func (m *shardedManager) ForceRelease(path string, clearQueue bool) ([]int64, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return shard.ForceRelease(path, clearQueue)
+}
+
+func (m *shardedManager) ReleaseMulti(path string, ids []int64) (map[int64]bool, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return shard.ReleaseMulti(path, ids)
+}
+
+func (m *shardedManager) Extend(path string, id int64, timeout time.Duration, options ...ExtendOptions) (bool, bool, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return false, false, err
+	}
+
+	return shard.Extend(path, id, timeout, options...)
+}
+
+func (m *shardedManager) ExtendMulti(extensions []LeaseExtension) []LeaseExtensionResult {
+	results := make([]LeaseExtensionResult, len(extensions))
+
+	// Group the extensions by shard, remembering their indices.
+	shardExtensions := make([][]LeaseExtension, len(m.shards))
+	shardIndices := make([][]int, len(m.shards))
+
+	for idx, extension := range extensions {
+		path, err := m.pathValidator.Validate(extension.Path)
+		if err != nil {
+			results[idx].Err = err
+			continue
+		}
+
+		shardIdx := m.shardIndex(path)
+		extension.Path = path
+
+		shardExtensions[shardIdx] = append(shardExtensions[shardIdx], extension)
+		shardIndices[shardIdx] = append(shardIndices[shardIdx], idx)
+	}
+
+	// Extend the leases of each shard at once.
+	for shardIdx, shard := range m.shards {
+		if len(shardExtensions[shardIdx]) == 0 {
+			continue
+		}
+
+		for idx, result := range shard.ExtendMulti(shardExtensions[shardIdx]) {
+			results[shardIndices[shardIdx][idx]] = result
+		}
+	}
+
+	return results
+}
+
+func (m *shardedManager) KeepAlive(ctx context.Context, path string, id int64, leaseTimeout time.Duration, interval time.Duration) (bool, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return false, err
+	}
+
+	return shard.KeepAlive(ctx, path, id, leaseTimeout, interval)
+}
+
+func (m *shardedManager) Shorten(path string, id int64, timeout time.Duration) (bool, bool, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return false, false, err
+	}
+
+	return shard.Shorten(path, id, timeout)
+}
+
+func (m *shardedManager) Downgrade(path string, id int64) (bool, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return false, err
+	}
+
+	return shard.Downgrade(path, id)
+}
+
+func (m *shardedManager) Upgrade(path string, id int64, lockTimeout time.Duration) (Ticket, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return shard.Upgrade(path, id, lockTimeout)
+}
+
+func (m *shardedManager) IsLocked(path string) ([]int64, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return shard.IsLocked(path)
+}
+
+func (m *shardedManager) QueuePosition(path string, id int64) (int, int, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return shard.QueuePosition(path, id)
+}
+
+func (m *shardedManager) Inspect(path string, options ...InspectOptions) (LockState, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return LockState{}, err
+	}
+
+	return shard.Inspect(path, options...)
+}
+
+func (m *shardedManager) InspectAll() (map[string]LockState, error) {
+	states := make(map[string]LockState)
+
+	for _, shard := range m.shards {
+		shardStates, err := shard.InspectAll()
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(states, shardStates)
+	}
+
+	return states, nil
+}
+
+func (m *shardedManager) InspectPattern(pattern string) (map[string]LockState, error) {
+	// Clean and validate the pattern.
+	pattern, err := m.pathValidator.ValidatePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// A pattern without a wildcard is a single path of a single shard.
+	if !strings.HasSuffix(pattern, "*") {
+		return m.shards[m.shardIndex(pattern)].InspectPattern(pattern)
+	}
+
+	states := make(map[string]LockState)
+
+	for _, shard := range m.shards {
+		shardStates, err := shard.InspectPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(states, shardStates)
+	}
+
+	return states, nil
+}
+
+func (m *shardedManager) InspectRange(prefix string, after string, limit int) (map[string]LockState, string, error) {
+	// Select up to the limit of paths of each shard, of which the first paths in order make up the range.
+	states := make(map[string]LockState)
+	more := false
+
+	for _, shard := range m.shards {
+		shardStates, next, err := shard.InspectRange(prefix, after, limit)
+		if err != nil {
+			return nil, "", err
+		}
+
+		maps.Copy(states, shardStates)
+		more = more || next != ""
+	}
+
+	// A shard has more paths remaining only if it makes up the whole range, so the range has more paths remaining if
+	// it exceeds the limit, or if any shard has.
+	if limit <= 0 || len(states) < limit || len(states) == limit && !more {
+		return states, "", nil
+	}
+
+	paths := slices.Sorted(maps.Keys(states))
+	for _, path := range paths[limit:] {
+		delete(states, path)
+	}
+
+	return states, paths[limit-1], nil
+}
+
+func (m *shardedManager) Subscribe(path string) (<-chan LockState, func(), error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return shard.Subscribe(path)
+}
+
+func (m *shardedManager) DefaultTimeouts() (time.Duration, time.Duration) {
+	return m.shards[0].DefaultTimeouts()
+}
+
+func (m *shardedManager) Stats() ManagerStats {
+	var stats ManagerStats
+
+	for idx, shard := range m.shards {
+		shardStats := shard.Stats()
+
+		stats.Paths += shardStats.Paths
+		stats.Holders += shardStats.Holders
+		stats.Acquirers += shardStats.Acquirers
+		stats.OldestLeaseAge = max(stats.OldestLeaseAge, shardStats.OldestLeaseAge)
+		stats.MaintainedPaths += shardStats.MaintainedPaths
+		stats.MaintenanceDuration = max(stats.MaintenanceDuration, shardStats.MaintenanceDuration)
+
+		// Report the shard lagging the furthest behind, or none having run yet, so lagging shards are not masked.
+		if idx == 0 || shardStats.LastMaintenance.Before(stats.LastMaintenance) {
+			stats.LastMaintenance = shardStats.LastMaintenance
+		}
+	}
+
+	return stats
+}
+
+func (m *shardedManager) HoldHistograms() []HoldHistogram {
+	var histograms []HoldHistogram
+	for _, shard := range m.shards {
+		histograms = append(histograms, shard.HoldHistograms()...)
+	}
+
+	if histograms == nil {
+		return nil
+	}
+
+	return mergeHoldHistograms(histograms)
+}
+
+func (m *shardedManager) Namespaces() ([]NamespaceState, error) {
+	// Sum the locks of each namespace across the shards.
+	namespaces := make(map[string]NamespaceState)
+
+	for _, shard := range m.shards {
+		shardNamespaces, err := shard.Namespaces()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, namespace := range shardNamespaces {
+			namespace.Locks += namespaces[namespace.Name].Locks
+			namespaces[namespace.Name] = namespace
+		}
+	}
+
+	result := make([]NamespaceState, 0, len(namespaces))
+	for _, name := range slices.Sorted(maps.Keys(namespaces)) {
+		result = append(result, namespaces[name])
+	}
+
+	return result, nil
+}
+
+func (m *shardedManager) History(path string) ([]AuditEvent, error) {
+	shard, path, err := m.shardOf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return shard.History(path)
+}
+
+func (m *shardedManager) DetectDeadlocks() ([][]int64, error) {
+	// Detect deadlocks across the shards with every shard locked at once.
+	m.lockShards()
+	defer m.unlockShards()
+
+	return newWaitForGraph(m.shards).deadlockIds(), nil
+}
+
+func (m *shardedManager) Drain(ctx context.Context) error {
+	// Drain the shards concurrently, so every shard refuses acquisitions at once.
+	errs := make(chan error, len(m.shards))
+
+	for _, shard := range m.shards {
+		go func() {
+			errs <- shard.Drain(ctx)
+		}()
+	}
+
+	var err error
+	for range m.shards {
+		if shardErr := <-errs; shardErr != nil {
+			err = shardErr
+		}
+	}
+
+	return err
+}
+
+func (m *shardedManager) AnnounceShutdown(grace time.Duration) {
+	for _, shard := range m.shards {
+		shard.AnnounceShutdown(grace)
+	}
+}
+
+// Shutdown announcement.
+//
+// Shutdown is announced to every shard alike, so the announcement of the first shard stands for all of them.
+func (m *shardedManager) ShutdownAnnounced() <-chan struct{} {
+	return m.shards[0].ShutdownAnnounced()
+}
+
+func (m *shardedManager) ShutdownDeadline() time.Time {
+	return m.shards[0].ShutdownDeadline()
+}
+
+func (m *shardedManager) Snapshot() ([]byte, error) {
+	// Snapshot every shard at once.
+	m.lockShards()
+
+	clock := m.shards[0].clock
+	now := clock.Monotonic()
+	var locks []snapshotLock
+
+	for _, shard := range m.shards {
+		locks = append(locks, shard.snapshotLocks(now)...)
+	}
+
+	m.unlockShards()
+
+	slices.SortFunc(locks, func(a, b snapshotLock) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return marshalSnapshot(locks, clock.Now())
+}
+
+func (m *shardedManager) Restore(data []byte) error {
+	locks, err := parseSnapshot(m.pathValidator, data, m.shards[0].clock.Now())
+	if err != nil {
+		return err
+	}
+
+	// Split the locks by shard.
+	shardLocks := make([][]snapshotLock, len(m.shards))
+	for _, lock := range locks {
+		shardIdx := m.shardIndex(lock.Path)
+		shardLocks[shardIdx] = append(shardLocks[shardIdx], lock)
+	}
+
+	// Restore the locks with every shard locked, so no locks are restored if any shard conflicts.
+	m.lockShards()
+	defer m.unlockShards()
+
+	for shardIdx, shard := range m.shards {
+		if err := shard.checkRestore(shardLocks[shardIdx]); err != nil {
+			return err
+		}
+	}
+
+	for shardIdx, shard := range m.shards {
+		if err := shard.restoreLocks(shardLocks[shardIdx]); err != nil {
+			return err
+		}
+	}
+
+	m.logger.Info("Restored locks from snapshot", "locks", len(locks))
+
+	return nil
+}
+
+func (m *shardedManager) ValidatePath(path string) (string, error) {
+	return m.pathValidator.Validate(path)
+}
@@ -0,0 +1,259 @@
+package locking
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardedManager(t *testing.T) {
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Shards: 4})
+	manager.Start()
+	defer manager.Stop()
+
+	// Acquire locks across the shards.
+	tickets := make(map[string]Ticket)
+
+	for i := 0; i < 50; i++ {
+		path := fmt.Sprintf("ns/%02d", i)
+		ticket, err := manager.Acquire("/"+path, timeScale, 100*timeScale)
+		if err != nil {
+			t.Fatalf("Unexpected error acquiring lock: %v", err)
+		}
+
+		AssertTicketAcquired(t, ticket, true)
+		AssertPathLockedBy(t, manager, path, ticket.Id())
+		tickets[path] = ticket
+	}
+
+	// Assert that every shard manages some of the paths.
+	for idx, shard := range manager.(*shardedManager).shards {
+		if len(shard.locks) == 0 {
+			t.Errorf("Expected shard %d to manage locks", idx)
+		}
+	}
+
+	// Test that inspecting merges the locks of all shards.
+	if states, _ := manager.InspectAll(); len(states) != 50 {
+		t.Errorf("Expected 50 locks, got %d", len(states))
+	}
+	if states, _ := manager.InspectPattern("ns/*"); len(states) != 50 {
+		t.Errorf("Expected 50 locks matching pattern, got %d", len(states))
+	}
+	if states, _ := manager.InspectPattern("ns/07"); len(states) != 1 {
+		t.Errorf("Expected 1 lock matching path, got %d", len(states))
+	}
+
+	var paths []string
+	after := ""
+
+	for {
+		states, next, _ := manager.InspectRange("ns/", after, 10)
+		if len(states) > 10 {
+			t.Fatalf("Expected at most 10 locks, got %d", len(states))
+		}
+
+		paths = append(paths, slices.Sorted(maps.Keys(states))...)
+		if next == "" {
+			break
+		}
+
+		after = next
+	}
+
+	if len(paths) != 50 || !slices.IsSorted(paths) {
+		t.Errorf("Expected ranges to cover all 50 locks in order, got %v", paths)
+	}
+
+	if stats := manager.Stats(); stats.Paths != 50 || stats.Holders != 50 {
+		t.Errorf("Expected 50 paths and holders, got %+v", stats)
+	}
+
+	if namespaces, _ := manager.Namespaces(); len(namespaces) != 2 || namespaces[1].Name != "ns" || namespaces[1].Locks != 50 {
+		t.Errorf("Expected 50 locks in namespace ns, got %+v", namespaces)
+	}
+
+	// Test extending leases across the shards.
+	results := manager.ExtendMulti([]LeaseExtension{
+		{Path: "ns/01", Id: tickets["ns/01"].Id(), Timeout: 200 * timeScale},
+		{Path: "/", Id: 1, Timeout: timeScale},
+		{Path: "ns/02", Id: tickets["ns/02"].Id(), Timeout: 200 * timeScale},
+	})
+
+	if !results[0].Found || !results[0].Changed || results[1].Err != ErrPathInvalid || !results[2].Found || !results[2].Changed {
+		t.Errorf("Unexpected extension results %+v", results)
+	}
+
+	// Test that a snapshot restores to a manager of another number of shards, and that conflicts restore no locks.
+	data, err := manager.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+
+	restored, _ := NewManager(Config{MaintenanceInterval: timeScale, Shards: 3})
+	conflicting, _, _ := restored.TryAcquire("ns/49", timeScale)
+
+	if err := restored.Restore(data); err != ErrSnapshotConflict {
+		t.Fatalf("Expected ErrSnapshotConflict, got %v", err)
+	}
+	if states, _ := restored.InspectAll(); len(states) != 1 {
+		t.Fatalf("Expected no locks to be restored, got %d locks", len(states))
+	}
+
+	restored.Release("ns/49", conflicting.Id())
+
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+
+	for path, ticket := range tickets {
+		AssertPathLockedBy(t, restored, path, ticket.Id())
+	}
+
+	// Test releasing the locks.
+	for path, ticket := range tickets {
+		if found, _ := manager.Release(path, ticket.Id()); !found {
+			t.Errorf("Expected lock %s to be released", path)
+		}
+	}
+
+	if stats := manager.Stats(); stats.Paths != 0 {
+		t.Errorf("Expected no paths, got %+v", stats)
+	}
+}
+
+func TestShardedManagerJournal(t *testing.T) {
+	_, err := NewManager(Config{Shards: 2, WALPath: filepath.Join(t.TempDir(), "wal")})
+	if err != ErrShardedJournal {
+		t.Fatalf("Expected ErrShardedJournal, got %v", err)
+	}
+}
+
+func TestShardedManagerHoldHistograms(t *testing.T) {
+	manager, _ := NewManager(Config{Shards: 4, HoldHistogram: HoldHistogramAggregate})
+
+	for idx := 0; idx < 16; idx++ {
+		path := fmt.Sprintf("path-%d", idx)
+		ticket, _ := manager.Acquire(path, 0, time.Minute)
+		manager.Release(path, ticket.Id())
+	}
+
+	// Test that the histograms of the shards are merged.
+	histograms := manager.HoldHistograms()
+	if len(histograms) != 1 || histograms[0].Count != 16 || histograms[0].Counts[0] != 16 {
+		t.Fatalf("Expected a single histogram of 16 durations, got %+v", histograms)
+	}
+}
+
+func TestShardedManagerDeadlocks(t *testing.T) {
+	clock := NewMockClock(time.Unix(0, 0))
+	manager, _ := NewManager(Config{MaintenanceInterval: timeScale, Clock: clock, Shards: 8, AbortDeadlocks: true})
+
+	sharded := manager.(*shardedManager)
+	if sharded.shardIndex("p1") == sharded.shardIndex("p2") {
+		t.Fatalf("Expected paths of different shards")
+	}
+
+	ownerA := AcquireOptions{Owner: "worker-a"}
+	ownerB := AcquireOptions{Owner: "worker-b"}
+
+	manager.Acquire("p1", 10*timeScale, 10*timeScale, ownerA)
+	manager.Acquire("p2", 10*timeScale, 10*timeScale, ownerB)
+
+	ticketA, _ := manager.Acquire("p2", 10*timeScale, 10*timeScale, ownerA)
+	ticketB, _ := manager.Acquire("p1", 10*timeScale, 10*timeScale, ownerB)
+
+	// Test that deadlocks spanning shards are detected.
+	ids := []int64{ticketA.Id(), ticketB.Id()}
+	slices.Sort(ids)
+
+	deadlocks, _ := manager.DetectDeadlocks()
+	if fmt.Sprint(deadlocks) != fmt.Sprint([][]int64{ids}) {
+		t.Fatalf("Expected deadlock of %v, got %v", ids, deadlocks)
+	}
+
+	// Test that deadlocks spanning shards are aborted.
+	manager.Start()
+	defer manager.Stop()
+
+	clock.Advance(2 * timeScale)
+
+	youngest, oldest := ticketA, ticketB
+	if ticketB.Id() > ticketA.Id() {
+		youngest, oldest = ticketB, ticketA
+	}
+
+	AssertTicketAcquired(t, youngest, false)
+	AssertTicketWaiting(t, oldest)
+
+	if deadlocks, _ := manager.DetectDeadlocks(); len(deadlocks) != 0 {
+		t.Fatalf("Expected no deadlocks, got %v", deadlocks)
+	}
+}
+
+func TestShardedManagerStore(t *testing.T) {
+	_, err := NewManager(Config{Shards: 2, Store: NewMemoryStore()})
+	if err != ErrShardedStore {
+		t.Fatalf("Expected ErrShardedStore, got %v", err)
+	}
+}
+
+func TestShardIndexConsistent(t *testing.T) {
+	managerA, _ := NewManager(Config{Shards: 4})
+	managerB, _ := NewManager(Config{Shards: 5})
+
+	// Test that adding a shard only moves paths to the new shard.
+	moved := 0
+
+	for i := 0; i < 1000; i++ {
+		path := fmt.Sprintf("path/%d", i)
+		shardA := managerA.(*shardedManager).shardIndex(path)
+		shardB := managerB.(*shardedManager).shardIndex(path)
+
+		if shardA != shardB {
+			if shardB != 4 {
+				t.Fatalf("Expected path %s to move to the new shard, got shard %d", path, shardB)
+			}
+
+			moved++
+		}
+	}
+
+	if moved < 100 || moved > 300 {
+		t.Errorf("Expected about a fifth of the paths to move, got %d", moved)
+	}
+}
+
+// Benchmark the contention of concurrent acquisitions of different paths.
+//
+// Every goroutine acquires and releases its own paths, so acquisitions only contend for the manager. Leases never
+// expire, so no maintenance is scheduled.
+func BenchmarkManagerContention(b *testing.B) {
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			manager, _ := NewManager(Config{Shards: shards})
+			manager.Start()
+			defer manager.Stop()
+
+			var workers atomic.Int64
+
+			b.RunParallel(func(pb *testing.PB) {
+				worker := workers.Add(1)
+				i := 0
+
+				for pb.Next() {
+					path := fmt.Sprintf("worker-%d/%d", worker, i%64)
+					i++
+
+					ticket, _ := manager.Acquire(path, time.Second, InfiniteTimeout)
+					<-ticket.Acquired()
+					manager.Release(path, ticket.Id())
+				}
+			})
+		})
+	}
+}
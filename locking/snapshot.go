@@ -0,0 +1,289 @@
+package locking
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Snapshot format version.
+const snapshotVersion = 1
+
+var (
+	// Snapshot is malformed, inconsistent or of an unsupported version.
+	ErrSnapshotInvalid = errors.New("invalid snapshot")
+
+	// Snapshot conflicts with locks of the manager.
+	ErrSnapshotConflict = errors.New("snapshot conflicts with existing locks")
+)
+
+// Snapshot of the locks of a manager.
+//
+// Timeouts are recorded as the durations remaining when the snapshot was taken, as monotonic timestamps do not survive
+// a move to another process. The wall clock time at which the snapshot was taken is recorded alongside, so the time
+// elapsed until the snapshot is restored counts against the timeouts.
+type snapshot struct {
+	Version int            `json:"version"`
+	TakenAt int64          `json:"taken_at"`
+	Locks   []snapshotLock `json:"locks"`
+}
+
+// Snapshot of a lock.
+type snapshotLock struct {
+	Path    string           `json:"path"`
+	Fence   int64            `json:"fence"`
+	Tickets []snapshotTicket `json:"tickets"`
+}
+
+// Snapshot of a ticket.
+//
+// The lease timeout of a holder is the remainder of its lease, while the lease timeout of a waiting acquisition is the
+// lease it is granted once acquired, and its lock timeout is the remainder of its wait. Lease timeouts of leases that
+// never expire are negative.
+type snapshotTicket struct {
+	Id           int64             `json:"id"`
+	Mode         LockMode          `json:"mode"`
+	Held         bool              `json:"held,omitempty"`
+	Fence        int64             `json:"fence,omitempty"`
+	Owner        string            `json:"owner,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	HoldCount    int               `json:"hold_count,omitempty"`
+	LockTimeout  time.Duration     `json:"lock_timeout,omitempty"`
+	LeaseTimeout time.Duration     `json:"lease_timeout"`
+}
+
+func (m *managerImpl) Snapshot() ([]byte, error) {
+	// Lock the manager.
+	m.sync.Lock()
+	defer m.unlock()
+
+	return marshalSnapshot(m.snapshotLocks(m.clock.Monotonic()), m.clock.Now())
+}
+
+// Marshal a snapshot of the given locks, taken at the given time.
+func marshalSnapshot(locks []snapshotLock, now time.Time) ([]byte, error) {
+	return json.Marshal(snapshot{
+		Version: snapshotVersion,
+		TakenAt: now.UnixNano(),
+		Locks:   locks,
+	})
+}
+
+// Snapshot the locks.
+//
+// Records the locks in the order of their paths, and their tickets in queue order. This assumes exclusive lock to the
+// manager is provided during the process.
+func (m *managerImpl) snapshotLocks(now time.Duration) []snapshotLock {
+	locks := make([]snapshotLock, 0, len(m.paths.paths))
+
+	for _, path := range m.paths.paths {
+		lock := m.locks[path]
+		tickets := make([]snapshotTicket, len(lock.tickets))
+
+		for idx, ticket := range lock.tickets {
+			tickets[idx] = snapshotTicket{
+				Id:     ticket.id,
+				Mode:   ticket.mode,
+				Owner:  ticket.owner,
+				Labels: ticket.labels,
+			}
+
+			if ticket.leaseTimeoutAt > 0 {
+				tickets[idx].Held = true
+				tickets[idx].Fence = ticket.fence
+				tickets[idx].HoldCount = ticket.holdCount
+				tickets[idx].LeaseTimeout = ticket.leaseTimeoutAt - now
+				if ticket.leaseTimeoutAt == leaseNever {
+					tickets[idx].LeaseTimeout = InfiniteTimeout
+				}
+			} else {
+				tickets[idx].LockTimeout = ticket.acquireTimeoutAt - now
+				tickets[idx].LeaseTimeout = max(ticket.firstLeaseTimeout, InfiniteTimeout)
+			}
+		}
+
+		locks = append(locks, snapshotLock{
+			Path:    path,
+			Fence:   lock.fence,
+			Tickets: tickets,
+		})
+	}
+
+	return locks
+}
+
+func (m *managerImpl) Restore(data []byte) error {
+	locks, err := parseSnapshot(m.pathValidator, data, m.clock.Now())
+	if err != nil {
+		return err
+	}
+
+	// Lock the manager.
+	m.sync.Lock()
+	defer m.unlock()
+
+	if err := m.checkRestore(locks); err != nil {
+		return err
+	}
+
+	if err := m.restoreLocks(locks); err != nil {
+		return err
+	}
+
+	m.logger.Info("Restored locks from snapshot", "locks", len(locks))
+
+	return nil
+}
+
+// Parse a snapshot.
+//
+// Cleans and validates the paths of the locks of the snapshot by the given validator, and deducts the time elapsed since the snapshot was
+// taken from the timeouts of their tickets by the given current time, leaving out the tickets that have expired in the
+// meantime.
+func parseSnapshot(validator PathValidator, data []byte, now time.Time) ([]snapshotLock, error) {
+	var s snapshot
+
+	if err := json.Unmarshal(data, &s); err != nil || s.Version != snapshotVersion {
+		return nil, ErrSnapshotInvalid
+	}
+
+	// Deduct the time elapsed since the snapshot was taken from the timeouts, disregarding clocks running behind.
+	elapsed := max(time.Duration(now.UnixNano()-s.TakenAt), 0)
+
+	locks := make([]snapshotLock, 0, len(s.Locks))
+	paths := make(map[string]bool, len(s.Locks))
+
+	for _, lock := range s.Locks {
+		path, err := validator.Validate(lock.Path)
+		if err != nil || paths[path] || !validSnapshotTickets(lock.Tickets) {
+			return nil, ErrSnapshotInvalid
+		}
+		paths[path] = true
+
+		// Skip the tickets that have expired in the meantime.
+		tickets := make([]snapshotTicket, 0, len(lock.Tickets))
+
+		for _, ticket := range lock.Tickets {
+			if ticket.Held && ticket.LeaseTimeout >= 0 {
+				if ticket.LeaseTimeout -= elapsed; ticket.LeaseTimeout <= 0 {
+					continue
+				}
+			} else if !ticket.Held {
+				if ticket.LockTimeout -= elapsed; ticket.LockTimeout <= 0 {
+					continue
+				}
+			}
+
+			tickets = append(tickets, ticket)
+		}
+
+		if len(tickets) > 0 {
+			locks = append(locks, snapshotLock{
+				Path:    path,
+				Fence:   lock.Fence,
+				Tickets: tickets,
+			})
+		}
+	}
+
+	return locks, nil
+}
+
+// Check whether locks can be restored.
+//
+// Returns ErrDraining if the manager is draining, and ErrSnapshotConflict if the manager already has a lock of any of
+// the paths. This assumes exclusive lock to the manager is provided during the process.
+func (m *managerImpl) checkRestore(locks []snapshotLock) error {
+	if m.draining {
+		return ErrDraining
+	}
+
+	for _, lock := range locks {
+		if _, ok := m.locks[lock.Path]; ok {
+			return ErrSnapshotConflict
+		}
+	}
+
+	return nil
+}
+
+// Restore locks.
+//
+// Holders are journaled before their lock is restored, so a lock is left out if journaling fails, while the locks
+// restored before it remain. This assumes exclusive lock to the manager is provided during the process.
+func (m *managerImpl) restoreLocks(locks []snapshotLock) error {
+	now := m.clock.Monotonic()
+
+	for _, lock := range locks {
+		tickets := make([]*ticketImpl, len(lock.Tickets))
+
+		for idx, restored := range lock.Tickets {
+			ticket := newTicket(restored.Id, restored.Mode, restored.LeaseTimeout)
+			ticket.owner = restored.Owner
+			ticket.labels = restored.Labels
+			ticket.createdAt = now
+
+			if restored.Held {
+				ticket.fence = restored.Fence
+				ticket.holdCount = max(restored.HoldCount, 1)
+				ticket.acquiredAt = now
+				ticket.acquiredAtWall = m.clock.Now()
+				ticket.leaseTimeoutAt = leaseTimeoutAt(now, restored.LeaseTimeout)
+
+				if err := m.journalHold(lock.Path, ticket); err != nil {
+					return err
+				}
+				if ticket.holdCount > 1 {
+					if err := m.journalHoldCount(lock.Path, ticket.id, ticket.holdCount); err != nil {
+						return err
+					}
+				}
+
+				ticket.emit(TicketAcquired)
+				m.scheduleMaintenance(lock.Path, restored.LeaseTimeout)
+				m.nextFence = max(m.nextFence, ticket.fence)
+			} else {
+				ticket.acquireTimeoutAt = now + restored.LockTimeout
+				m.scheduleMaintenance(lock.Path, restored.LockTimeout)
+			}
+
+			tickets[idx] = ticket
+		}
+
+		m.setLock(lock.Path, &lockImpl{
+			tickets: tickets,
+			fence:   lock.Fence,
+		})
+		m.nextFence = max(m.nextFence, lock.Fence)
+
+		// Promote waiting acquisitions if all holders have expired in the meantime.
+		m.maintainPath(lock.Path)
+	}
+
+	return nil
+}
+
+// Validate the tickets of a lock snapshot.
+//
+// The holders must make up the head of the tickets, and be either a single exclusive holder or any number of shared
+// holders.
+func validSnapshotTickets(tickets []snapshotTicket) bool {
+	holderCount := 0
+	for holderCount < len(tickets) && tickets[holderCount].Held {
+		holderCount++
+	}
+
+	for idx, ticket := range tickets {
+		if ticket.Mode != ModeExclusive && ticket.Mode != ModeShared {
+			return false
+		}
+		if idx >= holderCount && ticket.Held {
+			return false
+		}
+		if idx < holderCount && holderCount > 1 && ticket.Mode != ModeShared {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,83 @@
+package locking
+
+import (
+	"time"
+)
+
+// Manager statistics.
+//
+// Aggregates the state of all locks at a single point in time.
+type ManagerStats struct {
+	// Number of paths with held locks.
+	Paths int
+
+	// Number of tickets holding locks.
+	//
+	// Exceeds the number of paths if locks are held in shared mode.
+	Holders int
+
+	// Number of waiting acquisitions.
+	Acquirers int
+
+	// Age of the oldest lease.
+	//
+	// The time elapsed since the longest standing holder of any lock acquired it, and zero if no locks are held.
+	OldestLeaseAge time.Duration
+
+	// Number of paths maintained by the last maintenance pass.
+	MaintainedPaths int
+
+	// Duration of the last maintenance pass.
+	MaintenanceDuration time.Duration
+
+	// Time of the last maintenance pass.
+	//
+	// The time at which the last maintenance pass completed, and zero if maintenance has not run yet. Maintenance runs
+	// at the maintenance interval while the manager is started, so a time lagging several intervals behind indicates
+	// maintenance is not keeping up.
+	LastMaintenance time.Time
+}
+
+// Record a maintenance pass.
+func (m *managerImpl) recordMaintenance(paths int, startedAt time.Time) {
+	m.maintenanceSync.Lock()
+	defer m.maintenanceSync.Unlock()
+
+	m.maintainedPaths = paths
+	m.maintainedAt = m.clock.Now()
+	m.maintenanceDuration = m.maintainedAt.Sub(startedAt)
+}
+
+func (m *managerImpl) HoldHistograms() []HoldHistogram {
+	return m.holdHistograms.snapshot()
+}
+
+func (m *managerImpl) Stats() ManagerStats {
+	// Lock the manager.
+	m.sync.Lock()
+	defer m.unlock()
+
+	// Aggregate the tickets of all locks.
+	now := m.clock.Monotonic()
+	stats := ManagerStats{Paths: len(m.locks)}
+
+	for _, lock := range m.locks {
+		holderCount := lock.holderCount()
+
+		stats.Holders += holderCount
+		stats.Acquirers += len(lock.tickets) - holderCount
+
+		for _, ticket := range lock.tickets[:holderCount] {
+			stats.OldestLeaseAge = max(stats.OldestLeaseAge, now-ticket.acquiredAt)
+		}
+	}
+
+	// Add the state of maintenance.
+	m.maintenanceSync.Lock()
+	stats.MaintainedPaths = m.maintainedPaths
+	stats.MaintenanceDuration = m.maintenanceDuration
+	stats.LastMaintenance = m.maintainedAt
+	m.maintenanceSync.Unlock()
+
+	return stats
+}
@@ -0,0 +1,93 @@
+package locking
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Lock store.
+//
+// Stores the locks of a manager, such as to persist them, so that a manager created subsequently restores their
+// holders. The manager serves its locks from memory, and writes the locks changed since its last write to the store in
+// batches, at the maintenance interval and once stopped, outside of the locks of the manager, so writes do not delay
+// its operations. Waiting acquisitions are not stored, as the acquirers waiting for them do not survive the manager
+// either. A store may not be shared between managers.
+type Store interface {
+	// Load the locks.
+	//
+	// Invoked once when the manager is created.
+	Load() ([]StoredLock, error)
+
+	// Write a batch of changed locks.
+	//
+	// Replaces the stored state of each lock, deleting locks without holders. Batches are written one at a time, and
+	// contain each path at most once. If a write fails, the manager logs the error and writes the locks again with
+	// the next batch, as of their latest change.
+	Write(locks []StoredLock) error
+}
+
+// Stored lock.
+//
+// The state of a lock as of its latest change. Lease timeouts are stored as wall clock timestamps, as monotonic
+// timestamps do not survive a restart.
+type StoredLock struct {
+	Path     string         `json:"path"`
+	Fence    int64          `json:"fence"`
+	Capacity int            `json:"capacity,omitempty"`
+	Holders  []StoredHolder `json:"holders,omitempty"`
+}
+
+// Stored holder of a lock.
+type StoredHolder struct {
+	Id         int64             `json:"id"`
+	Mode       LockMode          `json:"mode,omitempty"`
+	Fence      int64             `json:"fence"`
+	Owner      string            `json:"owner,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	HoldCount  int               `json:"hold_count"`
+	LeaseUntil int64             `json:"lease_until"`
+}
+
+// In-memory store.
+//
+// Stores the locks in a map, so they survive the manager, but not the process.
+type memoryStore struct {
+	sync  sync.Mutex
+	locks map[string]StoredLock
+}
+
+// New in-memory store.
+func NewMemoryStore() Store {
+	return &memoryStore{locks: make(map[string]StoredLock)}
+}
+
+func (s *memoryStore) Load() ([]StoredLock, error) {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+
+	return sortedStoredLocks(s.locks), nil
+}
+
+func (s *memoryStore) Write(locks []StoredLock) error {
+	s.sync.Lock()
+	defer s.sync.Unlock()
+
+	for _, lock := range locks {
+		if len(lock.Holders) == 0 {
+			delete(s.locks, lock.Path)
+		} else {
+			s.locks[lock.Path] = lock
+		}
+	}
+
+	return nil
+}
+
+// Stored locks sorted by path.
+func sortedStoredLocks(locks map[string]StoredLock) []StoredLock {
+	return slices.SortedFunc(maps.Values(locks), func(a, b StoredLock) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+}
@@ -0,0 +1,54 @@
+package locking
+
+// Lock state subscription.
+//
+// Delivers the state of a lock path on a channel buffering a single state. If the buffer is full when a new state is
+// delivered, the undelivered state is discarded in favor of the new state, so a slow consumer always observes the most
+// recent state.
+type subscription struct {
+	// State notification channel.
+	stateChan chan LockState
+
+	// Whether the state notification channel is closed.
+	stateChanClosed bool
+}
+
+// New subscription.
+func newSubscription() *subscription {
+	return &subscription{
+		stateChan: make(chan LockState, 1),
+	}
+}
+
+// Deliver a state.
+//
+// This assumes lock to the path is provided during the process, and thus that the manager is the only sender on the
+// subscription's channel.
+func (s *subscription) deliver(state LockState) {
+	if s.stateChanClosed {
+		return
+	}
+
+	select {
+	case s.stateChan <- state:
+	default:
+		select {
+		case <-s.stateChan:
+		default:
+		}
+
+		s.stateChan <- state
+	}
+}
+
+// Close the subscription.
+//
+// This assumes lock to the path is provided during the process.
+func (s *subscription) close() {
+	if s.stateChanClosed {
+		return
+	}
+
+	close(s.stateChan)
+	s.stateChanClosed = true
+}
@@ -1,9 +1,82 @@
 package locking
 
 import (
+	"math"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Infinite timeout.
+//
+// A lease timeout that results in a lease that never expires. Any negative lease timeout is treated as infinite.
+const InfiniteTimeout time.Duration = -1
+
+// Lease timeout of a lease that never expires, as a monotonic timestamp.
+const leaseNever = time.Duration(math.MaxInt64)
+
+// Lease timeout as a monotonic timestamp.
+//
+// Returns the monotonic timestamp at which a lease with the given timeout from now expires.
+func leaseTimeoutAt(now time.Duration, timeout time.Duration) time.Duration {
+	if timeout < 0 {
+		return leaseNever
+	}
+
+	return now + timeout
+}
+
+// Ticket event.
+type TicketEvent int
+
+const (
+	// Lock acquired.
+	TicketAcquired TicketEvent = iota + 1
+
+	// Lock acquisition failed.
+	//
+	// The acquisition either timed out or was canceled.
+	TicketAcquisitionFailed
+
+	// Lease timeout changed.
+	TicketLeaseChanged
+
+	// Lock released.
+	TicketReleased
+
+	// Lease expired.
+	TicketLeaseExpired
+)
+
+// Ticket event buffer size.
+//
+// Documented by Ticket.Events, which must be updated along with it.
+const ticketEventBufferSize = 8
+
+// Test if the event is terminal.
+//
+// No further events are emitted for a ticket subsequent to a terminal event.
+func (e TicketEvent) terminal() bool {
+	return e == TicketAcquisitionFailed || e == TicketReleased || e == TicketLeaseExpired
+}
+
+func (e TicketEvent) String() string {
+	switch e {
+	case TicketAcquired:
+		return "acquired"
+	case TicketAcquisitionFailed:
+		return "acquisition_failed"
+	case TicketLeaseChanged:
+		return "lease_changed"
+	case TicketReleased:
+		return "released"
+	case TicketLeaseExpired:
+		return "lease_expired"
+	}
+
+	return "unknown"
+}
+
 // Lock ticket.
 //
 // If the ticket is the current lock holder, it will have its lease timeout set. If not, it will have its acquisition
@@ -14,10 +87,36 @@ type Ticket interface {
 	// Identifies the specific locking attempt or lease.
 	Id() int64
 
+	// Fencing token.
+	//
+	// Set once the lock is acquired, and zero until then. The fencing token of a path strictly increases every time
+	// the lock changes hands, so downstream storage can reject writes from a holder whose lease has expired by
+	// comparing tokens.
+	Fence() int64
+
 	// Acquired.
 	//
-	// Channel that will eventually emit the state of the acquisition attempt of the ticket.
+	// Channel that will eventually emit the state of the acquisition attempt of the ticket. This is derived from the
+	// acquisition events of the ticket, and is unaffected by the buffering of events.
 	Acquired() <-chan bool
+
+	// Events.
+	//
+	// Channel emitting the lifecycle events of the ticket in order. The channel buffers up to 8 events, and delivery
+	// is reliable for as long as no more events are pending: every event is delivered exactly once and in order. If the
+	// buffer is full when a new event is emitted, the oldest undelivered event is discarded in favor of the new event,
+	// so a consumer falling behind, such as by extending a lease many times without receiving, misses the oldest
+	// events, but is guaranteed to observe the most recent ones, including the terminal event. The acquisition state is
+	// never lost, see Acquired. The channel is closed subsequent to a terminal event, ie. failed acquisition, release
+	// or lease expiry.
+	Events() <-chan TicketEvent
+
+	// Contended.
+	//
+	// Channel that is closed the first time another acquisition waits for the lock while the ticket holds it, whether
+	// the acquisition queues behind the ticket, or the ticket is promoted ahead of waiting acquisitions. Contention is
+	// advisory, so a holder may finish early to let others have the lock, and is signaled only once per ticket.
+	Contended() <-chan struct{}
 }
 
 // Lock ticket implementation.
@@ -25,23 +124,195 @@ type ticketImpl struct {
 	// Lease ID.
 	id int64
 
+	// Lock mode.
+	mode LockMode
+
+	// Fencing token.
+	fence int64
+
+	// Owner identity.
+	owner string
+
+	// Labels.
+	//
+	// Immutable once the ticket is created.
+	labels map[string]string
+
+	// Hold count.
+	//
+	// The number of times the ticket holds the lock, which is greater than one if the lock is re-entered by the owner.
+	holdCount int
+
 	// First lease timeout upon acquisition.
 	firstLeaseTimeout time.Duration
 
 	// Acquisition notification channel.
 	acquiredChan chan bool
 
+	// Event notification channel.
+	eventChan chan TicketEvent
+
+	// Whether the event notification channel is closed.
+	eventChanClosed bool
+
+	// Acquisition settlement channel.
+	//
+	// Closed once the ticket has either acquired the lock or failed to do so.
+	settledChan chan struct{}
+
+	// Whether the acquisition settlement channel is closed.
+	settledChanClosed bool
+
+	// Contention channel.
+	//
+	// Closed once another acquisition waits for the lock held by the ticket.
+	contendedChan chan struct{}
+
+	// Whether the contention channel is closed.
+	contendedChanClosed bool
+
+	// Upgrade settlement channel.
+	//
+	// Set while the ticket holds the lock in shared mode and waits to upgrade it to exclusive mode, and emits whether
+	// the upgrade succeeded once it is settled.
+	upgradeChan chan bool
+
+	// Creation time as a monotonic timestamp.
+	createdAt time.Duration
+
+	// Acquisition time as a monotonic timestamp.
+	acquiredAt time.Duration
+
+	// Acquisition time as a wall clock timestamp.
+	//
+	// Recorded upon acquisition rather than derived from the monotonic timestamp when inspected, so it does not drift
+	// as the wall clock is adjusted while the lock is held.
+	acquiredAtWall time.Time
+
 	// Acquisition timeout as a monotonic timestamp.
 	acquireTimeoutAt time.Duration
 
 	// Lease timeout as a monotonic timestamp.
 	leaseTimeoutAt time.Duration
+
+	// Trace span of the acquisition.
+	//
+	// Only set if the acquisition is traced by a recording span.
+	span trace.Span
+}
+
+// New ticket.
+func newTicket(id int64, mode LockMode, firstLeaseTimeout time.Duration) *ticketImpl {
+	return &ticketImpl{
+		id:                id,
+		mode:              mode,
+		holdCount:         1,
+		firstLeaseTimeout: firstLeaseTimeout,
+		acquiredChan:      make(chan bool, 1),
+		eventChan:         make(chan TicketEvent, ticketEventBufferSize),
+		settledChan:       make(chan struct{}),
+		contendedChan:     make(chan struct{}),
+	}
+}
+
+// Add an event to the trace span of the acquisition.
+//
+// Does nothing if the acquisition is not traced.
+func (t *ticketImpl) addSpanEvent(name string) {
+	if t.span != nil {
+		t.span.AddEvent(name)
+	}
+}
+
+// Settle a pending upgrade.
+//
+// Does nothing if the ticket is not waiting to upgrade. This assumes lock to the path is provided during the process.
+func (t *ticketImpl) settleUpgrade(upgraded bool) {
+	if t.upgradeChan == nil {
+		return
+	}
+
+	t.upgradeChan <- upgraded
+	t.upgradeChan = nil
+}
+
+// Notify of the acquisition state.
+//
+// The notification is dropped if a notification is already pending, so the manager never blocks on a consumer that does
+// not receive from the channel. This assumes lock to the path is provided during the process.
+func (t *ticketImpl) notifyAcquired(acquired bool) {
+	select {
+	case t.acquiredChan <- acquired:
+	default:
+	}
 }
 
 func (t *ticketImpl) Id() int64 {
 	return t.id
 }
 
+func (t *ticketImpl) Fence() int64 {
+	return t.fence
+}
+
 func (t *ticketImpl) Acquired() <-chan bool {
 	return t.acquiredChan
 }
+
+func (t *ticketImpl) Events() <-chan TicketEvent {
+	return t.eventChan
+}
+
+func (t *ticketImpl) Contended() <-chan struct{} {
+	return t.contendedChan
+}
+
+// Signal contention.
+//
+// Does nothing if contention was already signaled. This assumes lock to the path is provided during the process.
+func (t *ticketImpl) contend() {
+	if !t.contendedChanClosed {
+		close(t.contendedChan)
+		t.contendedChanClosed = true
+	}
+}
+
+// Emit an event.
+//
+// This assumes lock to the path is provided during the process, and thus that the manager is the only sender on the
+// ticket's channels.
+func (t *ticketImpl) emit(event TicketEvent) {
+	if t.eventChanClosed {
+		return
+	}
+
+	select {
+	case t.eventChan <- event:
+	default:
+		// Coalesce by discarding the oldest undelivered event. As the consumer can only make room in the buffer, the
+		// subsequent send is guaranteed not to block.
+		select {
+		case <-t.eventChan:
+		default:
+		}
+
+		t.eventChan <- event
+	}
+
+	switch event {
+	case TicketAcquired:
+		t.notifyAcquired(true)
+	case TicketAcquisitionFailed:
+		t.notifyAcquired(false)
+	}
+
+	if (event == TicketAcquired || event == TicketAcquisitionFailed) && !t.settledChanClosed {
+		close(t.settledChan)
+		t.settledChanClosed = true
+	}
+
+	if event.terminal() {
+		close(t.eventChan)
+		t.eventChanClosed = true
+	}
+}
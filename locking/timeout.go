@@ -0,0 +1,90 @@
+package locking
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// Lease timeout is out of the configured range.
+	ErrLeaseTimeoutOutOfRange = errors.New("lease timeout out of range")
+
+	// Lock timeout is out of the configured range.
+	ErrLockTimeoutOutOfRange = errors.New("lock timeout out of range")
+)
+
+// Timeout policy.
+//
+// Determines how timeouts outside of the configured range are treated.
+type TimeoutPolicy int
+
+const (
+	// Clamp policy.
+	//
+	// Timeouts outside of the range are clamped to the nearest limit. This is the default.
+	TimeoutPolicyClamp TimeoutPolicy = iota
+
+	// Reject policy.
+	//
+	// Timeouts outside of the range are rejected with ErrLeaseTimeoutOutOfRange or ErrLockTimeoutOutOfRange.
+	TimeoutPolicyReject
+)
+
+// Timeout limits.
+//
+// Zero limits are disabled.
+type timeoutLimits struct {
+	minLeaseTimeout time.Duration
+	maxLeaseTimeout time.Duration
+	maxLockTimeout  time.Duration
+	policy          TimeoutPolicy
+}
+
+// Limit a lease timeout.
+//
+// Infinite lease timeouts exceed any maximum lease timeout.
+func (l timeoutLimits) limitLease(leaseTimeout time.Duration) (time.Duration, error) {
+	if l.maxLeaseTimeout > 0 && (leaseTimeout < 0 || leaseTimeout > l.maxLeaseTimeout) {
+		if l.policy == TimeoutPolicyReject {
+			return leaseTimeout, ErrLeaseTimeoutOutOfRange
+		}
+
+		return l.maxLeaseTimeout, nil
+	}
+
+	if leaseTimeout >= 0 && leaseTimeout < l.minLeaseTimeout {
+		if l.policy == TimeoutPolicyReject {
+			return leaseTimeout, ErrLeaseTimeoutOutOfRange
+		}
+
+		return l.minLeaseTimeout, nil
+	}
+
+	return leaseTimeout, nil
+}
+
+// Limit the timeout of a shortened lease.
+//
+// Positive lease timeouts below the minimum lease timeout are clamped to it regardless of the policy, so a lease is not
+// shortened so far that it is effectively released by accident. Zero lease timeouts are taken as intended, and left
+// untouched.
+func (l timeoutLimits) limitShortenedLease(leaseTimeout time.Duration) time.Duration {
+	if leaseTimeout > 0 && leaseTimeout < l.minLeaseTimeout {
+		return l.minLeaseTimeout
+	}
+
+	return leaseTimeout
+}
+
+// Limit a lock timeout.
+func (l timeoutLimits) limitLock(lockTimeout time.Duration) (time.Duration, error) {
+	if l.maxLockTimeout > 0 && lockTimeout > l.maxLockTimeout {
+		if l.policy == TimeoutPolicyReject {
+			return lockTimeout, ErrLockTimeoutOutOfRange
+		}
+
+		return l.maxLockTimeout, nil
+	}
+
+	return lockTimeout, nil
+}
@@ -0,0 +1,150 @@
+package locking
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Write-ahead log.
+//
+// Journals the holders of locks as an append-only log of JSON records, one per line. Waiting acquisitions are not
+// journaled, as the acquirers waiting for them do not survive a restart of the manager either. Records are written one
+// at a time, as records of different paths may be appended concurrently.
+type wal struct {
+	path string
+
+	sync sync.Mutex
+	file *os.File
+}
+
+// New write-ahead log.
+func newWAL(path string) *wal {
+	return &wal{
+		path: path,
+	}
+}
+
+// Restore the holders.
+//
+// Replays the log if it exists, and subsequently compacts it to the records of the holders whose leases have not
+// expired. A partially written last record, as left by a crash, is ignored.
+func (w *wal) Restore(now time.Time) ([]JournalRecord, error) {
+	holders, err := replayWAL(w.path, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.Compact(holders); err != nil {
+		return nil, err
+	}
+
+	return holders, nil
+}
+
+// Replay a write-ahead log.
+func replayWAL(path string, now time.Time) ([]JournalRecord, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var holders []JournalRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+
+	for scanner.Scan() {
+		var record JournalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			break
+		}
+
+		holders = ApplyJournalRecord(holders, record)
+	}
+
+	if err := scanner.Err(); err != nil && err != bufio.ErrTooLong {
+		return nil, err
+	}
+
+	// Drop the holders whose leases have expired in the meantime.
+	return ExpireJournalHolders(holders, now), nil
+}
+
+// Append a record to the log.
+func (w *wal) Append(record JournalRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	w.sync.Lock()
+	defer w.sync.Unlock()
+
+	_, err = w.file.Write(append(data, '\n'))
+	return err
+}
+
+// Compact the log.
+//
+// Writes a snapshot of the given holder records to a fresh log, which atomically replaces the current log.
+func (w *wal) Compact(holders []JournalRecord) error {
+	tempPath := filepath.Join(filepath.Dir(w.path), "."+filepath.Base(w.path)+".tmp")
+
+	file, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	for _, holder := range holders {
+		if err = encoder.Encode(holder); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := os.Rename(tempPath, w.path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	// Continue appending to the compacted log.
+	nextFile, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	w.sync.Lock()
+	defer w.sync.Unlock()
+
+	if w.file != nil {
+		w.file.Close()
+	}
+
+	w.file = nextFile
+	return nil
+}
@@ -0,0 +1,54 @@
+package locking
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReplayWAL(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "wal")
+	now := time.Unix(1000, 0)
+
+	log := `{"op":"hold","path":"a","id":1,"fence":10,"lease_until":1010000000000}
+{"op":"hold","path":"b","id":2,"fence":11,"lease_until":999000000000}
+{"op":"mode","path":"b","id":2,"mode":1,"fence":14}
+{"op":"hold","path":"c","id":3,"mode":1,"fence":12,"owner":"worker","labels":{"host":"a"},"lease_until":1010000000000}
+{"op":"hold_count","path":"c","id":3,"hold_count":2}
+{"op":"lease","path":"b","id":2,"lease_until":1020000000000}
+{"op":"hold","path":"a","id":4,"fence":13,"lease_until":1010000000000}
+{"op":"release","path":"a","id":1}
+{"op":"hold","path":"d","id":5,"fe`
+
+	if err := ioutil.WriteFile(walPath, []byte(log), 0600); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+
+	holders, err := replayWAL(walPath, now)
+	if err != nil {
+		t.Fatalf("Failed to replay log: %v", err)
+	}
+
+	expected := []JournalRecord{
+		{Op: JournalOpHold, Path: "b", Id: 2, Mode: ModeShared, Fence: 14, LeaseUntil: 1020000000000},
+		{Op: JournalOpHold, Path: "c", Id: 3, Mode: ModeShared, Fence: 12, Owner: "worker", Labels: map[string]string{"host": "a"}, HoldCount: 2, LeaseUntil: 1010000000000},
+		{Op: JournalOpHold, Path: "a", Id: 4, Fence: 13, LeaseUntil: 1010000000000},
+	}
+
+	if len(holders) != len(expected) {
+		t.Fatalf("Expected %d holders, got %v", len(expected), holders)
+	}
+	for idx := range expected {
+		if !reflect.DeepEqual(holders[idx], expected[idx]) {
+			t.Errorf("Expected holder #%d to be %v, got %v", idx+1, expected[idx], holders[idx])
+		}
+	}
+
+	// Test replaying a nonexistent log.
+	holders, err = replayWAL(filepath.Join(t.TempDir(), "missing"), now)
+	if err != nil || len(holders) != 0 {
+		t.Fatalf("Expected no holders for nonexistent log")
+	}
+}
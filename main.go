@@ -6,6 +6,7 @@ import (
 
 	"github.com/mitchellh/cli"
 
+	"lockerd/command/lock"
 	"lockerd/command/server"
 	"lockerd/command/version"
 )
@@ -34,6 +35,11 @@ func realMain() int {
 		Args: args,
 		//Commands:     cmds,
 		Commands: map[string]cli.CommandFactory{
+			"acquire": lock.NewAcquireFactory(ui),
+			"extend":  lock.NewExtendFactory(ui),
+			"hold":    lock.NewHoldFactory(ui),
+			"inspect": lock.NewInspectFactory(ui),
+			"release": lock.NewReleaseFactory(ui),
 			"server":  server.NewFactory(ui),
 			"version": version.NewFactory(ui),
 		},